@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// LoadAWSConfig loads the configuration of the AWS SDK's default chain:
+// credentials from the environment, the shared config and credentials
+// files (AWS_PROFILE, SSO, assume role, credential_process), web identity
+// tokens, and the ECS task or EC2 instance role. region, if not empty,
+// overrides the region of the environment and shared config. Credentials
+// are resolved on the first request and cached until they expire.
+func LoadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("aws config: %w", err)
+	}
+	return cfg, nil
+}
+
+// signV4 signs req, whose body is body, with AWS Signature Version 4 using
+// the credentials of cfg.
+func signV4(ctx context.Context, req *http.Request, body []byte, cfg aws.Config, service string, now time.Time) error {
+	if cfg.Credentials == nil {
+		return errors.New("aws credentials: none configured")
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("aws credentials: %w", err)
+	}
+	payload := sha256.Sum256(body)
+	return v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payload[:]), service, cfg.Region, now)
+}
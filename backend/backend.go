@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotSupported is returned by optional interface methods when the
+// backend implements the interface but the feature is not configured
+// for this particular system.
+var ErrNotSupported = errors.New("not supported by backend")
+
+// ErrStateUnknown is wrapped by the error of a state query when the device
+// reports that its state is unknown, e.g. a smart plug that dropped off
+// the network. The server then serves the last known state and refuses
+// power actions rather than take the system for off.
+var ErrStateUnknown = errors.New("power state unknown")
+
+// Backend is the original backend interface: PowerOn and PowerOff plus
+// the optional interfaces below. The server drives it through Adapt; new
+// backends may implement System directly.
+type Backend interface {
+	PowerOn(ctx context.Context) error
+	PowerOff(ctx context.Context) error
+}
+
+// PowerStateProvider is an optional interface that backends can implement
+// to report the current power state. If not implemented, the server
+// will rely on last known in-memory state.
+type PowerStateProvider interface {
+	CurrentState(ctx context.Context) (on bool, err error)
+}
+
+// Redfish PowerStates of a system in transition.
+const (
+	PowerStatePoweringOn  = "PoweringOn"
+	PowerStatePoweringOff = "PoweringOff"
+)
+
+// TransitionalStateProvider is an optional interface for backends that can
+// tell a system is still powering on or off. on is the state the system is
+// in or heading to; transition is PowerStatePoweringOn,
+// PowerStatePoweringOff or empty when the system has settled.
+type TransitionalStateProvider interface {
+	PowerStateDetail(ctx context.Context) (on bool, transition string, err error)
+}
+
+// GracefulPowerOffer is an optional interface for backends that
+// distinguish an orderly shutdown from a hard power off. GracefulShutdown
+// resets call GracefulPowerOff; PowerOff is then the forced variant.
+type GracefulPowerOffer interface {
+	GracefulPowerOff(ctx context.Context) error
+}
+
+// ResetCapabilities is an optional interface for backends that implement
+// some Redfish ResetTypes natively, e.g. a hardware reset instead of the
+// shim's off-sleep-on sequence. NativeResetTypes lists them; Reset is only
+// called with one of those.
+type ResetCapabilities interface {
+	NativeResetTypes() []string
+	Reset(ctx context.Context, resetType string) error
+}
+
+// RetryableError marks a temporary failure, e.g. an API rate limit, that a
+// client may retry after RetryAfter (zero if unknown).
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// NameProvider is an optional interface that backends can implement
+// to supply a friendly display name for the system.
+type NameProvider interface {
+	DisplayName(ctx context.Context) (string, error)
+}
+
+// OemProvider is an optional interface for backends that can expose
+// details useful for debugging, such as the entity or host they control.
+// The shim renders them under Oem.BmcShim.Backend of the System and
+// Chassis resources unless told to hide them.
+type OemProvider interface {
+	Oem(ctx context.Context) (map[string]any, error)
+}
+
+// HealthChecker is an optional interface that backends can implement
+// to report their health status.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// Reconnector is an optional interface for backends that hold persistent
+// connections. Reconnect drops and re-establishes them, e.g. on a
+// Manager.Reset of the shim.
+type Reconnector interface {
+	Reconnect(ctx context.Context) error
+}
+
+// Starter is an optional interface for backends that hold connections.
+// Their constructors only validate the configuration; the server calls
+// Start when it starts to establish the connections, and again until it
+// succeeds, serving the system from cached state meanwhile.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// PowerMetrics is a point-in-time power reading. Nil fields are unknown
+// (not configured, unavailable, or stale) and must not be reported.
+type PowerMetrics struct {
+	Watts     *float64
+	EnergyKWh *float64
+}
+
+// PowerMetricsProvider is an optional interface that backends can implement
+// to report power consumption. Implementations return ErrNotSupported when
+// no metrics source is configured for the system.
+type PowerMetricsProvider interface {
+	PowerMetrics(ctx context.Context) (PowerMetrics, error)
+}
+
+// TemperatureReading is a single named temperature sensor. A nil Celsius
+// means the sensor is currently unavailable.
+type TemperatureReading struct {
+	Name    string
+	Celsius *float64
+}
+
+// ThermalProvider is an optional interface that backends can implement to
+// report temperature readings. Implementations return ErrNotSupported when
+// no sensors are configured for the system. Individual unavailable sensors
+// are reported with a nil reading instead of failing the whole call.
+type ThermalProvider interface {
+	Temperatures(ctx context.Context) ([]TemperatureReading, error)
+}
+
+// IndicatorLED states as defined by Redfish.
+const (
+	IndicatorOff      = "Off"
+	IndicatorLit      = "Lit"
+	IndicatorBlinking = "Blinking"
+)
+
+// IndicatorProvider is an optional interface that backends can implement to
+// drive a locator light for the system. IndicatorLED returns ErrNotSupported
+// when no indicator is configured for the system; SetIndicatorLED returns
+// ErrNotSupported for states the indicator cannot display.
+type IndicatorProvider interface {
+	IndicatorLED(ctx context.Context) (string, error)
+	SetIndicatorLED(ctx context.Context, state string) error
+}
+
+// BootOptions is the boot configuration a client requested for a system.
+// Values use the Redfish enumerations (e.g. OverrideTarget "Pxe").
+type BootOptions struct {
+	OverrideTarget  string
+	OverrideEnabled string
+	OverrideMode    string
+	// UefiTarget is the UEFI device path booted when OverrideTarget is
+	// "UefiTarget".
+	UefiTarget string
+	// BootOrder is the persistent boot order, a permutation of (a subset
+	// of) the system's configured boot devices.
+	BootOrder []string
+}
+
+// BootSetter is an optional interface for backends that can apply boot
+// settings to the host. SetBoot may return ErrNotSupported when boot
+// control is not configured for the system, in which case the settings are
+// only kept by the shim.
+type BootSetter interface {
+	SetBoot(ctx context.Context, opts BootOptions) error
+}
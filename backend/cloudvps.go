@@ -0,0 +1,288 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vpsProvider adapts CloudVPS to one provider's API.
+type vpsProvider interface {
+	// api is the default API base URL and tokenEnv the environment
+	// variable the provider's CLI reads the token from.
+	api() string
+	tokenEnv() string
+	// act performs PowerOn ("on"), PowerOff ("off"), GracefulPowerOff
+	// ("shutdown") or a native ResetType.
+	act(ctx context.Context, v *CloudVPS, op string) error
+	nativeResets() []ResetType
+	// describe returns the instance label and power state.
+	describe(ctx context.Context, v *CloudVPS) (label string, on bool, transition string, err error)
+}
+
+var vpsProviders = map[string]vpsProvider{
+	"digitalocean": digitalOcean{},
+	"linode":       linode{},
+}
+
+// CloudVPS controls a VPS at a provider with a simple power API
+// (DigitalOcean droplets, Linode instances).
+type CloudVPS struct {
+	provider vpsProvider
+	name     string
+	token    string
+	id       string
+	base     string
+	client   *http.Client
+}
+
+// CloudVPSOption configures optional cloud VPS backend features.
+type CloudVPSOption func(*CloudVPS)
+
+// WithVPSEndpoint overrides the provider's API base URL.
+func WithVPSEndpoint(baseURL string) CloudVPSOption {
+	return func(v *CloudVPS) { v.base = strings.TrimRight(baseURL, "/") }
+}
+
+// NewCloudVPS returns a backend for the instance with the given ID at
+// provider (digitalocean or linode). An empty token falls back to the
+// provider CLI's environment variable.
+func NewCloudVPS(provider, token, id string, opts ...CloudVPSOption) (*CloudVPS, error) {
+	p, ok := vpsProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("cloud-vps backend: unknown provider %q (expected digitalocean or linode)", provider)
+	}
+	if token == "" {
+		token = os.Getenv(p.tokenEnv())
+	}
+	if token == "" {
+		return nil, fmt.Errorf("cloud-vps backend requires an API token (--vps-token or %s)", p.tokenEnv())
+	}
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("cloud-vps backend requires a numeric instance ID, got %q", id)
+	}
+	v := &CloudVPS{
+		provider: p,
+		name:     provider,
+		token:    token,
+		id:       id,
+		base:     p.api(),
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+func (v *CloudVPS) PowerOn(ctx context.Context) error {
+	return v.provider.act(ctx, v, "on")
+}
+
+func (v *CloudVPS) PowerOff(ctx context.Context) error {
+	return v.provider.act(ctx, v, "off")
+}
+
+func (v *CloudVPS) GracefulPowerOff(ctx context.Context) error {
+	return v.provider.act(ctx, v, "shutdown")
+}
+
+// Capabilities adds the restarts the provider carries out natively to the
+// standard resets.
+func (v *CloudVPS) Capabilities() Capability {
+	return capabilities(v, v.provider.nativeResets()...)
+}
+
+// Reset hands the provider's native ResetTypes to its API.
+func (v *CloudVPS) Reset(ctx context.Context, t ResetType) error {
+	if slices.Contains(v.provider.nativeResets(), t) {
+		return v.provider.act(ctx, v, string(t))
+	}
+	return standardReset(ctx, v, t)
+}
+
+func (v *CloudVPS) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, v)
+}
+
+func (v *CloudVPS) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := v.PowerStateDetail(ctx)
+	return on, err
+}
+
+func (v *CloudVPS) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	_, on, transition, err := v.provider.describe(ctx, v)
+	return on, transition, err
+}
+
+func (v *CloudVPS) DisplayName(ctx context.Context) (string, error) {
+	label, _, _, err := v.provider.describe(ctx, v)
+	return label, err
+}
+
+func (v *CloudVPS) Ping(ctx context.Context) error {
+	_, _, _, err := v.provider.describe(ctx, v)
+	return err
+}
+
+// do performs an API request. Rate limiting is reported as a
+// RetryableError.
+func (v *CloudVPS) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.base+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+v.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// DigitalOcean: {"id": ..., "message": ...}
+		// Linode: {"errors": [{"reason": ...}]}
+		var e struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = json.Unmarshal(b, &e)
+		msg := e.Message
+		if msg == "" && len(e.Errors) > 0 {
+			msg = e.Errors[0].Reason
+		}
+		err := fmt.Errorf("%s instance %s: http %d", v.name, v.id, resp.StatusCode)
+		if msg != "" {
+			err = fmt.Errorf("%s instance %s: http %d: %s", v.name, v.id, resp.StatusCode, msg)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			var after time.Duration
+			if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+				after = time.Duration(secs) * time.Second
+			} else if reset, perr := strconv.ParseInt(resp.Header.Get("Ratelimit-Reset"), 10, 64); perr == nil {
+				after = time.Until(time.Unix(reset, 0))
+			}
+			return &RetryableError{Err: err, RetryAfter: after}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// digitalOcean drives droplets through droplet actions.
+type digitalOcean struct{}
+
+func (digitalOcean) api() string      { return "https://api.digitalocean.com/v2" }
+func (digitalOcean) tokenEnv() string { return "DIGITALOCEAN_TOKEN" }
+
+func (digitalOcean) nativeResets() []ResetType {
+	return []ResetType{ResetForceRestart, ResetGracefulRestart}
+}
+
+func (digitalOcean) act(ctx context.Context, v *CloudVPS, op string) error {
+	typ, ok := map[string]string{
+		"on":              "power_on",
+		"off":             "power_off",
+		"shutdown":        "shutdown",
+		"ForceRestart":    "power_cycle",
+		"GracefulRestart": "reboot",
+	}[op]
+	if !ok {
+		return ErrNotSupported
+	}
+	return v.do(ctx, http.MethodPost, "/droplets/"+v.id+"/actions", map[string]string{"type": typ}, nil)
+}
+
+func (digitalOcean) describe(ctx context.Context, v *CloudVPS) (string, bool, string, error) {
+	var body struct {
+		Droplet struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"droplet"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/droplets/"+v.id, nil, &body); err != nil {
+		return "", false, "", err
+	}
+	d := body.Droplet
+	switch d.Status {
+	case "active":
+		return d.Name, true, "", nil
+	case "new":
+		return d.Name, true, PowerStatePoweringOn, nil
+	case "off", "archive":
+		return d.Name, false, "", nil
+	default:
+		return d.Name, false, "", fmt.Errorf("digitalocean droplet %s: unknown status %q", v.id, d.Status)
+	}
+}
+
+// linode drives Linode instances. Linode has no hard power off, so
+// PowerOff is a shutdown too.
+type linode struct{}
+
+func (linode) api() string      { return "https://api.linode.com/v4" }
+func (linode) tokenEnv() string { return "LINODE_TOKEN" }
+
+func (linode) nativeResets() []ResetType {
+	return []ResetType{ResetForceRestart}
+}
+
+func (linode) act(ctx context.Context, v *CloudVPS, op string) error {
+	verb, ok := map[string]string{
+		"on":           "boot",
+		"off":          "shutdown",
+		"shutdown":     "shutdown",
+		"ForceRestart": "reboot",
+	}[op]
+	if !ok {
+		return ErrNotSupported
+	}
+	return v.do(ctx, http.MethodPost, "/linode/instances/"+v.id+"/"+verb, struct{}{}, nil)
+}
+
+func (linode) describe(ctx context.Context, v *CloudVPS) (string, bool, string, error) {
+	var inst struct {
+		Label  string `json:"label"`
+		Status string `json:"status"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/linode/instances/"+v.id, nil, &inst); err != nil {
+		return "", false, "", err
+	}
+	switch inst.Status {
+	case "running":
+		return inst.Label, true, "", nil
+	case "booting", "rebooting", "provisioning":
+		return inst.Label, true, PowerStatePoweringOn, nil
+	case "shutting_down":
+		return inst.Label, false, PowerStatePoweringOff, nil
+	case "offline", "stopped":
+		return inst.Label, false, "", nil
+	default:
+		return inst.Label, false, "", fmt.Errorf("linode instance %s: unknown status %q", v.id, inst.Status)
+	}
+}
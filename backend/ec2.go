@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	ec2APIVersion = "2016-11-15"
+	// ec2DescribeTTL is how long one DescribeInstances answer is reused,
+	// so polling many systems of an account costs a single call.
+	ec2DescribeTTL = 5 * time.Second
+	// ec2DescribeBatch is the number of instance IDs per DescribeInstances.
+	ec2DescribeBatch = 1000
+	// ec2Attempts is how often a throttled request is tried.
+	ec2Attempts = 4
+)
+
+// EC2Client is a minimal EC2 Query API client shared by all systems of a
+// region. It batches DescribeInstances for the instances registered with
+// it and retries throttled requests.
+type EC2Client struct {
+	cfg      aws.Config
+	endpoint string
+	client   *http.Client
+
+	mu        sync.Mutex
+	ids       []string
+	described time.Time
+	instances map[string]ec2Instance
+	err       error
+}
+
+// NewEC2Client returns a client for the region and credentials of cfg,
+// see LoadAWSConfig. endpoint overrides the regional endpoint, e.g. for a
+// VPC endpoint.
+func NewEC2Client(cfg aws.Config, endpoint string) (*EC2Client, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("ec2 backend requires a region (--aws-region, AWS_REGION, AWS_DEFAULT_REGION or the shared config)")
+	}
+	if endpoint == "" {
+		endpoint = "https://ec2." + cfg.Region + ".amazonaws.com/"
+	}
+	return &EC2Client{
+		cfg:       cfg,
+		endpoint:  endpoint,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		instances: map[string]ec2Instance{},
+	}, nil
+}
+
+// EC2 controls one EC2 instance: PowerOn starts and PowerOff force-stops
+// it; GracefulPowerOff is a normal stop.
+type EC2 struct {
+	c  *EC2Client
+	id string
+}
+
+// NewEC2 returns a backend for the instance with the given ID.
+func NewEC2(c *EC2Client, instanceID string) (*EC2, error) {
+	if !strings.HasPrefix(instanceID, "i-") {
+		return nil, fmt.Errorf("ec2 backend requires an instance ID (i-...), got %q", instanceID)
+	}
+	c.mu.Lock()
+	c.ids = append(c.ids, instanceID)
+	c.mu.Unlock()
+	return &EC2{c: c, id: instanceID}, nil
+}
+
+func (e *EC2) PowerOn(ctx context.Context) error {
+	return e.c.act(ctx, "StartInstances", url.Values{"InstanceId.1": {e.id}})
+}
+
+func (e *EC2) PowerOff(ctx context.Context) error {
+	return e.c.act(ctx, "StopInstances", url.Values{"InstanceId.1": {e.id}, "Force": {"true"}})
+}
+
+func (e *EC2) GracefulPowerOff(ctx context.Context) error {
+	return e.c.act(ctx, "StopInstances", url.Values{"InstanceId.1": {e.id}})
+}
+
+func (e *EC2) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := e.PowerStateDetail(ctx)
+	return on, err
+}
+
+// PowerStateDetail maps the instance state; pending and stopping are
+// reported as transitions.
+func (e *EC2) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	inst, err := e.c.describe(ctx, e.id)
+	if err != nil {
+		return false, "", err
+	}
+	switch inst.State.Name {
+	case "running":
+		return true, "", nil
+	case "pending":
+		return true, PowerStatePoweringOn, nil
+	case "stopping", "shutting-down":
+		return false, PowerStatePoweringOff, nil
+	case "stopped", "terminated":
+		return false, "", nil
+	default:
+		return false, "", fmt.Errorf("ec2 instance %s: unknown state %q", e.id, inst.State.Name)
+	}
+}
+
+// DisplayName returns the instance's Name tag.
+func (e *EC2) DisplayName(ctx context.Context) (string, error) {
+	inst, err := e.c.describe(ctx, e.id)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range inst.Tags {
+		if t.Key == "Name" {
+			return t.Value, nil
+		}
+	}
+	return "", nil
+}
+
+func (e *EC2) Ping(ctx context.Context) error {
+	_, err := e.c.describe(ctx, e.id)
+	return err
+}
+
+type ec2Instance struct {
+	ID    string `xml:"instanceId"`
+	State struct {
+		Name string `xml:"name"`
+	} `xml:"instanceState"`
+	Tags []struct {
+		Key   string `xml:"key"`
+		Value string `xml:"value"`
+	} `xml:"tagSet>item"`
+}
+
+type ec2DescribeResponse struct {
+	Reservations []struct {
+		Instances []ec2Instance `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+}
+
+// act performs a state-changing action and drops the cached instance
+// states, which it made stale.
+func (c *EC2Client) act(ctx context.Context, action string, params url.Values) error {
+	err := c.call(ctx, action, params, nil)
+	c.mu.Lock()
+	c.described = time.Time{}
+	c.mu.Unlock()
+	return err
+}
+
+// describe returns the instance, refreshing all registered instances at
+// most once per ec2DescribeTTL.
+func (c *EC2Client) describe(ctx context.Context, id string) (ec2Instance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.described) > ec2DescribeTTL {
+		c.instances, c.err = c.describeAll(ctx, c.ids)
+		c.described = time.Now()
+	}
+	if c.err != nil {
+		return ec2Instance{}, c.err
+	}
+	inst, ok := c.instances[id]
+	if !ok {
+		return ec2Instance{}, fmt.Errorf("ec2 instance %s not found", id)
+	}
+	return inst, nil
+}
+
+func (c *EC2Client) describeAll(ctx context.Context, ids []string) (map[string]ec2Instance, error) {
+	out := make(map[string]ec2Instance, len(ids))
+	for start := 0; start < len(ids); start += ec2DescribeBatch {
+		batch := ids[start:min(start+ec2DescribeBatch, len(ids))]
+		params := url.Values{}
+		for i, id := range batch {
+			params.Set("InstanceId."+strconv.Itoa(i+1), id)
+		}
+		var resp ec2DescribeResponse
+		err := c.call(ctx, "DescribeInstances", params, &resp)
+		var apiErr *EC2Error
+		if errors.As(err, &apiErr) && apiErr.Code == "InvalidInstanceID.NotFound" && len(batch) > 1 {
+			// One unknown ID fails the whole batch; describe the
+			// instances one by one so the others keep working.
+			for _, id := range batch {
+				m, err := c.describeAll(ctx, []string{id})
+				if err == nil {
+					out[id] = m[id]
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Reservations {
+			for _, inst := range r.Instances {
+				out[inst.ID] = inst
+			}
+		}
+	}
+	return out, nil
+}
+
+// EC2Error is an error returned by the EC2 API.
+type EC2Error struct {
+	Code    string
+	Message string
+}
+
+func (e *EC2Error) Error() string {
+	return "ec2: " + e.Code + ": " + e.Message
+}
+
+// throttled reports whether the request may succeed when retried later.
+func (e *EC2Error) throttled() bool {
+	switch e.Code {
+	case "RequestLimitExceeded", "Throttling", "ThrottlingException", "ServiceUnavailable", "Unavailable", "InternalError":
+		return true
+	}
+	return false
+}
+
+// call performs an EC2 Query API action, retrying throttled requests with
+// exponential backoff, and decodes the XML response into out if not nil.
+func (c *EC2Client) call(ctx context.Context, action string, params url.Values, out any) error {
+	params.Set("Action", action)
+	params.Set("Version", ec2APIVersion)
+	body := []byte(params.Encode())
+	var err error
+	for attempt := 0; attempt < ec2Attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(1<<attempt) * 250 * time.Millisecond):
+			}
+		}
+		err = c.do(ctx, body, out)
+		var apiErr *EC2Error
+		if !errors.As(err, &apiErr) || !apiErr.throttled() {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *EC2Client) do(ctx context.Context, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if err := signV4(ctx, req, body, c.cfg, "ec2", time.Now()); err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []struct {
+				Code    string `xml:"Code"`
+				Message string `xml:"Message"`
+			} `xml:"Errors>Error"`
+		}
+		if xml.Unmarshal(b, &e) == nil && len(e.Errors) > 0 {
+			return &EC2Error{Code: e.Errors[0].Code, Message: e.Errors[0].Message}
+		}
+		return fmt.Errorf("ec2: http %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(b, out)
+}
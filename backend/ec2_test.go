@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCredentialProcessEnv makes the test binary an AWS credential_process
+// printing keys with the variable's value as the access key ID.
+const fakeCredentialProcessEnv = "BMC_SHIM_FAKE_CREDENTIAL_PROCESS"
+
+// isolateAWS points the AWS SDK's default chain at empty files in a
+// temporary directory and disables the instance metadata service, so the
+// tests do not see the credentials of the machine they run on.
+func isolateAWS(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	return dir
+}
+
+// fakeEC2 is an EC2 Query API endpoint knowing the instances in states. It
+// records the actions and Authorization headers of the requests.
+type fakeEC2 struct {
+	states map[string]string
+
+	mu      sync.Mutex
+	actions []string
+	auth    []string
+	tokens  []string
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	params, _ := url.ParseQuery(string(b))
+	f.mu.Lock()
+	f.actions = append(f.actions, params.Get("Action"))
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	f.tokens = append(f.tokens, r.Header.Get("X-Amz-Security-Token"))
+	f.mu.Unlock()
+	if params.Get("Action") != "DescribeInstances" {
+		_, _ = io.WriteString(w, "<Response/>")
+		return
+	}
+	var items strings.Builder
+	for i := 1; params.Has(fmt.Sprintf("InstanceId.%d", i)); i++ {
+		id := params.Get(fmt.Sprintf("InstanceId.%d", i))
+		state, ok := f.states[id]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code><Message>%s</Message></Error></Errors></Response>", id)
+			return
+		}
+		fmt.Fprintf(&items, "<item><instanceId>%s</instanceId><instanceState><name>%s</name></instanceState><tagSet><item><key>Name</key><value>node-%s</value></item></tagSet></item>", id, state, id)
+	}
+	fmt.Fprintf(w, "<DescribeInstancesResponse><reservationSet><item><instancesSet>%s</instancesSet></item></reservationSet></DescribeInstancesResponse>", items.String())
+}
+
+func newTestEC2(t *testing.T, f *fakeEC2, region string) *EC2Client {
+	t.Helper()
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	cfg, err := LoadAWSConfig(context.Background(), region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewEC2Client(cfg, ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEC2Credentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		files     map[string]string
+		wantKey   string
+		wantToken string
+	}{
+		{
+			name:      "environment",
+			env:       map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_SESSION_TOKEN": "session"},
+			wantKey:   "AKIDENV",
+			wantToken: "session",
+		},
+		{
+			name:    "shared credentials profile",
+			env:     map[string]string{"AWS_PROFILE": "lab"},
+			files:   map[string]string{"credentials": "[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = secret\n\n[lab]\naws_access_key_id = AKIDLAB\naws_secret_access_key = secret\n"},
+			wantKey: "AKIDLAB",
+		},
+		{
+			name:    "credential_process",
+			env:     map[string]string{"AWS_PROFILE": "proc"},
+			files:   map[string]string{"config": "[profile proc]\ncredential_process = " + credentialProcess(t) + "\n"},
+			wantKey: "AKIDPROCESS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := isolateAWS(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f := &fakeEC2{states: map[string]string{"i-1": "running"}}
+			sys, err := NewEC2(newTestEC2(t, f, "eu-west-1"), "i-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sys.PowerOn(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			auth := f.auth[0]
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+tt.wantKey+"/") || !strings.Contains(auth, "/eu-west-1/ec2/aws4_request") {
+				t.Errorf("Authorization = %q, want a signature with %s for eu-west-1/ec2", auth, tt.wantKey)
+			}
+			if f.tokens[0] != tt.wantToken {
+				t.Errorf("X-Amz-Security-Token = %q, want %q", f.tokens[0], tt.wantToken)
+			}
+		})
+	}
+}
+
+// credentialProcess returns a credential_process command line running the
+// test binary as the process, see TestMain.
+func credentialProcess(t *testing.T) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(fakeCredentialProcessEnv, "AKIDPROCESS")
+	return `"` + exe + `"`
+}
+
+// fakeCredentialProcess prints the output of an AWS credential_process.
+func fakeCredentialProcess(key string) {
+	fmt.Printf(`{"Version":1,"AccessKeyId":%q,"SecretAccessKey":"secret"}`+"\n", key)
+}
+
+func TestEC2NoCredentials(t *testing.T) {
+	isolateAWS(t)
+	sys, err := NewEC2(newTestEC2(t, &fakeEC2{}, "eu-west-1"), "i-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sys.PowerOn(context.Background()); err == nil || !strings.Contains(err.Error(), "aws credentials") {
+		t.Errorf("PowerOn without credentials = %v, want an aws credentials error", err)
+	}
+}
+
+func TestEC2Region(t *testing.T) {
+	dir := isolateAWS(t)
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte("[default]\nregion = ap-south-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ flag, want string }{{"", "ap-south-1"}, {"us-east-2", "us-east-2"}} {
+		cfg, err := LoadAWSConfig(context.Background(), tt.flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Region != tt.want {
+			t.Errorf("region with --aws-region %q = %q, want %q", tt.flag, cfg.Region, tt.want)
+		}
+	}
+
+	_ = os.Remove(filepath.Join(dir, "config"))
+	cfg, err := LoadAWSConfig(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEC2Client(cfg, ""); err == nil {
+		t.Error("NewEC2Client without a region succeeded")
+	}
+}
+
+func TestEC2DescribeBatch(t *testing.T) {
+	isolateAWS(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	f := &fakeEC2{states: map[string]string{"i-1": "running", "i-2": "stopping"}}
+	c := newTestEC2(t, f, "eu-west-1")
+	var systems []*EC2
+	for _, id := range []string{"i-1", "i-2", "i-missing"} {
+		sys, err := NewEC2(c, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		systems = append(systems, sys)
+	}
+	ctx := context.Background()
+	for _, tt := range []struct {
+		sys        *EC2
+		on         bool
+		transition string
+	}{{systems[0], true, ""}, {systems[1], false, PowerStatePoweringOff}} {
+		on, transition, err := tt.sys.PowerStateDetail(ctx)
+		if err != nil || on != tt.on || transition != tt.transition {
+			t.Errorf("%s state = %v %q %v, want %v %q", tt.sys.id, on, transition, err, tt.on, tt.transition)
+		}
+	}
+	if name, err := systems[0].DisplayName(ctx); err != nil || name != "node-i-1" {
+		t.Errorf("DisplayName = %q %v, want node-i-1", name, err)
+	}
+	if err := systems[2].Ping(ctx); err == nil {
+		t.Error("Ping of an unknown instance succeeded")
+	}
+	// One batch failing on the unknown ID, then one call per instance;
+	// the later reads are answered from the cache.
+	if want := []string{"DescribeInstances", "DescribeInstances", "DescribeInstances", "DescribeInstances"}; strings.Join(f.actions, ",") != strings.Join(want, ",") {
+		t.Errorf("actions = %v, want %v", f.actions, want)
+	}
+}
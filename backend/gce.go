@@ -0,0 +1,208 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const gceAPI = "https://compute.googleapis.com/compute/v1"
+
+// GCE controls a Google Compute Engine VM: PowerOn starts and PowerOff
+// stops the instance.
+type GCE struct {
+	creds    *GoogleCredentials
+	project  string
+	zone     string
+	instance string
+	api      string
+	wait     time.Duration
+	client   *http.Client
+}
+
+// GCEOption configures optional GCE backend features.
+type GCEOption func(*GCE)
+
+// WithGCEWait makes PowerOn and PowerOff wait up to timeout for the
+// start/stop operation to finish instead of returning once it is accepted.
+func WithGCEWait(timeout time.Duration) GCEOption {
+	return func(g *GCE) { g.wait = timeout }
+}
+
+// WithGCEEndpoint overrides the Compute API base URL, e.g. for a private
+// service connect endpoint.
+func WithGCEEndpoint(baseURL string) GCEOption {
+	return func(g *GCE) { g.api = strings.TrimRight(baseURL, "/") }
+}
+
+// NewGCE returns a backend for the instance given as project/zone/name.
+func NewGCE(creds *GoogleCredentials, instance string, opts ...GCEOption) (*GCE, error) {
+	parts := strings.Split(instance, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("gce backend requires an instance of the form project/zone/name, got %q", instance)
+	}
+	if creds == nil {
+		return nil, fmt.Errorf("gce backend requires credentials")
+	}
+	g := &GCE{
+		creds:    creds,
+		project:  parts[0],
+		zone:     parts[1],
+		instance: parts[2],
+		api:      gceAPI,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, nil
+}
+
+func (g *GCE) PowerOn(ctx context.Context) error {
+	return g.act(ctx, "start")
+}
+
+func (g *GCE) PowerOff(ctx context.Context) error {
+	return g.act(ctx, "stop")
+}
+
+// CurrentState maps the instance status to on/off. Transitional states
+// count as the state they are heading to.
+func (g *GCE) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := g.PowerStateDetail(ctx)
+	return on, err
+}
+
+func (g *GCE) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	inst, err := g.fetchInstance(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	switch inst.Status {
+	case "RUNNING", "REPAIRING":
+		return true, "", nil
+	case "PROVISIONING", "STAGING":
+		return true, PowerStatePoweringOn, nil
+	case "STOPPING", "SUSPENDING":
+		return false, PowerStatePoweringOff, nil
+	case "SUSPENDED", "TERMINATED":
+		return false, "", nil
+	default:
+		return false, "", fmt.Errorf("gce instance %s: unknown status %q", g.instance, inst.Status)
+	}
+}
+
+func (g *GCE) DisplayName(ctx context.Context) (string, error) {
+	inst, err := g.fetchInstance(ctx)
+	if err != nil {
+		return "", err
+	}
+	return inst.Name, nil
+}
+
+func (g *GCE) Ping(ctx context.Context) error {
+	_, err := g.fetchInstance(ctx)
+	return err
+}
+
+type gceInstance struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// gceOperation is the subset of a zonal Operation the backend uses.
+type gceOperation struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  *struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+func (op *gceOperation) err() error {
+	if op.Error == nil || len(op.Error.Errors) == 0 {
+		return nil
+	}
+	e := op.Error.Errors[0]
+	return fmt.Errorf("gce operation %s: %s: %s", op.Name, e.Code, e.Message)
+}
+
+func (g *GCE) instanceURL() string {
+	return fmt.Sprintf("%s/projects/%s/zones/%s/instances/%s", g.api, g.project, g.zone, g.instance)
+}
+
+// act issues a start or stop and, if configured, waits for the operation.
+func (g *GCE) act(ctx context.Context, verb string) error {
+	var op gceOperation
+	if err := g.do(ctx, http.MethodPost, g.instanceURL()+"/"+verb, &op); err != nil {
+		return err
+	}
+	if err := op.err(); err != nil {
+		return err
+	}
+	if g.wait <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.wait)
+	defer cancel()
+	// operations.wait returns after at most two minutes even if the
+	// operation is still running.
+	for op.Status != "DONE" {
+		u := fmt.Sprintf("%s/projects/%s/zones/%s/operations/%s/wait", g.api, g.project, g.zone, op.Name)
+		if err := g.do(ctx, http.MethodPost, u, &op); err != nil {
+			return fmt.Errorf("gce instance %s: waiting for %s: %w", g.instance, verb, err)
+		}
+	}
+	return op.err()
+}
+
+func (g *GCE) fetchInstance(ctx context.Context) (*gceInstance, error) {
+	var inst gceInstance
+	if err := g.do(ctx, http.MethodGet, g.instanceURL(), &inst); err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+func (g *GCE) do(ctx context.Context, method, u string, out any) error {
+	token, err := g.creds.Token(ctx)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if method == http.MethodPost {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(b, &e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("gce instance %s: http %d: %s", g.instance, resp.StatusCode, e.Error.Message)
+		}
+		return fmt.Errorf("gce instance %s: http %d", g.instance, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
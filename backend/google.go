@@ -0,0 +1,204 @@
+package backend
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	googleComputeAPI  = "https://www.googleapis.com/auth/compute"
+)
+
+// GoogleCredentials hands out OAuth2 access tokens for the Google Cloud
+// APIs. Tokens are cached and refreshed shortly before they expire, so a
+// single GoogleCredentials can be shared by all systems of a project.
+type GoogleCredentials struct {
+	client *http.Client
+	fetch  func(ctx context.Context) (*http.Request, error)
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// googleCredentialsFile is the subset of a service account key or an
+// application default credentials file the shim understands.
+type googleCredentialsFile struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// NewGoogleCredentials loads credentials from a service account key file.
+// With an empty keyFile the application default credentials are used:
+// GOOGLE_APPLICATION_CREDENTIALS, then the gcloud ADC file, then the
+// metadata server of the VM the shim runs on.
+func NewGoogleCredentials(keyFile string) (*GoogleCredentials, error) {
+	c := &GoogleCredentials{client: &http.Client{Timeout: 15 * time.Second}}
+	if keyFile == "" {
+		keyFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if keyFile == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			adc := filepath.Join(dir, "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(adc); err == nil {
+				keyFile = adc
+			}
+		}
+	}
+	if keyFile == "" {
+		c.fetch = func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleMetadataURL, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Metadata-Flavor", "Google")
+			return req, nil
+		}
+		return c, nil
+	}
+
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("google credentials: %w", err)
+	}
+	var f googleCredentialsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("google credentials %s: %w", keyFile, err)
+	}
+	if f.TokenURI == "" {
+		f.TokenURI = googleTokenURL
+	}
+	switch f.Type {
+	case "service_account":
+		key, err := parseRSAKey(f.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("google credentials %s: %w", keyFile, err)
+		}
+		c.fetch = func(ctx context.Context) (*http.Request, error) {
+			assertion, err := signJWT(key, f.ClientEmail, f.TokenURI)
+			if err != nil {
+				return nil, err
+			}
+			return tokenRequest(ctx, f.TokenURI, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+		}
+	case "authorized_user":
+		c.fetch = func(ctx context.Context) (*http.Request, error) {
+			return tokenRequest(ctx, f.TokenURI, url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {f.ClientID},
+				"client_secret": {f.ClientSecret},
+				"refresh_token": {f.RefreshToken},
+			})
+		}
+	default:
+		return nil, fmt.Errorf("google credentials %s: unsupported type %q", keyFile, f.Type)
+	}
+	return c, nil
+}
+
+// Token returns a valid access token, fetching a new one if needed.
+func (c *GoogleCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Until(c.expires) > time.Minute {
+		return c.token, nil
+	}
+	req, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("google token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("google token: http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("google token: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("google token: empty access token")
+	}
+	c.token = body.AccessToken
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+func tokenRequest(ctx context.Context, tokenURL string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+func parseRSAKey(p string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(p))
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not RSA")
+		}
+		return rk, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// signJWT builds the RS256-signed assertion of the OAuth2 JWT bearer flow.
+func signJWT(key *rsa.PrivateKey, email, aud string) (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": googleComputeAPI,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
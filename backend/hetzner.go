@@ -0,0 +1,326 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hcloudAPI = "https://api.hetzner.cloud/v1"
+	robotAPI  = "https://robot-ws.your-server.de"
+)
+
+// HCloud controls a Hetzner Cloud server through its power actions.
+type HCloud struct {
+	token  string
+	id     string
+	api    string
+	client *http.Client
+}
+
+// HCloudOption configures optional Hetzner Cloud backend features.
+type HCloudOption func(*HCloud)
+
+// WithHCloudEndpoint overrides the Hetzner Cloud API base URL.
+func WithHCloudEndpoint(baseURL string) HCloudOption {
+	return func(h *HCloud) { h.api = strings.TrimRight(baseURL, "/") }
+}
+
+// NewHCloud returns a backend for the server with the given numeric ID.
+func NewHCloud(token, serverID string, opts ...HCloudOption) (*HCloud, error) {
+	if token == "" {
+		return nil, errors.New("hcloud backend requires an API token")
+	}
+	if _, err := strconv.ParseUint(serverID, 10, 64); err != nil {
+		return nil, fmt.Errorf("hcloud backend requires a numeric server ID, got %q", serverID)
+	}
+	h := &HCloud{
+		token:  token,
+		id:     serverID,
+		api:    hcloudAPI,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+func (h *HCloud) PowerOn(ctx context.Context) error {
+	return h.action(ctx, "poweron")
+}
+
+func (h *HCloud) PowerOff(ctx context.Context) error {
+	return h.action(ctx, "poweroff")
+}
+
+// GracefulPowerOff sends an ACPI shutdown request.
+func (h *HCloud) GracefulPowerOff(ctx context.Context) error {
+	return h.action(ctx, "shutdown")
+}
+
+func (h *HCloud) Capabilities() Capability {
+	return capabilities(h, ResetForceRestart, ResetGracefulRestart)
+}
+
+// Reset maps ForceRestart to a hard reset and GracefulRestart to an ACPI
+// reboot.
+func (h *HCloud) Reset(ctx context.Context, t ResetType) error {
+	switch t {
+	case ResetForceRestart:
+		return h.action(ctx, "reset")
+	case ResetGracefulRestart:
+		return h.action(ctx, "reboot")
+	}
+	return standardReset(ctx, h, t)
+}
+
+func (h *HCloud) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, h)
+}
+
+func (h *HCloud) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := h.PowerStateDetail(ctx)
+	return on, err
+}
+
+func (h *HCloud) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	srv, err := h.fetchServer(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	switch srv.Status {
+	case "running", "migrating", "rebuilding":
+		return true, "", nil
+	case "initializing", "starting":
+		return true, PowerStatePoweringOn, nil
+	case "stopping", "deleting":
+		return false, PowerStatePoweringOff, nil
+	case "off":
+		return false, "", nil
+	default:
+		return false, "", fmt.Errorf("hcloud server %s: unknown status %q", h.id, srv.Status)
+	}
+}
+
+func (h *HCloud) DisplayName(ctx context.Context) (string, error) {
+	srv, err := h.fetchServer(ctx)
+	if err != nil {
+		return "", err
+	}
+	return srv.Name, nil
+}
+
+func (h *HCloud) Ping(ctx context.Context) error {
+	_, err := h.fetchServer(ctx)
+	return err
+}
+
+type hcloudServer struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func (h *HCloud) fetchServer(ctx context.Context) (*hcloudServer, error) {
+	var body struct {
+		Server hcloudServer `json:"server"`
+	}
+	if err := h.do(ctx, http.MethodGet, "/servers/"+h.id, &body); err != nil {
+		return nil, err
+	}
+	return &body.Server, nil
+}
+
+func (h *HCloud) action(ctx context.Context, name string) error {
+	return h.do(ctx, http.MethodPost, "/servers/"+h.id+"/actions/"+name, nil)
+}
+
+func (h *HCloud) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, h.api+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("hcloud server %s: http %d", h.id, resp.StatusCode)
+		if json.Unmarshal(b, &e) == nil && e.Error.Code != "" {
+			err = fmt.Errorf("hcloud server %s: %s: %s", h.id, e.Error.Code, e.Error.Message)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || e.Error.Code == "rate_limit_exceeded" {
+			// RateLimit-Reset is the UNIX time the budget is refilled.
+			var after time.Duration
+			if reset, perr := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); perr == nil {
+				after = time.Until(time.Unix(reset, 0))
+			}
+			return &RetryableError{Err: err, RetryAfter: after}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// HetznerRobot controls a Hetzner dedicated server through the Robot
+// webservice. Robot cannot report the power state, so the shim relies on
+// the last known state.
+type HetznerRobot struct {
+	user   string
+	pass   string
+	server string
+	api    string
+	client *http.Client
+}
+
+// HetznerRobotOption configures optional Hetzner Robot backend features.
+type HetznerRobotOption func(*HetznerRobot)
+
+// WithRobotEndpoint overrides the Robot webservice base URL.
+func WithRobotEndpoint(baseURL string) HetznerRobotOption {
+	return func(h *HetznerRobot) { h.api = strings.TrimRight(baseURL, "/") }
+}
+
+// NewHetznerRobot returns a backend for the dedicated server with the
+// given server number, using the Robot webservice credentials.
+func NewHetznerRobot(user, pass, serverNumber string, opts ...HetznerRobotOption) (*HetznerRobot, error) {
+	if user == "" || pass == "" {
+		return nil, errors.New("hetzner-robot backend requires webservice user and password")
+	}
+	if _, err := strconv.ParseUint(serverNumber, 10, 64); err != nil {
+		return nil, fmt.Errorf("hetzner-robot backend requires a numeric server number, got %q", serverNumber)
+	}
+	h := &HetznerRobot{
+		user:   user,
+		pass:   pass,
+		server: serverNumber,
+		api:    robotAPI,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// PowerOn sends a Wake-on-LAN packet, which is harmless if the server is
+// already running.
+func (h *HetznerRobot) PowerOn(ctx context.Context) error {
+	return h.do(ctx, http.MethodPost, "/wol/"+h.server, nil, nil)
+}
+
+// PowerOff holds the power button.
+func (h *HetznerRobot) PowerOff(ctx context.Context) error {
+	return h.reset(ctx, "power_long")
+}
+
+// GracefulPowerOff presses the power button briefly, which makes the OS
+// shut down.
+func (h *HetznerRobot) GracefulPowerOff(ctx context.Context) error {
+	return h.reset(ctx, "power")
+}
+
+func (h *HetznerRobot) Capabilities() Capability {
+	return capabilities(h, ResetForceRestart, ResetGracefulRestart)
+}
+
+// Reset maps ForceRestart to a hardware reset and GracefulRestart to a
+// software reset (CTRL+ALT+DEL).
+func (h *HetznerRobot) Reset(ctx context.Context, t ResetType) error {
+	switch t {
+	case ResetForceRestart:
+		return h.reset(ctx, "hw")
+	case ResetGracefulRestart:
+		return h.reset(ctx, "sw")
+	}
+	return standardReset(ctx, h, t)
+}
+
+func (h *HetznerRobot) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, h)
+}
+
+func (h *HetznerRobot) DisplayName(ctx context.Context) (string, error) {
+	var body struct {
+		Server struct {
+			Name string `json:"server_name"`
+		} `json:"server"`
+	}
+	if err := h.do(ctx, http.MethodGet, "/server/"+h.server, nil, &body); err != nil {
+		return "", err
+	}
+	return body.Server.Name, nil
+}
+
+func (h *HetznerRobot) Ping(ctx context.Context) error {
+	_, err := h.DisplayName(ctx)
+	return err
+}
+
+func (h *HetznerRobot) reset(ctx context.Context, typ string) error {
+	return h.do(ctx, http.MethodPost, "/reset/"+h.server, url.Values{"type": {typ}}, nil)
+}
+
+func (h *HetznerRobot) do(ctx context.Context, method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.api+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(h.user, h.pass)
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Code     string `json:"code"`
+				Message  string `json:"message"`
+				Interval int    `json:"interval"`
+			} `json:"error"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("hetzner robot server %s: http %d", h.server, resp.StatusCode)
+		if json.Unmarshal(b, &e) == nil && e.Error.Code != "" {
+			err = fmt.Errorf("hetzner robot server %s: %s: %s", h.server, e.Error.Code, e.Error.Message)
+		}
+		if e.Error.Code == "RATE_LIMIT_EXCEEDED" {
+			return &RetryableError{Err: err, RetryAfter: time.Duration(e.Error.Interval) * time.Second}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,758 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// haSensorMaxAge is how old a sensor reading may be before it is treated
+// as stale and omitted.
+const haSensorMaxAge = 15 * time.Minute
+
+type HomeAssistant struct {
+	baseURL string
+	token   string
+	// entityID is the first of entities, the switches powering the
+	// system; it names the system.
+	entityID string
+	entities []string
+	// stateAny makes a system with several entities on when any of them
+	// is, rather than all.
+	stateAny     bool
+	powerEntity  string
+	energyEntity string
+	tempEntities []string
+	ledEntity    string
+	// resetEntities maps ResetTypes to entities triggered instead of the
+	// default sequence, e.g. ForceRestart to a reset script.
+	resetEntities map[string]string
+	client        *http.Client
+	// states, if set, serves state reads from one fetch of all entities
+	// shared with the other systems.
+	states *HAStateCache
+	// optimisticWindow, if set, is how long CurrentState reports the state
+	// a successful switch asked for while Home Assistant catches up.
+	optimisticWindow time.Duration
+	optimistic       haOptimisticState
+	// now times the optimistic window; replaced in tests.
+	now func() time.Time
+}
+
+// haOptimisticState is the state a successful switch asked for, reported
+// until Home Assistant confirms it, contradicts it twice in a row, or the
+// window ends.
+type haOptimisticState struct {
+	mu        sync.Mutex
+	set       bool
+	on        bool
+	until     time.Time
+	conflicts int
+}
+
+// HomeAssistantOption configures optional Home Assistant backend features.
+type HomeAssistantOption func(*HomeAssistant)
+
+// WithHAPowerEntity sets a sensor entity reporting the current power draw in watts.
+func WithHAPowerEntity(entityID string) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.powerEntity = entityID }
+}
+
+// WithHAEnergyEntity sets a sensor entity reporting consumed energy in kWh.
+func WithHAEnergyEntity(entityID string) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.energyEntity = entityID }
+}
+
+// WithHATemperatureEntities sets sensor entities reporting temperatures.
+func WithHATemperatureEntities(entityIDs ...string) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.tempEntities = append(h.tempEntities, entityIDs...) }
+}
+
+// WithHAIndicatorEntity sets a light or switch entity used as the
+// system's IndicatorLED.
+func WithHAIndicatorEntity(entityID string) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.ledEntity = entityID }
+}
+
+// WithHAResetEntities maps Redfish ResetTypes to entities that carry them
+// out, such as script.node3_reset for ForceRestart. Scripts and scenes are
+// turned on, buttons pressed and automations triggered.
+func WithHAResetEntities(m map[string]string) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.resetEntities = m }
+}
+
+// WithHAStateAny makes a system powered by several entities count as on
+// when any of them is on, rather than only when all are.
+func WithHAStateAny() HomeAssistantOption {
+	return func(h *HomeAssistant) { h.stateAny = true }
+}
+
+// WithHAOptimisticState makes CurrentState report the state a successful
+// PowerOn or PowerOff asked for during window, instead of the state Home
+// Assistant still reports for a device that is slow to update it. A state
+// contradicting it twice in a row wins early.
+func WithHAOptimisticState(window time.Duration) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.optimisticWindow = window }
+}
+
+// WithHAHTTPClient makes the backend use c, typically one client from
+// NewHAHTTPClient shared by all backends talking to the same Home
+// Assistant instance.
+func WithHAHTTPClient(c *http.Client) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.client = c }
+}
+
+// WithHAStateCache makes the backend read entity states through c, shared
+// by all backends talking to the same Home Assistant instance.
+func WithHAStateCache(c *HAStateCache) HomeAssistantOption {
+	return func(h *HomeAssistant) { h.states = c }
+}
+
+// NewHAHTTPClient returns a client whose transport keeps up to maxConns
+// connections to Home Assistant open and never opens more, so that many
+// systems polling the same instance reuse a small pool instead of
+// dialing for every request. maxConns <= 0 leaves the pool unbounded.
+// With a TLS pin (see ParseTLSPin), Home Assistant's certificate is
+// checked against it instead of the system roots.
+func NewHAHTTPClient(maxConns int, tlsPin string) (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if maxConns > 0 {
+		tr.MaxConnsPerHost = maxConns
+		tr.MaxIdleConnsPerHost = maxConns
+	}
+	if tlsPin != "" {
+		pin, err := ParseTLSPin(tlsPin)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		PinTLS(tr.TLSClientConfig, pin)
+	}
+	return &http.Client{Timeout: 15 * time.Second, Transport: tr}, nil
+}
+
+// NewHomeAssistant returns a backend for the system powered by entityID,
+// or by several entities joined with "+" (e.g. the two plugs feeding a
+// dual-PSU server), which are switched together.
+func NewHomeAssistant(baseURL, token, entityID string, opts ...HomeAssistantOption) (*HomeAssistant, error) {
+	if baseURL == "" || token == "" || entityID == "" {
+		return nil, fmt.Errorf("homeassistant backend requires baseURL, token, and entityID")
+	}
+	entities := strings.Split(entityID, "+")
+	for i, e := range entities {
+		if entities[i] = strings.TrimSpace(e); entities[i] == "" {
+			return nil, fmt.Errorf("homeassistant backend: empty entity in %q", entityID)
+		}
+	}
+	// Ensure no trailing slash on URL
+	baseURL = strings.TrimRight(baseURL, "/")
+	h := &HomeAssistant{
+		baseURL:  baseURL,
+		token:    token,
+		entityID: entities[0],
+		entities: entities,
+		client:   &http.Client{Timeout: 15 * time.Second},
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// DiscoverHASwitches returns the switch entities carrying label and
+// assigned (directly or through their device) to area, in sorted order.
+// Label and area may be given by ID or name; an empty one does not
+// restrict the result, but at least one is required. It renders a
+// template through the REST API, which needs no admin token unlike the
+// registry (websocket) API.
+func DiscoverHASwitches(ctx context.Context, client *http.Client, baseURL, token, label, area string) ([]string, error) {
+	var expr string
+	switch {
+	case label != "" && area != "":
+		expr = fmt.Sprintf("label_entities(%s) | select('in', area_entities(%s))", jinjaString(label), jinjaString(area))
+	case label != "":
+		expr = fmt.Sprintf("label_entities(%s)", jinjaString(label))
+	case area != "":
+		expr = fmt.Sprintf("area_entities(%s)", jinjaString(area))
+	default:
+		return nil, fmt.Errorf("homeassistant discovery requires a label or an area")
+	}
+	tmpl := "{{ " + expr + " | select('match', 'switch[.]') | list | tojson }}"
+	b, _ := json.Marshal(map[string]string{"template": tmpl})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/api/template", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			fmt.Printf("error closing response body: %v\n", cerr)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("homeassistant template: http %d", resp.StatusCode)
+	}
+	var entities []string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&entities); err != nil {
+		return nil, fmt.Errorf("homeassistant template: %w", err)
+	}
+	slices.Sort(entities)
+	return slices.Compact(entities), nil
+}
+
+// jinjaString quotes s as a template string literal; JSON string escapes
+// are valid in Jinja's Python-like literals.
+func jinjaString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (h *HomeAssistant) PowerOn(ctx context.Context) error {
+	return h.switchAll(ctx, "turn_on", true)
+}
+
+func (h *HomeAssistant) PowerOff(ctx context.Context) error {
+	return h.switchAll(ctx, "turn_off", false)
+}
+
+// switchAll calls service for all entities at once. Home Assistant does
+// not say which entity a failed call failed for, so the error names those
+// that did not end up on (or off).
+func (h *HomeAssistant) switchAll(ctx context.Context, service string, on bool) error {
+	var ids any = h.entityID
+	if len(h.entities) > 1 {
+		ids = h.entities
+	}
+	err := h.callService(ctx, "switch", service, map[string]any{"entity_id": ids})
+	h.setOptimistic(on, err == nil)
+	if err == nil || len(h.entities) == 1 {
+		return err
+	}
+	var failed []string
+	for _, e := range h.entities {
+		if v, serr := h.entityOn(ctx, e); serr != nil || v != on {
+			failed = append(failed, e)
+		}
+	}
+	if len(failed) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (not %s: %s)", err, strings.TrimPrefix(service, "turn_"), strings.Join(failed, ", "))
+}
+
+// setOptimistic starts reporting on until Home Assistant catches up if the
+// switch succeeded, and stops reporting an earlier state otherwise.
+func (h *HomeAssistant) setOptimistic(on, ok bool) {
+	if h.optimisticWindow <= 0 {
+		return
+	}
+	o := &h.optimistic
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.set, o.on, o.until, o.conflicts = ok, on, h.now().Add(h.optimisticWindow), 0
+}
+
+// applyOptimistic returns the state to report given the one Home
+// Assistant reported: the optimistic state during its window, unless Home
+// Assistant confirmed it, which ends the window, or contradicted it for
+// the second time in a row.
+func (h *HomeAssistant) applyOptimistic(reported bool) bool {
+	o := &h.optimistic
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case !o.set:
+		return reported
+	case !h.now().Before(o.until), reported == o.on:
+		o.set = false
+		return reported
+	}
+	o.conflicts++
+	if o.conflicts >= 2 {
+		o.set = false
+		log.Printf("homeassistant %s: reported %s twice after being switched %s; dropping the optimistic state", h.entityID, onOff(reported), onOff(o.on))
+		return reported
+	}
+	return o.on
+}
+
+// CurrentState reports whether all entities are on, or any with
+// WithHAStateAny. It fails if any entity's state cannot be told, naming
+// the entities that failed. With WithHAOptimisticState, a state that
+// lags behind a successful switch is reported as switched.
+func (h *HomeAssistant) CurrentState(ctx context.Context) (bool, error) {
+	on, err := h.reportedState(ctx)
+	if err != nil || h.optimisticWindow <= 0 {
+		return on, err
+	}
+	return h.applyOptimistic(on), nil
+}
+
+// reportedState is CurrentState as Home Assistant reports it.
+func (h *HomeAssistant) reportedState(ctx context.Context) (bool, error) {
+	if len(h.entities) == 1 {
+		return h.entityOn(ctx, h.entityID)
+	}
+	on := !h.stateAny
+	var errs []error
+	for _, e := range h.entities {
+		v, err := h.entityOn(ctx, e)
+		switch {
+		case errors.Is(err, ErrStateUnknown):
+			errs = append(errs, err)
+		case err != nil:
+			errs = append(errs, fmt.Errorf("homeassistant %s: %w", e, err))
+		case h.stateAny:
+			on = on || v
+		default:
+			on = on && v
+		}
+	}
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+	return on, nil
+}
+
+// entityOn reports whether an entity is on.
+func (h *HomeAssistant) entityOn(ctx context.Context, entityID string) (bool, error) {
+	st, err := h.fetchEntity(ctx, entityID)
+	if err != nil {
+		return false, err
+	}
+	switch state := strings.ToLower(st.State); state {
+	case "unavailable", "unknown":
+		// Home Assistant restarting or the device offline: not off.
+		return false, fmt.Errorf("homeassistant %s is %s: %w", entityID, state, ErrStateUnknown)
+	default:
+		return state == "on", nil
+	}
+}
+
+func (h *HomeAssistant) DisplayName(ctx context.Context) (string, error) {
+	_, name, err := h.fetchState(ctx)
+	return name, err
+}
+
+func (h *HomeAssistant) Ping(ctx context.Context) error {
+	_, _, err := h.fetchState(ctx)
+	return err
+}
+
+// Reconnect drops pooled connections to Home Assistant; new ones are
+// opened on demand.
+func (h *HomeAssistant) Reconnect(ctx context.Context) error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// haOemAttributes are the entity attributes included in Oem; others may
+// be large or carry device details not meant for Redfish clients.
+var haOemAttributes = []string{"friendly_name", "device_class", "assumed_state", "icon"}
+
+// Oem reports the controlled entity, its raw state and when it last
+// changed, and the configured sensor entities.
+func (h *HomeAssistant) Oem(ctx context.Context) (map[string]any, error) {
+	st, err := h.fetchEntity(ctx, h.entityID)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]any{}
+	for _, k := range haOemAttributes {
+		if v, ok := st.Attributes[k]; ok {
+			attrs[k] = v
+		}
+	}
+	oem := map[string]any{
+		"EntityId":    h.entityID,
+		"State":       st.State,
+		"LastChanged": st.LastChanged.Format(time.RFC3339),
+		"Attributes":  attrs,
+	}
+	if len(h.entities) > 1 {
+		states := map[string]string{}
+		for _, e := range h.entities[1:] {
+			if st, err := h.fetchEntity(ctx, e); err == nil {
+				states[e] = st.State
+			}
+		}
+		states[h.entityID] = st.State
+		oem["EntityIds"] = h.entities
+		oem["EntityStates"] = states
+		oem["StateMatch"] = "all"
+		if h.stateAny {
+			oem["StateMatch"] = "any"
+		}
+	}
+	if h.powerEntity != "" {
+		oem["PowerEntityId"] = h.powerEntity
+	}
+	if h.energyEntity != "" {
+		oem["EnergyEntityId"] = h.energyEntity
+	}
+	if len(h.tempEntities) > 0 {
+		oem["TemperatureEntityIds"] = h.tempEntities
+	}
+	if h.ledEntity != "" {
+		oem["IndicatorEntityId"] = h.ledEntity
+	}
+	if len(h.resetEntities) > 0 {
+		oem["ResetEntityIds"] = h.resetEntities
+	}
+	return oem, nil
+}
+
+func (h *HomeAssistant) PowerMetrics(ctx context.Context) (PowerMetrics, error) {
+	if h.powerEntity == "" && h.energyEntity == "" {
+		return PowerMetrics{}, ErrNotSupported
+	}
+	var m PowerMetrics
+	if h.powerEntity != "" {
+		v, err := h.fetchSensor(ctx, h.powerEntity)
+		if err != nil {
+			return PowerMetrics{}, err
+		}
+		m.Watts = v
+	}
+	if h.energyEntity != "" {
+		v, err := h.fetchSensor(ctx, h.energyEntity)
+		if err != nil {
+			return PowerMetrics{}, err
+		}
+		m.EnergyKWh = v
+	}
+	return m, nil
+}
+
+func (h *HomeAssistant) Temperatures(ctx context.Context) ([]TemperatureReading, error) {
+	if len(h.tempEntities) == 0 {
+		return nil, ErrNotSupported
+	}
+	readings := make([]TemperatureReading, 0, len(h.tempEntities))
+	for _, id := range h.tempEntities {
+		r := TemperatureReading{Name: id}
+		st, err := h.fetchEntity(ctx, id)
+		if err != nil {
+			log.Printf("homeassistant temperature %s: %v", id, err)
+			readings = append(readings, r)
+			continue
+		}
+		if n, ok := st.Attributes["friendly_name"].(string); ok && n != "" {
+			r.Name = n
+		}
+		if v, err := strconv.ParseFloat(st.State, 64); err == nil {
+			if unit, _ := st.Attributes["unit_of_measurement"].(string); unit == "°F" {
+				v = (v - 32) * 5 / 9
+			}
+			r.Celsius = &v
+		}
+		readings = append(readings, r)
+	}
+	return readings, nil
+}
+
+func (h *HomeAssistant) IndicatorLED(ctx context.Context) (string, error) {
+	if h.ledEntity == "" {
+		return "", ErrNotSupported
+	}
+	st, err := h.fetchEntity(ctx, h.ledEntity)
+	if err != nil {
+		return "", err
+	}
+	if strings.ToLower(st.State) == "on" {
+		return IndicatorLit, nil
+	}
+	return IndicatorOff, nil
+}
+
+func (h *HomeAssistant) SetIndicatorLED(ctx context.Context, state string) error {
+	if h.ledEntity == "" {
+		return ErrNotSupported
+	}
+	domain, _, _ := strings.Cut(h.ledEntity, ".")
+	data := map[string]any{"entity_id": h.ledEntity}
+	switch state {
+	case IndicatorLit:
+		return h.callService(ctx, domain, "turn_on", data)
+	case IndicatorOff:
+		return h.callService(ctx, domain, "turn_off", data)
+	case IndicatorBlinking:
+		// Only lights know how to flash.
+		if domain != "light" {
+			return ErrNotSupported
+		}
+		data["flash"] = "long"
+		return h.callService(ctx, domain, "turn_on", data)
+	default:
+		return ErrNotSupported
+	}
+}
+
+// Capabilities adds the ResetTypes mapped to entities to the standard
+// resets.
+func (h *HomeAssistant) Capabilities() Capability {
+	return capabilities(h, sortedResetTypes(h.resetEntities)...)
+}
+
+// Reset triggers the entity mapped to t, if any.
+func (h *HomeAssistant) Reset(ctx context.Context, t ResetType) error {
+	entity, ok := h.resetEntities[string(t)]
+	if !ok {
+		return standardReset(ctx, h, t)
+	}
+	domain, _, _ := strings.Cut(entity, ".")
+	service := "turn_on"
+	switch domain {
+	case "button", "input_button":
+		service = "press"
+	case "automation":
+		service = "trigger"
+	}
+	return h.callService(ctx, domain, service, map[string]any{"entity_id": entity})
+}
+
+func (h *HomeAssistant) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, h)
+}
+
+func (h *HomeAssistant) callService(ctx context.Context, domain, service string, data map[string]any) error {
+	if h.states != nil {
+		// Whatever the call changes must not be read back from the cache.
+		defer h.states.invalidate()
+	}
+	b, _ := json.Marshal(data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.baseURL+"/api/services/"+domain+"/"+service, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			fmt.Printf("error closing response body: %v\n", cerr)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("homeassistant service %s.%s: http %d", domain, service, resp.StatusCode)
+	}
+	return nil
+}
+
+// haState is the subset of an entity state object the backend uses.
+type haState struct {
+	State        string         `json:"state"`
+	Attributes   map[string]any `json:"attributes"`
+	LastChanged  time.Time      `json:"last_changed"`
+	LastUpdated  time.Time      `json:"last_updated"`
+	LastReported time.Time      `json:"last_reported"`
+}
+
+// fetchState returns (state, friendlyName, error)
+func (h *HomeAssistant) fetchState(ctx context.Context) (string, string, error) {
+	st, err := h.fetchEntity(ctx, h.entityID)
+	if err != nil {
+		return "", "", err
+	}
+	name := ""
+	if v, ok := st.Attributes["friendly_name"]; ok {
+		if s, ok := v.(string); ok {
+			name = s
+		}
+	}
+	return st.State, name, nil
+}
+
+// fetchSensor returns the numeric state of a sensor entity, or nil if the
+// sensor is unavailable or its reading is stale.
+func (h *HomeAssistant) fetchSensor(ctx context.Context, entityID string) (*float64, error) {
+	st, err := h.fetchEntity(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseFloat(st.State, 64)
+	if err != nil {
+		// "unavailable", "unknown" and friends
+		return nil, nil
+	}
+	seen := st.LastReported
+	if seen.IsZero() {
+		seen = st.LastUpdated
+	}
+	if !seen.IsZero() && time.Since(seen) > haSensorMaxAge {
+		return nil, nil
+	}
+	return &v, nil
+}
+
+// fetchEntity returns the state of an entity, from the shared states
+// cache if there is one and it knows the entity.
+func (h *HomeAssistant) fetchEntity(ctx context.Context, entityID string) (*haState, error) {
+	if h.states != nil {
+		if st, ok := h.states.get(ctx, entityID); ok {
+			return st, nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+"/api/states/"+entityID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			fmt.Printf("error closing response body: %v\n", cerr)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("homeassistant state %s: http %d", entityID, resp.StatusCode)
+	}
+	var body haState
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// HAStateCache fetches the states of all entities of a Home Assistant
+// instance with a single GET /api/states and serves them to the backends
+// sharing it until they are maxAge old, so that reading many systems
+// costs one request rather than one per entity. Concurrent reads of a
+// stale cache wait for one fetch. Entities missing from it, and reads
+// while Home Assistant fails, fall back to fetching the entity alone; after
+// a failed fetch, the next is not tried until maxAge has passed.
+type HAStateCache struct {
+	baseURL string
+	token   string
+	client  *http.Client
+	maxAge  time.Duration
+	// fetching holds a token while a fetch is running.
+	fetching chan struct{}
+
+	mu      sync.Mutex
+	states  map[string]*haState
+	fetched time.Time
+	// failed is when the last fetch failed, if it did.
+	failed time.Time
+}
+
+func NewHAStateCache(client *http.Client, baseURL, token string, maxAge time.Duration) *HAStateCache {
+	return &HAStateCache{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		token:    token,
+		client:   client,
+		maxAge:   maxAge,
+		fetching: make(chan struct{}, 1),
+	}
+}
+
+// cached returns the cached state of an entity if the cache is fresh.
+// failing is true while a failed fetch is less than maxAge old.
+func (c *HAStateCache) cached(entityID string) (st *haState, fresh, failing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states == nil || time.Since(c.fetched) >= c.maxAge {
+		return nil, false, time.Since(c.failed) < c.maxAge
+	}
+	return c.states[entityID], true, false
+}
+
+// get returns the state of an entity, refreshing the cache if it is stale;
+// ok is false if the entity is unknown or the refresh failed, now or less
+// than maxAge ago.
+func (c *HAStateCache) get(ctx context.Context, entityID string) (*haState, bool) {
+	if st, fresh, failing := c.cached(entityID); fresh || failing {
+		return st, st != nil
+	}
+	select {
+	case c.fetching <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false
+	}
+	defer func() { <-c.fetching }()
+	// Another reader may have refreshed it, or failed to, while this one
+	// waited.
+	if st, fresh, failing := c.cached(entityID); fresh || failing {
+		return st, st != nil
+	}
+	states, err := c.fetchAll(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			// Home Assistant failed, not this reader's request.
+			log.Printf("homeassistant: fetching all states: %v", err)
+			c.mu.Lock()
+			c.failed = time.Now()
+			c.mu.Unlock()
+		}
+		return nil, false
+	}
+	c.mu.Lock()
+	c.states, c.fetched = states, time.Now()
+	c.mu.Unlock()
+	st := states[entityID]
+	return st, st != nil
+}
+
+// invalidate makes the next read refresh the cache.
+func (c *HAStateCache) invalidate() {
+	c.mu.Lock()
+	c.states = nil
+	c.mu.Unlock()
+}
+
+func (c *HAStateCache) fetchAll(ctx context.Context) (map[string]*haState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/states", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			fmt.Printf("error closing response body: %v\n", cerr)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("homeassistant states: http %d", resp.StatusCode)
+	}
+	var body []struct {
+		EntityID string `json:"entity_id"`
+		haState
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	states := make(map[string]*haState, len(body))
+	for i := range body {
+		states[body[i].EntityID] = &body[i].haState
+	}
+	return states, nil
+}
@@ -0,0 +1,372 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHA is a Home Assistant REST API knowing the states of switch
+// entities. It counts the requests per path.
+type fakeHA struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	states   map[string]string
+	requests map[string]int
+	// failStates makes GET /api/states answer 500.
+	failStates bool
+	// stuck entities ignore service calls, which then answer 500.
+	stuck map[string]bool
+}
+
+func newFakeHA(t *testing.T, states map[string]string) *fakeHA {
+	t.Helper()
+	f := &fakeHA{states: states, requests: map[string]int{}, stuck: map[string]bool{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeHA) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.URL.Path]++
+	switch {
+	case r.URL.Path == "/api/states":
+		if f.failStates {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var all []map[string]any
+		for id, st := range f.states {
+			all = append(all, map[string]any{"entity_id": id, "state": st, "attributes": map[string]any{"friendly_name": "Plug " + id}})
+		}
+		_ = json.NewEncoder(w).Encode(all)
+	case strings.HasPrefix(r.URL.Path, "/api/states/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/states/")
+		st, ok := f.states[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"state": st, "attributes": map[string]any{"friendly_name": "Plug " + id}})
+	case strings.HasPrefix(r.URL.Path, "/api/services/switch/"):
+		var body struct {
+			EntityID any `json:"entity_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		var ids []string
+		switch v := body.EntityID.(type) {
+		case string:
+			ids = []string{v}
+		case []any:
+			for _, id := range v {
+				ids = append(ids, fmt.Sprint(id))
+			}
+		}
+		failed := false
+		for _, id := range ids {
+			if f.stuck[id] {
+				failed = true
+				continue
+			}
+			f.states[id] = strings.TrimPrefix(r.URL.Path, "/api/services/switch/turn_")
+		}
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// set changes the state Home Assistant reports for id.
+func (f *fakeHA) set(id, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[id] = state
+}
+
+// count returns the number of requests for path.
+func (f *fakeHA) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func newTestHA(t *testing.T, f *fakeHA, entityID string, opts ...HomeAssistantOption) *HomeAssistant {
+	t.Helper()
+	h, err := NewHomeAssistant(f.URL, "token", entityID, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// TestHAStateCacheRequests checks that concurrent state reads of many
+// systems sharing a cache cost one GET /api/states per refresh, and that
+// while it fails the readers fall back to their own entity at once rather
+// than each retrying the batch.
+func TestHAStateCacheRequests(t *testing.T) {
+	const n = 15
+	for _, failing := range []bool{false, true} {
+		t.Run(fmt.Sprintf("failing=%v", failing), func(t *testing.T) {
+			states := map[string]string{}
+			for i := range n {
+				states[fmt.Sprintf("switch.node%d", i)] = "on"
+			}
+			f := newFakeHA(t, states)
+			f.failStates = failing
+			cache := NewHAStateCache(http.DefaultClient, f.URL, "token", time.Minute)
+			var systems []*HomeAssistant
+			for i := range n {
+				systems = append(systems, newTestHA(t, f, fmt.Sprintf("switch.node%d", i), WithHAStateCache(cache)))
+			}
+
+			for range 2 {
+				var wg sync.WaitGroup
+				errs := make(chan error, n)
+				for _, h := range systems {
+					wg.Go(func() {
+						on, err := h.CurrentState(context.Background())
+						if err == nil && !on {
+							err = fmt.Errorf("%s is off", h.entityID)
+						}
+						errs <- err
+					})
+				}
+				wg.Wait()
+				close(errs)
+				for err := range errs {
+					if err != nil {
+						t.Error(err)
+					}
+				}
+			}
+
+			if got := f.count("/api/states"); got != 1 {
+				t.Errorf("GET /api/states requests = %d, want 1", got)
+			}
+			wantSingle := 0
+			if failing {
+				wantSingle = 2
+			}
+			for i := range n {
+				if got := f.count(fmt.Sprintf("/api/states/switch.node%d", i)); got != wantSingle {
+					t.Errorf("GET /api/states/switch.node%d requests = %d, want %d", i, got, wantSingle)
+				}
+			}
+		})
+	}
+}
+
+// TestHAHTTPClientReuse checks that backends sharing the client of
+// NewHAHTTPClient reuse its connections, and never open more than the
+// limit at once.
+func TestHAHTTPClientReuse(t *testing.T) {
+	const systems, maxConns = 20, 2
+	var mu sync.Mutex
+	conns := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"state": "on"})
+	}))
+	ts.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	t.Cleanup(ts.Close)
+	newConns := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := conns
+		conns = 0
+		return n
+	}
+
+	client, err := NewHAHTTPClient(maxConns, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := make([]*HomeAssistant, systems)
+	for i := range systems {
+		if backends[i], err = NewHomeAssistant(ts.URL, "token", fmt.Sprintf("switch.node%d", i), WithHAHTTPClient(client)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(concurrent bool) {
+		var wg sync.WaitGroup
+		for _, h := range backends {
+			if !concurrent {
+				if _, err := h.CurrentState(context.Background()); err != nil {
+					t.Error(err)
+				}
+				continue
+			}
+			wg.Go(func() {
+				if _, err := h.CurrentState(context.Background()); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+		wg.Wait()
+	}
+
+	read(false)
+	read(false)
+	if n := newConns(); n != 1 {
+		t.Errorf("sequential reads of %d systems opened %d connections, want 1", systems, n)
+	}
+	for range 3 {
+		read(true)
+	}
+	if n := newConns(); n > maxConns {
+		t.Errorf("concurrent reads of %d systems opened %d more connections, want at most %d", systems, n, maxConns)
+	}
+}
+
+// TestHAUnavailable checks that an entity going unavailable or unknown
+// makes the state unknown rather than off, and that it is known again
+// once the entity is back.
+func TestHAUnavailable(t *testing.T) {
+	for _, entityID := range []string{"switch.node1", "switch.psu_a+switch.psu_b"} {
+		t.Run(entityID, func(t *testing.T) {
+			f := newFakeHA(t, map[string]string{"switch.node1": "on", "switch.psu_a": "on", "switch.psu_b": "on"})
+			h := newTestHA(t, f, entityID)
+			entities := strings.Split(entityID, "+")
+			last := entities[len(entities)-1]
+			for _, step := range []struct {
+				state string
+				on    bool
+				err   bool
+			}{
+				{"on", true, false},
+				{"unavailable", false, true},
+				{"unknown", false, true},
+				{"off", false, false},
+				{"unavailable", false, true},
+				{"on", true, false},
+			} {
+				f.set(last, step.state)
+				on, err := h.CurrentState(context.Background())
+				if step.err {
+					if !errors.Is(err, ErrStateUnknown) || !strings.Contains(err.Error(), last) {
+						t.Errorf("%s %s: CurrentState = %v, %v; want ErrStateUnknown naming it", last, step.state, on, err)
+					}
+					continue
+				}
+				if err != nil || on != step.on {
+					t.Errorf("%s %s: CurrentState = %v, %v; want %v", last, step.state, on, err, step.on)
+				}
+			}
+		})
+	}
+}
+
+// TestHASwitchAllPartialFailure checks that switching several entities of
+// which one does not follow fails naming it, and that the system is not
+// reported on, optimistically or not.
+func TestHASwitchAllPartialFailure(t *testing.T) {
+	for _, opts := range [][]HomeAssistantOption{nil, {WithHAOptimisticState(time.Minute)}} {
+		f := newFakeHA(t, map[string]string{"switch.psu_a": "off", "switch.psu_b": "off"})
+		f.stuck["switch.psu_b"] = true
+		h := newTestHA(t, f, "switch.psu_a+switch.psu_b", opts...)
+
+		err := h.PowerOn(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "not on: switch.psu_b") || strings.Contains(err.Error(), "psu_a") {
+			t.Errorf("PowerOn = %v, want an error naming switch.psu_b alone", err)
+		}
+		if on, err := h.CurrentState(context.Background()); err != nil || on {
+			t.Errorf("CurrentState after the partial failure = %v, %v; want off", on, err)
+		}
+
+		f.stuck["switch.psu_b"] = false
+		f.stuck["switch.psu_a"] = true
+		f.set("switch.psu_b", "on")
+		err = h.PowerOff(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "not off: switch.psu_a") {
+			t.Errorf("PowerOff = %v, want an error naming switch.psu_a", err)
+		}
+	}
+}
+
+// TestHAOptimisticState steps through the window of the state reported
+// after a successful switch, with a clock moved by hand.
+func TestHAOptimisticState(t *testing.T) {
+	const window = 10 * time.Second
+	newHA := func() (*HomeAssistant, *time.Time) {
+		now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		h := newTestHA(t, newFakeHA(t, map[string]string{}), "switch.node1", WithHAOptimisticState(window))
+		h.now = func() time.Time { return now }
+		return h, &now
+	}
+	// step is a state Home Assistant reports, after moving the clock by
+	// advance, and the state the backend must report.
+	type step struct {
+		advance  time.Duration
+		reported bool
+		want     bool
+	}
+	tests := []struct {
+		name     string
+		switched bool
+		steps    []step
+	}{
+		{"confirmed at once", true, []step{{0, true, true}, {time.Second, false, false}}},
+		{"conflict twice", true, []step{{0, false, true}, {time.Second, false, false}, {time.Second, false, false}}},
+		{"conflict then confirmed", true, []step{{0, false, true}, {time.Second, true, true}, {time.Second, false, false}}},
+		{"expired", true, []step{{0, false, true}, {window, false, false}, {0, true, true}}},
+		{"expired without conflict", true, []step{{window - time.Nanosecond, false, true}, {time.Nanosecond, false, false}}},
+		{"failed switch", false, []step{{0, false, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, now := newHA()
+			h.setOptimistic(true, tt.switched)
+			for i, s := range tt.steps {
+				*now = now.Add(s.advance)
+				if got := h.applyOptimistic(s.reported); got != s.want {
+					t.Errorf("step %d: reported %v, served %v; want %v", i, s.reported, got, s.want)
+				}
+			}
+		})
+	}
+
+	t.Run("switched again", func(t *testing.T) {
+		h, _ := newHA()
+		h.setOptimistic(true, true)
+		h.applyOptimistic(false)
+		// A new switch starts a new window without the earlier conflict.
+		h.setOptimistic(false, true)
+		if got := h.applyOptimistic(true); got {
+			t.Error("first conflict with the new switch ended the window")
+		}
+	})
+
+	t.Run("end to end", func(t *testing.T) {
+		f := newFakeHA(t, map[string]string{"switch.node1": "off"})
+		h := newTestHA(t, f, "switch.node1", WithHAOptimisticState(time.Minute))
+		if err := h.PowerOn(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// The plug has not reported the switch yet.
+		f.set("switch.node1", "off")
+		for i, want := range []bool{true, false} {
+			if on, err := h.CurrentState(context.Background()); err != nil || on != want {
+				t.Errorf("read %d = %v, %v; want %v", i, on, err, want)
+			}
+		}
+	})
+}
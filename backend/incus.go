@@ -0,0 +1,305 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// incusSockets are the local sockets tried when neither a socket nor a URL
+// is configured, Incus first and then LXD.
+var incusSockets = []string{
+	"/var/lib/incus/unix.socket",
+	"/var/snap/lxd/common/lxd/unix.socket",
+	"/var/lib/lxd/unix.socket",
+}
+
+// incusOpTimeout bounds how long an instance state change is waited for.
+const incusOpTimeout = 2 * time.Minute
+
+// IncusConfig describes how to reach an Incus (or LXD) server: either a
+// local unix socket or an HTTPS URL authenticated with a client
+// certificate from the server's trust store.
+type IncusConfig struct {
+	Socket string
+	URL    string
+	// ClientCert and ClientKey are PEM files of a trusted client
+	// certificate (URL only).
+	ClientCert string
+	ClientKey  string
+	// ServerCert is the PEM certificate (or CA) the server is verified
+	// against; empty uses the system roots.
+	ServerCert string
+}
+
+// IncusClient talks to the Incus REST API and is shared by all instances
+// on a server.
+type IncusClient struct {
+	base   string
+	client *http.Client
+}
+
+// NewIncusClient returns a client for cfg. With an empty cfg the first
+// existing local socket is used.
+func NewIncusClient(cfg IncusConfig) (*IncusClient, error) {
+	if cfg.URL != "" {
+		tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.ClientCert != "" || cfg.ClientKey != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("incus client certificate: %w", err)
+			}
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+		if cfg.ServerCert != "" {
+			pem, err := os.ReadFile(cfg.ServerCert)
+			if err != nil {
+				return nil, fmt.Errorf("incus server certificate: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("incus server certificate %s: no PEM certificates", cfg.ServerCert)
+			}
+			tlsCfg.RootCAs = pool
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsCfg
+		return &IncusClient{
+			base:   strings.TrimRight(cfg.URL, "/"),
+			client: &http.Client{Timeout: incusOpTimeout + 30*time.Second, Transport: tr},
+		}, nil
+	}
+
+	socket := cfg.Socket
+	if socket == "" {
+		for _, s := range incusSockets {
+			if _, err := os.Stat(s); err == nil {
+				socket = s
+				break
+			}
+		}
+	}
+	if socket == "" {
+		return nil, errors.New("incus backend requires --incus-socket or --incus-url (no local socket found)")
+	}
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &IncusClient{
+		base:   "http://incus",
+		client: &http.Client{Timeout: incusOpTimeout + 30*time.Second, Transport: tr},
+	}, nil
+}
+
+// incusResponse is the envelope of every Incus API response.
+type incusResponse struct {
+	Type      string          `json:"type"`
+	Operation string          `json:"operation"`
+	Error     string          `json:"error"`
+	ErrorCode int             `json:"error_code"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// do performs a request and, for async responses, waits for the operation.
+func (c *IncusClient) do(ctx context.Context, method, path string, project string, body, out any) error {
+	u := c.base + path
+	if project != "" {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		u += sep + "project=" + url.QueryEscape(project)
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var ir incusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+		return fmt.Errorf("incus %s %s: http %d: %w", method, path, resp.StatusCode, err)
+	}
+	switch ir.Type {
+	case "error":
+		return fmt.Errorf("incus %s %s: %s", method, path, ir.Error)
+	case "async":
+		return c.wait(ctx, ir.Operation)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(ir.Metadata, out)
+}
+
+// wait blocks until the operation at op finishes and returns its error.
+func (c *IncusClient) wait(ctx context.Context, op string) error {
+	var md struct {
+		Status string `json:"status"`
+		Err    string `json:"err"`
+	}
+	// The operation URL may carry a ?project= of its own.
+	path, query, _ := strings.Cut(op, "?")
+	path = fmt.Sprintf("%s/wait?timeout=%d", path, int(incusOpTimeout/time.Second))
+	if query != "" {
+		path += "&" + query
+	}
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &md); err != nil {
+		return err
+	}
+	if md.Err != "" {
+		return fmt.Errorf("incus operation %s: %s", op, md.Err)
+	}
+	if md.Status != "Success" {
+		return fmt.Errorf("incus operation %s: %s", op, md.Status)
+	}
+	return nil
+}
+
+// Incus controls one Incus/LXD container or VM.
+type Incus struct {
+	c       *IncusClient
+	project string
+	name    string
+}
+
+// NewIncus returns a backend for the instance given as [project/]name.
+func NewIncus(c *IncusClient, instance string) (*Incus, error) {
+	project, name, ok := strings.Cut(instance, "/")
+	if !ok {
+		project, name = "", instance
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("incus backend requires an instance of the form [project/]name, got %q", instance)
+	}
+	return &Incus{c: c, project: project, name: name}, nil
+}
+
+func (i *Incus) path(sub string) string {
+	return "/1.0/instances/" + url.PathEscape(i.name) + sub
+}
+
+func (i *Incus) setState(ctx context.Context, action string, force bool) error {
+	return i.c.do(ctx, http.MethodPut, i.path("/state"), i.project, map[string]any{
+		"action":  action,
+		"timeout": int(incusOpTimeout / time.Second),
+		"force":   force,
+	}, nil)
+}
+
+type incusState struct {
+	Status string `json:"status"`
+}
+
+func (i *Incus) status(ctx context.Context) (string, error) {
+	var st incusState
+	err := i.c.do(ctx, http.MethodGet, i.path("/state"), i.project, nil, &st)
+	return st.Status, err
+}
+
+// PowerOn starts a stopped instance and unfreezes a frozen one.
+func (i *Incus) PowerOn(ctx context.Context) error {
+	status, err := i.status(ctx)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case "Running":
+		return nil
+	case "Frozen":
+		return i.setState(ctx, "unfreeze", false)
+	default:
+		return i.setState(ctx, "start", false)
+	}
+}
+
+func (i *Incus) PowerOff(ctx context.Context) error {
+	return i.setState(ctx, "stop", true)
+}
+
+func (i *Incus) GracefulPowerOff(ctx context.Context) error {
+	return i.setState(ctx, "stop", false)
+}
+
+func (i *Incus) Capabilities() Capability {
+	return capabilities(i, ResetForceRestart, ResetGracefulRestart)
+}
+
+func (i *Incus) Reset(ctx context.Context, t ResetType) error {
+	switch t {
+	case ResetForceRestart:
+		return i.setState(ctx, "restart", true)
+	case ResetGracefulRestart:
+		return i.setState(ctx, "restart", false)
+	}
+	return standardReset(ctx, i, t)
+}
+
+func (i *Incus) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, i)
+}
+
+// CurrentState reports Running and Frozen instances as on.
+func (i *Incus) CurrentState(ctx context.Context) (bool, error) {
+	status, err := i.status(ctx)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case "Running", "Frozen":
+		return true, nil
+	case "Stopped":
+		return false, nil
+	default:
+		return false, fmt.Errorf("incus instance %s: status %q", i.name, status)
+	}
+}
+
+// DisplayName returns the instance description, or its name if it has
+// none.
+func (i *Incus) DisplayName(ctx context.Context) (string, error) {
+	var inst struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := i.c.do(ctx, http.MethodGet, i.path(""), i.project, nil, &inst); err != nil {
+		return "", err
+	}
+	if inst.Description != "" {
+		return inst.Description, nil
+	}
+	return inst.Name, nil
+}
+
+func (i *Incus) Ping(ctx context.Context) error {
+	_, err := i.status(ctx)
+	return err
+}
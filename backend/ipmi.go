@@ -0,0 +1,331 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPMIConfig describes how ipmitool reaches the BMCs.
+type IPMIConfig struct {
+	// Interface is the ipmitool interface, default "lanplus".
+	Interface string
+	User      string
+	Password  string
+	// Binary is the ipmitool executable, default "ipmitool".
+	Binary string
+}
+
+// ipmiQuirk works around the misbehaviour of a family of BMCs.
+type ipmiQuirk struct {
+	// SettlePolls is how many times the power status is polled, every
+	// SettleDelay, after a power command before it is trusted. Until it
+	// shows the commanded state the system is reported in transition.
+	SettlePolls int
+	SettleDelay time.Duration
+	// CycleOffAsOn powers on a system that is off instead of power
+	// cycling it, which such BMCs reject.
+	CycleOffAsOn bool
+	// RetryCodes are completion codes a command is retried on, up to
+	// Retries times every RetryDelay.
+	RetryCodes []byte
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// ipmiQuirks are the quirks selectable per system by name.
+var ipmiQuirks = map[string]ipmiQuirk{
+	// X9 boards report the old state for several seconds after a power
+	// command, answer a cycle of a host that is off with "command not
+	// supported in present state" and are often busy right after one.
+	"supermicro-x9": {
+		SettlePolls:  6,
+		SettleDelay:  2 * time.Second,
+		CycleOffAsOn: true,
+		RetryCodes:   []byte{0xc0, 0xc3, 0xff},
+		Retries:      3,
+		RetryDelay:   2 * time.Second,
+	},
+	// X10 boards only lag behind in reporting the power state.
+	"supermicro-x10": {
+		SettlePolls: 3,
+		SettleDelay: 2 * time.Second,
+	},
+}
+
+// ipmiCompletionCodes are the texts ipmitool prints for the completion
+// codes quirks may retry, from the IPMI specification.
+var ipmiCompletionCodes = map[byte]string{
+	0xc0: "Node busy",
+	0xc3: "Timeout",
+	0xc4: "Out of space",
+	0xc9: "Parameter out of range",
+	0xcc: "Invalid data field in request",
+	0xce: "Command response could not be provided",
+	0xd5: "Command not supported in present state",
+	0xff: "Unspecified error",
+}
+
+// IPMIQuirks returns the names of the known vendor quirks.
+func IPMIQuirks() []string {
+	names := make([]string, 0, len(ipmiQuirks))
+	for n := range ipmiQuirks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IPMI controls a server through ipmitool chassis power commands.
+type IPMI struct {
+	cfg    IPMIConfig
+	host   string
+	quirks string
+	quirk  ipmiQuirk
+	// run runs ipmitool chassis power action and returns its output;
+	// replaced in tests.
+	run func(ctx context.Context, action string) (string, error)
+
+	mu sync.Mutex
+	// settling is the state a power command was sent for while its
+	// status is polled, and settleUntil when polling gives up.
+	settling    *bool
+	settleUntil time.Time
+}
+
+// NewIPMI returns a backend for the BMC at host with the named vendor
+// quirks, or none if quirks is empty.
+func NewIPMI(cfg IPMIConfig, host, quirks string) (*IPMI, error) {
+	if cfg.Binary == "" {
+		cfg.Binary = "ipmitool"
+	}
+	if cfg.Interface == "" {
+		cfg.Interface = "lanplus"
+	}
+	if host == "" || cfg.User == "" {
+		return nil, errors.New("ipmitool requires a BMC host and user")
+	}
+	q, ok := ipmiQuirks[quirks]
+	if quirks != "" && !ok {
+		return nil, fmt.Errorf("unknown ipmi quirks %q (expected one of %s)", quirks, strings.Join(IPMIQuirks(), ", "))
+	}
+	p := &IPMI{cfg: cfg, host: host, quirks: quirks, quirk: q}
+	p.run = p.ipmitool
+	return p, nil
+}
+
+// ipmitool runs ipmitool chassis power action and returns its output. The
+// password is handed over in the environment (-E), never as an argument.
+func (p *IPMI) ipmitool(ctx context.Context, action string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.cfg.Binary, "-I", p.cfg.Interface, "-H", p.host, "-U", p.cfg.User, "-E", "chassis", "power", action)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+p.cfg.Password)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// power runs ipmitool chassis power action and returns its output.
+// Failures with a completion code the quirks list are retried.
+func (p *IPMI) power(ctx context.Context, action string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		out, err := p.run(ctx, action)
+		text := strings.TrimSpace(out)
+		if err == nil {
+			return text, nil
+		}
+		if attempt < p.quirk.Retries && p.transient(text) {
+			if err := sleepCtx(ctx, p.quirk.RetryDelay); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if text != "" {
+			return "", fmt.Errorf("ipmitool chassis power %s: %v: %s", action, err, text)
+		}
+		return "", fmt.Errorf("ipmitool chassis power %s: %w", action, err)
+	}
+}
+
+// transient reports whether ipmitool's output names a completion code the
+// quirks retry, either as text or as rsp=0xNN.
+func (p *IPMI) transient(out string) bool {
+	lower := strings.ToLower(out)
+	for _, code := range p.quirk.RetryCodes {
+		if strings.Contains(lower, fmt.Sprintf("rsp=0x%02x", code)) {
+			return true
+		}
+		if text, ok := ipmiCompletionCodes[code]; ok && strings.Contains(lower, strings.ToLower(text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// command sends a power command that leaves the system on or off and,
+// with quirks that distrust the status, polls it until it agrees.
+func (p *IPMI) command(ctx context.Context, action string, on bool) error {
+	if _, err := p.power(ctx, action); err != nil {
+		return err
+	}
+	if p.quirk.SettlePolls == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	p.settling = &on
+	p.settleUntil = time.Now().Add(time.Duration(p.quirk.SettlePolls) * p.quirk.SettleDelay)
+	p.mu.Unlock()
+	defer p.settled(&on)
+	for range p.quirk.SettlePolls {
+		if err := sleepCtx(ctx, p.quirk.SettleDelay); err != nil {
+			return err
+		}
+		if got, err := p.status(ctx); err == nil && got == on {
+			return nil
+		}
+	}
+	// The command was accepted; the status will catch up or the poller
+	// will notice that it did not.
+	return nil
+}
+
+// settled ends the settling of the command that wanted on, unless a later
+// command superseded it.
+func (p *IPMI) settled(on *bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.settling == on {
+		p.settling = nil
+	}
+}
+
+func (p *IPMI) PowerOn(ctx context.Context) error {
+	return p.command(ctx, "on", true)
+}
+
+func (p *IPMI) PowerOff(ctx context.Context) error {
+	return p.command(ctx, "off", false)
+}
+
+func (p *IPMI) GracefulPowerOff(ctx context.Context) error {
+	// An ACPI shutdown takes as long as the OS does; it is not awaited.
+	_, err := p.power(ctx, "soft")
+	return err
+}
+
+func (p *IPMI) Capabilities() Capability {
+	return capabilities(p, ResetForceRestart, ResetPowerCycle)
+}
+
+// Reset maps ForceRestart to a hard reset and PowerCycle to a power cycle.
+func (p *IPMI) Reset(ctx context.Context, t ResetType) error {
+	switch t {
+	case ResetForceRestart:
+		_, err := p.power(ctx, "reset")
+		return err
+	case ResetPowerCycle:
+		if p.quirk.CycleOffAsOn {
+			on, err := p.status(ctx)
+			if err != nil {
+				return err
+			}
+			if !on {
+				return p.PowerOn(ctx)
+			}
+		}
+		return p.command(ctx, "cycle", true)
+	default:
+		return standardReset(ctx, p, t)
+	}
+}
+
+func (p *IPMI) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, p)
+}
+
+// status returns the power status as ipmitool reports it.
+func (p *IPMI) status(ctx context.Context) (bool, error) {
+	out, err := p.power(ctx, "status")
+	if err != nil {
+		return false, err
+	}
+	return parseChassisPower(out)
+}
+
+func (p *IPMI) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := p.PowerStateDetail(ctx)
+	return on, err
+}
+
+// PowerStateDetail reports a system as powering on or off while the
+// status of a power command is not trusted yet and disagrees with it.
+func (p *IPMI) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	on, err := p.status(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	p.mu.Lock()
+	settling, until := p.settling, p.settleUntil
+	p.mu.Unlock()
+	if settling == nil || *settling == on || time.Now().After(until) {
+		return on, "", nil
+	}
+	if *settling {
+		return true, PowerStatePoweringOn, nil
+	}
+	return false, PowerStatePoweringOff, nil
+}
+
+func (p *IPMI) Ping(ctx context.Context) error {
+	_, err := p.status(ctx)
+	return err
+}
+
+// Oem exposes the BMC and the quirks applied to it.
+func (p *IPMI) Oem(ctx context.Context) (map[string]any, error) {
+	oem := map[string]any{"Host": p.host, "Interface": p.cfg.Interface}
+	if p.quirks != "" {
+		oem["Quirks"] = p.quirks
+	}
+	return oem, nil
+}
+
+// parseChassisPower parses the output of ipmitool chassis power status,
+// "Chassis Power is on".
+func parseChassisPower(out string) (bool, error) {
+	lines := strings.Split(out, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		fields := strings.Fields(strings.ToLower(lines[i]))
+		if !slices.Equal(fields[:min(len(fields), 3)], []string{"chassis", "power", "is"}) || len(fields) != 4 {
+			continue
+		}
+		switch fields[3] {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("ipmitool: cannot parse power status from %q", out)
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
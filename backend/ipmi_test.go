@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ipmiStep is an ipmitool run a fixture expects and its answer.
+type ipmiStep struct {
+	action string
+	out    string
+	fail   bool
+}
+
+// ipmiFixture is a testdata/ipmi file: the quirks of a system, the call
+// made, the ipmitool runs it must lead to with their output, and whether
+// the call succeeds. Runs are written as "> action", or "> action (exit
+// 1)" for a failing one, followed by the lines of the output.
+type ipmiFixture struct {
+	quirks string
+	call   string
+	steps  []ipmiStep
+	ok     bool
+}
+
+func readIPMIFixture(t *testing.T, path string) ipmiFixture {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f ipmiFixture
+	for line := range strings.Lines(string(b)) {
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "quirks:"):
+			f.quirks = strings.TrimSpace(strings.TrimPrefix(line, "quirks:"))
+		case strings.HasPrefix(line, "call:"):
+			f.call = strings.TrimSpace(strings.TrimPrefix(line, "call:"))
+		case strings.HasPrefix(line, "result:"):
+			f.ok = strings.TrimSpace(strings.TrimPrefix(line, "result:")) == "ok"
+		case strings.HasPrefix(line, "> "):
+			action, fail := strings.CutSuffix(strings.TrimPrefix(line, "> "), " (exit 1)")
+			f.steps = append(f.steps, ipmiStep{action: action, fail: fail})
+		case len(f.steps) > 0:
+			f.steps[len(f.steps)-1].out += line + "\n"
+		default:
+			t.Fatalf("%s: unexpected line %q", path, line)
+		}
+	}
+	return f
+}
+
+// TestIPMIQuirks replays the fixtures in testdata/ipmi: each checks the
+// ipmitool commands the quirks of a vendor lead to.
+func TestIPMIQuirks(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "ipmi", "*.txt"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".txt"), func(t *testing.T) {
+			f := readIPMIFixture(t, path)
+			p, err := NewIPMI(IPMIConfig{User: "ADMIN"}, "10.0.0.5", f.quirks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.quirk.SettleDelay = time.Millisecond
+			p.quirk.RetryDelay = time.Millisecond
+			steps := f.steps
+			p.run = func(ctx context.Context, action string) (string, error) {
+				if len(steps) == 0 {
+					t.Errorf("unexpected ipmitool chassis power %s", action)
+					return "", errors.New("exit status 1")
+				}
+				step := steps[0]
+				steps = steps[1:]
+				if action != step.action {
+					t.Errorf("ipmitool chassis power %s, want %s", action, step.action)
+				}
+				if step.fail {
+					return step.out, errors.New("exit status 1")
+				}
+				return step.out, nil
+			}
+
+			switch f.call {
+			case "PowerOn":
+				err = p.PowerOn(context.Background())
+			case "PowerOff":
+				err = p.PowerOff(context.Background())
+			case "PowerCycle":
+				err = p.Reset(context.Background(), ResetPowerCycle)
+			default:
+				t.Fatalf("unknown call %q", f.call)
+			}
+			if (err == nil) != f.ok {
+				t.Errorf("%s = %v, want ok %v", f.call, err, f.ok)
+			}
+			for _, step := range steps {
+				t.Errorf("ipmitool chassis power %s not run", step.action)
+			}
+		})
+	}
+}
+
+func TestIPMITransient(t *testing.T) {
+	x9 := &IPMI{quirk: ipmiQuirks["supermicro-x9"]}
+	for out, want := range map[string]bool{
+		"Unable to set Chassis Power Control to Up/On: rsp=0xc0":                            true,
+		"Set Chassis Power Control to Down/Off failed: NODE BUSY":                           true,
+		"Set Chassis Power Control to Cycle failed: Command not supported in present state": false,
+		"Unable to set Chassis Power Control to Up/On: rsp=0xd5":                            false,
+		"Error: Unable to establish IPMI v2 / RMCP+ session":                                false,
+	} {
+		if got := x9.transient(out); got != want {
+			t.Errorf("transient(%q) = %v, want %v", out, got, want)
+		}
+	}
+	if (&IPMI{}).transient("rsp=0xc0") {
+		t.Error("no quirks retry rsp=0xc0")
+	}
+	if _, err := NewIPMI(IPMIConfig{User: "ADMIN"}, "10.0.0.5", "supermicro-x8"); err == nil || !strings.Contains(err.Error(), "supermicro-x10, supermicro-x9") {
+		t.Errorf("unknown quirks = %v, want an error listing the known ones", err)
+	}
+}
@@ -0,0 +1,239 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// The oidc auth provider; the cloud ones were removed from client-go
+	// in favour of exec plugins.
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubernetesClient talks to the Kubernetes API server and is shared by
+// all workloads.
+type KubernetesClient struct {
+	server string
+	// namespace is the default namespace of targets.
+	namespace string
+	// client authenticates its requests, refreshing the credentials of
+	// exec plugins and rotated service account tokens as needed.
+	client *http.Client
+}
+
+// NewKubernetesClient returns a client for the cluster of the current
+// context of the kubeconfig file at path, loaded like kubectl does (YAML
+// or JSON; tokens, client certificates, exec credential plugins and the
+// oidc auth provider). With an empty path the in-cluster service account
+// is used. namespace overrides the default namespace of targets.
+func NewKubernetesClient(path, namespace string) (*KubernetesClient, error) {
+	var cfg *rest.Config
+	var defaultNS string
+	if path == "" {
+		var err error
+		if cfg, err = rest.InClusterConfig(); err != nil {
+			return nil, fmt.Errorf("kubernetes backend: %w; pass --kubeconfig", err)
+		}
+		if ns, err := os.ReadFile(k8sNamespaceFile); err == nil {
+			defaultNS = strings.TrimSpace(string(ns))
+		}
+	} else {
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: path}, &clientcmd.ConfigOverrides{})
+		var err error
+		if cfg, err = loader.ClientConfig(); err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %w", path, err)
+		}
+		if defaultNS, _, err = loader.Namespace(); err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %w", path, err)
+		}
+	}
+	cfg.Timeout = 15 * time.Second
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes backend: %w", err)
+	}
+	c := &KubernetesClient{server: strings.TrimRight(cfg.Host, "/"), namespace: defaultNS, client: client}
+	if namespace != "" {
+		c.namespace = namespace
+	}
+	if c.namespace == "" {
+		c.namespace = "default"
+	}
+	return c, nil
+}
+
+// k8sNamespaceFile holds the namespace of the pod (in-cluster
+// configuration).
+const k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+func (c *KubernetesClient) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Errors come as a Status object.
+		var st struct {
+			Message string `json:"message"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &st) == nil && st.Message != "" {
+			msg = st.Message
+		}
+		err := fmt.Errorf("kubernetes %s %s: http %d: %s", method, path, resp.StatusCode, msg)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// Retry-After is in seconds for API priority and fairness.
+			secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			return &RetryableError{Err: err, RetryAfter: time.Duration(secs) * time.Second}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// kubernetesKinds maps the accepted workload kinds to their resource.
+var kubernetesKinds = map[string]string{
+	"deployment":  "deployments",
+	"deploy":      "deployments",
+	"statefulset": "statefulsets",
+	"sts":         "statefulsets",
+}
+
+// Kubernetes controls a Deployment or StatefulSet as if it were a
+// machine, scaling it between 0 and 1 replicas.
+type Kubernetes struct {
+	c         *KubernetesClient
+	namespace string
+	resource  string
+	name      string
+}
+
+// NewKubernetes returns a backend for target, given as
+// [namespace/]kind/name with kind deployment or statefulset.
+func NewKubernetes(c *KubernetesClient, target string) (*Kubernetes, error) {
+	parts := strings.Split(target, "/")
+	if len(parts) == 2 {
+		parts = append([]string{c.namespace}, parts...)
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("kubernetes backend requires a target of the form [namespace/]kind/name, got %q", target)
+	}
+	resource, ok := kubernetesKinds[strings.ToLower(parts[1])]
+	if !ok {
+		return nil, fmt.Errorf("kubernetes backend: unsupported kind %q in %q (expected deployment or statefulset)", parts[1], target)
+	}
+	return &Kubernetes{c: c, namespace: parts[0], resource: resource, name: parts[2]}, nil
+}
+
+func (k *Kubernetes) path(sub string) string {
+	return "/apis/apps/v1/namespaces/" + url.PathEscape(k.namespace) + "/" + k.resource + "/" + url.PathEscape(k.name) + sub
+}
+
+func (k *Kubernetes) scale(ctx context.Context, replicas int) error {
+	return k.c.do(ctx, http.MethodPatch, k.path("/scale"), "application/merge-patch+json",
+		map[string]any{"spec": map[string]int{"replicas": replicas}}, nil)
+}
+
+// PowerOn scales the workload to one replica.
+func (k *Kubernetes) PowerOn(ctx context.Context) error {
+	return k.scale(ctx, 1)
+}
+
+// PowerOff scales the workload to zero replicas.
+func (k *Kubernetes) PowerOff(ctx context.Context) error {
+	return k.scale(ctx, 0)
+}
+
+type kubernetesWorkload struct {
+	Metadata struct {
+		Generation int64 `json:"generation"`
+	} `json:"metadata"`
+	Spec struct {
+		// Replicas is nil when defaulted to 1.
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration int64 `json:"observedGeneration"`
+		Replicas           int   `json:"replicas"`
+		ReadyReplicas      int   `json:"readyReplicas"`
+	} `json:"status"`
+}
+
+func (k *Kubernetes) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := k.PowerStateDetail(ctx)
+	return on, err
+}
+
+// PowerStateDetail derives the state from the desired replicas and the
+// ready pods: a workload scaled up is on once a pod is ready and powering
+// on until then, one scaled to zero is off once its pods are gone and
+// powering off until then.
+func (k *Kubernetes) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	var w kubernetesWorkload
+	if err := k.c.do(ctx, http.MethodGet, k.path(""), "", nil, &w); err != nil {
+		return false, "", err
+	}
+	replicas := 1
+	if w.Spec.Replicas != nil {
+		replicas = *w.Spec.Replicas
+	}
+	settled := w.Status.ObservedGeneration >= w.Metadata.Generation
+	if replicas == 0 {
+		if w.Status.Replicas > 0 || !settled {
+			return false, PowerStatePoweringOff, nil
+		}
+		return false, "", nil
+	}
+	if w.Status.ReadyReplicas == 0 || !settled {
+		return true, PowerStatePoweringOn, nil
+	}
+	return true, "", nil
+}
+
+// DisplayName is the workload name.
+func (k *Kubernetes) DisplayName(ctx context.Context) (string, error) {
+	return k.name, nil
+}
+
+// Oem reports the workload.
+func (k *Kubernetes) Oem(ctx context.Context) (map[string]any, error) {
+	return map[string]any{"Namespace": k.namespace, "Resource": k.resource, "Name": k.name}, nil
+}
+
+// Ping reads the workload, which checks the API server is reachable and
+// the credentials may see it.
+func (k *Kubernetes) Ping(ctx context.Context) error {
+	return k.c.do(ctx, http.MethodGet, k.path(""), "", nil, nil)
+}
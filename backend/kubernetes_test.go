@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCredentialEnv holds the token the test binary, run as an exec
+// credential plugin, hands out.
+const fakeCredentialEnv = "BMC_SHIM_FAKE_EXEC_CREDENTIAL"
+
+func fakeCredentialPlugin(token string) {
+	_ = json.NewEncoder(os.Stdout).Encode(map[string]any{
+		"apiVersion": "client.authentication.k8s.io/v1",
+		"kind":       "ExecCredential",
+		"status":     map[string]any{"token": token},
+	})
+}
+
+// fakeAPIServer serves one Deployment, web in namespace games, recording
+// the Authorization header and the scale patches it gets.
+type fakeAPIServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	auth     []string
+	workload string
+	patches  []string
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	f := &fakeAPIServer{workload: `{"metadata": {"generation": 2}, "spec": {"replicas": 1}, "status": {"observedGeneration": 2, "replicas": 1, "readyReplicas": 1}}`}
+	const path = "/apis/apps/v1/namespaces/games/deployments/web"
+	f.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.auth = append(f.auth, r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == path:
+			_, _ = w.Write([]byte(f.workload))
+		case r.Method == http.MethodPatch && r.URL.Path == path+"/scale":
+			body, _ := io.ReadAll(r.Body)
+			f.patches = append(f.patches, r.Header.Get("Content-Type")+" "+string(body))
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind": "Status", "message": "not found"}`))
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAPIServer) lastAuth() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.auth) == 0 {
+		return ""
+	}
+	return f.auth[len(f.auth)-1]
+}
+
+// kubeconfig writes a YAML kubeconfig for the server with the given user
+// and returns its path.
+func (f *fakeAPIServer) kubeconfig(t *testing.T, user string) string {
+	t.Helper()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.Certificate().Raw})
+	config := `apiVersion: v1
+kind: Config
+current-context: lab
+clusters:
+- name: lab
+  cluster:
+    server: ` + f.URL + `
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString(ca) + `
+contexts:
+- name: lab
+  context:
+    cluster: lab
+    user: shim
+    namespace: games
+users:
+- name: shim
+  user:
+` + user
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKubeconfigAuth(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		user string
+		want string
+	}{
+		{"token", "    token: static-token\n", "Bearer static-token"},
+		{"token file", "    tokenFile: " + filepath.Join(t.TempDir(), "missing") + "\n", ""},
+		{"exec plugin", `    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: ` + exe + `
+      interactiveMode: Never
+      env:
+      - name: ` + fakeCredentialEnv + `
+        value: exec-token
+`, "Bearer exec-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeAPIServer(t)
+			c, err := NewKubernetesClient(f.kubeconfig(t, tt.user), "")
+			if tt.want == "" {
+				if err == nil {
+					t.Error("NewKubernetesClient succeeded with a missing token file")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The namespace of the context applies to targets without one.
+			k, err := NewKubernetes(c, "deployment/web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := k.Ping(context.Background()); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+			if got := f.lastAuth(); got != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubeconfigJSON(t *testing.T) {
+	f := newFakeAPIServer(t)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.Certificate().Raw})
+	config, _ := json.Marshal(map[string]any{
+		"current-context": "lab",
+		"clusters":        []any{map[string]any{"name": "lab", "cluster": map[string]any{"server": f.URL, "certificate-authority-data": base64.StdEncoding.EncodeToString(ca)}}},
+		"contexts":        []any{map[string]any{"name": "lab", "context": map[string]any{"cluster": "lab", "user": "shim"}}},
+		"users":           []any{map[string]any{"name": "shim", "user": map[string]any{"token": "json-token"}}},
+	})
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, config, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewKubernetesClient(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a namespace in the context, "default" applies.
+	if c.namespace != "default" {
+		t.Errorf("namespace = %q, want default", c.namespace)
+	}
+	k, err := NewKubernetes(c, "games/deploy/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if got := f.lastAuth(); got != "Bearer json-token" {
+		t.Errorf("Authorization = %q, want Bearer json-token", got)
+	}
+}
+
+func TestKubeconfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid")
+	if err := os.WriteFile(invalid, []byte("current-context: [unterminated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	noContext := filepath.Join(dir, "no-context")
+	if err := os.WriteFile(noContext, []byte("apiVersion: v1\nkind: Config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing"), invalid, noContext} {
+		if _, err := NewKubernetesClient(path, ""); err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("NewKubernetesClient(%s) = %v, want an error naming the file", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestKubernetesPowerState(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload string
+		on       bool
+		detail   string
+	}{
+		{"ready", `{"metadata": {"generation": 2}, "spec": {"replicas": 1}, "status": {"observedGeneration": 2, "replicas": 1, "readyReplicas": 1}}`, true, ""},
+		{"defaulted replicas", `{"metadata": {"generation": 1}, "spec": {}, "status": {"observedGeneration": 1, "replicas": 1, "readyReplicas": 1}}`, true, ""},
+		{"pod not ready", `{"metadata": {"generation": 2}, "spec": {"replicas": 1}, "status": {"observedGeneration": 2, "replicas": 1}}`, true, PowerStatePoweringOn},
+		{"scale-up not observed", `{"metadata": {"generation": 3}, "spec": {"replicas": 1}, "status": {"observedGeneration": 2, "replicas": 1, "readyReplicas": 1}}`, true, PowerStatePoweringOn},
+		{"off", `{"metadata": {"generation": 2}, "spec": {"replicas": 0}, "status": {"observedGeneration": 2}}`, false, ""},
+		{"pod terminating", `{"metadata": {"generation": 2}, "spec": {"replicas": 0}, "status": {"observedGeneration": 2, "replicas": 1}}`, false, PowerStatePoweringOff},
+	}
+	f := newFakeAPIServer(t)
+	c, err := NewKubernetesClient(f.kubeconfig(t, "    token: t\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKubernetes(c, "deployment/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		f.mu.Lock()
+		f.workload = tt.workload
+		f.mu.Unlock()
+		on, detail, err := k.PowerStateDetail(context.Background())
+		if err != nil || on != tt.on || detail != tt.detail {
+			t.Errorf("%s: PowerStateDetail = %v, %q, %v, want %v, %q", tt.name, on, detail, err, tt.on, tt.detail)
+		}
+	}
+
+	if err := k.PowerOff(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if want := `application/merge-patch+json {"spec":{"replicas":0}}`; len(f.patches) != 1 || f.patches[0] != want {
+		t.Errorf("patches = %q, want [%q]", f.patches, want)
+	}
+}
@@ -0,0 +1,441 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mqttKeepAlive is the keep alive interval announced to the broker; the
+// client pings at half of it.
+const mqttKeepAlive = 30 * time.Second
+
+// MQTT 3.1.1 control packet types.
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttSubscribe  = 8
+	mqttSubAck     = 9
+	mqttPingReq    = 12
+	mqttDisconnect = 14
+)
+
+// mqttConnAckErrors are the CONNACK return codes of a refused connection.
+var mqttConnAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// MQTTMessage is the last message received on a topic.
+type MQTTMessage struct {
+	Payload  []byte
+	Received time.Time
+}
+
+// MQTTClient is a minimal MQTT 3.1.1 client keeping the last message of
+// every topic it subscribed to, shared by all systems behind the broker.
+// It publishes and subscribes at QoS 0, holds one connection and dials
+// again on the next use once it breaks. The messages of a broken
+// connection are dropped, so nothing is served from a stale view.
+type MQTTClient struct {
+	addr     string
+	tls      *tls.Config
+	user     string
+	pass     string
+	clientID string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	filters []string
+	last    map[string]MQTTMessage
+	// changed is closed and replaced whenever a message arrives or the
+	// connection breaks.
+	changed chan struct{}
+	// wmu serializes writes to conn.
+	wmu    sync.Mutex
+	nextID uint16
+}
+
+// NewMQTTClient returns a client for the broker at rawURL,
+// mqtt://host[:1883] or mqtts://host[:8883]. user and pass may be empty
+// for brokers allowing anonymous clients.
+func NewMQTTClient(rawURL, user, pass string) (*MQTTClient, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "mqtt://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("mqtt requires a broker URL, got %q", rawURL)
+	}
+	c := &MQTTClient{user: user, pass: pass, last: map[string]MQTTMessage{}, changed: make(chan struct{})}
+	port := "1883"
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		port = "8883"
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("mqtt: unsupported scheme %q (expected mqtt or mqtts)", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	c.addr = net.JoinHostPort(u.Hostname(), port)
+	if u.User != nil && c.user == "" {
+		c.user = u.User.Username()
+		c.pass, _ = u.User.Password()
+	}
+	id := make([]byte, 6)
+	_, _ = rand.Read(id)
+	c.clientID = "bmc-shim-" + hex.EncodeToString(id)
+	return c, nil
+}
+
+// Addr returns the broker's host:port.
+func (c *MQTTClient) Addr() string { return c.addr }
+
+// Subscribe adds a topic filter, e.g. "zigbee2mqtt/#", whose messages the
+// client keeps. It subscribes on the current connection, if any, and on
+// every new one.
+func (c *MQTTClient) Subscribe(filter string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.filters {
+		if f == filter {
+			return
+		}
+	}
+	c.filters = append(c.filters, filter)
+	if c.conn != nil {
+		if err := c.subscribeLocked(c.conn, []string{filter}); err != nil {
+			c.dropLocked(c.conn, err)
+		}
+	}
+}
+
+// Connect dials the broker unless the client is connected.
+func (c *MQTTClient) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return nil
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("mqtt %s: %w", c.addr, err)
+	}
+	if c.tls != nil {
+		tc := tls.Client(conn, c.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("mqtt %s: %w", c.addr, err)
+		}
+		conn = tc
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	r := bufio.NewReader(conn)
+	if err := c.handshake(conn, r); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("mqtt %s: %w", c.addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if err := c.subscribeLocked(conn, c.filters); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("mqtt %s: %w", c.addr, err)
+	}
+	c.conn = conn
+	go c.readLoop(conn, r)
+	go c.keepAlive(conn)
+	return nil
+}
+
+// handshake sends CONNECT and waits for the broker to accept it.
+func (c *MQTTClient) handshake(conn net.Conn, r *bufio.Reader) error {
+	var flags byte = 0x02 // clean session
+	payload := mqttString(c.clientID)
+	if c.user != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(c.user)...)
+		if c.pass != "" {
+			flags |= 0x40
+			payload = append(payload, mqttString(c.pass)...)
+		}
+	}
+	body := append(mqttString("MQTT"), 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	if _, err := conn.Write(mqttPacket(mqttConnect<<4, append(body, payload...))); err != nil {
+		return err
+	}
+	typ, body, err := mqttRead(r)
+	if err != nil {
+		return err
+	}
+	if typ>>4 != mqttConnAck || len(body) != 2 {
+		return errors.New("unexpected response to CONNECT")
+	}
+	if body[1] != 0 {
+		if msg, ok := mqttConnAckErrors[body[1]]; ok {
+			return fmt.Errorf("connection refused: %s", msg)
+		}
+		return fmt.Errorf("connection refused (code %d)", body[1])
+	}
+	return nil
+}
+
+// subscribeLocked subscribes to filters at QoS 0. Callers hold c.mu.
+func (c *MQTTClient) subscribeLocked(conn net.Conn, filters []string) error {
+	if len(filters) == 0 {
+		return nil
+	}
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	body := binary.BigEndian.AppendUint16(nil, c.nextID)
+	for _, f := range filters {
+		body = append(append(body, mqttString(f)...), 0)
+	}
+	return c.write(conn, mqttPacket(mqttSubscribe<<4|0x02, body))
+}
+
+func (c *MQTTClient) write(conn net.Conn, packet []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := conn.Write(packet)
+	return err
+}
+
+// readLoop keeps the messages arriving on conn until it breaks.
+func (c *MQTTClient) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		// The broker answers our pings, so silence means a dead link.
+		_ = conn.SetReadDeadline(time.Now().Add(mqttKeepAlive + mqttKeepAlive/2))
+		typ, body, err := mqttRead(r)
+		if err != nil {
+			c.drop(conn, err)
+			return
+		}
+		switch typ >> 4 {
+		case mqttPublish:
+			topic, payload, id, err := mqttParsePublish(typ, body)
+			if err != nil {
+				c.drop(conn, err)
+				return
+			}
+			if (typ>>1)&0x03 == 1 {
+				_ = c.write(conn, mqttPacket(mqttPubAck<<4, binary.BigEndian.AppendUint16(nil, id)))
+			}
+			c.mu.Lock()
+			if c.conn == conn {
+				c.last[topic] = MQTTMessage{Payload: payload, Received: time.Now()}
+				close(c.changed)
+				c.changed = make(chan struct{})
+			}
+			c.mu.Unlock()
+		case mqttSubAck:
+			for _, code := range body[min(2, len(body)):] {
+				if code == 0x80 {
+					log.Printf("mqtt %s: subscription refused", c.addr)
+				}
+			}
+		}
+	}
+}
+
+// keepAlive pings the broker until conn is dropped.
+func (c *MQTTClient) keepAlive(conn net.Conn) {
+	t := time.NewTicker(mqttKeepAlive / 2)
+	defer t.Stop()
+	for range t.C {
+		c.mu.Lock()
+		current := c.conn == conn
+		c.mu.Unlock()
+		if !current {
+			return
+		}
+		if err := c.write(conn, []byte{mqttPingReq << 4, 0}); err != nil {
+			c.drop(conn, err)
+			return
+		}
+	}
+}
+
+func (c *MQTTClient) drop(conn net.Conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropLocked(conn, err)
+}
+
+// dropLocked closes conn and forgets its messages if it is the current
+// connection. Callers hold c.mu.
+func (c *MQTTClient) dropLocked(conn net.Conn, err error) {
+	if c.conn != conn {
+		return
+	}
+	_ = conn.Close()
+	c.conn = nil
+	clear(c.last)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("mqtt %s: connection lost: %v", c.addr, err)
+	}
+}
+
+// Reconnect drops the connection and dials again.
+func (c *MQTTClient) Reconnect(ctx context.Context) error {
+	c.mu.Lock()
+	if c.conn != nil {
+		_ = c.write(c.conn, []byte{mqttDisconnect << 4, 0})
+		c.dropLocked(c.conn, nil)
+	}
+	c.mu.Unlock()
+	return c.Connect(ctx)
+}
+
+// Publish sends payload to topic at QoS 0, connecting first if needed.
+func (c *MQTTClient) Publish(ctx context.Context, topic string, payload []byte) error {
+	if len(topic) > 0xffff {
+		return fmt.Errorf("mqtt: topic too long")
+	}
+	if err := c.Connect(ctx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("mqtt %s: not connected", c.addr)
+	}
+	if err := c.write(conn, mqttPacket(mqttPublish<<4, append(mqttString(topic), payload...))); err != nil {
+		c.drop(conn, err)
+		return fmt.Errorf("mqtt %s: %w", c.addr, err)
+	}
+	return nil
+}
+
+// Last returns the last message received on topic on the current
+// connection.
+func (c *MQTTClient) Last(topic string) (MQTTMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.last[topic]
+	return m, ok
+}
+
+// Await waits until done, called whenever a message arrives, returns true,
+// the connection breaks or ctx ends.
+func (c *MQTTClient) Await(ctx context.Context, done func() bool) error {
+	for {
+		c.mu.Lock()
+		conn, changed := c.conn, c.changed
+		c.mu.Unlock()
+		if done() {
+			return nil
+		}
+		if conn == nil {
+			return fmt.Errorf("mqtt %s: not connected", c.addr)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// mqttString encodes s as a length-prefixed MQTT string.
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+// mqttPacket frames body with the fixed header byte typ.
+func mqttPacket(typ byte, body []byte) []byte {
+	b := []byte{typ}
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+// mqttRead reads one packet, returning its fixed header byte and body.
+func mqttRead(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i == 4 {
+			return 0, nil, errors.New("mqtt: malformed packet length")
+		}
+		n += int(d&0x7f) * mult
+		mult *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+// mqttParsePublish splits a PUBLISH body into its topic, payload and,
+// for QoS 1 and 2, packet identifier.
+func mqttParsePublish(typ byte, body []byte) (string, []byte, uint16, error) {
+	if len(body) < 2 {
+		return "", nil, 0, errors.New("mqtt: malformed PUBLISH")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	rest := body[2:]
+	if len(rest) < n {
+		return "", nil, 0, errors.New("mqtt: malformed PUBLISH")
+	}
+	topic, rest := string(rest[:n]), rest[n:]
+	var id uint16
+	if (typ>>1)&0x03 > 0 {
+		if len(rest) < 2 {
+			return "", nil, 0, errors.New("mqtt: malformed PUBLISH")
+		}
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+	return topic, rest, id, nil
+}
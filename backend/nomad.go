@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// NomadClient talks to the Nomad HTTP API and is shared by all jobs.
+type NomadClient struct {
+	addr      string
+	token     string
+	region    string
+	namespace string
+	client    *http.Client
+}
+
+// NewNomadClient returns a client for the Nomad agent at addr. Empty
+// values fall back to NOMAD_ADDR, NOMAD_TOKEN, NOMAD_REGION and
+// NOMAD_NAMESPACE like the nomad CLI.
+func NewNomadClient(addr, token, region, namespace string) *NomadClient {
+	env := func(v, name, def string) string {
+		if v == "" {
+			v = os.Getenv(name)
+		}
+		if v == "" {
+			v = def
+		}
+		return v
+	}
+	return &NomadClient{
+		addr:      strings.TrimRight(env(addr, "NOMAD_ADDR", "http://127.0.0.1:4646"), "/"),
+		token:     env(token, "NOMAD_TOKEN", ""),
+		region:    env(region, "NOMAD_REGION", ""),
+		namespace: env(namespace, "NOMAD_NAMESPACE", ""),
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (c *NomadClient) do(ctx context.Context, method, path string, body, out any) error {
+	q := url.Values{}
+	if c.region != "" {
+		q.Set("region", c.region)
+	}
+	if c.namespace != "" {
+		q.Set("namespace", c.namespace)
+	}
+	u := c.addr + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Nomad reports errors as plain text.
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("nomad %s %s: http %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Nomad controls a Nomad job, or a single task group of it, as if it
+// were a machine.
+type Nomad struct {
+	c     *NomadClient
+	job   string
+	group string
+	count int
+}
+
+// NewNomad returns a backend for target, given as job or job/group. With a
+// group, PowerOn and PowerOff scale the group to count and to zero instead
+// of starting and stopping the whole job.
+func NewNomad(c *NomadClient, target string, count int) (*Nomad, error) {
+	job, group, _ := strings.Cut(target, "/")
+	if job == "" || (strings.Contains(target, "/") && group == "") {
+		return nil, fmt.Errorf("nomad backend requires a target of the form job[/group], got %q", target)
+	}
+	if count < 1 {
+		count = 1
+	}
+	return &Nomad{c: c, job: job, group: group, count: count}, nil
+}
+
+func (n *Nomad) path(sub string) string {
+	return "/v1/job/" + url.PathEscape(n.job) + sub
+}
+
+func (n *Nomad) scale(ctx context.Context, count int) error {
+	return n.c.do(ctx, http.MethodPost, n.path("/scale"), map[string]any{
+		"Count":   count,
+		"Target":  map[string]string{"Group": n.group},
+		"Message": "bmc-shim power action",
+	}, nil)
+}
+
+// PowerOn registers a stopped job again with Stop cleared, as nomad job
+// start does, or scales the group up.
+func (n *Nomad) PowerOn(ctx context.Context) error {
+	if n.group != "" {
+		return n.scale(ctx, n.count)
+	}
+	// Raw fields keep nanosecond timestamps intact on the round trip.
+	var job map[string]json.RawMessage
+	if err := n.c.do(ctx, http.MethodGet, n.path(""), nil, &job); err != nil {
+		return err
+	}
+	if string(job["Stop"]) != "true" {
+		return nil
+	}
+	job["Stop"] = json.RawMessage("false")
+	return n.c.do(ctx, http.MethodPost, n.path(""), map[string]any{"Job": job}, nil)
+}
+
+// PowerOff stops the job without purging it, or scales the group to zero.
+func (n *Nomad) PowerOff(ctx context.Context) error {
+	if n.group != "" {
+		return n.scale(ctx, 0)
+	}
+	return n.c.do(ctx, http.MethodDelete, n.path(""), nil, nil)
+}
+
+type nomadJob struct {
+	Name   string `json:"Name"`
+	Status string `json:"Status"`
+	Stop   bool   `json:"Stop"`
+}
+
+func (n *Nomad) CurrentState(ctx context.Context) (bool, error) {
+	on, _, err := n.PowerStateDetail(ctx)
+	return on, err
+}
+
+// PowerStateDetail derives the state from the job status, or for a group
+// from its allocation summary: running allocations mean on, and a job
+// whose desired state disagrees with its allocations is in transition.
+func (n *Nomad) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	if n.group != "" {
+		var sum struct {
+			Summary map[string]struct {
+				Running  int `json:"Running"`
+				Starting int `json:"Starting"`
+				Queued   int `json:"Queued"`
+			} `json:"Summary"`
+		}
+		if err := n.c.do(ctx, http.MethodGet, n.path("/summary"), nil, &sum); err != nil {
+			return false, "", err
+		}
+		g, ok := sum.Summary[n.group]
+		if !ok {
+			return false, "", fmt.Errorf("nomad job %s: no task group %q", n.job, n.group)
+		}
+		switch {
+		case g.Running > 0:
+			return true, "", nil
+		case g.Starting > 0 || g.Queued > 0:
+			return true, PowerStatePoweringOn, nil
+		}
+		return false, "", nil
+	}
+	var job nomadJob
+	if err := n.c.do(ctx, http.MethodGet, n.path(""), nil, &job); err != nil {
+		return false, "", err
+	}
+	switch {
+	case job.Status == "dead":
+		return false, "", nil
+	case job.Stop:
+		return false, PowerStatePoweringOff, nil
+	case job.Status == "running":
+		return true, "", nil
+	case job.Status == "pending":
+		return true, PowerStatePoweringOn, nil
+	}
+	return false, "", fmt.Errorf("nomad job %s: unknown status %q", n.job, job.Status)
+}
+
+func (n *Nomad) DisplayName(ctx context.Context) (string, error) {
+	var job nomadJob
+	if err := n.c.do(ctx, http.MethodGet, n.path(""), nil, &job); err != nil {
+		return "", err
+	}
+	if n.group != "" {
+		return job.Name + "/" + n.group, nil
+	}
+	return job.Name, nil
+}
+
+// Ping checks the cluster has a leader.
+func (n *Nomad) Ping(ctx context.Context) error {
+	var leader string
+	if err := n.c.do(ctx, http.MethodGet, "/v1/status/leader", nil, &leader); err != nil {
+		return err
+	}
+	if leader == "" {
+		return errors.New("nomad: no cluster leader")
+	}
+	return nil
+}
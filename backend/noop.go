@@ -0,0 +1,189 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrSimulated is returned by noop backend calls failed on purpose.
+var ErrSimulated = errors.New("simulated failure")
+
+// Faults are misbehaviours the noop backend simulates on request, so that
+// clients' error handling can be tested.
+type Faults struct {
+	// FailNext is how many of the next calls that change something
+	// (power actions, boot and indicator settings) fail.
+	FailNext int
+	// Latency delays every call.
+	Latency time.Duration
+	// ForcedState, if "On" or "Off", is reported whatever the power
+	// actions did.
+	ForcedState string
+	// FlapInterval makes the reported state flip at this interval.
+	FlapInterval time.Duration
+}
+
+// FaultInjector is an optional interface for simulating backends that can
+// be told to misbehave.
+type FaultInjector interface {
+	Faults() Faults
+	SetFaults(f Faults)
+}
+
+type noop struct {
+	mu  sync.Mutex
+	led string
+	on  bool
+	// faults are the simulated misbehaviours; flapSince is when they
+	// were set, the start of the first flap interval.
+	faults    Faults
+	flapSince time.Time
+}
+
+// NewNoop returns a System that only keeps its state in memory. It
+// implements the ResetTypes itself, so restarts and power cycles take no
+// time.
+func NewNoop() System { return &noop{led: IndicatorOff} }
+
+// simulate applies the configured latency and, for calls that change
+// something, fails if failures are pending.
+func (n *noop) simulate(ctx context.Context, change bool) error {
+	n.mu.Lock()
+	f := n.faults
+	fail := change && f.FailNext > 0
+	if fail {
+		n.faults.FailNext--
+	}
+	n.mu.Unlock()
+	if f.Latency > 0 {
+		t := time.NewTimer(f.Latency)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if fail {
+		return ErrSimulated
+	}
+	return nil
+}
+
+// noopReset is a ResetType of the noop backend and the power state it
+// leaves the system in.
+type noopReset struct {
+	t      ResetType
+	on     bool
+	hidden bool
+}
+
+var noopResets = []noopReset{
+	{t: ResetOn, on: true},
+	{t: ResetForceOff},
+	{t: ResetGracefulShutdown},
+	{t: ResetForceRestart, on: true},
+	{t: "PowerCycle", on: true},
+	{t: ResetGracefulRestart, on: true, hidden: true},
+	{t: "Off", hidden: true},
+}
+
+func (n *noop) Capabilities() Capability {
+	c := Capability{
+		PowerState: true,
+		Health:     n,
+		Boot:       n,
+		Indicator:  n,
+		Faults:     n,
+	}
+	for _, r := range noopResets {
+		c.Resets = append(c.Resets, ResetCapability{Type: r.t, Calls: []string{"Reset(" + string(r.t) + ")"}, Hidden: r.hidden})
+	}
+	return c
+}
+
+func (n *noop) Reset(ctx context.Context, t ResetType) error {
+	i := slices.IndexFunc(noopResets, func(r noopReset) bool { return r.t == t })
+	if i < 0 {
+		return ErrNotSupported
+	}
+	if err := n.simulate(ctx, true); err != nil {
+		log.Printf("noop backend: Reset %s: %v", t, err)
+		return err
+	}
+	log.Printf("noop backend: Reset %s", t)
+	n.mu.Lock()
+	n.on = noopResets[i].on
+	n.mu.Unlock()
+	return nil
+}
+
+// State reports the simulated power state: the outcome of the last power
+// action unless a state is forced, flipped every FlapInterval.
+func (n *noop) State(ctx context.Context) (PowerState, error) {
+	if err := n.simulate(ctx, false); err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	on := n.on
+	switch n.faults.ForcedState {
+	case "On":
+		on = true
+	case "Off":
+		on = false
+	}
+	if iv := n.faults.FlapInterval; iv > 0 && time.Since(n.flapSince)/iv%2 == 1 {
+		on = !on
+	}
+	return onOff(on), nil
+}
+
+func (n *noop) Ping(ctx context.Context) error {
+	return n.simulate(ctx, false)
+}
+
+func (n *noop) Faults() Faults {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.faults
+}
+
+func (n *noop) SetFaults(f Faults) {
+	n.mu.Lock()
+	n.faults = f
+	n.flapSince = time.Now()
+	n.mu.Unlock()
+}
+
+func (n *noop) IndicatorLED(ctx context.Context) (string, error) {
+	if err := n.simulate(ctx, false); err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.led, nil
+}
+
+func (n *noop) SetIndicatorLED(ctx context.Context, state string) error {
+	if err := n.simulate(ctx, true); err != nil {
+		return err
+	}
+	log.Printf("noop backend: SetIndicatorLED %s", state)
+	n.mu.Lock()
+	n.led = state
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *noop) SetBoot(ctx context.Context, opts BootOptions) error {
+	if err := n.simulate(ctx, true); err != nil {
+		return err
+	}
+	log.Printf("noop backend: SetBoot %+v", opts)
+	return nil
+}
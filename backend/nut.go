@@ -0,0 +1,272 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NUTClient speaks the Network UPS Tools protocol to upsd. It holds one
+// authenticated connection, shared by all outlets of the UPS, and dials
+// again when it breaks.
+type NUTClient struct {
+	addr string
+	ups  string
+	user string
+	pass string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewNUTClient returns a client for the UPS named ups at upsd's addr
+// (host[:port], default port 3493). user and pass are an upsd.users
+// account allowed to run the outlet instant commands.
+func NewNUTClient(addr, ups, user, pass string) (*NUTClient, error) {
+	if addr == "" || ups == "" {
+		return nil, errors.New("nut backend requires the upsd address and UPS name")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "3493")
+	}
+	return &NUTClient{addr: addr, ups: ups, user: user, pass: pass}, nil
+}
+
+// NUTError is an ERR response from upsd, e.g. ACCESS-DENIED.
+type NUTError struct {
+	Code string
+}
+
+func (e *NUTError) Error() string { return "nut: " + e.Code }
+
+// connect dials upsd and authenticates. Callers hold c.mu.
+func (c *NUTClient) connect(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	if c.user != "" {
+		for _, cmd := range []string{"USERNAME " + nutQuote(c.user), "PASSWORD " + nutQuote(c.pass)} {
+			if _, err := c.roundTrip(ctx, cmd); err != nil {
+				c.closeLocked()
+				return fmt.Errorf("nut login: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *NUTClient) closeLocked() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn, c.r = nil, nil
+	}
+}
+
+// roundTrip sends one command and returns its first response line.
+// Callers hold c.mu.
+func (c *NUTClient) roundTrip(ctx context.Context, cmd string) (string, error) {
+	deadline := time.Now().Add(10 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetDeadline(deadline)
+	if _, err := c.conn.Write([]byte(cmd + "\n")); err != nil {
+		return "", err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if code, ok := strings.CutPrefix(line, "ERR "); ok {
+		return "", &NUTError{Code: code}
+	}
+	return line, nil
+}
+
+func (c *NUTClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// do runs fn on the connection, connecting first and retrying once on a
+// fresh connection if the old one turns out to be broken.
+func (c *NUTClient) do(ctx context.Context, fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if err := c.connect(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		var ne *NUTError
+		if err == nil || errors.As(err, &ne) {
+			return err
+		}
+		c.closeLocked()
+		if attempt > 0 || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// Reconnect drops the connection; the next request dials again.
+func (c *NUTClient) Reconnect(ctx context.Context) error {
+	c.mu.Lock()
+	c.closeLocked()
+	c.mu.Unlock()
+	return c.ping(ctx)
+}
+
+func (c *NUTClient) instCmd(ctx context.Context, cmd string) error {
+	return c.do(ctx, func() error {
+		line, err := c.roundTrip(ctx, "INSTCMD "+c.ups+" "+cmd)
+		if err != nil {
+			return fmt.Errorf("nut %s: %w", cmd, err)
+		}
+		// "OK" or, with tracking enabled, "OK TRACKING <id>".
+		if !strings.HasPrefix(line, "OK") {
+			return fmt.Errorf("nut %s: unexpected response %q", cmd, line)
+		}
+		return nil
+	})
+}
+
+func (c *NUTClient) getVar(ctx context.Context, name string) (string, error) {
+	var value string
+	err := c.do(ctx, func() error {
+		line, err := c.roundTrip(ctx, "GET VAR "+c.ups+" "+name)
+		if err != nil {
+			return fmt.Errorf("nut %s: %w", name, err)
+		}
+		prefix := "VAR " + c.ups + " " + name + " "
+		rest, ok := strings.CutPrefix(line, prefix)
+		if !ok {
+			return fmt.Errorf("nut %s: unexpected response %q", name, line)
+		}
+		value, err = nutUnquote(rest)
+		return err
+	})
+	return value, err
+}
+
+// ping lists the UPSes and checks ours is among them.
+func (c *NUTClient) ping(ctx context.Context) error {
+	return c.do(ctx, func() error {
+		line, err := c.roundTrip(ctx, "LIST UPS")
+		if err != nil {
+			return err
+		}
+		if line != "BEGIN LIST UPS" {
+			return fmt.Errorf("nut LIST UPS: unexpected response %q", line)
+		}
+		found := false
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END LIST UPS" {
+				break
+			}
+			if f := strings.Fields(line); len(f) >= 2 && f[0] == "UPS" && f[1] == c.ups {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("nut: UPS %q not found on %s", c.ups, c.addr)
+		}
+		return nil
+	})
+}
+
+// nutQuote quotes s as a NUT protocol argument.
+func nutQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// nutUnquote parses a quoted NUT protocol value.
+func nutUnquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("nut: malformed value %q", s)
+	}
+	var b strings.Builder
+	s = s[1 : len(s)-1]
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// NUT controls one switchable outlet (group) of a UPS.
+type NUT struct {
+	c      *NUTClient
+	outlet string
+}
+
+// NewNUT returns a backend for the outlet with the given number.
+func NewNUT(c *NUTClient, outlet string) (*NUT, error) {
+	if _, err := strconv.ParseUint(outlet, 10, 32); err != nil {
+		return nil, fmt.Errorf("nut backend requires a numeric outlet, got %q", outlet)
+	}
+	return &NUT{c: c, outlet: outlet}, nil
+}
+
+func (n *NUT) PowerOn(ctx context.Context) error {
+	return n.c.instCmd(ctx, "outlet."+n.outlet+".load.on")
+}
+
+func (n *NUT) PowerOff(ctx context.Context) error {
+	return n.c.instCmd(ctx, "outlet."+n.outlet+".load.off")
+}
+
+func (n *NUT) CurrentState(ctx context.Context) (bool, error) {
+	status, err := n.c.getVar(ctx, "outlet."+n.outlet+".status")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(status) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("nut outlet %s: unknown status %q", n.outlet, status)
+	}
+}
+
+// DisplayName returns the outlet description, e.g. "Outlet 1".
+func (n *NUT) DisplayName(ctx context.Context) (string, error) {
+	return n.c.getVar(ctx, "outlet."+n.outlet+".desc")
+}
+
+func (n *NUT) Ping(ctx context.Context) error {
+	return n.c.ping(ctx)
+}
+
+// Start connects to upsd and checks the UPS exists.
+func (n *NUT) Start(ctx context.Context) error {
+	return n.c.ping(ctx)
+}
+
+func (n *NUT) Reconnect(ctx context.Context) error {
+	return n.c.Reconnect(ctx)
+}
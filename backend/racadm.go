@@ -0,0 +1,172 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RacadmConfig describes how racadm reaches the iDRACs.
+type RacadmConfig struct {
+	// Mode is "local" (racadm talks to the iDRAC of this host), "remote"
+	// (racadm -r host) or "ssh" (racadm run on the iDRAC over SSH).
+	Mode     string
+	User     string
+	Password string
+	// Binary is the racadm executable, default "racadm".
+	Binary string
+}
+
+// Racadm controls a Dell server through racadm serveraction.
+type Racadm struct {
+	cfg  RacadmConfig
+	host string
+}
+
+// NewRacadm returns a backend for the iDRAC at host (empty in local mode).
+func NewRacadm(cfg RacadmConfig, host string) (*Racadm, error) {
+	if cfg.Binary == "" {
+		cfg.Binary = "racadm"
+	}
+	switch cfg.Mode {
+	case "", "local":
+		cfg.Mode = "local"
+		host = ""
+	case "remote", "ssh":
+		if host == "" || cfg.User == "" {
+			return nil, fmt.Errorf("racadm %s mode requires an iDRAC host and user", cfg.Mode)
+		}
+		if cfg.Mode == "remote" && cfg.Password == "" {
+			return nil, errors.New("racadm remote mode requires a password")
+		}
+	default:
+		return nil, fmt.Errorf("unknown racadm mode %q (expected local, remote or ssh)", cfg.Mode)
+	}
+	return &Racadm{cfg: cfg, host: host}, nil
+}
+
+// command builds the command running racadm with args. The password is
+// handed over in the environment wherever the transport allows it; only
+// racadm -r insists on it being an argument.
+func (r *Racadm) command(ctx context.Context, args ...string) *exec.Cmd {
+	switch r.cfg.Mode {
+	case "remote":
+		args = append([]string{"-r", r.host, "-u", r.cfg.User, "-p", r.cfg.Password}, args...)
+		return exec.CommandContext(ctx, r.cfg.Binary, args...)
+	case "ssh":
+		ssh := []string{"-o", "StrictHostKeyChecking=accept-new", r.cfg.User + "@" + r.host, "racadm"}
+		if r.cfg.Password == "" {
+			return exec.CommandContext(ctx, "ssh", append(append([]string{"-o", "BatchMode=yes"}, ssh...), args...)...)
+		}
+		cmd := exec.CommandContext(ctx, "sshpass", append(append([]string{"-e", "ssh"}, ssh...), args...)...)
+		cmd.Env = append(os.Environ(), "SSHPASS="+r.cfg.Password)
+		return cmd
+	default:
+		return exec.CommandContext(ctx, r.cfg.Binary, args...)
+	}
+}
+
+// serverAction runs racadm serveraction action and returns its output.
+func (r *Racadm) serverAction(ctx context.Context, action string) (string, error) {
+	var out bytes.Buffer
+	cmd := r.command(ctx, "serveraction", action)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return serverActionResult(action, out.String(), err)
+}
+
+// serverActionResult returns the output of racadm serveraction action
+// that exited with err, or the error it reports.
+func serverActionResult(action, out string, err error) (string, error) {
+	text := strings.TrimSpace(out)
+	// racadm reports some failures with exit status 0.
+	if err == nil && strings.HasPrefix(strings.ToUpper(text), "ERROR") {
+		err = errors.New("failed")
+	}
+	if err != nil {
+		if text != "" {
+			return "", fmt.Errorf("racadm serveraction %s: %v: %s", action, err, text)
+		}
+		return "", fmt.Errorf("racadm serveraction %s: %w", action, err)
+	}
+	return text, nil
+}
+
+func (r *Racadm) PowerOn(ctx context.Context) error {
+	_, err := r.serverAction(ctx, "powerup")
+	return err
+}
+
+func (r *Racadm) PowerOff(ctx context.Context) error {
+	_, err := r.serverAction(ctx, "powerdown")
+	return err
+}
+
+func (r *Racadm) GracefulPowerOff(ctx context.Context) error {
+	_, err := r.serverAction(ctx, "graceshutdown")
+	return err
+}
+
+func (r *Racadm) Capabilities() Capability {
+	return capabilities(r, ResetForceRestart, ResetPowerCycle)
+}
+
+// Reset maps ForceRestart to a hard reset and PowerCycle to a power cycle.
+func (r *Racadm) Reset(ctx context.Context, t ResetType) error {
+	var err error
+	switch t {
+	case ResetForceRestart:
+		_, err = r.serverAction(ctx, "hardreset")
+	case ResetPowerCycle:
+		_, err = r.serverAction(ctx, "powercycle")
+	default:
+		err = standardReset(ctx, r, t)
+	}
+	return err
+}
+
+func (r *Racadm) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, r)
+}
+
+func (r *Racadm) CurrentState(ctx context.Context) (bool, error) {
+	out, err := r.serverAction(ctx, "powerstatus")
+	if err != nil {
+		return false, err
+	}
+	return parsePowerStatus(out)
+}
+
+func (r *Racadm) Ping(ctx context.Context) error {
+	_, err := r.CurrentState(ctx)
+	return err
+}
+
+// parsePowerStatus parses the output of racadm serveraction powerstatus,
+// e.g. "Server power status: ON". Firmware versions differ in banners and
+// wording, so the last line containing "power status" wins.
+func parsePowerStatus(out string) (bool, error) {
+	lines := strings.Split(out, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.Contains(strings.ToLower(line), "power status") {
+			continue
+		}
+		_, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(strings.TrimSpace(v)) {
+		case "ON":
+			return true, nil
+		case "OFF":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("racadm: cannot parse power status from %q", out)
+}
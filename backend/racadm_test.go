@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRacadmPowerStatus parses racadm serveraction powerstatus outputs
+// captured from iDRACs, in testdata/racadm.
+func TestRacadmPowerStatus(t *testing.T) {
+	tests := []struct {
+		file    string
+		exitErr error
+		want    bool
+		wantErr string
+	}{
+		{file: "idrac8-on.txt", want: true},
+		{file: "idrac9-off.txt", want: false},
+		{file: "idrac6-remote-on.txt", want: true},
+		{file: "idrac6-ssh-off.txt", want: false},
+		// Old racadm versions exit with 0 on errors.
+		{file: "error-connect.txt", wantErr: "Unable to connect to RAC"},
+		{file: "error-login.txt", exitErr: errors.New("exit status 2"), wantErr: "exit status 2: ERROR: Login failed"},
+		{file: "unknown-state.txt", wantErr: "cannot parse power status"},
+		{file: "no-value.txt", wantErr: "cannot parse power status"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSuffix(tt.file, ".txt"), func(t *testing.T) {
+			out, err := os.ReadFile(filepath.Join("testdata", "racadm", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, err := serverActionResult("powerstatus", string(out), tt.exitErr)
+			var on bool
+			if err == nil {
+				on, err = parsePowerStatus(text)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("power status = %v, %v, want an error containing %q", on, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || on != tt.want {
+				t.Errorf("power status = %v, %v, want %v", on, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRacadmActionFailure(t *testing.T) {
+	if _, err := serverActionResult("powerup", "", errors.New("exit status 1")); err == nil || err.Error() != "racadm serveraction powerup: exit status 1" {
+		t.Errorf("error without output = %v", err)
+	}
+	if out, err := serverActionResult("powerup", "Server power operation successful\n", nil); err != nil || out != "Server power operation successful" {
+		t.Errorf("successful powerup = %q, %v", out, err)
+	}
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Shell is the interpreter command lines are run with: a program and its
+// arguments, to which the command line is appended.
+type Shell []string
+
+// DefaultShell returns the platform's interpreter: sh -lc, or PowerShell
+// on Windows.
+func DefaultShell() Shell {
+	return append(Shell(nil), defaultShell...)
+}
+
+// ParseShell parses an interpreter given as space-separated words, e.g.
+// "cmd /C". An empty string means DefaultShell.
+func ParseShell(s string) (Shell, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultShell(), nil
+	}
+	sh := Shell(strings.Fields(s))
+	if strings.HasPrefix(sh[0], "-") {
+		return nil, errors.New("shell must start with the program, e.g. \"cmd /C\"")
+	}
+	return sh, nil
+}
+
+// Args returns the argv that runs line.
+func (sh Shell) Args(line string) []string {
+	if len(sh) == 0 {
+		sh = defaultShell
+	}
+	return append(append([]string(nil), sh...), line)
+}
+
+// Run runs line and waits for it, failing if it exits with a non-zero
+// status.
+func (sh Shell) Run(ctx context.Context, line string) error {
+	args := sh.Args(line)
+	return exec.CommandContext(ctx, args[0], args[1:]...).Run()
+}
+
+func (sh Shell) String() string {
+	if len(sh) == 0 {
+		sh = defaultShell
+	}
+	return strings.Join(sh, " ")
+}
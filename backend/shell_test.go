@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeShellEnv names the file the test binary, run as a fake interpreter,
+// records its arguments in.
+const fakeShellEnv = "BMC_SHIM_FAKE_SHELL"
+
+// TestMain turns the test binary into the fake interpreter of fakeShell
+// when fakeShellEnv is set: it appends its arguments to the file as a JSON
+// line and fails if the command line contains "fail". This runs the same
+// on every platform, without sh or PowerShell. With fakeCredentialEnv or
+// fakeCredentialProcessEnv set it is a Kubernetes exec credential plugin
+// or an AWS credential_process instead.
+func TestMain(m *testing.M) {
+	if token := os.Getenv(fakeCredentialEnv); token != "" {
+		fakeCredentialPlugin(token)
+		os.Exit(0)
+	}
+	if key := os.Getenv(fakeCredentialProcessEnv); key != "" {
+		fakeCredentialProcess(key)
+		os.Exit(0)
+	}
+	if out := os.Getenv(fakeShellEnv); out != "" {
+		f, err := os.OpenFile(out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			os.Exit(2)
+		}
+		_ = json.NewEncoder(f).Encode(os.Args[1:])
+		_ = f.Close()
+		if strings.Contains(os.Args[len(os.Args)-1], "fail") {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeShell returns a Shell running the test binary as the interpreter,
+// and a function returning the argv of each of its runs.
+func fakeShell(t *testing.T, args ...string) (Shell, func() [][]string) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "argv")
+	t.Setenv(fakeShellEnv, out)
+	runs := func() [][]string {
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var all [][]string
+		dec := json.NewDecoder(strings.NewReader(string(b)))
+		for dec.More() {
+			var argv []string
+			if err := dec.Decode(&argv); err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, argv)
+		}
+		return all
+	}
+	return append(Shell{exe}, args...), runs
+}
+
+func TestParseShell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Shell
+		ok   bool
+	}{
+		{"", DefaultShell(), true},
+		{"  ", DefaultShell(), true},
+		{"cmd /C", Shell{"cmd", "/C"}, true},
+		{"powershell -NoProfile -Command", Shell{"powershell", "-NoProfile", "-Command"}, true},
+		{"bash  -c", Shell{"bash", "-c"}, true},
+		{"-c", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseShell(tt.in)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("ParseShell(%q) = %q, %v, want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestShellArgs(t *testing.T) {
+	const line = `Set-Outlet -Id 3 -State "on"; echo 'done'`
+	tests := []struct {
+		sh   Shell
+		want []string
+	}{
+		{Shell{"sh", "-lc"}, []string{"sh", "-lc", line}},
+		{Shell{"cmd", "/C"}, []string{"cmd", "/C", line}},
+		{Shell{"powershell", "-NoProfile", "-NonInteractive", "-Command"}, []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", line}},
+		{nil, append(slices.Clone(defaultShell), line)},
+	}
+	for _, tt := range tests {
+		if got := tt.sh.Args(line); !slices.Equal(got, tt.want) {
+			t.Errorf("%q.Args = %q, want %q", tt.sh, got, tt.want)
+		}
+	}
+	sh := Shell{"cmd", "/C"}
+	_ = sh.Args("a")
+	if !slices.Equal(sh, Shell{"cmd", "/C"}) {
+		t.Errorf("Args modified the shell: %q", sh)
+	}
+}
+
+// TestCommandArgv runs the command backend with the fake interpreter and
+// checks the argv each reset runs.
+func TestCommandArgv(t *testing.T) {
+	sh, runs := fakeShell(t, "-Command")
+	be, err := NewCommand("outlet 3 on", "outlet 3 off", WithCommandShell(sh), WithCommandResets(map[string]string{"ForceRestart": `outlet 3 "cycle"`}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := Adapt(be)
+	ctx := context.Background()
+	for _, rt := range []ResetType{ResetOn, ResetForceOff, ResetForceRestart} {
+		if err := sys.Reset(ctx, rt); err != nil {
+			t.Fatalf("Reset(%s): %v", rt, err)
+		}
+	}
+	want := [][]string{{"-Command", "outlet 3 on"}, {"-Command", "outlet 3 off"}, {"-Command", `outlet 3 "cycle"`}}
+	if got := runs(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("argv = %q, want %q", got, want)
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	sh, _ := fakeShell(t)
+	be, err := NewCommand("on", "fail off", WithCommandShell(sh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Adapt(be).Reset(context.Background(), ResetForceOff); err == nil {
+		t.Error("Reset succeeded with a failing command")
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !windows
+
+package backend
+
+var defaultShell = Shell{"sh", "-lc"}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package backend
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDefaultShell(t *testing.T) {
+	if got, want := DefaultShell(), (Shell{"sh", "-lc"}); !slices.Equal(got, want) {
+		t.Errorf("DefaultShell() = %q, want %q", got, want)
+	}
+	if got, want := DefaultShell().Args("echo on"), []string{"sh", "-lc", "echo on"}; !slices.Equal(got, want) {
+		t.Errorf("Args = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultShellRun(t *testing.T) {
+	ctx := context.Background()
+	if err := DefaultShell().Run(ctx, `test "$(echo a b)" = "a b"`); err != nil {
+		t.Errorf("Run of a succeeding line: %v", err)
+	}
+	if err := DefaultShell().Run(ctx, "exit 3"); err == nil {
+		t.Error("Run of a failing line succeeded")
+	}
+}
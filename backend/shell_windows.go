@@ -0,0 +1,7 @@
+//go:build windows
+
+package backend
+
+// PowerShell rather than cmd /C, so that the scripts driving outlets run
+// as they are; -NonInteractive makes a prompt fail instead of hanging.
+var defaultShell = Shell{"powershell", "-NoProfile", "-NonInteractive", "-Command"}
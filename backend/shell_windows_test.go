@@ -0,0 +1,29 @@
+//go:build windows
+
+package backend
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDefaultShell(t *testing.T) {
+	want := Shell{"powershell", "-NoProfile", "-NonInteractive", "-Command"}
+	if got := DefaultShell(); !slices.Equal(got, want) {
+		t.Errorf("DefaultShell() = %q, want %q", got, want)
+	}
+	if got, want := DefaultShell().Args("Write-Output on"), append(slices.Clone(want), "Write-Output on"); !slices.Equal(got, want) {
+		t.Errorf("Args = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultShellRun(t *testing.T) {
+	ctx := context.Background()
+	if err := DefaultShell().Run(ctx, `if ("a b" -ne "a b") { exit 1 }`); err != nil {
+		t.Errorf("Run of a succeeding line: %v", err)
+	}
+	if err := DefaultShell().Run(ctx, "exit 3"); err == nil {
+		t.Error("Run of a failing line succeeded")
+	}
+}
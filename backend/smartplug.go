@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrWrongKey is wrapped by smart plug errors when the device rejects or
+// cannot decrypt a message, i.e. the configured key does not match.
+var ErrWrongKey = errors.New("wrong device key")
+
+// SmartPlugConfig carries the per-device settings of a local smart plug.
+type SmartPlugConfig struct {
+	// DeviceID is the Tuya devId (tuya only).
+	DeviceID string
+	// Key is the Meross device key or the Tuya localKey.
+	Key string
+	// Version is the Tuya protocol version, 3.3 (default) or 3.4.
+	Version string
+	// Channel is the Meross channel (default 0) or the Tuya switch DP
+	// (default 1) of multi-outlet devices.
+	Channel string
+}
+
+// NewSmartPlug returns a backend for a smart plug on the local network.
+// target is adapter:host with adapter meross or tuya.
+func NewSmartPlug(target string, cfg SmartPlugConfig) (Backend, error) {
+	adapter, host, ok := strings.Cut(target, ":")
+	if !ok || host == "" {
+		return nil, fmt.Errorf("smartplug backend requires a target of the form meross:<host> or tuya:<host>, got %q", target)
+	}
+	switch adapter {
+	case "meross":
+		return NewMeross(host, cfg)
+	case "tuya":
+		return NewTuya(host, cfg)
+	default:
+		return nil, fmt.Errorf("smartplug backend: unknown adapter %q (expected meross or tuya)", adapter)
+	}
+}
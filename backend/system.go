@@ -0,0 +1,258 @@
+package backend
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ResetType is a Redfish ResetType, e.g. "On" or "ForceRestart".
+type ResetType string
+
+// The ResetTypes every adapted Backend supports.
+const (
+	ResetOn               ResetType = "On"
+	ResetForceOff         ResetType = "ForceOff"
+	ResetGracefulShutdown ResetType = "GracefulShutdown"
+	ResetForceRestart     ResetType = "ForceRestart"
+	ResetGracefulRestart  ResetType = "GracefulRestart"
+)
+
+// ResetPowerCycle is the ResetType of backends that power-cycle natively.
+const ResetPowerCycle ResetType = "PowerCycle"
+
+// PowerState is a Redfish PowerState: PowerStateOn, PowerStateOff or one of
+// the transitional PowerStatePoweringOn and PowerStatePoweringOff.
+type PowerState string
+
+const (
+	PowerStateOn  PowerState = "On"
+	PowerStateOff PowerState = "Off"
+)
+
+// System is how the server drives a system. Reset owns the semantics of
+// each ResetType, so a backend that e.g. power-cycles natively does so
+// instead of an off/on sequence, and Capabilities tells the server what
+// else the backend can do. The backends with native resets implement it
+// themselves; the others, written against the Backend interface and its
+// optional interfaces, are served through Adapt.
+type System interface {
+	// Reset carries out one of the ResetTypes listed by Capabilities.
+	Reset(ctx context.Context, t ResetType) error
+	// State reports the power state, or ErrNotSupported when
+	// Capabilities().PowerState is false.
+	State(ctx context.Context) (PowerState, error)
+	Capabilities() Capability
+}
+
+// Capability describes what a System supports. The optional features are
+// nil when unsupported.
+type Capability struct {
+	// Resets are the ResetTypes Reset accepts, in the order they are
+	// advertised.
+	Resets []ResetCapability
+	// PowerState is set if State reports the actual power state; the
+	// server otherwise relies on the last state it set.
+	PowerState bool
+
+	Name         NameProvider
+	Health       HealthChecker
+	Oem          OemProvider
+	Boot         BootSetter
+	Indicator    IndicatorProvider
+	PowerMetrics PowerMetricsProvider
+	Thermal      ThermalProvider
+	Reconnect    Reconnector
+	Start        Starter
+	Faults       FaultInjector
+}
+
+// ResetCapability is a ResetType a System accepts.
+type ResetCapability struct {
+	Type ResetType
+	// Calls name the backend calls the reset makes, for dry runs.
+	Calls []string
+	// Hidden ResetTypes are accepted but not advertised, e.g. aliases.
+	Hidden bool
+}
+
+// Reset returns the capability of ResetType t.
+func (c Capability) Reset(t ResetType) (ResetCapability, bool) {
+	i := slices.IndexFunc(c.Resets, func(r ResetCapability) bool { return r.Type == t })
+	if i < 0 {
+		return ResetCapability{}, false
+	}
+	return c.Resets[i], true
+}
+
+// ResetTypes lists the advertised ResetTypes.
+func (c Capability) ResetTypes() []ResetType {
+	var types []ResetType
+	for _, r := range c.Resets {
+		if !r.Hidden {
+			types = append(types, r.Type)
+		}
+	}
+	return types
+}
+
+// restartPause is how long a Backend stays off during a restart made of
+// PowerOff and PowerOn.
+var restartPause = 2 * time.Second
+
+// capabilities returns the capabilities of be: the ResetTypes every
+// Backend supports through PowerOn and PowerOff, replaced or extended by
+// the native ResetTypes be carries out itself, and the optional
+// interfaces be implements. Backends implementing System build their
+// Capabilities with it, so they advertise what Adapt would.
+func capabilities(be Backend, native ...ResetType) Capability {
+	off := "PowerOff"
+	if _, ok := be.(GracefulPowerOffer); ok {
+		off = "GracefulPowerOff"
+	}
+	resets := []ResetCapability{
+		{Type: ResetOn, Calls: []string{"PowerOn"}},
+		{Type: ResetForceOff, Calls: []string{"PowerOff"}},
+		{Type: ResetGracefulShutdown, Calls: []string{off}},
+		{Type: ResetForceRestart, Calls: []string{"PowerOff", "PowerOn"}},
+		{Type: ResetGracefulRestart, Calls: []string{"PowerOff", "PowerOn"}, Hidden: true},
+		{Type: "Off", Calls: []string{"PowerOff"}, Hidden: true},
+	}
+	for _, t := range native {
+		rc := ResetCapability{Type: t, Calls: []string{"Reset(" + string(t) + ")"}}
+		if i := slices.IndexFunc(resets, func(r ResetCapability) bool { return r.Type == t }); i >= 0 {
+			rc.Hidden = resets[i].Hidden
+			resets[i] = rc
+		} else {
+			resets = append(resets, rc)
+		}
+	}
+	c := Capability{Resets: resets}
+	_, c.PowerState = be.(PowerStateProvider)
+	if _, ok := be.(TransitionalStateProvider); ok {
+		c.PowerState = true
+	}
+	c.Name, _ = be.(NameProvider)
+	c.Health, _ = be.(HealthChecker)
+	c.Oem, _ = be.(OemProvider)
+	c.Boot, _ = be.(BootSetter)
+	c.Indicator, _ = be.(IndicatorProvider)
+	c.PowerMetrics, _ = be.(PowerMetricsProvider)
+	c.Thermal, _ = be.(ThermalProvider)
+	c.Reconnect, _ = be.(Reconnector)
+	c.Start, _ = be.(Starter)
+	c.Faults, _ = be.(FaultInjector)
+	return c
+}
+
+// standardReset carries out ResetType t through PowerOn and PowerOff (or
+// GracefulPowerOff): restarts are off, a pause, then on. It fails with
+// ErrNotSupported for other ResetTypes.
+func standardReset(ctx context.Context, be Backend, t ResetType) error {
+	switch t {
+	case ResetOn:
+		return be.PowerOn(ctx)
+	case ResetForceOff, "Off":
+		return be.PowerOff(ctx)
+	case ResetGracefulShutdown:
+		if g, ok := be.(GracefulPowerOffer); ok {
+			return g.GracefulPowerOff(ctx)
+		}
+		return be.PowerOff(ctx)
+	case ResetForceRestart, ResetGracefulRestart:
+	default:
+		return ErrNotSupported
+	}
+	if err := be.PowerOff(ctx); err != nil {
+		return err
+	}
+	timer := time.NewTimer(restartPause)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return be.PowerOn(ctx)
+}
+
+// powerState reports the power state of be through PowerStateDetail or
+// CurrentState, or fails with ErrNotSupported if be implements neither.
+func powerState(ctx context.Context, be Backend) (PowerState, error) {
+	if ts, ok := be.(TransitionalStateProvider); ok {
+		on, transition, err := ts.PowerStateDetail(ctx)
+		if err != nil {
+			return "", err
+		}
+		if transition == "" {
+			return onOff(on), nil
+		}
+		return PowerState(transition), nil
+	}
+	if ps, ok := be.(PowerStateProvider); ok {
+		on, err := ps.CurrentState(ctx)
+		if err != nil {
+			return "", err
+		}
+		return onOff(on), nil
+	}
+	return "", ErrNotSupported
+}
+
+// sortedResetTypes returns the ResetTypes of a map of ResetTypes to how a
+// backend carries them out, sorted.
+func sortedResetTypes(m map[string]string) []ResetType {
+	var types []ResetType
+	for _, t := range slices.Sorted(maps.Keys(m)) {
+		types = append(types, ResetType(t))
+	}
+	return types
+}
+
+func onOff(on bool) PowerState {
+	if on {
+		return PowerStateOn
+	}
+	return PowerStateOff
+}
+
+// adapter serves a Backend as a System: On and the off ResetTypes call
+// PowerOn and PowerOff (or GracefulPowerOff), restarts call both, and
+// ResetTypes the backend implements natively go to its Reset.
+type adapter struct {
+	be   Backend
+	caps Capability
+}
+
+// Adapt returns a System driving be. The optional interfaces be implements
+// become its capabilities. A Backend that already is a System is returned
+// as it is.
+func Adapt(be Backend) System {
+	if s, ok := be.(System); ok {
+		return s
+	}
+	var native []ResetType
+	if rc, ok := be.(ResetCapabilities); ok {
+		for _, t := range rc.NativeResetTypes() {
+			native = append(native, ResetType(t))
+		}
+	}
+	return &adapter{be: be, caps: capabilities(be, native...)}
+}
+
+func (a *adapter) Capabilities() Capability { return a.caps }
+
+func (a *adapter) Reset(ctx context.Context, t ResetType) error {
+	if _, ok := a.caps.Reset(t); !ok {
+		return ErrNotSupported
+	}
+	if native, ok := a.be.(ResetCapabilities); ok && slices.Contains(native.NativeResetTypes(), string(t)) {
+		return native.Reset(ctx, string(t))
+	}
+	return standardReset(ctx, a.be, t)
+}
+
+func (a *adapter) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, a.be)
+}
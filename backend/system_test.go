@@ -0,0 +1,262 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recorder is a Backend recording the calls made to it.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) PowerOn(ctx context.Context) error {
+	r.calls = append(r.calls, "PowerOn")
+	return nil
+}
+
+func (r *recorder) PowerOff(ctx context.Context) error {
+	r.calls = append(r.calls, "PowerOff")
+	return nil
+}
+
+// graceful adds GracefulPowerOff.
+type graceful struct{ recorder }
+
+func (g *graceful) GracefulPowerOff(ctx context.Context) error {
+	g.calls = append(g.calls, "GracefulPowerOff")
+	return nil
+}
+
+// native adds a native ForceRestart and PowerCycle.
+type native struct{ graceful }
+
+func (n *native) NativeResetTypes() []string { return []string{"ForceRestart", "PowerCycle"} }
+
+func (n *native) Reset(ctx context.Context, resetType string) error {
+	n.calls = append(n.calls, "Reset("+resetType+")")
+	return nil
+}
+
+// transitional reports a fixed power state.
+type transitional struct {
+	recorder
+	on         bool
+	transition string
+}
+
+func (t *transitional) PowerStateDetail(ctx context.Context) (bool, string, error) {
+	return t.on, t.transition, nil
+}
+
+func (t *transitional) Ping(ctx context.Context) error { return nil }
+
+func (t *transitional) DisplayName(ctx context.Context) (string, error) { return "node", nil }
+
+func TestAdaptReset(t *testing.T) {
+	defer func(d time.Duration) { restartPause = d }(restartPause)
+	restartPause = time.Millisecond
+
+	tests := []struct {
+		name  string
+		be    func() (Backend, *[]string)
+		reset ResetType
+		calls []string
+		err   error
+	}{
+		{"on", plain, ResetOn, []string{"PowerOn"}, nil},
+		{"force off", plain, ResetForceOff, []string{"PowerOff"}, nil},
+		{"off alias", plain, "Off", []string{"PowerOff"}, nil},
+		{"graceful shutdown without GracefulPowerOff", plain, ResetGracefulShutdown, []string{"PowerOff"}, nil},
+		{"graceful shutdown", withGraceful, ResetGracefulShutdown, []string{"GracefulPowerOff"}, nil},
+		{"force restart", plain, ResetForceRestart, []string{"PowerOff", "PowerOn"}, nil},
+		{"graceful restart", withGraceful, ResetGracefulRestart, []string{"PowerOff", "PowerOn"}, nil},
+		{"power cycle unsupported", plain, ResetPowerCycle, nil, ErrNotSupported},
+		{"unknown", plain, "Nmi", nil, ErrNotSupported},
+		{"native force restart", withNative, ResetForceRestart, []string{"Reset(ForceRestart)"}, nil},
+		{"native power cycle", withNative, ResetPowerCycle, []string{"Reset(PowerCycle)"}, nil},
+		{"standard reset beside native ones", withNative, ResetGracefulRestart, []string{"PowerOff", "PowerOn"}, nil},
+		{"graceful shutdown beside native ones", withNative, ResetGracefulShutdown, []string{"GracefulPowerOff"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			be, calls := tt.be()
+			sys := Adapt(be)
+			err := sys.Reset(context.Background(), tt.reset)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Reset(%s) = %v, want %v", tt.reset, err, tt.err)
+			}
+			if !slices.Equal(*calls, tt.calls) {
+				t.Errorf("Reset(%s) called %v, want %v", tt.reset, *calls, tt.calls)
+			}
+			if rc, ok := sys.Capabilities().Reset(tt.reset); ok && !slices.Equal(rc.Calls, tt.calls) {
+				t.Errorf("capability of %s names calls %v, made %v", tt.reset, rc.Calls, tt.calls)
+			}
+		})
+	}
+}
+
+func plain() (Backend, *[]string) {
+	r := &recorder{}
+	return r, &r.calls
+}
+
+func withGraceful() (Backend, *[]string) {
+	g := &graceful{}
+	return g, &g.calls
+}
+
+func withNative() (Backend, *[]string) {
+	n := &native{}
+	return n, &n.calls
+}
+
+func TestAdaptRestartCanceled(t *testing.T) {
+	r := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Adapt(r).Reset(ctx, ResetForceRestart); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Reset = %v, want context.Canceled", err)
+	}
+	if want := []string{"PowerOff"}; !slices.Equal(r.calls, want) {
+		t.Errorf("calls = %v, want %v", r.calls, want)
+	}
+}
+
+func TestAdaptCapabilities(t *testing.T) {
+	tests := []struct {
+		name       string
+		be         Backend
+		resetTypes []ResetType
+		powerState bool
+		health     bool
+		named      bool
+	}{
+		{
+			name:       "plain",
+			be:         &recorder{},
+			resetTypes: []ResetType{ResetOn, ResetForceOff, ResetGracefulShutdown, ResetForceRestart},
+		},
+		{
+			name:       "native",
+			be:         &native{},
+			resetTypes: []ResetType{ResetOn, ResetForceOff, ResetGracefulShutdown, ResetForceRestart, ResetPowerCycle},
+		},
+		{
+			name:       "providers",
+			be:         &transitional{},
+			resetTypes: []ResetType{ResetOn, ResetForceOff, ResetGracefulShutdown, ResetForceRestart},
+			powerState: true,
+			health:     true,
+			named:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Adapt(tt.be).Capabilities()
+			if got := c.ResetTypes(); !slices.Equal(got, tt.resetTypes) {
+				t.Errorf("ResetTypes() = %v, want %v", got, tt.resetTypes)
+			}
+			for _, hidden := range []ResetType{ResetGracefulRestart, "Off"} {
+				if rc, ok := c.Reset(hidden); !ok || !rc.Hidden {
+					t.Errorf("Reset(%s) = %+v, %v, want a hidden capability", hidden, rc, ok)
+				}
+			}
+			if c.PowerState != tt.powerState {
+				t.Errorf("PowerState = %v, want %v", c.PowerState, tt.powerState)
+			}
+			if (c.Health != nil) != tt.health {
+				t.Errorf("Health = %v, want set %v", c.Health, tt.health)
+			}
+			if (c.Name != nil) != tt.named {
+				t.Errorf("Name = %v, want set %v", c.Name, tt.named)
+			}
+			for name, p := range map[string]any{"Oem": c.Oem, "Boot": c.Boot, "Indicator": c.Indicator, "PowerMetrics": c.PowerMetrics, "Thermal": c.Thermal, "Reconnect": c.Reconnect, "Start": c.Start, "Faults": c.Faults} {
+				if p != nil {
+					t.Errorf("%s = %v, want nil", name, p)
+				}
+			}
+		})
+	}
+}
+
+func TestAdaptState(t *testing.T) {
+	tests := []struct {
+		on         bool
+		transition string
+		want       PowerState
+	}{
+		{true, "", PowerStateOn},
+		{false, "", PowerStateOff},
+		{true, PowerStatePoweringOn, PowerStatePoweringOn},
+		{false, PowerStatePoweringOff, PowerStatePoweringOff},
+	}
+	for _, tt := range tests {
+		got, err := Adapt(&transitional{on: tt.on, transition: tt.transition}).State(context.Background())
+		if err != nil || got != tt.want {
+			t.Errorf("State() with on %v, transition %q = %q, %v, want %q", tt.on, tt.transition, got, err, tt.want)
+		}
+	}
+	if _, err := Adapt(&recorder{}).State(context.Background()); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("State() without a PowerStateProvider = %v, want ErrNotSupported", err)
+	}
+}
+
+// TestNativeSystems checks that backends with native resets are Systems
+// advertising them beside the standard resets.
+func TestNativeSystems(t *testing.T) {
+	cmd, err := NewCommand("on", "off", WithCommandResets(map[string]string{"PowerCycle": "cycle", "ForceRestart": "reset"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		be         Backend
+		powerState bool
+		want       map[ResetType][]string
+	}{
+		{"command", cmd, false, map[ResetType][]string{
+			ResetOn:           {"PowerOn"},
+			ResetForceRestart: {"Reset(ForceRestart)"},
+			ResetPowerCycle:   {"Reset(PowerCycle)"},
+		}},
+		{"hcloud", &HCloud{}, true, map[ResetType][]string{
+			ResetGracefulShutdown: {"GracefulPowerOff"},
+			ResetForceRestart:     {"Reset(ForceRestart)"},
+			ResetGracefulRestart:  {"Reset(GracefulRestart)"},
+		}},
+		{"ipmi", &IPMI{}, true, map[ResetType][]string{
+			ResetForceOff:     {"PowerOff"},
+			ResetForceRestart: {"Reset(ForceRestart)"},
+			ResetPowerCycle:   {"Reset(PowerCycle)"},
+		}},
+		{"tasmota without a cycle delay", &Tasmota{}, true, map[ResetType][]string{
+			ResetForceRestart: {"PowerOff", "PowerOn"},
+			ResetPowerCycle:   nil,
+		}},
+		{"tasmota", &Tasmota{cycle: time.Second}, true, map[ResetType][]string{
+			ResetPowerCycle: {"Reset(PowerCycle)"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := Adapt(tt.be)
+			if _, ok := sys.(*adapter); ok {
+				t.Fatalf("Adapt(%T) returned an adapter, want the backend itself", tt.be)
+			}
+			c := sys.Capabilities()
+			if c.PowerState != tt.powerState {
+				t.Errorf("PowerState = %v, want %v", c.PowerState, tt.powerState)
+			}
+			for rt, calls := range tt.want {
+				rc, ok := c.Reset(rt)
+				if ok != (calls != nil) || !slices.Equal(rc.Calls, calls) {
+					t.Errorf("Reset(%s) = %v, %v, want calls %v", rt, rc.Calls, ok, calls)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tasmota controls a relay of a Tasmota device through its /cm HTTP
+// command endpoint.
+type Tasmota struct {
+	base   string
+	user   string
+	pass   string
+	index  int
+	cycle  time.Duration
+	client *http.Client
+}
+
+// TasmotaOption configures optional Tasmota backend features.
+type TasmotaOption func(*Tasmota)
+
+// WithTasmotaAuth sets the web admin credentials (WebPassword). It is a
+// no-op without a password; credentials in the device URL take precedence.
+func WithTasmotaAuth(user, pass string) TasmotaOption {
+	return func(t *Tasmota) {
+		if pass != "" && t.user == "" && t.pass == "" {
+			t.user, t.pass = user, pass
+		}
+	}
+}
+
+// WithTasmotaCycle makes PowerCycle a native reset run by the device
+// itself: off, wait d, on.
+func WithTasmotaCycle(d time.Duration) TasmotaOption {
+	return func(t *Tasmota) { t.cycle = d }
+}
+
+// NewTasmota returns a backend for target, given as url[:index] where url
+// is the device's address (http:// is assumed if no scheme is given) and
+// index selects the relay of a multi-relay device. A trailing :N from 1 to
+// 32 is an index rather than a port.
+func NewTasmota(target string, opts ...TasmotaOption) (*Tasmota, error) {
+	rawURL, index := target, 0
+	if i := strings.LastIndex(target, ":"); i >= 0 {
+		if n, err := strconv.Atoi(target[i+1:]); err == nil && n >= 1 && n <= 32 {
+			rawURL, index = target[:i], n
+		}
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("tasmota backend requires a device URL, got %q", target)
+	}
+	t := &Tasmota{index: index, client: &http.Client{Timeout: 10 * time.Second}}
+	if u.User != nil {
+		t.user = u.User.Username()
+		t.pass, _ = u.User.Password()
+		u.User = nil
+	}
+	t.base = strings.TrimRight(u.String(), "/")
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t, nil
+}
+
+// power is the Power command of the configured relay.
+func (t *Tasmota) power() string {
+	if t.index == 0 {
+		return "Power"
+	}
+	return "Power" + strconv.Itoa(t.index)
+}
+
+// cmd runs a Tasmota command and decodes the JSON response into out.
+func (t *Tasmota) cmd(ctx context.Context, command string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.base+"/cm?cmnd="+url.QueryEscape(command), nil)
+	if err != nil {
+		return err
+	}
+	if t.user != "" || t.pass != "" {
+		req.SetBasicAuth(t.user, t.pass)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("tasmota %s: unauthorized, check the web password", t.base)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tasmota %s: %s: http %d", t.base, command, resp.StatusCode)
+	}
+	// Without credentials, Tasmota answers {"WARNING":"Need user=<username>&password=<password>"}.
+	var warn struct {
+		Warning string `json:"WARNING"`
+		Command string `json:"Command"`
+	}
+	if json.Unmarshal(b, &warn) == nil {
+		if warn.Warning != "" {
+			return fmt.Errorf("tasmota %s: %s", t.base, warn.Warning)
+		}
+		if warn.Command == "Unknown" {
+			return fmt.Errorf("tasmota %s: unknown command %q", t.base, command)
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("tasmota %s: %s: %w", t.base, command, err)
+	}
+	return nil
+}
+
+// setPower runs the relay's Power command with arg ("" queries the state)
+// and returns the resulting state.
+func (t *Tasmota) setPower(ctx context.Context, arg string) (bool, error) {
+	command := t.power()
+	if arg != "" {
+		command += " " + arg
+	}
+	var resp map[string]any
+	if err := t.cmd(ctx, command, &resp); err != nil {
+		return false, err
+	}
+	// Single-relay devices answer POWER even to Power1.
+	v, ok := resp[strings.ToUpper(t.power())]
+	if !ok {
+		v, ok = resp["POWER"]
+	}
+	if !ok && t.index == 1 {
+		v, ok = resp["POWER1"]
+	}
+	s, _ := v.(string)
+	switch {
+	case !ok:
+		return false, fmt.Errorf("tasmota %s: no %s in response", t.base, strings.ToUpper(t.power()))
+	case s == "ON":
+		return true, nil
+	case s == "OFF":
+		return false, nil
+	default:
+		return false, fmt.Errorf("tasmota %s: unknown power state %q", t.base, s)
+	}
+}
+
+func (t *Tasmota) PowerOn(ctx context.Context) error {
+	_, err := t.setPower(ctx, "On")
+	return err
+}
+
+func (t *Tasmota) PowerOff(ctx context.Context) error {
+	_, err := t.setPower(ctx, "Off")
+	return err
+}
+
+func (t *Tasmota) CurrentState(ctx context.Context) (bool, error) {
+	return t.setPower(ctx, "")
+}
+
+// Capabilities advertises PowerCycle when a cycle delay is configured.
+func (t *Tasmota) Capabilities() Capability {
+	if t.cycle <= 0 {
+		return capabilities(t)
+	}
+	return capabilities(t, ResetPowerCycle)
+}
+
+// Reset runs PowerCycle as a Backlog on the device, so the relay comes
+// back on even if the shim goes away mid-cycle. Delay counts in tenths of
+// a second.
+func (t *Tasmota) Reset(ctx context.Context, rt ResetType) error {
+	if rt != ResetPowerCycle || t.cycle <= 0 {
+		return standardReset(ctx, t, rt)
+	}
+	tenths := int(t.cycle / (100 * time.Millisecond))
+	p := t.power()
+	return t.cmd(ctx, fmt.Sprintf("Backlog %s Off; Delay %d; %s On", p, tenths, p), nil)
+}
+
+// DisplayName returns the FriendlyName of the relay.
+func (t *Tasmota) DisplayName(ctx context.Context) (string, error) {
+	var resp struct {
+		Status struct {
+			DeviceName   string   `json:"DeviceName"`
+			FriendlyName []string `json:"FriendlyName"`
+		} `json:"Status"`
+	}
+	if err := t.cmd(ctx, "Status", &resp); err != nil {
+		return "", err
+	}
+	names := resp.Status.FriendlyName
+	switch {
+	case t.index > 0 && t.index <= len(names):
+		return names[t.index-1], nil
+	case len(names) > 0:
+		return names[0], nil
+	case resp.Status.DeviceName != "":
+		return resp.Status.DeviceName, nil
+	}
+	return "", errors.New("tasmota: no FriendlyName in status")
+}
+
+func (t *Tasmota) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, t)
+}
+
+func (t *Tasmota) Ping(ctx context.Context) error {
+	_, err := t.CurrentState(ctx)
+	return err
+}
@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+)
+
+// DefaultWakeOnLANAddr is where Wake-on-LAN packets are sent by default:
+// the limited broadcast address, discard port.
+const DefaultWakeOnLANAddr = "255.255.255.255:9"
+
+// WakeOnLAN sends a magic packet for mac to addr, a UDP host:port,
+// normally a broadcast address of the host's network.
+func WakeOnLAN(ctx context.Context, mac net.HardwareAddr, addr string) error {
+	if len(mac) != 6 {
+		return fmt.Errorf("wake-on-lan: invalid MAC address %s", mac)
+	}
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	for range 16 {
+		packet = append(packet, mac...)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", addr)
+	if err != nil {
+		return fmt.Errorf("wake-on-lan: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("wake-on-lan: %w", err)
+	}
+	return nil
+}
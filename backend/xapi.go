@@ -0,0 +1,282 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// XAPIClient is a JSON-RPC client for the XenServer/XCP-ng management API
+// of a pool. It holds one session, shared by all VMs of the pool, and logs
+// in again when the session expires.
+type XAPIClient struct {
+	url    string
+	user   string
+	pass   string
+	client *http.Client
+	seq    atomic.Int64
+
+	mu      sync.Mutex
+	session string
+}
+
+// NewXAPIClient returns a client for the pool master at baseURL, e.g.
+// https://xcp-master.lan. insecure skips TLS certificate verification for
+// the self-signed certificates pool masters ship with.
+func NewXAPIClient(baseURL, user, pass string, insecure bool) (*XAPIClient, error) {
+	if baseURL == "" || user == "" || pass == "" {
+		return nil, errors.New("xapi backend requires the pool master URL, user and password")
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &XAPIClient{
+		url:    strings.TrimRight(baseURL, "/") + "/jsonrpc",
+		user:   user,
+		pass:   pass,
+		client: &http.Client{Timeout: 60 * time.Second, Transport: tr},
+	}, nil
+}
+
+// XAPIError is an error returned by XAPI, e.g. VM_BAD_POWER_STATE.
+type XAPIError struct {
+	Code string
+	Args []string
+}
+
+func (e *XAPIError) Error() string {
+	if len(e.Args) == 0 {
+		return "xapi: " + e.Code
+	}
+	return "xapi: " + e.Code + " " + strings.Join(e.Args, " ")
+}
+
+// call invokes a method with the session prepended to params, logging in
+// first if needed and once more if the session has expired.
+func (c *XAPIClient) call(ctx context.Context, method string, out any, params ...any) error {
+	for attempt := 0; ; attempt++ {
+		session, err := c.login(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.rpc(ctx, method, out, append([]any{session}, params...)...)
+		var xe *XAPIError
+		if attempt == 0 && errors.As(err, &xe) && xe.Code == "SESSION_INVALID" {
+			c.mu.Lock()
+			if c.session == session {
+				c.session = ""
+			}
+			c.mu.Unlock()
+			continue
+		}
+		return err
+	}
+}
+
+func (c *XAPIClient) login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session != "" {
+		return c.session, nil
+	}
+	var session string
+	err := c.rpc(ctx, "session.login_with_password", &session, c.user, c.pass, "1.0", "bmc-shim")
+	var xe *XAPIError
+	if errors.As(err, &xe) && xe.Code == "HOST_IS_SLAVE" && len(xe.Args) > 0 {
+		// Only the pool master accepts logins; follow it.
+		if u, perr := url.Parse(c.url); perr == nil {
+			if _, port, serr := net.SplitHostPort(u.Host); serr == nil {
+				u.Host = net.JoinHostPort(xe.Args[0], port)
+			} else {
+				u.Host = xe.Args[0]
+			}
+			c.url = u.String()
+			err = c.rpc(ctx, "session.login_with_password", &session, c.user, c.pass, "1.0", "bmc-shim")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("xapi login: %w", err)
+	}
+	c.session = session
+	return session, nil
+}
+
+func (c *XAPIClient) rpc(ctx context.Context, method string, out any, params ...any) error {
+	b, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      c.seq.Add(1),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("xapi %s: http %d", method, resp.StatusCode)
+	}
+	var body struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string   `json:"message"`
+			Data    []string `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("xapi %s: %w", method, err)
+	}
+	if body.Error != nil {
+		return &XAPIError{Code: body.Error.Message, Args: body.Error.Data}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Result, out)
+}
+
+// XAPI controls one VM of a XenServer/XCP-ng pool.
+type XAPI struct {
+	c    *XAPIClient
+	uuid string
+
+	mu  sync.Mutex
+	ref string
+}
+
+// NewXAPI returns a backend for the VM with the given UUID.
+func NewXAPI(c *XAPIClient, vmUUID string) (*XAPI, error) {
+	if vmUUID == "" {
+		return nil, errors.New("xapi backend requires a VM UUID")
+	}
+	return &XAPI{c: c, uuid: vmUUID}, nil
+}
+
+// Start logs in to the pool master and looks the VM up.
+func (x *XAPI) Start(ctx context.Context) error {
+	_, err := x.vm(ctx)
+	return err
+}
+
+// vm returns the VM's opaque reference, looking it up once.
+func (x *XAPI) vm(ctx context.Context) (string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.ref != "" {
+		return x.ref, nil
+	}
+	if err := x.c.call(ctx, "VM.get_by_uuid", &x.ref, x.uuid); err != nil {
+		return "", err
+	}
+	return x.ref, nil
+}
+
+func (x *XAPI) do(ctx context.Context, method string, out any) error {
+	ref, err := x.vm(ctx)
+	if err != nil {
+		return err
+	}
+	return x.c.call(ctx, method, out, ref)
+}
+
+func (x *XAPI) powerState(ctx context.Context) (string, error) {
+	var state string
+	err := x.do(ctx, "VM.get_power_state", &state)
+	return state, err
+}
+
+// PowerOn starts a halted VM, and resumes a suspended or unpauses a
+// paused one.
+func (x *XAPI) PowerOn(ctx context.Context) error {
+	state, err := x.powerState(ctx)
+	if err != nil {
+		return err
+	}
+	ref, err := x.vm(ctx)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case "Running":
+		return nil
+	case "Paused":
+		return x.c.call(ctx, "VM.unpause", nil, ref)
+	case "Suspended":
+		return x.c.call(ctx, "VM.resume", nil, ref, false, false)
+	default:
+		return x.c.call(ctx, "VM.start", nil, ref, false, false)
+	}
+}
+
+func (x *XAPI) PowerOff(ctx context.Context) error {
+	return x.do(ctx, "VM.hard_shutdown", nil)
+}
+
+func (x *XAPI) GracefulPowerOff(ctx context.Context) error {
+	return x.do(ctx, "VM.clean_shutdown", nil)
+}
+
+func (x *XAPI) Capabilities() Capability {
+	return capabilities(x, ResetForceRestart, ResetGracefulRestart)
+}
+
+func (x *XAPI) Reset(ctx context.Context, t ResetType) error {
+	switch t {
+	case ResetForceRestart:
+		return x.do(ctx, "VM.hard_reboot", nil)
+	case ResetGracefulRestart:
+		return x.do(ctx, "VM.clean_reboot", nil)
+	}
+	return standardReset(ctx, x, t)
+}
+
+func (x *XAPI) State(ctx context.Context) (PowerState, error) {
+	return powerState(ctx, x)
+}
+
+// CurrentState reports Running and Paused VMs as on, Halted and Suspended
+// ones as off.
+func (x *XAPI) CurrentState(ctx context.Context) (bool, error) {
+	state, err := x.powerState(ctx)
+	if err != nil {
+		return false, err
+	}
+	switch state {
+	case "Running", "Paused":
+		return true, nil
+	case "Halted", "Suspended":
+		return false, nil
+	default:
+		return false, fmt.Errorf("xapi vm %s: unknown power state %q", x.uuid, state)
+	}
+}
+
+func (x *XAPI) DisplayName(ctx context.Context) (string, error) {
+	var name string
+	err := x.do(ctx, "VM.get_name_label", &name)
+	return name, err
+}
+
+func (x *XAPI) Ping(ctx context.Context) error {
+	_, err := x.powerState(ctx)
+	return err
+}
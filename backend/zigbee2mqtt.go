@@ -0,0 +1,306 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Zigbee2MQTTBaseTopic is Zigbee2MQTT's default base topic.
+const Zigbee2MQTTBaseTopic = "zigbee2mqtt"
+
+// z2mStateWait bounds how long a state read waits for Zigbee2MQTT to
+// answer a /get, and a power action for the device to report the new
+// state.
+const z2mStateWait = 5 * time.Second
+
+// Zigbee2MQTT switches a Zigbee device through Zigbee2MQTT: it publishes
+// {"state":"ON"} to <base>/<friendly name>/set and reads the state from
+// the JSON Zigbee2MQTT publishes to <base>/<friendly name>. A device that
+// Zigbee2MQTT reports unavailable, or a bridge that is offline, makes the
+// state unknown rather than off.
+type Zigbee2MQTT struct {
+	c    *MQTTClient
+	base string
+	name string
+}
+
+// z2mDevice is an entry of <base>/bridge/devices.
+type z2mDevice struct {
+	FriendlyName string `json:"friendly_name"`
+	IEEEAddress  string `json:"ieee_address"`
+	Description  string `json:"description"`
+	Definition   *struct {
+		Vendor      string `json:"vendor"`
+		Model       string `json:"model"`
+		Description string `json:"description"`
+	} `json:"definition"`
+}
+
+// NewZigbee2MQTT returns a backend for the device with the given friendly
+// name on the Zigbee2MQTT instance publishing under base (default
+// "zigbee2mqtt").
+func NewZigbee2MQTT(c *MQTTClient, base, friendlyName string) (*Zigbee2MQTT, error) {
+	if friendlyName == "" {
+		return nil, errors.New("zigbee2mqtt backend requires a device friendly name")
+	}
+	if base == "" {
+		base = Zigbee2MQTTBaseTopic
+	}
+	base = strings.TrimRight(base, "/")
+	if strings.ContainsAny(base+friendlyName, "#+") {
+		return nil, fmt.Errorf("zigbee2mqtt: topic wildcards in %q", base+"/"+friendlyName)
+	}
+	c.Subscribe(base + "/#")
+	return &Zigbee2MQTT{c: c, base: base, name: friendlyName}, nil
+}
+
+func (z *Zigbee2MQTT) topic(suffix string) string {
+	if suffix == "" {
+		return z.base + "/" + z.name
+	}
+	return z.base + "/" + z.name + "/" + suffix
+}
+
+// z2mOnline parses an availability or bridge state payload, either
+// {"state":"online"} or the legacy plain "online". ok is false for an
+// unrecognized payload.
+func z2mOnline(payload []byte) (online, ok bool) {
+	state := strings.TrimSpace(string(payload))
+	var v struct {
+		State string `json:"state"`
+	}
+	if json.Unmarshal(payload, &v) == nil && v.State != "" {
+		state = v.State
+	}
+	switch strings.ToLower(state) {
+	case "online":
+		return true, true
+	case "offline":
+		return false, true
+	}
+	return false, false
+}
+
+// available fails, wrapping ErrStateUnknown, if the bridge is offline or
+// the device unavailable. Without availability messages, e.g. with the
+// feature disabled in Zigbee2MQTT, the device counts as available.
+func (z *Zigbee2MQTT) available() error {
+	if m, ok := z.c.Last(z.base + "/bridge/state"); ok {
+		if online, ok := z2mOnline(m.Payload); ok && !online {
+			return fmt.Errorf("zigbee2mqtt bridge %s is offline: %w", z.base, ErrStateUnknown)
+		}
+	}
+	if m, ok := z.c.Last(z.topic("availability")); ok {
+		if online, ok := z2mOnline(m.Payload); ok && !online {
+			return fmt.Errorf("zigbee2mqtt %s is offline: %w", z.name, ErrStateUnknown)
+		}
+	}
+	return nil
+}
+
+// state parses the last state message received after since.
+func (z *Zigbee2MQTT) state(since time.Time) (on, ok bool, err error) {
+	m, found := z.c.Last(z.topic(""))
+	if !found || m.Received.Before(since) {
+		return false, false, nil
+	}
+	var v struct {
+		State *string `json:"state"`
+	}
+	if err := json.Unmarshal(m.Payload, &v); err != nil {
+		return false, false, fmt.Errorf("zigbee2mqtt %s: malformed state %q", z.name, m.Payload)
+	}
+	if v.State == nil {
+		// E.g. a sensor update without the switch state.
+		return false, false, nil
+	}
+	switch strings.ToUpper(*v.State) {
+	case "ON":
+		return true, true, nil
+	case "OFF":
+		return false, true, nil
+	}
+	return false, false, fmt.Errorf("zigbee2mqtt %s: unknown state %q", z.name, *v.State)
+}
+
+func (z *Zigbee2MQTT) PowerOn(ctx context.Context) error {
+	return z.set(ctx, true)
+}
+
+func (z *Zigbee2MQTT) PowerOff(ctx context.Context) error {
+	return z.set(ctx, false)
+}
+
+// set switches the device and waits for it to report the new state.
+func (z *Zigbee2MQTT) set(ctx context.Context, on bool) error {
+	if err := z.c.Connect(ctx); err != nil {
+		return err
+	}
+	if err := z.available(); err != nil {
+		return err
+	}
+	payload := `{"state":"OFF"}`
+	if on {
+		payload = `{"state":"ON"}`
+	}
+	sent := time.Now()
+	if err := z.c.Publish(ctx, z.topic("set"), []byte(payload)); err != nil {
+		return err
+	}
+	wctx, cancel := context.WithTimeout(ctx, z2mStateWait)
+	defer cancel()
+	var serr error
+	err := z.c.Await(wctx, func() bool {
+		if serr = z.available(); serr != nil {
+			return true
+		}
+		v, ok, err := z.state(sent)
+		serr = err
+		return err != nil || (ok && v == on)
+	})
+	switch {
+	case serr != nil:
+		return serr
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		return fmt.Errorf("zigbee2mqtt %s: did not report %s within %s", z.name, onOff(on), z2mStateWait)
+	}
+	return err
+}
+
+// CurrentState reports the last state Zigbee2MQTT published, asking for
+// it with a /get if none was received on the current connection, e.g.
+// because Zigbee2MQTT does not retain states.
+func (z *Zigbee2MQTT) CurrentState(ctx context.Context) (bool, error) {
+	if err := z.c.Connect(ctx); err != nil {
+		return false, err
+	}
+	if err := z.available(); err != nil {
+		return false, err
+	}
+	if on, ok, err := z.state(time.Time{}); ok || err != nil {
+		return on, err
+	}
+	if err := z.c.Publish(ctx, z.topic("get"), []byte(`{"state":""}`)); err != nil {
+		return false, err
+	}
+	wctx, cancel := context.WithTimeout(ctx, z2mStateWait)
+	defer cancel()
+	var on bool
+	var serr error
+	err := z.c.Await(wctx, func() bool {
+		if serr = z.available(); serr != nil {
+			return true
+		}
+		var ok bool
+		on, ok, serr = z.state(time.Time{})
+		return ok || serr != nil
+	})
+	switch {
+	case serr != nil:
+		return false, serr
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		return false, fmt.Errorf("zigbee2mqtt %s: no state reported within %s", z.name, z2mStateWait)
+	}
+	return on, err
+}
+
+// device returns the device's entry in the retained <base>/bridge/devices
+// list, waiting briefly for it after connecting.
+func (z *Zigbee2MQTT) device(ctx context.Context) (z2mDevice, error) {
+	if err := z.c.Connect(ctx); err != nil {
+		return z2mDevice{}, err
+	}
+	topic := z.base + "/bridge/devices"
+	wctx, cancel := context.WithTimeout(ctx, z2mStateWait)
+	defer cancel()
+	err := z.c.Await(wctx, func() bool {
+		_, ok := z.c.Last(topic)
+		return ok
+	})
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return z2mDevice{}, fmt.Errorf("zigbee2mqtt: no device list on %s", topic)
+	}
+	if err != nil {
+		return z2mDevice{}, err
+	}
+	m, _ := z.c.Last(topic)
+	var devices []z2mDevice
+	if err := json.Unmarshal(m.Payload, &devices); err != nil {
+		return z2mDevice{}, fmt.Errorf("zigbee2mqtt: malformed device list on %s: %w", topic, err)
+	}
+	for _, d := range devices {
+		if d.FriendlyName == z.name {
+			return d, nil
+		}
+	}
+	return z2mDevice{}, fmt.Errorf("zigbee2mqtt: no device %q on %s", z.name, z.base)
+}
+
+// DisplayName returns the device's description set in Zigbee2MQTT, or
+// the vendor and description of its device definition, e.g. "IKEA
+// TRADFRI control outlet".
+func (z *Zigbee2MQTT) DisplayName(ctx context.Context) (string, error) {
+	d, err := z.device(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case d.Description != "":
+		return d.Description, nil
+	case d.Definition != nil && d.Definition.Description != "":
+		return strings.TrimSpace(d.Definition.Vendor + " " + d.Definition.Description), nil
+	}
+	return z.name, nil
+}
+
+// Oem reports the device's topic, address, model and availability.
+func (z *Zigbee2MQTT) Oem(ctx context.Context) (map[string]any, error) {
+	oem := map[string]any{
+		"Broker":       z.c.Addr(),
+		"Topic":        z.topic(""),
+		"FriendlyName": z.name,
+	}
+	if d, err := z.device(ctx); err == nil {
+		oem["IEEEAddress"] = d.IEEEAddress
+		if d.Definition != nil {
+			oem["Vendor"] = d.Definition.Vendor
+			oem["Model"] = d.Definition.Model
+		}
+	}
+	oem["Availability"] = "online"
+	if err := z.available(); err != nil {
+		oem["Availability"] = "offline"
+	}
+	if m, ok := z.c.Last(z.topic("")); ok {
+		var v struct {
+			LinkQuality *int `json:"linkquality"`
+		}
+		if json.Unmarshal(m.Payload, &v) == nil && v.LinkQuality != nil {
+			oem["LinkQuality"] = *v.LinkQuality
+		}
+	}
+	return oem, nil
+}
+
+// Ping checks the broker connection, that the bridge is online and that
+// it knows the device.
+func (z *Zigbee2MQTT) Ping(ctx context.Context) error {
+	if _, err := z.device(ctx); err != nil {
+		return err
+	}
+	return z.available()
+}
+
+// Start connects to the broker and checks the bridge knows the device.
+func (z *Zigbee2MQTT) Start(ctx context.Context) error {
+	_, err := z.device(ctx)
+	return err
+}
+
+func (z *Zigbee2MQTT) Reconnect(ctx context.Context) error {
+	return z.c.Reconnect(ctx)
+}
@@ -0,0 +1,229 @@
+// Package backendmw wraps the calls the server makes to a backend.System
+// with cross-cutting behaviour: retries, a circuit breaker, timeouts,
+// metrics and logging, or any other Option, so backends need not
+// implement them.
+//
+// Options apply in the order they are given, the first one outermost: it
+// sees a call first and its outcome last, and every later Option runs
+// inside it. The shim wraps every system with
+//
+//	Wrap(sys, Logging(logf), Metrics(observe), Breaker(n, cooldown), Retry(n, backoff), Timeout(d))
+//
+// so that a call is logged and counted once whatever the retries, the
+// breaker counts a failure only once the retries are exhausted and, when
+// open, fails calls without retrying them, and the timeout bounds each
+// attempt. Given before Retry, Timeout would bound all attempts together;
+// given before Breaker, Retry would retry calls the open breaker refused.
+package backendmw
+
+import (
+	"context"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// Call describes a backend call passed through the Options.
+type Call struct {
+	// Method is the method called, e.g. "Reset", "State" or
+	// "DisplayName".
+	Method string
+	// ResetType is the ResetType of a Reset.
+	ResetType backend.ResetType
+	// ReadOnly calls only read from the backend, so they may be retried.
+	ReadOnly bool
+}
+
+// String returns the method with its ResetType, e.g. "Reset(On)", as
+// backend.ResetCapability names the calls of a reset.
+func (c Call) String() string {
+	if c.ResetType != "" {
+		return c.Method + "(" + string(c.ResetType) + ")"
+	}
+	return c.Method
+}
+
+// Next carries out a call, through the Options after the current one.
+type Next func(ctx context.Context) error
+
+// An Option wraps every call of a wrapped system: it is handed the call
+// and next, which it calls zero or more times, and returns the outcome of
+// the call.
+type Option func(ctx context.Context, c Call, next Next) error
+
+// wrapped is a System whose calls go through opts. caps are the
+// capabilities of the inner System with every provider wrapped likewise.
+type wrapped struct {
+	sys  backend.System
+	opts []Option
+	caps backend.Capability
+}
+
+// Wrap returns a System passing every call to sys through opts. It keeps
+// the capabilities of sys: a capability sys lacks stays nil and one it
+// has is wrapped, so a wrapped system with a NameProvider still has one
+// whose DisplayName goes through opts. Capabilities that are no backend
+// calls, like the fault injection of the noop backend, are passed through
+// as they are. The capabilities of sys are read once. A Backend is wrapped
+// as backend.Adapt(be). Wrap without options returns sys.
+func Wrap(sys backend.System, opts ...Option) backend.System {
+	if len(opts) == 0 {
+		return sys
+	}
+	w := &wrapped{sys: sys, opts: opts}
+	caps := sys.Capabilities()
+	if caps.Name != nil {
+		caps.Name = nameProvider{w, caps.Name}
+	}
+	if caps.Health != nil {
+		caps.Health = healthChecker{w, caps.Health}
+	}
+	if caps.Oem != nil {
+		caps.Oem = oemProvider{w, caps.Oem}
+	}
+	if caps.Boot != nil {
+		caps.Boot = bootSetter{w, caps.Boot}
+	}
+	if caps.Indicator != nil {
+		caps.Indicator = indicatorProvider{w, caps.Indicator}
+	}
+	if caps.PowerMetrics != nil {
+		caps.PowerMetrics = powerMetricsProvider{w, caps.PowerMetrics}
+	}
+	if caps.Thermal != nil {
+		caps.Thermal = thermalProvider{w, caps.Thermal}
+	}
+	if caps.Reconnect != nil {
+		caps.Reconnect = reconnector{w, caps.Reconnect}
+	}
+	if caps.Start != nil {
+		caps.Start = starter{w, caps.Start}
+	}
+	w.caps = caps
+	return w
+}
+
+// call carries out fn through the Options from the ith on.
+func (w *wrapped) call(ctx context.Context, c Call, i int, fn Next) error {
+	if i == len(w.opts) {
+		return fn(ctx)
+	}
+	return w.opts[i](ctx, c, func(ctx context.Context) error {
+		return w.call(ctx, c, i+1, fn)
+	})
+}
+
+// callValue is call for a method returning a value besides the error.
+func callValue[T any](w *wrapped, ctx context.Context, c Call, fn func(context.Context) (T, error)) (T, error) {
+	var v T
+	err := w.call(ctx, c, 0, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+func (w *wrapped) Capabilities() backend.Capability { return w.caps }
+
+func (w *wrapped) Reset(ctx context.Context, t backend.ResetType) error {
+	return w.call(ctx, Call{Method: "Reset", ResetType: t}, 0, func(ctx context.Context) error {
+		return w.sys.Reset(ctx, t)
+	})
+}
+
+func (w *wrapped) State(ctx context.Context) (backend.PowerState, error) {
+	return callValue(w, ctx, Call{Method: "State", ReadOnly: true}, w.sys.State)
+}
+
+type nameProvider struct {
+	w  *wrapped
+	np backend.NameProvider
+}
+
+func (p nameProvider) DisplayName(ctx context.Context) (string, error) {
+	return callValue(p.w, ctx, Call{Method: "DisplayName", ReadOnly: true}, p.np.DisplayName)
+}
+
+type healthChecker struct {
+	w  *wrapped
+	hc backend.HealthChecker
+}
+
+func (p healthChecker) Ping(ctx context.Context) error {
+	return p.w.call(ctx, Call{Method: "Ping", ReadOnly: true}, 0, p.hc.Ping)
+}
+
+type oemProvider struct {
+	w  *wrapped
+	op backend.OemProvider
+}
+
+func (p oemProvider) Oem(ctx context.Context) (map[string]any, error) {
+	return callValue(p.w, ctx, Call{Method: "Oem", ReadOnly: true}, p.op.Oem)
+}
+
+type bootSetter struct {
+	w  *wrapped
+	bs backend.BootSetter
+}
+
+func (p bootSetter) SetBoot(ctx context.Context, opts backend.BootOptions) error {
+	return p.w.call(ctx, Call{Method: "SetBoot"}, 0, func(ctx context.Context) error {
+		return p.bs.SetBoot(ctx, opts)
+	})
+}
+
+type indicatorProvider struct {
+	w  *wrapped
+	ip backend.IndicatorProvider
+}
+
+func (p indicatorProvider) IndicatorLED(ctx context.Context) (string, error) {
+	return callValue(p.w, ctx, Call{Method: "IndicatorLED", ReadOnly: true}, p.ip.IndicatorLED)
+}
+
+func (p indicatorProvider) SetIndicatorLED(ctx context.Context, state string) error {
+	return p.w.call(ctx, Call{Method: "SetIndicatorLED"}, 0, func(ctx context.Context) error {
+		return p.ip.SetIndicatorLED(ctx, state)
+	})
+}
+
+type powerMetricsProvider struct {
+	w  *wrapped
+	pm backend.PowerMetricsProvider
+}
+
+func (p powerMetricsProvider) PowerMetrics(ctx context.Context) (backend.PowerMetrics, error) {
+	return callValue(p.w, ctx, Call{Method: "PowerMetrics", ReadOnly: true}, p.pm.PowerMetrics)
+}
+
+type thermalProvider struct {
+	w  *wrapped
+	tp backend.ThermalProvider
+}
+
+func (p thermalProvider) Temperatures(ctx context.Context) ([]backend.TemperatureReading, error) {
+	return callValue(p.w, ctx, Call{Method: "Temperatures", ReadOnly: true}, p.tp.Temperatures)
+}
+
+type reconnector struct {
+	w  *wrapped
+	rc backend.Reconnector
+}
+
+func (p reconnector) Reconnect(ctx context.Context) error {
+	return p.w.call(ctx, Call{Method: "Reconnect"}, 0, p.rc.Reconnect)
+}
+
+type starter struct {
+	w  *wrapped
+	st backend.Starter
+}
+
+func (p starter) Start(ctx context.Context) error {
+	return p.w.call(ctx, Call{Method: "Start"}, 0, p.st.Start)
+}
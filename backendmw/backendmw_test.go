@@ -0,0 +1,285 @@
+package backendmw
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// fake is a System with every capability, recording the calls made to it
+// and failing them with err.
+type fake struct {
+	calls []string
+	err   error
+}
+
+func (f *fake) call(method string) error {
+	f.calls = append(f.calls, method)
+	return f.err
+}
+
+func (f *fake) Capabilities() backend.Capability {
+	return backend.Capability{
+		Resets:       []backend.ResetCapability{{Type: backend.ResetOn, Calls: []string{"Reset(On)"}}},
+		PowerState:   true,
+		Name:         f,
+		Health:       f,
+		Oem:          f,
+		Boot:         f,
+		Indicator:    f,
+		PowerMetrics: f,
+		Thermal:      f,
+		Reconnect:    f,
+		Start:        f,
+		Faults:       f,
+	}
+}
+
+func (f *fake) Reset(ctx context.Context, t backend.ResetType) error { return f.call("Reset") }
+
+func (f *fake) State(ctx context.Context) (backend.PowerState, error) {
+	return backend.PowerStateOn, f.call("State")
+}
+
+func (f *fake) DisplayName(ctx context.Context) (string, error) { return "node", f.call("DisplayName") }
+func (f *fake) Ping(ctx context.Context) error                  { return f.call("Ping") }
+func (f *fake) Oem(ctx context.Context) (map[string]any, error) { return nil, f.call("Oem") }
+func (f *fake) SetBoot(ctx context.Context, opts backend.BootOptions) error {
+	return f.call("SetBoot")
+}
+func (f *fake) IndicatorLED(ctx context.Context) (string, error) { return "", f.call("IndicatorLED") }
+func (f *fake) SetIndicatorLED(ctx context.Context, state string) error {
+	return f.call("SetIndicatorLED")
+}
+func (f *fake) PowerMetrics(ctx context.Context) (backend.PowerMetrics, error) {
+	return backend.PowerMetrics{}, f.call("PowerMetrics")
+}
+func (f *fake) Temperatures(ctx context.Context) ([]backend.TemperatureReading, error) {
+	return nil, f.call("Temperatures")
+}
+func (f *fake) Reconnect(ctx context.Context) error { return f.call("Reconnect") }
+func (f *fake) Start(ctx context.Context) error     { return f.call("Start") }
+func (f *fake) Faults() backend.Faults              { return backend.Faults{} }
+func (f *fake) SetFaults(backend.Faults)            {}
+
+// bare is a System without optional capabilities.
+type bare struct{ fake }
+
+func (b *bare) Capabilities() backend.Capability { return backend.Capability{} }
+
+// record is an Option recording the calls passed through it.
+func record(calls *[]Call) Option {
+	return func(ctx context.Context, c Call, next Next) error {
+		*calls = append(*calls, c)
+		return next(ctx)
+	}
+}
+
+func TestWrapRoutesEveryCapability(t *testing.T) {
+	f := &fake{}
+	var seen []Call
+	sys := Wrap(f, record(&seen))
+	caps := sys.Capabilities()
+	ctx := context.Background()
+	tests := []struct {
+		method   string
+		readOnly bool
+		call     func() error
+	}{
+		{"Reset", false, func() error { return sys.Reset(ctx, backend.ResetOn) }},
+		{"State", true, func() error { _, err := sys.State(ctx); return err }},
+		{"DisplayName", true, func() error { _, err := caps.Name.DisplayName(ctx); return err }},
+		{"Ping", true, func() error { return caps.Health.Ping(ctx) }},
+		{"Oem", true, func() error { _, err := caps.Oem.Oem(ctx); return err }},
+		{"SetBoot", false, func() error { return caps.Boot.SetBoot(ctx, backend.BootOptions{}) }},
+		{"IndicatorLED", true, func() error { _, err := caps.Indicator.IndicatorLED(ctx); return err }},
+		{"SetIndicatorLED", false, func() error { return caps.Indicator.SetIndicatorLED(ctx, backend.IndicatorLit) }},
+		{"PowerMetrics", true, func() error { _, err := caps.PowerMetrics.PowerMetrics(ctx); return err }},
+		{"Temperatures", true, func() error { _, err := caps.Thermal.Temperatures(ctx); return err }},
+		{"Reconnect", false, func() error { return caps.Reconnect.Reconnect(ctx) }},
+		{"Start", false, func() error { return caps.Start.Start(ctx) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			seen, f.calls = nil, nil
+			if err := tt.call(); err != nil {
+				t.Fatal(err)
+			}
+			if len(seen) != 1 || seen[0].Method != tt.method || seen[0].ReadOnly != tt.readOnly {
+				t.Errorf("options saw %+v, want one %s call with ReadOnly %v", seen, tt.method, tt.readOnly)
+			}
+			if !slices.Equal(f.calls, []string{tt.method}) {
+				t.Errorf("system got %v, want %s", f.calls, tt.method)
+			}
+		})
+	}
+	if caps.Faults != backend.FaultInjector(f) {
+		t.Errorf("Faults = %v, want the injector of the system itself", caps.Faults)
+	}
+	if !caps.PowerState || len(caps.Resets) != 1 {
+		t.Errorf("capabilities %+v lost PowerState or Resets", caps)
+	}
+}
+
+func TestWrapKeepsMissingCapabilities(t *testing.T) {
+	caps := Wrap(&bare{}, record(new([]Call))).Capabilities()
+	for name, p := range map[string]any{"Name": caps.Name, "Health": caps.Health, "Oem": caps.Oem, "Boot": caps.Boot, "Indicator": caps.Indicator, "PowerMetrics": caps.PowerMetrics, "Thermal": caps.Thermal, "Reconnect": caps.Reconnect, "Start": caps.Start, "Faults": caps.Faults} {
+		if p != nil {
+			t.Errorf("%s = %v, want nil", name, p)
+		}
+	}
+}
+
+func TestWrapWithoutOptions(t *testing.T) {
+	f := &fake{}
+	if sys := Wrap(f); sys != backend.System(f) {
+		t.Errorf("Wrap without options = %v, want the system itself", sys)
+	}
+}
+
+func TestOptionOrder(t *testing.T) {
+	var order []string
+	opt := func(name string) Option {
+		return func(ctx context.Context, c Call, next Next) error {
+			order = append(order, name+" before")
+			err := next(ctx)
+			order = append(order, name+" after")
+			return err
+		}
+	}
+	f := &fake{}
+	if err := Wrap(f, opt("first"), opt("second")).Reset(context.Background(), backend.ResetOn); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first before", "second before", "second after", "first after"}
+	if !slices.Equal(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		call  func(backend.System) error
+		calls int
+	}{
+		{"read retried", errors.New("timeout"), func(s backend.System) error { _, err := s.State(context.Background()); return err }, 3},
+		{"reset not retried", errors.New("timeout"), func(s backend.System) error { return s.Reset(context.Background(), backend.ResetOn) }, 1},
+		{"unsupported not retried", backend.ErrNotSupported, func(s backend.System) error { _, err := s.State(context.Background()); return err }, 1},
+		{"unknown state not retried", backend.ErrStateUnknown, func(s backend.System) error { _, err := s.State(context.Background()); return err }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fake{err: tt.err}
+			if err := tt.call(Wrap(f, Retry(2, time.Millisecond))); !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if len(f.calls) != tt.calls {
+				t.Errorf("calls = %v, want %d", f.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryWaitsRetryAfter(t *testing.T) {
+	f := &fake{err: &backend.RetryableError{Err: errors.New("rate limited"), RetryAfter: 50 * time.Millisecond}}
+	start := time.Now()
+	_, _ = Wrap(f, Retry(1, time.Millisecond)).State(context.Background())
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("retried after %s, want at least the RetryAfter of 50ms", d)
+	}
+}
+
+// TestBreakerAfterRetry checks the order the shim wraps systems in: the
+// breaker counts a call as failed once its retries are exhausted, and an
+// open breaker refuses calls without them being retried.
+func TestBreakerAfterRetry(t *testing.T) {
+	f := &fake{err: errors.New("unreachable")}
+	sys := Wrap(f, Breaker(2, time.Hour), Retry(2, time.Millisecond))
+	ctx := context.Background()
+
+	for i := range 2 {
+		if _, err := sys.State(ctx); errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("call %d refused by the breaker before it failed twice", i)
+		}
+	}
+	if len(f.calls) != 6 {
+		t.Fatalf("backend calls = %d, want 6 (two calls with two retries each)", len(f.calls))
+	}
+	_, err := sys.State(ctx)
+	var re *backend.RetryableError
+	if !errors.Is(err, ErrBreakerOpen) || !errors.As(err, &re) || re.RetryAfter <= 0 {
+		t.Errorf("err = %v, want ErrBreakerOpen in a RetryableError with a RetryAfter", err)
+	}
+	if len(f.calls) != 6 {
+		t.Errorf("backend calls = %d after the breaker opened, want still 6", len(f.calls))
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	f := &fake{err: errors.New("unreachable")}
+	const cooldown = 20 * time.Millisecond
+	sys := Wrap(f, Breaker(1, cooldown))
+	ctx := context.Background()
+
+	_ = sys.Reset(ctx, backend.ResetOn)
+	if err := sys.Reset(ctx, backend.ResetOn); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("err = %v, want ErrBreakerOpen", err)
+	}
+	time.Sleep(cooldown)
+	// The probe fails: the breaker stays open for another cooldown.
+	if err := sys.Reset(ctx, backend.ResetOn); errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if err := sys.Reset(ctx, backend.ResetOn); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("err after a failed probe = %v, want ErrBreakerOpen", err)
+	}
+	time.Sleep(cooldown)
+	// The probe succeeds: the breaker closes.
+	f.err = nil
+	for i := range 3 {
+		if err := sys.Reset(ctx, backend.ResetOn); err != nil {
+			t.Fatalf("call %d after a successful probe: %v", i, err)
+		}
+	}
+}
+
+func TestBreakerIgnoresUnsupported(t *testing.T) {
+	f := &fake{err: backend.ErrNotSupported}
+	sys := Wrap(f, Breaker(1, time.Hour))
+	for range 3 {
+		if err := sys.Reset(context.Background(), backend.ResetOn); !errors.Is(err, backend.ErrNotSupported) {
+			t.Fatalf("err = %v, want ErrNotSupported", err)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	slow := Option(func(ctx context.Context, c Call, next Next) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	err := Wrap(&fake{}, Timeout(time.Millisecond), slow).Reset(context.Background(), backend.ResetOn)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var observed []Call
+	f := &fake{err: errors.New("boom")}
+	_, _ = Wrap(f, Metrics(func(c Call, d time.Duration, err error) {
+		if err == nil {
+			t.Errorf("observed %s without its error", c)
+		}
+		observed = append(observed, c)
+	}), Retry(2, time.Millisecond)).State(context.Background())
+	if len(observed) != 1 || observed[0].String() != "State" {
+		t.Errorf("observed %v, want the State call once with its retries", observed)
+	}
+}
@@ -0,0 +1,167 @@
+package backendmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// ErrBreakerOpen is wrapped, in a backend.RetryableError, by the error of
+// a call the circuit breaker refused.
+var ErrBreakerOpen = errors.New("backend circuit breaker open")
+
+// failed reports whether err is a failure of the backend: not one of a
+// feature the system lacks, a state the device reports as unknown or a
+// call the caller gave up on.
+func failed(ctx context.Context, err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, backend.ErrNotSupported),
+		errors.Is(err, backend.ErrStateUnknown),
+		errors.Is(err, ErrBreakerOpen):
+		return false
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		return false
+	}
+	return true
+}
+
+// Retry retries a failed read-only call up to retries times, waiting
+// backoff before the first retry and twice as long before each further
+// one, or the RetryAfter of a backend.RetryableError if that is longer.
+// Calls that change something are not retried: a reset the backend
+// carried out but failed to confirm must not be carried out again.
+func Retry(retries int, backoff time.Duration) Option {
+	return func(ctx context.Context, c Call, next Next) error {
+		err := next(ctx)
+		delay := backoff
+		for i := 0; i < retries && c.ReadOnly && failed(ctx, err) && ctx.Err() == nil; i++ {
+			wait := delay
+			var re *backend.RetryableError
+			if errors.As(err, &re) {
+				wait = max(wait, re.RetryAfter)
+			}
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+			err = next(ctx)
+			delay *= 2
+		}
+		return err
+	}
+}
+
+// breaker is the state of a circuit breaker.
+type breaker struct {
+	mu sync.Mutex
+	// failures counts the consecutive failed calls.
+	failures int
+	// openUntil is when an open breaker lets a probe call through.
+	openUntil time.Time
+	// probing is set while the probe call of an open breaker runs.
+	probing bool
+}
+
+// Breaker opens after failures consecutive calls failed: for cooldown it
+// fails every call at once with ErrBreakerOpen, in a
+// backend.RetryableError, rather than let clients wait for an unreachable
+// backend. Then it lets one call through; the breaker closes if it
+// succeeds and stays open for another cooldown if it fails. Calls of
+// features the system lacks and power states the device reports as
+// unknown count as successes.
+func Breaker(failures int, cooldown time.Duration) Option {
+	b := &breaker{}
+	return func(ctx context.Context, c Call, next Next) error {
+		probe, wait, ok := b.allow(time.Now(), failures)
+		if !ok {
+			return &backend.RetryableError{Err: fmt.Errorf("%s: %w", c, ErrBreakerOpen), RetryAfter: wait}
+		}
+		err := next(ctx)
+		b.done(time.Now(), probe, failures, cooldown, failed(ctx, err))
+		return err
+	}
+}
+
+// allow reports whether a call may go through, and whether it is the probe
+// of an open breaker; wait is how long a refused call should wait.
+func (b *breaker) allow(now time.Time, failures int) (probe bool, wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.failures < failures:
+		return false, 0, true
+	case now.Before(b.openUntil):
+		return false, b.openUntil.Sub(now), false
+	case b.probing:
+		return false, 0, false
+	}
+	b.probing = true
+	return true, 0, true
+}
+
+// done records the outcome of a call allow let through.
+func (b *breaker) done(now time.Time, probe bool, failures int, cooldown time.Duration, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	if b.failures++; b.failures >= failures {
+		b.openUntil = now.Add(cooldown)
+	}
+}
+
+// Timeout bounds every call to d. An expired call fails with an error
+// wrapping context.DeadlineExceeded that names the call.
+func Timeout(d time.Duration) Option {
+	return func(parent context.Context, c Call, next Next) error {
+		ctx, cancel := context.WithTimeout(parent, d)
+		defer cancel()
+		err := next(ctx)
+		if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+			return fmt.Errorf("%s timed out after %s: %w", c, d, err)
+		}
+		return err
+	}
+}
+
+// Observer is told of every call, how long it took and its error.
+type Observer func(c Call, d time.Duration, err error)
+
+// Metrics reports every call to observe.
+func Metrics(observe Observer) Option {
+	return func(ctx context.Context, c Call, next Next) error {
+		start := time.Now()
+		err := next(ctx)
+		observe(c, time.Since(start), err)
+		return err
+	}
+}
+
+// Logging logs every call with its outcome and duration through logf,
+// e.g. log.Printf.
+func Logging(logf func(format string, args ...any)) Option {
+	return func(ctx context.Context, c Call, next Next) error {
+		start := time.Now()
+		err := next(ctx)
+		d := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			logf("backend %s: %v (%s)", c, err, d)
+		} else {
+			logf("backend %s: ok (%s)", c, d)
+		}
+		return err
+	}
+}
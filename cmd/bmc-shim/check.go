@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+type checkResult struct {
+	ID     string `json:"id"`
+	Kind   string `json:"backend"`
+	Target string `json:"target,omitempty"`
+	Health string `json:"health"`
+	Name   string `json:"name"`
+	Error  string `json:"error,omitempty"`
+	// TLSPin is the pin of the certificate the system's endpoint presents,
+	// for backends that can pin it.
+	TLSPin string `json:"tls_pin,omitempty"`
+}
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	checkBackends := fs.Bool("check-backends", false, "also ping each backend and resolve its display name")
+	jsonOut := fs.Bool("json", false, "print machine-readable JSON output")
+	var bf backendFlags
+	bf.register(fs, "noop")
+	_ = fs.Parse(args)
+	return check(&bf, *checkBackends, *jsonOut)
+}
+
+// check builds all configured backends, optionally pings them, prints a
+// per-system summary and returns the process exit code.
+func check(bf *backendFlags, ping, jsonOut bool) int {
+	systems, err := bf.build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config invalid: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	// The pin of Home Assistant's certificate, so that it can be adopted
+	// with --ha-tls-pin.
+	var haPin string
+	if ping && bf.opts.Backend == "homeassistant" && strings.HasPrefix(bf.opts.HAURL, "https://") {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		pin, err := backend.FetchTLSPin(ctx, bf.opts.HAURL)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Home Assistant %s: cannot read the TLS pin: %v\n", bf.opts.HAURL, err)
+		}
+		haPin = pin
+	}
+	results := make([]checkResult, 0, len(systems))
+	for _, sys := range systems {
+		res := checkResult{
+			ID:     sys.ID,
+			Kind:   sys.Kind,
+			Target: sys.Target,
+			Health: "not checked",
+			Name:   "System " + sys.ID,
+		}
+		if sys.Kind == "homeassistant" {
+			res.TLSPin = haPin
+		}
+		if sys.Info.Name != "" {
+			res.Name = sys.Info.Name
+		}
+		if ping {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			caps := sys.Backend.Capabilities()
+			if hc := caps.Health; hc != nil {
+				if err := hc.Ping(ctx); err != nil {
+					res.Health = "failed"
+					res.Error = err.Error()
+					code = 1
+				} else {
+					res.Health = "ok"
+				}
+			} else {
+				res.Health = "unsupported"
+			}
+			if np := caps.Name; np != nil && res.Error == "" && sys.Info.Name == "" {
+				if n, err := np.DisplayName(ctx); err == nil && n != "" {
+					res.Name = n
+				}
+			}
+			cancel()
+		}
+		results = append(results, res)
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(results)
+		return code
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tBACKEND\tTARGET\tHEALTH\tNAME")
+	for _, r := range results {
+		health := r.Health
+		if r.Error != "" {
+			health += ": " + r.Error
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.Kind, r.Target, health, r.Name)
+	}
+	_ = tw.Flush()
+	if haPin != "" {
+		note := ""
+		if bf.opts.HATLSPin != "" {
+			// The configuration was validated by bf.build.
+			if pin, _ := backend.ParseTLSPin(bf.opts.HATLSPin); pin == haPin {
+				note = " (matches --ha-tls-pin)"
+			} else {
+				note = " (does not match --ha-tls-pin)"
+			}
+		}
+		fmt.Printf("\nHome Assistant %s TLS pin: %s%s\n", bf.opts.HAURL, haPin, note)
+	}
+	return code
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/client"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/config"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/server"
+)
+
+// clientFlags are the flags shared by the CLI client commands. When
+// --backend is given the backends are driven directly in-process,
+// otherwise the commands talk to a running shim at --url.
+type clientFlags struct {
+	url     string
+	user    string
+	pass    string
+	system  string
+	jsonOut bool
+	timeout time.Duration
+	verbose bool
+	backend backendFlags
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.url, "url", "http://127.0.0.1:8080", "base URL of a running bmc-shim")
+	fs.StringVar(&f.user, "user", readConfigValue("user"), "basic auth username (or /etc/bmc-shim/user or BMC_SHIM_USER)")
+	fs.StringVar(&f.pass, "pass", readConfigValue("pass"), "basic auth password (or /etc/bmc-shim/pass or BMC_SHIM_PASS)")
+	fs.StringVar(&f.system, "system", "", "system ID to operate on")
+	fs.BoolVar(&f.jsonOut, "json", false, "print machine-readable JSON output")
+	fs.DurationVar(&f.timeout, "timeout", 2*time.Minute, "overall timeout for the command")
+	fs.BoolVar(&f.verbose, "v", false, "log requests and backend calls (direct mode)")
+	f.backend.register(fs, "")
+}
+
+func (f *clientFlags) client() (*client.Client, error) {
+	if f.backend.kind() == "" {
+		return client.New(f.url, f.user, f.pass, nil), nil
+	}
+	if !f.verbose {
+		log.SetOutput(io.Discard)
+	}
+	systems, err := f.backend.build()
+	if err != nil {
+		return nil, err
+	}
+	srv := server.New(server.Config{
+		Systems: config.Backends(systems),
+		Info:    config.Infos(systems),
+	})
+	return client.NewForHandler(srv.Handler(), "", ""), nil
+}
+
+type statusResult struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	PowerState string `json:"powerState,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	_ = fs.Parse(args)
+
+	c, err := cf.client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cf.timeout)
+	defer cancel()
+
+	ids := []string{cf.system}
+	if cf.system == "" {
+		if ids, err = c.SystemIDs(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "error: listing systems: %v\n", err)
+			return 1
+		}
+	}
+
+	code := 0
+	results := make([]statusResult, 0, len(ids))
+	for _, id := range ids {
+		res := statusResult{ID: id}
+		if sys, err := c.System(ctx, id); err != nil {
+			res.Error = err.Error()
+			code = 1
+		} else {
+			res.Name = sys.Name
+			res.PowerState = sys.PowerState
+		}
+		results = append(results, res)
+	}
+
+	if cf.jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(results)
+		return code
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tPOWER\tNAME")
+	for _, r := range results {
+		if r.Error != "" {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", r.ID, "Error", r.Error)
+			continue
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", r.ID, r.PowerState, r.Name)
+	}
+	_ = tw.Flush()
+	return code
+}
+
+// powerActions maps CLI power actions to Redfish ResetTypes.
+var powerActions = map[string]string{
+	"on":      "On",
+	"off":     "ForceOff",
+	"restart": "ForceRestart",
+}
+
+type powerResult struct {
+	ID        string `json:"id"`
+	Action    string `json:"action"`
+	ResetType string `json:"resetType"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+func runPower(args []string) int {
+	fs := flag.NewFlagSet("power", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: bmc-shim power on|off|restart --system id [flags]")
+		fs.PrintDefaults()
+	}
+
+	// Accept the action both before and after the flags.
+	action := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	_ = fs.Parse(args)
+	if action == "" {
+		action = fs.Arg(0)
+	}
+	resetType, ok := powerActions[action]
+	if !ok || cf.system == "" {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := cf.client()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cf.timeout)
+	defer cancel()
+
+	res := powerResult{ID: cf.system, Action: action, ResetType: resetType, Success: true}
+	if err := c.Reset(ctx, cf.system, resetType); err != nil {
+		res.Success = false
+		res.Error = err.Error()
+	}
+
+	if cf.jsonOut {
+		_ = json.NewEncoder(os.Stdout).Encode(res)
+	} else if res.Success {
+		fmt.Printf("system %s: %s ok\n", res.ID, resetType)
+	} else {
+		fmt.Fprintf(os.Stderr, "system %s: %s failed: %s\n", res.ID, resetType, res.Error)
+	}
+	if !res.Success {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// The configuration file is a YAML mapping of flag names and values, e.g.
+//
+//	listen: [https://:8443]
+//	backend: homeassistant
+//	ha-url: https://ha.example.com
+//	ha-token: ${HA_TOKEN}
+//	pass: !file /run/secrets/bmc-shim-pass
+//
+// As YAML is a superset of JSON, the same as a JSON object works too.
+// Flags given on the command line win over the file. Strings may refer to
+// environment variables as ${NAME} ($${ is a literal ${), and a "!file
+// <path>" value, tagged or as a string, is replaced by the content of that
+// file, so the file can be kept in git and the secrets injected at
+// runtime.
+
+// commandFlags are the flags of serve that cannot be set in the
+// configuration file.
+var commandFlags = map[string]bool{"config": true, "config-schema": true, "print-config": true, "write-config": true}
+
+// envRefRe matches an environment variable reference or its escape.
+var envRefRe = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// configError is an error at a position of the configuration file.
+type configError struct {
+	path      string
+	line, col int
+	err       error
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.path, e.line, e.col, e.err)
+}
+
+func (e *configError) Unwrap() error { return e.err }
+
+// configKinds of flags, by the value they take.
+const (
+	kindString  = "string"
+	kindBool    = "boolean"
+	kindInteger = "integer"
+	kindNumber  = "number"
+	kindList    = "list"
+	kindObject  = "object"
+)
+
+// flagKind returns the kind of value f takes.
+func flagKind(f *flag.Flag) string {
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		if _, ok := f.Value.(*listFlag); ok {
+			return kindList
+		}
+		if _, ok := f.Value.(*jsonFlag); ok {
+			return kindObject
+		}
+		return kindString
+	}
+	switch g.Get().(type) {
+	case bool:
+		return kindBool
+	case int, int64, uint, uint64:
+		return kindInteger
+	case float64:
+		return kindNumber
+	}
+	return kindString
+}
+
+// loadConfigFile sets the flags of fs that were not given on the command
+// line from the configuration file at path.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	values, err := parseConfigFile(fs, path, data, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, v := range values {
+		if given[v.name] {
+			continue
+		}
+		for _, s := range v.values {
+			if err := fs.Set(v.name, s); err != nil {
+				return &configError{path: path, line: v.line, col: v.col, err: fmt.Errorf("%q: invalid value %q: %w", v.name, s, err)}
+			}
+		}
+	}
+	return nil
+}
+
+// configValue is a flag set by the configuration file, with the values
+// to pass to it and the position of its key.
+type configValue struct {
+	name      string
+	values    []string
+	line, col int
+}
+
+// yamlLineRe matches the line number in the syntax errors of the YAML
+// parser.
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// parseConfigFile validates data against the flags of fs, interpolates
+// its strings with the environment variables of lookup and returns the
+// flag values in file order.
+func parseConfigFile(fs *flag.FlagSet, path string, data []byte, lookup func(string) (string, bool)) ([]configValue, error) {
+	fail := func(n *yaml.Node, err error) error {
+		return &configError{path: path, line: n.Line, col: n.Column, err: err}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, &configError{path: path, line: line, col: 1, err: errors.New(err.Error()[len(m[0]):])}
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind != yaml.DocumentNode || doc.Content[0].Kind != yaml.MappingNode {
+		n := &doc
+		if doc.Kind == yaml.DocumentNode {
+			n = doc.Content[0]
+		} else {
+			n.Line, n.Column = 1, 1
+		}
+		return nil, fail(n, errors.New("expected a mapping of flag names and values"))
+	}
+	root := doc.Content[0]
+	seen := map[string]bool{}
+	var values []configValue
+	for i := 0; i < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		name := key.Value
+		v := configValue{name: name, line: key.Line, col: key.Column}
+		f := fs.Lookup(name)
+		if key.Kind != yaml.ScalarNode || f == nil || commandFlags[name] {
+			return nil, fail(key, fmt.Errorf("unknown key %q (keys are the flag names of serve)", name))
+		}
+		if seen[name] {
+			return nil, fail(key, fmt.Errorf("duplicate key %q", name))
+		}
+		seen[name] = true
+		raw, err := nodeValue(node)
+		if err != nil {
+			return nil, fail(key, fmt.Errorf("%q: %w", name, err))
+		}
+		raw, err = mapStrings(raw, func(s string) (string, error) { return interpolateWith(s, lookup) })
+		if err != nil {
+			return nil, fail(key, fmt.Errorf("%q: %w", name, err))
+		}
+		if v.values, err = configStrings(raw, flagKind(f)); err != nil {
+			return nil, fail(key, fmt.Errorf("%q: %w", name, err))
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// nodeValue converts a YAML node to the value decoding the same JSON
+// gives, with numbers as json.Number. A scalar tagged !file becomes the
+// string "!file <path>".
+func nodeValue(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return nodeValue(n.Alias)
+	case yaml.SequenceNode:
+		out := make([]any, len(n.Content))
+		for i, e := range n.Content {
+			v, err := nodeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case yaml.MappingNode:
+		out := make(map[string]any, len(n.Content)/2)
+		for i := 0; i < len(n.Content); i += 2 {
+			v, err := nodeValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			out[n.Content[i].Value] = v
+		}
+		return out, nil
+	}
+	switch n.Tag {
+	case "!!str":
+		return n.Value, nil
+	case "!file":
+		return "!file " + n.Value, nil
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			return nil, fmt.Errorf("expected an integer, got %s", n.Value)
+		}
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	return nil, fmt.Errorf("unsupported tag %s", n.Tag)
+}
+
+// configStrings converts a decoded value to the values of a flag of kind.
+// Every kind also takes a string, which may refer to an environment
+// variable.
+func configStrings(v any, kind string) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		if kind == kindBool {
+			return []string{strconv.FormatBool(v)}, nil
+		}
+	case json.Number:
+		if kind == kindInteger {
+			if _, err := v.Int64(); err != nil {
+				return nil, fmt.Errorf("expected an integer, got %s", v)
+			}
+			return []string{v.String()}, nil
+		}
+		if kind == kindNumber {
+			return []string{v.String()}, nil
+		}
+	case map[string]any:
+		if kind == kindObject {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return []string{string(b)}, nil
+		}
+	case []any:
+		if kind == kindList {
+			out := make([]string, len(v))
+			for i, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("element %d: expected a string", i)
+				}
+				out[i] = s
+			}
+			return out, nil
+		}
+	}
+	switch kind {
+	case kindList:
+		return nil, errors.New("expected a string or an array of strings")
+	case kindString:
+		return nil, errors.New("expected a string")
+	case kindObject:
+		return nil, errors.New("expected an object or a string")
+	}
+	return nil, fmt.Errorf("expected a %s or a string", kind)
+}
+
+// mapStrings replaces the strings of a decoded value, including
+// those nested in arrays and objects, by what fn returns for them.
+func mapStrings(v any, fn func(string) (string, error)) (any, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			if out[i], err = mapStrings(e, fn); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			if out[k], err = mapStrings(e, fn); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// interpolateWith replaces the references to the environment variables of
+// lookup in s and then a "!file <path>" value by the content of the file,
+// without trailing newlines.
+func interpolateWith(s string, lookup func(string) (string, bool)) (string, error) {
+	var err error
+	s = envRefRe.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+		name := m[2 : len(m)-1]
+		v, ok := lookup(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	if path, ok := strings.CutPrefix(s, "!file "); ok {
+		b, err := os.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return s, nil
+}
+
+// schemaDefault returns the default of f as a JSON value. Defaults read
+// from /etc/bmc-shim or the environment are left out: they may be
+// secrets.
+func schemaDefault(f *flag.Flag) (any, bool) {
+	if f.DefValue == "" || strings.Contains(f.Usage, "BMC_SHIM_") {
+		return nil, false
+	}
+	switch flagKind(f) {
+	case kindBool:
+		b, err := strconv.ParseBool(f.DefValue)
+		return b, err == nil
+	case kindInteger, kindNumber:
+		return json.Number(f.DefValue), true
+	case kindList, kindObject:
+		return nil, false
+	}
+	return f.DefValue, true
+}
+
+// configSchema returns the JSON Schema of the configuration file for the
+// flags of fs.
+func configSchema(fs *flag.FlagSet) map[string]any {
+	props := map[string]any{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			return
+		}
+		p := map[string]any{"description": f.Usage}
+		switch kind := flagKind(f); kind {
+		case kindString:
+			p["type"] = "string"
+		case kindList:
+			p["oneOf"] = []any{
+				map[string]any{"type": "string"},
+				map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			}
+		case kindObject:
+			p["type"] = []string{"object", "string"}
+		default:
+			p["type"] = []string{kind, "string"}
+		}
+		if d, ok := schemaDefault(f); ok {
+			p["default"] = d
+		}
+		props[f.Name] = p
+	})
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "bmc-shim configuration",
+		"description":          "Flag names of bmc-shim serve and their values. Strings may refer to environment variables as ${NAME}, and \"!file <path>\" is replaced by the content of the file.",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           props,
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestConfigFileSystemIDs checks that system IDs set through the
+// configuration file are validated like those on the command line.
+func TestConfigFileSystemIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"valid", `{"backend": "tasmota", "systems": "1=http://plug1.lan,node-2=http://plug2.lan"}`, ""},
+		{"duplicate", `{"backend": "tasmota", "systems": "1=http://plug1.lan,1=http://plug2.lan"}`, `duplicate system id "1"`},
+		{"slash", `{"backend": "tasmota", "systems": "rack/1=http://plug1.lan"}`, `invalid system id "rack/1"`},
+		{"empty target", `{"backend": "tasmota", "systems": "1="}`, "empty target"},
+		{"single", `{"backend": "noop", "system-id": "node 1"}`, "invalid --system-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			var bf backendFlags
+			bf.register(fs, "noop")
+			if err := loadConfigFile(fs, path); err != nil {
+				t.Fatal(err)
+			}
+			_, err := bf.build()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("build: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("build = %v, want an error mentioning %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "pass")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BMC_SHIM_TEST_TOKEN", "t0k3n")
+	tests := []struct {
+		name    string
+		file    string
+		want    map[string][]string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			file: "# lab\nbackend: tasmota\nlisten:\n  - :8000\n  - https://:8443\nlog-entries: 2\nread-only: true\n",
+			want: map[string][]string{"backend": {"tasmota"}, "listen": {":8000", "https://:8443"}, "log-entries": {"2"}, "read-only": {"true"}},
+		},
+		{
+			name: "json",
+			file: `{"backend": "tasmota", "listen": [":8000"], "log-entries": 2, "system-overrides": {"1": {"Count": 2}}}`,
+			want: map[string][]string{"backend": {"tasmota"}, "listen": {":8000"}, "log-entries": {"2"}, "system-overrides": {`{"1":{"Count":2}}`}},
+		},
+		{
+			name: "references",
+			file: "pass: !file " + secret + "\nha-token: ${BMC_SHIM_TEST_TOKEN}\nuser: '!file " + secret + "'\nha-url: $${literal}\n",
+			want: map[string][]string{"pass": {"hunter2"}, "ha-token": {"t0k3n"}, "user": {"hunter2"}, "ha-url": {"${literal}"}},
+		},
+		{name: "yaml integer forms", file: "log-entries: 0x10\n", want: map[string][]string{"log-entries": {"16"}}},
+		{name: "unknown key", file: "backend: noop\nnope: 1\n", wantErr: `:2:1: unknown key "nope"`},
+		{name: "command flag", file: "print-config: true\n", wantErr: `:1:1: unknown key "print-config"`},
+		{name: "duplicate key", file: "backend: noop\nbackend: tasmota\n", wantErr: `:2:1: duplicate key "backend"`},
+		{name: "wrong type", file: "log-entries: 1.5\n", wantErr: `:1:1: "log-entries": expected an integer, got 1.5`},
+		{name: "list element", file: "listen: [[a]]\n", wantErr: `"listen": element 0: expected a string`},
+		{name: "unset variable", file: "backend: noop\nha-token: ${BMC_SHIM_TEST_UNSET}\n", wantErr: `:2:1: "ha-token": environment variable BMC_SHIM_TEST_UNSET is not set`},
+		{name: "syntax", file: "backend: noop\n  bad: indent\n", wantErr: ":2:1: mapping values are not allowed"},
+		{name: "not a mapping", file: "- backend\n", wantErr: ":1:1: expected a mapping of flag names and values"},
+		{name: "empty", file: "", wantErr: ":1:1: expected a mapping of flag names and values"},
+		{name: "unknown tag", file: "backend: !secret noop\n", wantErr: `"backend": unsupported tag !secret`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			var bf backendFlags
+			bf.register(fs, "noop")
+			fs.Var(new(listFlag), "listen", "")
+			fs.Int("log-entries", 100, "")
+			fs.Bool("read-only", false, "")
+			fs.Var(new(jsonFlag), "system-overrides", "")
+			fs.Bool("print-config", false, "")
+			fs.String("user", "", "")
+			fs.String("pass", "", "")
+			values, err := parseConfigFile(fs, "bmc-shim.yaml", []byte(tt.file), os.LookupEnv)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				if !strings.HasPrefix(err.Error(), "bmc-shim.yaml:") {
+					t.Errorf("err = %v, want it to start with the file name", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]string{}
+			for _, v := range values {
+				got[v.name] = v.values
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
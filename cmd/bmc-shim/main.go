@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"text/template"
+	"time"
 
-	"github.com/ArthurVardevanyan/bmc-shim/internal/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/acme"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/config"
 	"github.com/ArthurVardevanyan/bmc-shim/internal/server"
 )
 
@@ -18,95 +27,773 @@ func readConfigValue(name string) string {
 	// Check /etc/bmc-shim/<name> first, then env
 	path := filepath.Join("/etc/bmc-shim", name)
 	if b, err := os.ReadFile(path); err == nil {
+		configSources[name] = "!file " + path
 		return strings.TrimSpace(string(b))
 	}
-	return os.Getenv("BMC_SHIM_" + strings.ToUpper(name))
+	env := "BMC_SHIM_" + strings.ToUpper(name)
+	v := os.Getenv(env)
+	if v != "" {
+		configSources[name] = "${" + env + "}"
+	}
+	return v
 }
 
+// configSources records where readConfigValue found values, as the
+// configuration file reference to them, so that --print-config can refer
+// to credentials rather than inline them.
+var configSources = map[string]string{}
+
+const usage = `usage: bmc-shim [command] [flags]
+
+commands:
+  serve                         run the Redfish server (default)
+  check [--check-backends]      validate the configuration and exit
+  status [--system id]          print power state and name of systems
+  power on|off|restart --system id
+                                change the power state of a system
+  version                       print the version and build information
+
+Run "bmc-shim <command> -h" for the flags of a command.
+`
+
 func main() {
-	listen := flag.String("listen", ":8080", "address to listen on (e.g. :8080)")
-	user := flag.String("user", readConfigValue("user"), "basic auth username (or /etc/bmc-shim/user or BMC_SHIM_USER)")
-	pass := flag.String("pass", readConfigValue("pass"), "basic auth password (or /etc/bmc-shim/pass or BMC_SHIM_PASS)")
-	systemID := flag.String("system-id", "1", "Redfish system ID path segment (single-system mode)")
-	beKind := flag.String("backend", "noop", "backend kind: noop|command|homeassistant")
-	onCmd := flag.String("on-cmd", "", "command to execute for power ON (backend=command)")
-	offCmd := flag.String("off-cmd", "", "command to execute for power OFF (backend=command)")
-	haURL := flag.String("ha-url", readConfigValue("ha_url"), "Home Assistant base URL (backend=homeassistant)")
-	haToken := flag.String("ha-token", readConfigValue("ha_token"), "Home Assistant API token (backend=homeassistant or /etc/bmc-shim/ha_token or BMC_SHIM_HA_TOKEN)")
-	haEntity := flag.String("ha-entity", readConfigValue("ha_entity"), "Home Assistant entity_id (backend=homeassistant)")
-	haSystems := flag.String("systems", readConfigValue("ha_systems"), "Comma-separated list of id=entity_id for multi-system (backend=homeassistant)")
-	flag.Parse()
-
-	if *user == "" || *pass == "" {
-		log.Println("warning: no basic auth configured; use --user/--pass or BMC_SHIM_USER/BMC_SHIM_PASS")
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var code int
+	switch cmd {
+	case "serve":
+		code = runServe(args)
+	case "check":
+		code = runCheck(args)
+	case "status":
+		code = runStatus(args)
+	case "power":
+		code = runPower(args)
+	case "version":
+		fmt.Printf("bmc-shim %s\n", buildinfo.Get())
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		code = 2
+	}
+	os.Exit(code)
+}
+
+// backendFlags holds the flags that describe which backends to build.
+// They are shared by the serve command and the direct mode of the CLI commands.
+type backendFlags struct {
+	opts config.Options
+	// haClient is shared by the Home Assistant systems of every discovery
+	// run, so rediscovery does not open a new connection pool.
+	haClient *http.Client
+}
+
+// discoverTimeout bounds one Home Assistant discovery run.
+const discoverTimeout = 30 * time.Second
+
+func (f *backendFlags) register(fs *flag.FlagSet, defaultKind string) {
+	fs.StringVar(&f.opts.SystemID, "system-id", "1", "Redfish system ID path segment (single-system mode)")
+	fs.StringVar(&f.opts.Backend, "backend", defaultKind, "backend kind: noop|command|homeassistant|gce|ec2|hcloud|hetzner-robot|xapi|incus|cloud-vps|racadm|ipmi|nut|tasmota|zigbee2mqtt|smartplug|nomad|kubernetes")
+	fs.StringVar(&f.opts.OnCmd, "on-cmd", "", "command to execute for power ON (backend=command)")
+	fs.StringVar(&f.opts.OffCmd, "off-cmd", "", "command to execute for power OFF (backend=command)")
+	fs.StringVar(&f.opts.CommandShell, "command-shell", backend.DefaultShell().String(), "interpreter the commands of backend=command and poweron-hook are appended to, e.g. \"cmd /C\"")
+	fs.StringVar(&f.opts.HAURL, "ha-url", readConfigValue("ha_url"), "Home Assistant base URL (backend=homeassistant)")
+	fs.StringVar(&f.opts.HAToken, "ha-token", readConfigValue("ha_token"), "Home Assistant API token (backend=homeassistant or /etc/bmc-shim/ha_token or BMC_SHIM_HA_TOKEN)")
+	fs.StringVar(&f.opts.HATLSPin, "ha-tls-pin", readConfigValue("ha_tls_pin"), "trust only the Home Assistant certificate with this public key pin (sha256//BASE64), e.g. a self-signed one; \"check --check-backends\" prints the current pin (backend=homeassistant)")
+	fs.IntVar(&f.opts.HAMaxConns, "ha-max-conns", 8, "maximum connections to Home Assistant, shared by all systems; 0 for no limit (backend=homeassistant)")
+	fs.DurationVar(&f.opts.HAStatesMaxAge, "ha-states-max-age", 2*time.Second, "with several systems, how long one GET /api/states serves the state reads of all of them; 0 fetches each entity on its own (backend=homeassistant)")
+	fs.DurationVar(&f.opts.HAOptimisticWindow, "ha-optimistic-window", 0, "how long a system reports the state a successful power action asked for while Home Assistant still reports the old one; a different state reported twice in a row ends it early, 0 disables (backend=homeassistant)")
+	fs.StringVar(&f.opts.HAEntity, "ha-entity", readConfigValue("ha_entity"), "Home Assistant entity_id (backend=homeassistant)")
+	fs.StringVar(&f.opts.HAPowerEntity, "ha-power-entity", "", "Home Assistant sensor entity reporting power draw in W (backend=homeassistant)")
+	fs.StringVar(&f.opts.HAEnergyEntity, "ha-energy-entity", "", "Home Assistant sensor entity reporting energy in kWh (backend=homeassistant)")
+	fs.StringVar(&f.opts.HATemperatureEntities, "ha-temperature-entities", "", "comma-separated Home Assistant temperature sensor entities (backend=homeassistant)")
+	fs.StringVar(&f.opts.HAIndicatorEntity, "ha-indicator-entity", "", "Home Assistant light/switch entity used as IndicatorLED (backend=homeassistant)")
+	fs.StringVar(&f.opts.HADiscoverLabel, "ha-discover-label", "", "add every Home Assistant switch with this label (ID or name) as a system named after its object ID (backend=homeassistant)")
+	fs.StringVar(&f.opts.HADiscoverArea, "ha-discover-area", "", "add every Home Assistant switch in this area (ID or name) as a system; with --ha-discover-label, switches must match both (backend=homeassistant)")
+	fs.StringVar(&f.opts.GCECredentials, "gce-credentials", readConfigValue("gce_credentials"), "service account key file (backend=gce; default: application default credentials)")
+	fs.StringVar(&f.opts.GCEInstance, "gce-instance", "", "instance as project/zone/name (backend=gce)")
+	fs.DurationVar(&f.opts.GCEWait, "gce-wait", 0, "wait up to this long for start/stop operations to finish (backend=gce; 0 returns once accepted)")
+	fs.StringVar(&f.opts.GCEEndpoint, "gce-endpoint", "", "Compute API base URL override (backend=gce)")
+	fs.StringVar(&f.opts.AWSRegion, "aws-region", awsRegion(), "AWS region of the instances (backend=ec2; default AWS_REGION, AWS_DEFAULT_REGION or the region of the shared config profile)")
+	fs.StringVar(&f.opts.AWSEndpoint, "aws-endpoint", "", "EC2 endpoint URL override (backend=ec2)")
+	fs.StringVar(&f.opts.EC2Instance, "ec2-instance", "", "instance ID (backend=ec2)")
+	fs.StringVar(&f.opts.HCloudToken, "hcloud-token", hcloudToken(), "Hetzner Cloud API token (backend=hcloud; or /etc/bmc-shim/hcloud_token, BMC_SHIM_HCLOUD_TOKEN or HCLOUD_TOKEN)")
+	fs.StringVar(&f.opts.HCloudServer, "hcloud-server", "", "Hetzner Cloud server ID (backend=hcloud)")
+	fs.StringVar(&f.opts.HCloudEndpoint, "hcloud-endpoint", "", "Hetzner Cloud API base URL override (backend=hcloud)")
+	fs.StringVar(&f.opts.RobotUser, "robot-user", readConfigValue("robot_user"), "Hetzner Robot webservice user (backend=hetzner-robot; or /etc/bmc-shim/robot_user or BMC_SHIM_ROBOT_USER)")
+	fs.StringVar(&f.opts.RobotPass, "robot-pass", readConfigValue("robot_pass"), "Hetzner Robot webservice password (backend=hetzner-robot; or /etc/bmc-shim/robot_pass or BMC_SHIM_ROBOT_PASS)")
+	fs.StringVar(&f.opts.RobotServer, "robot-server", "", "Hetzner Robot server number (backend=hetzner-robot)")
+	fs.StringVar(&f.opts.RobotEndpoint, "robot-endpoint", "", "Hetzner Robot webservice base URL override (backend=hetzner-robot)")
+	fs.StringVar(&f.opts.XAPIURL, "xapi-url", readConfigValue("xapi_url"), "XenServer/XCP-ng pool master URL, e.g. https://xcp-master.lan (backend=xapi; or /etc/bmc-shim/xapi_url or BMC_SHIM_XAPI_URL)")
+	fs.StringVar(&f.opts.XAPIUser, "xapi-user", readConfigValue("xapi_user"), "XAPI user (backend=xapi; or /etc/bmc-shim/xapi_user or BMC_SHIM_XAPI_USER)")
+	fs.StringVar(&f.opts.XAPIPass, "xapi-pass", readConfigValue("xapi_pass"), "XAPI password (backend=xapi; or /etc/bmc-shim/xapi_pass or BMC_SHIM_XAPI_PASS)")
+	fs.BoolVar(&f.opts.XAPIInsecure, "xapi-insecure", false, "skip TLS certificate verification of the pool master (backend=xapi)")
+	fs.StringVar(&f.opts.XAPIVM, "xapi-vm", "", "VM UUID (backend=xapi)")
+	fs.StringVar(&f.opts.Incus.Socket, "incus-socket", "", "Incus/LXD unix socket (backend=incus; default: the first local socket found)")
+	fs.StringVar(&f.opts.Incus.URL, "incus-url", "", "Incus/LXD HTTPS URL, e.g. https://incus.lan:8443, instead of the local socket (backend=incus)")
+	fs.StringVar(&f.opts.Incus.ClientCert, "incus-client-cert", "", "PEM client certificate trusted by the Incus server (backend=incus with --incus-url)")
+	fs.StringVar(&f.opts.Incus.ClientKey, "incus-client-key", "", "PEM key of --incus-client-cert (backend=incus)")
+	fs.StringVar(&f.opts.Incus.ServerCert, "incus-server-cert", "", "PEM certificate or CA to verify the Incus server with (backend=incus; default: system roots)")
+	fs.StringVar(&f.opts.IncusInstance, "incus-instance", "", "instance as [project/]name (backend=incus)")
+	fs.StringVar(&f.opts.VPSProvider, "vps-provider", "", "cloud VPS provider: digitalocean|linode (backend=cloud-vps)")
+	fs.StringVar(&f.opts.VPSToken, "vps-token", readConfigValue("vps_token"), "provider API token (backend=cloud-vps; or /etc/bmc-shim/vps_token, BMC_SHIM_VPS_TOKEN, DIGITALOCEAN_TOKEN or LINODE_TOKEN)")
+	fs.StringVar(&f.opts.VPSInstance, "vps-instance", "", "droplet or Linode instance ID (backend=cloud-vps)")
+	fs.StringVar(&f.opts.VPSEndpoint, "vps-endpoint", "", "provider API base URL override (backend=cloud-vps)")
+	fs.StringVar(&f.opts.Racadm.Mode, "racadm-mode", "local", "how racadm reaches the iDRAC: local|remote|ssh (backend=racadm)")
+	fs.StringVar(&f.opts.Racadm.User, "racadm-user", readConfigValue("racadm_user"), "iDRAC user (backend=racadm; or /etc/bmc-shim/racadm_user or BMC_SHIM_RACADM_USER)")
+	fs.StringVar(&f.opts.Racadm.Binary, "racadm-binary", "racadm", "racadm executable (backend=racadm)")
+	fs.StringVar(&f.opts.RacadmHost, "racadm-host", "", "iDRAC host for remote and ssh modes (backend=racadm)")
+	f.opts.Racadm.Password = racadmPassword()
+	fs.StringVar(&f.opts.IPMI.Interface, "ipmi-interface", "lanplus", "ipmitool interface, e.g. lanplus or lan (backend=ipmi)")
+	fs.StringVar(&f.opts.IPMI.User, "ipmi-user", readConfigValue("ipmi_user"), "BMC user (backend=ipmi; or /etc/bmc-shim/ipmi_user or BMC_SHIM_IPMI_USER)")
+	fs.StringVar(&f.opts.IPMI.Binary, "ipmi-binary", "ipmitool", "ipmitool executable (backend=ipmi)")
+	fs.StringVar(&f.opts.IPMIHost, "ipmi-host", "", "BMC host (backend=ipmi)")
+	fs.StringVar(&f.opts.IPMIQuirks, "ipmi-quirks", "", "vendor quirks of BMCs without a quirks option: "+strings.Join(backend.IPMIQuirks(), "|")+" (backend=ipmi)")
+	f.opts.IPMI.Password = ipmiPassword()
+	fs.StringVar(&f.opts.NUTAddr, "nut-addr", readConfigValue("nut_addr"), "upsd address as host[:port] (backend=nut; or /etc/bmc-shim/nut_addr or BMC_SHIM_NUT_ADDR)")
+	fs.StringVar(&f.opts.NUTUPS, "nut-ups", "", "UPS name as configured in ups.conf (backend=nut)")
+	fs.StringVar(&f.opts.NUTOutlet, "nut-outlet", "", "outlet number (backend=nut)")
+	f.opts.NUTUser = readConfigValue("nut_user")
+	f.opts.NUTPass = readConfigValue("nut_pass")
+	fs.StringVar(&f.opts.TasmotaDevice, "tasmota-device", "", "device URL with optional relay index, e.g. http://plug.lan:2 (backend=tasmota)")
+	fs.StringVar(&f.opts.TasmotaUser, "tasmota-user", "admin", "Tasmota web admin user (backend=tasmota)")
+	fs.StringVar(&f.opts.TasmotaPass, "tasmota-pass", readConfigValue("tasmota_pass"), "Tasmota web password (backend=tasmota; or /etc/bmc-shim/tasmota_pass or BMC_SHIM_TASMOTA_PASS)")
+	fs.DurationVar(&f.opts.TasmotaCycle, "tasmota-cycle", 0, "off time of a native PowerCycle run on the device; 0 disables PowerCycle (backend=tasmota)")
+	fs.StringVar(&f.opts.Z2MBroker, "z2m-broker", readConfigValue("z2m_broker"), "MQTT broker Zigbee2MQTT publishes to, as mqtt://host[:1883] or mqtts://host[:8883] (backend=zigbee2mqtt; or /etc/bmc-shim/z2m_broker or BMC_SHIM_Z2M_BROKER)")
+	fs.StringVar(&f.opts.Z2MUser, "z2m-user", readConfigValue("z2m_user"), "MQTT user (backend=zigbee2mqtt; or /etc/bmc-shim/z2m_user or BMC_SHIM_Z2M_USER)")
+	fs.StringVar(&f.opts.Z2MPass, "z2m-pass", readConfigValue("z2m_pass"), "MQTT password (backend=zigbee2mqtt; or /etc/bmc-shim/z2m_pass or BMC_SHIM_Z2M_PASS)")
+	fs.StringVar(&f.opts.Z2MBaseTopic, "z2m-base-topic", backend.Zigbee2MQTTBaseTopic, "Zigbee2MQTT base_topic; a system's base option overrides it (backend=zigbee2mqtt)")
+	fs.StringVar(&f.opts.Z2MDevice, "z2m-device", "", "device friendly name (backend=zigbee2mqtt)")
+	fs.StringVar(&f.opts.SmartPlugDevice, "smartplug-device", "", "plug as meross:<host> or tuya:<host>; set key, device, version and channel in --system-options (backend=smartplug)")
+	fs.StringVar(&f.opts.NomadAddr, "nomad-addr", "", "Nomad HTTP API address (backend=nomad; default NOMAD_ADDR or http://127.0.0.1:4646)")
+	fs.StringVar(&f.opts.NomadToken, "nomad-token", readConfigValue("nomad_token"), "Nomad ACL token (backend=nomad; or /etc/bmc-shim/nomad_token, BMC_SHIM_NOMAD_TOKEN or NOMAD_TOKEN)")
+	fs.StringVar(&f.opts.NomadRegion, "nomad-region", "", "Nomad region (backend=nomad; default NOMAD_REGION)")
+	fs.StringVar(&f.opts.NomadNamespace, "nomad-namespace", "", "Nomad namespace (backend=nomad; default NOMAD_NAMESPACE)")
+	fs.IntVar(&f.opts.NomadCount, "nomad-count", 1, "count a job/group target is scaled to on power on (backend=nomad)")
+	fs.StringVar(&f.opts.NomadJob, "nomad-job", "", "job ID, or job/group to scale a task group (backend=nomad)")
+	fs.StringVar(&f.opts.Kubeconfig, "kubeconfig", "", "kubeconfig file whose current context is used (backend=kubernetes; default: the in-cluster service account)")
+	fs.StringVar(&f.opts.K8sNamespace, "k8s-namespace", "", "namespace of targets without one (backend=kubernetes; default: that of the context or the pod)")
+	fs.StringVar(&f.opts.K8sWorkload, "k8s-workload", "", "[namespace/]deployment|statefulset/name of the single system (backend=kubernetes)")
+	fs.StringVar(&f.opts.Systems, "systems", readConfigValue("ha_systems"), "Comma-separated list of id=target[;key=value...] for multi-system, where target is an entity_id (backend=homeassistant), project/zone/name (backend=gce), instance ID (backend=ec2) server ID/number (backend=hcloud, hetzner-robot), VM UUID (backend=xapi), [project/]name (backend=incus), droplet/instance ID (backend=cloud-vps), iDRAC host (backend=racadm), BMC host (backend=ipmi), outlet number (backend=nut), url[:relay] (backend=tasmota), friendly name (backend=zigbee2mqtt), meross:<host>/tuya:<host> (backend=smartplug) job[/group] (backend=nomad) or [namespace/]kind/name (backend=kubernetes)")
+	fs.StringVar(&f.opts.SystemOptions, "system-options", "", "semicolon-separated key=value options for the single system, e.g. name=Node 1;model=NUC (keys: name, description, manufacturer, model, serial, uuid, mac, boot, cpus, cpu, memory, disk, reset, stability, wol, poweron-hook, hook-delay, hook-retries, hook-strict, device, key, version, channel, quirks, critical)")
+	fs.IntVar(&f.opts.BackendRetries, "backend-retries", 0, "how many times a failed backend read (state, name, health, metrics) is retried; power actions and settings are never retried")
+	fs.DurationVar(&f.opts.BackendRetryBackoff, "backend-retry-backoff", 500*time.Millisecond, "wait before the first retry of a backend read, doubled for each further one")
+	fs.IntVar(&f.opts.BackendBreakerFailures, "backend-breaker-failures", 0, "open the circuit breaker of a system after this many consecutive failed backend calls, failing its calls at once with 503 for --backend-breaker-cooldown; 0 disables")
+	fs.DurationVar(&f.opts.BackendBreakerCooldown, "backend-breaker-cooldown", 30*time.Second, "how long an open circuit breaker fails calls before it lets one through to probe the backend")
+	fs.DurationVar(&f.opts.BackendCallTimeout, "backend-call-timeout", 0, "maximum time a single backend call, including a whole reset, may take; 0: only --backend-timeout applies")
+	fs.BoolVar(&f.opts.LogBackendCalls, "log-backend-calls", false, "log every backend call with its outcome and duration")
+}
+
+// awsRegion returns the region from the environment like the AWS SDKs.
+func awsRegion() string {
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// hcloudToken falls back to the variable the hcloud CLI uses.
+func hcloudToken() string {
+	if t := readConfigValue("hcloud_token"); t != "" {
+		return t
 	}
+	return os.Getenv("HCLOUD_TOKEN")
+}
+
+// racadmPassword reads the iDRAC password from /etc/bmc-shim/racadm_password,
+// BMC_SHIM_RACADM_PASSWORD or RACADM_PASSWORD. There is deliberately no
+// flag, which would show up in the process list.
+func racadmPassword() string {
+	if p := readConfigValue("racadm_password"); p != "" {
+		return p
+	}
+	return os.Getenv("RACADM_PASSWORD")
+}
+
+// ipmiPassword reads the BMC password from /etc/bmc-shim/ipmi_password,
+// BMC_SHIM_IPMI_PASSWORD or ipmitool's IPMI_PASSWORD, with no flag for
+// the same reason as racadmPassword.
+func ipmiPassword() string {
+	if p := readConfigValue("ipmi_password"); p != "" {
+		return p
+	}
+	return os.Getenv("IPMI_PASSWORD")
+}
 
-	systems := map[string]backend.Backend{}
-	var be backend.Backend
-	var err error
-	switch *beKind {
-	case "noop":
-		be = backend.NewNoop()
-		systems[*systemID] = be
-	case "command":
-		be, err = backend.NewCommand(*onCmd, *offCmd)
+func (f *backendFlags) kind() string {
+	return f.opts.Backend
+}
+
+func (f *backendFlags) build() ([]config.System, error) {
+	if !f.opts.Discovering() {
+		return config.Build(f.opts)
+	}
+	if f.haClient == nil {
+		client, err := backend.NewHAHTTPClient(f.opts.HAMaxConns, f.opts.HATLSPin)
 		if err != nil {
-			log.Fatalf("backend init: %v", err)
-		}
-		systems[*systemID] = be
-	case "homeassistant":
-		if *haSystems != "" {
-			// parse id=entity,id=entity
-			entries := strings.Split(*haSystems, ",")
-			for _, e := range entries {
-				e = strings.TrimSpace(e)
-				if e == "" {
-					continue
-				}
-				parts := strings.SplitN(e, "=", 2)
-				if len(parts) != 2 {
-					log.Fatalf("invalid systems entry: %q (expected id=entity)", e)
-				}
-				id := strings.TrimSpace(parts[0])
-				entity := strings.TrimSpace(parts[1])
-				b, berr := backend.NewHomeAssistant(*haURL, *haToken, entity)
-				if berr != nil {
-					log.Fatalf("backend init (%s): %v", id, berr)
-				}
-				systems[id] = b
-			}
-			if len(systems) == 0 {
-				log.Fatalf("no valid systems parsed from --systems")
+			return nil, err
+		}
+		f.haClient = client
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+	return config.Discover(ctx, f.opts, f.haClient)
+}
+
+// logDiscovered lists the systems found by Home Assistant discovery.
+func logDiscovered(systems []config.System) {
+	var found []string
+	for _, sys := range systems {
+		if sys.Discovered {
+			found = append(found, sys.ID+"="+sys.Target)
+		}
+	}
+	if len(found) == 0 {
+		log.Printf("warning: Home Assistant discovery found no matching switch entities")
+		return
+	}
+	log.Printf("discovered %d Home Assistant systems: %s", len(found), strings.Join(found, ", "))
+}
+
+// listFlag is a repeatable string flag. The first use replaces the default.
+type listFlag struct {
+	values []string
+	set    bool
+}
+
+func (f *listFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	if !f.set {
+		f.values, f.set = nil, true
+	}
+	f.values = append(f.values, v)
+	return nil
+}
+
+// jsonFlag is a flag taking a JSON object, which the configuration file
+// may also give as an object.
+type jsonFlag struct {
+	value string
+}
+
+func (f *jsonFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *jsonFlag) Set(v string) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v), &m); err != nil {
+		return errors.New("expected a JSON object")
+	}
+	f.value = v
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty elements.
+// It never returns nil.
+func splitList(v string) []string {
+	out := []string{}
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// acmeConfig validates the ACME flags against the TLS and listen flags and
+// returns the ACME configuration, or nil if ACME is not used.
+func acmeConfig(listen, domains []string, cacheDir, directory, email string, acceptTOS bool, tlsCert, tlsKey string) (*acme.Config, error) {
+	if (tlsCert == "") != (tlsKey == "") {
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	}
+	if len(domains) == 0 {
+		if cacheDir != "" || email != "" || directory != acme.LetsEncrypt || acceptTOS {
+			return nil, errors.New("--acme-cache-dir, --acme-email, --acme-directory and --acme-accept-tos require --acme-domain")
+		}
+		return nil, nil
+	}
+	if cacheDir == "" {
+		return nil, errors.New("--acme-domain requires --acme-cache-dir")
+	}
+	if !acceptTOS {
+		return nil, fmt.Errorf("--acme-domain requires --acme-accept-tos: registering with %s means agreeing to its terms of service", directory)
+	}
+	https := false
+	for _, l := range listen {
+		if addr, ok := strings.CutPrefix(strings.ToLower(l), "https://"); ok {
+			https = true
+			if _, port, err := net.SplitHostPort(addr); err != nil || port != "443" {
+				log.Printf("warning: ACME validates TLS-ALPN-01 on port 443; make sure %s is reachable there", l)
 			}
-		} else {
-			b, berr := backend.NewHomeAssistant(*haURL, *haToken, *haEntity)
-			if berr != nil {
-				log.Fatalf("backend init: %v", berr)
+		}
+	}
+	if !https {
+		return nil, errors.New("--acme-domain requires an https:// listener")
+	}
+	if tlsCert != "" {
+		log.Printf("serving %s until an ACME certificate is issued", tlsCert)
+	}
+	return &acme.Config{Domains: domains, CacheDir: cacheDir, DirectoryURL: directory, Email: email, AcceptTOS: acceptTOS}, nil
+}
+
+// compatFlag validates --compat and maps the deprecated
+// --legacy-action-response to the legacy profile.
+func compatFlag(compat string, legacyActions bool) (string, error) {
+	if _, err := server.ParseCompat(compat); err != nil {
+		return "", fmt.Errorf("--compat: %w", err)
+	}
+	if !legacyActions {
+		return compat, nil
+	}
+	if compat != server.CompatStrict && compat != server.CompatLegacy {
+		return "", fmt.Errorf("--legacy-action-response conflicts with --compat=%s", compat)
+	}
+	log.Println("warning: --legacy-action-response is deprecated; use --compat=legacy")
+	return server.CompatLegacy, nil
+}
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := &listFlag{values: []string{":8080"}}
+	fs.Var(listen, "listen", "address to listen on, optionally with a scheme (e.g. :8080, http://:8080, https://:8443); may be repeated")
+	tlsCert := fs.String("tls-cert", "", "PEM certificate file for https listeners")
+	tlsKey := fs.String("tls-key", "", "PEM private key file for https listeners")
+	var acmeDomains listFlag
+	fs.Var(&acmeDomains, "acme-domain", "DNS name to obtain a certificate for from an ACME CA (TLS-ALPN-01 on the https listener); may be repeated")
+	acmeCacheDir := fs.String("acme-cache-dir", "", "directory keeping the ACME account key and certificates (required with --acme-domain)")
+	acmeDirectory := fs.String("acme-directory", acme.LetsEncrypt, "ACME directory URL, e.g. the Let's Encrypt staging one for testing")
+	acmeEmail := fs.String("acme-email", "", "contact address of the ACME account for expiry notices")
+	acmeAcceptTOS := fs.Bool("acme-accept-tos", false, "agree to the terms of service of the ACME CA (required with --acme-domain; the URL is logged on registration)")
+	user := fs.String("user", readConfigValue("user"), "basic auth username (or /etc/bmc-shim/user or BMC_SHIM_USER)")
+	pass := fs.String("pass", readConfigValue("pass"), "basic auth password (or /etc/bmc-shim/pass or BMC_SHIM_PASS)")
+	var apiKeys listFlag
+	fs.Var(&apiKeys, "api-key", `API key accepted in X-Api-Key or "Authorization: Bearer", as "key [name [role [systems]]]" with role reader or operator (default); may be repeated`)
+	apiKeyFile := fs.String("api-key-file", "", "file with one API key per line in the --api-key format; re-read on SIGHUP")
+	usersFile := fs.String("users-file", "", `file of basic auth users, one "name password [role [systems]]" per line (systems: comma-separated IDs or * for all); re-read on SIGHUP`)
+	outOfScope := fs.Int("out-of-scope-status", http.StatusNotFound, "status for requests to systems outside the client's scope: 404 (hides them) or 403")
+	oidcIssuer := fs.String("oidc-issuer", "", "OpenID Connect issuer URL whose bearer tokens (JWTs) are accepted, e.g. https://keycloak.example.com/realms/lab")
+	oidcAudience := fs.String("oidc-audience", "", "audience (client ID) the tokens must be issued for; required with --oidc-issuer")
+	oidcRoleClaim := fs.String("oidc-role-claim", "groups", "token claim with the client's groups or roles, as a dotted path (e.g. realm_access.roles)")
+	oidcOperators := fs.String("oidc-operator-values", "", "comma-separated --oidc-role-claim values granting the operator role")
+	oidcReaders := fs.String("oidc-reader-values", "", "comma-separated --oidc-role-claim values granting the reader role (with neither set, every valid token is an operator)")
+	authMode := fs.String("auth-mode", "", "accepted credentials: basic (basic auth and API keys), oidc (tokens only) or oidc+basic (default: basic, or oidc+basic with --oidc-issuer)")
+	showVersion := fs.Bool("version", false, "print the version and build information and exit")
+	checkConfig := fs.Bool("check-config", false, "validate the configuration, print a per-system summary and exit")
+	checkBackends := fs.Bool("check-backends", false, "with --check-config, also ping each backend")
+	configFile := fs.String("config", "", "YAML (or JSON) file of flag names and values, with ${ENV} and \"!file <path>\" references; command-line flags win")
+	printSchema := fs.Bool("config-schema", false, "print the JSON Schema of the --config file and exit")
+	printConfig := fs.Bool("print-config", false, "print the YAML --config file equivalent to the other flags, environment and /etc/bmc-shim files, with credentials as ${ENV} or !file references, and exit")
+	writeConfig := fs.String("write-config", "", "like --print-config, but write the file to this path, which must not exist yet")
+	stateFile := fs.String("state-file", "", "path of a JSON file persisting settings written through the API (e.g. AssetTag, HostName)")
+	historyFile := fs.String("history-file", "", "path of the power history file exported by /admin/history (default <state-file>.history; in memory without --state-file)")
+	historyRetention := fs.Duration("history-retention", server.DefaultHistoryRetention, "how long the history file keeps power actions and transitions (0 keeps them all)")
+	language := fs.String("language", server.DefaultLanguage, "language of Name/Description strings and error messages for clients whose Accept-Language names no available one (built in: en, de)")
+	languageDir := fs.String("language-dir", "", "directory of additional <language>.json message catalogs")
+	captureDir := fs.String("capture-dir", "", "debugging: write every request/response pair, with credentials redacted, as a numbered JSON file to this directory (default disabled)")
+	captureMaxFiles := fs.Int("capture-max-files", server.DefaultCaptureMaxFiles, "number of exchanges --capture-dir captures before capturing stops")
+	logBodyBytes := fs.Int("log-body-bytes", server.DefaultLogBodyBytes, "how much of each JSON request body the access log shows (0 leaves bodies out)")
+	logEntries := fs.Int("log-entries", 100, "number of events kept per system in the Redfish LogService")
+	sseMaxConns := fs.Int("sse-max-connections", server.DefaultSSEMaxConnections, "maximum number of open event streams (/redfish/v1/EventService/SSE)")
+	compat := fs.String("compat", server.CompatStrict, "response compatibility profile for clients expecting non-standard responses: strict|idrac-ish|legacy")
+	schemaValidation := fs.String("schema-validation", server.SchemaStrict, "what to do with PATCH bodies that violate the Redfish schema: strict (reject with 400)|warn (log and go on)|off")
+	legacyBootPOST := fs.Bool("legacy-boot-post", false, "accept a POST of only a Boot object to /redfish/v1/Systems/{id} as the equivalent PATCH, for old fencing scripts (default: 405)")
+	legacyActions := fs.Bool("legacy-action-response", false, "deprecated: same as --compat=legacy")
+	publicPaths := fs.String("public-paths", strings.Join(server.DefaultPublicPaths, ","), "comma-separated exact paths served without authentication (empty: none)")
+	healthAuthRemote := fs.Bool("health-auth-remote", false, "require authentication on /livez, /readyz and /startupz for non-localhost callers")
+	trustedProxies := fs.String("trusted-proxies", "", "comma-separated CIDRs of reverse proxies whose Forwarded/X-Forwarded-For/X-Real-IP headers are trusted")
+	var allowCIDRs listFlag
+	fs.Var(&allowCIDRs, "allow-cidr", "CIDR or IP allowed to make POST/PATCH/DELETE requests; may be repeated (default: any)")
+	allowCIDRRead := fs.Bool("allow-cidr-read", false, "apply --allow-cidr to reads as well (except the health endpoints)")
+	debugListen := fs.String("debug-listen", "", "separate address serving pprof, expvar and /debug/state without auth, e.g. 127.0.0.1:6060 (default disabled)")
+	debugOnMain := fs.Bool("debug-on-main", false, "serve the debug endpoints on the main listeners instead (requires --user/--pass)")
+	pollInterval := fs.Duration("poll-interval", 30*time.Second, "how often to refresh power state and health of every system in the background (0 disables)")
+	stateStability := fs.String("state-stability", "", "serve a power state change reported by a backend only once it was reported by this many consecutive polls (e.g. 3) or for this long (e.g. 90s); empty serves changes at once")
+	metricsLiveState := fs.Bool("metrics-live-state", false, "query the backends on every /metrics scrape instead of reporting cached states")
+	advertise := fs.Bool("advertise", false, "announce the service via SSDP and mDNS (_redfish._tcp)")
+	advertiseIfaces := fs.String("advertise-interfaces", "", "comma-separated interfaces to advertise on (default: all multicast-capable)")
+	urlPrefix := fs.String("url-prefix", "", "path the service is mounted under behind a reverse proxy, e.g. /bmc/node3; stripped from requests and added to every link (X-Forwarded-Prefix from --trusted-proxies overrides it)")
+	externalURL := fs.String("external-url", "", "base URL clients reach the service at, announced instead of the listener address (e.g. https://bmc.example.com or http://[2001:db8::10]:8080)")
+	managerIfaces := fs.String("manager-interfaces", "", "comma-separated host interfaces listed as the manager's EthernetInterfaces, or none (default: all but loopback)")
+	var notifyURLs listFlag
+	fs.Var(&notifyURLs, "notify-url", "webhook URL receiving a JSON POST on every power state change; may be repeated")
+	notifyTemplate := fs.String("notify-template", "", `Go template for the notification body, e.g. {"text": {{printf "%s is %s" .System .NewState | json}}} (default: JSON with system, old_state, new_state, initiator, timestamp)`)
+	notifyVerify := fs.Bool("notify-verify", false, "send a test notification to every --notify-url at startup and refuse to start if one is not accepted")
+	notifyTimeout := fs.Duration("notify-timeout", 10*time.Second, "timeout of a single notification delivery attempt")
+	reassert := fs.Bool("reassert-power-state", false, "call the backend for On/Off even when the system already is in the requested state")
+	actionCooldown := fs.Duration("action-cooldown", 0, "minimum interval between power actions on a system; requests inside it get 429 unless the system is already in the requested state (0 disables)")
+	powerOnStagger := fs.Duration("poweron-stagger", 0, "minimum interval between the starts of resets that power systems on, across all systems (0 disables)")
+	powerOnConcurrency := fs.Int("poweron-concurrency", 0, "maximum number of resets powering systems on at once (0: no limit)")
+	powerOnMaxWait := fs.Duration("poweron-max-wait", server.DefaultPowerOnMaxWait, "how long a power-on waits for its turn under --poweron-stagger/--poweron-concurrency before it is answered with 503")
+	dryRun := fs.Bool("dry-run", false, "log and record power actions without calling the backends (per system: dryrun=true)")
+	readOnly := fs.Bool("read-only", false, "start in read-only (maintenance) mode: reject POST/PATCH/DELETE with 503; SIGUSR1 toggles it at runtime")
+	unknownStateActions := fs.Bool("allow-unknown-state-actions", false, "allow power actions on systems whose backend reports their power state as unknown, e.g. an unavailable Home Assistant entity (default: refuse with 503)")
+	readyPolicy := fs.String("ready-policy", server.ReadyCritical, "which systems /readyz requires to pass their health check: critical (those with critical=true, or any if there are none)|any|all")
+	ui := fs.Bool("ui", false, "serve an HTML status page at /ui with power buttons for operators (default: API only)")
+	var systemOverrides jsonFlag
+	fs.Var(&systemOverrides, "system-overrides", `JSON object of system IDs to static ComputerSystem properties replacing the reported ones, e.g. {"1": {"BiosVersion": "2.1.0", "SystemType": "Physical"}}`)
+	hideBackendOem := fs.Bool("hide-backend-oem", false, "omit backend details (entity IDs, commands, backend errors) from Oem.BmcShim of Systems and Chassis")
+	backendTimeout := fs.Duration("backend-timeout", server.DefaultBackendTimeout, "maximum time the backend calls of a power action or PATCH may take")
+	cacheTTL := fs.Duration("cache-ttl", server.DefaultCacheTTL, "how long backend reads (power state, name, health, metrics) answering GETs are cached; power actions and the poller always read fresh (0: no caching)")
+	cacheMaxStale := fs.Duration("cache-max-stale", server.DefaultCacheMaxStale, "how old a cached name, metric or backend detail may be to be served when the backend fails (0: never)")
+	backendStartTimeout := fs.Duration("backend-start-timeout", server.DefaultBackendStartTimeout, "maximum time each attempt to connect a backend (nut, xapi) at startup may take")
+	readTimeout := fs.Duration("read-timeout", server.DefaultReadTimeout, "maximum time to read a request, including its body (0 disables)")
+	writeTimeout := fs.Duration("write-timeout", 0, "maximum time to answer a request (default and minimum: --backend-timeout plus 5s)")
+	idleTimeout := fs.Duration("idle-timeout", server.DefaultIdleTimeout, "how long an idle keep-alive connection is kept open (0: use --read-timeout)")
+	maxHeaderBytes := fs.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "maximum size of request headers in bytes")
+	nameSource := fs.String("name-source", "config", "which system name wins when both are set: config|backend")
+	profile := fs.String("profile", "", "adapt the service to a client and check at startup that the configuration suits it: metal3 (Ironic's redfish driver)")
+	discoverInterval := fs.Duration("ha-discover-interval", 0, "how often to repeat the Home Assistant discovery (0: only at startup and on SIGHUP)")
+	var bf backendFlags
+	bf.register(fs, "noop")
+	_ = fs.Parse(args)
+
+	if *showVersion {
+		fmt.Printf("bmc-shim %s\n", buildinfo.Get())
+		return 0
+	}
+	if *printSchema {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(configSchema(fs))
+		return 0
+	}
+	if *configFile != "" {
+		if err := loadConfigFile(fs, *configFile); err != nil {
+			if *checkConfig {
+				fmt.Fprintf(os.Stderr, "config invalid: %v\n", err)
+				return 1
 			}
-			systems[*systemID] = b
+			log.Fatalf("%v", err)
+		}
+	}
+	if *printConfig || *writeConfig != "" {
+		return migrateConfig(fs, &bf, *writeConfig)
+	}
+	if *checkConfig {
+		return check(&bf, *checkBackends, false)
+	}
+
+	var oidc *server.OIDCConfig
+	if *oidcIssuer != "" {
+		if *oidcAudience == "" {
+			log.Fatalf("--oidc-issuer requires --oidc-audience")
+		}
+		oidc = &server.OIDCConfig{
+			Issuer:         *oidcIssuer,
+			Audience:       *oidcAudience,
+			RoleClaim:      *oidcRoleClaim,
+			OperatorValues: splitList(*oidcOperators),
+			ReaderValues:   splitList(*oidcReaders),
+		}
+	}
+	switch *authMode {
+	case "", server.AuthModeBasic:
+	case server.AuthModeOIDC, server.AuthModeOIDCBasic:
+		if oidc == nil {
+			log.Fatalf("--auth-mode %s requires --oidc-issuer", *authMode)
 		}
 	default:
-		log.Fatalf("unknown backend: %s", *beKind)
+		log.Fatalf("invalid --auth-mode %q (expected basic, oidc or oidc+basic)", *authMode)
+	}
+	if *authMode == server.AuthModeBasic && oidc != nil {
+		log.Println("warning: --oidc-issuer is ignored with --auth-mode basic")
+		oidc = nil
+	}
+
+	noAuth := (*user == "" || *pass == "") && *usersFile == "" && len(apiKeys.values) == 0 && *apiKeyFile == "" && oidc == nil
+	if noAuth {
+		log.Println("warning: no basic auth configured; use --user/--pass or BMC_SHIM_USER/BMC_SHIM_PASS")
+	}
+
+	if *debugOnMain && noAuth {
+		log.Fatalf("--debug-on-main requires authentication (--user/--pass or API keys)")
+	}
+	if *outOfScope != http.StatusNotFound && *outOfScope != http.StatusForbidden {
+		log.Fatalf("invalid --out-of-scope-status %d (expected 404 or 403)", *outOfScope)
+	}
+
+	for name, d := range map[string]time.Duration{"backend-timeout": *backendTimeout, "backend-start-timeout": *backendStartTimeout, "read-timeout": *readTimeout, "write-timeout": *writeTimeout, "idle-timeout": *idleTimeout, "poweron-stagger": *powerOnStagger} {
+		if d < 0 {
+			log.Fatalf("invalid --%s %s: must not be negative", name, d)
+		}
+	}
+	if *powerOnConcurrency < 0 {
+		log.Fatalf("invalid --poweron-concurrency %d: must not be negative", *powerOnConcurrency)
+	}
+	if *powerOnMaxWait <= 0 {
+		log.Fatalf("invalid --poweron-max-wait %s: must be positive", *powerOnMaxWait)
+	}
+	if *backendTimeout == 0 {
+		log.Fatalf("invalid --backend-timeout 0: must be positive")
+	}
+	if *maxHeaderBytes < 1024 {
+		log.Fatalf("invalid --max-header-bytes %d: must be at least 1024", *maxHeaderBytes)
+	}
+	if *readTimeout > 0 && *idleTimeout == 0 {
+		log.Printf("warning: --idle-timeout 0 falls back to --read-timeout %s for keep-alive connections", *readTimeout)
+	}
+
+	var keys []server.APIKey
+	for _, v := range apiKeys.values {
+		k, err := server.ParseAPIKey(v)
+		if err != nil {
+			log.Fatalf("--api-key: %v", err)
+		}
+		keys = append(keys, k)
+	}
+
+	if *nameSource != "config" && *nameSource != "backend" {
+		log.Fatalf("invalid --name-source %q (expected config or backend)", *nameSource)
+	}
+
+	stability, err := server.ParseStability(*stateStability)
+	if err != nil {
+		log.Fatalf("--state-stability: %v", err)
+	}
+	if _, err := server.ParseSchemaValidation(*schemaValidation); err != nil {
+		log.Fatalf("--schema-validation: %v", err)
+	}
+	if _, err := server.ParseReadyPolicy(*readyPolicy); err != nil {
+		log.Fatalf("--ready-policy: %v", err)
+	}
+	if *compat, err = compatFlag(*compat, *legacyActions); err != nil {
+		log.Fatalf("%v", err)
+	}
+	overrides, err := server.ParseSystemOverrides(systemOverrides.value)
+	if err != nil {
+		log.Fatalf("--system-overrides: %v", err)
+	}
+	if *profile != "" && *profile != server.ProfileMetal3 {
+		log.Fatalf("invalid --profile %q (expected metal3)", *profile)
+	}
+
+	if *discoverInterval < 0 {
+		log.Fatalf("--ha-discover-interval must not be negative")
+	}
+	if *discoverInterval > 0 && !bf.opts.Discovering() {
+		log.Fatalf("--ha-discover-interval requires --ha-discover-label or --ha-discover-area")
+	}
+	backendCalls := server.NewBackendCalls()
+	bf.opts.Metrics = backendCalls.Observer
+	systems, err := bf.build()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if bf.opts.Discovering() {
+		logDiscovered(systems)
+	}
+	if *profile == server.ProfileMetal3 {
+		warnings, err := checkMetal3(systems, listen.values, *externalURL, *compat)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		for _, w := range warnings {
+			log.Printf("warning: metal3 profile: %s", w)
+		}
+	}
+	proxies, err := server.ParseTrustedProxies(splitList(*trustedProxies))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *externalURL != "" {
+		if *externalURL, err = server.ParseExternalURL(*externalURL); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *urlPrefix, err = server.ParseURLPrefix(*urlPrefix); err != nil {
+		log.Fatalf("%v", err)
+	}
+	acmeCfg, err := acmeConfig(listen.values, acmeDomains.values, *acmeCacheDir, *acmeDirectory, *acmeEmail, *acmeAcceptTOS, *tlsCert, *tlsKey)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	allowed, err := server.ParseAllowCIDRs(allowCIDRs.values)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *allowCIDRRead && len(allowed) == 0 {
+		log.Fatalf("--allow-cidr-read requires --allow-cidr")
+	}
+	var tmpl *template.Template
+	if *notifyTemplate != "" {
+		if tmpl, err = server.ParseNotifyTemplate(*notifyTemplate); err != nil {
+			log.Fatalf("%v", err)
+		}
 	}
 
 	srv := server.New(server.Config{
-		Listen:   *listen,
-		Username: *user,
-		Password: *pass,
-		Systems:  systems,
+		Listen:                listen.values,
+		TLSCert:               *tlsCert,
+		TLSKey:                *tlsKey,
+		ACME:                  acmeCfg,
+		Username:              *user,
+		Password:              *pass,
+		Systems:               config.Backends(systems),
+		Info:                  config.Infos(systems),
+		PreferBackendName:     *nameSource == "backend",
+		StateFile:             *stateFile,
+		LogEntries:            *logEntries,
+		SSEMaxConnections:     *sseMaxConns,
+		Compat:                *compat,
+		Profile:               *profile,
+		PublicPaths:           splitList(*publicPaths),
+		HealthAuthRemote:      *healthAuthRemote,
+		TrustedProxies:        proxies,
+		DebugListen:           *debugListen,
+		DebugOnMain:           *debugOnMain,
+		PollInterval:          *pollInterval,
+		StateStability:        stability,
+		MetricsLiveState:      *metricsLiveState,
+		BackendCalls:          backendCalls,
+		NotifyURLs:            notifyURLs.values,
+		NotifyTemplate:        tmpl,
+		NotifyTimeout:         *notifyTimeout,
+		ReassertPowerState:    *reassert,
+		ActionCooldown:        *actionCooldown,
+		PowerOnStagger:        *powerOnStagger,
+		PowerOnConcurrency:    *powerOnConcurrency,
+		PowerOnMaxWait:        *powerOnMaxWait,
+		DryRun:                *dryRun,
+		ReadOnly:              *readOnly,
+		Advertise:             *advertise,
+		AdvertiseInterfaces:   splitList(*advertiseIfaces),
+		ExternalURL:           *externalURL,
+		URLPrefix:             *urlPrefix,
+		ManagerInterfaces:     splitList(*managerIfaces),
+		HideManagerInterfaces: *managerIfaces == "none",
+		UI:                    *ui,
+		SystemOverrides:       overrides,
+		HideBackendOem:        *hideBackendOem,
+		UnknownStateActions:   *unknownStateActions,
+		ReadyPolicy:           *readyPolicy,
+		LegacyBootPOST:        *legacyBootPOST,
+		SchemaValidation:      *schemaValidation,
+		BackendTimeout:        *backendTimeout,
+		BackendStartTimeout:   *backendStartTimeout,
+		CacheTTL:              *cacheTTL,
+		CacheMaxStale:         *cacheMaxStale,
+		ReadTimeout:           *readTimeout,
+		WriteTimeout:          *writeTimeout,
+		IdleTimeout:           *idleTimeout,
+		MaxHeaderBytes:        *maxHeaderBytes,
+		APIKeys:               keys,
+		APIKeyFile:            *apiKeyFile,
+		AllowCIDRs:            allowed,
+		AllowCIDRRead:         *allowCIDRRead,
+		OIDC:                  oidc,
+		AuthMode:              *authMode,
+		UsersFile:             *usersFile,
+		OutOfScopeForbidden:   *outOfScope == http.StatusForbidden,
+		Language:              *language,
+		LanguageDir:           *languageDir,
+		CaptureDir:            *captureDir,
+		CaptureMaxFiles:       *captureMaxFiles,
+		LogBodyBytes:          max(*logBodyBytes, 0),
+		HistoryFile:           *historyFile,
+		HistoryRetention:      max(*historyRetention, 0),
 	})
+	if err := srv.LoadState(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := srv.LoadAPIKeys(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := srv.LoadUsers(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *notifyVerify {
+		if err := srv.VerifyNotifications(context.Background()); err != nil {
+			log.Fatalf("notify: test notification failed: %v", err)
+		}
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
 	defer stop()
 
+	serveErr, err := srv.Start()
+	if err != nil {
+		log.Printf("server: %v", err)
+		return 1
+	}
+
+	usr1 := make(chan os.Signal, 1)
+	notifyToggleReadOnly(usr1)
+	defer signal.Stop(usr1)
 	go func() {
-		if err := srv.Start(); err != nil {
-			log.Fatalf("server: %v", err)
+		for range usr1 {
+			srv.SetReadOnly(!srv.ReadOnly())
 		}
 	}()
 
-	<-ctx.Done()
+	rediscover := func() {
+		systems, err := bf.build()
+		if err != nil {
+			log.Printf("rediscovering systems: %v (keeping the current systems)", err)
+			return
+		}
+		srv.SetSystems(config.Backends(systems), config.Infos(systems))
+	}
+
+	hup := make(chan os.Signal, 1)
+	notifyReload(hup)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			if err := srv.LoadAPIKeys(); err != nil {
+				log.Printf("reloading API keys: %v (keeping the previous keys)", err)
+			}
+			if bf.opts.Discovering() {
+				rediscover()
+			}
+			// After rediscovery, so scopes are checked against the
+			// current systems.
+			if err := srv.LoadUsers(); err != nil {
+				log.Printf("reloading users: %v (keeping the previous users)", err)
+			}
+		}
+	}()
+
+	if *discoverInterval > 0 {
+		go func() {
+			t := time.NewTicker(*discoverInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					rediscover()
+				}
+			}
+		}()
+	}
+
+	code := 0
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		// A listener failed after startup; the others are closed already.
+		log.Printf("server: %v", err)
+		code = 1
+	}
 	if err := srv.Shutdown(context.Background()); err != nil {
 		log.Printf("shutdown error: %v", err)
 	}
+	return code
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/acme"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/server"
+)
+
+func TestACMEConfig(t *testing.T) {
+	https := []string{"https://:443"}
+	domains := []string{"bmc.example.com"}
+	tests := []struct {
+		name      string
+		listen    []string
+		domains   []string
+		cacheDir  string
+		directory string
+		acceptTOS bool
+		tlsCert   string
+		tlsKey    string
+		err       string
+	}{
+		{"no ACME", https, nil, "", acme.LetsEncrypt, false, "cert.pem", "key.pem", ""},
+		{"ACME", https, domains, "/var/lib/acme", acme.LetsEncrypt, true, "", "", ""},
+		{"ACME with a fallback", https, domains, "/var/lib/acme", acme.LetsEncrypt, true, "cert.pem", "key.pem", ""},
+		{"terms not accepted", https, domains, "/var/lib/acme", acme.LetsEncrypt, false, "", "", "--acme-accept-tos"},
+		{"terms accepted without a domain", https, nil, "", acme.LetsEncrypt, true, "", "", "require --acme-domain"},
+		{"cache directory without a domain", https, nil, "/var/lib/acme", acme.LetsEncrypt, false, "", "", "require --acme-domain"},
+		{"directory without a domain", https, nil, "", "https://ca.example/directory", false, "", "", "require --acme-domain"},
+		{"no cache directory", https, domains, "", acme.LetsEncrypt, true, "", "", "--acme-cache-dir"},
+		{"no https listener", []string{":8080"}, domains, "/var/lib/acme", acme.LetsEncrypt, true, "", "", "https:// listener"},
+		{"certificate without a key", https, domains, "/var/lib/acme", acme.LetsEncrypt, true, "cert.pem", "", "together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := acmeConfig(tt.listen, tt.domains, tt.cacheDir, tt.directory, "", tt.acceptTOS, tt.tlsCert, tt.tlsKey)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("acmeConfig = %v, want an error mentioning %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("acmeConfig: %v", err)
+			}
+			if (cfg != nil) != (tt.domains != nil) {
+				t.Errorf("acmeConfig = %+v, want a configuration only with domains", cfg)
+			}
+			if cfg != nil && !cfg.AcceptTOS {
+				t.Error("AcceptTOS not passed on")
+			}
+		})
+	}
+}
+
+func TestCompatFlag(t *testing.T) {
+	tests := []struct {
+		compat        string
+		legacyActions bool
+		want          string
+		err           string
+	}{
+		{server.CompatStrict, false, server.CompatStrict, ""},
+		{server.CompatIDRACish, false, server.CompatIDRACish, ""},
+		{server.CompatStrict, true, server.CompatLegacy, ""},
+		{server.CompatLegacy, true, server.CompatLegacy, ""},
+		{server.CompatIDRACish, true, "", "conflicts"},
+		{"ilo", false, "", "--compat"},
+	}
+	for _, tt := range tests {
+		got, err := compatFlag(tt.compat, tt.legacyActions)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("compatFlag(%q, %v) = %q, %v; want an error mentioning %s", tt.compat, tt.legacyActions, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("compatFlag(%q, %v) = %q, %v; want %q", tt.compat, tt.legacyActions, got, err, tt.want)
+		}
+	}
+}
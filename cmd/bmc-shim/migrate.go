@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// migrateSkipped are the flags of serve that select what it does rather
+// than configure it, and are left out of a generated configuration file.
+var migrateSkipped = map[string]bool{
+	"config": true, "config-schema": true, "print-config": true, "write-config": true,
+	"version": true, "check-config": true, "check-backends": true,
+}
+
+// secretFlag reports whether a flag's value is a credential, which a
+// generated configuration file refers to instead of inlining it.
+// Notification URLs count as they usually embed a token.
+func secretFlag(name string) bool {
+	return name == "pass" || name == "api-key" || name == "notify-url" ||
+		strings.HasSuffix(name, "-pass") || strings.HasSuffix(name, "-token")
+}
+
+// configValueName returns the name readConfigValue reads the default of
+// a flag under.
+func configValueName(flag string) string {
+	if flag == "systems" {
+		return "ha_systems"
+	}
+	return strings.ReplaceAll(flag, "-", "_")
+}
+
+// migratedValue is a key of a generated configuration file.
+type migratedValue struct {
+	name string
+	// value is the value of the key.
+	value any
+	// secrets are the values of the environment variables the value
+	// refers to that are not set yet.
+	secrets map[string]string
+}
+
+// migrateConfig generates the configuration file equivalent to the flags,
+// environment and /etc/bmc-shim files serve was started with, verifies
+// that it configures the same backends and prints it, or writes it to
+// path. Credentials are replaced by the ${ENV} or !file references they
+// were read from, or by a new ${BMC_SHIM_<FLAG>} reference, listed on
+// stderr, if they were given as flags.
+func migrateConfig(fs *flag.FlagSet, bf *backendFlags, path string) int {
+	values := migratedValues(fs)
+	data, err := marshalConfig(values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate config: %v\n", err)
+		return 1
+	}
+	if err := verifyMigration(fs, bf, data, values); err != nil {
+		fmt.Fprintf(os.Stderr, "generated configuration does not match: %v\n", err)
+		return 1
+	}
+	var secrets []string
+	for _, v := range values {
+		for env := range v.secrets {
+			secrets = append(secrets, fmt.Sprintf("%s (the value of --%s)", env, v.name))
+		}
+	}
+	sort.Strings(secrets)
+	if len(secrets) > 0 {
+		fmt.Fprintf(os.Stderr, "set these environment variables where the configuration file is used: %s\n", strings.Join(secrets, ", "))
+	}
+	if path == "" {
+		_, _ = os.Stdout.Write(data)
+		return 0
+	}
+	// Never overwrite a configuration, e.g. the --config being migrated.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write config: %v\n", err)
+		return 1
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write config: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s\n", path)
+	return 0
+}
+
+// migratedValues returns the keys of the configuration file equivalent to
+// the flags of fs, in flag order: the flags that differ from their
+// default or whose default was read from the environment or
+// /etc/bmc-shim.
+func migratedValues(fs *flag.FlagSet) []migratedValue {
+	var values []migratedValue
+	fs.VisitAll(func(f *flag.Flag) {
+		if migrateSkipped[f.Name] {
+			return
+		}
+		source, sourced := configSources[configValueName(f.Name)]
+		unchanged := f.Value.String() == f.DefValue
+		sourced = sourced && unchanged
+		if !sourced && unchanged {
+			return
+		}
+		v := migratedValue{name: f.Name}
+		switch {
+		case sourced && secretFlag(f.Name):
+			v.value = source
+		case secretFlag(f.Name):
+			env := "BMC_SHIM_" + strings.ToUpper(configValueName(f.Name))
+			v.secrets = map[string]string{}
+			if l, ok := f.Value.(*listFlag); ok {
+				refs := make([]string, len(l.values))
+				for i, s := range l.values {
+					name := env + "_" + strconv.Itoa(i+1)
+					refs[i], v.secrets[name] = "${"+name+"}", s
+				}
+				v.value = refs
+			} else {
+				v.value, v.secrets[env] = "${"+env+"}", f.Value.String()
+			}
+		default:
+			v.value = configFileValue(f)
+		}
+		values = append(values, v)
+	})
+	return values
+}
+
+// marshalConfig returns the YAML configuration file setting values, in
+// their order.
+func marshalConfig(values []migratedValue) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range values {
+		var n yaml.Node
+		if err := n.Encode(v.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", v.name, err)
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.name}, &n)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// configFileValue returns the value of f as it is written in a
+// configuration file.
+func configFileValue(f *flag.Flag) any {
+	escape := func(s string) string { return strings.ReplaceAll(s, "${", "$${") }
+	switch kind := flagKind(f); kind {
+	case kindBool, kindInteger, kindNumber:
+		return f.Value.(flag.Getter).Get()
+	case kindList:
+		values := f.Value.(*listFlag).values
+		out := make([]string, len(values))
+		for i, s := range values {
+			out[i] = escape(s)
+		}
+		return out
+	case kindObject:
+		var v any
+		if json.Unmarshal([]byte(f.Value.String()), &v) != nil {
+			break
+		}
+		v, _ = mapStrings(v, func(s string) (string, error) { return escape(s), nil })
+		return v
+	}
+	return escape(f.Value.String())
+}
+
+// verifyMigration loads the configuration file data generated for the
+// serve flags fs like --config into a fresh set of backend flags,
+// resolving the references to the credentials of values given as flags to
+// their values, and compares the backend configuration it gives with that
+// of bf.
+func verifyMigration(serve *flag.FlagSet, bf *backendFlags, data []byte, values []migratedValue) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	var got backendFlags
+	got.register(fs, "noop")
+	secrets := map[string]string{}
+	for _, v := range values {
+		for k, s := range v.secrets {
+			secrets[k] = s
+		}
+	}
+	lookup := func(name string) (string, bool) {
+		if s, ok := secrets[name]; ok {
+			return s, true
+		}
+		return os.LookupEnv(name)
+	}
+	parsed, err := parseConfigFile(serve, "generated configuration", data, lookup)
+	if err != nil {
+		return err
+	}
+	for _, v := range parsed {
+		if fs.Lookup(v.name) == nil {
+			continue
+		}
+		for _, s := range v.values {
+			if err := fs.Set(v.name, s); err != nil {
+				return fmt.Errorf("%s: %w", v.name, err)
+			}
+		}
+	}
+	want, have := reflect.ValueOf(bf.opts), reflect.ValueOf(got.opts)
+	for i := range want.NumField() {
+		if !reflect.DeepEqual(want.Field(i).Interface(), have.Field(i).Interface()) {
+			return fmt.Errorf("backend option %s differs", want.Type().Field(i).Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+// TestMigrateConfigYAML checks that the generated configuration file is
+// YAML, refers to credentials instead of inlining them and configures the
+// same backends when loaded.
+func TestMigrateConfigYAML(t *testing.T) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var bf backendFlags
+	bf.register(fs, "noop")
+	fs.Var(new(listFlag), "listen", "")
+	fs.Int("log-entries", 100, "")
+	fs.String("pass", "", "")
+	fs.Bool("read-only", false, "")
+	fs.Var(new(jsonFlag), "system-overrides", "")
+	if err := fs.Parse([]string{
+		"--backend", "tasmota",
+		"--systems", "1=http://plug1.lan,2=http://plug2.lan",
+		"--log-entries", "3",
+		"--listen", ":8000", "--listen", "https://:8443",
+		"--pass", "s3cret",
+		"--read-only",
+		"--system-overrides", `{"1": {"BiosVersion": "2.1.0", "Note": "${x}", "ProcessorSummary": {"Count": 2}}}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	values := migratedValues(fs)
+	data, err := marshalConfig(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `backend: tasmota
+listen:
+  - :8000
+  - https://:8443
+log-entries: 3
+pass: ${BMC_SHIM_PASS}
+read-only: true
+system-overrides:
+  "1":
+    BiosVersion: 2.1.0
+    Note: $${x}
+    ProcessorSummary:
+      Count: 2
+systems: 1=http://plug1.lan,2=http://plug2.lan
+`
+	if string(data) != want {
+		t.Errorf("generated configuration:\n%s\nwant:\n%s", data, want)
+	}
+	if err := verifyMigration(fs, &bf, data, values); err != nil {
+		t.Errorf("verifyMigration: %v", err)
+	}
+
+	loaded := flag.NewFlagSet("serve", flag.ContinueOnError)
+	loaded.SetOutput(io.Discard)
+	var got backendFlags
+	got.register(loaded, "noop")
+	loaded.Var(new(listFlag), "listen", "")
+	loaded.Int("log-entries", 100, "")
+	pass := loaded.String("pass", "", "")
+	loaded.Bool("read-only", false, "")
+	overrides := new(jsonFlag)
+	loaded.Var(overrides, "system-overrides", "")
+	parsed, err := parseConfigFile(loaded, "generated", data, func(name string) (string, bool) {
+		return map[string]string{"BMC_SHIM_PASS": "s3cret"}[name], name == "BMC_SHIM_PASS"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range parsed {
+		for _, s := range v.values {
+			if err := loaded.Set(v.name, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if *pass != "s3cret" {
+		t.Errorf("pass = %q, want the value of BMC_SHIM_PASS", *pass)
+	}
+	if want := `{"1":{"BiosVersion":"2.1.0","Note":"${x}","ProcessorSummary":{"Count":2}}}`; overrides.String() != want {
+		t.Errorf("system-overrides = %s, want %s", overrides, want)
+	}
+}
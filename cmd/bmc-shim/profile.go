@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/config"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/server"
+)
+
+// checkMetal3 validates the configuration for registering the systems as
+// BareMetalHosts and keeping their power state in sync. The resources
+// Ironic reads (the Manager, the System with its Boot override and Reset
+// action) are always served; what depends on the configuration is
+// checked here. Settings Ironic cannot work with are an error, features it
+// will miss are returned as warnings.
+func checkMetal3(systems []config.System, listen []string, externalURL, compat string) ([]string, error) {
+	if compat != server.CompatStrict {
+		return nil, fmt.Errorf("--profile=metal3 requires --compat=%s, not %s", server.CompatStrict, compat)
+	}
+	var warnings []string
+	https := strings.HasPrefix(externalURL, "https://")
+	for _, l := range listen {
+		https = https || strings.HasPrefix(strings.ToLower(l), "https://")
+	}
+	if !https {
+		warnings = append(warnings, "no https listener: BareMetalHost addresses must use redfish+http://")
+	}
+	warnings = append(warnings, "virtual media is not supported: use redfish:// (network boot) rather than redfish-virtualmedia:// addresses")
+	for _, sys := range systems {
+		caps := sys.Backend.Capabilities()
+		if caps.Boot == nil {
+			warnings = append(warnings, fmt.Sprintf("system %s: backend %s cannot apply boot overrides, so the host must boot from the network by default", sys.ID, sys.Kind))
+		}
+		if !caps.PowerState {
+			warnings = append(warnings, fmt.Sprintf("system %s: backend %s does not report the power state, so Ironic's power sync sees the last requested one", sys.ID, sys.Kind))
+		}
+		var missing []string
+		if len(sys.Info.EthernetInterfaces) == 0 {
+			missing = append(missing, "mac")
+		}
+		if sys.Info.ProcessorCount == 0 {
+			missing = append(missing, "cpus")
+		}
+		if sys.Info.MemoryGiB == 0 {
+			missing = append(missing, "memory")
+		}
+		if len(sys.Info.Disks) == 0 {
+			missing = append(missing, "disk")
+		}
+		if len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf("system %s: options %s not set, so Ironic's redfish inspection reports no such hardware", sys.ID, strings.Join(missing, ", ")))
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// shutdownSignals make serve shut down gracefully.
+var shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// notifyToggleReadOnly relays the signal toggling read-only mode (SIGUSR1)
+// to c.
+func notifyToggleReadOnly(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
+
+// notifyReload relays the signal reloading the key and users files and
+// rediscovering systems (SIGHUP) to c.
+func notifyReload(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals make serve shut down gracefully: os.Interrupt is
+// CTRL_C_EVENT and CTRL_BREAK_EVENT, SIGTERM the console being closed and
+// the system shutting down.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// notifyToggleReadOnly does nothing: Windows has no SIGUSR1.
+func notifyToggleReadOnly(chan<- os.Signal) {}
+
+// notifyReload does nothing: Windows has no SIGHUP to send.
+func notifyReload(chan<- os.Signal) {}
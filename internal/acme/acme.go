@@ -0,0 +1,210 @@
+// Package acme obtains and renews certificates from an ACME CA such as
+// Let's Encrypt (RFC 8555), answering TLS-ALPN-01 challenges (RFC 8737)
+// on the service's own HTTPS listener. The protocol is left to
+// golang.org/x/crypto/acme/autocert; this package adds the fallback
+// certificate, eager issuance and logging.
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	xacme "golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// LetsEncrypt is the production directory of Let's Encrypt.
+const LetsEncrypt = xacme.LetsEncryptURL
+
+// ALPNProto is the ALPN protocol of TLS-ALPN-01 validation connections.
+const ALPNProto = xacme.ALPNProto
+
+const (
+	// renewBefore is how long before expiry a certificate is renewed.
+	renewBefore = 30 * 24 * time.Hour
+	// retryMin and retryMax bound the backoff after a failed issuance;
+	// CAs rate-limit failed validations, so retries start slowly.
+	retryMin = 5 * time.Minute
+	retryMax = 6 * time.Hour
+)
+
+// Config describes the certificates to maintain.
+type Config struct {
+	// Domains are the DNS names to obtain certificates for, one
+	// certificate each. Wildcards cannot be validated with TLS-ALPN-01.
+	Domains []string
+	// CacheDir keeps the account key and the certificates across
+	// restarts.
+	CacheDir string
+	// DirectoryURL is the CA's ACME directory (default LetsEncrypt).
+	DirectoryURL string
+	// Email is the optional account contact for expiry notices.
+	Email string
+	// AcceptTOS records that the operator agrees to the CA's terms of
+	// service, which registering an account requires. New fails without
+	// it.
+	AcceptTOS bool
+	// Fallback, if set, is served while no ACME certificate is available,
+	// e.g. when issuance fails.
+	Fallback *tls.Certificate
+}
+
+// Manager serves the current certificates and keeps them renewed.
+type Manager struct {
+	cfg Config
+	m   *autocert.Manager
+}
+
+// New validates cfg and creates cfg.CacheDir if needed. Nothing is
+// requested from the CA until Run or a TLS handshake.
+func New(cfg Config) (*Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, errors.New("acme: no domains")
+	}
+	domains := make([]string, len(cfg.Domains))
+	for i, d := range cfg.Domains {
+		if d == "" || strings.ContainsAny(d, "*/: ") {
+			return nil, fmt.Errorf("acme: invalid domain %q (wildcards are not supported)", d)
+		}
+		domains[i] = strings.ToLower(strings.TrimSuffix(d, "."))
+	}
+	cfg.Domains = domains
+	if cfg.CacheDir == "" {
+		return nil, errors.New("acme: a cache directory is required")
+	}
+	if !cfg.AcceptTOS {
+		return nil, errors.New("acme: the CA's terms of service have not been accepted")
+	}
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = LetsEncrypt
+	}
+	if err := os.MkdirAll(cfg.CacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("acme: %w", err)
+	}
+	return &Manager{
+		cfg: cfg,
+		m: &autocert.Manager{
+			Prompt: func(tosURL string) bool {
+				log.Printf("acme: accepting the terms of service of %s: %s", cfg.DirectoryURL, tosURL)
+				return true
+			},
+			Cache:       logCache{autocert.DirCache(cfg.CacheDir)},
+			HostPolicy:  autocert.HostWhitelist(domains...),
+			RenewBefore: renewBefore,
+			Client:      &xacme.Client{DirectoryURL: cfg.DirectoryURL},
+			Email:       cfg.Email,
+		},
+	}, nil
+}
+
+// TLSConfig returns a server configuration serving the managed
+// certificates and answering TLS-ALPN-01 validation handshakes.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", ALPNProto},
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate. Clients without
+// SNI, e.g. connecting by IP address, get the certificate of the first
+// domain; the fallback is served while there is none.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" {
+		h := *hello
+		h.ServerName = m.cfg.Domains[0]
+		hello = &h
+	}
+	cert, err := m.m.GetCertificate(hello)
+	if err != nil && m.cfg.Fallback != nil && !isChallenge(hello) {
+		return m.cfg.Fallback, nil
+	}
+	return cert, err
+}
+
+func isChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == ALPNProto
+}
+
+// Run obtains the certificates that are not cached yet, rather than on
+// the first handshake for each domain, until ctx is done. Failures are
+// logged and retried with backoff; the fallback is served meanwhile.
+// Renewals are then scheduled by autocert and logged when stored.
+func (m *Manager) Run(ctx context.Context) {
+	for _, domain := range m.cfg.Domains {
+		retry := retryMin
+		for {
+			err := m.obtain(ctx, domain)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("acme: obtaining certificate for %s failed: %v (retrying in %s)", domain, err, retry)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			retry = min(2*retry, retryMax)
+		}
+	}
+}
+
+// obtain loads or issues the ECDSA certificate of domain, as a handshake
+// of a client supporting ECDSA would.
+func (m *Manager) obtain(ctx context.Context, domain string) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.m.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:   domain,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// logCache logs the certificates autocert stores, i.e. each issuance and
+// renewal.
+type logCache struct {
+	autocert.Cache
+}
+
+func (c logCache) Put(ctx context.Context, key string, data []byte) error {
+	if err := c.Cache.Put(ctx, key, data); err != nil {
+		log.Printf("acme: caching %s failed: %v", key, err)
+		return err
+	}
+	// Certificates are stored under their domain, the account key and
+	// challenge certificates under keys with a '+'.
+	if strings.Contains(key, "+") {
+		return nil
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if leaf, err := x509.ParseCertificate(block.Bytes); err == nil {
+			log.Printf("acme: obtained certificate for %s, valid until %s", key, leaf.NotAfter.Format(time.RFC3339))
+			return nil
+		}
+	}
+	log.Printf("acme: obtained certificate for %s", key)
+	return nil
+}
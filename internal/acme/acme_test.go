@@ -0,0 +1,270 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const testTOS = "https://ca.example/terms.pdf"
+
+// fakeCA is an ACME directory that records the account registrations
+// posted to it and refuses them, so that issuance fails after the account
+// request.
+type fakeCA struct {
+	*httptest.Server
+	mu       sync.Mutex
+	accounts []map[string]any
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	ca := &fakeCA{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"newNonce":   ca.URL + "/nonce",
+			"newAccount": ca.URL + "/account",
+			"newOrder":   ca.URL + "/order",
+			"meta":       map[string]any{"termsOfService": testTOS},
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		var jws struct{ Payload string }
+		if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+			t.Errorf("account request: %v", err)
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+		if err != nil {
+			t.Errorf("account payload: %v", err)
+		}
+		var account map[string]any
+		if err := json.Unmarshal(payload, &account); err != nil {
+			t.Errorf("account payload %q: %v", payload, err)
+		}
+		ca.mu.Lock()
+		ca.accounts = append(ca.accounts, account)
+		ca.mu.Unlock()
+		w.Header().Set("Replay-Nonce", "nonce")
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"type": "urn:ietf:params:acme:error:unauthorized", "detail": "refused by the test CA"}`))
+	})
+	ca.Server = httptest.NewServer(mux)
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+func (ca *fakeCA) registrations() []map[string]any {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.accounts
+}
+
+// selfSigned returns a certificate for name and its PEM encoding, key
+// first as autocert stores it.
+func selfSigned(t *testing.T, name string) (*tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	_ = pem.Encode(&b, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	_ = pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, b.Bytes()
+}
+
+// captureLog returns the log output written until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var b bytes.Buffer
+	log.SetOutput(&b)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &b
+}
+
+func ecdsaHello(name string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{ServerName: name, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  Config
+		err  string
+	}{
+		{"valid", Config{Domains: []string{"bmc.example.com"}, CacheDir: dir, AcceptTOS: true}, ""},
+		{"terms not accepted", Config{Domains: []string{"bmc.example.com"}, CacheDir: dir}, "terms of service"},
+		{"no domains", Config{CacheDir: dir, AcceptTOS: true}, "no domains"},
+		{"wildcard", Config{Domains: []string{"*.example.com"}, CacheDir: dir, AcceptTOS: true}, "wildcards"},
+		{"with port", Config{Domains: []string{"bmc.example.com:443"}, CacheDir: dir, AcceptTOS: true}, "invalid domain"},
+		{"no cache directory", Config{Domains: []string{"bmc.example.com"}, AcceptTOS: true}, "cache directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if tt.err == "" && err != nil {
+				t.Errorf("New: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("New = %v, want an error mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestRegistration checks what the account registration sends the CA:
+// the terms of service agreed to, which New only allows with AcceptTOS,
+// and the contact. The URL of the terms is logged.
+func TestRegistration(t *testing.T) {
+	ca := newFakeCA(t)
+	logged := captureLog(t)
+	fallback, _ := selfSigned(t, "fallback.example.com")
+	m, err := New(Config{
+		Domains:      []string{"bmc.example.com"},
+		CacheDir:     t.TempDir(),
+		DirectoryURL: ca.URL + "/directory",
+		Email:        "ops@example.com",
+		AcceptTOS:    true,
+		Fallback:     fallback,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Issuance fails at the account: the fallback is served.
+	cert, err := m.GetCertificate(ecdsaHello("bmc.example.com"))
+	if err != nil || cert != fallback {
+		t.Fatalf("GetCertificate = %v, %v, want the fallback", cert, err)
+	}
+	accounts := ca.registrations()
+	if len(accounts) == 0 {
+		t.Fatal("no account registered")
+	}
+	if agreed, _ := accounts[0]["termsOfServiceAgreed"].(bool); !agreed {
+		t.Errorf("account %v does not agree to the terms of service", accounts[0])
+	}
+	if contact, _ := json.Marshal(accounts[0]["contact"]); string(contact) != `["mailto:ops@example.com"]` {
+		t.Errorf("account contact = %s, want mailto:ops@example.com", contact)
+	}
+	if !strings.Contains(logged.String(), testTOS) {
+		t.Errorf("accepted terms of service not logged: %s", logged)
+	}
+}
+
+func TestGetCertificateFallback(t *testing.T) {
+	ca := newFakeCA(t)
+	captureLog(t)
+	fallback, _ := selfSigned(t, "fallback.example.com")
+	newManager := func(fallback *tls.Certificate) *Manager {
+		m, err := New(Config{Domains: []string{"bmc.example.com"}, CacheDir: t.TempDir(), DirectoryURL: ca.URL + "/directory", AcceptTOS: true, Fallback: fallback})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	m := newManager(fallback)
+
+	// Clients without SNI are served like those asking for the first
+	// domain.
+	if cert, err := m.GetCertificate(ecdsaHello("")); err != nil || cert != fallback {
+		t.Errorf("GetCertificate without SNI = %v, %v, want the fallback", cert, err)
+	}
+	// Validation handshakes never get the fallback.
+	challenge := ecdsaHello("bmc.example.com")
+	challenge.SupportedProtos = []string{ALPNProto}
+	if cert, err := m.GetCertificate(challenge); err == nil {
+		t.Errorf("GetCertificate of a validation handshake without a pending challenge = %v, want an error", cert)
+	}
+	// Without a fallback the failure is the handshake's.
+	if cert, err := newManager(nil).GetCertificate(ecdsaHello("bmc.example.com")); err == nil {
+		t.Errorf("GetCertificate without a fallback = %v, want an error", cert)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	// Not t.TempDir: the abandoned issuance may still write to it when
+	// the test ends.
+	dir, err := os.MkdirTemp("", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	m, err := New(Config{Domains: []string{"bmc.example.com"}, CacheDir: dir, DirectoryURL: newFakeCA(t).URL + "/directory", AcceptTOS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after ctx was canceled")
+	}
+}
+
+func TestLogCache(t *testing.T) {
+	logged := captureLog(t)
+	c := logCache{autocert.DirCache(t.TempDir())}
+	ctx := context.Background()
+	_, data := selfSigned(t, "bmc.example.com")
+	if err := c.Put(ctx, "acme_account+key", []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("account key logged as a certificate: %s", logged)
+	}
+	if err := c.Put(ctx, "bmc.example.com", data); err != nil {
+		t.Fatal(err)
+	}
+	if want := "acme: obtained certificate for bmc.example.com, valid until 2030-01-02T03:04:05Z"; !strings.Contains(logged.String(), want) {
+		t.Errorf("log = %q, want %q", logged, want)
+	}
+	if got, err := c.Get(ctx, "bmc.example.com"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get = %v, want the stored certificate", err)
+	}
+}
@@ -1,24 +0,0 @@
-package backend
-
-import (
-	"context"
-	"log"
-)
-
-type noop struct{}
-
-func NewNoop() Backend { return &noop{} }
-
-func (n *noop) PowerOn(ctx context.Context) error {
-	log.Println("noop backend: PowerOn")
-	return nil
-}
-
-func (n *noop) PowerOff(ctx context.Context) error {
-	log.Println("noop backend: PowerOff")
-	return nil
-}
-
-func (n *noop) Ping(ctx context.Context) error {
-	return nil
-}
@@ -0,0 +1,88 @@
+// Package buildinfo describes the running build of bmc-shim.
+//
+// Release builds set the version, commit and date with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo.version=v1.2.0 \
+//	  -X github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo.commit=$(git rev-parse HEAD) \
+//	  -X github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/bmc-shim
+//
+// Values that are not set fall back to what the Go toolchain recorded in
+// the binary (module version and VCS stamping).
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Set with -ldflags -X.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info is the version information of a build.
+type Info struct {
+	Version   string `json:"Version"`
+	Commit    string `json:"Commit,omitempty"`
+	Date      string `json:"BuildDate,omitempty"`
+	GoVersion string `json:"GoVersion"`
+}
+
+// String formats the information for logs and --version, e.g.
+// "v1.2.0 (commit 1a2b3c4, built 2026-01-02T03:04:05Z, go1.25.5)".
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		c, dirty := strings.CutSuffix(i.Commit, "-dirty")
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if dirty {
+			c += "-dirty"
+		}
+		details = append(details, "commit "+c)
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	details = append(details, i.GoVersion)
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// Get returns the information of the running binary.
+var Get = sync.OnceValue(func() Info {
+	info := Info{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		// Only mark a commit dirty that came from VCS stamping.
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+})
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/redfish"
+)
+
+// Client is a minimal Redfish client for talking to a bmc-shim instance.
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+}
+
+// System is a ComputerSystem resource as served by the shim.
+type System = redfish.ComputerSystem
+
+// StatusError is returned when the shim answers with a non-2xx status.
+// MessageID and Message are taken from the Redfish error body, if any.
+type StatusError struct {
+	Code      int
+	Body      string
+	MessageID string
+	Message   string
+}
+
+func (e *StatusError) Error() string {
+	if e.MessageID != "" {
+		return fmt.Sprintf("http %d: %s: %s", e.Code, e.MessageID, e.Message)
+	}
+	return fmt.Sprintf("http %d: %s", e.Code, strings.TrimSpace(e.Body))
+}
+
+// newStatusError decodes the Redfish error envelope of a failed response.
+// Extended info is preferred over the top-level GeneralError.
+func newStatusError(code int, body []byte) *StatusError {
+	e := &StatusError{Code: code, Body: string(body)}
+	var env struct {
+		Error struct {
+			Code     string            `json:"code"`
+			Message  string            `json:"message"`
+			Extended []redfish.Message `json:"@Message.ExtendedInfo"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &env) != nil {
+		return e
+	}
+	e.MessageID, e.Message = env.Error.Code, env.Error.Message
+	if len(env.Error.Extended) > 0 {
+		e.MessageID, e.Message = env.Error.Extended[0].MessageID, env.Error.Extended[0].Message
+	}
+	return e
+}
+
+// New returns a client for the shim at baseURL (e.g. http://127.0.0.1:8080).
+// If httpClient is nil a client with a sensible timeout is used.
+func New(baseURL, username, password string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &Client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		http:     httpClient,
+	}
+}
+
+// NewForHandler returns a client that dispatches requests directly to h
+// in-process, without opening a listener.
+func NewForHandler(h http.Handler, username, password string) *Client {
+	return New("http://bmc-shim.local", username, password, &http.Client{Transport: handlerTransport{h}})
+}
+
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Server-side requests always carry a non-nil body and a RequestURI.
+	req = req.Clone(req.Context())
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	req.RequestURI = req.URL.RequestURI()
+	rw := &responseWriter{header: http.Header{}}
+	t.h.ServeHTTP(rw, req)
+	rw.WriteHeader(http.StatusOK)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rw.code, http.StatusText(rw.code)),
+		StatusCode:    rw.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rw.sent,
+		Body:          io.NopCloser(&rw.body),
+		ContentLength: int64(rw.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// responseWriter buffers the response of an in-process request. Like a
+// server, it sends the headers as they are when the status is written.
+type responseWriter struct {
+	header http.Header
+	sent   http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	w.code = code
+	w.sent = w.header.Clone()
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		if w.header.Get("Content-Type") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(b)
+}
+
+// Flush is a no-op; handlers that stream look for an http.Flusher.
+func (w *responseWriter) Flush() {}
+
+// SystemIDs lists the IDs of all systems in the Systems collection, sorted.
+func (c *Client) SystemIDs(ctx context.Context) ([]string, error) {
+	var body redfish.Collection[redfish.Link]
+	if err := c.get(ctx, "/redfish/v1/Systems", &body); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(body.Members))
+	for _, m := range body.Members {
+		ids = append(ids, path.Base(m.ODataID))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// System fetches a single system.
+func (c *Client) System(ctx context.Context, id string) (*System, error) {
+	var sys System
+	if err := c.get(ctx, "/redfish/v1/Systems/"+id, &sys); err != nil {
+		return nil, err
+	}
+	return &sys, nil
+}
+
+// Reset invokes the ComputerSystem.Reset action on a system. Both 204 No
+// Content and the legacy 200 response count as success.
+func (c *Client) Reset(ctx context.Context, id, resetType string) error {
+	b, err := json.Marshal(map[string]string{"ResetType": resetType})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/redfish/v1/Systems/"+id+"/Actions/ComputerSystem.Reset", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *Client) get(ctx context.Context, p string, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, method, p string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+p, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, newStatusError(resp.StatusCode, b)
+	}
+	return resp, nil
+}
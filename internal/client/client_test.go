@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/server"
+)
+
+func TestNewForHandler(t *testing.T) {
+	h := server.New(server.Config{
+		Username: "admin",
+		Password: "secret",
+		Systems:  map[string]backend.System{"1": backend.NewNoop(), "2": backend.NewNoop()},
+	}).Handler()
+	c := NewForHandler(h, "admin", "secret")
+	ctx := context.Background()
+
+	ids, err := c.SystemIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"1", "2"}) {
+		t.Errorf("SystemIDs = %v, want [1 2]", ids)
+	}
+	if err := c.Reset(ctx, "1", "ForceOff"); err != nil {
+		t.Fatal(err)
+	}
+	sys, err := c.System(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys.PowerState != "Off" {
+		t.Errorf("PowerState after ForceOff = %q, want Off", sys.PowerState)
+	}
+
+	_, err = c.System(ctx, "3")
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusNotFound || se.MessageID != "Base.1.0.ResourceMissingAtURI" {
+		t.Errorf("System of an unknown ID = %v, want a 404 StatusError with ResourceMissingAtURI", err)
+	}
+
+	_, err = NewForHandler(h, "admin", "wrong").SystemIDs(ctx)
+	if !errors.As(err, &se) || se.Code != http.StatusUnauthorized {
+		t.Errorf("SystemIDs with a wrong password = %v, want a 401 StatusError", err)
+	}
+}
+
+func TestHandlerTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		h        http.HandlerFunc
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{"implicit status", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "<html>hi</html>")
+		}, http.StatusOK, "text/html; charset=utf-8", "<html>hi</html>"},
+		{"headers sent with the status", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = io.WriteString(w, "{}")
+		}, http.StatusAccepted, "application/json", "{}"},
+		{"no body", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}, http.StatusNoContent, "", ""},
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://bmc-shim.local/x?y=1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got *http.Request
+			resp, err := handlerTransport{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				tt.h(w, r)
+			})}.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantCode || resp.Header.Get("Content-Type") != tt.wantType || string(body) != tt.wantBody {
+				t.Errorf("response = %d %q %q, want %d %q %q", resp.StatusCode, resp.Header.Get("Content-Type"), body, tt.wantCode, tt.wantType, tt.wantBody)
+			}
+			if resp.ContentLength != int64(len(tt.wantBody)) {
+				t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(tt.wantBody))
+			}
+			if got.Body == nil || got.RequestURI != "/x?y=1" {
+				t.Errorf("handler got body %v and RequestURI %q, want a body and /x?y=1", got.Body, got.RequestURI)
+			}
+		})
+	}
+}
@@ -0,0 +1,908 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/backendmw"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/server"
+)
+
+// Options describes which backends to build. It mirrors the command line
+// flags so that the construction logic can be exercised without main.
+type Options struct {
+	SystemID string
+	Backend  string
+	OnCmd    string
+	OffCmd   string
+	// CommandShell is the interpreter of the command backend and command
+	// hooks, as space-separated words; empty means backend.DefaultShell.
+	CommandShell string
+	HAURL        string
+	HAToken      string
+	HAEntity     string
+	// HAMaxConns bounds the connections all Home Assistant systems share.
+	HAMaxConns int
+	// HATLSPin, if set, pins Home Assistant's certificate; see
+	// backend.ParseTLSPin.
+	HATLSPin string
+	// HAStatesMaxAge is how long one fetch of all Home Assistant states
+	// serves the reads of several systems; zero fetches every entity on
+	// its own.
+	HAStatesMaxAge time.Duration
+	// HAOptimisticWindow is how long a Home Assistant system reports the
+	// state a successful power action asked for until Home Assistant
+	// reports it; zero reports what Home Assistant reports.
+	HAOptimisticWindow time.Duration
+	// HAPowerEntity and HAEnergyEntity are sensor entities for the single
+	// system's power draw (W) and consumed energy (kWh).
+	HAPowerEntity  string
+	HAEnergyEntity string
+	// HATemperatureEntities is a comma-separated list of temperature sensor
+	// entities for the single system.
+	HATemperatureEntities string
+	// HAIndicatorEntity is a light/switch entity used as the single
+	// system's IndicatorLED.
+	HAIndicatorEntity string
+	// HADiscoverLabel and HADiscoverArea select the Home Assistant switch
+	// entities added as systems by Discover.
+	HADiscoverLabel string
+	HADiscoverArea  string
+	// GCECredentials is a service account key file for backend=gce; empty
+	// uses the application default credentials.
+	GCECredentials string
+	// GCEInstance is the single system's project/zone/name (backend=gce).
+	GCEInstance string
+	// GCEWait, if positive, makes power actions wait for the start/stop
+	// operation to finish.
+	GCEWait time.Duration
+	// GCEEndpoint overrides the Compute API base URL.
+	GCEEndpoint string
+	// AWSRegion is the region of the instances (backend=ec2).
+	AWSRegion string
+	// AWSEndpoint overrides the regional EC2 endpoint.
+	AWSEndpoint string
+	// EC2Instance is the single system's instance ID (backend=ec2).
+	EC2Instance string
+	// HCloudToken is the Hetzner Cloud API token (backend=hcloud).
+	HCloudToken string
+	// HCloudServer is the single system's server ID (backend=hcloud).
+	HCloudServer string
+	// HCloudEndpoint overrides the Hetzner Cloud API base URL.
+	HCloudEndpoint string
+	// RobotUser and RobotPass are the Hetzner Robot webservice
+	// credentials (backend=hetzner-robot).
+	RobotUser string
+	RobotPass string
+	// RobotServer is the single system's server number
+	// (backend=hetzner-robot).
+	RobotServer string
+	// RobotEndpoint overrides the Robot webservice base URL.
+	RobotEndpoint string
+	// XAPIURL, XAPIUser and XAPIPass address the XenServer/XCP-ng pool
+	// master (backend=xapi).
+	XAPIURL  string
+	XAPIUser string
+	XAPIPass string
+	// XAPIInsecure skips TLS verification of the pool master.
+	XAPIInsecure bool
+	// XAPIVM is the single system's VM UUID (backend=xapi).
+	XAPIVM string
+	// Incus addresses the Incus/LXD server (backend=incus).
+	Incus backend.IncusConfig
+	// IncusInstance is the single system's [project/]name (backend=incus).
+	IncusInstance string
+	// VPSProvider (digitalocean or linode), VPSToken and VPSEndpoint
+	// configure backend=cloud-vps.
+	VPSProvider string
+	VPSToken    string
+	VPSEndpoint string
+	// VPSInstance is the single system's droplet/instance ID
+	// (backend=cloud-vps).
+	VPSInstance string
+	// Racadm configures backend=racadm.
+	Racadm backend.RacadmConfig
+	// RacadmHost is the single system's iDRAC host (remote and ssh modes).
+	RacadmHost string
+	// IPMI configures backend=ipmi.
+	IPMI backend.IPMIConfig
+	// IPMIHost is the single system's BMC host and IPMIQuirks the vendor
+	// quirks of BMCs without a quirks option (backend=ipmi).
+	IPMIHost   string
+	IPMIQuirks string
+	// NUTAddr and NUTUPS address the UPS at upsd, NUTUser and NUTPass
+	// the upsd.users account (backend=nut).
+	NUTAddr string
+	NUTUPS  string
+	NUTUser string
+	NUTPass string
+	// NUTOutlet is the single system's outlet number (backend=nut).
+	NUTOutlet string
+	// TasmotaUser and TasmotaPass are the web admin credentials of the
+	// Tasmota devices (backend=tasmota).
+	TasmotaUser string
+	TasmotaPass string
+	// TasmotaCycle, when positive, makes PowerCycle a native off-delay-on
+	// run by the device.
+	TasmotaCycle time.Duration
+	// TasmotaDevice is the single system's url[:index] (backend=tasmota).
+	TasmotaDevice string
+	// Z2MBroker is the MQTT broker URL Zigbee2MQTT publishes to, Z2MUser
+	// and Z2MPass its credentials (backend=zigbee2mqtt).
+	Z2MBroker string
+	Z2MUser   string
+	Z2MPass   string
+	// Z2MBaseTopic is Zigbee2MQTT's base topic, unless a system's base
+	// option overrides it.
+	Z2MBaseTopic string
+	// Z2MDevice is the single system's friendly name (backend=zigbee2mqtt).
+	Z2MDevice string
+	// SmartPlugDevice is the single system's adapter:host
+	// (backend=smartplug); its key and device ID come from SystemOptions.
+	SmartPlugDevice string
+	// NomadAddr, NomadToken, NomadRegion and NomadNamespace address the
+	// Nomad cluster (backend=nomad); empty values fall back to the
+	// NOMAD_* environment variables.
+	NomadAddr      string
+	NomadToken     string
+	NomadRegion    string
+	NomadNamespace string
+	// NomadCount is the count a task group is scaled to on power on.
+	NomadCount int
+	// NomadJob is the single system's job[/group] (backend=nomad).
+	NomadJob string
+	// Kubeconfig is a kubeconfig file (backend=kubernetes); empty
+	// uses the in-cluster service account. K8sNamespace overrides the
+	// default namespace of targets.
+	Kubeconfig   string
+	K8sNamespace string
+	// K8sWorkload is the single system's [namespace/]kind/name
+	// (backend=kubernetes).
+	K8sWorkload string
+	// Systems is the multi-system mapping: comma-separated
+	// id=target[;key=value...] entries.
+	Systems string
+	// SystemOptions holds key=value;... options for the single system
+	// (the same options an entry in Systems accepts).
+	SystemOptions string
+	// BackendRetries is how many times a failed backend read is retried,
+	// the first time after BackendRetryBackoff.
+	BackendRetries      int
+	BackendRetryBackoff time.Duration
+	// BackendBreakerFailures, if positive, opens the circuit breaker of a
+	// system after that many consecutive failed backend calls, for
+	// BackendBreakerCooldown.
+	BackendBreakerFailures int
+	BackendBreakerCooldown time.Duration
+	// BackendCallTimeout, if positive, bounds every backend call.
+	BackendCallTimeout time.Duration
+	// LogBackendCalls logs every backend call.
+	LogBackendCalls bool
+	// Metrics, if set, returns the observer of the backend calls of a
+	// system.
+	Metrics func(id string) backendmw.Observer
+}
+
+// System is a single configured system together with its backend.
+type System struct {
+	ID   string
+	Kind string
+	// Target identifies what the backend controls (e.g. the HA entity_id).
+	Target  string
+	Info    server.SystemInfo
+	Backend backend.System
+	// Discovered is set for systems found by Discover.
+	Discovered bool
+}
+
+// Build constructs all configured systems. It only validates configuration
+// and never talks to the backends.
+func Build(o Options) ([]System, error) {
+	if err := o.checkMiddleware(); err != nil {
+		return nil, err
+	}
+	systems, err := o.build()
+	if err != nil {
+		return nil, err
+	}
+	return o.wrap(systems), nil
+}
+
+func (o Options) build() ([]System, error) {
+	single, err := o.single()
+	if err != nil {
+		return nil, err
+	}
+	switch o.Backend {
+	case "noop":
+		if err := single.checkResetTargets(o.Backend); err != nil {
+			return nil, err
+		}
+		return []System{{ID: single.ID, Kind: o.Backend, Info: single.Info, Backend: backend.NewNoop()}}, nil
+	case "command":
+		be, err := backend.NewCommand(o.OnCmd, o.OffCmd, backend.WithCommandResets(single.ResetTargets), backend.WithCommandShell(single.shell))
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return []System{{ID: single.ID, Kind: o.Backend, Info: single.Info, Backend: backend.Adapt(be)}}, nil
+	case "homeassistant":
+		client, err := backend.NewHAHTTPClient(o.HAMaxConns, o.HATLSPin)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.homeAssistant(single, client, o.haStates(client))
+	case "gce":
+		creds, err := backend.NewGoogleCredentials(o.GCECredentials)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		var opts []backend.GCEOption
+		if o.GCEWait > 0 {
+			opts = append(opts, backend.WithGCEWait(o.GCEWait))
+		}
+		if o.GCEEndpoint != "" {
+			opts = append(opts, backend.WithGCEEndpoint(o.GCEEndpoint))
+		}
+		return o.systems(single, o.GCEInstance, func(e Entry) (backend.Backend, error) {
+			return backend.NewGCE(creds, e.Target, opts...)
+		})
+	case "ec2":
+		cfg, err := backend.LoadAWSConfig(context.Background(), o.AWSRegion)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		c, err := backend.NewEC2Client(cfg, o.AWSEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.systems(single, o.EC2Instance, func(e Entry) (backend.Backend, error) {
+			return backend.NewEC2(c, e.Target)
+		})
+	case "hcloud":
+		var opts []backend.HCloudOption
+		if o.HCloudEndpoint != "" {
+			opts = append(opts, backend.WithHCloudEndpoint(o.HCloudEndpoint))
+		}
+		return o.systems(single, o.HCloudServer, func(e Entry) (backend.Backend, error) {
+			return backend.NewHCloud(o.HCloudToken, e.Target, opts...)
+		})
+	case "hetzner-robot":
+		var opts []backend.HetznerRobotOption
+		if o.RobotEndpoint != "" {
+			opts = append(opts, backend.WithRobotEndpoint(o.RobotEndpoint))
+		}
+		return o.systems(single, o.RobotServer, func(e Entry) (backend.Backend, error) {
+			return backend.NewHetznerRobot(o.RobotUser, o.RobotPass, e.Target, opts...)
+		})
+	case "xapi":
+		c, err := backend.NewXAPIClient(o.XAPIURL, o.XAPIUser, o.XAPIPass, o.XAPIInsecure)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.systems(single, o.XAPIVM, func(e Entry) (backend.Backend, error) {
+			return backend.NewXAPI(c, e.Target)
+		})
+	case "incus":
+		c, err := backend.NewIncusClient(o.Incus)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.systems(single, o.IncusInstance, func(e Entry) (backend.Backend, error) {
+			return backend.NewIncus(c, e.Target)
+		})
+	case "cloud-vps":
+		var opts []backend.CloudVPSOption
+		if o.VPSEndpoint != "" {
+			opts = append(opts, backend.WithVPSEndpoint(o.VPSEndpoint))
+		}
+		return o.systems(single, o.VPSInstance, func(e Entry) (backend.Backend, error) {
+			return backend.NewCloudVPS(o.VPSProvider, o.VPSToken, e.Target, opts...)
+		})
+	case "racadm":
+		return o.systems(single, o.RacadmHost, func(e Entry) (backend.Backend, error) {
+			return backend.NewRacadm(o.Racadm, e.Target)
+		})
+	case "ipmi":
+		return o.systems(single, o.IPMIHost, func(e Entry) (backend.Backend, error) {
+			quirks := o.IPMIQuirks
+			if e.Quirks != "" {
+				quirks = e.Quirks
+			}
+			return backend.NewIPMI(o.IPMI, e.Target, quirks)
+		})
+	case "nut":
+		c, err := backend.NewNUTClient(o.NUTAddr, o.NUTUPS, o.NUTUser, o.NUTPass)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.systems(single, o.NUTOutlet, func(e Entry) (backend.Backend, error) {
+			return backend.NewNUT(c, e.Target)
+		})
+	case "tasmota":
+		opts := []backend.TasmotaOption{backend.WithTasmotaAuth(o.TasmotaUser, o.TasmotaPass)}
+		if o.TasmotaCycle > 0 {
+			opts = append(opts, backend.WithTasmotaCycle(o.TasmotaCycle))
+		}
+		return o.systems(single, o.TasmotaDevice, func(e Entry) (backend.Backend, error) {
+			return backend.NewTasmota(e.Target, opts...)
+		})
+	case "zigbee2mqtt":
+		c, err := backend.NewMQTTClient(o.Z2MBroker, o.Z2MUser, o.Z2MPass)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.systems(single, o.Z2MDevice, func(e Entry) (backend.Backend, error) {
+			base := o.Z2MBaseTopic
+			if e.BaseTopic != "" {
+				base = e.BaseTopic
+			}
+			return backend.NewZigbee2MQTT(c, base, e.Target)
+		})
+	case "smartplug":
+		return o.systems(single, o.SmartPlugDevice, func(e Entry) (backend.Backend, error) {
+			return backend.NewSmartPlug(e.Target, e.SmartPlug)
+		})
+	case "nomad":
+		c := backend.NewNomadClient(o.NomadAddr, o.NomadToken, o.NomadRegion, o.NomadNamespace)
+		return o.systems(single, o.NomadJob, func(e Entry) (backend.Backend, error) {
+			return backend.NewNomad(c, e.Target, o.NomadCount)
+		})
+	case "kubernetes":
+		c, err := backend.NewKubernetesClient(o.Kubeconfig, o.K8sNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return o.systems(single, o.K8sWorkload, func(e Entry) (backend.Backend, error) {
+			return backend.NewKubernetes(c, e.Target)
+		})
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", o.Backend)
+	}
+}
+
+// haStates returns the states cache shared by the Home Assistant systems,
+// or nil if it is disabled or there is only a single system.
+func (o Options) haStates(client *http.Client) *backend.HAStateCache {
+	if o.HAStatesMaxAge <= 0 || (o.Systems == "" && !o.Discovering()) {
+		return nil
+	}
+	return backend.NewHAStateCache(client, o.HAURL, o.HAToken, o.HAStatesMaxAge)
+}
+
+// homeAssistant builds the systems of backend=homeassistant, all sharing
+// client and states.
+func (o Options) homeAssistant(single Entry, client *http.Client, states *backend.HAStateCache) ([]System, error) {
+	if o.Systems == "" {
+		single.Target = o.HAEntity
+		if single.PowerEntity == "" {
+			single.PowerEntity = o.HAPowerEntity
+		}
+		if single.EnergyEntity == "" {
+			single.EnergyEntity = o.HAEnergyEntity
+		}
+		if single.IndicatorEntity == "" {
+			single.IndicatorEntity = o.HAIndicatorEntity
+		}
+		for _, t := range strings.Split(o.HATemperatureEntities, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				single.TemperatureEntities = append(single.TemperatureEntities, t)
+			}
+		}
+		be, err := newHomeAssistant(o, single, client, states)
+		if err != nil {
+			return nil, fmt.Errorf("backend init: %w", err)
+		}
+		return []System{{ID: single.ID, Kind: o.Backend, Target: o.HAEntity, Info: single.Info, Backend: backend.Adapt(be)}}, nil
+	}
+	entries, err := ParseSystems(o.Systems, single.shell)
+	if err != nil {
+		return nil, err
+	}
+	systems := make([]System, 0, len(entries))
+	for _, e := range entries {
+		be, err := newHomeAssistant(o, e, client, states)
+		if err != nil {
+			return nil, fmt.Errorf("backend init (%s): %w", e.ID, err)
+		}
+		systems = append(systems, System{ID: e.ID, Kind: o.Backend, Target: e.Target, Info: e.Info, Backend: backend.Adapt(be)})
+	}
+	return systems, nil
+}
+
+// single returns the entry of the single system (no --systems mapping).
+func (o Options) single() (Entry, error) {
+	if err := validSystemID(o.SystemID); err != nil {
+		return Entry{}, fmt.Errorf("invalid --system-id: %w", err)
+	}
+	shell, err := backend.ParseShell(o.CommandShell)
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid --command-shell: %w", err)
+	}
+	single := Entry{ID: o.SystemID, shell: shell}
+	if o.SystemOptions != "" {
+		if err := single.parseOptions(strings.Split(o.SystemOptions, ";")); err != nil {
+			return Entry{}, err
+		}
+	}
+	return single, nil
+}
+
+// systems builds a backend for each entry of the --systems mapping, or for
+// the single system with target when no mapping is given.
+func (o Options) systems(single Entry, target string, newBackend func(Entry) (backend.Backend, error)) ([]System, error) {
+	entries := []Entry{single}
+	entries[0].Target = target
+	if o.Systems != "" {
+		var err error
+		if entries, err = ParseSystems(o.Systems, single.shell); err != nil {
+			return nil, err
+		}
+	}
+	systems := make([]System, 0, len(entries))
+	for _, e := range entries {
+		if err := e.checkResetTargets(o.Backend); err != nil {
+			return nil, err
+		}
+		be, err := newBackend(e)
+		if err != nil {
+			return nil, fmt.Errorf("backend init (%s): %w", e.ID, err)
+		}
+		systems = append(systems, System{ID: e.ID, Kind: o.Backend, Target: e.Target, Info: e.Info, Backend: backend.Adapt(be)})
+	}
+	return systems, nil
+}
+
+func newHomeAssistant(o Options, e Entry, client *http.Client, states *backend.HAStateCache) (*backend.HomeAssistant, error) {
+	opts := []backend.HomeAssistantOption{backend.WithHAHTTPClient(client)}
+	if states != nil {
+		opts = append(opts, backend.WithHAStateCache(states))
+	}
+	if e.PowerEntity != "" {
+		opts = append(opts, backend.WithHAPowerEntity(e.PowerEntity))
+	}
+	if e.EnergyEntity != "" {
+		opts = append(opts, backend.WithHAEnergyEntity(e.EnergyEntity))
+	}
+	if e.IndicatorEntity != "" {
+		opts = append(opts, backend.WithHAIndicatorEntity(e.IndicatorEntity))
+	}
+	if len(e.TemperatureEntities) > 0 {
+		opts = append(opts, backend.WithHATemperatureEntities(e.TemperatureEntities...))
+	}
+	if len(e.ResetTargets) > 0 {
+		opts = append(opts, backend.WithHAResetEntities(e.ResetTargets))
+	}
+	if e.StateAny {
+		opts = append(opts, backend.WithHAStateAny())
+	}
+	if o.HAOptimisticWindow > 0 {
+		opts = append(opts, backend.WithHAOptimisticState(o.HAOptimisticWindow))
+	}
+	return backend.NewHomeAssistant(o.HAURL, o.HAToken, e.Target, opts...)
+}
+
+// wrap wraps the backend of every system with the backendmw options the
+// Options ask for.
+func (o Options) wrap(systems []System) []System {
+	for i, s := range systems {
+		systems[i].Backend = backendmw.Wrap(s.Backend, o.middleware(s.ID)...)
+	}
+	return systems
+}
+
+// checkMiddleware validates the options of the backendmw wrappers.
+func (o Options) checkMiddleware() error {
+	switch {
+	case o.BackendRetries < 0:
+		return errors.New("--backend-retries must not be negative")
+	case o.BackendRetries > 0 && o.BackendRetryBackoff < 0:
+		return errors.New("--backend-retry-backoff must not be negative")
+	case o.BackendBreakerFailures < 0:
+		return errors.New("--backend-breaker-failures must not be negative")
+	case o.BackendBreakerFailures > 0 && o.BackendBreakerCooldown <= 0:
+		return errors.New("--backend-breaker-cooldown must be positive")
+	case o.BackendCallTimeout < 0:
+		return errors.New("--backend-call-timeout must not be negative")
+	}
+	return nil
+}
+
+// middleware returns the backendmw options of the system id, in the order
+// the backendmw package documents.
+func (o Options) middleware(id string) []backendmw.Option {
+	var opts []backendmw.Option
+	if o.LogBackendCalls {
+		opts = append(opts, backendmw.Logging(func(format string, args ...any) {
+			log.Printf("system %s: "+format, append([]any{id}, args...)...)
+		}))
+	}
+	if o.Metrics != nil {
+		opts = append(opts, backendmw.Metrics(o.Metrics(id)))
+	}
+	if o.BackendBreakerFailures > 0 {
+		opts = append(opts, backendmw.Breaker(o.BackendBreakerFailures, o.BackendBreakerCooldown))
+	}
+	if o.BackendRetries > 0 {
+		opts = append(opts, backendmw.Retry(o.BackendRetries, o.BackendRetryBackoff))
+	}
+	if o.BackendCallTimeout > 0 {
+		opts = append(opts, backendmw.Timeout(o.BackendCallTimeout))
+	}
+	return opts
+}
+
+// Backends returns the id to backend map the server expects.
+func Backends(systems []System) map[string]backend.System {
+	m := make(map[string]backend.System, len(systems))
+	for _, s := range systems {
+		m[s.ID] = s.Backend
+	}
+	return m
+}
+
+// Infos returns the per-system metadata the server expects.
+func Infos(systems []System) map[string]server.SystemInfo {
+	m := make(map[string]server.SystemInfo, len(systems))
+	for _, s := range systems {
+		m[s.ID] = s.Info
+	}
+	return m
+}
+
+// Entry is one parsed element of the --systems mapping.
+type Entry struct {
+	ID     string
+	Target string
+	Info   server.SystemInfo
+	// PowerEntity and EnergyEntity are optional HA sensor entities.
+	PowerEntity  string
+	EnergyEntity string
+	// TemperatureEntities are optional HA temperature sensor entities.
+	TemperatureEntities []string
+	// IndicatorEntity is an optional HA light/switch used as IndicatorLED.
+	IndicatorEntity string
+	// StateAny makes a system powered by several HA entities on when any
+	// of them is, rather than all.
+	StateAny bool
+	// BaseTopic is the Zigbee2MQTT base topic of the system's device
+	// (backend=zigbee2mqtt).
+	BaseTopic string
+	// SmartPlug holds the device ID, key, protocol version and channel of
+	// a local smart plug (backend=smartplug).
+	SmartPlug backend.SmartPlugConfig
+	// Quirks names the vendor quirks of a BMC (backend=ipmi).
+	Quirks string
+	// ResetTargets maps ResetTypes to a backend-specific action: an HA
+	// entity (backend=homeassistant) or a shell command (backend=command).
+	ResetTargets map[string]string
+	// shell runs the command hook.
+	shell backend.Shell
+}
+
+// ParseSystems parses the comma-separated id=target mapping. Each entry may
+// carry additional ;key=value options, e.g.
+//
+//	1=switch.node1;name=Node 1;model=NUC;serial=ABC123;mac=aa:bb:cc:dd:ee:ff/eno1;boot=Pxe;boot=Hdd
+//
+// Command hooks are run with shell.
+func ParseSystems(s string, shell backend.Shell) ([]Entry, error) {
+	var entries []Entry
+	// seen maps each ID to its entry, to report both of a duplicate.
+	seen := map[string]string{}
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		fields := strings.Split(e, ";")
+		parts := strings.SplitN(fields[0], "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid systems entry: %q (expected id=entity)", e)
+		}
+		entry := Entry{
+			ID:     strings.TrimSpace(parts[0]),
+			Target: strings.TrimSpace(parts[1]),
+			shell:  shell,
+		}
+		if err := validSystemID(entry.ID); err != nil {
+			return nil, fmt.Errorf("invalid systems entry %q: %w", e, err)
+		}
+		if entry.Target == "" {
+			return nil, fmt.Errorf("invalid systems entry %q: empty target", e)
+		}
+		if prev, ok := seen[entry.ID]; ok {
+			return nil, fmt.Errorf("duplicate system id %q in systems entries %q and %q", entry.ID, prev, e)
+		}
+		seen[entry.ID] = e
+		if err := entry.parseOptions(fields[1:]); err != nil {
+			return nil, fmt.Errorf("invalid systems entry %q: %w", e, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no valid systems parsed from --systems")
+	}
+	return entries, nil
+}
+
+// systemIDRe matches IDs that need no escaping in URLs.
+var systemIDRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// validSystemID accepts letters, digits, '-', '_' and '.', but not "." or
+// "..", which clients would resolve as path segments.
+func validSystemID(id string) error {
+	if id == "" {
+		return fmt.Errorf("empty system id")
+	}
+	if !systemIDRe.MatchString(id) || id == "." || id == ".." {
+		return fmt.Errorf("invalid system id %q (allowed: letters, digits, '-', '_' and '.')", id)
+	}
+	return nil
+}
+
+func (e *Entry) parseOptions(opts []string) error {
+	for _, opt := range opts {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(opt, "=")
+		if !ok {
+			return fmt.Errorf("invalid option %q (expected key=value)", opt)
+		}
+		k, v = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)
+		switch k {
+		case "name":
+			e.Info.Name = v
+		case "description":
+			e.Info.Description = v
+		case "manufacturer":
+			e.Info.Manufacturer = v
+		case "model":
+			e.Info.Model = v
+		case "serial":
+			e.Info.SerialNumber = v
+		case "uuid":
+			if !uuidRe.MatchString(v) {
+				return fmt.Errorf("invalid uuid %q", v)
+			}
+			e.Info.UUID = strings.ToLower(v)
+		case "power":
+			e.PowerEntity = v
+		case "energy":
+			e.EnergyEntity = v
+		case "led":
+			e.IndicatorEntity = v
+		case "temp":
+			e.TemperatureEntities = append(e.TemperatureEntities, v)
+		case "state":
+			switch v {
+			case "all":
+				e.StateAny = false
+			case "any":
+				e.StateAny = true
+			default:
+				return fmt.Errorf("invalid state %q (expected all or any)", v)
+			}
+		case "base":
+			e.BaseTopic = v
+		case "device":
+			e.SmartPlug.DeviceID = v
+		case "key":
+			e.SmartPlug.Key = v
+		case "version":
+			e.SmartPlug.Version = v
+		case "channel":
+			e.SmartPlug.Channel = v
+		case "quirks":
+			e.Quirks = v
+		case "dryrun":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid dryrun %q (expected true or false)", v)
+			}
+			e.Info.DryRun = b
+		case "critical":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid critical %q (expected true or false)", v)
+			}
+			e.Info.Critical = b
+		case "stability":
+			st, err := server.ParseStability(v)
+			if err != nil {
+				return err
+			}
+			e.Info.StateStability = st
+		case "boot":
+			if v == "" {
+				return fmt.Errorf("empty boot device")
+			}
+			e.Info.BootDevices = append(e.Info.BootDevices, v)
+		case "mac":
+			nic, err := parseNIC(v)
+			if err != nil {
+				return err
+			}
+			e.Info.EthernetInterfaces = append(e.Info.EthernetInterfaces, nic)
+		case "cpus":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid cpus %q (expected a positive number)", v)
+			}
+			e.Info.ProcessorCount = n
+		case "cpu":
+			e.Info.ProcessorModel = v
+		case "memory":
+			gib, err := strconv.ParseFloat(v, 64)
+			if err != nil || gib <= 0 {
+				return fmt.Errorf("invalid memory %q (expected GiB, e.g. 32)", v)
+			}
+			e.Info.MemoryGiB = gib
+		case "disk":
+			disk, err := parseDisk(v)
+			if err != nil {
+				return err
+			}
+			e.Info.Disks = append(e.Info.Disks, disk)
+		case "reset":
+			if err := e.parseReset(v); err != nil {
+				return err
+			}
+		case "wol":
+			if err := e.parseWakeOnLAN(v); err != nil {
+				return err
+			}
+		case "poweron-hook":
+			if e.hook().Run != nil {
+				return fmt.Errorf("only one of wol and poweron-hook may be set")
+			}
+			if v == "" {
+				return fmt.Errorf("empty poweron-hook command")
+			}
+			e.hook().Name = "command " + backend.MaskCommand(v)
+			sh := e.shell
+			e.hook().Run = func(ctx context.Context) error { return sh.Run(ctx, v) }
+		case "hook-delay":
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid hook-delay %q (expected a duration, e.g. 5s)", v)
+			}
+			e.hook().Delay = d
+		case "hook-retries":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid hook-retries %q (expected a number)", v)
+			}
+			e.hook().Retries = n
+		case "hook-strict":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid hook-strict %q (expected true or false)", v)
+			}
+			e.hook().Strict = b
+		default:
+			return fmt.Errorf("unknown option %q", k)
+		}
+	}
+	if h := e.Info.PostPowerOn; h != nil && h.Run == nil {
+		return fmt.Errorf("hook-delay, hook-retries and hook-strict require wol or poweron-hook")
+	}
+	return nil
+}
+
+// Defaults of the post-power-on hook options.
+const (
+	defaultHookDelay   = 5 * time.Second
+	defaultHookRetries = 2
+)
+
+// hook returns the post-power-on hook being configured, creating it with
+// the defaults.
+func (e *Entry) hook() *server.PostPowerOnHook {
+	if e.Info.PostPowerOn == nil {
+		e.Info.PostPowerOn = &server.PostPowerOnHook{Delay: defaultHookDelay, Retries: defaultHookRetries}
+	}
+	return e.Info.PostPowerOn
+}
+
+// parseWakeOnLAN parses a wol option of the form <mac>[@<host>[:<port>]]:
+// a Wake-on-LAN packet for mac, sent to the broadcast address host, after
+// every power-on.
+func (e *Entry) parseWakeOnLAN(v string) error {
+	if e.hook().Run != nil {
+		return fmt.Errorf("only one of wol and poweron-hook may be set")
+	}
+	mac, addr, ok := strings.Cut(v, "@")
+	hw, err := net.ParseMAC(strings.TrimSpace(mac))
+	if err != nil || len(hw) != 6 {
+		return fmt.Errorf("invalid wol %q (expected aa:bb:cc:dd:ee:ff[@broadcast address])", v)
+	}
+	addr = strings.TrimSpace(addr)
+	switch {
+	case !ok:
+		addr = backend.DefaultWakeOnLANAddr
+	case addr == "":
+		return fmt.Errorf("invalid wol %q: empty broadcast address", v)
+	default:
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "9")
+		}
+	}
+	e.hook().Name = "Wake-on-LAN " + hw.String()
+	e.hook().Run = func(ctx context.Context) error { return backend.WakeOnLAN(ctx, hw, addr) }
+	return nil
+}
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// resetTypes are the Redfish ResetTypes a reset option may map.
+var resetTypes = []string{
+	"On", "ForceOff", "GracefulShutdown", "GracefulRestart", "ForceRestart",
+	"Nmi", "ForceOn", "PushPowerButton", "PowerCycle", "Suspend", "Pause", "Resume",
+}
+
+// parseReset parses a reset option of the form <ResetType>:<target>. The
+// target is another ResetType to perform instead, "none" to withdraw the
+// ResetType, or otherwise a backend-specific action.
+func (e *Entry) parseReset(v string) error {
+	t, target, _ := strings.Cut(v, ":")
+	t, target = strings.TrimSpace(t), strings.TrimSpace(target)
+	if !slices.Contains(resetTypes, t) || target == "" {
+		return fmt.Errorf("invalid reset %q (expected <ResetType>:<ResetType, none, entity or command>)", v)
+	}
+	if e.Info.ResetMap[t] != "" || e.ResetTargets[t] != "" {
+		return fmt.Errorf("duplicate reset mapping for %s", t)
+	}
+	if target == server.ResetDisabled || slices.Contains(resetTypes, target) {
+		if e.Info.ResetMap == nil {
+			e.Info.ResetMap = map[string]string{}
+		}
+		e.Info.ResetMap[t] = target
+		return nil
+	}
+	if e.ResetTargets == nil {
+		e.ResetTargets = map[string]string{}
+	}
+	e.ResetTargets[t] = target
+	return nil
+}
+
+// checkResetTargets rejects backend-specific reset targets for backends
+// that cannot carry them out.
+func (e Entry) checkResetTargets(kind string) error {
+	if len(e.ResetTargets) > 0 && kind != "homeassistant" && kind != "command" {
+		return fmt.Errorf("system %s: reset entities and commands need backend homeassistant or command", e.ID)
+	}
+	return nil
+}
+
+// parseDisk parses a disk option of the form <size in GiB>[/<name>].
+func parseDisk(v string) (server.Disk, error) {
+	size, name, _ := strings.Cut(v, "/")
+	gib, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+	if err != nil || gib <= 0 {
+		return server.Disk{}, fmt.Errorf("invalid disk %q (expected <GiB>[/<name>])", v)
+	}
+	return server.Disk{Name: strings.TrimSpace(name), CapacityBytes: int64(gib * (1 << 30))}, nil
+}
+
+// parseNIC parses a mac option of the form <mac>[/<interface name>].
+func parseNIC(v string) (server.EthernetInterface, error) {
+	mac, name, _ := strings.Cut(v, "/")
+	hw, err := net.ParseMAC(strings.TrimSpace(mac))
+	if err != nil || len(hw) != 6 {
+		return server.EthernetInterface{}, fmt.Errorf("invalid mac %q (expected aa:bb:cc:dd:ee:ff)", mac)
+	}
+	return server.EthernetInterface{Name: strings.TrimSpace(name), MACAddress: hw.String()}, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+func TestValidSystemID(t *testing.T) {
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{"1", true},
+		{"node-1", true},
+		{"rack_2.node.3", true},
+		{"NUC", true},
+		{"...", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{"node 1", false},
+		{"node%201", false},
+		{"a?b", false},
+		{"a#b", false},
+		{"nœud", false},
+	}
+	for _, tt := range tests {
+		if err := validSystemID(tt.id); (err == nil) != tt.ok {
+			t.Errorf("validSystemID(%q) = %v, want ok %v", tt.id, err, tt.ok)
+		}
+	}
+}
+
+func TestParseSystems(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantIDs []string
+		// wantErr are substrings of the error; nil means success.
+		wantErr []string
+	}{
+		{in: "1=switch.a", wantIDs: []string{"1"}},
+		{in: " 1 = switch.a , node-2=switch.b;name=Node 2 ,", wantIDs: []string{"1", "node-2"}},
+		{in: "a.b=http://plug.lan:2", wantIDs: []string{"a.b"}},
+		{in: "1=switch.a,1=switch.b", wantErr: []string{`duplicate system id "1"`, `"1=switch.a"`, `"1=switch.b"`}},
+		{in: "1=switch.a;name=A,2=switch.b,1=switch.c", wantErr: []string{`"1=switch.a;name=A"`, `"1=switch.c"`}},
+		{in: "a/b=switch.a", wantErr: []string{`invalid system id "a/b"`}},
+		{in: "node 1=switch.a", wantErr: []string{`invalid system id "node 1"`}},
+		{in: "..=switch.a", wantErr: []string{`invalid system id ".."`}},
+		{in: "=switch.a", wantErr: []string{"empty system id"}},
+		{in: "1=", wantErr: []string{"empty target"}},
+		{in: "1= ;name=A", wantErr: []string{"empty target"}},
+		{in: "switch.a", wantErr: []string{"expected id=entity"}},
+		{in: " , ", wantErr: []string{"no valid systems"}},
+	}
+	for _, tt := range tests {
+		entries, err := ParseSystems(tt.in, backend.DefaultShell())
+		if tt.wantErr != nil {
+			if err == nil {
+				t.Errorf("ParseSystems(%q) succeeded, want an error", tt.in)
+				continue
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("ParseSystems(%q) = %v, want it to mention %s", tt.in, err, want)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSystems(%q): %v", tt.in, err)
+			continue
+		}
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		if !slices.Equal(ids, tt.wantIDs) {
+			t.Errorf("ParseSystems(%q) IDs = %v, want %v", tt.in, ids, tt.wantIDs)
+		}
+	}
+}
+
+func TestBuildSystemID(t *testing.T) {
+	if _, err := Build(Options{Backend: "noop", SystemID: "node-1"}); err != nil {
+		t.Errorf("Build with --system-id node-1: %v", err)
+	}
+	for _, id := range []string{"", "a/b", "node 1"} {
+		if _, err := Build(Options{Backend: "noop", SystemID: id}); err == nil || !strings.Contains(err.Error(), "--system-id") {
+			t.Errorf("Build with --system-id %q = %v, want an invalid --system-id error", id, err)
+		}
+	}
+}
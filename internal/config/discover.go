@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// Discovering reports whether the Home Assistant systems are discovered
+// rather than only configured.
+func (o Options) Discovering() bool {
+	return o.Backend == "homeassistant" && (o.HADiscoverLabel != "" || o.HADiscoverArea != "")
+}
+
+// Discover builds the configured Home Assistant systems like Build and adds
+// a system for every switch entity matching HADiscoverLabel and
+// HADiscoverArea, all sharing client. The ID of a discovered system is the
+// sanitized object ID of its entity (switch.rack_node_1 becomes
+// rack_node_1). Configured systems always win: entities they already map
+// are not added again, and a discovered ID that is configured for another
+// entity is skipped, as are IDs that several entities sanitize to.
+func Discover(ctx context.Context, o Options, client *http.Client) ([]System, error) {
+	if !o.Discovering() {
+		return nil, errors.New("discovery requires backend homeassistant and a label or area")
+	}
+	if o.HAURL == "" || o.HAToken == "" {
+		return nil, errors.New("homeassistant discovery requires baseURL and token")
+	}
+	if err := o.checkMiddleware(); err != nil {
+		return nil, err
+	}
+	states := o.haStates(client)
+	var systems []System
+	if o.Systems != "" || o.HAEntity != "" {
+		single, err := o.single()
+		if err != nil {
+			return nil, err
+		}
+		if systems, err = o.homeAssistant(single, client, states); err != nil {
+			return nil, err
+		}
+	}
+	entities, err := backend.DiscoverHASwitches(ctx, client, o.HAURL, o.HAToken, o.HADiscoverLabel, o.HADiscoverArea)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	configured := map[string]string{}
+	mapped := map[string]bool{}
+	for _, sys := range systems {
+		configured[sys.ID] = sys.Target
+		for _, e := range strings.Split(sys.Target, "+") {
+			mapped[strings.TrimSpace(e)] = true
+		}
+	}
+	byID := map[string][]string{}
+	var ids []string
+	for _, entity := range entities {
+		if mapped[entity] {
+			continue
+		}
+		id := discoveredID(entity)
+		if id == "" {
+			log.Printf("discovery: skipping %s: no usable system ID in its object ID", entity)
+			continue
+		}
+		if _, ok := byID[id]; !ok {
+			ids = append(ids, id)
+		}
+		byID[id] = append(byID[id], entity)
+	}
+	for _, id := range ids {
+		candidates := byID[id]
+		if target, ok := configured[id]; ok {
+			log.Printf("discovery: skipping %s: system ID %s is configured for %s", strings.Join(candidates, ", "), id, target)
+			continue
+		}
+		if len(candidates) > 1 {
+			log.Printf("discovery: skipping %s: they all map to system ID %s; configure them in --systems", strings.Join(candidates, ", "), id)
+			continue
+		}
+		be, err := newHomeAssistant(o, Entry{ID: id, Target: candidates[0]}, client, states)
+		if err != nil {
+			return nil, fmt.Errorf("backend init (%s): %w", id, err)
+		}
+		systems = append(systems, System{ID: id, Kind: o.Backend, Target: candidates[0], Backend: backend.Adapt(be), Discovered: true})
+	}
+	return o.wrap(systems), nil
+}
+
+// discoveredID derives a system ID from an entity ID: its object ID,
+// lower-cased, with runs of characters other than letters, digits, '_'
+// and '-' replaced by a single '-'.
+func discoveredID(entity string) string {
+	_, object, _ := strings.Cut(entity, ".")
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(object) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
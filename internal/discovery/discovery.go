@@ -0,0 +1,175 @@
+// Package discovery advertises the Redfish service on the local network
+// via SSDP (as defined by DSP0266) and mDNS (_redfish._tcp).
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Config describes the service being advertised.
+type Config struct {
+	// Interfaces restricts advertisement to the named interfaces. Empty
+	// means every up, multicast-capable, non-loopback interface.
+	Interfaces []string
+	// Scheme and Port are those of the listener clients should use.
+	Scheme string
+	Port   int
+	// Location, if set, is the service root URL announced instead of one
+	// built from the interface address, Scheme and Port.
+	Location string
+	// UUID is the ServiceRoot UUID.
+	UUID string
+	// Name is the mDNS instance name; it defaults to "bmc-shim-<host>".
+	Name string
+}
+
+// iface is an interface advertised on, with the IPv4 address announced
+// for it.
+type iface struct {
+	ifi  *net.Interface
+	ip   net.IP
+	nets []*net.IPNet
+}
+
+// owns reports whether a peer address is on one of the interface's subnets.
+func (i iface) owns(ip net.IP) bool {
+	for _, n := range i.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Advertiser answers SSDP and mDNS queries for the service.
+type Advertiser struct {
+	ssdp []*ssdp
+	mdns []*mdns
+}
+
+// New selects the interfaces and joins the multicast groups on them.
+func New(cfg Config) (*Advertiser, error) {
+	if cfg.Name == "" {
+		host, _ := os.Hostname()
+		host, _, _ = strings.Cut(host, ".")
+		cfg.Name = "bmc-shim-" + host
+	}
+	ifaces, err := selectInterfaces(cfg.Interfaces)
+	if err != nil {
+		return nil, err
+	}
+	a := &Advertiser{}
+	for _, i := range ifaces {
+		ssdp, err := newSSDP(cfg, i)
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		a.ssdp = append(a.ssdp, ssdp)
+		mdns, err := newMDNS(cfg, i)
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		a.mdns = append(a.mdns, mdns)
+		log.Printf("advertising %s on %s (SSDP, mDNS %s)", ssdp.location(), i.ifi.Name, mdns.instance())
+	}
+	return a, nil
+}
+
+func (a *Advertiser) close() {
+	for _, s := range a.ssdp {
+		_ = s.conn.Close()
+	}
+	for _, m := range a.mdns {
+		_ = m.conn.Close()
+	}
+}
+
+// Run advertises the service until ctx is done, then says goodbye.
+func (a *Advertiser) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range a.ssdp {
+		wg.Go(func() { s.run(ctx) })
+	}
+	for _, m := range a.mdns {
+		wg.Go(func() { m.run(ctx) })
+	}
+	wg.Wait()
+}
+
+func selectInterfaces(names []string) ([]iface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []iface
+	for idx := range all {
+		ifi := &all[idx]
+		if len(names) > 0 {
+			found := false
+			for _, n := range names {
+				found = found || n == ifi.Name
+			}
+			if !found {
+				continue
+			}
+		} else if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %w", ifi.Name, err)
+		}
+		i := iface{ifi: ifi}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+				if i.ip == nil {
+					i.ip = n.IP.To4()
+				}
+				i.nets = append(i.nets, n)
+			}
+		}
+		if i.ip == nil {
+			if len(names) > 0 {
+				return nil, fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+			}
+			continue
+		}
+		out = append(out, i)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no interface to advertise on")
+	}
+	return out, nil
+}
+
+// listen joins group on the interface and returns the receiving socket.
+func listen(i iface, group *net.UDPAddr) (*net.UDPConn, error) {
+	conn, err := net.ListenMulticastUDP("udp4", i.ifi, group)
+	if err != nil {
+		return nil, fmt.Errorf("join %s on %s: %w", group, i.ifi.Name, err)
+	}
+	return conn, nil
+}
+
+// sendMulticast sends b to group out of the interface, by binding the
+// interface's address as the source.
+func sendMulticast(i iface, group *net.UDPAddr, b []byte) error {
+	conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: i.ip}, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, err = conn.Write(b)
+	return err
+}
@@ -0,0 +1,239 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	mdnsTTL     = 120
+	serviceName = "_redfish._tcp.local."
+
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+	typeANY = 255
+
+	classIN    = 1
+	cacheFlush = 0x8000
+	unicastQU  = 0x8000
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+type mdns struct {
+	cfg  Config
+	i    iface
+	conn *net.UDPConn
+}
+
+func newMDNS(cfg Config, i iface) (*mdns, error) {
+	conn, err := listen(i, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	return &mdns{cfg: cfg, i: i, conn: conn}, nil
+}
+
+func (m *mdns) instance() string { return m.cfg.Name + "." + serviceName }
+func (m *mdns) host() string     { return m.cfg.Name + ".local." }
+
+func (m *mdns) run(ctx context.Context) {
+	go func() {
+		// Announce twice, a second apart (RFC 6762 section 8.3).
+		for range 2 {
+			m.announce(mdnsTTL)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		m.announce(0)
+		_ = m.conn.Close()
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, peer, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("mdns %s: %v", m.i.ifi.Name, err)
+			}
+			return
+		}
+		if !m.i.owns(peer.IP) {
+			continue
+		}
+		id, qs, err := parseQuery(buf[:n])
+		if err != nil || !m.matches(qs) {
+			continue
+		}
+		if peer.Port != mdnsGroup.Port {
+			// Legacy unicast query: answer the sender directly, echoing
+			// the ID and questions (RFC 6762 section 6.7).
+			_, _ = m.conn.WriteToUDP(m.response(id, qs, 10), peer)
+			continue
+		}
+		unicast := false
+		for _, q := range qs {
+			unicast = unicast || q.class&unicastQU != 0
+		}
+		if unicast {
+			_, _ = m.conn.WriteToUDP(m.response(0, nil, mdnsTTL), peer)
+		} else {
+			m.announce(mdnsTTL)
+		}
+	}
+}
+
+func (m *mdns) matches(qs []question) bool {
+	for _, q := range qs {
+		switch strings.ToLower(q.name) {
+		case strings.ToLower(serviceName), strings.ToLower(m.instance()), strings.ToLower(m.host()):
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mdns) announce(ttl uint32) {
+	if err := sendMulticast(m.i, mdnsGroup, m.response(0, nil, ttl)); err != nil {
+		log.Printf("mdns announce on %s: %v", m.i.ifi.Name, err)
+	}
+}
+
+// response builds a response carrying all records of the service.
+func (m *mdns) response(id uint16, qs []question, ttl uint32) []byte {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = binary.BigEndian.AppendUint16(b, 0x8400) // response, authoritative
+	b = binary.BigEndian.AppendUint16(b, uint16(len(qs)))
+	b = binary.BigEndian.AppendUint16(b, 4)
+	b = binary.BigEndian.AppendUint16(b, 0)
+	b = binary.BigEndian.AppendUint16(b, 0)
+	for _, q := range qs {
+		b = appendName(b, q.name)
+		b = binary.BigEndian.AppendUint16(b, q.typ)
+		b = binary.BigEndian.AppendUint16(b, q.class&^unicastQU)
+	}
+
+	b = appendRR(b, serviceName, typePTR, classIN, ttl, appendName(nil, m.instance()))
+
+	srv := binary.BigEndian.AppendUint16(nil, 0) // priority
+	srv = binary.BigEndian.AppendUint16(srv, 0)  // weight
+	srv = binary.BigEndian.AppendUint16(srv, uint16(m.cfg.Port))
+	srv = appendName(srv, m.host())
+	b = appendRR(b, m.instance(), typeSRV, classIN|cacheFlush, ttl, srv)
+
+	var txt []byte
+	for _, kv := range []string{"path=/redfish/v1/", "scheme=" + m.cfg.Scheme, "uuid=" + m.cfg.UUID} {
+		txt = append(txt, byte(len(kv)))
+		txt = append(txt, kv...)
+	}
+	b = appendRR(b, m.instance(), typeTXT, classIN|cacheFlush, ttl, txt)
+
+	return appendRR(b, m.host(), typeA, classIN|cacheFlush, ttl, m.i.ip.To4())
+}
+
+func appendRR(b []byte, name string, typ, class uint16, ttl uint32, rdata []byte) []byte {
+	b = appendName(b, name)
+	b = binary.BigEndian.AppendUint16(b, typ)
+	b = binary.BigEndian.AppendUint16(b, class)
+	b = binary.BigEndian.AppendUint32(b, ttl)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+// appendName encodes a dotted name without compression.
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+type question struct {
+	name       string
+	typ, class uint16
+}
+
+var errMalformed = errors.New("malformed DNS message")
+
+// parseQuery returns the ID and questions of a DNS query; responses are
+// rejected.
+func parseQuery(msg []byte) (uint16, []question, error) {
+	if len(msg) < 12 {
+		return 0, nil, errMalformed
+	}
+	if msg[2]&0x80 != 0 {
+		return 0, nil, errors.New("not a query")
+	}
+	id := binary.BigEndian.Uint16(msg)
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	off := 12
+	qs := make([]question, 0, qd)
+	for range qd {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return 0, nil, err
+		}
+		if next+4 > len(msg) {
+			return 0, nil, errMalformed
+		}
+		q := question{name: name, typ: binary.BigEndian.Uint16(msg[next:]), class: binary.BigEndian.Uint16(msg[next+2:])}
+		if q.typ == typePTR || q.typ == typeSRV || q.typ == typeTXT || q.typ == typeA || q.typ == typeANY {
+			qs = append(qs, q)
+		}
+		off = next + 4
+	}
+	return id, qs, nil
+}
+
+// readName decodes a possibly compressed name at off and returns it with
+// the offset following it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for hops := 0; hops < 32; hops++ {
+		if off >= len(msg) {
+			return "", 0, errMalformed
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+	return "", 0, fmt.Errorf("%w: too many compression pointers", errMalformed)
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// redfishST is the SSDP search target of a Redfish service (DSP0266).
+	redfishST = "urn:dmtf-org:service:redfish-rest:1"
+	// ssdpMaxAge is announced in CACHE-CONTROL; NOTIFYs repeat at half of it.
+	ssdpMaxAge = 1800
+)
+
+const (
+	// SSDPPort is the UDP port SSDP is answered on.
+	SSDPPort = 1900
+	// SSDPNotifyInterval is how often, in seconds, alive NOTIFYs are sent.
+	SSDPNotifyInterval = ssdpMaxAge / 2
+)
+
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: SSDPPort}
+
+type ssdp struct {
+	cfg  Config
+	i    iface
+	conn *net.UDPConn
+}
+
+func newSSDP(cfg Config, i iface) (*ssdp, error) {
+	conn, err := listen(i, ssdpGroup)
+	if err != nil {
+		return nil, err
+	}
+	return &ssdp{cfg: cfg, i: i, conn: conn}, nil
+}
+
+func (s *ssdp) location() string {
+	if s.cfg.Location != "" {
+		return s.cfg.Location
+	}
+	return fmt.Sprintf("%s://%s/redfish/v1/", s.cfg.Scheme, net.JoinHostPort(s.i.ip.String(), fmt.Sprint(s.cfg.Port)))
+}
+
+func (s *ssdp) usn() string {
+	return "uuid:" + s.cfg.UUID + "::" + redfishST
+}
+
+func (s *ssdp) run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.notify("ssdp:byebye")
+		_ = s.conn.Close()
+	}()
+	go func() {
+		t := time.NewTicker(SSDPNotifyInterval * time.Second)
+		defer t.Stop()
+		for {
+			s.notify("ssdp:alive")
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	buf := make([]byte, 2048)
+	for {
+		n, peer, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("ssdp %s: %v", s.i.ifi.Name, err)
+			}
+			return
+		}
+		// Every interface's socket sees the group's traffic; only answer
+		// peers on our own subnets so the LOCATION is reachable.
+		if !s.i.owns(peer.IP) {
+			continue
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "M-SEARCH" || req.Header.Get("Man") != `"ssdp:discover"` {
+			continue
+		}
+		switch st := req.Header.Get("St"); st {
+		case redfishST, "ssdp:all":
+			s.reply(peer)
+		}
+	}
+}
+
+func (s *ssdp) reply(peer *net.UDPAddr) {
+	msg := strings.Join([]string{
+		"HTTP/1.1 200 OK",
+		fmt.Sprintf("CACHE-CONTROL: max-age=%d", ssdpMaxAge),
+		"EXT:",
+		"ST: " + redfishST,
+		"USN: " + s.usn(),
+		"AL: " + s.location(),
+		"LOCATION: " + s.location(),
+		"", "",
+	}, "\r\n")
+	if _, err := s.conn.WriteToUDP([]byte(msg), peer); err != nil {
+		log.Printf("ssdp reply to %s: %v", peer, err)
+	}
+}
+
+func (s *ssdp) notify(nts string) {
+	msg := strings.Join([]string{
+		"NOTIFY * HTTP/1.1",
+		"HOST: " + ssdpGroup.String(),
+		fmt.Sprintf("CACHE-CONTROL: max-age=%d", ssdpMaxAge),
+		"NT: " + redfishST,
+		"NTS: " + nts,
+		"USN: " + s.usn(),
+		"AL: " + s.location(),
+		"LOCATION: " + s.location(),
+		"", "",
+	}, "\r\n")
+	if err := sendMulticast(s.i, ssdpGroup, []byte(msg)); err != nil {
+		log.Printf("ssdp notify on %s: %v", s.i.ifi.Name, err)
+	}
+}
@@ -0,0 +1,169 @@
+// Package redfish defines the Redfish resources bmc-shim serves, so that
+// the server renders and the client decodes the same types.
+package redfish
+
+import "encoding/json"
+
+// ODataVersion is the OData protocol version of every response.
+const ODataVersion = "4.0"
+
+// Version is the Redfish protocol version the service root reports.
+const Version = "1.6.0"
+
+// Link references another resource.
+type Link struct {
+	ODataID string `json:"@odata.id"`
+}
+
+// Message is an entry of @Message.ExtendedInfo.
+type Message struct {
+	ODataType   string   `json:"@odata.type"`
+	MessageID   string   `json:"MessageId"`
+	Message     string   `json:"Message"`
+	MessageArgs []string `json:"MessageArgs,omitempty"`
+	Severity    string   `json:"Severity"`
+	Resolution  string   `json:"Resolution,omitempty"`
+	// RelatedProperties are JSON pointers to the properties of the
+	// request the message is about.
+	RelatedProperties []string `json:"RelatedProperties,omitempty"`
+}
+
+// ServiceRoot is /redfish/v1/. Services that are optional or not always
+// enabled are pointers, so that only those actually served are
+// advertised.
+type ServiceRoot struct {
+	ODataType      string `json:"@odata.type"`
+	ODataID        string `json:"@odata.id"`
+	ID             string `json:"Id"`
+	Name           string `json:"Name"`
+	RedfishVersion string `json:"RedfishVersion"`
+	UUID           string `json:"UUID"`
+	Systems        Link   `json:"Systems"`
+	Chassis        Link   `json:"Chassis"`
+	Managers       Link   `json:"Managers"`
+	Registries     Link   `json:"Registries"`
+	JsonSchemas    Link   `json:"JsonSchemas"`
+	AccountService Link   `json:"AccountService"`
+	EventService   Link   `json:"EventService"`
+	// CertificateService is only served for a certificate that can be
+	// replaced.
+	CertificateService *Link          `json:"CertificateService,omitempty"`
+	Oem                map[string]any `json:"Oem,omitempty"`
+}
+
+// Collection is a resource collection whose members are links or, with
+// $expand, the resources themselves.
+type Collection[T any] struct {
+	ODataType    string `json:"@odata.type,omitempty"`
+	ODataID      string `json:"@odata.id"`
+	Name         string `json:"Name"`
+	Members      []T    `json:"Members"`
+	MembersCount int    `json:"Members@odata.count"`
+	NextLink     string `json:"Members@odata.nextLink,omitempty"`
+}
+
+// ComputerSystem is /redfish/v1/Systems/{id}.
+type ComputerSystem struct {
+	ODataType string `json:"@odata.type"`
+	ODataID   string `json:"@odata.id"`
+	// Settings points at the pending settings resource.
+	Settings     *Settings `json:"@Redfish.Settings,omitempty"`
+	ID           string    `json:"Id"`
+	Name         string    `json:"Name"`
+	Description  string    `json:"Description,omitempty"`
+	UUID         string    `json:"UUID"`
+	Manufacturer string    `json:"Manufacturer,omitempty"`
+	Model        string    `json:"Model,omitempty"`
+	SerialNumber string    `json:"SerialNumber,omitempty"`
+	AssetTag     string    `json:"AssetTag"`
+	HostName     string    `json:"HostName"`
+	PowerState   string    `json:"PowerState"`
+	// LastResetTime is when the system was last reset or seen to change
+	// its power state.
+	LastResetTime string `json:"LastResetTime,omitempty"`
+	// Status is only reported for systems with power state hysteresis
+	// or whose power state is unknown.
+	Status map[string]string `json:"Status,omitempty"`
+	// PowerStateInfo explains a PowerState that is the last known one
+	// because the backend could not be queried.
+	PowerStateInfo     []Message         `json:"PowerState@Message.ExtendedInfo,omitempty"`
+	IndicatorLED       string            `json:"IndicatorLED,omitempty"`
+	ProcessorSummary   *ProcessorSummary `json:"ProcessorSummary,omitempty"`
+	MemorySummary      *MemorySummary    `json:"MemorySummary,omitempty"`
+	SimpleStorage      *Link             `json:"SimpleStorage,omitempty"`
+	Boot               Boot              `json:"Boot"`
+	EthernetInterfaces *Link             `json:"EthernetInterfaces,omitempty"`
+	LogServices        Link              `json:"LogServices"`
+	Links              SystemLinks       `json:"Links"`
+	Actions            SystemActions     `json:"Actions"`
+	Oem                map[string]any    `json:"Oem,omitempty"`
+	// Overrides replace properties of the JSON, whatever the fields say.
+	Overrides map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON marshals the system with its Overrides applied.
+func (c ComputerSystem) MarshalJSON() ([]byte, error) {
+	type plain ComputerSystem
+	b, err := json.Marshal(plain(c))
+	if err != nil || len(c.Overrides) == 0 {
+		return b, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range c.Overrides {
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// Settings is the @Redfish.Settings annotation of a resource whose
+// changes are written to a separate settings resource.
+type Settings struct {
+	ODataType           string    `json:"@odata.type"`
+	SettingsObject      Link      `json:"SettingsObject"`
+	Time                string    `json:"Time,omitempty"`
+	Messages            []Message `json:"Messages,omitempty"`
+	SupportedApplyTimes []string  `json:"SupportedApplyTimes"`
+}
+
+// ProcessorSummary summarizes the processors of a ComputerSystem.
+type ProcessorSummary struct {
+	Count int    `json:"Count,omitempty"`
+	Model string `json:"Model,omitempty"`
+}
+
+// MemorySummary summarizes the memory of a ComputerSystem.
+type MemorySummary struct {
+	TotalSystemMemoryGiB float64 `json:"TotalSystemMemoryGiB"`
+}
+
+// Boot is the boot override of a ComputerSystem.
+type Boot struct {
+	BootSourceOverrideTarget     string   `json:"BootSourceOverrideTarget"`
+	BootSourceOverrideEnabled    string   `json:"BootSourceOverrideEnabled"`
+	AllowableTargets             []string `json:"BootSourceOverrideTarget@Redfish.AllowableValues"`
+	BootSourceOverrideMode       string   `json:"BootSourceOverrideMode,omitempty"`
+	AllowableModes               []string `json:"BootSourceOverrideMode@Redfish.AllowableValues,omitempty"`
+	UefiTargetBootSourceOverride string   `json:"UefiTargetBootSourceOverride,omitempty"`
+	BootOrder                    []string `json:"BootOrder,omitempty"`
+}
+
+// SystemLinks are the related resources of a ComputerSystem.
+type SystemLinks struct {
+	ManagedBy []Link `json:"ManagedBy"`
+	Chassis   []Link `json:"Chassis"`
+}
+
+// SystemActions are the actions of a ComputerSystem.
+type SystemActions struct {
+	Reset ResetAction `json:"#ComputerSystem.Reset"`
+}
+
+// ResetAction describes a Reset action and the reset types it accepts.
+type ResetAction struct {
+	Target          string   `json:"target"`
+	ActionInfo      string   `json:"@Redfish.ActionInfo"`
+	AllowableValues []string `json:"ResetType@Redfish.AllowableValues"`
+}
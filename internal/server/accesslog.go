@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLogBodyBytes is how much of a request body the access log shows
+// by default.
+const DefaultLogBodyBytes = 4096
+
+// secretBodyPaths are the path prefixes whose request bodies may hold
+// passwords or private keys.
+var secretBodyPaths = []string{"/redfish/v1/AccountService", "/redfish/v1/CertificateService"}
+
+// secretBodyPath reports whether request bodies to p may hold secrets.
+func secretBodyPath(p string) bool {
+	for _, prefix := range secretBodyPaths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipBodyLog reports whether the body of r is left out of the access log:
+// bodies that are not JSON (uploads, forms), those of paths that carry no
+// interesting input and those that may hold secrets. r is the request with
+// any URL prefix stripped.
+func skipBodyLog(r *http.Request) bool {
+	if healthPaths[r.URL.Path] || r.URL.Path == "/metrics" || isDebugPath(r.URL.Path) || secretBodyPath(r.URL.Path) {
+		return true
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		// Redfish clients commonly omit it; the body is JSON anyway.
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	return err != nil || (mt != "application/json" && !strings.HasSuffix(mt, "+json"))
+}
+
+// loggingMiddleware writes a REQ line when a request arrives and a RES
+// line with the status, response size and duration when it is done. The
+// request body is never buffered: what the handler reads is copied, up to
+// Config.LogBodyBytes, into the RES line.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		client := clientIP(r)
+		log.Printf("REQ: %s %s Client: %s RemoteAddr: %s", r.Method, r.URL.RequestURI(), client, r.RemoteAddr)
+
+		var body *cappedBuffer
+		if s.cfg.LogBodyBytes > 0 && r.Body != nil && r.Body != http.NoBody && !skipBodyLog(s.unprefixed(r)) {
+			body = &cappedBuffer{max: s.cfg.LogBodyBytes}
+			r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, body), Closer: r.Body}
+		}
+		r, p := withPrincipalSlot(r)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		user := p.Name
+		if user == "" {
+			user = "-"
+		}
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		if body != nil && body.buf.Len() > 0 {
+			log.Printf("RES: %s %s Client: %s RemoteAddr: %s User: %s Status: %d Bytes: %d Body: %s (%v)", r.Method, r.URL.RequestURI(), client, r.RemoteAddr, user, sw.status, sw.bytes, body, time.Since(start))
+			return
+		}
+		log.Printf("RES: %s %s Client: %s RemoteAddr: %s User: %s Status: %d Bytes: %d (%v)", r.Method, r.URL.RequestURI(), client, r.RemoteAddr, user, sw.status, sw.bytes, time.Since(start))
+	})
+}
+
+// teeReadCloser is a request body whose reads are copied elsewhere.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cappedBuffer keeps the first max bytes written to it and counts the
+// rest. Writes never fail, so it cannot disturb the reader it tees.
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	n := min(len(p), c.max-c.buf.Len())
+	c.buf.Write(p[:n])
+	c.dropped += len(p) - n
+	return len(p), nil
+}
+
+func (c *cappedBuffer) String() string {
+	if c.dropped > 0 {
+		return c.buf.String() + "... (" + strconv.Itoa(c.dropped) + " more bytes)"
+	}
+	return c.buf.String()
+}
+
+// statusWriter records the status and the number of body bytes of a
+// response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
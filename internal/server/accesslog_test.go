@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// TestSecretBodiesRedactedUnderPrefix checks that bodies that may hold
+// secrets stay out of the access log and captures whether the service is
+// reached with or without its URL prefix.
+func TestSecretBodiesRedactedUnderPrefix(t *testing.T) {
+	const secret = "hunter2-secret"
+	tests := []struct {
+		name   string
+		prefix string
+		path   string
+		header http.Header
+	}{
+		{"no prefix", "", "/redfish/v1/AccountService/Accounts", nil},
+		{"configured prefix", "/bmc/node3", "/bmc/node3/redfish/v1/AccountService/Accounts", nil},
+		{"forwarded prefix", "", "/proxied/redfish/v1/CertificateService/Actions/CertificateService.ReplaceCertificate", http.Header{"X-Forwarded-Prefix": {"/proxied"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			s := New(Config{
+				Systems:        map[string]backend.System{"1": backend.NewNoop()},
+				URLPrefix:      tt.prefix,
+				TrustedProxies: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+				LogBodyBytes:   DefaultLogBodyBytes,
+			})
+			dir := t.TempDir()
+			c, err := newCapturer(dir, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.capture = c
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"UserName":"ops","Password":"`+secret+`"}`))
+			req.RemoteAddr = "192.0.2.1:4242"
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+			if strings.Contains(logs.String(), secret) {
+				t.Errorf("access log holds the secret:\n%s", logs.String())
+			}
+			files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("captured files = %v, %v, want one", files, err)
+			}
+			b, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(b), secret) {
+				t.Errorf("capture holds the secret:\n%s", b)
+			}
+			if !strings.Contains(string(b), "[REDACTED]") {
+				t.Errorf("capture does not redact the body:\n%s", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const accountsPath = "/redfish/v1/AccountService/Accounts"
+
+// Redfish role IDs of our roles.
+var redfishRoles = map[string]string{
+	RoleReader:   "ReadOnly",
+	RoleOperator: "Operator",
+}
+
+// rolePrivileges are the Redfish privileges of each role. Every account
+// may change its own password.
+var rolePrivileges = map[string][]string{
+	"ReadOnly": {"Login", "ConfigureSelf"},
+	"Operator": {"Login", "ConfigureSelf", "ConfigureComponents"},
+}
+
+// account is a configured basic auth account as listed by the
+// AccountService.
+type account struct {
+	User
+	// fromFile is set for Config.UsersFile accounts, the only ones whose
+	// password can be changed through the API.
+	fromFile bool
+}
+
+// accounts returns the --user account, if any, and those of the users
+// file.
+func (s *Server) accounts() []account {
+	var accts []account
+	if s.cfg.Username != "" {
+		accts = append(accts, account{User: User{Name: s.cfg.Username, Role: RoleOperator}})
+	}
+	if users := s.users.Load(); users != nil {
+		for _, u := range *users {
+			accts = append(accts, account{User: u, fromFile: true})
+		}
+	}
+	return accts
+}
+
+// visibleAccounts returns the accounts the client of r may see: all of
+// them for unscoped operators, otherwise only its own.
+func (s *Server) visibleAccounts(r *http.Request) []account {
+	accts := s.accounts()
+	p, ok := requestPrincipal(r)
+	if !ok || (p.Role == RoleOperator && p.Systems == nil) {
+		return accts
+	}
+	var own []account
+	for _, a := range accts {
+		if a.Name == p.Name {
+			own = append(own, a)
+		}
+	}
+	return own
+}
+
+// isOwnAccountPatch reports whether r modifies the account of p itself,
+// which every role may do.
+func isOwnAccountPatch(p principal, r *http.Request) bool {
+	return r.Method == http.MethodPatch && r.URL.Path == accountsPath+"/"+p.Name
+}
+
+func (s *Server) handleAccountService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":    "#AccountService.v1_5_0.AccountService",
+		"@odata.id":      "/redfish/v1/AccountService",
+		"Id":             "AccountService",
+		"Name":           "Account Service",
+		"ServiceEnabled": true,
+		"Accounts":       map[string]string{"@odata.id": accountsPath},
+		"Roles":          map[string]string{"@odata.id": "/redfish/v1/AccountService/Roles"},
+	})
+}
+
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	accts := s.visibleAccounts(r)
+	members := make([]map[string]string, 0, len(accts))
+	for _, a := range accts {
+		members = append(members, map[string]string{"@odata.id": accountsPath + "/" + url.PathEscape(a.Name)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":         "#ManagerAccountCollection.ManagerAccountCollection",
+		"@odata.id":           accountsPath,
+		"Name":                "Accounts Collection",
+		"Members":             members,
+		"Members@odata.count": len(members),
+	})
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, accountsPath+"/")
+	var acct account
+	found := false
+	for _, a := range s.visibleAccounts(r) {
+		if a.Name == name {
+			acct, found = a, true
+		}
+	}
+	if !found {
+		writeNotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, accountResource(acct))
+	case http.MethodPatch:
+		s.patchAccount(w, r, acct)
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPatch)
+	}
+}
+
+// accountResource renders a ManagerAccount. The password is never shown.
+func accountResource(a account) map[string]any {
+	role := redfishRoles[a.Role]
+	acct := map[string]any{
+		"@odata.type": "#ManagerAccount.v1_4_0.ManagerAccount",
+		"@odata.id":   accountsPath + "/" + url.PathEscape(a.Name),
+		"Id":          a.Name,
+		"Name":        "User Account",
+		"UserName":    a.Name,
+		"RoleId":      role,
+		"Enabled":     true,
+		"Locked":      false,
+		"Password":    nil,
+		"Links": map[string]any{
+			"Role": map[string]string{"@odata.id": "/redfish/v1/AccountService/Roles/" + role},
+		},
+	}
+	if a.Systems != nil {
+		acct["Oem"] = map[string]any{"BmcShim": map[string]any{"Systems": a.Systems}}
+	}
+	return acct
+}
+
+// accountReadOnly lists ManagerAccount properties we render but which
+// clients may not PATCH.
+var accountReadOnly = map[string]bool{
+	"@odata.id": true, "@odata.type": true, "Id": true, "Name": true, "UserName": true,
+	"RoleId": true, "Enabled": true, "Locked": true, "Links": true, "Oem": true,
+}
+
+// patchAccount changes the password of an account. Only the account
+// itself may do so, authenticated with its current password, so that a
+// leaked API key or token cannot take over an account.
+func (s *Server) patchAccount(w http.ResponseWriter, r *http.Request, acct account) {
+	body, ok := s.decodeBody(w, r, schemaManagerAccount)
+	if !ok {
+		return
+	}
+	var password string
+	var msgs []message
+	for prop, raw := range body {
+		switch {
+		case prop == "Password":
+			if err := json.Unmarshal(raw, &password); err != nil {
+				msgs = append(msgs, msgPropertyValueTypeError(string(raw), prop))
+				continue
+			}
+			if !acct.fromFile {
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+				continue
+			}
+			if !validPassword(password) {
+				// Never echo the password.
+				msgs = append(msgs, msgPropertyValueFormatError("******", prop))
+			}
+		case accountReadOnly[prop]:
+			msgs = append(msgs, msgPropertyNotWritable(prop))
+		default:
+			msgs = append(msgs, msgPropertyUnknown(prop))
+		}
+	}
+	if len(msgs) > 0 {
+		writeError(w, http.StatusBadRequest, msgs...)
+		return
+	}
+	if password == "" {
+		writeError(w, http.StatusBadRequest, msgPropertyMissing("Password"))
+		return
+	}
+	usr, pwd, basic := r.BasicAuth()
+	if _, ok := s.lookupUser(usr, pwd); !ok || !basic || usr != acct.Name {
+		writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
+		return
+	}
+	if err := s.setUserPassword(acct.Name, password); err != nil {
+		log.Printf("account %s: change password: %v", acct.Name, err)
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	log.Printf("account %s changed its password", acct.Name)
+	writeJSON(w, http.StatusOK, accountResource(acct))
+}
+
+// validPassword accepts 8 to 128 printable characters without white
+// space, which the users file format cannot hold.
+func validPassword(v string) bool {
+	if len(v) < 8 || len(v) > 128 {
+		return false
+	}
+	for _, c := range v {
+		if unicode.IsSpace(c) || !unicode.IsPrint(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// setUserPassword rewrites the users file line of name with a new
+// password, keeping every other line as is, and reloads the users.
+func (s *Server) setUserPassword(name, password string) error {
+	s.usersFileMu.Lock()
+	defer s.usersFileMu.Unlock()
+	b, err := os.ReadFile(s.cfg.UsersFile)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	found := false
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := sc.Text()
+		if f := strings.Fields(line); len(f) >= 2 && f[0] == name && !found {
+			f[1] = password
+			line = strings.Join(f, " ")
+			found = true
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("user %s not found in %s", name, s.cfg.UsersFile)
+	}
+	if err := writeFileAtomic(s.cfg.UsersFile, out.Bytes(), filePerm(s.cfg.UsersFile, 0o600)); err != nil {
+		return err
+	}
+	return s.LoadUsers()
+}
+
+func (s *Server) handleRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type": "#RoleCollection.RoleCollection",
+		"@odata.id":   "/redfish/v1/AccountService/Roles",
+		"Name":        "Roles Collection",
+		"Members": []map[string]string{
+			{"@odata.id": "/redfish/v1/AccountService/Roles/ReadOnly"},
+			{"@odata.id": "/redfish/v1/AccountService/Roles/Operator"},
+		},
+		"Members@odata.count": 2,
+	})
+}
+
+func (s *Server) handleRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/redfish/v1/AccountService/Roles/")
+	privileges, ok := rolePrivileges[id]
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":        "#Role.v1_2_0.Role",
+		"@odata.id":          "/redfish/v1/AccountService/Roles/" + id,
+		"Id":                 id,
+		"Name":               id + " Role",
+		"RoleId":             id,
+		"IsPredefined":       true,
+		"AssignedPrivileges": privileges,
+	})
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// Reasons a power action was rejected, as reported by
+// bmc_shim_power_actions_rejected_total.
+const (
+	rejectCooldown     = "cooldown"
+	rejectQueueTimeout = "queue_timeout"
+	rejectNotConnected = "not_connected"
+	rejectStateUnknown = "state_unknown"
+)
+
+// rejectReason returns why err rejected a power action, or "" if it is
+// no rejection (e.g. a backend failure or an unsupported ResetType).
+func rejectReason(err error) string {
+	var cd *cooldownError
+	switch {
+	case errors.As(err, &cd):
+		return rejectCooldown
+	case errors.Is(err, errPowerOnQueued):
+		return rejectQueueTimeout
+	case errors.Is(err, errNotConnected):
+		return rejectNotConnected
+	case errors.Is(err, backend.ErrStateUnknown):
+		return rejectStateUnknown
+	}
+	return ""
+}
+
+// actionStats counts the power actions being applied and those rejected,
+// per system.
+type actionStats struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	// rejected counts rejections per system and reason.
+	rejected map[[2]string]uint64
+}
+
+// begin counts a power action of a system as in flight until end is
+// called.
+func (a *actionStats) begin(id string) (end func()) {
+	a.mu.Lock()
+	if a.inFlight == nil {
+		a.inFlight = map[string]int{}
+	}
+	a.inFlight[id]++
+	a.mu.Unlock()
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.inFlight[id]--; a.inFlight[id] == 0 {
+			delete(a.inFlight, id)
+		}
+	}
+}
+
+func (a *actionStats) reject(id, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rejected == nil {
+		a.rejected = map[[2]string]uint64{}
+	}
+	a.rejected[[2]string{id, reason}]++
+}
+
+// total returns the number of power actions in flight on all systems.
+func (a *actionStats) total() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, v := range a.inFlight {
+		n += v
+	}
+	return n
+}
+
+// actionStatus is the power action status of a system, as shown by
+// /debug/state.
+type actionStatus struct {
+	InFlight int `json:"inFlight"`
+	Queued   int `json:"queued"`
+}
+
+// actionStatus returns the systems with power actions in flight or
+// queued for their turn to power on.
+func (s *Server) actionStatus() map[string]actionStatus {
+	out := map[string]actionStatus{}
+	s.actions.mu.Lock()
+	for id, n := range s.actions.inFlight {
+		out[id] = actionStatus{InFlight: n}
+	}
+	s.actions.mu.Unlock()
+	if g := s.powerOn; g != nil {
+		g.mu.Lock()
+		for id, n := range g.queued {
+			st := out[id]
+			st.Queued = n
+			out[id] = st
+		}
+		g.mu.Unlock()
+	}
+	return out
+}
+
+// powerOnWaitBuckets are the upper bounds, in seconds, of the histogram
+// of the time power-ons waited for their turn.
+var powerOnWaitBuckets = [...]float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// histogram is a Prometheus histogram over powerOnWaitBuckets.
+type histogram struct {
+	// counts holds the observations per bucket, not cumulated.
+	counts [len(powerOnWaitBuckets) + 1]uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(powerOnWaitBuckets[:], v)
+	h.counts[i]++
+	h.sum += v
+}
+
+// write writes the samples of h with the label system=id.
+func (h *histogram) write(w io.Writer, name, id string) {
+	var n uint64
+	for i, le := range powerOnWaitBuckets {
+		n += h.counts[i]
+		_, _ = fmt.Fprintf(w, "%s_bucket{system=%s,le=\"%s\"} %d\n", name, labelValue(id), strconv.FormatFloat(le, 'g', -1, 64), n)
+	}
+	n += h.counts[len(powerOnWaitBuckets)]
+	_, _ = fmt.Fprintf(w, "%s_bucket{system=%s,le=\"+Inf\"} %d\n", name, labelValue(id), n)
+	_, _ = fmt.Fprintf(w, "%s_sum{system=%s} %s\n", name, labelValue(id), strconv.FormatFloat(h.sum, 'g', -1, 64))
+	_, _ = fmt.Fprintf(w, "%s_count{system=%s} %d\n", name, labelValue(id), n)
+}
+
+// writeActionMetrics writes the power action metrics of the systems ids.
+func (s *Server) writeActionMetrics(w io.Writer, ids []string) {
+	visible := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		visible[id] = true
+	}
+	s.actions.mu.Lock()
+	inFlight := maps.Clone(s.actions.inFlight)
+	rejected := maps.Clone(s.actions.rejected)
+	s.actions.mu.Unlock()
+
+	writeMetricHeader(w, "bmc_shim_power_actions_in_flight", "gauge", "Number of power actions being applied to the system.")
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(w, "bmc_shim_power_actions_in_flight{system=%s} %d\n", labelValue(id), inFlight[id])
+	}
+	writeMetricHeader(w, "bmc_shim_power_actions_rejected_total", "counter", "Number of power actions rejected, by reason (cooldown, queue_timeout, not_connected, state_unknown).")
+	keys := slices.SortedFunc(maps.Keys(rejected), func(a, b [2]string) int {
+		return cmp.Or(strings.Compare(a[0], b[0]), strings.Compare(a[1], b[1]))
+	})
+	for _, k := range keys {
+		if visible[k[0]] {
+			_, _ = fmt.Fprintf(w, "bmc_shim_power_actions_rejected_total{system=%s,reason=%s} %d\n", labelValue(k[0]), labelValue(k[1]), rejected[k])
+		}
+	}
+
+	g := s.powerOn
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	queued := maps.Clone(g.queued)
+	waits := make(map[string]histogram, len(g.waits))
+	for id, h := range g.waits {
+		waits[id] = *h
+	}
+	g.mu.Unlock()
+	writeMetricHeader(w, "bmc_shim_power_on_queue_depth", "gauge", "Number of power-ons of the system waiting for their turn (with --poweron-stagger or --poweron-concurrency).")
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(w, "bmc_shim_power_on_queue_depth{system=%s} %d\n", labelValue(id), queued[id])
+	}
+	writeMetricHeader(w, "bmc_shim_power_on_queue_wait_seconds", "histogram", "Time power-ons of the system waited for their turn.")
+	for _, id := range ids {
+		if h, ok := waits[id]; ok {
+			h.write(w, "bmc_shim_power_on_queue_wait_seconds", id)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// resetSystem posts a reset of system id and sends the status to codes.
+func resetSystem(h http.Handler, id, resetType string, codes chan<- int) {
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/redfish/v1/Systems/"+id+"/Actions/ComputerSystem.Reset", strings.NewReader(`{"ResetType":"`+resetType+`"}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes <- rec.Code
+	}()
+}
+
+// expectMetrics checks that the /metrics of h has each of the samples.
+func expectMetrics(t *testing.T, h http.Handler, samples ...string) {
+	t.Helper()
+	rec := request(h, http.MethodGet, "/metrics", "")
+	for _, sample := range samples {
+		if !strings.Contains(rec.Body.String(), "\n"+sample+"\n") {
+			t.Errorf("metrics lack %s", sample)
+		}
+	}
+}
+
+// TestActionQueueStats follows a power-on in flight and one queued behind
+// it by the stagger through the status of /debug/state and the metrics.
+func TestActionQueueStats(t *testing.T) {
+	c := newFakeClock()
+	first := &gatedBackend{entered: make(chan struct{}), release: make(chan struct{})}
+	s := New(Config{
+		Systems:        map[string]backend.System{"1": backend.Adapt(first), "2": backend.Adapt(&gatedBackend{})},
+		PowerOnStagger: 10 * time.Second,
+	})
+	s.powerOn = newPowerOnGate(10*time.Second, 0, c)
+	h := s.Handler()
+	codes := make(chan int, 2)
+
+	resetSystem(h, "1", "On", codes)
+	<-first.entered
+	resetSystem(h, "2", "On", codes)
+	c.waitTimers(t, 1)
+	status := s.actionStatus()
+	if status["1"] != (actionStatus{InFlight: 1}) || status["2"] != (actionStatus{Queued: 1}) {
+		t.Errorf("status = %+v, want 1 in flight and 2 queued", status)
+	}
+	expectMetrics(t, h,
+		`bmc_shim_power_actions_in_flight{system="1"} 1`,
+		`bmc_shim_power_actions_in_flight{system="2"} 0`,
+		`bmc_shim_power_on_queue_depth{system="1"} 0`,
+		`bmc_shim_power_on_queue_depth{system="2"} 1`,
+	)
+
+	close(first.release)
+	if code := <-codes; code != http.StatusNoContent {
+		t.Fatalf("power-on of 1 = %d", code)
+	}
+	c.advance(10 * time.Second)
+	if code := <-codes; code != http.StatusNoContent {
+		t.Fatalf("power-on of 2 = %d", code)
+	}
+	if status := s.actionStatus(); len(status) != 0 {
+		t.Errorf("status = %+v after both power-ons, want none", status)
+	}
+	expectMetrics(t, h,
+		`bmc_shim_power_actions_in_flight{system="1"} 0`,
+		`bmc_shim_power_on_queue_depth{system="2"} 0`,
+		`bmc_shim_power_on_queue_wait_seconds_bucket{system="1",le="0.1"} 1`,
+		`bmc_shim_power_on_queue_wait_seconds_count{system="1"} 1`,
+		`bmc_shim_power_on_queue_wait_seconds_bucket{system="2",le="5"} 0`,
+		`bmc_shim_power_on_queue_wait_seconds_bucket{system="2",le="10"} 1`,
+		`bmc_shim_power_on_queue_wait_seconds_sum{system="2"} 10`,
+		`bmc_shim_power_on_queue_wait_seconds_count{system="2"} 1`,
+	)
+}
+
+// TestActionRejectionStats checks that power-ons not getting their turn
+// within PowerOnMaxWait and resets inside the cooldown are counted by
+// reason.
+func TestActionRejectionStats(t *testing.T) {
+	c := newFakeClock()
+	s := New(Config{
+		Systems:        map[string]backend.System{"1": backend.Adapt(&gatedBackend{}), "2": backend.Adapt(&gatedBackend{})},
+		PowerOnStagger: 10 * time.Second,
+		PowerOnMaxWait: 20 * time.Millisecond,
+		ActionCooldown: time.Minute,
+	})
+	s.powerOn = newPowerOnGate(10*time.Second, 0, c)
+	h := s.Handler()
+	codes := make(chan int, 1)
+
+	resetSystem(h, "1", "On", codes)
+	if code := <-codes; code != http.StatusNoContent {
+		t.Fatalf("power-on of 1 = %d", code)
+	}
+	// The clock never reaches the turn of 2.
+	resetSystem(h, "2", "On", codes)
+	if code := <-codes; code != http.StatusServiceUnavailable {
+		t.Errorf("power-on of 2 past the maximum wait = %d, want 503", code)
+	}
+	resetSystem(h, "1", "ForceOff", codes)
+	if code := <-codes; code != http.StatusTooManyRequests {
+		t.Errorf("ForceOff of 1 in the cooldown = %d, want 429", code)
+	}
+	expectMetrics(t, h,
+		`bmc_shim_power_actions_rejected_total{system="1",reason="cooldown"} 1`,
+		`bmc_shim_power_actions_rejected_total{system="2",reason="queue_timeout"} 1`,
+		`bmc_shim_power_on_queue_depth{system="2"} 0`,
+		`bmc_shim_power_on_queue_wait_seconds_count{system="2"} 1`,
+	)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+)
+
+// ParseAllowCIDRs parses the client networks of Config.AllowCIDRs.
+func ParseAllowCIDRs(list []string) ([]netip.Prefix, error) {
+	return parsePrefixes(list, "allowed CIDR")
+}
+
+// allowlistMiddleware rejects modifying requests, and with
+// Config.AllowCIDRRead all but the health probes, from clients outside
+// Config.AllowCIDRs. The client IP is the one derived through trusted
+// proxies. It runs before authentication, so leaked credentials are of
+// no use from elsewhere.
+func (s *Server) allowlistMiddleware(next http.Handler) http.Handler {
+	if len(s.cfg.AllowCIDRs) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		restricted := s.cfg.AllowCIDRRead && !healthPaths[r.URL.Path]
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			restricted = true
+		}
+		if ip := clientIP(r); restricted && !prefixesContain(s.cfg.AllowCIDRs, ip) {
+			log.Printf("denied %s %s from %s: not in --allow-cidr", r.Method, r.URL.Path, ip)
+			writeError(w, http.StatusForbidden, msgAccessDenied(r.URL.Path))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
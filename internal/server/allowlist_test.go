@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+func mustPrefixes(t *testing.T, list ...string) []netip.Prefix {
+	t.Helper()
+	p, err := parsePrefixes(list, "test prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPrefixesContain(t *testing.T) {
+	prefixes := mustPrefixes(t, "10.0.0.0/24", "192.0.2.7", "2001:db8::/64", "::ffff:198.51.100.0/120")
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.0", true},
+		{"10.0.0.255", true},
+		{"10.0.1.0", false},
+		{"9.255.255.255", false},
+		{"192.0.2.7", true},
+		{"192.0.2.8", false},
+		{"2001:db8::1", true},
+		{"2001:db8::ffff:ffff:ffff:ffff", true},
+		{"2001:db8:0:1::", false},
+		{"fe80::1%eth0", false},
+		// IPv4-mapped addresses match IPv4 prefixes.
+		{"::ffff:10.0.0.5", true},
+		{"::ffff:10.0.1.5", false},
+		// An IPv4-mapped prefix matches plain IPv4 addresses.
+		{"198.51.100.200", true},
+		{"::ffff:198.51.100.1", true},
+		{"198.51.101.1", false},
+		// Zones are ignored.
+		{"2001:db8::1%eth0", true},
+		{"", false},
+		{"unknown", false},
+		{"10.0.0.1:80", false},
+	}
+	for _, tt := range tests {
+		if got := prefixesContain(prefixes, tt.ip); got != tt.want {
+			t.Errorf("prefixesContain(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if prefixesContain(nil, "10.0.0.1") {
+		t.Error("prefixesContain(nil, ...) = true, want false")
+	}
+}
+
+func TestParsePrefixesRejects(t *testing.T) {
+	for _, v := range []string{"::ffff:10.0.0.0/95", "fe80::1%eth0", "10.0.0.0/33", "host.example"} {
+		if _, err := parsePrefixes([]string{v}, "test prefix"); err == nil {
+			t.Errorf("parsePrefixes(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestAllowlistMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		read       bool
+		method     string
+		path       string
+		remote     string
+		forwarded  string
+		wantDenied bool
+	}{
+		{"allowed write", false, http.MethodPost, "/redfish/v1/missing", "10.0.0.5:1234", "", false},
+		{"denied write", false, http.MethodPost, "/redfish/v1/missing", "10.0.1.5:1234", "", true},
+		{"first address of the range", false, http.MethodPatch, "/redfish/v1/missing", "10.0.0.0:1234", "", false},
+		{"last address of the range", false, http.MethodDelete, "/redfish/v1/missing", "10.0.0.255:1234", "", false},
+		{"read open by default", false, http.MethodGet, "/redfish/v1/", "10.0.1.5:1234", "", false},
+		{"read restricted", true, http.MethodGet, "/redfish/v1/", "10.0.1.5:1234", "", true},
+		{"head restricted", true, http.MethodHead, "/redfish/v1/", "10.0.1.5:1234", "", true},
+		{"health probe open", true, http.MethodGet, "/livez", "10.0.1.5:1234", "", false},
+		{"allowed IPv6", false, http.MethodPost, "/redfish/v1/missing", "[2001:db8::5]:1234", "", false},
+		{"denied IPv6", false, http.MethodPost, "/redfish/v1/missing", "[2001:db8:1::5]:1234", "", true},
+		{"IPv4-mapped peer", false, http.MethodPost, "/redfish/v1/missing", "[::ffff:10.0.0.5]:1234", "", false},
+		{"denied IPv4-mapped peer", false, http.MethodPost, "/redfish/v1/missing", "[::ffff:10.0.1.5]:1234", "", true},
+		{"client behind trusted proxy", false, http.MethodPost, "/redfish/v1/missing", "192.0.2.1:1234", "10.0.0.5", false},
+		{"denied client behind trusted proxy", false, http.MethodPost, "/redfish/v1/missing", "192.0.2.1:1234", "10.0.1.5", true},
+		{"forged header from untrusted peer", false, http.MethodPost, "/redfish/v1/missing", "10.0.1.5:1234", "10.0.0.5", true},
+		{"IPv4-mapped client behind trusted proxy", false, http.MethodPost, "/redfish/v1/missing", "192.0.2.1:1234", "::ffff:10.0.0.5", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{
+				Systems:        map[string]backend.System{"1": backend.NewNoop()},
+				AllowCIDRs:     mustPrefixes(t, "10.0.0.0/24", "2001:db8::/64"),
+				AllowCIDRRead:  tt.read,
+				TrustedProxies: mustPrefixes(t, "192.0.2.1"),
+			})
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+			if denied := rec.Code == http.StatusForbidden; denied != tt.wantDenied {
+				t.Errorf("%s %s from %s (forwarded for %q) = %d, want denied %v", tt.method, tt.path, tt.remote, tt.forwarded, rec.Code, tt.wantDenied)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestAnsibleRedfishCommand replays the requests of Ansible's
+// community.general.redfish_command power tasks and compares the exchanges
+// with testdata/ansible.golden. Every task starts a new session: the
+// module reads the service root, follows it to the Systems collection
+// (with the trailing slash some versions add) and to each system, reads
+// the Reset ActionInfo for the allowable values and posts the reset with
+// a charset parameter in the Content-Type.
+func TestAnsibleRedfishCommand(t *testing.T) {
+	s := newGoldenServer(Config{})
+	h := s.Handler()
+	header := http.Header{
+		"Accept":        {"application/json"},
+		"Content-Type":  {"application/json;charset=utf-8"},
+		"Odata-Version": {"4.0"},
+		"User-Agent":    {"ansible-httpget"},
+	}
+	task := func(resetType string) []exchange {
+		return []exchange{
+			{method: http.MethodGet, path: "/redfish/v1/"},
+			{method: http.MethodGet, path: "/redfish/v1/Systems/"},
+			{method: http.MethodGet, path: "/redfish/v1/Systems/1"},
+			{method: http.MethodGet, path: "/redfish/v1/Systems/2"},
+			{method: http.MethodGet, path: "/redfish/v1/Systems/1"},
+			{method: http.MethodGet, path: "/redfish/v1/Systems/1/ResetActionInfo"},
+			{method: http.MethodPost, path: "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", body: `{"ResetType": "` + resetType + `"}`},
+		}
+	}
+	var exchanges []exchange
+	// The power-cycle flow: power on, force a restart, force off and
+	// check the final state.
+	for _, resetType := range []string{"On", "ForceRestart", "ForceOff"} {
+		exchanges = append(exchanges, task(resetType)...)
+	}
+	exchanges = append(exchanges, exchange{method: http.MethodGet, path: "/redfish/v1/Systems/1"})
+	replay(t, h, header, "ansible.golden", exchanges)
+}
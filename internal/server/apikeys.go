@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Roles a client can hold. Readers may only read; operators may also
+// change state and run actions.
+const (
+	RoleReader   = "reader"
+	RoleOperator = "operator"
+)
+
+// minAPIKeyLen rejects keys short enough to be guessed.
+const minAPIKeyLen = 16
+
+// APIKey is a static key accepted in an X-Api-Key or an
+// "Authorization: Bearer" header.
+type APIKey struct {
+	// Name identifies the key in logs in place of the secret.
+	Name string
+	Role string
+	Key  string
+	// Systems limits the key to these system IDs; nil means all.
+	Systems []string
+}
+
+// ParseAPIKey parses "key [name [role [systems]]]", separated by
+// whitespace. The name defaults to a fingerprint of the key, the role to
+// operator and the systems, as for ParseUser, to all.
+func ParseAPIKey(s string) (APIKey, error) {
+	f := strings.Fields(s)
+	if len(f) == 0 || len(f) > 4 {
+		return APIKey{}, fmt.Errorf("invalid API key entry: expected \"key [name [role [systems]]]\"")
+	}
+	k := APIKey{Key: f[0], Role: RoleOperator}
+	if len(k.Key) < minAPIKeyLen {
+		return APIKey{}, fmt.Errorf("invalid API key entry: key must be at least %d characters", minAPIKeyLen)
+	}
+	if len(f) > 1 {
+		k.Name = f[1]
+	} else {
+		sum := sha256.Sum256([]byte(k.Key))
+		k.Name = "key-" + hex.EncodeToString(sum[:4])
+	}
+	if len(f) > 2 {
+		k.Role = f[2]
+	}
+	if k.Role != RoleReader && k.Role != RoleOperator {
+		return APIKey{}, fmt.Errorf("API key %s: invalid role %q (expected %s or %s)", k.Name, k.Role, RoleReader, RoleOperator)
+	}
+	if len(f) > 3 {
+		systems, err := parseScope(f[3])
+		if err != nil {
+			return APIKey{}, fmt.Errorf("API key %s: %w", k.Name, err)
+		}
+		k.Systems = systems
+	}
+	return k, nil
+}
+
+// LoadAPIKeys (re)reads Config.APIKeyFile and replaces the accepted keys
+// with its entries plus Config.APIKeys, so removing a line revokes that
+// key. On error the previous keys stay in effect.
+func (s *Server) LoadAPIKeys() error {
+	keys := append([]APIKey(nil), s.cfg.APIKeys...)
+	if s.cfg.APIKeyFile != "" {
+		b, err := os.ReadFile(s.cfg.APIKeyFile)
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; sc.Scan(); n++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			k, err := ParseAPIKey(line)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", s.cfg.APIKeyFile, n, err)
+			}
+			keys = append(keys, k)
+		}
+	}
+	names := map[string]bool{}
+	for _, k := range keys {
+		if names[k.Name] {
+			return fmt.Errorf("API keys: duplicate name %q", k.Name)
+		}
+		names[k.Name] = true
+	}
+	s.apiKeys.Store(&keys)
+	if s.cfg.APIKeyFile != "" {
+		log.Printf("loaded %d API keys", len(keys))
+	}
+	return nil
+}
+
+// lookupAPIKey returns the key matching secret. Every key is compared in
+// constant time so that the timing reveals neither the key nor which one
+// matched.
+func (s *Server) lookupAPIKey(secret string) (APIKey, bool) {
+	keys := s.apiKeys.Load()
+	if keys == nil {
+		return APIKey{}, false
+	}
+	// Hashing first makes the comparison independent of the length.
+	got := sha256.Sum256([]byte(secret))
+	var match APIKey
+	ok := false
+	for _, k := range *keys {
+		want := sha256.Sum256([]byte(k.Key))
+		if subtle.ConstantTimeCompare(got[:], want[:]) == 1 {
+			match, ok = k, true
+		}
+	}
+	return match, ok
+}
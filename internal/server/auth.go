@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// principal is the authenticated client of a request.
+type principal struct {
+	// Name is the basic auth user or the API key name; never a secret.
+	Name string
+	Role string
+	// Systems limits the client to these system IDs; nil means all.
+	Systems []string
+}
+
+// canAccess reports whether the client may see and act on system id.
+func (p principal) canAccess(id string) bool {
+	return p.Systems == nil || slices.Contains(p.Systems, id)
+}
+
+type principalKey struct{}
+
+// withPrincipalSlot returns r with an empty principal that authMiddleware
+// fills in, so that outer middleware (the access log) can see who the
+// client turned out to be.
+func withPrincipalSlot(r *http.Request) (*http.Request, *principal) {
+	p := &principal{}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, p)), p
+}
+
+// setPrincipal records the authenticated client of r, in the slot of
+// withPrincipalSlot if there is one.
+func setPrincipal(r *http.Request, p principal) *http.Request {
+	slot, ok := r.Context().Value(principalKey{}).(*principal)
+	if !ok {
+		r, slot = withPrincipalSlot(r)
+	}
+	*slot = p
+	return r
+}
+
+// requestPrincipal returns the authenticated client of r, if any.
+func requestPrincipal(r *http.Request) (principal, bool) {
+	p, ok := r.Context().Value(principalKey{}).(*principal)
+	if !ok || p.Name == "" {
+		return principal{}, false
+	}
+	return *p, true
+}
+
+// authRequired reports whether clients must authenticate at all.
+func (s *Server) authRequired() bool {
+	return s.cfg.Username != "" || s.cfg.Password != "" || s.cfg.UsersFile != "" || s.cfg.APIKeyFile != "" || len(s.cfg.APIKeys) > 0 || s.oidc != nil
+}
+
+// errNoCredentials means the request carried no credentials accepted in
+// the configured mode.
+var errNoCredentials = errors.New("no credentials")
+
+// authenticate identifies the client by OIDC token, API key or basic auth,
+// as the auth mode allows. A client with a valid token whose claims grant
+// no role is returned with an empty Role.
+func (s *Server) authenticate(r *http.Request) (principal, error) {
+	bearer, isBearer := bearerToken(r)
+	if s.oidc != nil && isBearer && looksLikeJWT(bearer) {
+		return s.oidc.verify(r.Context(), bearer)
+	}
+	if s.cfg.AuthMode == AuthModeOIDC {
+		return principal{}, errNoCredentials
+	}
+	if key, ok := apiKeyFromRequest(r); ok {
+		k, ok := s.lookupAPIKey(key)
+		if !ok {
+			return principal{}, errors.New("unknown API key")
+		}
+		return principal{Name: k.Name, Role: k.Role, Systems: k.Systems}, nil
+	}
+	usr, pwd, ok := r.BasicAuth()
+	if !ok {
+		return principal{}, errNoCredentials
+	}
+	if u, ok := s.lookupUser(usr, pwd); ok {
+		return principal{Name: u.Name, Role: u.Role, Systems: u.Systems}, nil
+	}
+	if s.cfg.Username == "" && s.cfg.Password == "" {
+		if s.cfg.UsersFile == "" {
+			return principal{}, errNoCredentials
+		}
+		return principal{}, errors.New("invalid basic auth credentials")
+	}
+	if usr != s.cfg.Username || pwd != s.cfg.Password {
+		return principal{}, errors.New("invalid basic auth credentials")
+	}
+	return principal{Name: usr, Role: RoleOperator}, nil
+}
+
+// inScope reports whether the client of r may see and act on system id.
+// Unauthenticated requests are only served when no authentication is
+// required, so they are unrestricted.
+func inScope(r *http.Request, id string) bool {
+	p, ok := requestPrincipal(r)
+	return !ok || p.canAccess(id)
+}
+
+// visibleSystemIDs returns the IDs of the systems the client of r may see,
+// in sorted order.
+func (s *Server) visibleSystemIDs(r *http.Request) []string {
+	ids := s.systemIDs()
+	return slices.DeleteFunc(ids, func(id string) bool { return !inScope(r, id) })
+}
+
+// writeOutOfScope answers a request for a system outside the client's
+// scope: with 404 like an unknown system, unless configured otherwise.
+func (s *Server) writeOutOfScope(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.OutOfScopeForbidden {
+		writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
+		return
+	}
+	writeNotFound(w, r)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// challenge sets WWW-Authenticate for a 401 with the schemes the auth
+// mode accepts.
+func (s *Server) challenge(w http.ResponseWriter, err error) {
+	if s.oidc != nil {
+		if errors.Is(err, errNoCredentials) {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="redfish"`)
+		} else {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="redfish", error="invalid_token"`)
+		}
+	}
+	if s.cfg.AuthMode != AuthModeOIDC {
+		w.Header().Add("WWW-Authenticate", "Basic realm=redfish")
+	}
+}
+
+// apiKeyFromRequest returns the key of an X-Api-Key or
+// "Authorization: Bearer" header.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if k := r.Header.Get("X-Api-Key"); k != "" {
+		return k, true
+	}
+	return bearerToken(r)
+}
+
+// allowed reports whether role may make a request with method.
+func allowed(role, method string) bool {
+	switch role {
+	case RoleOperator:
+		return true
+	case RoleReader:
+		return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/backendmw"
+)
+
+// BackendCalls counts the backend calls of every system by method and
+// result, and times them, for /metrics. Systems are wrapped with
+// backendmw.Metrics(calls.Observer(id)) to be counted.
+type BackendCalls struct {
+	mu sync.Mutex
+	// calls counts the calls per system, method and result.
+	calls     map[[3]string]uint64
+	durations map[string]*histogram
+}
+
+// NewBackendCalls returns an empty BackendCalls.
+func NewBackendCalls() *BackendCalls {
+	return &BackendCalls{calls: map[[3]string]uint64{}, durations: map[string]*histogram{}}
+}
+
+// Observer returns the observer of the calls of system id.
+func (b *BackendCalls) Observer(id string) backendmw.Observer {
+	return func(c backendmw.Call, d time.Duration, err error) {
+		result := "ok"
+		switch {
+		case errors.Is(err, backend.ErrNotSupported):
+			result = "not_supported"
+		case err != nil:
+			result = "error"
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.calls[[3]string{id, c.Method, result}]++
+		h := b.durations[id]
+		if h == nil {
+			h = &histogram{}
+			b.durations[id] = h
+		}
+		h.observe(d.Seconds())
+	}
+}
+
+// write writes the backend call metrics of the systems ids.
+func (b *BackendCalls) write(w io.Writer, ids []string) {
+	visible := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		visible[id] = true
+	}
+	b.mu.Lock()
+	calls := maps.Clone(b.calls)
+	durations := make(map[string]histogram, len(b.durations))
+	for id, h := range b.durations {
+		durations[id] = *h
+	}
+	b.mu.Unlock()
+
+	writeMetricHeader(w, "bmc_shim_backend_calls_total", "counter", "Number of backend calls of the system by method and result (ok, not_supported, error).")
+	keys := slices.SortedFunc(maps.Keys(calls), func(a, b [3]string) int {
+		return cmp.Or(strings.Compare(a[0], b[0]), strings.Compare(a[1], b[1]), strings.Compare(a[2], b[2]))
+	})
+	for _, k := range keys {
+		if visible[k[0]] {
+			_, _ = fmt.Fprintf(w, "bmc_shim_backend_calls_total{system=%s,method=%s,result=%s} %d\n", labelValue(k[0]), labelValue(k[1]), labelValue(k[2]), calls[k])
+		}
+	}
+	writeMetricHeader(w, "bmc_shim_backend_call_duration_seconds", "histogram", "Time backend calls of the system took, including retries.")
+	for _, id := range ids {
+		if h, ok := durations[id]; ok {
+			h.write(w, "bmc_shim_backend_call_duration_seconds", id)
+		}
+	}
+}
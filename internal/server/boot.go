@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/redfish"
+)
+
+// Allowable values of the writable Boot properties.
+var (
+	bootTargets = []string{"None", "Pxe", "Hdd", "UefiTarget"}
+	bootEnabled = []string{"Disabled", "Once", "Continuous"}
+	bootModes   = []string{"Legacy", "UEFI"}
+)
+
+// currentBoot returns the boot settings of a system, with defaults filled in.
+func (s *Server) currentBoot(id string) Boot {
+	s.mu.RLock()
+	b := s.boot[id]
+	s.mu.RUnlock()
+	if b.BootSourceOverrideTarget == "" {
+		b.BootSourceOverrideTarget = "None"
+	}
+	if b.BootSourceOverrideEnabled == "" {
+		b.BootSourceOverrideEnabled = "Disabled"
+	}
+	if len(b.BootOrder) == 0 {
+		b.BootOrder = s.systemInfo(id).BootDevices
+	}
+	return b
+}
+
+// renderBoot builds the Boot property of a ComputerSystem.
+func (s *Server) renderBoot(id string) redfish.Boot {
+	b := s.currentBoot(id)
+	rb := redfish.Boot{
+		BootSourceOverrideTarget:     b.BootSourceOverrideTarget,
+		BootSourceOverrideEnabled:    b.BootSourceOverrideEnabled,
+		AllowableTargets:             bootTargets,
+		BootSourceOverrideMode:       b.BootSourceOverrideMode,
+		UefiTargetBootSourceOverride: b.UefiTargetBootSourceOverride,
+		BootOrder:                    b.BootOrder,
+	}
+	if s.cfg.Profile == ProfileMetal3 {
+		rb.AllowableModes = bootModes
+	}
+	return rb
+}
+
+// parseBootPatch validates the Boot object of a PATCH and merges it into
+// b, the settings it changes.
+func (s *Server) parseBootPatch(id string, b Boot, raw json.RawMessage) (Boot, []message) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &body); err != nil || body == nil {
+		return Boot{}, []message{msgPropertyValueTypeError(string(raw), "Boot")}
+	}
+	var msgs []message
+	for _, key := range sortedKeys(body) {
+		prop := "Boot/" + key
+		v := body[key]
+		switch key {
+		case "BootSourceOverrideTarget":
+			if e, ok := enumValue(v, prop, bootTargets, &msgs); ok {
+				b.BootSourceOverrideTarget = e
+			}
+		case "BootSourceOverrideEnabled":
+			if e, ok := enumValue(v, prop, bootEnabled, &msgs); ok {
+				b.BootSourceOverrideEnabled = e
+			}
+		case "BootSourceOverrideMode":
+			if e, ok := enumValue(v, prop, bootModes, &msgs); ok {
+				b.BootSourceOverrideMode = e
+			}
+		case "UefiTargetBootSourceOverride":
+			var path string
+			if err := json.Unmarshal(v, &path); err != nil {
+				msgs = append(msgs, msgPropertyValueTypeError(string(v), prop))
+				continue
+			}
+			b.UefiTargetBootSourceOverride = path
+		case "BootOrder":
+			devices := s.systemInfo(id).BootDevices
+			if len(devices) == 0 {
+				// Without configured devices there is nothing to order.
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+				continue
+			}
+			var order []string
+			if err := json.Unmarshal(v, &order); err != nil {
+				msgs = append(msgs, msgPropertyValueTypeError(string(v), prop))
+				continue
+			}
+			valid := true
+			for i, dev := range order {
+				if !slices.Contains(devices, dev) {
+					msgs = append(msgs, msgPropertyValueNotInList(dev, prop))
+					valid = false
+				} else if slices.Contains(order[:i], dev) {
+					msgs = append(msgs, msgPropertyValueFormatError(dev, prop))
+					valid = false
+				}
+			}
+			if valid {
+				b.BootOrder = order
+			}
+		default:
+			if strings.Contains(key, "@") {
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+			} else {
+				msgs = append(msgs, msgPropertyUnknown(prop))
+			}
+		}
+	}
+	if len(msgs) == 0 && b.BootSourceOverrideTarget == "UefiTarget" && b.UefiTargetBootSourceOverride == "" {
+		msgs = append(msgs, msgPropertyMissing("Boot/UefiTargetBootSourceOverride"))
+	}
+	return b, msgs
+}
+
+// enumValue decodes a string property that must be one of allowed. On
+// failure it appends the error message to msgs.
+func enumValue(raw json.RawMessage, prop string, allowed []string, msgs *[]message) (string, bool) {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		*msgs = append(*msgs, msgPropertyValueTypeError(string(raw), prop))
+		return "", false
+	}
+	if !slices.Contains(allowed, v) {
+		*msgs = append(*msgs, msgPropertyValueNotInList(v, prop))
+		return "", false
+	}
+	return v, true
+}
+
+// setBoot hands validated boot settings to the backend, if it can apply
+// them, and stores them; by names the initiator for the event log.
+func (s *Server) setBoot(ctx context.Context, by, id string, be backend.System, b Boot) error {
+	if bs := be.Capabilities().Boot; bs != nil {
+		err := bs.SetBoot(ctx, backend.BootOptions{
+			OverrideTarget:  b.BootSourceOverrideTarget,
+			OverrideEnabled: b.BootSourceOverrideEnabled,
+			OverrideMode:    b.BootSourceOverrideMode,
+			UefiTarget:      b.UefiTargetBootSourceOverride,
+			BootOrder:       b.BootOrder,
+		})
+		if err != nil && !errors.Is(err, backend.ErrNotSupported) {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.boot[id] = b
+	s.mu.Unlock()
+	msg := fmt.Sprintf("Boot override set to %s (%s) by %s", b.BootSourceOverrideTarget, b.BootSourceOverrideEnabled, by)
+	if len(b.BootOrder) > 0 {
+		msg += ", boot order " + strings.Join(b.BootOrder, ",")
+	}
+	s.recordEvent(id, severityOK, msg)
+	return s.saveState()
+}
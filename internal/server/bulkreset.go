@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const resetAllPath = "/redfish/v1/Oem/BmcShim/Actions/ResetAll"
+
+// resetAllMember is the result of a bulk reset for one system.
+type resetAllMember struct {
+	ODataID    string    `json:"@odata.id"`
+	ID         string    `json:"Id"`
+	Outcome    string    `json:"Outcome"`
+	HTTPStatus int       `json:"HttpStatus"`
+	RetryAfter int       `json:"RetryAfter,omitempty"`
+	Messages   []message `json:"@Message.ExtendedInfo,omitempty"`
+	Oem        any       `json:"Oem,omitempty"`
+}
+
+// handleResetAll resets several systems at once, all visible ones unless
+// Systems lists some. Every system goes through the same path as its own
+// Reset action, so cooldowns, locks, read-only systems, the power-on
+// stagger and dry runs apply to each. The response always lists the result
+// of every member; the action only fails as a whole on a bad request.
+func (s *Server) handleResetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	var body struct {
+		ResetType string
+		Systems   []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return
+	}
+	if body.ResetType == "" {
+		writeError(w, http.StatusBadRequest, msgActionParameterMissing("ResetAll", "ResetType"))
+		return
+	}
+	for _, h := range dryRunHeaders {
+		if r.Header.Get(h) != "" {
+			writeError(w, http.StatusBadRequest, msgActionParameterNotSupported(h, "ResetAll"))
+			return
+		}
+	}
+	ids := body.Systems
+	if ids == nil {
+		ids = s.visibleSystemIDs(r)
+	}
+	by := initiator(r)
+	results, errs := fanOut(r.Context(), ids, s.resetTimeout(), func(ctx context.Context, id string) (resetResult, error) {
+		be, ok := s.system(id)
+		if !ok || !inScope(r, id) {
+			return resetResult{outcome: "refused", code: http.StatusNotFound, msgs: []message{newMessage("ResourceMissingAtURI", "/redfish/v1/Systems/"+id)}}, nil
+		}
+		return s.resetSystem(ctx, id, be, body.ResetType, by), nil
+	})
+	members := make([]resetAllMember, len(ids))
+	var failed []string
+	for i, id := range ids {
+		res := results[i]
+		if errs[i] != nil {
+			// The reset overran its timeout and was abandoned.
+			res = resetResult{outcome: "failed", code: http.StatusInternalServerError, msgs: []message{msgInternalError()}}
+		}
+		m := resetAllMember{ODataID: "/redfish/v1/Systems/" + id, ID: id, Outcome: res.outcome, HTTPStatus: res.code, RetryAfter: res.retryAfter, Messages: res.msgs}
+		if res.oem != nil {
+			m.Oem = map[string]any{"BmcShim": res.oem}
+		}
+		if !res.ok() {
+			failed = append(failed, id)
+		}
+		members[i] = m
+	}
+	state, status := "Completed", "OK"
+	switch {
+	case len(failed) == len(ids) && len(ids) > 0:
+		state, status = "Exception", "Critical"
+	case len(failed) > 0:
+		status = "Warning"
+	}
+	if len(failed) > 0 {
+		log.Printf("ResetAll %s requested by %s: %d of %d systems failed: %s", body.ResetType, by, len(failed), len(ids), strings.Join(failed, ", "))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ResetType":           body.ResetType,
+		"TaskState":           state,
+		"TaskStatus":          status,
+		"Members":             members,
+		"Members@odata.count": len(members),
+	})
+}
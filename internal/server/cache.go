@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// DefaultCacheTTL is how long a backend read is served from the cache.
+const DefaultCacheTTL = 2 * time.Second
+
+// DefaultCacheMaxStale is how old a cached read may be to be served when
+// the backend fails.
+const DefaultCacheMaxStale = 5 * time.Minute
+
+// Kinds of backend reads the cache holds per system.
+const (
+	cacheState     = "state"
+	cacheName      = "name"
+	cacheHealth    = "health"
+	cacheMetrics   = "metrics"
+	cacheThermal   = "thermal"
+	cacheIndicator = "indicator"
+	cacheOem       = "oem"
+)
+
+// cacheKinds are the kinds of reads, in the order of the metrics.
+var cacheKinds = []string{cacheState, cacheName, cacheHealth, cacheMetrics, cacheThermal, cacheIndicator, cacheOem}
+
+// cacheServesStale are the kinds of reads served from an older cached
+// value when the backend fails. Power state has its own fallback to the
+// last known state, with an annotation, and a failed health check must
+// not pass for a cached success.
+var cacheServesStale = map[string]bool{
+	cacheName:      true,
+	cacheMetrics:   true,
+	cacheThermal:   true,
+	cacheIndicator: true,
+	cacheOem:       true,
+}
+
+type cacheKey struct {
+	system, kind string
+}
+
+// cacheEntry is the last successful read of a kind for a system.
+type cacheEntry struct {
+	value any
+	at    time.Time
+}
+
+// cacheCounters count the reads of a kind.
+type cacheCounters struct {
+	// hits were served from the cache, misses from the backend and
+	// stale from the cache after the backend failed.
+	hits, misses, stale atomic.Uint64
+}
+
+// readCache caches what the backends report, per system and kind of
+// read, so that all read paths agree and a burst of requests does not
+// turn into a burst of backend calls. Power actions invalidate what they
+// change; see invalidate.
+type readCache struct {
+	ttl, maxStale time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+
+	counters map[string]*cacheCounters
+}
+
+func newReadCache(ttl, maxStale time.Duration) *readCache {
+	c := &readCache{ttl: ttl, maxStale: maxStale, entries: map[cacheKey]cacheEntry{}, counters: map[string]*cacheCounters{}}
+	for _, kind := range cacheKinds {
+		c.counters[kind] = &cacheCounters{}
+	}
+	return c
+}
+
+// cachedRead returns the value of a kind of read of a system: from the
+// cache if it is younger than maxAge, otherwise from fetch. maxAge is the
+// cache TTL for reads that may lag, or zero for reads that decide an
+// action and must be fresh; they still update the cache. If fetch fails,
+// kinds that serve stale values return a cached one up to the cache's
+// maximum staleness instead.
+func cachedRead[T any](c *readCache, ctx context.Context, id, kind string, maxAge time.Duration, fetch func(context.Context) (T, error)) (T, error) {
+	key := cacheKey{id, kind}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && maxAge > 0 && time.Since(e.at) < maxAge {
+		c.counters[kind].hits.Add(1)
+		return e.value.(T), nil
+	}
+	c.counters[kind].misses.Add(1)
+	v, err := fetch(ctx)
+	if err == nil {
+		c.mu.Lock()
+		c.entries[key] = cacheEntry{value: v, at: time.Now()}
+		c.mu.Unlock()
+		return v, nil
+	}
+	if ok && cacheServesStale[kind] && !errors.Is(err, backend.ErrNotSupported) && time.Since(e.at) < c.maxStale {
+		c.counters[kind].stale.Add(1)
+		log.Printf("system %s: %s: serving cached value from %s ago: %v", id, kind, time.Since(e.at).Round(time.Second), err)
+		return e.value.(T), nil
+	}
+	if ok {
+		// A failed read must not be answered with the older value until
+		// it expires.
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+	}
+	return v, err
+}
+
+// invalidate drops the cached reads of a system of the given kinds, or
+// of all kinds if none are given.
+func (c *readCache) invalidate(id string, kinds ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(kinds) == 0 {
+		kinds = cacheKinds
+	}
+	for _, kind := range kinds {
+		delete(c.entries, cacheKey{id, kind})
+	}
+}
+
+// invalidateAll drops every cached read.
+func (c *readCache) invalidateAll() {
+	c.mu.Lock()
+	c.entries = map[cacheKey]cacheEntry{}
+	c.mu.Unlock()
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const capturePath = "/admin/capture"
+
+// DefaultCaptureMaxFiles is how many exchanges are captured before
+// capturing stops by itself.
+const DefaultCaptureMaxFiles = 1000
+
+// captureBodyBytes bounds each captured body.
+const captureBodyBytes = 1 << 20
+
+// redactedHeaders carry credentials and are never captured.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+
+// capturer writes request/response pairs to a directory, one numbered
+// JSON file per exchange, for debugging client integrations.
+type capturer struct {
+	dir     string
+	enabled atomic.Bool
+	// mu guards maxFiles and seq, the number of the last file written.
+	mu       sync.Mutex
+	maxFiles int
+	captured int
+	seq      int
+}
+
+// newCapturer prepares capturing to dir, creating it if needed and
+// numbering files after those already there.
+func newCapturer(dir string, maxFiles int) (*capturer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("capture dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("capture dir: %w", err)
+	}
+	c := &capturer{dir: dir, maxFiles: maxFiles}
+	for _, e := range entries {
+		if n, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".json")); err == nil && strings.HasSuffix(e.Name(), ".json") {
+			c.seq = max(c.seq, n)
+		}
+	}
+	c.enabled.Store(true)
+	return c, nil
+}
+
+// next reserves the number of the next file, or reports false once
+// maxFiles exchanges were captured, which disables capturing.
+func (c *capturer) next() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.captured >= c.maxFiles {
+		if c.enabled.CompareAndSwap(true, false) {
+			log.Printf("capture: %d exchanges captured, disabling capture", c.captured)
+		}
+		return 0, false
+	}
+	c.captured++
+	c.seq++
+	return c.seq, true
+}
+
+// skipCapture reports whether requests to p are left out of captures:
+// probes, metrics and the debug and admin endpoints.
+func skipCapture(p string) bool {
+	return healthPaths[p] || p == "/metrics" || isDebugPath(p) || isAdminPath(p)
+}
+
+type capturedMessage struct {
+	Method  string      `json:"method,omitempty"`
+	URI     string      `json:"uri,omitempty"`
+	Proto   string      `json:"proto,omitempty"`
+	Status  int         `json:"status,omitempty"`
+	Headers http.Header `json:"headers"`
+	// Body is embedded as JSON if it is JSON, otherwise as a string.
+	Body any `json:"body,omitempty"`
+}
+
+type capturedExchange struct {
+	Seq        int             `json:"seq"`
+	Time       time.Time       `json:"time"`
+	DurationMS float64         `json:"duration_ms"`
+	Route      string          `json:"route"`
+	Client     string          `json:"client"`
+	User       string          `json:"user,omitempty"`
+	Request    capturedMessage `json:"request"`
+	Response   capturedMessage `json:"response"`
+}
+
+// sanitizedHeaders copies h with credentials replaced.
+func sanitizedHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range redactedHeaders {
+		if _, ok := out[k]; ok {
+			out[k] = []string{"[REDACTED]"}
+		}
+	}
+	return out
+}
+
+// capturedBody renders a captured body for the file.
+func capturedBody(c *cappedBuffer) any {
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	if c.dropped == 0 && json.Valid(c.buf.Bytes()) {
+		return json.RawMessage(c.buf.Bytes())
+	}
+	return c.String()
+}
+
+// captureWriter copies a response as it is written.
+type captureWriter struct {
+	statusWriter
+	body *cappedBuffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.statusWriter.Write(p)
+	_, _ = w.body.Write(p[:n])
+	return n, err
+}
+
+// captureMiddleware writes every exchange to Config.CaptureDir while
+// capturing is enabled. Credentials in headers and the bodies that may
+// hold secrets (see skipBodyLog) are redacted.
+func (s *Server) captureMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.capture == nil || !s.capture.enabled.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The paths are matched as routed, without any URL prefix.
+		routed := s.unprefixed(r)
+		if skipCapture(routed.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		_, route := s.mux.Handler(routed)
+		reqHeaders := sanitizedHeaders(r.Header)
+		reqBody := &cappedBuffer{max: captureBodyBytes}
+		secret := secretBodyPath(routed.URL.Path)
+		if r.Body != nil && r.Body != http.NoBody && !secret {
+			r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+		}
+		cw := &captureWriter{statusWriter: statusWriter{ResponseWriter: w}, body: &cappedBuffer{max: captureBodyBytes}}
+		next.ServeHTTP(cw, r)
+
+		seq, ok := s.capture.next()
+		if !ok {
+			return
+		}
+		ex := capturedExchange{
+			Seq:        seq,
+			Time:       start.UTC(),
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			Route:      route,
+			Client:     clientIP(r),
+			Request: capturedMessage{
+				Method:  r.Method,
+				URI:     r.URL.RequestURI(),
+				Proto:   r.Proto,
+				Headers: reqHeaders,
+				Body:    capturedBody(reqBody),
+			},
+			Response: capturedMessage{
+				Status:  cw.status,
+				Headers: sanitizedHeaders(w.Header()),
+				Body:    capturedBody(cw.body),
+			},
+		}
+		if secret && r.ContentLength != 0 {
+			ex.Request.Body = "[REDACTED]"
+		}
+		if p, ok := requestPrincipal(r); ok {
+			ex.User = p.Name
+		}
+		if ex.Response.Status == 0 {
+			ex.Response.Status = http.StatusOK
+		}
+		if w.Header().Get("Content-Encoding") == "gzip" {
+			// Store what the handler rendered rather than compressed bytes.
+			if zr, err := gzip.NewReader(bytes.NewReader(cw.body.buf.Bytes())); err == nil {
+				plain := &cappedBuffer{max: captureBodyBytes}
+				_, _ = io.Copy(plain, zr)
+				ex.Response.Body = capturedBody(plain)
+			}
+		}
+		b, err := json.MarshalIndent(ex, "", "  ")
+		if err != nil {
+			log.Printf("capture: %v", err)
+			return
+		}
+		if err := os.WriteFile(filepath.Join(s.capture.dir, fmt.Sprintf("%06d.json", seq)), append(b, '\n'), 0o600); err != nil {
+			log.Printf("capture: %v", err)
+		}
+	})
+}
+
+// captureStatus is the JSON form of the capture settings.
+type captureStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Dir      string `json:"dir"`
+	MaxFiles int    `json:"max_files"`
+	Captured int    `json:"captured"`
+}
+
+func (c *capturer) status() captureStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return captureStatus{Enabled: c.enabled.Load(), Dir: c.dir, MaxFiles: c.maxFiles, Captured: c.captured}
+}
+
+// handleCapture shows the capture settings (GET) and changes them (POST),
+// e.g. {"enabled": true, "max_files": 200}. Raising max_files above the
+// number captured so far allows capturing again. It only exists if a
+// capture directory is configured.
+func (s *Server) handleCapture(w http.ResponseWriter, r *http.Request) {
+	c := s.capture
+	if c == nil {
+		writeNotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Enabled  *bool `json:"enabled"`
+			MaxFiles *int  `json:"max_files"`
+		}
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, msgMalformedJSON())
+			return
+		}
+		if body.MaxFiles != nil && *body.MaxFiles <= 0 {
+			writeError(w, http.StatusBadRequest, msgPropertyValueFormatError(strconv.Itoa(*body.MaxFiles), "max_files"))
+			return
+		}
+		c.mu.Lock()
+		if body.MaxFiles != nil {
+			c.maxFiles = *body.MaxFiles
+		}
+		if body.Enabled != nil {
+			c.enabled.Store(*body.Enabled)
+		}
+		c.mu.Unlock()
+		st := c.status()
+		log.Printf("capture set by %s: enabled %t, max files %d", initiator(r), st.Enabled, st.MaxFiles)
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.status())
+}
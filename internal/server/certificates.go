@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// httpsCertPath is the one certificate we serve: that of the https
+// listeners.
+const httpsCertPath = "/redfish/v1/Managers/" + managerID + "/NetworkProtocol/HTTPS/Certificates/1"
+
+const replaceCertAction = "CertificateService.ReplaceCertificate"
+
+// handleCertificateService serves the CertificateService and its action.
+// It only exists for a static certificate; one obtained through ACME
+// cannot be replaced.
+func (s *Server) handleCertificateService(w http.ResponseWriter, r *http.Request) {
+	if s.tlsCert.Load() == nil {
+		writeNotFound(w, r)
+		return
+	}
+	base := "/redfish/v1/CertificateService"
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case base:
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":          "#CertificateService.v1_0_0.CertificateService",
+			"@odata.id":            base,
+			"Id":                   "CertificateService",
+			"Name":                 "Certificate Service",
+			"CertificateLocations": map[string]string{"@odata.id": base + "/CertificateLocations"},
+			"Actions": map[string]any{
+				"#" + replaceCertAction: map[string]any{
+					"target": base + "/Actions/" + replaceCertAction,
+					"CertificateType@Redfish.AllowableValues": []string{"PEM"},
+				},
+			},
+		})
+	case base + "/CertificateLocations":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type": "#CertificateLocations.v1_0_0.CertificateLocations",
+			"@odata.id":   base + "/CertificateLocations",
+			"Id":          "CertificateLocations",
+			"Name":        "Certificate Locations",
+			"Links": map[string]any{
+				"Certificates": []map[string]string{{"@odata.id": httpsCertPath}},
+			},
+		})
+	case base + "/Actions/" + replaceCertAction:
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.replaceCertificate(w, r)
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+// handleHTTPSCertificates serves the certificate collection of the https
+// listeners below the manager, sub being the path below Certificates.
+func (s *Server) handleHTTPSCertificates(w http.ResponseWriter, r *http.Request, sub string) {
+	cert := s.tlsCert.Load()
+	if cert == nil {
+		writeNotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	switch sub {
+	case "":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":         "#CertificateCollection.CertificateCollection",
+			"@odata.id":           strings.TrimSuffix(httpsCertPath, "/1"),
+			"Name":                "HTTPS Certificate Collection",
+			"Members":             []map[string]string{{"@odata.id": httpsCertPath}},
+			"Members@odata.count": 1,
+		})
+	case "1":
+		writeJSON(w, http.StatusOK, certificateResource(cert))
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+// certificateResource renders the certificate of the https listeners. The
+// private key is never shown.
+func certificateResource(cert *tls.Certificate) map[string]any {
+	var chain bytes.Buffer
+	for _, der := range cert.Certificate {
+		_ = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	leaf := cert.Leaf
+	sum := sha256.Sum256(leaf.Raw)
+	return map[string]any{
+		"@odata.type":              "#Certificate.v1_3_0.Certificate",
+		"@odata.id":                httpsCertPath,
+		"Id":                       "1",
+		"Name":                     "HTTPS Certificate",
+		"CertificateString":        chain.String(),
+		"CertificateType":          "PEM",
+		"Issuer":                   certIdentifier(leaf.Issuer),
+		"Subject":                  certIdentifier(leaf.Subject),
+		"ValidNotBefore":           leaf.NotBefore.UTC().Format(time.RFC3339),
+		"ValidNotAfter":            leaf.NotAfter.UTC().Format(time.RFC3339),
+		"Fingerprint":              strings.ToUpper(hex.EncodeToString(sum[:])),
+		"FingerprintHashAlgorithm": "TPM_ALG_SHA256",
+	}
+}
+
+// certIdentifier renders the Issuer or Subject of a certificate.
+func certIdentifier(n pkix.Name) map[string]string {
+	id := map[string]string{"CommonName": n.CommonName}
+	for prop, v := range map[string][]string{
+		"Organization":       n.Organization,
+		"OrganizationalUnit": n.OrganizationalUnit,
+		"City":               n.Locality,
+		"State":              n.Province,
+		"Country":            n.Country,
+	} {
+		if len(v) > 0 {
+			id[prop] = v[0]
+		}
+	}
+	return id
+}
+
+// replaceCertificate implements ReplaceCertificate: CertificateString
+// holds the PEM certificate chain and its private key, which must match
+// and be currently valid. Both are written to the configured files and
+// served from the next TLS handshake on.
+func (s *Server) replaceCertificate(w http.ResponseWriter, r *http.Request) {
+	// The certificate is shared by every system.
+	if p, ok := requestPrincipal(r); ok && p.Systems != nil {
+		writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
+		return
+	}
+	var body struct {
+		CertificateString string
+		CertificateType   string
+		CertificateURI    *struct {
+			ODataID string `json:"@odata.id"`
+		} `json:"CertificateUri"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return
+	}
+	var msgs []message
+	if body.CertificateString == "" {
+		msgs = append(msgs, msgActionParameterMissing(replaceCertAction, "CertificateString"))
+	}
+	switch body.CertificateType {
+	case "PEM":
+	case "":
+		msgs = append(msgs, msgActionParameterMissing(replaceCertAction, "CertificateType"))
+	default:
+		msgs = append(msgs, msgActionParameterValueFormatError(body.CertificateType, "CertificateType", replaceCertAction))
+	}
+	if body.CertificateURI == nil {
+		msgs = append(msgs, msgActionParameterMissing(replaceCertAction, "CertificateUri"))
+	} else if body.CertificateURI.ODataID != httpsCertPath {
+		msgs = append(msgs, msgActionParameterValueFormatError(body.CertificateURI.ODataID, "CertificateUri", replaceCertAction))
+	}
+	if len(msgs) > 0 {
+		writeError(w, http.StatusBadRequest, msgs...)
+		return
+	}
+	certPEM, keyPEM, cert, err := parseCertificate(body.CertificateString, time.Now())
+	if err != nil {
+		// The string holds a private key, so only the problem is echoed.
+		writeError(w, http.StatusBadRequest, msgActionParameterValueFormatError("<"+err.Error()+">", "CertificateString", replaceCertAction))
+		return
+	}
+	if err := s.installCertificate(certPEM, keyPEM, cert); err != nil {
+		log.Printf("replace certificate: %v", err)
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	log.Printf("certificate replaced by %s: subject %q, issuer %q, valid until %s",
+		initiator(r), cert.Leaf.Subject, cert.Leaf.Issuer, cert.Leaf.NotAfter.UTC().Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, certificateResource(cert))
+}
+
+// parseCertificate splits a PEM bundle into the certificate chain and the
+// private key and checks that they match and that the certificate is
+// valid at now.
+func parseCertificate(bundle string, now time.Time) (certPEM, keyPEM []byte, cert *tls.Certificate, err error) {
+	var certs, keys bytes.Buffer
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			_ = pem.Encode(&certs, block)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if keys.Len() > 0 {
+				return nil, nil, nil, errors.New("more than one private key")
+			}
+			_ = pem.Encode(&keys, block)
+		}
+	}
+	if certs.Len() == 0 {
+		return nil, nil, nil, errors.New("no certificate")
+	}
+	if keys.Len() == 0 {
+		return nil, nil, nil, errors.New("no private key")
+	}
+	c, err := tls.X509KeyPair(certs.Bytes(), keys.Bytes())
+	if err != nil {
+		return nil, nil, nil, errors.New("certificate and key do not match")
+	}
+	if c.Leaf == nil {
+		if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return nil, nil, nil, errors.New("invalid certificate")
+		}
+	}
+	if now.Before(c.Leaf.NotBefore) {
+		return nil, nil, nil, errors.New("certificate not yet valid")
+	}
+	if now.After(c.Leaf.NotAfter) {
+		return nil, nil, nil, errors.New("certificate expired")
+	}
+	return certs.Bytes(), keys.Bytes(), &c, nil
+}
+
+// installCertificate writes the certificate and key to Config.TLSCert and
+// Config.TLSKey, or both to one file if they are the same, and serves the
+// certificate from then on.
+func (s *Server) installCertificate(certPEM, keyPEM []byte, cert *tls.Certificate) error {
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+	if s.cfg.TLSCert == s.cfg.TLSKey {
+		if err := writeFileAtomic(s.cfg.TLSKey, append(certPEM, keyPEM...), filePerm(s.cfg.TLSKey, 0o600)); err != nil {
+			return err
+		}
+	} else {
+		if err := writeFileAtomic(s.cfg.TLSKey, keyPEM, filePerm(s.cfg.TLSKey, 0o600)); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(s.cfg.TLSCert, certPEM, filePerm(s.cfg.TLSCert, 0o644)); err != nil {
+			return err
+		}
+	}
+	s.tlsCert.Store(cert)
+	return nil
+}
+
+// filePerm returns the permissions of the file at path, or def if it
+// cannot be read.
+func filePerm(path string, def fs.FileMode) fs.FileMode {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return def
+	}
+	return fi.Mode().Perm()
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// Every system is modelled with a chassis of the same ID, which carries the
+// environmental resources (power, thermal) of the system.
+
+func (s *Server) handleChassisCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ids := s.visibleSystemIDs(r)
+	members := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, map[string]string{"@odata.id": "/redfish/v1/Chassis/" + id})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":         "#ChassisCollection.ChassisCollection",
+		"@odata.id":           "/redfish/v1/Chassis",
+		"Name":                "Chassis Collection",
+		"Members":             members,
+		"Members@odata.count": len(members),
+	})
+}
+
+func (s *Server) handleChassis(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/redfish/v1/Chassis/")
+	id, sub, _ := strings.Cut(path, "/")
+	sub = strings.TrimSuffix(sub, "/")
+	be, ok := s.system(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+	if !inScope(r, id) {
+		s.writeOutOfScope(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	base := "/redfish/v1/Chassis/" + id
+	switch sub {
+	case "":
+		chassis := map[string]any{
+			"@odata.type": "#Chassis.v1_14_0.Chassis",
+			"@odata.id":   base,
+			"Id":          id,
+			"Name":        s.systemName(r.Context(), id, be, s.systemInfo(id)),
+			"ChassisType": "Other",
+			"PowerState":  s.powerState(r.Context(), id, be),
+			"Links": map[string]any{
+				"ComputerSystems": []map[string]string{
+					{"@odata.id": "/redfish/v1/Systems/" + id},
+				},
+			},
+		}
+		if _, ok := s.powerMetrics(r.Context(), id, be); ok {
+			chassis["Power"] = map[string]string{"@odata.id": base + "/Power"}
+			chassis["EnvironmentMetrics"] = map[string]string{"@odata.id": base + "/EnvironmentMetrics"}
+		}
+		if _, ok := s.temperatures(r.Context(), id, be); ok {
+			chassis["Thermal"] = map[string]string{"@odata.id": base + "/Thermal"}
+		}
+		if b := s.backendOem(r.Context(), id, be); b != nil {
+			chassis["Oem"] = map[string]any{"BmcShim": map[string]any{"Backend": b}}
+		}
+		writeJSON(w, http.StatusOK, chassis)
+	case "Power":
+		m, ok := s.powerMetrics(r.Context(), id, be)
+		if !ok {
+			writeNotFound(w, r)
+			return
+		}
+		control := map[string]any{
+			"@odata.id": base + "/Power#/PowerControl/0",
+			"MemberId":  "0",
+			"Name":      "System Power Control",
+		}
+		if m.Watts != nil {
+			control["PowerConsumedWatts"] = *m.Watts
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":  "#Power.v1_7_1.Power",
+			"@odata.id":    base + "/Power",
+			"Id":           "Power",
+			"Name":         "Power",
+			"PowerControl": []map[string]any{control},
+		})
+	case "EnvironmentMetrics":
+		m, ok := s.powerMetrics(r.Context(), id, be)
+		if !ok {
+			writeNotFound(w, r)
+			return
+		}
+		env := map[string]any{
+			"@odata.type": "#EnvironmentMetrics.v1_3_0.EnvironmentMetrics",
+			"@odata.id":   base + "/EnvironmentMetrics",
+			"Id":          "EnvironmentMetrics",
+			"Name":        "Chassis Environment Metrics",
+		}
+		if m.Watts != nil {
+			env["PowerWatts"] = map[string]any{"Reading": *m.Watts}
+		}
+		if m.EnergyKWh != nil {
+			env["EnergykWh"] = map[string]any{"Reading": *m.EnergyKWh}
+		}
+		writeJSON(w, http.StatusOK, env)
+	case "Thermal":
+		readings, ok := s.temperatures(r.Context(), id, be)
+		if !ok {
+			writeNotFound(w, r)
+			return
+		}
+		temps := make([]map[string]any, 0, len(readings))
+		for i, t := range readings {
+			n := strconv.Itoa(i)
+			temp := map[string]any{
+				"@odata.id": base + "/Thermal#/Temperatures/" + n,
+				"MemberId":  n,
+				"Name":      t.Name,
+			}
+			if t.Celsius != nil {
+				temp["ReadingCelsius"] = *t.Celsius
+				temp["Status"] = map[string]string{"State": "Enabled", "Health": "OK"}
+			} else {
+				temp["Status"] = map[string]string{"State": "Absent"}
+			}
+			temps = append(temps, temp)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":  "#Thermal.v1_7_0.Thermal",
+			"@odata.id":    base + "/Thermal",
+			"Id":           "Thermal",
+			"Name":         "Thermal",
+			"Temperatures": temps,
+		})
+	default:
+		writeNotFound(w, r)
+	}
+}
+
+// powerMetrics returns the backend's power metrics, reporting false when
+// the backend has no metrics source for this system.
+func (s *Server) powerMetrics(ctx context.Context, id string, be backend.System) (backend.PowerMetrics, bool) {
+	pm := be.Capabilities().PowerMetrics
+	if pm == nil {
+		return backend.PowerMetrics{}, false
+	}
+	m, err := cachedRead(s.cache, ctx, id, cacheMetrics, s.cfg.CacheTTL, pm.PowerMetrics)
+	if errors.Is(err, backend.ErrNotSupported) {
+		return backend.PowerMetrics{}, false
+	}
+	if err != nil {
+		// The resource still exists; the readings are just unknown.
+		log.Printf("power metrics for %s: %v", id, err)
+		return backend.PowerMetrics{}, true
+	}
+	return m, true
+}
+
+// temperatures returns the backend's temperature readings, reporting false
+// when the backend has no temperature sensors for this system.
+func (s *Server) temperatures(ctx context.Context, id string, be backend.System) ([]backend.TemperatureReading, bool) {
+	tp := be.Capabilities().Thermal
+	if tp == nil {
+		return nil, false
+	}
+	readings, err := cachedRead(s.cache, ctx, id, cacheThermal, s.cfg.CacheTTL, tp.Temperatures)
+	if errors.Is(err, backend.ErrNotSupported) {
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("temperatures for %s: %v", id, err)
+		return nil, true
+	}
+	return readings, true
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ctxKey int
+
+const clientIPKey ctxKey = iota
+
+// ParseTrustedProxies parses a list of CIDRs or single IP addresses.
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	return parsePrefixes(list, "trusted proxy")
+}
+
+// parsePrefixes parses CIDRs or single IP addresses; what names the list
+// in errors.
+func parsePrefixes(list []string, what string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, v := range list {
+		if p, err := netip.ParsePrefix(v); err == nil {
+			if p.Addr().Is4In6() {
+				// Written as ::ffff:a.b.c.d/n; match it like the IPv4
+				// prefix since addresses are unmapped before matching.
+				if p.Bits() < 96 {
+					return nil, fmt.Errorf("invalid %s %q: IPv4-mapped prefix shorter than /96", what, v)
+				}
+				p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(v)
+		if err != nil || a.Zone() != "" {
+			return nil, fmt.Errorf("invalid %s %q (expected CIDR or IP)", what, v)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// prefixesContain reports whether ip is in one of prefixes. IPv4-mapped
+// IPv6 addresses match IPv4 prefixes, and zones are ignored.
+func prefixesContain(prefixes []netip.Prefix, ip string) bool {
+	a, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	a = a.Unmap().WithZone("")
+	for _, p := range prefixes {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIPMiddleware derives the real client IP and stores it in the
+// request context, where clientIP finds it.
+func (s *Server) clientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.deriveClientIP(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+	})
+}
+
+// clientIP returns the client IP derived for r, or its RemoteAddr host if
+// the request did not pass through clientIPMiddleware.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
+
+// deriveClientIP returns the peer address unless the peer is a trusted
+// proxy. Then the forwarding headers are walked from the right and the
+// first hop that is not itself a trusted proxy is the client.
+func (s *Server) deriveClientIP(r *http.Request) string {
+	peer := remoteHost(r.RemoteAddr)
+	if !s.trusted(peer) {
+		return peer
+	}
+	hops := forwardedFor(r.Header)
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			// Garbage (or "unknown"): stop at the last hop we could verify.
+			break
+		}
+		client = hops[i]
+		if !s.trusted(client) {
+			break
+		}
+	}
+	return client
+}
+
+func (s *Server) trusted(ip string) bool {
+	return prefixesContain(s.cfg.TrustedProxies, ip)
+}
+
+// forwardedFor returns the client chain a proxy reported, left to right,
+// from the Forwarded header, X-Forwarded-For or X-Real-IP, in that order
+// of preference.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	if vals := h.Values("Forwarded"); len(vals) > 0 {
+		for _, elem := range strings.Split(strings.Join(vals, ","), ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hops = append(hops, forwardedNode(v))
+				}
+			}
+		}
+		return hops
+	}
+	if vals := h.Values("X-Forwarded-For"); len(vals) > 0 {
+		for _, v := range strings.Split(strings.Join(vals, ","), ",") {
+			hops = append(hops, forwardedNode(v))
+		}
+		return hops
+	}
+	if v := h.Get("X-Real-IP"); v != "" {
+		return []string{forwardedNode(v)}
+	}
+	return nil
+}
+
+// forwardedNode strips quotes, brackets and ports from a forwarded node,
+// e.g. "[2001:db8::1]:4711" becomes 2001:db8::1.
+func forwardedNode(v string) string {
+	v = strings.Trim(strings.TrimSpace(v), `"`)
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		return host
+	}
+	return strings.Trim(v, "[]")
+}
+
+// remoteHost returns the host part of a RemoteAddr.
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
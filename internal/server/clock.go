@@ -0,0 +1,18 @@
+package server
+
+import "time"
+
+// clock is the time source of the power-on gate and the power-on
+// accounting, replaced by a fake in tests.
+type clock interface {
+	Now() time.Time
+	// After is like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the clock of the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Compatibility profiles of Config.Compat.
+const (
+	// CompatStrict is the spec-correct behavior.
+	CompatStrict = "strict"
+	// CompatIDRACish suits clients written against iDRACs: actions
+	// answer 200 with a Success message and collection counts are
+	// strings.
+	CompatIDRACish = "idrac-ish"
+	// CompatLegacy restores the responses of old versions: actions
+	// answer 200 {"status":"ok"} and resources carry no @odata.context.
+	CompatLegacy = "legacy"
+)
+
+// CompatProfiles lists the valid values of Config.Compat.
+var CompatProfiles = []string{CompatStrict, CompatIDRACish, CompatLegacy}
+
+// ProfileMetal3 is the Config.Profile of Ironic's redfish driver, as used
+// for Metal3 BareMetalHosts. The Boot property of the systems advertises
+// the override modes Ironic's boot mode management reads, which it would
+// otherwise guess.
+const ProfileMetal3 = "metal3"
+
+// compatProfile is the set of response-shaping behaviors of a profile.
+type compatProfile struct {
+	// actionBody, if set, answers successful actions with 200 and this
+	// body instead of 204 No Content.
+	actionBody func() any
+	// stringCounts renders Members@odata.count as a string.
+	stringCounts bool
+	// noContext omits @odata.context.
+	noContext bool
+}
+
+var compatProfiles = map[string]compatProfile{
+	CompatStrict: {},
+	CompatIDRACish: {
+		actionBody:   func() any { return map[string]any{"@Message.ExtendedInfo": []message{msgSuccess()}} },
+		stringCounts: true,
+	},
+	CompatLegacy: {
+		actionBody: func() any { return map[string]string{"status": "ok"} },
+		noContext:  true,
+	},
+}
+
+// ParseCompat validates a compatibility profile name.
+func ParseCompat(v string) (string, error) {
+	if !slices.Contains(CompatProfiles, v) {
+		return "", fmt.Errorf("invalid compatibility profile %q (expected %s)", v, strings.Join(CompatProfiles, ", "))
+	}
+	return v, nil
+}
+
+// rewrites reports whether the profile changes JSON bodies.
+func (p compatProfile) rewrites() bool {
+	return p.stringCounts || p.noContext
+}
+
+// rewrite applies the profile to a rendered JSON body. Bodies it cannot
+// parse are returned as they are.
+func (p compatProfile) rewrite(b []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return b
+	}
+	out, err := json.Marshal(p.rewriteValue(v))
+	if err != nil {
+		log.Printf("compat: re-encoding response: %v", err)
+		return b
+	}
+	return out
+}
+
+func (p compatProfile) rewriteValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			switch {
+			case k == "@odata.context" && p.noContext:
+				delete(v, k)
+			case strings.HasSuffix(k, "@odata.count") && p.stringCounts:
+				if n, ok := e.(json.Number); ok {
+					v[k] = n.String()
+				}
+			default:
+				v[k] = p.rewriteValue(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = p.rewriteValue(e)
+		}
+	}
+	return v
+}
+
+// compatWriter carries the profile of the response to writeJSON and turns
+// 204 No Content answers to actions into 200 with the profile's body.
+type compatWriter struct {
+	http.ResponseWriter
+	p      compatProfile
+	action bool
+}
+
+func (c *compatWriter) WriteHeader(code int) {
+	if code == http.StatusNoContent && c.action && c.p.actionBody != nil {
+		writeJSON(c.ResponseWriter, http.StatusOK, c.p.actionBody())
+		return
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (c *compatWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// compatMiddleware applies Config.Compat to the responses of the handlers
+// it wraps; the strict profile leaves them alone.
+func (s *Server) compatMiddleware(next http.Handler) http.Handler {
+	p := compatProfiles[s.cfg.Compat]
+	if p.actionBody == nil && !p.rewrites() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/Actions/")
+		next.ServeHTTP(&compatWriter{ResponseWriter: w, p: p, action: action}, r)
+	})
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestCompatGolden replays the same session against each compatibility
+// profile and compares the transcripts with testdata/compat.
+func TestCompatGolden(t *testing.T) {
+	exchanges := []exchange{
+		{http.MethodGet, "/redfish/v1/Systems", ""},
+		{http.MethodGet, "/redfish/v1/Systems/1", ""},
+		{http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", `{"ResetType": "On"}`},
+		{http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", `{"ResetType": "Hibernate"}`},
+		{http.MethodGet, "/redfish/v1/Managers", ""},
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	for _, profile := range CompatProfiles {
+		t.Run(profile, func(t *testing.T) {
+			h := newGoldenServer(Config{Compat: profile}).Handler()
+			replay(t, h, header, "compat/"+profile+".golden", exchanges)
+		})
+	}
+}
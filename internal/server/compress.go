@@ -0,0 +1,180 @@
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize is the smallest response body worth compressing; below it
+// the gzip framing outweighs the savings.
+const gzipMinSize = 1024
+
+var gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// gzipMiddleware compresses JSON responses of at least gzipMinSize bytes
+// for clients that accept gzip. The health endpoints are left alone so
+// that probes stay trivial.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if healthPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip. An
+// explicit gzip entry takes precedence over a "*" one.
+func acceptsGzip(header string) bool {
+	gzipQ, starQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzipQ = q
+		case "*":
+			starQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return starQ > 0
+}
+
+// gzipResponseWriter holds back the status and the start of the body
+// until it knows whether the response is worth compressing.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	code    int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.decided || g.code != 0 {
+		return
+	}
+	g.code = code
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.code == 0 {
+		g.code = http.StatusOK
+	}
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= gzipMinSize {
+		if err := g.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide sends the header, compressed if the response qualifies, and the
+// buffered body.
+func (g *gzipResponseWriter) decide() error {
+	g.decided = true
+	if g.code == 0 {
+		g.code = http.StatusOK
+	}
+	h := g.Header()
+	if len(g.buf) >= gzipMinSize && compressible(g.code, h) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		// The compressed body is a different representation; a strong
+		// validator must not match the identity one.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		g.gz = gzipPool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.code)
+	if len(g.buf) == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(g.buf)
+	} else {
+		_, err = g.ResponseWriter.Write(g.buf)
+	}
+	g.buf = nil
+	return err
+}
+
+// compressible reports whether a response with this status and header
+// may be compressed.
+func compressible(code int, h http.Header) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	ct, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	return strings.TrimSpace(ct) == "application/json"
+}
+
+// Flush sends what has been written so far, so streaming responses keep
+// working through the middleware.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		if err := g.decide(); err != nil {
+			return
+		}
+	}
+	if g.gz != nil {
+		_ = g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// finish completes the response once the handler has returned.
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		if g.code == 0 && len(g.buf) == 0 {
+			// Nothing was written; let net/http send its default.
+			return
+		}
+		_ = g.decide()
+	}
+	if g.gz != nil {
+		_ = g.gz.Close()
+		g.gz.Reset(nil)
+		gzipPool.Put(g.gz)
+		g.gz = nil
+	}
+}
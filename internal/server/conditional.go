@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// version is when a rendered resource was first seen with its current
+// content.
+type version struct {
+	sum [sha256.Size]byte
+	at  time.Time
+}
+
+// modifiedSince returns when the resource at key last changed, judged by
+// comparing its rendered form v with the one seen before. Resources that
+// mix in backend data (power state, sensor readings) have no timestamp of
+// their own, so this is the closest to one the service can give.
+func (s *Server) modifiedSince(key string, v any) time.Time {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return time.Time{}
+	}
+	sum := sha256.Sum256(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.versions[key]; ok && cur.sum == sum {
+		return cur.at
+	}
+	now := time.Now().UTC()
+	s.versions[key] = version{sum: sum, at: now}
+	return now
+}
+
+// writeJSONModified is writeJSON for a resource last modified at
+// modified: it sets Last-Modified and answers a GET or HEAD whose
+// If-Modified-Since is not older with 304 Not Modified. A zero modified
+// writes v unconditionally.
+func writeJSONModified(w http.ResponseWriter, r *http.Request, modified time.Time, v any) {
+	if modified.IsZero() {
+		writeJSON(w, http.StatusOK, v)
+		return
+	}
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if notModified(r, modified) {
+		setRedfishHeaders(w.Header())
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// notModified evaluates If-Modified-Since, which is ignored when the
+// request also carries If-None-Match (RFC 9110, 13.1.3).
+func notModified(r *http.Request, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// cooldownError is returned for a power action arriving within the
+// cooldown window of the previous action on the same system.
+type cooldownError struct {
+	retryAfter time.Duration
+}
+
+func (e *cooldownError) Error() string {
+	return fmt.Sprintf("power action cooldown, retry in %s", e.retryAfter.Round(time.Second))
+}
+
+// retrySeconds is retryAfter rounded up to whole seconds.
+func (e *cooldownError) retrySeconds() int {
+	return int((e.retryAfter + time.Second - 1) / time.Second)
+}
+
+// targetState returns the power state a ResetType leaves the system in;
+// ok is false for restarts, which never match the current state.
+func targetState(resetType string) (on, ok bool) {
+	switch resetType {
+	case "On":
+		return true, true
+	case "ForceOff", "GracefulShutdown", "Off":
+		return false, true
+	}
+	return false, false
+}
+
+// reserveAction enforces Config.ActionCooldown. Inside the window a
+// request for the state the system is already in is a no-op (skip) and
+// anything else is refused; otherwise the window restarts now.
+func (s *Server) reserveAction(id, resetType string) (skip bool, err error) {
+	if s.cfg.ActionCooldown <= 0 {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if last, ok := s.lastAction[id]; ok {
+		if wait := s.cfg.ActionCooldown - now.Sub(last); wait > 0 {
+			want, idempotent := targetState(resetType)
+			if cur, known := s.last[id]; idempotent && known && cur == want {
+				return true, nil
+			}
+			return false, &cooldownError{retryAfter: wait}
+		}
+	}
+	s.lastAction[id] = now
+	return false, nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// gatedBackend is a Backend reporting its power state whose power calls
+// wait for release, if set, and are counted.
+type gatedBackend struct {
+	release chan struct{}
+	entered chan struct{}
+
+	mu    sync.Mutex
+	on    bool
+	calls int
+}
+
+func (g *gatedBackend) switchTo(on bool) error {
+	g.mu.Lock()
+	g.calls++
+	g.mu.Unlock()
+	if g.entered != nil {
+		g.entered <- struct{}{}
+	}
+	if g.release != nil {
+		<-g.release
+	}
+	g.mu.Lock()
+	g.on = on
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *gatedBackend) PowerOn(ctx context.Context) error  { return g.switchTo(true) }
+func (g *gatedBackend) PowerOff(ctx context.Context) error { return g.switchTo(false) }
+
+func (g *gatedBackend) CurrentState(ctx context.Context) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.on, nil
+}
+
+func (g *gatedBackend) callCount() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+func resetRequest(h http.Handler, resetType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", strings.NewReader(`{"ResetType":"`+resetType+`"}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestCooldownConcurrentResets checks that of simultaneous resets inside
+// the cooldown window only one reaches the backend; the others are
+// refused, or skipped once the system is in the state they ask for.
+func TestCooldownConcurrentResets(t *testing.T) {
+	for _, resetType := range []string{"On", "ForceOff"} {
+		t.Run(resetType, func(t *testing.T) {
+			be := &gatedBackend{on: resetType != "On"}
+			h := New(Config{
+				Systems:        map[string]backend.System{"1": backend.Adapt(be)},
+				ActionCooldown: time.Minute,
+			}).Handler()
+
+			const n = 8
+			codes := make(chan int, n)
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for range n {
+				wg.Go(func() {
+					<-start
+					codes <- resetRequest(h, resetType).Code
+				})
+			}
+			close(start)
+			wg.Wait()
+			close(codes)
+
+			count := map[int]int{}
+			for code := range codes {
+				count[code]++
+			}
+			if be.callCount() != 1 {
+				t.Errorf("backend calls = %d, want 1", be.callCount())
+			}
+			if count[http.StatusNoContent] != 1 || count[http.StatusNoContent]+count[http.StatusOK]+count[http.StatusTooManyRequests] != n {
+				t.Errorf("responses = %v, want one 204 and the rest 200 or 429", count)
+			}
+		})
+	}
+}
+
+// TestCooldownWhileInFlight checks that a reset arriving while the one
+// that started the window is still running is refused with Retry-After,
+// and that a later request for the state reached is skipped.
+func TestCooldownWhileInFlight(t *testing.T) {
+	be := &gatedBackend{release: make(chan struct{}), entered: make(chan struct{}, 1)}
+	h := New(Config{
+		Systems:        map[string]backend.System{"1": backend.Adapt(be)},
+		ActionCooldown: time.Minute,
+	}).Handler()
+
+	first := make(chan int, 1)
+	go func() { first <- resetRequest(h, "On").Code }()
+	<-be.entered
+
+	for _, resetType := range []string{"On", "ForceRestart"} {
+		rec := resetRequest(h, resetType)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%s during the first reset = %d, want 429: %s", resetType, rec.Code, rec.Body)
+		}
+		if ra := rec.Header().Get("Retry-After"); ra == "" || ra == "0" {
+			t.Errorf("%s during the first reset: Retry-After = %q, want the rest of the window", resetType, ra)
+		}
+	}
+	close(be.release)
+	if code := <-first; code != http.StatusNoContent {
+		t.Fatalf("first reset = %d, want 204", code)
+	}
+
+	if rec := resetRequest(h, "On"); rec.Code != http.StatusOK {
+		t.Errorf("On when already on = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if rec := resetRequest(h, "ForceOff"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("ForceOff inside the window = %d, want 429: %s", rec.Code, rec.Body)
+	}
+	if be.callCount() != 1 {
+		t.Errorf("backend calls = %d, want 1", be.callCount())
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// debugHandler serves pprof, expvar and a dump of the server's in-memory
+// state under /debug/.
+func (s *Server) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/state", s.handleDebugState)
+	return mux
+}
+
+func (s *Server) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	systems := map[string]string{}
+	set := s.systems.Load()
+	for id, be := range set.backends {
+		systems[id] = fmt.Sprintf("%T", be)
+	}
+	logs := map[string]int{}
+	for id, l := range set.logs {
+		logs[id] = len(l.list())
+	}
+
+	s.mu.RLock()
+	last := make(map[string]string, len(s.last))
+	for id, on := range s.last {
+		last[id] = powerStateString(on)
+	}
+	boot := make(map[string]Boot, len(s.boot))
+	for id, b := range s.boot {
+		boot[id] = b
+	}
+	asset := make(map[string]Asset, len(s.asset))
+	for id, a := range s.asset {
+		asset[id] = a
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"systems":         systems,
+		"lastPowerState":  last,
+		"boot":            boot,
+		"asset":           asset,
+		"eventLogEntries": logs,
+		"inFlightActions": s.actions.total(),
+		"actions":         s.actionStatus(),
+	})
+}
+
+// isDebugPath reports whether p is served by the debug handler.
+func isDebugPath(p string) bool {
+	return strings.HasPrefix(p, "/debug/")
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// dryRunHeaders are request headers a client might use to try to switch
+// dry-run off. They are rejected rather than ignored so nobody believes
+// they bypassed it.
+var dryRunHeaders = []string{"X-Dry-Run", "X-BmcShim-Dry-Run"}
+
+// dryRun reports whether power actions on a system are only simulated.
+func (s *Server) dryRun(id string) bool {
+	return s.cfg.DryRun || s.systemInfo(id).DryRun
+}
+
+// resetCalls lists the backend calls a ResetType maps to.
+func resetCalls(be backend.System, resetType string) ([]string, error) {
+	rc, ok := be.Capabilities().Reset(backend.ResetType(resetType))
+	if !ok {
+		return nil, errUnsupportedResetType
+	}
+	if len(rc.Calls) == 0 {
+		return []string{"Reset(" + resetType + ")"}, nil
+	}
+	return rc.Calls, nil
+}
+
+// simulatedCalls lists the backend calls a reset of a system would make.
+func (s *Server) simulatedCalls(id string, be backend.System, resetType string) ([]string, error) {
+	mapped, err := s.mappedResetType(id, resetType)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := resetCalls(be, mapped)
+	if err != nil {
+		return nil, err
+	}
+	if h := s.systemInfo(id).PostPowerOn; h != nil && powersOn(mapped) {
+		calls = append(calls, h.Name)
+	}
+	return calls, nil
+}
+
+// simulateReset logs and records the backend calls a reset would make,
+// without making them or touching any state.
+func (s *Server) simulateReset(id string, be backend.System, resetType, by string) resetResult {
+	calls, err := s.simulatedCalls(id, be, resetType)
+	if err != nil {
+		return resetResult{outcome: "refused", code: http.StatusBadRequest, msgs: []message{msgActionParameterValueFormatError(resetType, "ResetType", "ComputerSystem.Reset")}}
+	}
+	log.Printf("dry run: system %s: would call %s", id, strings.Join(calls, ", "))
+	s.recordEvent(id, severityOK, fmt.Sprintf("Reset %s requested by %s simulated (dry run: %s not called)", resetType, by, strings.Join(calls, ", ")))
+	s.recordAction(id, resetType, by, "simulated", nil)
+	return resetResult{outcome: "simulated", code: http.StatusOK, oem: map[string]any{
+		"DryRun":         true,
+		"SimulatedCalls": calls,
+	}}
+}
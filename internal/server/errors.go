@@ -0,0 +1,138 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/redfish"
+)
+
+// message is a Redfish Message object as used in @Message.ExtendedInfo.
+type message = redfish.Message
+
+// writeError writes a Redfish error response carrying msgs as extended info.
+func writeError(w http.ResponseWriter, code int, msgs ...message) {
+	general := newMessage("GeneralError")
+	errCode, errMsg := general.MessageID, general.Message
+	if len(msgs) == 1 {
+		errCode, errMsg = msgs[0].MessageID, msgs[0].Message
+	}
+	writeJSON(w, code, map[string]any{
+		"error": map[string]any{
+			"code":                  errCode,
+			"message":               errMsg,
+			"@Message.ExtendedInfo": msgs,
+		},
+	})
+}
+
+// writeNotFound answers a request for a resource that does not exist.
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, newMessage("ResourceMissingAtURI", r.URL.Path))
+}
+
+// writeMethodNotAllowed answers a request using a method the resource does
+// not support, listing the methods it does in the Allow header.
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allow ...string) {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	writeError(w, http.StatusMethodNotAllowed, newMessage("ActionNotSupported", r.Method))
+}
+
+// newMessage builds the message id of the Base registry, substituting args
+// for its %1..%n placeholders. An id missing from baseMessages is a bug,
+// which TestMessageIDsInRegistry catches; should one slip through, it is
+// logged and answered with InternalError rather than a panic.
+func newMessage(id string, args ...string) message {
+	def, ok := baseMessages[id]
+	if !ok {
+		log.Printf("message %q is not in the Base registry", id)
+		id, args = "InternalError", nil
+		def = baseMessages[id]
+	}
+	text := def.Message
+	for i := len(args); i > 0; i-- {
+		text = strings.ReplaceAll(text, "%"+strconv.Itoa(i), args[i-1])
+	}
+	return message{
+		ODataType:   "#Message.v1_1_1.Message",
+		MessageID:   baseRegistry + "." + id,
+		Message:     text,
+		MessageArgs: args,
+		Severity:    def.Severity,
+		Resolution:  def.Resolution,
+	}
+}
+
+func msgSuccess() message {
+	return newMessage("Success")
+}
+
+func msgActionParameterValueFormatError(value, param, action string) message {
+	return newMessage("ActionParameterValueFormatError", value, param, action)
+}
+
+func msgActionParameterNotSupported(param, action string) message {
+	return newMessage("ActionParameterNotSupported", param, action)
+}
+
+func msgActionParameterMissing(action, param string) message {
+	return newMessage("ActionParameterMissing", action, param)
+}
+
+func msgMalformedJSON() message {
+	return newMessage("MalformedJSON")
+}
+
+func msgPropertyUnknown(prop string) message {
+	return newMessage("PropertyUnknown", prop)
+}
+
+func msgPropertyNotWritable(prop string) message {
+	return newMessage("PropertyNotWritable", prop)
+}
+
+func msgPropertyMissing(prop string) message {
+	return newMessage("PropertyMissing", prop)
+}
+
+func msgPropertyValueTypeError(value, prop string) message {
+	return newMessage("PropertyValueTypeError", value, prop)
+}
+
+func msgPropertyValueFormatError(value, prop string) message {
+	return newMessage("PropertyValueFormatError", value, prop)
+}
+
+func msgPropertyValueNotInList(value, prop string) message {
+	return newMessage("PropertyValueNotInList", value, prop)
+}
+
+func msgQueryParameterValueTypeError(value, param string) message {
+	return newMessage("QueryParameterValueTypeError", value, param)
+}
+
+func msgQueryParameterOutOfRange(value, param, valRange string) message {
+	return newMessage("QueryParameterOutOfRange", value, param, valRange)
+}
+
+func msgNoValidSession() message {
+	return newMessage("NoValidSession")
+}
+
+func msgAccessDenied(uri string) message {
+	return newMessage("AccessDenied", uri)
+}
+
+func msgInsufficientPrivilege() message {
+	return newMessage("InsufficientPrivilege")
+}
+
+func msgServiceTemporarilyUnavailable(retryAfter string) message {
+	return newMessage("ServiceTemporarilyUnavailable", retryAfter)
+}
+
+func msgInternalError() message {
+	return newMessage("InternalError")
+}
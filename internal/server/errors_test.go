@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// TestMessageIDsInRegistry checks that every message the package builds
+// is defined in the Base registry it serves.
+func TestMessageIDsInRegistry(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	calls := 0
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "newMessage" {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				t.Errorf("%s: newMessage with a non-constant id", fset.Position(call.Pos()))
+				return true
+			}
+			id, _ := strconv.Unquote(lit.Value)
+			if _, ok := baseMessages[id]; !ok {
+				t.Errorf("%s: message %q is not in the Base registry", fset.Position(call.Pos()), id)
+			}
+			calls++
+			return true
+		})
+	}
+	if calls == 0 {
+		t.Fatal("found no newMessage calls")
+	}
+}
+
+func TestNewMessageUnknownID(t *testing.T) {
+	m := newMessage("NoSuchMessage", "arg")
+	if m.MessageID != baseRegistry+".InternalError" || len(m.MessageArgs) != 0 {
+		t.Errorf("message = %+v, want InternalError without args", m)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	tests := []struct {
+		method    string
+		path      string
+		legacy    bool
+		wantAllow string
+	}{
+		{http.MethodDelete, "/redfish/v1/", false, "GET"},
+		{http.MethodPost, "/redfish/v1/Systems", false, "GET"},
+		{http.MethodPut, "/redfish/v1/Systems/1", false, "GET, PATCH"},
+		{http.MethodPost, "/redfish/v1/Systems/1", false, "GET, PATCH"},
+		{http.MethodPut, "/redfish/v1/Systems/1", true, "GET, PATCH, POST"},
+		{http.MethodGet, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", false, "POST"},
+		{http.MethodPost, "/redfish/v1/Systems/1/Settings", false, "GET, PATCH, DELETE"},
+		{http.MethodPost, "/redfish/v1/Systems/1/LogServices/EventLog/Entries", false, "GET, DELETE"},
+		{http.MethodGet, "/redfish/v1/Managers/1/Actions/Manager.Reset", false, "POST"},
+		{http.MethodPost, "/redfish/v1/AccountService/Accounts/admin", false, "GET, PATCH"},
+		{http.MethodPost, jsonSchemasPath, false, "GET, HEAD"},
+		{http.MethodPut, simulatePath, false, "GET, POST, DELETE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			h := New(Config{
+				Username:       "admin",
+				Password:       "secret",
+				Systems:        map[string]backend.System{"1": backend.NewNoop()},
+				LegacyBootPOST: tt.legacy,
+			}).Handler()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			req.SetBasicAuth("admin", "secret")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			var body struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != baseRegistry+".ActionNotSupported" {
+				t.Errorf("error code = %q, want %s.ActionNotSupported", body.Error.Code, baseRegistry)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (s *Server) handleEthernetInterfaces(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	nics := s.systemInfo(id).EthernetInterfaces
+	base := "/redfish/v1/Systems/" + id + "/EthernetInterfaces"
+	members := make([]map[string]string, 0, len(nics))
+	for i := range nics {
+		members = append(members, map[string]string{"@odata.id": base + "/" + strconv.Itoa(i+1)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":         "#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		"@odata.id":           base,
+		"Name":                "Ethernet Interface Collection",
+		"Members":             members,
+		"Members@odata.count": len(members),
+	})
+}
+
+func (s *Server) handleEthernetInterface(w http.ResponseWriter, r *http.Request, id, nicID string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	nics := s.systemInfo(id).EthernetInterfaces
+	n, err := strconv.Atoi(nicID)
+	if err != nil || n < 1 || n > len(nics) {
+		writeNotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, ethernetInterfaceResource(id, n, nics[n-1]))
+}
+
+// ethernetInterfaceResource renders the n-th (1-based) NIC of a system.
+func ethernetInterfaceResource(id string, n int, nic EthernetInterface) map[string]any {
+	name := nic.Name
+	if name == "" {
+		name = "Ethernet Interface " + strconv.Itoa(n)
+	}
+	return map[string]any{
+		"@odata.type":         "#EthernetInterface.v1_4_0.EthernetInterface",
+		"@odata.id":           "/redfish/v1/Systems/" + id + "/EthernetInterfaces/" + strconv.Itoa(n),
+		"Id":                  strconv.Itoa(n),
+		"Name":                name,
+		"MACAddress":          nic.MACAddress,
+		"PermanentMACAddress": nic.MACAddress,
+		"InterfaceEnabled":    true,
+		"Status": map[string]string{
+			"State":  "Enabled",
+			"Health": "OK",
+		},
+	}
+}
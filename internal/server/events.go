@@ -0,0 +1,265 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultSSEMaxConnections is how many SSE streams may be open at once by
+// default.
+const DefaultSSEMaxConnections = 16
+
+const (
+	// sseKeepalive is how often an idle stream gets a comment, so that
+	// proxies and clients do not time it out.
+	sseKeepalive = 30 * time.Second
+	// sseWriteTimeout bounds each write to a stream; the server's
+	// WriteTimeout would otherwise end it.
+	sseWriteTimeout = 10 * time.Second
+	// sseBuffer is how many events a stream may lag behind before it is
+	// closed; the client then resumes with Last-Event-ID.
+	sseBuffer = 64
+	// sseRetryAfter is the Retry-After (seconds) when too many streams
+	// are open.
+	sseRetryAfter = 30
+	// testEventMessageID is the default MessageId of test events.
+	testEventMessageID = "BmcShim.1.0.TestEvent"
+)
+
+// eventHub passes recorded events to the open SSE streams.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan logEntry]struct{}
+}
+
+func (h *eventHub) subscribe() chan logEntry {
+	ch := make(chan logEntry, sseBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = map[chan logEntry]struct{}{}
+	}
+	h.subs[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan logEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publish never blocks: a subscriber that has fallen behind is dropped,
+// which closes its channel.
+func (h *eventHub) publish(e logEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// eventsSince returns the logged events after seq of every system, oldest
+// first.
+func (s *Server) eventsSince(seq uint64) []logEntry {
+	var out []logEntry
+	for _, l := range s.systems.Load().logs {
+		for _, e := range l.list() {
+			if e.Seq > seq {
+				out = append(out, e)
+			}
+		}
+	}
+	slices.SortFunc(out, func(a, b logEntry) int { return cmp.Compare(a.Seq, b.Seq) })
+	return out
+}
+
+func (s *Server) handleEventService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":        "#EventService.v1_3_0.EventService",
+		"@odata.id":          "/redfish/v1/EventService",
+		"Id":                 "EventService",
+		"Name":               "Event Service",
+		"ServiceEnabled":     true,
+		"ServerSentEventUri": "/redfish/v1/EventService/SSE",
+		"Status":             map[string]string{"State": "Enabled", "Health": "OK"},
+		"Actions": map[string]any{
+			"#EventService.SubmitTestEvent": map[string]string{
+				"target": "/redfish/v1/EventService/Actions/EventService.SubmitTestEvent",
+			},
+		},
+	})
+}
+
+// handleSubmitTestEvent sends a test event to the SSE streams and the
+// notification webhooks, so that their receivers can be checked. It fails
+// if a webhook does not accept it.
+func (s *Server) handleSubmitTestEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	const action = "EventService.SubmitTestEvent"
+	var body struct {
+		MessageId       string
+		Message         string
+		MessageSeverity string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return
+	}
+	e := logEntry{
+		Seq:       s.logSeq.Add(1),
+		Created:   time.Now().UTC(),
+		Severity:  cmp.Or(body.MessageSeverity, severityOK),
+		Message:   cmp.Or(body.Message, "Test event submitted by "+initiator(r)),
+		MessageID: cmp.Or(body.MessageId, testEventMessageID),
+	}
+	switch e.Severity {
+	case severityOK, severityWarning, severityCritical:
+	default:
+		writeError(w, http.StatusBadRequest, msgActionParameterValueFormatError(e.Severity, "MessageSeverity", action))
+		return
+	}
+	s.events.publish(e)
+	log.Printf("event: test event submitted by %s", initiator(r))
+	if err := s.notify.test(r.Context(), initiator(r)); err != nil {
+		log.Printf("notify: test event: %v", err)
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSSE streams the events of the systems the client may see, as
+// they are recorded in the event logs. A client reconnecting with
+// Last-Event-ID first gets the events it missed that are still logged.
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	if n := s.sseConns.Add(1); n > int64(s.cfg.SSEMaxConnections) {
+		s.sseConns.Add(-1)
+		w.Header().Set("Retry-After", strconv.Itoa(sseRetryAfter))
+		writeError(w, http.StatusServiceUnavailable, msgServiceTemporarilyUnavailable(strconv.Itoa(sseRetryAfter)))
+		return
+	}
+	defer s.sseConns.Add(-1)
+
+	// Subscribe before replaying so that nothing recorded in between is
+	// lost; events are sent in order and at most once.
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	h := w.Header()
+	setRedfishHeaders(h)
+	h.Set("Content-Type", "text/event-stream")
+	// Keep reverse proxies such as nginx from buffering the stream.
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	var sent uint64
+	send := func(e logEntry) error {
+		// Test events concern no system and reach every stream.
+		if e.Seq <= sent || (e.SystemID != "" && !inScope(r, e.SystemID)) {
+			return nil
+		}
+		sent = e.Seq
+		b, err := json.Marshal(sseEvent(e))
+		if err != nil {
+			return err
+		}
+		b = prefixLinks(w, b)
+		return write("id: %d\ndata: %s\n\n", e.Seq, b)
+	}
+
+	if err := write(": stream start\n\n"); err != nil {
+		return
+	}
+	if last, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		for _, e := range s.eventsSince(last) {
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.bgCtx.Done():
+			// Shutting down; the client reconnects elsewhere or later.
+			return
+		case <-keepalive.C:
+			if err := write(": keepalive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				log.Printf("SSE stream of %s closed: client too slow", initiator(r))
+				return
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sseEvent renders a logged event as a Redfish Event.
+func sseEvent(e logEntry) map[string]any {
+	n := strconv.FormatUint(e.Seq, 10)
+	rec := map[string]any{
+		"MemberId":        "0",
+		"EventId":         n,
+		"EventTimestamp":  e.Created.Format(time.RFC3339),
+		"MessageId":       cmp.Or(e.MessageID, "ResourceEvent.1.0.ResourceChanged"),
+		"MessageSeverity": e.Severity,
+		"Message":         e.Message,
+	}
+	if e.SystemID != "" {
+		rec["OriginOfCondition"] = map[string]string{"@odata.id": "/redfish/v1/Systems/" + e.SystemID}
+	}
+	if e.Origin != "" {
+		rec["Oem"] = map[string]any{"BmcShim": map[string]any{"Origin": e.Origin}}
+	}
+	return map[string]any{
+		"@odata.type": "#Event.v1_4_0.Event",
+		"Id":          n,
+		"Name":        "Event",
+		"Events":      []map[string]any{rec},
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// fanOutWorkers bounds the number of backend calls one request or poll
+// makes concurrently, and thereby the burst of upstream requests.
+const fanOutWorkers = 8
+
+// fanOutTimeout bounds each call of a fan-out serving a request, so that
+// an unreachable device delays the response by at most this much.
+var fanOutTimeout = 10 * time.Second
+
+// fanOut calls fn for every id on at most fanOutWorkers goroutines, each
+// call with its own timeout derived from ctx, and returns the results and
+// errors in the order of ids. A call that overruns its timeout is
+// abandoned: its slot is freed, its result dropped and its error is the
+// context's. Once ctx is done, calls not yet started fail with ctx's error,
+// so fanOut returns within roughly timeout of ctx being cancelled.
+func fanOut[T any](ctx context.Context, ids []string, timeout time.Duration, fn func(ctx context.Context, id string) (T, error)) ([]T, []error) {
+	type result struct {
+		i   int
+		v   T
+		err error
+	}
+	vals := make([]T, len(ids))
+	errs := make([]error, len(ids))
+	results := make(chan result, len(ids))
+	sem := make(chan struct{}, fanOutWorkers)
+	go func() {
+		for i, id := range ids {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results <- result{i: i, err: ctx.Err()}
+				continue
+			}
+			go func() {
+				cctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				done := make(chan result, 1)
+				go func() {
+					v, err := fn(cctx, id)
+					done <- result{i: i, v: v, err: err}
+				}()
+				var r result
+				select {
+				case r = <-done:
+				case <-cctx.Done():
+					r = result{i: i, err: cctx.Err()}
+				}
+				<-sem
+				results <- r
+			}()
+		}
+	}()
+	for range ids {
+		r := <-results
+		vals[r.i], errs[r.i] = r.v, r.err
+	}
+	return vals, errs
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+func fanOutIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i + 1)
+	}
+	return ids
+}
+
+func TestFanOutBoundsConcurrency(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	ids := fanOutIDs(2 * fanOutWorkers)
+	var running, peak atomic.Int32
+	start := time.Now()
+	vals, errs := fanOut(context.Background(), ids, time.Second, func(ctx context.Context, id string) (string, error) {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(delay)
+		running.Add(-1)
+		return id, nil
+	})
+	elapsed := time.Since(start)
+	for i, id := range ids {
+		if vals[i] != id || errs[i] != nil {
+			t.Errorf("result %d = %q, %v, want %q in the order of the ids", i, vals[i], errs[i], id)
+		}
+	}
+	if p := peak.Load(); p > fanOutWorkers {
+		t.Errorf("%d calls ran concurrently, want at most %d", p, fanOutWorkers)
+	}
+	// Two rounds of fanOutWorkers calls each, not one call after another.
+	if elapsed < 2*delay || elapsed > 6*delay {
+		t.Errorf("took %s, want about %s", elapsed, 2*delay)
+	}
+}
+
+func TestFanOutAbandonsHungCalls(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	hung := make(chan struct{})
+	defer close(hung)
+	start := time.Now()
+	_, errs := fanOut(context.Background(), fanOutIDs(3), timeout, func(ctx context.Context, id string) (struct{}, error) {
+		if id == "2" {
+			// A device that ignores the context.
+			<-hung
+		}
+		return struct{}{}, nil
+	})
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Errorf("took %s with a hung call, want about the timeout of %s", elapsed, timeout)
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("errs = %v, want the other calls to succeed", errs)
+	}
+	if !errors.Is(errs[1], context.DeadlineExceeded) {
+		t.Errorf("hung call err = %v, want context.DeadlineExceeded", errs[1])
+	}
+}
+
+func TestFanOutCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var calls atomic.Int32
+	start := time.Now()
+	_, errs := fanOut(ctx, fanOutIDs(3*fanOutWorkers), time.Hour, func(ctx context.Context, id string) (struct{}, error) {
+		calls.Add(1)
+		<-ctx.Done()
+		return struct{}{}, ctx.Err()
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s after cancellation", elapsed)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err %d = %v, want context.Canceled", i, err)
+		}
+	}
+	if n := calls.Load(); n > fanOutWorkers {
+		t.Errorf("%d calls started after cancellation, want at most %d", n, fanOutWorkers)
+	}
+}
+
+// slowSystem is a System whose State and Ping take delay, or until their
+// context is done, like a device behind a slow or dead link.
+type slowSystem struct {
+	delay time.Duration
+}
+
+func (s slowSystem) Capabilities() backend.Capability {
+	return backend.Capability{Resets: []backend.ResetCapability{{Type: backend.ResetOn}}, PowerState: true, Health: s}
+}
+
+func (s slowSystem) Reset(ctx context.Context, t backend.ResetType) error { return nil }
+
+func (s slowSystem) State(ctx context.Context) (backend.PowerState, error) {
+	if err := s.Ping(ctx); err != nil {
+		return "", err
+	}
+	return backend.PowerStateOn, nil
+}
+
+func (s slowSystem) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TestFanOutEndpointsWithSlowBackends checks that the endpoints querying
+// every backend answer within about one fan-out timeout when backends are
+// slow or dead, with partial results, rather than after the sum of the
+// delays.
+func TestFanOutEndpointsWithSlowBackends(t *testing.T) {
+	defer func(d time.Duration) { fanOutTimeout = d }(fanOutTimeout)
+	fanOutTimeout = 200 * time.Millisecond
+
+	systems := map[string]backend.System{"dead": slowSystem{delay: time.Hour}}
+	for i := range 2 * fanOutWorkers {
+		systems[fmt.Sprint("slow", i)] = slowSystem{delay: 100 * time.Millisecond}
+	}
+	h := New(Config{Systems: systems, CacheTTL: -1}).Handler()
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		// Two rounds of slow calls run within the timeout of the dead
+		// one; one after another they would take 1.6s.
+		if elapsed := time.Since(start); elapsed > fanOutTimeout+500*time.Millisecond {
+			t.Errorf("took %s, want at most about the fan-out timeout of %s", elapsed, fanOutTimeout)
+		}
+		return rec
+	}
+
+	t.Run("expand", func(t *testing.T) {
+		rec := get(t, "/redfish/v1/Systems?$expand=.")
+		var collection struct {
+			Members []map[string]any
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &collection); err != nil {
+			t.Fatalf("status %d, body %s: %v", rec.Code, rec.Body, err)
+		}
+		if len(collection.Members) != len(systems) {
+			t.Fatalf("%d members, want %d", len(collection.Members), len(systems))
+		}
+		for _, m := range collection.Members {
+			_, annotated := m["PowerState@Message.ExtendedInfo"]
+			if m["Id"] == "dead" {
+				if !annotated {
+					t.Errorf("dead system rendered without an error annotation: %v", m)
+				}
+			} else if m["PowerState"] != "On" || annotated {
+				t.Errorf("slow system %v rendered as %v, annotated %v", m["Id"], m["PowerState"], annotated)
+			}
+		}
+	})
+
+	t.Run("readyz", func(t *testing.T) {
+		body := get(t, "/readyz?verbose").Body.String()
+		for _, want := range []string{"[+]system slow0 ok", "[+]system slow15 ok", "[-]system dead failed"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("response lacks %q: %s", want, body)
+			}
+		}
+	})
+}
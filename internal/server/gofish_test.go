@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/schemas"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// TestGofish drives the service with gofish, the Redfish client library
+// most Go tooling (e.g. Metal3 and Cluster API providers) is built on.
+// Known incompatibilities are skipped with the reason, so they show up in
+// verbose test output rather than go unnoticed.
+func TestGofish(t *testing.T) {
+	s := New(Config{
+		Username: "admin",
+		Password: "secret",
+		Systems:  map[string]backend.System{"1": backend.NewNoop(), "2": backend.NewNoop()},
+	})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	t.Run("session", func(t *testing.T) {
+		c, err := gofish.Connect(gofish.ClientConfig{Endpoint: ts.URL, Username: "admin", Password: "secret"})
+		if err != nil {
+			t.Skipf("known incompatibility: gofish logs in through the SessionService, which the shim does not implement (basic auth only): %v", err)
+		}
+		c.Logout()
+	})
+
+	t.Run("basic", func(t *testing.T) {
+		c, err := gofish.Connect(gofish.ClientConfig{
+			Endpoint:  ts.URL,
+			Username:  "admin",
+			Password:  "secret",
+			BasicAuth: true,
+		})
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer c.Logout()
+
+		systems, err := c.Service.Systems()
+		if err != nil {
+			t.Fatalf("list systems: %v", err)
+		}
+		var ids []string
+		for _, sys := range systems {
+			ids = append(ids, sys.ID)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, []string{"1", "2"}) {
+			t.Fatalf("systems = %v, want [1 2]", ids)
+		}
+		sys := systems[slices.IndexFunc(systems, func(s *schemas.ComputerSystem) bool { return s.ID == "1" })]
+
+		types, err := sys.GetSupportedResetTypes()
+		if err != nil {
+			t.Fatalf("supported reset types: %v", err)
+		}
+		for _, want := range []schemas.ResetType{schemas.OnResetType, schemas.ForceOffResetType, schemas.ForceRestartResetType} {
+			if !slices.Contains(types, want) {
+				t.Errorf("supported reset types %v lack %s", types, want)
+			}
+		}
+
+		for _, step := range []struct {
+			reset schemas.ResetType
+			want  schemas.PowerState
+		}{
+			{schemas.ForceOffResetType, schemas.OffPowerState},
+			{schemas.OnResetType, schemas.OnPowerState},
+		} {
+			if _, err := sys.Reset(step.reset); err != nil {
+				t.Fatalf("reset %s: %v", step.reset, err)
+			}
+			got, err := schemas.GetObject[schemas.ComputerSystem](c, sys.ODataID)
+			if err != nil {
+				t.Fatalf("get system: %v", err)
+			}
+			if got.PowerState != step.want {
+				t.Errorf("power state after %s = %s, want %s", step.reset, got.PowerState, step.want)
+			}
+		}
+
+		managers, err := c.Service.Managers()
+		if err != nil {
+			t.Fatalf("list managers: %v", err)
+		}
+		if len(managers) == 0 {
+			t.Error("no managers")
+		}
+		chassis, err := c.Service.Chassis()
+		if err != nil {
+			t.Fatalf("list chassis: %v", err)
+		}
+		if len(chassis) == 0 {
+			t.Error("no chassis")
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenUUID is the ServiceUUID of the golden servers, so that the UUIDs
+// derived from it are stable.
+const goldenUUID = "3f0c5d62-8a6b-4f39-9f7e-2d1b8c4e7a10"
+
+// newGoldenServer returns a server whose responses are reproducible: two
+// noop systems, fixed credentials and UUID and no host interfaces.
+func newGoldenServer(cfg Config) *Server {
+	cfg.Username, cfg.Password = "admin", "secret"
+	cfg.ServiceUUID = goldenUUID
+	cfg.HideManagerInterfaces = true
+	cfg.Systems = map[string]backend.System{"1": backend.NewNoop(), "2": backend.NewNoop()}
+	return New(cfg)
+}
+
+// maskedKeys are the properties whose values change from run to run.
+var maskedKeys = map[string]bool{
+	"DateTime":            true,
+	"DateTimeLocalOffset": true,
+	"LastResetTime":       true,
+	"Created":             true,
+	"EventTimestamp":      true,
+	"FirmwareVersion":     true,
+	"GoVersion":           true,
+}
+
+// goldenHeaders are the response headers a transcript shows.
+var goldenHeaders = []string{"Allow", "Content-Type", "Location", "Retry-After"}
+
+// exchange is a request of a replayed client session.
+type exchange struct {
+	method string
+	path   string
+	body   string
+}
+
+// replay sends the exchanges to h as a client with the given request
+// headers and basic credentials would, and compares the transcript with
+// testdata/golden. go test -update rewrites it.
+func replay(t *testing.T, h http.Handler, header http.Header, golden string, exchanges []exchange) {
+	t.Helper()
+	var transcript bytes.Buffer
+	for _, ex := range exchanges {
+		req := httptest.NewRequest(ex.method, ex.path, strings.NewReader(ex.body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.SetBasicAuth("admin", "secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		fmt.Fprintf(&transcript, "> %s %s\n", ex.method, ex.path)
+		if ex.body != "" {
+			fmt.Fprintf(&transcript, "%s\n", normalizeJSON(t, []byte(ex.body)))
+		}
+		fmt.Fprintf(&transcript, "< %d\n", rec.Code)
+		for _, k := range goldenHeaders {
+			if v := rec.Header().Get(k); v != "" {
+				fmt.Fprintf(&transcript, "%s: %s\n", k, v)
+			}
+		}
+		if rec.Body.Len() > 0 {
+			fmt.Fprintf(&transcript, "%s\n", normalizeJSON(t, rec.Body.Bytes()))
+		}
+		transcript.WriteString("\n")
+	}
+	compareGolden(t, golden, transcript.Bytes())
+}
+
+// normalizeJSON indents a JSON body with sorted keys and masks the values
+// of maskedKeys.
+func normalizeJSON(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", b, err)
+	}
+	out, err := json.MarshalIndent(mask(v), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func mask(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if maskedKeys[k] {
+				v[k] = "<masked>"
+			} else {
+				v[k] = mask(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = mask(e)
+		}
+	}
+	return v
+}
+
+// compareGolden compares got with testdata/golden, or rewrites the file
+// with -update.
+func compareGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", golden)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := range max(len(gotLines), len(wantLines)) {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("%s differs at line %d:\n got: %s\nwant: %s\n(run go test -update if the change is intended)", path, i+1, g, w)
+		}
+	}
+}
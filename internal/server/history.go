@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const historyPath = "/admin/history"
+
+// historyEntries is the capacity of the in-memory history, used without a
+// state file.
+const historyEntries = 10000
+
+// DefaultHistoryRetention is how long the history file keeps records.
+const DefaultHistoryRetention = 90 * 24 * time.Hour
+
+// Kinds of history records.
+const (
+	historyAction     = "action"
+	historyTransition = "transition"
+)
+
+// historyRecord is a power action or a power state transition of a
+// system, for bulk export.
+type historyRecord struct {
+	Time   time.Time `json:"time"`
+	System string    `json:"system"`
+	Kind   string    `json:"kind"`
+	// ResetType and Outcome (performed, skipped, failed, refused,
+	// simulated, scheduled or dropped) describe actions.
+	ResetType string `json:"reset_type,omitempty"`
+	Outcome   string `json:"outcome,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// From and To are the power states of transitions.
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Initiator string `json:"initiator"`
+	// Origin is where a transition came from (see changeState).
+	Origin string `json:"origin,omitempty"`
+}
+
+var historyCSVHeader = []string{"time", "system", "kind", "reset_type", "outcome", "error", "from", "to", "initiator", "origin"}
+
+func (h historyRecord) csv() []string {
+	return []string{h.Time.Format(time.RFC3339Nano), h.System, h.Kind, h.ResetType, h.Outcome, h.Error, h.From, h.To, h.Initiator, h.Origin}
+}
+
+// history keeps the power history: in a ring buffer, or appended to a
+// file when one is configured.
+type history struct {
+	mu      sync.Mutex
+	ring    []historyRecord
+	next    int
+	path    string
+	file    *os.File
+	retain  time.Duration
+	written int
+}
+
+// openHistory opens the history file at path, pruning records older than
+// retain. An empty path keeps the history in memory.
+func openHistory(path string, retain time.Duration) (*history, error) {
+	h := &history{path: path, retain: retain}
+	if path == "" {
+		return h, nil
+	}
+	if err := h.prune(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *history) add(rec historyRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.path == "" {
+		if len(h.ring) < historyEntries {
+			h.ring = append(h.ring, rec)
+		} else {
+			h.ring[h.next] = rec
+			h.next = (h.next + 1) % historyEntries
+		}
+		return
+	}
+	b, err := json.Marshal(rec)
+	if err == nil {
+		_, err = h.file.Write(append(b, '\n'))
+	}
+	if err != nil {
+		log.Printf("history %s: %v", h.path, err)
+	}
+}
+
+// prune rewrites the history file without the records older than the
+// retention, and reopens it for appending.
+func (h *history) prune() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var kept bytes.Buffer
+	dropped := 0
+	if h.retain > 0 {
+		cutoff := time.Now().Add(-h.retain)
+		err := h.scan(func(rec historyRecord, line []byte) error {
+			if rec.Time.Before(cutoff) {
+				dropped++
+				return nil
+			}
+			kept.Write(line)
+			kept.WriteByte('\n')
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("history file: %w", err)
+		}
+	}
+	if dropped > 0 {
+		if h.file != nil {
+			h.file.Close()
+			h.file = nil
+		}
+		if err := writeFileAtomic(h.path, kept.Bytes(), 0o600); err != nil {
+			return fmt.Errorf("history file: %w", err)
+		}
+		log.Printf("history %s: dropped %d records older than %s", h.path, dropped, h.retain)
+	}
+	if h.file == nil {
+		f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return fmt.Errorf("history file: %w", err)
+		}
+		h.file = f
+	}
+	return nil
+}
+
+// scan calls fn with every record of the history file, oldest first.
+// Unparsable lines, e.g. one cut short by a crash, are skipped.
+func (h *history) scan(fn func(rec historyRecord, line []byte) error) error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var rec historyRecord
+		if json.Unmarshal(sc.Bytes(), &rec) != nil {
+			continue
+		}
+		if err := fn(rec, sc.Bytes()); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// each calls fn with every record, oldest first, until it fails.
+func (h *history) each(fn func(historyRecord) error) error {
+	if h.path != "" {
+		err := h.scan(func(rec historyRecord, _ []byte) error { return fn(rec) })
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	h.mu.Lock()
+	recs := append(append([]historyRecord(nil), h.ring[h.next:]...), h.ring[:h.next]...)
+	h.mu.Unlock()
+	for _, rec := range recs {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *history) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+}
+
+// historyFile returns the configured history file, or the default next to
+// the state file.
+func (s *Server) historyFile() string {
+	if s.cfg.HistoryFile == "" && s.cfg.StateFile != "" {
+		return s.cfg.StateFile + ".history"
+	}
+	return s.cfg.HistoryFile
+}
+
+// runHistoryPruning prunes the history file daily until ctx is done.
+func (s *Server) runHistoryPruning(ctx context.Context) {
+	t := time.NewTicker(24 * time.Hour)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.history.prune(); err != nil {
+				log.Printf("history: %v", err)
+			}
+		}
+	}
+}
+
+// recordAction adds a power action and its outcome to the history.
+func (s *Server) recordAction(id, resetType, by, outcome string, err error) {
+	rec := historyRecord{Time: time.Now().UTC(), System: id, Kind: historyAction, ResetType: resetType, Outcome: outcome, Initiator: by}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	s.history.add(rec)
+}
+
+// recordTransition adds a power state change to the history.
+func (s *Server) recordTransition(id string, prev, known, on bool, by, origin string) {
+	from := "Unknown"
+	if known {
+		from = powerStateString(prev)
+	}
+	s.history.add(historyRecord{Time: time.Now().UTC(), System: id, Kind: historyTransition, From: from, To: powerStateString(on), Initiator: by, Origin: origin})
+}
+
+// parseHistoryTime parses the since and until parameters: RFC 3339 times
+// or dates (midnight UTC).
+func parseHistoryTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// handleHistory exports the power history, oldest first, as JSON or CSV
+// (format=csv), optionally only that of a system and between since
+// (inclusive) and until (exclusive). The records are streamed.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	q := r.URL.Query()
+	system := q.Get("system")
+	var since, until time.Time
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &since}, {"until", &until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := parseHistoryTime(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, msgQueryParameterValueTypeError(v, p.name))
+				return
+			}
+			*p.dst = t
+		}
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	match := func(rec historyRecord) bool {
+		return (system == "" || rec.System == system) &&
+			(since.IsZero() || !rec.Time.Before(since)) &&
+			(until.IsZero() || rec.Time.Before(until))
+	}
+	var err error
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="bmc-shim-history.csv"`)
+		cw := csv.NewWriter(w)
+		_ = cw.Write(historyCSVHeader)
+		err = s.history.each(func(rec historyRecord) error {
+			if match(rec) {
+				return cw.Write(rec.csv())
+			}
+			return nil
+		})
+		cw.Flush()
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		bw := bufio.NewWriter(w)
+		_, _ = io.WriteString(bw, "[")
+		n := 0
+		err = s.history.each(func(rec historyRecord) error {
+			if !match(rec) {
+				return nil
+			}
+			if n++; n > 1 {
+				_ = bw.WriteByte(',')
+			}
+			b, _ := json.Marshal(rec)
+			_, err := bw.Write(b)
+			return err
+		})
+		_, _ = io.WriteString(bw, "]\n")
+		_ = bw.Flush()
+	default:
+		writeError(w, http.StatusBadRequest, msgPropertyValueNotInList(format, "format"))
+		return
+	}
+	if err != nil {
+		// The status is sent; the client sees a truncated body.
+		log.Printf("history export: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyFixture returns the records of three days of node3 and node4.
+func historyFixture() []historyRecord {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 10, 0, 0, 0, time.UTC) }
+	return []historyRecord{
+		{Time: day(1), System: "node3", Kind: historyAction, ResetType: "On", Outcome: "performed", Initiator: "admin"},
+		{Time: day(1).Add(time.Minute), System: "node3", Kind: historyTransition, From: "Off", To: "On", Initiator: "admin", Origin: "action"},
+		{Time: day(2), System: "node4", Kind: historyAction, ResetType: "ForceOff", Outcome: "failed", Error: "timeout", Initiator: "ops"},
+		{Time: day(3), System: "node3", Kind: historyAction, ResetType: "ForceOff", Outcome: "skipped", Initiator: "admin"},
+	}
+}
+
+// historyServer returns a server whose history holds historyFixture, kept
+// in memory or, with file, in a history file.
+func historyServer(t *testing.T, file bool) http.Handler {
+	t.Helper()
+	s := New(Config{})
+	if file {
+		h, err := openHistory(filepath.Join(t.TempDir(), "history"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(h.close)
+		s.history = h
+	}
+	for _, rec := range historyFixture() {
+		s.history.add(rec)
+	}
+	return s.Handler()
+}
+
+func TestHistoryFilter(t *testing.T) {
+	all := historyFixture()
+	tests := []struct {
+		query string
+		want  []historyRecord
+	}{
+		{"", all},
+		{"system=node3", []historyRecord{all[0], all[1], all[3]}},
+		{"since=2024-01-02", all[2:]},
+		{"until=2024-01-02", all[:2]},
+		{"since=2024-01-01T10:00:30Z&until=2024-01-03T10:00:00Z", all[1:3]},
+		{"system=node3&since=2024-01-02", all[3:]},
+		{"system=node5", []historyRecord{}},
+	}
+	for _, file := range []bool{false, true} {
+		h := historyServer(t, file)
+		for _, tt := range tests {
+			rec := request(h, http.MethodGet, historyPath+"?"+tt.query, "")
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("file=%v %q = %d %s: %s", file, tt.query, rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+			}
+			var got []historyRecord
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("file=%v %q: %v: %s", file, tt.query, err, rec.Body)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("file=%v %q = %+v, want %+v", file, tt.query, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHistoryCSV(t *testing.T) {
+	for _, file := range []bool{false, true} {
+		rec := request(historyServer(t, file), http.MethodGet, historyPath+"?format=csv&system=node4", "")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("file=%v: %d %s", file, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := [][]string{
+			historyCSVHeader,
+			{"2024-01-02T10:00:00Z", "node4", "action", "ForceOff", "failed", "timeout", "", "", "ops", ""},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("file=%v: rows = %q, want %q", file, rows, want)
+		}
+	}
+}
+
+func TestHistoryBadQuery(t *testing.T) {
+	h := historyServer(t, false)
+	for _, query := range []string{"since=yesterday", "until=2024-13-01", "format=xml"} {
+		if rec := request(h, http.MethodGet, historyPath+"?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestHistoryRequiresAuth(t *testing.T) {
+	h := New(Config{Username: "admin", Password: "secret"}).Handler()
+	if rec := request(h, http.MethodGet, historyPath, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated export = %d, want 401", rec.Code)
+	}
+}
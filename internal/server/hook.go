@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// PostPowerOnHook is a secondary action run after a reset powered a system
+// on, e.g. a Wake-on-LAN packet for a machine behind a smart plug that
+// stays off when its power returns.
+type PostPowerOnHook struct {
+	// Name describes the action in logs and events.
+	Name string
+	Run  func(ctx context.Context) error
+	// Delay is waited before the first attempt and between attempts.
+	Delay time.Duration
+	// Retries is how many times a failed attempt is repeated.
+	Retries int
+	// Strict fails the Reset when the hook fails. Otherwise the hook runs
+	// in the background and its failure is only logged and recorded.
+	Strict bool
+}
+
+// budget bounds a run of the hook: every attempt with its delay.
+func (h *PostPowerOnHook) budget(attemptTimeout time.Duration) time.Duration {
+	n := time.Duration(h.Retries + 1)
+	return n * (h.Delay + attemptTimeout)
+}
+
+// hookTimeout is the longest run of the strict post-power-on hooks, which
+// a reset waits for.
+func (s *Server) hookTimeout() time.Duration {
+	var d time.Duration
+	for _, info := range s.systems.Load().info {
+		if h := info.PostPowerOn; h != nil && h.Strict {
+			d = max(d, h.budget(s.cfg.BackendTimeout))
+		}
+	}
+	return d
+}
+
+// afterPowerOn runs the post-power-on hook of a system, if it has one. Only
+// the failure of a strict hook is returned.
+func (s *Server) afterPowerOn(ctx context.Context, id, by string) error {
+	h := s.systemInfo(id).PostPowerOn
+	if h == nil {
+		return nil
+	}
+	if h.Strict {
+		return s.runPostPowerOn(ctx, id, h, by)
+	}
+	s.bg.Go(func() { _ = s.runPostPowerOn(s.bgCtx, id, h, by) })
+	return nil
+}
+
+// runPostPowerOn attempts the hook until it succeeds or its retries are
+// used up, and records the outcome in the event log.
+func (s *Server) runPostPowerOn(ctx context.Context, id string, h *PostPowerOnHook, by string) error {
+	what := fmt.Sprintf("Post-power-on %s after power-on by %s", h.Name, by)
+	var err error
+	for attempt := 1; attempt <= h.Retries+1; attempt++ {
+		t := time.NewTimer(h.Delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			err = ctx.Err()
+			s.recordEvent(id, severityWarning, fmt.Sprintf("%s failed: %v", what, err))
+			return fmt.Errorf("post-power-on %s: %w", h.Name, err)
+		}
+		actx, cancel := context.WithTimeout(ctx, s.cfg.BackendTimeout)
+		err = h.Run(actx)
+		cancel()
+		if err == nil {
+			s.recordEvent(id, severityOK, fmt.Sprintf("%s succeeded (attempt %d)", what, attempt))
+			return nil
+		}
+		log.Printf("system %s: post-power-on %s: attempt %d of %d: %v", id, h.Name, attempt, h.Retries+1, err)
+	}
+	s.recordEvent(id, severityWarning, fmt.Sprintf("%s failed after %d attempts: %v", what, h.Retries+1, err))
+	return fmt.Errorf("post-power-on %s: %w", h.Name, err)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Stability is the hysteresis of the power state a backend reports: a
+// change is only served once it was reported by Polls consecutive
+// observations, or for Duration. The zero value serves changes at once.
+type Stability struct {
+	Polls    int
+	Duration time.Duration
+}
+
+// ParseStability parses a number of observations ("3") or a duration
+// ("30s"). Empty and "0" disable the hysteresis.
+func ParseStability(v string) (Stability, error) {
+	if v == "" {
+		return Stability{}, nil
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 {
+			return Stability{}, fmt.Errorf("invalid state stability %q (expected a number of polls or a duration)", v)
+		}
+		return Stability{Polls: n}, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return Stability{}, fmt.Errorf("invalid state stability %q (expected a number of polls or a duration)", v)
+	}
+	return Stability{Duration: d}, nil
+}
+
+func (st Stability) enabled() bool { return st.Polls > 1 || st.Duration > 0 }
+
+// A system whose backend reported flapWindowChanges state changes within
+// flapWindow is flapping.
+const (
+	flapWindow        = 10 * time.Minute
+	flapWindowChanges = 4
+)
+
+// hysteresis is the state of a system's power state hysteresis.
+type hysteresis struct {
+	// raw is the state the backend reported last.
+	raw, rawKnown bool
+	// pending is a reported change not served yet, first reported at
+	// since and then polls times in a row.
+	pending, hasPending bool
+	since               time.Time
+	polls               int
+	// changes are the times raw changed within flapWindow.
+	changes  []time.Time
+	flapping bool
+}
+
+// stability returns the hysteresis of a system: its own or Config's.
+func (s *Server) stability(id string) Stability {
+	if st := s.systemInfo(id).StateStability; st.enabled() {
+		return st
+	}
+	return s.cfg.StateStability
+}
+
+// stableState applies the hysteresis of a system to a reported state and
+// reports whether it may be served.
+func (s *Server) stableState(id string, on bool, st Stability) bool {
+	now := time.Now()
+	s.mu.Lock()
+	h := s.hysteresis[id]
+	if h == nil {
+		h = &hysteresis{}
+		s.hysteresis[id] = h
+	}
+	if h.rawKnown && h.raw != on {
+		h.changes = append(h.changes, now)
+	}
+	h.raw, h.rawKnown = on, true
+	for len(h.changes) > 0 && now.Sub(h.changes[0]) > flapWindow {
+		h.changes = h.changes[1:]
+	}
+	wasFlapping := h.flapping
+	h.flapping = len(h.changes) >= flapWindowChanges
+	flapping := h.flapping
+	changes := len(h.changes)
+	served, known := s.last[id]
+	stable := true
+	if known && served != on {
+		if !h.hasPending || h.pending != on {
+			h.pending, h.hasPending, h.since, h.polls = on, true, now, 0
+		}
+		h.polls++
+		stable = (st.Polls > 0 && h.polls >= st.Polls) || (st.Duration > 0 && now.Sub(h.since) >= st.Duration)
+	}
+	if stable {
+		h.hasPending = false
+	}
+	s.mu.Unlock()
+
+	switch {
+	case flapping == wasFlapping:
+	case flapping:
+		s.recordEvent(id, severityWarning, fmt.Sprintf("Power state flapping: %d changes reported within %s", changes, flapWindow))
+	default:
+		log.Printf("system %s: power state no longer flapping", id)
+		s.recordEvent(id, severityOK, "Power state stable again")
+	}
+	return stable
+}
+
+// trustState records a power state set through the API, which bypasses
+// the hysteresis.
+func (s *Server) trustState(id string, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h := s.hysteresis[id]; h != nil {
+		h.raw, h.rawKnown, h.hasPending = on, true, false
+	}
+}
+
+// flapStatus reports whether a system with hysteresis is flapping and the
+// state reported but not served yet, if any.
+func (s *Server) flapStatus(id string) (flapping bool, pending string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h := s.hysteresis[id]
+	if h == nil {
+		return false, ""
+	}
+	if h.hasPending {
+		pending = powerStateString(h.pending)
+	}
+	return h.flapping, pending
+}
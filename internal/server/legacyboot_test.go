@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// bootTarget returns the BootSourceOverrideTarget of system 1.
+func bootTarget(t *testing.T, h http.Handler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/redfish/v1/Systems/1", nil))
+	var sys struct {
+		Boot struct{ BootSourceOverrideTarget string }
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &sys); err != nil {
+		t.Fatal(err)
+	}
+	return sys.Boot.BootSourceOverrideTarget
+}
+
+func TestLegacyBootPOST(t *testing.T) {
+	const pxe = `{"Boot": {"BootSourceOverrideTarget": "Pxe", "BootSourceOverrideEnabled": "Once"}}`
+	tests := []struct {
+		name       string
+		enabled    bool
+		method     string
+		body       string
+		wantCode   int
+		wantAllow  string
+		wantBody   []string
+		wantTarget string
+		// wantWarning is set when the POST is carried out as a PATCH.
+		wantWarning bool
+	}{
+		{"disabled", false, http.MethodPost, pxe, http.StatusMethodNotAllowed, "GET, PATCH", nil, "None", false},
+		{"disabled, other method", false, http.MethodDelete, "", http.StatusMethodNotAllowed, "GET, PATCH", nil, "None", false},
+		{"enabled", true, http.MethodPost, pxe, http.StatusOK, "", nil, "Pxe", true},
+		{"enabled, other method", true, http.MethodDelete, "", http.StatusMethodNotAllowed, "GET, PATCH, POST", nil, "None", false},
+		{"mixed with another property", true, http.MethodPost, `{"Boot": {"BootSourceOverrideTarget": "Pxe"}, "AssetTag": "rack 1"}`, http.StatusBadRequest, "", []string{"PropertyUnknown", "AssetTag"}, "None", false},
+		{"mixed with an unknown property", true, http.MethodPost, `{"Boot": {"BootSourceOverrideTarget": "Pxe"}, "Bogus": 1}`, http.StatusBadRequest, "", []string{"PropertyUnknown", "Bogus"}, "None", false},
+		{"without Boot", true, http.MethodPost, `{"AssetTag": "rack 1"}`, http.StatusBadRequest, "", []string{"PropertyMissing", "PropertyUnknown"}, "None", false},
+		{"empty object", true, http.MethodPost, `{}`, http.StatusBadRequest, "", []string{"PropertyMissing"}, "None", false},
+		{"malformed", true, http.MethodPost, `{"Boot":`, http.StatusBadRequest, "", []string{"MalformedJSON"}, "None", false},
+		{"invalid Boot", true, http.MethodPost, `{"Boot": {"BootSourceOverrideTarget": "Floppy"}}`, http.StatusBadRequest, "", []string{"PropertyValueNotInList"}, "None", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(Config{
+				Systems:        map[string]backend.System{"1": backend.NewNoop()},
+				LegacyBootPOST: tt.enabled,
+			}).Handler()
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			defer log.SetOutput(os.Stderr)
+
+			req := httptest.NewRequest(tt.method, "/redfish/v1/Systems/1", strings.NewReader(tt.body))
+			req.Header.Set("User-Agent", "fence_legacy/1.0")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("response lacks %s: %s", want, rec.Body)
+				}
+			}
+			deprecated := strings.Contains(logged.String(), `deprecated`) && strings.Contains(logged.String(), `"fence_legacy/1.0"`)
+			if deprecated != tt.wantWarning {
+				t.Errorf("deprecation warning with the User-Agent logged = %v, want %v: %s", deprecated, tt.wantWarning, logged.String())
+			}
+			if got := bootTarget(t, h); got != tt.wantTarget {
+				t.Errorf("BootSourceOverrideTarget = %s, want %s", got, tt.wantTarget)
+			}
+		})
+	}
+}
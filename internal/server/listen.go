@@ -0,0 +1,293 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/acme"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/discovery"
+)
+
+// listenSpec is one parsed --listen value.
+type listenSpec struct {
+	scheme string
+	addr   string
+}
+
+// newAdvertiser prepares SSDP/mDNS advertisement of the first https
+// listener, or the first listener if there is none.
+func (s *Server) newAdvertiser(specs []listenSpec, listeners []net.Listener) (*discovery.Advertiser, error) {
+	pick := 0
+	for i, spec := range specs {
+		if spec.scheme == "https" {
+			pick = i
+			break
+		}
+	}
+	port := listeners[pick].Addr().(*net.TCPAddr).Port
+	cfg := discovery.Config{
+		Interfaces: s.cfg.AdvertiseInterfaces,
+		Scheme:     specs[pick].scheme,
+		Port:       port,
+		UUID:       s.cfg.ServiceUUID,
+		Location:   s.advertisedLocation(),
+	}
+	return discovery.New(cfg)
+}
+
+// advertisedLocation returns the service root URL announced for
+// Config.ExternalURL, or "" to announce the listener's address.
+func (s *Server) advertisedLocation() string {
+	if s.cfg.ExternalURL == "" {
+		return ""
+	}
+	// An external URL without a path is that of the proxy adding the URL
+	// prefix.
+	base := s.cfg.ExternalURL
+	if u, err := url.Parse(base); err == nil && u.Path == "" {
+		base += s.cfg.URLPrefix
+	}
+	return base + "/redfish/v1/"
+}
+
+// ParseExternalURL validates an external base URL such as
+// "https://bmc.example.com" or "http://[2001:db8::10]:8080" and returns
+// it without a trailing slash.
+func ParseExternalURL(v string) (string, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", fmt.Errorf("external URL %q: %w", v, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("external URL %q: expected http(s)://host[:port][/path]", v)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// sameAddr reports whether two listen addresses would bind the same port
+// on overlapping interfaces.
+func sameAddr(a, b string) bool {
+	ha, pa, errA := net.SplitHostPort(a)
+	hb, pb, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || pa != pb {
+		return false
+	}
+	return ha == hb || ha == "" || hb == "" || ha == "0.0.0.0" || hb == "0.0.0.0" || ha == "::" || hb == "::"
+}
+
+func (l listenSpec) String() string { return l.scheme + "://" + l.addr }
+
+// parseListen parses "http://:8080", "https://:8443" or a bare address,
+// which means plain HTTP.
+func parseListen(v string) (listenSpec, error) {
+	scheme, addr, ok := strings.Cut(v, "://")
+	if !ok {
+		scheme, addr = "http", v
+	}
+	scheme = strings.ToLower(scheme)
+	if scheme != "http" && scheme != "https" {
+		return listenSpec{}, fmt.Errorf("listen %q: unsupported scheme %q (expected http or https)", v, scheme)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return listenSpec{}, fmt.Errorf("listen %q: %w", v, err)
+	}
+	return listenSpec{scheme: scheme, addr: addr}, nil
+}
+
+// Start binds every configured listener and serves in the background until
+// Shutdown. Configuration and bind errors are returned synchronously, in
+// which case nothing is served. Otherwise the returned channel receives
+// nil once Shutdown has closed the listeners, or the error of a listener
+// that failed while serving (which stops the others).
+func (s *Server) Start() (<-chan error, error) {
+	// Shutdown waits for the setup, so it never races with starting the
+	// listeners or the background work.
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	if s.shutDown {
+		return nil, http.ErrServerClosed
+	}
+	specs := make([]listenSpec, 0, len(s.cfg.Listen))
+	needTLS := false
+	for _, v := range s.cfg.Listen {
+		spec, err := parseListen(v)
+		if err != nil {
+			return nil, err
+		}
+		needTLS = needTLS || spec.scheme == "https"
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("no listen address configured")
+	}
+	if err := s.setupLanguages(); err != nil {
+		return nil, err
+	}
+	if err := s.setupUI(); err != nil {
+		return nil, err
+	}
+	if s.cfg.CaptureDir != "" {
+		c, err := newCapturer(s.cfg.CaptureDir, s.cfg.CaptureMaxFiles)
+		if err != nil {
+			return nil, err
+		}
+		s.capture = c
+		log.Printf("warning: capturing requests and responses to %s (at most %d)", c.dir, c.maxFiles)
+	}
+	if path := s.historyFile(); path != "" {
+		h, err := openHistory(path, s.cfg.HistoryRetention)
+		if err != nil {
+			return nil, err
+		}
+		s.history = h
+	}
+	var acmeMgr *acme.Manager
+	switch {
+	case s.cfg.ACME != nil:
+		if !needTLS {
+			return nil, errors.New("ACME requires an https listener")
+		}
+		cfg := *s.cfg.ACME
+		if s.cfg.TLSCert != "" {
+			cert, err := tls.LoadX509KeyPair(s.cfg.TLSCert, s.cfg.TLSKey)
+			if err != nil {
+				return nil, fmt.Errorf("load fallback TLS certificate: %w", err)
+			}
+			cfg.Fallback = &cert
+		}
+		m, err := acme.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		acmeMgr = m
+		s.http.TLSConfig = m.TLSConfig()
+	case needTLS:
+		if s.cfg.TLSCert == "" || s.cfg.TLSKey == "" {
+			return nil, errors.New("https listener requires a TLS certificate and key")
+		}
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLSCert, s.cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		// Served through GetCertificate so that ReplaceCertificate takes
+		// effect without restarting the listeners.
+		s.tlsCert.Store(&cert)
+		s.http.TLSConfig = &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return s.tlsCert.Load(), nil },
+			// Listing h2 makes net/http set up HTTP/2 however the plain
+			// and TLS listeners race to start; otherwise it may be offered
+			// in ALPN without being served.
+			NextProtos: []string{"h2", "http/1.1"},
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	if s.debug != nil {
+		for _, spec := range specs {
+			if sameAddr(spec.addr, s.debug.Addr) {
+				return nil, fmt.Errorf("debug listener %s shares a main listener; use the debug-on-main option instead", s.debug.Addr)
+			}
+		}
+	}
+
+	listeners := make([]net.Listener, 0, len(specs))
+	for _, spec := range specs {
+		ln, err := net.Listen("tcp", spec.addr)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("listen %s: %w", spec, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if s.cfg.Advertise {
+		adv, err := s.newAdvertiser(specs, listeners)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("advertise: %w", err)
+		}
+		s.bg.Go(func() { adv.Run(s.bgCtx) })
+	}
+
+	var debugLn net.Listener
+	if s.debug != nil {
+		ln, err := net.Listen("tcp", s.debug.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("debug listen %s: %w", s.debug.Addr, err)
+		}
+		debugLn = ln
+		log.Printf("debug endpoints on http://%s/debug/", ln.Addr())
+		go func() {
+			if err := s.debug.Serve(debugLn); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("debug listener: %v", err)
+			}
+		}()
+	}
+
+	// Log the bound addresses rather than the configured ones, so that
+	// e.g. ":8080" on an IPv6-only host shows up as "[::]:8080".
+	addrs := make([]string, len(specs))
+	bound := make([]listenSpec, len(specs))
+	for i, spec := range specs {
+		bound[i] = listenSpec{scheme: spec.scheme, addr: listeners[i].Addr().String()}
+		addrs[i] = bound[i].String()
+	}
+	s.listening.Store(&bound)
+	log.Printf("bmc-shim %s listening on %s (systems: %v)", buildinfo.Get(), strings.Join(addrs, ", "), s.systemIDs())
+
+	if acmeMgr != nil {
+		s.bg.Go(func() { acmeMgr.Run(s.bgCtx) })
+	}
+	s.bg.Go(func() { s.warmUpSystems(s.bgCtx, s.systemIDs()) })
+	s.bg.Go(func() { s.runSchedules(s.bgCtx) })
+	if s.history.path != "" && s.cfg.HistoryRetention > 0 {
+		s.bg.Go(func() { s.runHistoryPruning(s.bgCtx) })
+	}
+	if s.cfg.PollInterval > 0 {
+		s.bg.Go(func() { s.poll(s.bgCtx, s.cfg.PollInterval) })
+	}
+	if len(s.cfg.NotifyURLs) > 0 {
+		s.bg.Go(func() { s.notify.run(s.bgCtx) })
+	}
+
+	errs := make([]error, len(listeners))
+	var wg sync.WaitGroup
+	for i, ln := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if specs[i].scheme == "https" {
+				err = s.http.ServeTLS(ln, "", "")
+			} else {
+				err = s.http.Serve(ln)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs[i] = err
+				// One failed listener takes the others down with it.
+				_ = s.http.Close()
+			}
+		}()
+	}
+	done := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		done <- errors.Join(errs...)
+	}()
+	return done, nil
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+func newListenServer(listen ...string) *Server {
+	return New(Config{
+		Listen:  listen,
+		Systems: map[string]backend.System{"1": backend.NewNoop()},
+	})
+}
+
+// freeAddr returns a loopback address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestStartConflictingListener(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	free := freeAddr(t)
+
+	s := newListenServer("http://"+free, "http://"+taken.Addr().String())
+	done, err := s.Start()
+	if err == nil {
+		_ = s.Shutdown(context.Background())
+		<-done
+		t.Fatal("Start succeeded with a listen address in use")
+	}
+	if !strings.Contains(err.Error(), taken.Addr().String()) {
+		t.Errorf("error %q does not name the address in use", err)
+	}
+	// The listener bound before the failing one must have been closed.
+	ln, err := net.Listen("tcp", free)
+	if err != nil {
+		t.Fatalf("listener on %s left open: %v", free, err)
+	}
+	_ = ln.Close()
+}
+
+func TestStartAndShutdown(t *testing.T) {
+	s := newListenServer("http://127.0.0.1:0")
+	done, err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := *s.listening.Load()
+	if len(bound) != 1 {
+		t.Fatalf("listening on %v, want one address", bound)
+	}
+	resp, err := http.Get("http://" + bound[0].addr + "/redfish/v1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /redfish/v1/ = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serving ended with %v, want nil after Shutdown", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("serving did not end after Shutdown")
+	}
+	if _, err := net.DialTimeout("tcp", bound[0].addr, time.Second); err == nil {
+		t.Errorf("%s still accepts connections after Shutdown", bound[0].addr)
+	}
+	if _, err := s.Start(); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Start after Shutdown = %v, want http.ErrServerClosed", err)
+	}
+}
+
+func TestStartIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	_ = ln.Close()
+
+	s := newListenServer("http://[::1]:0")
+	done, err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = s.Shutdown(context.Background())
+		<-done
+	}()
+	bound := *s.listening.Load()
+	host, port, err := net.SplitHostPort(bound[0].addr)
+	if err != nil || host != "::1" || !strings.HasPrefix(bound[0].addr, "[::1]:") {
+		t.Fatalf("bound address %q, want [::1]:port", bound[0].addr)
+	}
+
+	base := "http://" + bound[0].addr
+	resp, err := http.Get(base + "/redfish/v1/Managers/" + managerID + "/NetworkProtocol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		HTTP struct{ Port int }
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || strconv.Itoa(body.HTTP.Port) != port {
+		t.Errorf("NetworkProtocol = %d with HTTP port %d, want 200 with the bound port %s", resp.StatusCode, body.HTTP.Port, port)
+	}
+}
+
+func TestParseExternalURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://bmc.example.com/":      "https://bmc.example.com",
+		"http://[2001:db8::10]:8080":    "http://[2001:db8::10]:8080",
+		"https://[::1]/proxy/bmc-shim/": "https://[::1]/proxy/bmc-shim",
+	} {
+		if got, err := ParseExternalURL(in); err != nil || got != want {
+			t.Errorf("ParseExternalURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"bmc.example.com", "ftp://bmc.example.com", "http://[2001:db8::10", "https://user@bmc.example.com"} {
+		if _, err := ParseExternalURL(in); err == nil {
+			t.Errorf("ParseExternalURL(%q) succeeded", in)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language of the service's own strings; it needs
+// no catalog.
+const DefaultLanguage = "en"
+
+// catalog translates the human-readable strings of responses: Messages by
+// Base registry MessageId (with the registry's %1..%n placeholders) and
+// Strings, the Name and Description values, by their English text.
+type catalog struct {
+	Messages map[string]string `json:"messages"`
+	Strings  map[string]string `json:"strings"`
+}
+
+//go:embed locales/*.json
+var embeddedLocales embed.FS
+
+// loadCatalogs reads the <language>.json catalogs of fsys. Entries of
+// catalogs already in into override theirs.
+func loadCatalogs(fsys fs.FS, into map[string]*catalog) error {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return err
+		}
+		var c catalog
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return fmt.Errorf("language catalog %s: %w", f, err)
+		}
+		for id := range c.Messages {
+			if _, ok := baseMessages[id]; !ok {
+				return fmt.Errorf("language catalog %s: unknown message %q", f, id)
+			}
+		}
+		lang := strings.ToLower(strings.TrimSuffix(path.Base(f), ".json"))
+		if lang == DefaultLanguage {
+			return fmt.Errorf("language catalog %s: %s is built in", f, DefaultLanguage)
+		}
+		dst := into[lang]
+		if dst == nil {
+			dst = &catalog{Messages: map[string]string{}, Strings: map[string]string{}}
+			into[lang] = dst
+		}
+		maps.Copy(dst.Messages, c.Messages)
+		maps.Copy(dst.Strings, c.Strings)
+	}
+	return nil
+}
+
+// embeddedCatalogs returns the catalogs shipped with the binary.
+func embeddedCatalogs() map[string]*catalog {
+	sub, err := fs.Sub(embeddedLocales, "locales")
+	if err != nil {
+		panic(err)
+	}
+	m := map[string]*catalog{}
+	if err := loadCatalogs(sub, m); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// setupLanguages adds the catalogs of Config.LanguageDir to the embedded
+// ones and checks Config.Language.
+func (s *Server) setupLanguages() error {
+	if s.cfg.LanguageDir != "" {
+		if err := loadCatalogs(os.DirFS(s.cfg.LanguageDir), s.catalogs); err != nil {
+			return fmt.Errorf("language dir: %w", err)
+		}
+	}
+	if !slices.Contains(s.languages(), s.cfg.Language) {
+		return fmt.Errorf("language %q has no catalog (available: %s)", s.cfg.Language, strings.Join(s.languages(), ", "))
+	}
+	return nil
+}
+
+// languages lists the available languages.
+func (s *Server) languages() []string {
+	return append([]string{DefaultLanguage}, slices.Sorted(maps.Keys(s.catalogs))...)
+}
+
+// language picks the language of a response: the client's most preferred
+// available one from Accept-Language, otherwise Config.Language.
+func (s *Server) language(r *http.Request) string {
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && q > 0 {
+			prefs = append(prefs, pref{tag, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	for _, p := range prefs {
+		if p.tag == "*" {
+			break
+		}
+		primary, _, _ := strings.Cut(p.tag, "-")
+		for _, t := range []string{p.tag, primary} {
+			if _, ok := s.catalogs[t]; ok || t == DefaultLanguage {
+				return t
+			}
+		}
+	}
+	return s.cfg.Language
+}
+
+// localeWriter carries the catalog of a response to writeJSON.
+type localeWriter struct {
+	http.ResponseWriter
+	c *catalog
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (l *localeWriter) Unwrap() http.ResponseWriter {
+	return l.ResponseWriter
+}
+
+// localeMiddleware translates the responses of the handlers it wraps into
+// the language of the request.
+func (s *Server) localeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := s.language(r)
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", lang)
+		if c := s.catalogs[lang]; c != nil {
+			w = &localeWriter{ResponseWriter: w, c: c}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localize translates a rendered JSON body. Bodies it cannot parse are
+// returned as they are.
+func (c *catalog) localize(b []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return b
+	}
+	out, err := json.Marshal(c.localizeValue(v))
+	if err != nil {
+		log.Printf("locale: re-encoding response: %v", err)
+		return b
+	}
+	return out
+}
+
+func (c *catalog) localizeValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = c.localizeValue(e)
+		}
+		for _, k := range []string{"Name", "Description"} {
+			if s, ok := v[k].(string); ok && c.Strings[s] != "" {
+				v[k] = c.Strings[s]
+			}
+		}
+		if id, ok := v["MessageId"].(string); ok {
+			if text, ok := c.message(id, v["MessageArgs"]); ok {
+				v["Message"] = text
+			}
+		}
+		if e, ok := v["error"].(map[string]any); ok {
+			// The error's message repeats its only extended message or
+			// is the general error.
+			if info, ok := e["@Message.ExtendedInfo"].([]any); ok && len(info) == 1 {
+				if m, ok := info[0].(map[string]any); ok && m["Message"] != nil {
+					e["message"] = m["Message"]
+				}
+			} else if id, ok := e["code"].(string); ok {
+				if text, ok := c.message(id, nil); ok {
+					e["message"] = text
+				}
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = c.localizeValue(e)
+		}
+	}
+	return v
+}
+
+// message translates a Base registry message.
+func (c *catalog) message(id string, args any) (string, bool) {
+	name, ok := strings.CutPrefix(id, baseRegistry+".")
+	text := c.Messages[name]
+	if !ok || text == "" {
+		return "", false
+	}
+	list, _ := args.([]any)
+	for i := len(list); i > 0; i-- {
+		if a, ok := list[i-1].(string); ok {
+			text = strings.ReplaceAll(text, "%"+strconv.Itoa(i), a)
+		}
+	}
+	return text, true
+}
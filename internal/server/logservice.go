@@ -0,0 +1,218 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLogEntries is the per-system event log capacity when not configured.
+const defaultLogEntries = 100
+
+// Event log severities (Redfish Health values).
+const (
+	severityOK       = "OK"
+	severityWarning  = "Warning"
+	severityCritical = "Critical"
+)
+
+// logEntry is one record of a system's event log.
+type logEntry struct {
+	// Seq is unique and increasing across all systems.
+	Seq      uint64
+	SystemID string
+	Created  time.Time
+	Severity string
+	Message  string
+	// Origin is the origin of a power state change.
+	Origin string
+	// MessageID overrides the MessageId of the event sent to the SSE
+	// streams.
+	MessageID string
+}
+
+// eventLog is a fixed-size ring buffer of recent events for one system.
+type eventLog struct {
+	mu      sync.Mutex
+	entries []logEntry
+	size    int
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{size: size}
+}
+
+func (l *eventLog) add(e logEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) >= l.size {
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:len(l.entries)-1]
+	}
+	l.entries = append(l.entries, e)
+}
+
+// list returns a copy of the entries, oldest first.
+func (l *eventLog) list() []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]logEntry(nil), l.entries...)
+}
+
+func (l *eventLog) clear() {
+	l.mu.Lock()
+	l.entries = nil
+	l.mu.Unlock()
+}
+
+// recordEvent appends an event to a system's log and mirrors it to the
+// process log so there is an audit trail even without the LogService.
+func (s *Server) recordEvent(id, severity, msg string) {
+	s.recordEntry(logEntry{SystemID: id, Severity: severity, Message: msg})
+}
+
+// recordEntry is recordEvent for an entry with more than a message.
+func (s *Server) recordEntry(e logEntry) {
+	l := s.eventLogFor(e.SystemID)
+	if l == nil {
+		return
+	}
+	e.Seq = s.logSeq.Add(1)
+	e.Created = time.Now().UTC()
+	l.add(e)
+	s.events.publish(e)
+	if e.Origin != "" {
+		log.Printf("event: system=%s severity=%s origin=%s %s", e.SystemID, e.Severity, e.Origin, e.Message)
+		return
+	}
+	log.Printf("event: system=%s severity=%s %s", e.SystemID, e.Severity, e.Message)
+}
+
+// initiator describes who made a request, for event and audit records.
+func initiator(r *http.Request) string {
+	user := "anonymous"
+	if p, ok := requestPrincipal(r); ok {
+		user = p.Name
+	}
+	return user + "@" + clientIP(r)
+}
+
+func (s *Server) handleLogServices(w http.ResponseWriter, r *http.Request, id, sub string) {
+	base := "/redfish/v1/Systems/" + id + "/LogServices"
+	l := s.eventLogFor(id)
+	if l == nil {
+		// The system was removed since handleSystem looked it up.
+		writeNotFound(w, r)
+		return
+	}
+	switch sub {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":         "#LogServiceCollection.LogServiceCollection",
+			"@odata.id":           base,
+			"Name":                "Log Service Collection",
+			"Members":             []map[string]string{{"@odata.id": base + "/EventLog"}},
+			"Members@odata.count": 1,
+		})
+	case "EventLog":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":        "#LogService.v1_1_0.LogService",
+			"@odata.id":          base + "/EventLog",
+			"Id":                 "EventLog",
+			"Name":               "Event Log",
+			"MaxNumberOfRecords": l.size,
+			"OverWritePolicy":    "WrapsWhenFull",
+			"ServiceEnabled":     true,
+			"Entries":            map[string]string{"@odata.id": base + "/EventLog/Entries"},
+			"Actions": map[string]any{
+				"#LogService.ClearLog": map[string]string{
+					"target": base + "/EventLog/Actions/LogService.ClearLog",
+				},
+			},
+		})
+	case "EventLog/Actions/LogService.ClearLog":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.clearLog(r, id, l)
+		w.WriteHeader(http.StatusNoContent)
+	case "EventLog/Entries":
+		switch r.Method {
+		case http.MethodGet:
+			entries := l.list()
+			members := make([]map[string]any, 0, len(entries))
+			for _, e := range entries {
+				members = append(members, logEntryResource(base, e))
+			}
+			var modified time.Time
+			if len(entries) > 0 {
+				modified = entries[len(entries)-1].Created
+			}
+			writeJSONModified(w, r, modified, map[string]any{
+				"@odata.type":         "#LogEntryCollection.LogEntryCollection",
+				"@odata.id":           base + "/EventLog/Entries",
+				"Name":                "Log Entry Collection",
+				"Members":             members,
+				"Members@odata.count": len(members),
+			})
+		case http.MethodDelete:
+			s.clearLog(r, id, l)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeMethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		}
+	default:
+		entryID, ok := strings.CutPrefix(sub, "EventLog/Entries/")
+		if !ok {
+			writeNotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		for _, e := range l.list() {
+			if strconv.FormatUint(e.Seq, 10) == entryID {
+				writeJSONModified(w, r, e.Created, logEntryResource(base, e))
+				return
+			}
+		}
+		writeNotFound(w, r)
+	}
+}
+
+// clearLog clears l, the event log of system id.
+func (s *Server) clearLog(r *http.Request, id string, l *eventLog) {
+	l.clear()
+	s.recordEvent(id, severityOK, "Event log cleared by "+initiator(r))
+}
+
+func logEntryResource(base string, e logEntry) map[string]any {
+	n := strconv.FormatUint(e.Seq, 10)
+	res := map[string]any{
+		"@odata.type": "#LogEntry.v1_4_0.LogEntry",
+		"@odata.id":   base + "/EventLog/Entries/" + n,
+		"Id":          n,
+		"Name":        "Log Entry " + n,
+		"EntryType":   "Event",
+		"Severity":    e.Severity,
+		"Created":     e.Created.Format(time.RFC3339),
+		"Message":     e.Message,
+	}
+	if e.Origin != "" {
+		res["Oem"] = map[string]any{"BmcShim": map[string]any{"Origin": e.Origin}}
+	}
+	return res
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// TestLogServicesOfRemovedSystem checks that a request for the log service
+// of a system removed after handleSystem looked it up gets 404.
+func TestLogServicesOfRemovedSystem(t *testing.T) {
+	s := New(Config{Systems: map[string]backend.System{"1": backend.NewNoop(), "2": backend.NewNoop()}})
+	s.SetSystems(map[string]backend.System{"1": backend.NewNoop()}, nil)
+	for _, tt := range []struct{ method, sub string }{
+		{http.MethodGet, ""},
+		{http.MethodGet, "EventLog"},
+		{http.MethodPost, "EventLog/Actions/LogService.ClearLog"},
+		{http.MethodGet, "EventLog/Entries"},
+		{http.MethodDelete, "EventLog/Entries"},
+		{http.MethodGet, "EventLog/Entries/1"},
+	} {
+		req := httptest.NewRequest(tt.method, "/redfish/v1/Systems/2/LogServices/"+tt.sub, nil)
+		rec := httptest.NewRecorder()
+		s.handleLogServices(rec, req, "2", tt.sub)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s of a removed system = %d, want 404", tt.method, tt.sub, rec.Code)
+		}
+	}
+
+	// The remaining system's log still works, also when cleared.
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/redfish/v1/Systems/1/LogServices/EventLog/Entries", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("clear the log of a present system = %d, want 204", rec.Code)
+	}
+	if entries := s.eventLogFor("1").list(); len(entries) != 1 || entries[0].Message == "" {
+		t.Errorf("log after clearing = %+v, want the clear event", entries)
+	}
+}
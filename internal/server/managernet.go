@@ -0,0 +1,199 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/discovery"
+)
+
+// listenSpecs returns the listeners as bound or, before Start, as
+// configured.
+func (s *Server) listenSpecs() []listenSpec {
+	if bound := s.listening.Load(); bound != nil {
+		return *bound
+	}
+	var specs []listenSpec
+	for _, v := range s.cfg.Listen {
+		if spec, err := parseListen(v); err == nil {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+func (s *Server) handleNetworkProtocol(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	base := "/redfish/v1/Managers/" + managerID + "/NetworkProtocol"
+	specs := s.listenSpecs()
+	protocol := func(scheme string) map[string]any {
+		for _, spec := range specs {
+			if spec.scheme != scheme {
+				continue
+			}
+			_, port, _ := net.SplitHostPort(spec.addr)
+			n, _ := strconv.Atoi(port)
+			return map[string]any{"ProtocolEnabled": true, "Port": n}
+		}
+		return map[string]any{"ProtocolEnabled": false}
+	}
+	https := protocol("https")
+	if s.tlsCert.Load() != nil {
+		https["Certificates"] = map[string]string{"@odata.id": base + "/HTTPS/Certificates"}
+	}
+	ssdp := map[string]any{"ProtocolEnabled": s.cfg.Advertise}
+	if s.cfg.Advertise {
+		ssdp["Port"] = discovery.SSDPPort
+		ssdp["NotifyMulticastIntervalSeconds"] = discovery.SSDPNotifyInterval
+	}
+	host, _ := os.Hostname()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type": "#ManagerNetworkProtocol.v1_4_0.ManagerNetworkProtocol",
+		"@odata.id":   base,
+		"Id":          "NetworkProtocol",
+		"Name":        "Manager Network Protocol",
+		"HostName":    host,
+		"HTTP":        protocol("http"),
+		"HTTPS":       https,
+		"SSDP":        ssdp,
+		"Status":      map[string]string{"State": "Enabled", "Health": "OK"},
+	})
+}
+
+// hostInterface is a network interface of the host and its addresses.
+type hostInterface struct {
+	net.Interface
+	addrs []net.Addr
+}
+
+// hostInterfaces lists the network interfaces of the host; see
+// Server.interfaces.
+func hostInterfaces() ([]hostInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]hostInterface, 0, len(ifaces))
+	for _, i := range ifaces {
+		addrs, _ := i.Addrs()
+		out = append(out, hostInterface{i, addrs})
+	}
+	return out, nil
+}
+
+// managerInterfaces returns the host interfaces exposed as the manager's
+// EthernetInterfaces, in the order the system lists them.
+func (s *Server) managerInterfaces() ([]hostInterface, error) {
+	if s.cfg.HideManagerInterfaces {
+		return nil, nil
+	}
+	ifaces, err := s.interfaces()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(ifaces, func(i hostInterface) bool {
+		if len(s.cfg.ManagerInterfaces) > 0 {
+			return !slices.Contains(s.cfg.ManagerInterfaces, i.Name)
+		}
+		return i.Flags&net.FlagLoopback != 0
+	}), nil
+}
+
+func (s *Server) handleManagerInterfaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ifaces, err := s.managerInterfaces()
+	if err != nil {
+		log.Printf("list interfaces: %v", err)
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	base := "/redfish/v1/Managers/" + managerID + "/EthernetInterfaces"
+	members := make([]map[string]string, 0, len(ifaces))
+	for _, i := range ifaces {
+		members = append(members, map[string]string{"@odata.id": base + "/" + url.PathEscape(i.Name)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":         "#EthernetInterfaceCollection.EthernetInterfaceCollection",
+		"@odata.id":           base,
+		"Name":                "Manager Ethernet Interface Collection",
+		"Members":             members,
+		"Members@odata.count": len(members),
+	})
+}
+
+func (s *Server) handleManagerInterface(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ifaces, err := s.managerInterfaces()
+	if err != nil {
+		log.Printf("list interfaces: %v", err)
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	i := slices.IndexFunc(ifaces, func(i hostInterface) bool { return i.Name == name })
+	if i < 0 {
+		writeNotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, managerInterfaceResource(ifaces[i]))
+}
+
+// managerInterfaceResource renders a host interface with its addresses.
+func managerInterfaceResource(i hostInterface) map[string]any {
+	ipv4 := []map[string]any{}
+	ipv6 := []map[string]any{}
+	for _, a := range i.addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipnet.IP.To4(); ip4 != nil {
+			ipv4 = append(ipv4, map[string]any{
+				"Address":    ip4.String(),
+				"SubnetMask": net.IP(ipnet.Mask).String(),
+			})
+			continue
+		}
+		ones, _ := ipnet.Mask.Size()
+		ipv6 = append(ipv6, map[string]any{
+			"Address":      ipnet.IP.String(),
+			"PrefixLength": ones,
+		})
+	}
+	up := i.Flags&net.FlagUp != 0
+	state, link := "Disabled", "LinkDown"
+	if up {
+		state, link = "Enabled", "LinkUp"
+	}
+	iface := map[string]any{
+		"@odata.type":      "#EthernetInterface.v1_4_0.EthernetInterface",
+		"@odata.id":        "/redfish/v1/Managers/" + managerID + "/EthernetInterfaces/" + url.PathEscape(i.Name),
+		"Id":               i.Name,
+		"Name":             i.Name,
+		"InterfaceEnabled": up,
+		"LinkStatus":       link,
+		"MTUSize":          i.MTU,
+		"IPv4Addresses":    ipv4,
+		"IPv6Addresses":    ipv6,
+		"Status":           map[string]string{"State": state, "Health": "OK"},
+	}
+	if len(i.HardwareAddr) > 0 {
+		mac := i.HardwareAddr.String()
+		iface["MACAddress"] = mac
+		iface["PermanentMACAddress"] = mac
+	}
+	return iface
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func getJSON(t *testing.T, h http.Handler, path string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("GET %s: %v: %s", path, err, rec.Body)
+	}
+	return rec.Code, body
+}
+
+func TestNetworkProtocol(t *testing.T) {
+	tests := []struct {
+		name      string
+		listen    []string
+		advertise bool
+		want      map[string]any
+	}{
+		{
+			name:   "http only",
+			listen: []string{":8000"},
+			want: map[string]any{
+				"HTTP":  map[string]any{"ProtocolEnabled": true, "Port": 8000.0},
+				"HTTPS": map[string]any{"ProtocolEnabled": false},
+				"SSDP":  map[string]any{"ProtocolEnabled": false},
+			},
+		},
+		{
+			name:      "https and ssdp",
+			listen:    []string{"https://[::1]:8443", "http://127.0.0.1:8080"},
+			advertise: true,
+			want: map[string]any{
+				"HTTP":  map[string]any{"ProtocolEnabled": true, "Port": 8080.0},
+				"HTTPS": map[string]any{"ProtocolEnabled": true, "Port": 8443.0},
+				"SSDP":  map[string]any{"ProtocolEnabled": true, "Port": 1900.0, "NotifyMulticastIntervalSeconds": 900.0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(Config{Listen: tt.listen, Advertise: tt.advertise}).Handler()
+			code, body := getJSON(t, h, "/redfish/v1/Managers/"+managerID+"/NetworkProtocol")
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			for k, want := range tt.want {
+				if !reflect.DeepEqual(body[k], want) {
+					t.Errorf("%s = %v, want %v", k, body[k], want)
+				}
+			}
+		})
+	}
+}
+
+// fakeInterfaces returns the interfaces of a host with a loopback, a
+// wired interface that is up and a wireless one that is down.
+func fakeInterfaces() ([]hostInterface, error) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	_, v4, _ := net.ParseCIDR("192.0.2.10/24")
+	v4.IP = net.ParseIP("192.0.2.10")
+	_, v6, _ := net.ParseCIDR("2001:db8::10/64")
+	v6.IP = net.ParseIP("2001:db8::10")
+	_, lo, _ := net.ParseCIDR("127.0.0.1/8")
+	return []hostInterface{
+		{net.Interface{Index: 1, MTU: 65536, Name: "lo", Flags: net.FlagUp | net.FlagLoopback}, []net.Addr{lo}},
+		{net.Interface{Index: 2, MTU: 1500, Name: "eth0", HardwareAddr: mac, Flags: net.FlagUp}, []net.Addr{v4, v6}},
+		{net.Interface{Index: 3, MTU: 1500, Name: "wlan0"}, nil},
+	}, nil
+}
+
+func TestManagerEthernetInterfaces(t *testing.T) {
+	base := "/redfish/v1/Managers/" + managerID + "/EthernetInterfaces"
+	tests := []struct {
+		name    string
+		only    []string
+		hide    bool
+		members []any
+	}{
+		{"default", nil, false, []any{map[string]any{"@odata.id": base + "/eth0"}, map[string]any{"@odata.id": base + "/wlan0"}}},
+		{"restricted", []string{"wlan0", "missing"}, false, []any{map[string]any{"@odata.id": base + "/wlan0"}}},
+		{"hidden", nil, true, []any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{ManagerInterfaces: tt.only, HideManagerInterfaces: tt.hide})
+			s.interfaces = fakeInterfaces
+			code, body := getJSON(t, s.Handler(), base)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			if !reflect.DeepEqual(body["Members"], tt.members) || body["Members@odata.count"] != float64(len(tt.members)) {
+				t.Errorf("members = %v (%v), want %v", body["Members"], body["Members@odata.count"], tt.members)
+			}
+			if code, _ := getJSON(t, s.Handler(), base+"/lo"); code != http.StatusNotFound {
+				t.Errorf("GET of the loopback interface = %d, want 404", code)
+			}
+		})
+	}
+
+	s := New(Config{})
+	s.interfaces = fakeInterfaces
+	code, eth0 := getJSON(t, s.Handler(), base+"/eth0")
+	if code != http.StatusOK {
+		t.Fatalf("GET eth0 = %d", code)
+	}
+	want := map[string]any{
+		"Id":                  "eth0",
+		"MACAddress":          "52:54:00:12:34:56",
+		"PermanentMACAddress": "52:54:00:12:34:56",
+		"InterfaceEnabled":    true,
+		"LinkStatus":          "LinkUp",
+		"MTUSize":             1500.0,
+		"IPv4Addresses":       []any{map[string]any{"Address": "192.0.2.10", "SubnetMask": "255.255.255.0"}},
+		"IPv6Addresses":       []any{map[string]any{"Address": "2001:db8::10", "PrefixLength": 64.0}},
+		"Status":              map[string]any{"State": "Enabled", "Health": "OK"},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(eth0[k], v) {
+			t.Errorf("eth0 %s = %v, want %v", k, eth0[k], v)
+		}
+	}
+	_, wlan0 := getJSON(t, s.Handler(), base+"/wlan0")
+	if wlan0["LinkStatus"] != "LinkDown" || wlan0["InterfaceEnabled"] != false || wlan0["MACAddress"] != nil {
+		t.Errorf("wlan0 = %v, want a disabled interface without a MAC address", wlan0)
+	}
+
+	s.interfaces = func() ([]hostInterface, error) { return nil, errors.New("netlink unavailable") }
+	if code, _ := getJSON(t, s.Handler(), base); code != http.StatusInternalServerError {
+		t.Errorf("listing failing interfaces = %d, want 500", code)
+	}
+}
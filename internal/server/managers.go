@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo"
+)
+
+// managerID is the ID of the single manager representing the shim itself.
+const managerID = "1"
+
+func (s *Server) handleManagers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":         "#ManagerCollection.ManagerCollection",
+		"@odata.id":           "/redfish/v1/Managers",
+		"Name":                "Manager Collection",
+		"Members":             []map[string]string{{"@odata.id": "/redfish/v1/Managers/" + managerID}},
+		"Members@odata.count": 1,
+	})
+}
+
+func (s *Server) handleManager(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/redfish/v1/Managers/")
+	id, sub, _ := strings.Cut(path, "/")
+	sub = strings.TrimSuffix(sub, "/")
+	if id != managerID {
+		writeNotFound(w, r)
+		return
+	}
+	base := "/redfish/v1/Managers/" + managerID
+
+	switch sub {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		ids := s.visibleSystemIDs(r)
+		servers := make([]map[string]string, 0, len(ids))
+		for _, id := range ids {
+			servers = append(servers, map[string]string{"@odata.id": "/redfish/v1/Systems/" + id})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":     "#Manager.v1_5_0.Manager",
+			"@odata.id":       base,
+			"Id":              managerID,
+			"Name":            "BMC Shim Manager",
+			"ManagerType":     "BMC",
+			"FirmwareVersion": buildinfo.Get().Version,
+			"Status":          map[string]string{"State": "Enabled", "Health": "OK"},
+			"Oem": map[string]any{
+				"BmcShim": map[string]any{"ReadOnly": s.ReadOnly()},
+			},
+			"NetworkProtocol":    map[string]string{"@odata.id": base + "/NetworkProtocol"},
+			"EthernetInterfaces": map[string]string{"@odata.id": base + "/EthernetInterfaces"},
+			"Links": map[string]any{
+				"ManagerForServers": servers,
+			},
+			"Actions": map[string]any{
+				"#Manager.Reset": map[string]any{
+					"target":                            base + "/Actions/Manager.Reset",
+					"ResetType@Redfish.AllowableValues": []string{"GracefulRestart", "ForceRestart"},
+				},
+			},
+		})
+	case "Actions/Manager.Reset":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		// A manager reset affects every system.
+		if p, ok := requestPrincipal(r); ok && p.Systems != nil {
+			writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
+			return
+		}
+		var body struct{ ResetType string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, msgMalformedJSON())
+			return
+		}
+		switch body.ResetType {
+		case "", "GracefulRestart", "ForceRestart":
+		default:
+			writeError(w, http.StatusBadRequest, msgActionParameterValueFormatError(body.ResetType, "ResetType", "Manager.Reset"))
+			return
+		}
+		log.Printf("manager reset requested by %s", initiator(r))
+		s.softReset(r.Context())
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@Message.ExtendedInfo": []message{msgSuccess()},
+		})
+	case "NetworkProtocol":
+		s.handleNetworkProtocol(w, r)
+	case "NetworkProtocol/HTTPS/Certificates":
+		s.handleHTTPSCertificates(w, r, "")
+	case "EthernetInterfaces":
+		s.handleManagerInterfaces(w, r)
+	default:
+		if cert, ok := strings.CutPrefix(sub, "NetworkProtocol/HTTPS/Certificates/"); ok {
+			s.handleHTTPSCertificates(w, r, cert)
+			return
+		}
+		if name, ok := strings.CutPrefix(sub, "EthernetInterfaces/"); ok {
+			s.handleManagerInterface(w, r, name)
+			return
+		}
+		writeNotFound(w, r)
+	}
+}
+
+// softReset re-initializes the shim without dropping the listener: it waits
+// for in-flight power actions, drops and re-establishes persistent backend
+// connections, drops the read cache and re-runs the health checks. The
+// last known power states are kept: they are what the server set, which
+// backends without a power state cannot tell again.
+func (s *Server) softReset(ctx context.Context) {
+	// Blocks until in-flight actions finish and holds off new ones.
+	s.actionMu.Lock()
+	defer s.actionMu.Unlock()
+
+	// One snapshot, so systems SetSystems removes meanwhile are still
+	// reset rather than looked up in vain.
+	set := s.systems.Load()
+	ids := set.ids
+	_, errs := fanOut(ctx, ids, fanOutTimeout, func(ctx context.Context, id string) (struct{}, error) {
+		be := set.backends[id]
+		if rc := be.Capabilities().Reconnect; rc != nil {
+			return struct{}{}, rc.Reconnect(ctx)
+		}
+		return struct{}{}, nil
+	})
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("manager reset: reconnect %s: %v", ids[i], err)
+		}
+	}
+
+	s.cache.invalidateAll()
+
+	checked, errs := fanOut(ctx, ids, 15*time.Second, func(ctx context.Context, id string) (bool, error) {
+		be := set.backends[id]
+		return be.Capabilities().Health != nil, s.ping(ctx, id, be, 0)
+	})
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("manager reset: system %s unhealthy: %v", ids[i], err)
+		} else if checked[i] {
+			log.Printf("manager reset: system %s healthy", ids[i])
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// reconnectingSystem is a countingSystem that counts its reconnects.
+type reconnectingSystem struct {
+	countingSystem
+	reconnects int
+}
+
+func (r *reconnectingSystem) Capabilities() backend.Capability {
+	c := r.countingSystem.Capabilities()
+	c.Reconnect = r
+	return c
+}
+
+func (r *reconnectingSystem) Reconnect(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reconnects++
+	return nil
+}
+
+// TestManagerResetKeepsLastKnownState checks that a manager reset
+// reconnects the backends but keeps the power state the server last set
+// for those that cannot report it.
+func TestManagerResetKeepsLastKnownState(t *testing.T) {
+	sys := &reconnectingSystem{}
+	h := New(Config{Systems: map[string]backend.System{"1": sys}}).Handler()
+	postReset(t, h, "On")
+
+	req := httptest.NewRequest(http.MethodPost, "/redfish/v1/Managers/1/Actions/Manager.Reset", strings.NewReader(`{"ResetType":"GracefulRestart"}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Manager.Reset = %d: %s", rec.Code, rec.Body)
+	}
+	if sys.reconnects != 1 {
+		t.Errorf("reconnects = %d, want 1", sys.reconnects)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/redfish/v1/Systems/1", nil))
+	var got struct{ PowerState string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PowerState != "On" {
+		t.Errorf("PowerState after the manager reset = %q, want On", got.PowerState)
+	}
+	postReset(t, h, "On")
+	if calls := sys.calls(); len(calls) != 1 {
+		t.Errorf("backend resets = %v, want only the first On", calls)
+	}
+}
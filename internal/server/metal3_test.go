@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+// sushyHeaders are the headers sushy, the Redfish library of Ironic,
+// sends with every request.
+var sushyHeaders = http.Header{
+	"Accept":        {"application/json"},
+	"Content-Type":  {"application/json"},
+	"Odata-Version": {"4.0"},
+	"User-Agent":    {"python-sushy/4.8.0 openstack-ironic/24.1.0"},
+}
+
+// TestIronicRegistrationAndPowerSync replays the requests Ironic's redfish
+// driver makes when a Metal3 BareMetalHost is registered (service root,
+// system, manager and chassis, the boot device and power state), then
+// during provisioning (a PXE boot override and a power on) and in its
+// periodic power sync, and compares the exchanges with
+// testdata/metal3.golden.
+func TestIronicRegistrationAndPowerSync(t *testing.T) {
+	s := newGoldenServer(Config{Profile: ProfileMetal3})
+	replay(t, s.Handler(), sushyHeaders, "metal3.golden", []exchange{
+		// Registration: sushy connects and Ironic validates the node.
+		{method: http.MethodGet, path: "/redfish/v1/"},
+		{method: http.MethodGet, path: "/redfish/v1/Systems/1"},
+		{method: http.MethodGet, path: "/redfish/v1/Managers/1"},
+		{method: http.MethodGet, path: "/redfish/v1/Chassis/1"},
+		{method: http.MethodGet, path: "/redfish/v1/Systems/1/ResetActionInfo"},
+		// Power sync: the host is expected off.
+		{method: http.MethodGet, path: "/redfish/v1/Systems/1"},
+		{method: http.MethodPost, path: "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", body: `{"ResetType": "ForceOff"}`},
+		// Provisioning: a one-time PXE boot in UEFI mode, then power on.
+		{method: http.MethodPatch, path: "/redfish/v1/Systems/1", body: `{"Boot": {"BootSourceOverrideMode": "UEFI"}}`},
+		{method: http.MethodPatch, path: "/redfish/v1/Systems/1", body: `{"Boot": {"BootSourceOverrideEnabled": "Once", "BootSourceOverrideTarget": "Pxe"}}`},
+		{method: http.MethodPost, path: "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", body: `{"ResetType": "On"}`},
+		// Power sync after provisioning.
+		{method: http.MethodGet, path: "/redfish/v1/Systems/1"},
+		// Deprovisioning: power off.
+		{method: http.MethodPost, path: "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", body: `{"ResetType": "ForceOff"}`},
+		{method: http.MethodGet, path: "/redfish/v1/Systems/1"},
+	})
+}
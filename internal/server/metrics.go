@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// handleMetrics serves per-system gauges in the Prometheus text format.
+// States come from the cache kept up to date by the poller and API calls;
+// only with Config.MetricsLiveState are the backends queried per scrape.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ids := s.visibleSystemIDs(r)
+	if s.cfg.MetricsLiveState {
+		s.refreshAll(r.Context(), ids)
+	}
+
+	s.mu.RLock()
+	type sample struct {
+		id, name    string
+		state       int
+		up, upKnown bool
+		unknown     bool
+		transitions uint64
+		// flapping is only reported for systems with hysteresis.
+		hysteresis, flapping bool
+	}
+	samples := make([]sample, 0, len(ids))
+	for _, id := range ids {
+		smp := sample{id: id, name: s.systemInfo(id).Name, state: -1, transitions: s.transitions[id]}
+		if smp.name == "" {
+			smp.name = "System " + id
+		}
+		if on, ok := s.last[id]; ok {
+			smp.state = 0
+			if on {
+				smp.state = 1
+			}
+		}
+		smp.up, smp.upKnown = s.up[id]
+		smp.unknown = s.unknownState[id]
+		if smp.hysteresis = s.stability(id).enabled(); smp.hysteresis {
+			if h := s.hysteresis[id]; h != nil {
+				smp.flapping = h.flapping
+			}
+		}
+		samples = append(samples, smp)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	readOnly := 0
+	if s.ReadOnly() {
+		readOnly = 1
+	}
+	writeMetricHeader(w, "bmc_shim_read_only", "gauge", "Whether the service is in read-only (maintenance) mode.")
+	_, _ = fmt.Fprintf(w, "bmc_shim_read_only %d\n", readOnly)
+	writeMetricHeader(w, "bmc_shim_power_state", "gauge", "Power state of the system (1=on, 0=off, -1=unknown).")
+	for _, smp := range samples {
+		_, _ = fmt.Fprintf(w, "bmc_shim_power_state{system=%s,name=%s} %d\n", labelValue(smp.id), labelValue(smp.name), smp.state)
+	}
+	writeMetricHeader(w, "bmc_shim_backend_up", "gauge", "Whether the last health check of the system's backend succeeded.")
+	for _, smp := range samples {
+		if !smp.upKnown {
+			continue
+		}
+		up := 0
+		if smp.up {
+			up = 1
+		}
+		_, _ = fmt.Fprintf(w, "bmc_shim_backend_up{system=%s} %d\n", labelValue(smp.id), up)
+	}
+	writeMetricHeader(w, "bmc_shim_power_state_unknown", "gauge", "Whether the system's backend reports its power state as unknown, e.g. an unavailable Home Assistant entity.")
+	for _, smp := range samples {
+		unknown := 0
+		if smp.unknown {
+			unknown = 1
+		}
+		_, _ = fmt.Fprintf(w, "bmc_shim_power_state_unknown{system=%s} %d\n", labelValue(smp.id), unknown)
+	}
+	writeMetricHeader(w, "bmc_shim_power_state_transitions_total", "counter", "Number of power state changes seen for the system.")
+	for _, smp := range samples {
+		_, _ = fmt.Fprintf(w, "bmc_shim_power_state_transitions_total{system=%s} %d\n", labelValue(smp.id), smp.transitions)
+	}
+	writeMetricHeader(w, "bmc_shim_power_state_flapping", "gauge", "Whether the reported power state of the system is flapping (systems with hysteresis only).")
+	for _, smp := range samples {
+		if !smp.hysteresis {
+			continue
+		}
+		flapping := 0
+		if smp.flapping {
+			flapping = 1
+		}
+		_, _ = fmt.Fprintf(w, "bmc_shim_power_state_flapping{system=%s} %d\n", labelValue(smp.id), flapping)
+	}
+	s.writeActionMetrics(w, ids)
+	if c := s.cfg.BackendCalls; c != nil {
+		c.write(w, ids)
+	}
+	writeMetricHeader(w, "bmc_shim_cache_reads_total", "counter", "Number of backend reads by kind and whether they were served from the cache (hit), the backend (miss) or the cache after the backend failed (stale).")
+	for _, kind := range cacheKinds {
+		c := s.cache.counters[kind]
+		_, _ = fmt.Fprintf(w, "bmc_shim_cache_reads_total{kind=%q,result=\"hit\"} %d\n", kind, c.hits.Load())
+		_, _ = fmt.Fprintf(w, "bmc_shim_cache_reads_total{kind=%q,result=\"miss\"} %d\n", kind, c.misses.Load())
+		_, _ = fmt.Fprintf(w, "bmc_shim_cache_reads_total{kind=%q,result=\"stale\"} %d\n", kind, c.stale.Load())
+	}
+	if len(s.cfg.NotifyURLs) > 0 {
+		writeMetricHeader(w, "bmc_shim_notifications_total", "counter", "Number of power state notifications by delivery result.")
+		_, _ = fmt.Fprintf(w, "bmc_shim_notifications_total{result=\"sent\"} %d\n", s.notify.sent.Load())
+		_, _ = fmt.Fprintf(w, "bmc_shim_notifications_total{result=\"failed\"} %d\n", s.notify.failed.Load())
+		_, _ = fmt.Fprintf(w, "bmc_shim_notifications_total{result=\"dropped\"} %d\n", s.notify.dropped.Load())
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, typ, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelValue quotes a Prometheus label value.
+func labelValue(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
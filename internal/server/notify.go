@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	// defaultNotifyTimeout bounds a single webhook delivery attempt.
+	defaultNotifyTimeout = 10 * time.Second
+	// notifyAttempts is how often a delivery is tried before it counts as
+	// failed.
+	notifyAttempts = 3
+	// notifyQueueSize is the number of pending notifications; further
+	// ones are dropped rather than blocking the caller.
+	notifyQueueSize = 256
+)
+
+// Notification is the payload POSTed to the notification webhooks. It is
+// also the data a notification template is executed with.
+type Notification struct {
+	System    string `json:"system"`
+	Name      string `json:"-"`
+	OldState  string `json:"old_state"`
+	NewState  string `json:"new_state"`
+	Initiator string `json:"initiator"`
+	// Origin is api, out-of-band or startup-recovery.
+	Origin    string    `json:"origin"`
+	Timestamp time.Time `json:"timestamp"`
+	// Test marks a test notification, which carries no state change.
+	Test bool `json:"test,omitempty"`
+}
+
+// ParseNotifyTemplate parses a payload template for the notification
+// webhooks, e.g. {"text": "{{.System}} is now {{.NewState}}"}. Besides the
+// fields of Notification, templates may use the json function to quote a
+// value as a JSON string.
+func ParseNotifyTemplate(text string) (*template.Template, error) {
+	t, err := template.New("notify").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			var b strings.Builder
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(b.String(), "\n"), nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify template: %w", err)
+	}
+	return t, nil
+}
+
+// notifier delivers notifications to the configured webhooks from a
+// background goroutine.
+type notifier struct {
+	urls   []string
+	tmpl   *template.Template
+	client *http.Client
+	queue  chan Notification
+
+	sent    atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+func newNotifier(urls []string, tmpl *template.Template, timeout time.Duration) *notifier {
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	return &notifier{
+		urls:   urls,
+		tmpl:   tmpl,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan Notification, notifyQueueSize),
+	}
+}
+
+// enqueue schedules n for delivery. It never blocks.
+func (nt *notifier) enqueue(n Notification) {
+	if len(nt.urls) == 0 {
+		return
+	}
+	select {
+	case nt.queue <- n:
+	default:
+		nt.dropped.Add(1)
+		log.Printf("notify: queue full, dropping notification for system %s", n.System)
+	}
+}
+
+// run delivers queued notifications until ctx is done.
+func (nt *notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-nt.queue:
+			body, err := nt.payload(n)
+			if err != nil {
+				log.Printf("notify: system %s: %v", n.System, err)
+				nt.failed.Add(uint64(len(nt.urls)))
+				continue
+			}
+			for _, u := range nt.urls {
+				if err := nt.deliver(ctx, u, body); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					nt.failed.Add(1)
+					log.Printf("notify: system %s: %v", n.System, err)
+					continue
+				}
+				nt.sent.Add(1)
+			}
+		}
+	}
+}
+
+func (nt *notifier) payload(n Notification) ([]byte, error) {
+	if nt.tmpl == nil {
+		return json.Marshal(n)
+	}
+	var b bytes.Buffer
+	if err := nt.tmpl.Execute(&b, n); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// test delivers a test notification to every webhook at once, without
+// retrying, and returns the failures.
+func (nt *notifier) test(ctx context.Context, by string) error {
+	if len(nt.urls) == 0 {
+		return nil
+	}
+	body, err := nt.payload(Notification{Initiator: by, Timestamp: time.Now().UTC(), Test: true})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, u := range nt.urls {
+		if err := nt.post(ctx, u, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyNotifications delivers a test notification to every webhook and
+// returns the failures, e.g. to refuse a mistyped URL at startup.
+func (s *Server) VerifyNotifications(ctx context.Context) error {
+	return s.notify.test(ctx, "bmc-shim")
+}
+
+// deliver POSTs body to url, retrying with a growing delay.
+func (nt *notifier) deliver(ctx context.Context, url string, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt-1) * time.Second):
+			}
+		}
+		if err = nt.post(ctx, url, body); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: giving up after %d attempts: %w", url, notifyAttempts, err)
+}
+
+func (nt *notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := nt.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("http %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifyChange queues a notification about a power state change of a
+// system. known is false when the previous state was never seen.
+func (s *Server) notifyChange(id string, prev, known, on bool, by, origin string) {
+	old := "Unknown"
+	if known {
+		old = powerStateString(prev)
+	}
+	s.notify.enqueue(Notification{
+		System:    id,
+		Name:      s.systemInfo(id).Name,
+		OldState:  old,
+		NewState:  powerStateString(on),
+		Initiator: by,
+		Origin:    origin,
+		Timestamp: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// subscriber is a webhook receiver answering with status and recording
+// the bodies it gets.
+type subscriber struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newSubscriber(t *testing.T, status int) *subscriber {
+	t.Helper()
+	sub := &subscriber{}
+	sub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sub.mu.Lock()
+		sub.bodies = append(sub.bodies, string(b))
+		sub.mu.Unlock()
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(sub.Close)
+	return sub
+}
+
+func (sub *subscriber) received() []string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return append([]string(nil), sub.bodies...)
+}
+
+func TestVerifyNotifications(t *testing.T) {
+	ok := newSubscriber(t, http.StatusNoContent)
+	s := New(Config{NotifyURLs: []string{ok.URL}})
+	if err := s.VerifyNotifications(context.Background()); err != nil {
+		t.Fatalf("VerifyNotifications = %v", err)
+	}
+	got := ok.received()
+	if len(got) != 1 {
+		t.Fatalf("subscriber got %d requests, want 1", len(got))
+	}
+	var n Notification
+	if err := json.Unmarshal([]byte(got[0]), &n); err != nil || !n.Test || n.Initiator != "bmc-shim" {
+		t.Errorf("test notification = %s (%v), want a test by bmc-shim", got[0], err)
+	}
+
+	failing := newSubscriber(t, http.StatusInternalServerError)
+	gone := newSubscriber(t, http.StatusOK)
+	gone.Close()
+	s = New(Config{NotifyURLs: []string{ok.URL, failing.URL, gone.URL}})
+	err := s.VerifyNotifications(context.Background())
+	if err == nil || !strings.Contains(err.Error(), failing.URL+": http 500") || !strings.Contains(err.Error(), gone.URL) || strings.Contains(err.Error(), ok.URL+":") {
+		t.Errorf("VerifyNotifications = %v, want the failing and unreachable subscribers named", err)
+	}
+	// Not retried: a test shows the first answer.
+	if n := len(failing.received()); n != 1 {
+		t.Errorf("failing subscriber got %d requests, want 1", n)
+	}
+	if n := len(ok.received()); n != 2 {
+		t.Errorf("working subscriber got %d requests, want 2", n)
+	}
+}
+
+func TestSubmitTestEvent(t *testing.T) {
+	tmpl, err := ParseNotifyTemplate(`{"text": {{json (printf "test from %s" .Initiator)}}, "test": {{.Test}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := newSubscriber(t, http.StatusOK)
+	const path = "/redfish/v1/EventService/Actions/EventService.SubmitTestEvent"
+	h := New(Config{NotifyURLs: []string{ok.URL}, NotifyTemplate: tmpl}).Handler()
+	if rec := request(h, http.MethodPost, path, `{"MessageId": "Base.1.0.Success"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("SubmitTestEvent = %d: %s", rec.Code, rec.Body)
+	}
+	if got := ok.received(); len(got) != 1 || got[0] != `{"text": "test from anonymous@192.0.2.1", "test": true}` {
+		t.Errorf("subscriber got %q", got)
+	}
+
+	failing := newSubscriber(t, http.StatusNotFound)
+	h = New(Config{NotifyURLs: []string{failing.URL}}).Handler()
+	if rec := request(h, http.MethodPost, path, ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("SubmitTestEvent to a failing subscriber = %d, want 500", rec.Code)
+	}
+	if rec := request(h, http.MethodPost, path, `{"MessageSeverity": "Fatal"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("SubmitTestEvent with an invalid severity = %d, want 400", rec.Code)
+	}
+	if n := len(failing.received()); n != 1 {
+		t.Errorf("failing subscriber got %d requests, want 1 (none for the invalid event)", n)
+	}
+}
@@ -0,0 +1,428 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256, PS256, ES256
+	_ "crypto/sha512" // SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Authentication modes (Config.AuthMode).
+const (
+	// AuthModeBasic accepts basic auth and API keys.
+	AuthModeBasic = "basic"
+	// AuthModeOIDC accepts only bearer tokens of the OIDC issuer.
+	AuthModeOIDC = "oidc"
+	// AuthModeOIDCBasic accepts OIDC tokens and falls back to basic auth
+	// and API keys.
+	AuthModeOIDCBasic = "oidc+basic"
+)
+
+const (
+	// jwksTTL is how long fetched signing keys are used before they are
+	// fetched again.
+	jwksTTL = time.Hour
+	// jwksMinRefresh limits refetching for tokens signed with an unknown
+	// key, which a client could otherwise use to make the service hammer
+	// the issuer.
+	jwksMinRefresh = time.Minute
+	// jwtLeeway tolerates clock skew between issuer and service.
+	jwtLeeway = time.Minute
+)
+
+// OIDCConfig configures validation of bearer tokens issued by an OpenID
+// Connect provider such as Keycloak.
+type OIDCConfig struct {
+	// Issuer is the issuer URL; its discovery document names the JWKS.
+	Issuer string
+	// Audience must be one of the token's aud values.
+	Audience string
+	// RoleClaim is the claim holding the client's groups or roles, as a
+	// dotted path (e.g. realm_access.roles). Default "groups".
+	RoleClaim string
+	// OperatorValues and ReaderValues are the RoleClaim values granting
+	// each role; operator wins. If both are empty every valid token is an
+	// operator.
+	OperatorValues []string
+	ReaderValues   []string
+}
+
+// oidcVerifier validates JWTs against the issuer's published keys.
+type oidcVerifier struct {
+	cfg    OIDCConfig
+	client *http.Client
+	// fetches coalesces concurrent JWKS fetches into one.
+	fetches singleflight.Group
+
+	mu      sync.Mutex
+	jwksURI string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newOIDCVerifier(cfg OIDCConfig) *oidcVerifier {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = "groups"
+	}
+	return &oidcVerifier{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// looksLikeJWT tells a JWT from an opaque bearer token (an API key).
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// verify validates a token and returns the client it identifies.
+func (v *oidcVerifier) verify(ctx context.Context, token string) (principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return principal{}, errors.New("malformed token")
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return principal{}, fmt.Errorf("token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return principal{}, fmt.Errorf("token signature: %w", err)
+	}
+	key, err := v.key(ctx, hdr.Kid)
+	if err != nil {
+		return principal{}, err
+	}
+	if err := verifySignature(hdr.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return principal{}, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return principal{}, fmt.Errorf("token claims: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != v.cfg.Issuer {
+		return principal{}, fmt.Errorf("issuer %q not accepted", iss)
+	}
+	if !slices.Contains(claimStrings(claims["aud"]), v.cfg.Audience) {
+		return principal{}, fmt.Errorf("audience %v does not include %q", claims["aud"], v.cfg.Audience)
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return principal{}, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return principal{}, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return principal{}, errors.New("token not yet valid")
+	}
+
+	p := principal{Name: "oidc"}
+	if n, _ := claims["preferred_username"].(string); n != "" {
+		p.Name = n
+	} else if n, _ := claims["sub"].(string); n != "" {
+		p.Name = n
+	}
+	p.Role = v.role(claims)
+	return p, nil
+}
+
+// role maps the role claim to a role, or "" if it grants none.
+func (v *oidcVerifier) role(claims map[string]any) string {
+	if len(v.cfg.OperatorValues) == 0 && len(v.cfg.ReaderValues) == 0 {
+		return RoleOperator
+	}
+	var c any = claims
+	for _, name := range strings.Split(v.cfg.RoleClaim, ".") {
+		m, ok := c.(map[string]any)
+		if !ok {
+			return ""
+		}
+		c = m[name]
+	}
+	values := claimStrings(c)
+	role := ""
+	for _, val := range values {
+		if slices.Contains(v.cfg.OperatorValues, val) {
+			return RoleOperator
+		}
+		if slices.Contains(v.cfg.ReaderValues, val) {
+			role = RoleReader
+		}
+	}
+	return role
+}
+
+// claimStrings returns a claim that may be a string or a list of them.
+func claimStrings(c any) []string {
+	switch c := c.(type) {
+	case string:
+		return []string{c}
+	case []any:
+		out := make([]string, 0, len(c))
+		for _, e := range c {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func decodeSegment(seg string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// verifySignature checks a JWS signature. Only asymmetric algorithms are
+// accepted, so a token can never be signed with a public key as an HMAC
+// secret, nor be unsigned.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	d := h.New()
+	d.Write([]byte(signed))
+	digest := d.Sum(nil)
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("token algorithm %s does not match the key", alg)
+		}
+		if alg[0] == 'R' {
+			return rsa.VerifyPKCS1v15(pub, h, digest, sig)
+		}
+		return rsa.VerifyPSS(pub, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		// Each ES algorithm is bound to one curve (RFC 7518 3.4).
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != esCurves[alg] {
+			return fmt.Errorf("token algorithm %s does not match the key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid ECDSA signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported token algorithm %q", alg)
+}
+
+// esCurves are the curves of the ES algorithms.
+var esCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// key returns the signing key with the given ID, fetching the JWKS when
+// the cached one is stale or lacks the key. A token without kid is
+// accepted if the issuer publishes a single key. The issuer is not
+// contacted with v.mu held, so a slow issuer only delays the tokens
+// waiting for a fetch.
+func (v *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k, ok, fetched := v.cachedKey(kid)
+	stale := time.Since(fetched) > jwksTTL
+	if ok && !stale {
+		return k, nil
+	}
+	if stale || time.Since(fetched) > jwksMinRefresh {
+		// The fetch is shared by the waiting requests, so it must not be
+		// canceled with the one that started it; the client timeout
+		// bounds it.
+		_, err, _ := v.fetches.Do("jwks", func() (any, error) {
+			return nil, v.fetchKeys(context.WithoutCancel(ctx), fetched)
+		})
+		if err != nil {
+			// Keep using the cached keys while the issuer is unreachable.
+			if k, ok, _ := v.cachedKey(kid); ok {
+				return k, nil
+			}
+			return nil, err
+		}
+	}
+	if k, ok, _ := v.cachedKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no signing key %q", kid)
+}
+
+// cachedKey returns the cached signing key with the given ID and when the
+// keys were fetched.
+func (v *oidcVerifier) cachedKey(kid string) (crypto.PublicKey, bool, time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k, true, v.fetched
+		}
+	}
+	k, ok := v.keys[kid]
+	return k, ok, v.fetched
+}
+
+// fetchKeys reads the issuer's discovery document, if not done yet, and
+// its JWKS, and replaces the cached keys. It does nothing if the keys
+// were fetched again since the caller saw them fetched at seen.
+func (v *oidcVerifier) fetchKeys(ctx context.Context, seen time.Time) error {
+	v.mu.Lock()
+	jwksURI, fetched := v.jwksURI, v.fetched
+	v.mu.Unlock()
+	if !fetched.Equal(seen) {
+		return nil
+	}
+	if jwksURI == "" {
+		var doc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, v.cfg.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+			return fmt.Errorf("oidc discovery: %w", err)
+		}
+		if strings.TrimSuffix(doc.Issuer, "/") != v.cfg.Issuer {
+			return fmt.Errorf("oidc discovery: document is for issuer %q", doc.Issuer)
+		}
+		if doc.JWKSURI == "" {
+			return errors.New("oidc discovery: no jwks_uri")
+		}
+		jwksURI = doc.JWKSURI
+		v.mu.Lock()
+		v.jwksURI = jwksURI
+		v.mu.Unlock()
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, jwksURI, &set); err != nil {
+		return fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys of types we do not use rather than fail.
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	v.mu.Lock()
+	v.keys, v.fetched = keys, time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *oidcVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: http %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jwk is a JSON Web Key (RFC 7517) of type RSA or EC.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
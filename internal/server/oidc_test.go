@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is an OIDC issuer publishing the public keys of keys. Until
+// release is closed, JWKS requests block.
+type fakeIssuer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu      sync.Mutex
+	keys    map[string]crypto.Signer
+	release chan struct{}
+}
+
+// rotate publishes keys, blocking JWKS requests until the returned
+// channel is closed.
+func (f *fakeIssuer) rotate(keys map[string]crypto.Signer) chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys, f.release = keys, make(chan struct{})
+	return f.release
+}
+
+func newFakeIssuer(t *testing.T, keys map[string]crypto.Signer) *fakeIssuer {
+	t.Helper()
+	f := &fakeIssuer{keys: keys, release: make(chan struct{})}
+	close(f.release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": f.URL, "jwks_uri": f.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.fetches.Add(1)
+		f.mu.Lock()
+		keys, release := f.keys, f.release
+		f.mu.Unlock()
+		<-release
+		var set []map[string]string
+		for kid, k := range keys {
+			set = append(set, publicJWK(kid, k.Public()))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": set})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func publicJWK(kid string, pub crypto.PublicKey) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{"kty": "EC", "kid": kid, "crv": pub.Curve.Params().Name, "x": b64(pub.X.FillBytes(make([]byte, size))), "y": b64(pub.Y.FillBytes(make([]byte, size)))}
+	}
+	panic("unsupported key type")
+}
+
+// signToken returns a JWT of claims signed with key under alg.
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(body)
+	h := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[len(alg)-3:]]
+	d := h.New()
+	d.Write([]byte(signed))
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, h, d.Sum(nil))
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, d.Sum(nil))
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func mustECKey(t *testing.T, c elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(c, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestOIDCVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, p384, p521 := mustECKey(t, elliptic.P256()), mustECKey(t, elliptic.P384()), mustECKey(t, elliptic.P521())
+	iss := newFakeIssuer(t, map[string]crypto.Signer{"rsa": rsaKey, "p256": p256, "p384": p384, "p521": p521})
+	v := newOIDCVerifier(OIDCConfig{Issuer: iss.URL, Audience: "bmc-shim"})
+
+	now := time.Now().Unix()
+	claims := func(change func(map[string]any)) map[string]any {
+		c := map[string]any{"iss": iss.URL, "aud": "bmc-shim", "sub": "alice", "exp": now + 300, "nbf": now - 60}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	raw := func(hdr string, c map[string]any) string {
+		body, _ := json.Marshal(c)
+		return base64.RawURLEncoding.EncodeToString([]byte(hdr)) + "." + base64.RawURLEncoding.EncodeToString(body) + "."
+	}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"RS256", signToken(t, "RS256", "rsa", rsaKey, claims(nil)), ""},
+		{"ES256", signToken(t, "ES256", "p256", p256, claims(nil)), ""},
+		{"ES384", signToken(t, "ES384", "p384", p384, claims(nil)), ""},
+		{"ES512", signToken(t, "ES512", "p521", p521, claims(nil)), ""},
+		{"audience list", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { c["aud"] = []string{"other", "bmc-shim"} })), ""},
+		{"within leeway", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { c["exp"] = now - 30 })), ""},
+		{"expired", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { c["exp"] = now - 120 })), "token expired"},
+		{"no expiry", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { delete(c, "exp") })), "no expiry"},
+		{"not yet valid", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { c["nbf"] = now + 120 })), "not yet valid"},
+		{"wrong audience", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { c["aud"] = "other" })), "audience"},
+		{"no audience", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { delete(c, "aud") })), "audience"},
+		{"wrong issuer", signToken(t, "ES256", "p256", p256, claims(func(c map[string]any) { c["iss"] = "https://evil.example" })), "issuer"},
+		{"alg none", raw(`{"alg":"none","kid":"p256"}`, claims(nil)), "unsupported token algorithm"},
+		{"HS256 with the public key", raw(`{"alg":"HS256","kid":"rsa"}`, claims(nil)) + "c2ln", "unsupported token algorithm"},
+		{"RS256 header on an EC key", raw(`{"alg":"RS256","kid":"p256"}`, claims(nil)) + "c2ln", "does not match the key"},
+		{"ES256 header on an RSA key", raw(`{"alg":"ES256","kid":"rsa"}`, claims(nil)) + "c2ln", "does not match the key"},
+		{"tampered claims", func() string {
+			tok := strings.Split(signToken(t, "ES256", "p256", p256, claims(nil)), ".")
+			body, _ := json.Marshal(claims(func(c map[string]any) { c["sub"] = "mallory" }))
+			return tok[0] + "." + base64.RawURLEncoding.EncodeToString(body) + "." + tok[2]
+		}(), "invalid token signature"},
+		{"unknown key", signToken(t, "ES256", "gone", p256, claims(nil)), `no signing key "gone"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.verify(context.Background(), tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verify: %v", err)
+				}
+				if p.Name != "alice" || p.Role != RoleOperator {
+					t.Errorf("principal = %+v, want alice as operator", p)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verify = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestOIDCCurveBinding checks that an ES algorithm only verifies with the
+// key of its curve, even when the signature length would fit.
+func TestOIDCCurveBinding(t *testing.T) {
+	p384 := mustECKey(t, elliptic.P384())
+	iss := newFakeIssuer(t, map[string]crypto.Signer{"p384": p384})
+	v := newOIDCVerifier(OIDCConfig{Issuer: iss.URL, Audience: "bmc-shim"})
+	claims := map[string]any{"iss": iss.URL, "aud": "bmc-shim", "exp": time.Now().Unix() + 300}
+	for _, alg := range []string{"ES256", "ES512"} {
+		// A P-384 signature over the digest of alg.
+		tok := signToken(t, alg, "p384", p384, claims)
+		if _, err := v.verify(context.Background(), tok); err == nil || !strings.Contains(err.Error(), "does not match the key") {
+			t.Errorf("%s token signed with a P-384 key: verify = %v, want a key mismatch", alg, err)
+		}
+	}
+	if _, err := v.verify(context.Background(), signToken(t, "ES384", "p384", p384, claims)); err != nil {
+		t.Errorf("ES384 token signed with a P-384 key: %v", err)
+	}
+}
+
+// TestOIDCFetchOutsideLock checks that a JWKS fetch is shared by the
+// requests waiting for it and does not hold up tokens signed with a
+// cached key.
+func TestOIDCFetchOutsideLock(t *testing.T) {
+	known, rotated := mustECKey(t, elliptic.P256()), mustECKey(t, elliptic.P256())
+	iss := newFakeIssuer(t, map[string]crypto.Signer{"known": known})
+	v := newOIDCVerifier(OIDCConfig{Issuer: iss.URL, Audience: "bmc-shim"})
+	claims := map[string]any{"iss": iss.URL, "aud": "bmc-shim", "sub": "alice", "exp": time.Now().Unix() + 300}
+	knownToken := signToken(t, "ES256", "known", known, claims)
+	if _, err := v.verify(context.Background(), knownToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// The issuer rotates to a new key and becomes slow. Let the minimum
+	// refresh interval pass, so tokens with the new key trigger a fetch.
+	release := iss.rotate(map[string]crypto.Signer{"known": known, "rotated": rotated})
+	v.mu.Lock()
+	v.fetched = v.fetched.Add(-2 * jwksMinRefresh)
+	v.mu.Unlock()
+	fetchesBefore := iss.fetches.Load()
+
+	rotatedToken := signToken(t, "ES256", "rotated", rotated, claims)
+	const waiters = 8
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	errs := make(chan error, waiters)
+	for i := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := context.Background()
+			if i == 0 {
+				// Canceling one of the waiting requests must not fail
+				// the others.
+				c = ctx
+			}
+			_, err := v.verify(c, rotatedToken)
+			if i != 0 {
+				errs <- err
+			}
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for iss.fetches.Load() == fetchesBefore && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.verify(context.Background(), knownToken)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("token with a cached key during a fetch: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("token with a cached key waited for the JWKS fetch")
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("token with the rotated key: %v", err)
+		}
+	}
+	if n := iss.fetches.Load() - fetchesBefore; n != 1 {
+		t.Errorf("JWKS fetched %d times for %d concurrent tokens, want once", n, waiters)
+	}
+}
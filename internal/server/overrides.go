@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SystemOverrides are static ComputerSystem properties per system ID,
+// served instead of what the shim reports, for clients that insist on
+// particular values.
+type SystemOverrides map[string]map[string]json.RawMessage
+
+// overrideType is the JSON type of an overridable property: "string",
+// "integer", "number" or "object" with the given fields.
+type overrideType struct {
+	kind    string
+	enum    []string
+	pattern *regexp.Regexp
+	fields  map[string]overrideType
+}
+
+var overrideUUIDRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// overridable are the ComputerSystem properties overrides may set.
+// Links, actions, state and the properties clients change with PATCH are
+// left out, as overriding them would break the service.
+var overridable = map[string]overrideType{
+	"Name":         {kind: "string"},
+	"Description":  {kind: "string"},
+	"Manufacturer": {kind: "string"},
+	"Model":        {kind: "string"},
+	"SubModel":     {kind: "string"},
+	"SKU":          {kind: "string"},
+	"SerialNumber": {kind: "string"},
+	"PartNumber":   {kind: "string"},
+	"BiosVersion":  {kind: "string"},
+	"UUID":         {kind: "string", pattern: overrideUUIDRe},
+	"SystemType":   {kind: "string", enum: []string{"Physical", "Virtual", "OS", "PhysicallyPartitioned", "VirtuallyPartitioned", "Composed", "DPU"}},
+	"ProcessorSummary": {kind: "object", fields: map[string]overrideType{
+		"Count":                 {kind: "integer"},
+		"CoreCount":             {kind: "integer"},
+		"LogicalProcessorCount": {kind: "integer"},
+		"Model":                 {kind: "string"},
+	}},
+	"MemorySummary": {kind: "object", fields: map[string]overrideType{
+		"TotalSystemMemoryGiB": {kind: "number"},
+	}},
+}
+
+// ParseSystemOverrides parses a JSON object of system IDs to objects of
+// ComputerSystem properties, e.g. {"1": {"BiosVersion": "2.1.0"}},
+// rejecting properties that cannot be overridden and values of the wrong
+// type.
+func ParseSystemOverrides(v string) (SystemOverrides, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	var systems map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v), &systems); err != nil {
+		return nil, fmt.Errorf("expected a JSON object of system IDs to objects of properties: %w", err)
+	}
+	for _, id := range sortedKeys(systems) {
+		for _, prop := range sortedKeys(systems[id]) {
+			t, ok := overridable[prop]
+			if !ok {
+				return nil, fmt.Errorf("system %q: property %q cannot be overridden (expected one of %s)", id, prop, strings.Join(sortedKeys(overridable), ", "))
+			}
+			if err := t.check(systems[id][prop]); err != nil {
+				return nil, fmt.Errorf("system %q: %s: %w", id, prop, err)
+			}
+		}
+	}
+	return systems, nil
+}
+
+// check validates a value against t.
+func (t overrideType) check(raw json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return t.checkValue(v)
+}
+
+func (t overrideType) checkValue(v any) error {
+	switch t.kind {
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", jsonTypeName(v))
+		}
+		if t.enum != nil && !slices.Contains(t.enum, s) {
+			return fmt.Errorf("%q is not one of %s", s, strings.Join(t.enum, ", "))
+		}
+		if t.pattern != nil && !t.pattern.MatchString(s) {
+			return fmt.Errorf("%q does not match %s", s, t.pattern)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %s", jsonTypeName(v))
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("expected an integer, got %s", n)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("expected a number, got %s", jsonTypeName(v))
+		}
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected an object, got %s", jsonTypeName(v))
+		}
+		for _, k := range sortedKeys(m) {
+			ft, ok := t.fields[k]
+			if !ok {
+				return fmt.Errorf("unknown property %q (expected one of %s)", k, strings.Join(sortedKeys(t.fields), ", "))
+			}
+			if err := ft.checkValue(m[k]); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	default:
+		return errors.New("unsupported type")
+	}
+	return nil
+}
+
+// jsonTypeName names the JSON type of a decoded value for error messages.
+func jsonTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// reportsProperty reports whether the shim itself reports prop for a
+// system with info, so that an override of it replaces a value.
+func reportsProperty(info SystemInfo, prop string) bool {
+	switch prop {
+	case "Name", "UUID":
+		return true
+	case "Description":
+		return info.Description != ""
+	case "Manufacturer":
+		return info.Manufacturer != ""
+	case "Model":
+		return info.Model != ""
+	case "SerialNumber":
+		return info.SerialNumber != ""
+	case "ProcessorSummary":
+		return info.ProcessorCount > 0 || info.ProcessorModel != ""
+	case "MemorySummary":
+		return info.MemoryGiB > 0
+	}
+	return false
+}
+
+// logOverrides logs, once at startup, the overrides that replace a value
+// the shim reports and those of systems that do not exist.
+func (s *Server) logOverrides() {
+	for _, id := range sortedKeys(s.cfg.SystemOverrides) {
+		if _, ok := s.system(id); !ok {
+			log.Printf("warning: overrides of system %s: no such system", id)
+			continue
+		}
+		info := s.systemInfo(id)
+		var replaced []string
+		for _, prop := range sortedKeys(s.cfg.SystemOverrides[id]) {
+			if reportsProperty(info, prop) {
+				replaced = append(replaced, prop)
+			}
+		}
+		if len(replaced) > 0 {
+			log.Printf("system %s: overrides replace the reported %s", id, strings.Join(replaced, ", "))
+		}
+	}
+}
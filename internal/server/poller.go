@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// pollTimeout bounds a single backend call of the poller.
+const pollTimeout = 10 * time.Second
+
+// poll refreshes the cached power state and health of every system each
+// interval until ctx is done, so that metrics and fallbacks are current
+// even when no client is asking.
+func (s *Server) poll(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		s.pollOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Server) pollOnce(ctx context.Context) {
+	s.refreshAll(ctx, s.systemIDs())
+}
+
+// refreshAll refreshes the given systems concurrently.
+func (s *Server) refreshAll(ctx context.Context, ids []string) {
+	fanOut(ctx, ids, pollTimeout, func(ctx context.Context, id string) (struct{}, error) {
+		be, ok := s.system(id)
+		if !ok {
+			// Removed since the IDs were listed.
+			return struct{}{}, nil
+		}
+		return struct{}{}, s.refresh(ctx, id, be)
+	})
+}
+
+// refresh queries one backend. A successful state query also counts as a
+// health check, so Ping is only used for backends without state.
+func (s *Server) refresh(ctx context.Context, id string, be backend.System) error {
+	if err := s.notConnected(id); err != nil {
+		// Started in the background, not by the poller.
+		s.setUp(id, false)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+	var err error
+	caps := be.Capabilities()
+	switch {
+	case caps.PowerState:
+		var state backend.PowerState
+		if state, err = s.backendState(ctx, id, be, 0); err == nil {
+			s.observeState(id, stateOn(state))
+		}
+	case caps.Health != nil:
+		err = s.ping(ctx, id, be, 0)
+	}
+	if err != nil {
+		log.Printf("poll system %s: %v", id, err)
+	}
+	s.setUp(id, err == nil)
+	return err
+}
+
+// ping runs the health check of a system, if its backend has one, unless
+// one passed within maxAge.
+func (s *Server) ping(ctx context.Context, id string, be backend.System, maxAge time.Duration) error {
+	hc := be.Capabilities().Health
+	if hc == nil {
+		return nil
+	}
+	_, err := cachedRead(s.cache, ctx, id, cacheHealth, maxAge, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, hc.Ping(ctx)
+	})
+	return err
+}
+
+// setUp records the outcome of the last health check of a system.
+func (s *Server) setUp(id string, up bool) {
+	s.mu.Lock()
+	s.up[id] = up
+	s.mu.Unlock()
+}
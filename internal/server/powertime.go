@@ -0,0 +1,63 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// powerTime is when a system was last reset and how long it has been on.
+// Time on is counted from when the system is seen on, with the monotonic
+// clock, so wall clock jumps do not distort it; time the shim was not
+// running is not counted.
+type powerTime struct {
+	lastReset time.Time
+	// on is the time on accumulated up to onSince, which is set while
+	// the system is on.
+	on      time.Duration
+	onSince time.Time
+}
+
+// total returns the time on up to now.
+func (p powerTime) total(now time.Time) time.Duration {
+	if p.onSince.IsZero() {
+		return p.on
+	}
+	// Negative only if the clock went backwards between runs.
+	return p.on + max(now.Sub(p.onSince), 0)
+}
+
+// countPowerTime starts or stops counting the time on of a system that is
+// now on or off. Callers hold s.mu.
+func (s *Server) countPowerTime(id string, on bool) {
+	p := s.powerTimes[id]
+	now := s.clock.Now()
+	switch {
+	case on && p.onSince.IsZero():
+		p.onSince = now
+	case !on && !p.onSince.IsZero():
+		p.on, p.onSince = p.total(now), time.Time{}
+	default:
+		return
+	}
+	s.powerTimes[id] = p
+}
+
+// recordReset sets the LastResetTime of a system to now and persists it
+// along with the time on.
+func (s *Server) recordReset(id string) {
+	s.mu.Lock()
+	p := s.powerTimes[id]
+	p.lastReset = s.clock.Now()
+	s.powerTimes[id] = p
+	s.mu.Unlock()
+	if err := s.saveState(); err != nil {
+		log.Printf("system %s: save state: %v", id, err)
+	}
+}
+
+// powerTimeOf returns the power-on accounting of a system.
+func (s *Server) powerTimeOf(id string) powerTime {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.powerTimes[id]
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// powerTimeServer returns a server of system 1 on be, timed by c and
+// keeping its state in stateFile.
+func powerTimeServer(t *testing.T, be backend.Backend, c clock, stateFile string) http.Handler {
+	t.Helper()
+	s := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}, StateFile: stateFile})
+	s.clock = c
+	if err := s.LoadState(); err != nil {
+		t.Fatal(err)
+	}
+	return s.Handler()
+}
+
+// powerTimes returns the LastResetTime and Oem PowerOnHours of system 1.
+func powerTimes(t *testing.T, h http.Handler) (lastReset string, hours float64) {
+	t.Helper()
+	_, sys := getJSON(t, h, "/redfish/v1/Systems/1")
+	lastReset, _ = sys["LastResetTime"].(string)
+	oem, _ := sys["Oem"].(map[string]any)
+	shim, _ := oem["BmcShim"].(map[string]any)
+	hours, _ = shim["PowerOnHours"].(float64)
+	return lastReset, hours
+}
+
+func TestPowerTimes(t *testing.T) {
+	c := newFakeClock()
+	t0 := c.Now()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	be := &gatedBackend{}
+	h := powerTimeServer(t, be, c, stateFile)
+	expect := func(h http.Handler, step string, lastReset time.Time, hours float64) {
+		t.Helper()
+		gotReset, gotHours := powerTimes(t, h)
+		if want := lastReset.Format(time.RFC3339); gotReset != want || gotHours != hours {
+			t.Errorf("%s: LastResetTime %s, PowerOnHours %v; want %s, %v", step, gotReset, gotHours, want, hours)
+		}
+	}
+
+	if rec := resetRequest(h, "On"); rec.Code != http.StatusNoContent {
+		t.Fatalf("On = %d", rec.Code)
+	}
+	c.advance(90 * time.Minute)
+	expect(h, "on for 90 minutes", t0, 1.5)
+
+	resetRequest(h, "ForceOff")
+	c.advance(time.Hour)
+	expect(h, "off for an hour", t0.Add(90*time.Minute), 1.5)
+
+	resetRequest(h, "On")
+	on := c.Now()
+	// The clock jumps back while the system is on: no time is counted
+	// until it has caught up.
+	c.advance(-30 * time.Minute)
+	expect(h, "clock jumped back", on, 1.5)
+	c.advance(time.Hour)
+	expect(h, "clock caught up", on, 2)
+
+	// A restart resumes from the time on and reset persisted with the
+	// last reset, counting the system on again from when it is seen.
+	c.advance(time.Hour)
+	h = powerTimeServer(t, be, c, stateFile)
+	expect(h, "restarted", on, 1.5)
+	c.advance(30 * time.Minute)
+	expect(h, "on after the restart", on, 2)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ParseURLPrefix validates a path prefix the service is mounted under
+// behind a reverse proxy, e.g. "/bmc/node3", and returns it cleaned and
+// without a trailing slash ("" for none).
+func ParseURLPrefix(v string) (string, error) {
+	if v == "" || v == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(v, "/") || strings.ContainsAny(v, "?#%\\") {
+		return "", fmt.Errorf("URL prefix %q: expected an absolute path such as /bmc/node3", v)
+	}
+	p := path.Clean(v)
+	if p == "/" {
+		return "", nil
+	}
+	return p, nil
+}
+
+// urlPrefix returns the prefix links are served with: X-Forwarded-Prefix
+// from a trusted proxy, or Config.URLPrefix.
+func (s *Server) urlPrefix(r *http.Request) string {
+	if v := r.Header.Get("X-Forwarded-Prefix"); v != "" && s.trusted(remoteHost(r.RemoteAddr)) {
+		if p, err := ParseURLPrefix(v); err == nil {
+			return p
+		}
+	}
+	return s.cfg.URLPrefix
+}
+
+// prefixWriter marks a response whose links get a URL prefix.
+type prefixWriter struct {
+	http.ResponseWriter
+	prefix string
+}
+
+func (p *prefixWriter) Unwrap() http.ResponseWriter { return p.ResponseWriter }
+
+func (p *prefixWriter) WriteHeader(code int) {
+	if loc := p.Header().Get("Location"); isLink(loc) {
+		p.Header().Set("Location", p.prefix+loc)
+	}
+	p.ResponseWriter.WriteHeader(code)
+}
+
+// stripPrefix returns r with prefix stripped from its path, or r itself if
+// its path lacks the prefix.
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if prefix == "" || !ok || (rest != "" && rest[0] != '/') {
+		return r
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = rest
+	r2.URL.RawPath = ""
+	if raw, ok := strings.CutPrefix(r.URL.RawPath, prefix); ok {
+		r2.URL.RawPath = raw
+	}
+	return r2
+}
+
+// unprefixed returns r as prefixMiddleware passes it on, for the
+// middlewares before it that look at the path, e.g. to redact secrets.
+func (s *Server) unprefixed(r *http.Request) *http.Request {
+	return stripPrefix(r, s.urlPrefix(r))
+}
+
+// prefixMiddleware serves the service under a URL prefix: the prefix is
+// stripped from request paths, so routing, public paths and scopes see
+// the paths they always do, and added to the links of the responses.
+// Requests without the prefix, e.g. from a proxy that strips it, are
+// served as they are.
+func (s *Server) prefixMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := s.urlPrefix(r)
+		if prefix == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&prefixWriter{ResponseWriter: w, prefix: prefix}, stripPrefix(r, prefix))
+	})
+}
+
+// isLink reports whether v is a link into the service.
+func isLink(v string) bool {
+	return v == "/redfish" || strings.HasPrefix(v, "/redfish/")
+}
+
+// prefixLinks adds the URL prefix of the response, if any, to the links in
+// a rendered JSON body. Bodies it cannot parse are returned as they are.
+func prefixLinks(w http.ResponseWriter, b []byte) []byte {
+	pw, ok := wrappedWriter[*prefixWriter](w)
+	if !ok {
+		return b
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return b
+	}
+	out, err := json.Marshal(prefixValue(v, pw.prefix))
+	if err != nil {
+		log.Printf("url prefix: re-encoding response: %v", err)
+		return b
+	}
+	return out
+}
+
+func prefixValue(v any, prefix string) any {
+	switch v := v.(type) {
+	case string:
+		if isLink(v) {
+			return prefix + v
+		}
+	case map[string]any:
+		for k, e := range v {
+			v[k] = prefixValue(e, prefix)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = prefixValue(e, prefix)
+		}
+	}
+	return v
+}
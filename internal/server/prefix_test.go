@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// TestURLPrefixLinks checks routing and the links of responses with and
+// without a URL prefix, configured or forwarded by a proxy, and reached
+// with or without the prefix in the path.
+func TestURLPrefixLinks(t *testing.T) {
+	// httptest requests come from 192.0.2.1.
+	proxy := []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}
+	tests := []struct {
+		name      string
+		cfg       Config
+		forwarded string
+		// path is the prefix the request path carries, want the one of
+		// the links.
+		path, want string
+	}{
+		{"no prefix", Config{}, "", "", ""},
+		{"configured", Config{URLPrefix: "/bmc/node3"}, "", "/bmc/node3", "/bmc/node3"},
+		{"configured, stripped by the proxy", Config{URLPrefix: "/bmc/node3"}, "", "", "/bmc/node3"},
+		{"forwarded", Config{TrustedProxies: proxy}, "/bmc/node4/", "/bmc/node4", "/bmc/node4"},
+		{"forwarded over configured", Config{URLPrefix: "/bmc/node3", TrustedProxies: proxy}, "/bmc/node4", "/bmc/node4", "/bmc/node4"},
+		{"forwarded by an untrusted client", Config{}, "/bmc/node4", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Systems = map[string]backend.System{"1": backend.NewNoop()}
+			h := New(tt.cfg).Handler()
+			do := func(method, path, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, tt.path+path, strings.NewReader(body))
+				if tt.forwarded != "" {
+					req.Header.Set("X-Forwarded-Prefix", tt.forwarded)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				return rec
+			}
+			get := func(path string) map[string]any {
+				rec := do(http.MethodGet, path, "")
+				if rec.Code != http.StatusOK {
+					t.Fatalf("GET %s%s = %d", tt.path, path, rec.Code)
+				}
+				var body map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("GET %s%s: %v", tt.path, path, err)
+				}
+				return body
+			}
+
+			root := get("/redfish/v1/")
+			if got := root["Systems"].(map[string]any)["@odata.id"]; got != tt.want+"/redfish/v1/Systems" {
+				t.Errorf("service root Systems = %v", got)
+			}
+			systems := get("/redfish/v1/Systems")
+			if got := systems["@odata.id"]; got != tt.want+"/redfish/v1/Systems" {
+				t.Errorf("collection @odata.id = %v", got)
+			}
+			if got := systems["Members"].([]any)[0].(map[string]any)["@odata.id"]; got != tt.want+"/redfish/v1/Systems/1" {
+				t.Errorf("member = %v", got)
+			}
+			system := get("/redfish/v1/Systems/1")
+			reset := system["Actions"].(map[string]any)["#ComputerSystem.Reset"].(map[string]any)
+			if got := reset["target"]; got != tt.want+"/redfish/v1/Systems/1/Actions/ComputerSystem.Reset" {
+				t.Errorf("reset target = %v", got)
+			}
+			if rec := do(http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", `{"ResetType":"On"}`); rec.Code != http.StatusNoContent {
+				t.Errorf("POST to the reset target = %d", rec.Code)
+			}
+			if tt.want == "" {
+				if rec := do(http.MethodGet, "/bmc/node3/redfish/v1/", ""); rec.Code != http.StatusNotFound {
+					t.Errorf("GET under a prefix not in use = %d, want 404", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestURLPrefixLocation(t *testing.T) {
+	s := New(Config{URLPrefix: "/bmc/node3"})
+	h := s.prefixMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	for path, want := range map[string]string{
+		"/bmc/node3/redfish/v1/TaskService/Tasks/1": "/bmc/node3/redfish/v1/TaskService/Tasks/1",
+		"/redfish/v1/TaskService/Tasks/1":           "/bmc/node3/redfish/v1/TaskService/Tasks/1",
+		"/bmc/node3/ui":                             "/ui",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := rec.Header().Get("Location"); got != want {
+			t.Errorf("Location for %s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAdvertisedLocation(t *testing.T) {
+	tests := []struct {
+		external, prefix, want string
+	}{
+		{"", "/bmc/node3", ""},
+		{"https://bmc.example.com", "", "https://bmc.example.com/redfish/v1/"},
+		{"https://bmc.example.com", "/bmc/node3", "https://bmc.example.com/bmc/node3/redfish/v1/"},
+		{"https://bmc.example.com/node3", "/bmc/node3", "https://bmc.example.com/node3/redfish/v1/"},
+		{"http://[2001:db8::10]:8080", "", "http://[2001:db8::10]:8080/redfish/v1/"},
+	}
+	for _, tt := range tests {
+		s := New(Config{ExternalURL: tt.external, URLPrefix: tt.prefix})
+		if got := s.advertisedLocation(); got != tt.want {
+			t.Errorf("ExternalURL %q, URLPrefix %q: announced %q, want %q", tt.external, tt.prefix, got, tt.want)
+		}
+	}
+}
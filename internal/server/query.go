@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// paging holds the $top/$skip query parameters of a collection request.
+// top is -1 when no limit was requested.
+type paging struct {
+	top, skip int
+}
+
+// parsePaging parses $top and $skip. On invalid values it writes the error
+// response and returns false.
+func parsePaging(w http.ResponseWriter, r *http.Request) (paging, bool) {
+	p := paging{top: -1}
+	q := r.URL.Query()
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"$top", &p.top}, {"$skip", &p.skip}} {
+		if !q.Has(param.name) {
+			continue
+		}
+		v := q.Get(param.name)
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, msgQueryParameterValueTypeError(v, param.name))
+			return p, false
+		}
+		if n < 0 {
+			writeError(w, http.StatusBadRequest, msgQueryParameterOutOfRange(v, param.name, ">= 0"))
+			return p, false
+		}
+		*param.dst = n
+	}
+	return p, true
+}
+
+// page returns the window of ids selected by p and the $skip of the next
+// page, or -1 if no members remain.
+func (p paging) page(ids []string) ([]string, int) {
+	if p.skip >= len(ids) {
+		return nil, -1
+	}
+	ids = ids[p.skip:]
+	if p.top < 0 || p.top >= len(ids) {
+		return ids, -1
+	}
+	return ids[:p.top], p.skip + p.top
+}
+
+// wantsExpand reports whether $expand asks for subordinate resources to be
+// inlined ("." or "*", with or without $levels). Other expand forms are not
+// supported and are ignored, as the spec allows.
+func wantsExpand(r *http.Request) bool {
+	v := r.URL.Query().Get("$expand")
+	if i := strings.IndexByte(v, '('); i >= 0 {
+		v = v[:i]
+	}
+	return v == "." || v == "*"
+}
+
+// selection is the set of top-level properties named by $select, or nil
+// when the request has none and every property is wanted.
+type selection map[string]bool
+
+// parseSelect parses $select. A path into a complex property such as
+// "Boot/BootSourceOverrideTarget" selects the whole top-level property.
+// Names the resource does not have are ignored, as the spec allows.
+func parseSelect(r *http.Request) selection {
+	q := r.URL.Query()
+	if !q.Has("$select") {
+		return nil
+	}
+	sel := selection{}
+	for _, p := range strings.Split(q.Get("$select"), ",") {
+		p, _, _ = strings.Cut(strings.TrimSpace(p), "/")
+		if p != "" {
+			sel[p] = true
+		}
+	}
+	return sel
+}
+
+// has reports whether prop is selected.
+func (sel selection) has(prop string) bool {
+	return sel == nil || sel[prop]
+}
+
+// project reduces the JSON of v to the selected properties and their
+// annotations, keeping the @odata ones the spec requires.
+func (sel selection) project(v any) (any, error) {
+	if sel == nil {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k := range m {
+		prop, _, _ := strings.Cut(k, "@")
+		if !strings.HasPrefix(k, "@odata.") && !sel[prop] {
+			delete(m, k)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// countingBackend is a Backend with a name, Oem details and power metrics
+// counting the calls of each query.
+type countingBackend struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingBackend) count(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	c.calls[call]++
+}
+
+func (c *countingBackend) PowerOn(ctx context.Context) error  { return nil }
+func (c *countingBackend) PowerOff(ctx context.Context) error { return nil }
+
+func (c *countingBackend) CurrentState(ctx context.Context) (bool, error) {
+	c.count("CurrentState")
+	return true, nil
+}
+
+func (c *countingBackend) DisplayName(ctx context.Context) (string, error) {
+	c.count("DisplayName")
+	return "rack1-node1", nil
+}
+
+func (c *countingBackend) Oem(ctx context.Context) (map[string]any, error) {
+	c.count("Oem")
+	return map[string]any{"Entity": "switch.node1"}, nil
+}
+
+func (c *countingBackend) PowerMetrics(ctx context.Context) (backend.PowerMetrics, error) {
+	c.count("PowerMetrics")
+	w := 42.0
+	return backend.PowerMetrics{Watts: &w}, nil
+}
+
+// TestSelectSkipsBackendCalls checks that a System GET with $select
+// returns the selected properties and the @odata ones, and only makes the
+// backend calls they need.
+func TestSelectSkipsBackendCalls(t *testing.T) {
+	tests := []struct {
+		sel string
+		// props are the properties returned besides @odata.*.
+		props []string
+		calls map[string]int
+	}{
+		{"PowerState", []string{"PowerState"}, map[string]int{"CurrentState": 1}},
+		{"Name,Id", []string{"Id", "Name"}, map[string]int{"DisplayName": 1}},
+		{"Boot/BootSourceOverrideTarget", []string{"Boot"}, map[string]int{}},
+		{"Oem", []string{"Oem"}, map[string]int{"CurrentState": 1, "Oem": 1, "PowerMetrics": 1}},
+		// Names the resource lacks are ignored.
+		{"Bogus,PowerState", []string{"PowerState"}, map[string]int{"CurrentState": 1}},
+		{"Bogus", nil, map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sel, func(t *testing.T) {
+			be := &countingBackend{}
+			h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+			code, body := getJSON(t, h, "/redfish/v1/Systems/1?$select="+url.QueryEscape(tt.sel))
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			var props []string
+			for k := range body {
+				if k[0] != '@' {
+					props = append(props, k)
+				}
+			}
+			slices.Sort(props)
+			if !slices.Equal(props, tt.props) {
+				t.Errorf("properties = %v, want %v", props, tt.props)
+			}
+			if body["@odata.id"] != "/redfish/v1/Systems/1" || body["@odata.type"] == nil {
+				t.Errorf("@odata properties missing: %v", body)
+			}
+			if !maps.Equal(be.calls, tt.calls) {
+				t.Errorf("backend calls = %v, want %v", be.calls, tt.calls)
+			}
+		})
+	}
+
+	be := &countingBackend{}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+	_, body := getJSON(t, h, "/redfish/v1/Systems/1")
+	if body["Name"] != "rack1-node1" || body["PowerState"] != "On" {
+		t.Errorf("without $select: Name %v, PowerState %v", body["Name"], body["PowerState"])
+	}
+	for _, call := range []string{"CurrentState", "DisplayName", "Oem", "PowerMetrics"} {
+		if be.calls[call] == 0 {
+			t.Errorf("without $select %s was not called", call)
+		}
+	}
+}
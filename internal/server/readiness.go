@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Readiness policies of Config.ReadyPolicy.
+const (
+	// ReadyCritical is ready when every critical system passes its
+	// health check, ignoring the others, or like ReadyAny if no system
+	// is critical.
+	ReadyCritical = "critical"
+	// ReadyAny is ready when any system passes its health check.
+	ReadyAny = "any"
+	// ReadyAll is ready when every system passes its health check.
+	ReadyAll = "all"
+)
+
+// ReadyPolicies lists the valid values of Config.ReadyPolicy.
+var ReadyPolicies = []string{ReadyCritical, ReadyAny, ReadyAll}
+
+// ParseReadyPolicy validates a readiness policy.
+func ParseReadyPolicy(v string) (string, error) {
+	if !slices.Contains(ReadyPolicies, v) {
+		return "", fmt.Errorf("invalid readiness policy %q (expected %s)", v, strings.Join(ReadyPolicies, ", "))
+	}
+	return v, nil
+}
+
+// readiness decides whether the shim is ready from the health check
+// errors of the systems ids, and returns the status reported by /readyz.
+func (s *Server) readiness(ids []string, errs []error) (bool, string) {
+	policy := s.cfg.ReadyPolicy
+	var critical []int
+	for i, id := range ids {
+		if s.systemInfo(id).Critical {
+			critical = append(critical, i)
+		}
+	}
+	if policy == "" || policy == ReadyCritical {
+		policy = ReadyAny
+		if len(critical) > 0 {
+			policy = ReadyCritical
+		}
+	}
+	switch policy {
+	case ReadyCritical:
+		var failed []string
+		for _, i := range critical {
+			if errs[i] != nil {
+				failed = append(failed, ids[i])
+			}
+		}
+		if len(failed) > 0 {
+			return false, "critical systems failed: " + strings.Join(failed, ", ")
+		}
+	case ReadyAll:
+		failed := 0
+		for _, err := range errs {
+			if err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return false, fmt.Sprintf("%d of %d backends failed", failed, len(ids))
+		}
+	default:
+		success, warming := false, true
+		for _, err := range errs {
+			success = success || err == nil
+			warming = warming && errors.Is(err, errNotConnected)
+		}
+		switch {
+		case !success && warming:
+			return false, "no backend connected yet"
+		case !success:
+			return false, "all backends failed"
+		}
+	}
+	return true, "ok"
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// readOnlyRetryAfter is the Retry-After (seconds) sent while read-only.
+const readOnlyRetryAfter = 60
+
+// errReadOnly is returned by actions attempted in read-only mode.
+var errReadOnly = errors.New("service is in read-only mode")
+
+// ReadOnly reports whether the service is in read-only (maintenance) mode.
+func (s *Server) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// SetReadOnly switches read-only mode. It waits for in-flight power
+// actions, so once it returns no action runs in the old mode.
+func (s *Server) SetReadOnly(on bool) {
+	s.actionMu.Lock()
+	prev := s.readOnly.Swap(on)
+	s.actionMu.Unlock()
+	if prev != on {
+		log.Printf("read-only mode %s", map[bool]string{true: "enabled", false: "disabled"}[on])
+	}
+}
+
+// readOnlyMiddleware rejects every modifying request while read-only.
+func (s *Server) readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if s.ReadOnly() {
+				writeReadOnly(w)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeReadOnly(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(readOnlyRetryAfter))
+	writeError(w, http.StatusServiceUnavailable, msgServiceTemporarilyUnavailable(strconv.Itoa(readOnlyRetryAfter)))
+}
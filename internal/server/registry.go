@@ -0,0 +1,233 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The service's messages come from version 1.0.0 of the DMTF Base message
+// registry; their MessageIds are "Base.1.0.<Id>".
+const (
+	baseRegistry        = "Base.1.0"
+	baseRegistryVersion = "1.0.0"
+)
+
+// registryMessage is the definition of a message in a message registry.
+type registryMessage struct {
+	Description  string
+	Message      string
+	Severity     string
+	NumberOfArgs int
+	ParamTypes   []string `json:",omitempty"`
+	Resolution   string
+}
+
+// baseMessages is the subset of the Base registry the service references.
+var baseMessages = map[string]registryMessage{
+	"Success": {
+		Description: "Indicates that all conditions of a successful operation have been met.",
+		Message:     "Successfully Completed Request",
+		Severity:    "OK",
+		Resolution:  "None",
+	},
+	"GeneralError": {
+		Description: "Indicates that a general error has occurred.",
+		Message:     "A general error has occurred. See ExtendedInfo for more information.",
+		Severity:    "Critical",
+		Resolution:  "See ExtendedInfo for more information.",
+	},
+	"PropertyMissing": {
+		Description:  "Indicates that a required property was not supplied as part of the request.",
+		Message:      "The property %1 is a required property and must be included in the request.",
+		Severity:     "Warning",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "Ensure that the property is in the request body and has a valid value and resubmit the request if the operation failed.",
+	},
+	"MalformedJSON": {
+		Description: "Indicates that the request body was malformed JSON. Could be duplicate, syntax error,etc.",
+		Message:     "The request body submitted was malformed JSON and could not be parsed by the receiving service.",
+		Severity:    "Critical",
+		Resolution:  "Ensure that the request body is valid JSON and resubmit the request.",
+	},
+	"PropertyUnknown": {
+		Description:  "Indicates that an unknown property was included in the request body.",
+		Message:      "The property %1 is not in the list of valid properties for the resource.",
+		Severity:     "Warning",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "Remove the unknown property from the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyNotWritable": {
+		Description:  "Indicates that a property was given a value in the request body, but the property is a readonly property.",
+		Message:      "The property %1 is a read only property and cannot be assigned a value.",
+		Severity:     "Warning",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "Remove the property from the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyValueTypeError": {
+		Description:  "Indicates that a property was given the wrong value type, such as when a number is supplied for a property that requires a string.",
+		Message:      "The value %1 for the property %2 is of a different type than the property can accept.",
+		Severity:     "Warning",
+		NumberOfArgs: 2,
+		ParamTypes:   []string{"string", "string"},
+		Resolution:   "Correct the value for the property in the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyValueFormatError": {
+		Description:  "Indicates that a property was given the correct value type but the value of that property was not supported. This includes value size/length exceeded.",
+		Message:      "The value %1 for the property %2 is of a different format than the property can accept.",
+		Severity:     "Warning",
+		NumberOfArgs: 2,
+		ParamTypes:   []string{"string", "string"},
+		Resolution:   "Correct the value for the property in the request body and resubmit the request if the operation failed.",
+	},
+	"PropertyValueNotInList": {
+		Description:  "Indicates that a property was given the correct value type but the value of that property was not supported. This values not in an enumeration",
+		Message:      "The value %1 for the property %2 is not in the list of acceptable values.",
+		Severity:     "Warning",
+		NumberOfArgs: 2,
+		ParamTypes:   []string{"string", "string"},
+		Resolution:   "Choose a value from the enumeration list that the implementation can support and resubmit the request if the operation failed.",
+	},
+	"ActionNotSupported": {
+		Description:  "Indicates that the action supplied with the POST operation is not supported by the resource.",
+		Message:      "The action %1 is not supported by the resource.",
+		Severity:     "Critical",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "The action supplied cannot be resubmitted to the implementation.  Perhaps the action was invalid, the wrong resource was the target or the implementation documentation may be of assistance.",
+	},
+	"ActionParameterValueFormatError": {
+		Description:  "Indicates that the correct value type was supplied for the action parameter, but the value is not supported, such as a value outside of an enumeration.",
+		Message:      "The value %1 for the parameter %2 in the action %3 is of a different format than the parameter can accept.",
+		Severity:     "Warning",
+		NumberOfArgs: 3,
+		ParamTypes:   []string{"string", "string", "string"},
+		Resolution:   "Correct the value for the parameter in the request body and resubmit the request if the operation failed.",
+	},
+	"ActionParameterNotSupported": {
+		Description:  "Indicates that the parameter supplied for the action is not supported on the resource.",
+		Message:      "The parameter %1 for the action %2 is not supported on the target resource.",
+		Severity:     "Warning",
+		NumberOfArgs: 2,
+		ParamTypes:   []string{"string", "string"},
+		Resolution:   "Remove the parameter supplied and resubmit the request if the operation failed.",
+	},
+	"ActionParameterMissing": {
+		Description:  "Indicates that the action requested was missing a parameter that is required to process the action.",
+		Message:      "The action %1 requires the parameter %2 to be present in the request body.",
+		Severity:     "Critical",
+		NumberOfArgs: 2,
+		ParamTypes:   []string{"string", "string"},
+		Resolution:   "Supply the action with the required parameter in the request body when the request is resubmitted.",
+	},
+	"QueryParameterValueTypeError": {
+		Description:  "Indicates that a query parameter was given the wrong value type, such as when a number is supplied for a query parameter that requires a string.",
+		Message:      "The value %1 for the query parameter %2 is of a different type than the parameter can accept.",
+		Severity:     "Warning",
+		NumberOfArgs: 2,
+		ParamTypes:   []string{"string", "string"},
+		Resolution:   "Correct the value for the query parameter in the request and resubmit the request if the operation failed.",
+	},
+	"QueryParameterOutOfRange": {
+		Description:  "Indicates that a query parameter was supplied that is out of range for the given resource. This can happen with values that are too low or beyond that possible for the supplied resource, such as when a page is requested that is beyond the last page.",
+		Message:      "The value %1 for the query parameter %2 is out of range %3.",
+		Severity:     "Warning",
+		NumberOfArgs: 3,
+		ParamTypes:   []string{"string", "string", "string"},
+		Resolution:   "Reduce the value for the query parameter to a value that is within range, such as a start or count value that is within bounds of the number of resources in a collection or a page that is within the range of valid pages.",
+	},
+	"ResourceMissingAtURI": {
+		Description:  "Indicates that the operation expected an image or other resource at the provided URI but none was found.  Examples of this are in requests that require URIs like Firmware Update.",
+		Message:      "The resource at the URI %1 was not found.",
+		Severity:     "Critical",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "Place a valid resource at the URI or correct the URI and resubmit the request.",
+	},
+	"NoValidSession": {
+		Description: "Indicates that the operation failed because a valid session is required in order to access any resources.",
+		Message:     "There is no valid session established with the implementation.",
+		Severity:    "Critical",
+		Resolution:  "Establish as session before attempting any operations.",
+	},
+	"AccessDenied": {
+		Description:  "Indicates that while attempting to access, connect to or transfer to/from another resource, the service denied access.",
+		Message:      "While attempting to establish a connection to %1, the service denied access.",
+		Severity:     "Critical",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "Attempt to ensure that the URI is correct and that the service has the appropriate credentials.",
+	},
+	"InsufficientPrivilege": {
+		Description: "Indicates that the credentials associated with the established session do not have sufficient privileges for the requested operation.",
+		Message:     "There are insufficient privileges for the account or credentials associated with the current session to perform the requested operation.",
+		Severity:    "Critical",
+		Resolution:  "Either abandon the operation or change the associated access rights and resubmit the request if the operation failed.",
+	},
+	"ServiceTemporarilyUnavailable": {
+		Description:  "Indicates the service is temporarily unavailable.",
+		Message:      "The service is temporarily unavailable.  Retry in %1 seconds.",
+		Severity:     "Critical",
+		NumberOfArgs: 1,
+		ParamTypes:   []string{"string"},
+		Resolution:   "Wait for the indicated retry duration and retry the operation.",
+	},
+	"InternalError": {
+		Description: "Indicates that the request failed for an unknown internal error but that the service is still operational.",
+		Message:     "The request failed due to an internal service error.  The service is still operational.",
+		Severity:    "Critical",
+		Resolution:  "Resubmit the request.  If the problem persists, consider resetting the service.",
+	},
+}
+
+func (s *Server) handleRegistries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type":         "#MessageRegistryFileCollection.MessageRegistryFileCollection",
+		"@odata.id":           "/redfish/v1/Registries",
+		"Name":                "Registry File Collection",
+		"Members":             []map[string]string{{"@odata.id": "/redfish/v1/Registries/Base"}},
+		"Members@odata.count": 1,
+	})
+}
+
+func (s *Server) handleRegistry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	base := "/redfish/v1/Registries/Base"
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case base:
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type": "#MessageRegistryFile.v1_0_0.MessageRegistryFile",
+			"@odata.id":   base,
+			"Id":          "Base",
+			"Name":        "Base Message Registry File",
+			"Registry":    baseRegistry,
+			"Languages":   []string{"en"},
+			"Location": []map[string]string{
+				{"Language": "en", "Uri": base + "/Base"},
+			},
+		})
+	case base + "/Base":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":     "#MessageRegistry.v1_0_0.MessageRegistry",
+			"Id":              "Base." + baseRegistryVersion,
+			"Name":            "Base Message Registry",
+			"Language":        "en",
+			"Description":     "The subset of the DMTF Base message registry used by this service.",
+			"RegistryPrefix":  "Base",
+			"RegistryVersion": baseRegistryVersion,
+			"OwningEntity":    "DMTF",
+			"Messages":        baseMessages,
+		})
+	default:
+		writeNotFound(w, r)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// backendResetTypes lists the ResetTypes a backend advertises.
+func backendResetTypes(be backend.System) []string {
+	var types []string
+	for _, t := range be.Capabilities().ResetTypes() {
+		types = append(types, string(t))
+	}
+	return types
+}
+
+// allowableResetTypes lists the ResetTypes advertised for a system: those
+// of the backend after applying SystemInfo.ResetMap. A type mapped to one
+// the backend lacks is not offered.
+func (s *Server) allowableResetTypes(id string, be backend.System) []string {
+	supported := backendResetTypes(be)
+	types := slices.Clone(supported)
+	resetMap := s.systemInfo(id).ResetMap
+	for _, t := range slices.Sorted(maps.Keys(resetMap)) {
+		if target := resetMap[t]; target == ResetDisabled || !slices.Contains(supported, target) {
+			types = slices.DeleteFunc(types, func(v string) bool { return v == t })
+		} else if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// handleResetActionInfo describes the parameters of the Reset action, for
+// clients such as Ansible's redfish modules that look them up there.
+func (s *Server) handleResetActionInfo(w http.ResponseWriter, r *http.Request, id string, be backend.System) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.type": "#ActionInfo.v1_1_2.ActionInfo",
+		"@odata.id":   "/redfish/v1/Systems/" + id + "/ResetActionInfo",
+		"Id":          "ResetActionInfo",
+		"Name":        "Reset Action Info",
+		"Parameters": []map[string]any{{
+			"Name":            "ResetType",
+			"Required":        true,
+			"DataType":        "String",
+			"AllowableValues": s.allowableResetTypes(id, be),
+		}},
+	})
+}
+
+// mappedResetType returns the ResetType to perform for resetType under
+// SystemInfo.ResetMap.
+func (s *Server) mappedResetType(id, resetType string) (string, error) {
+	target, ok := s.systemInfo(id).ResetMap[resetType]
+	switch {
+	case !ok:
+		return resetType, nil
+	case target == ResetDisabled:
+		return "", errUnsupportedResetType
+	}
+	return target, nil
+}
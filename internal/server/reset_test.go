@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// countingSystem is a System that counts the resets it is asked for.
+// Without reportState it cannot report its power state, so the server
+// relies on the last state it set.
+type countingSystem struct {
+	mu          sync.Mutex
+	on          bool
+	reportState bool
+	resets      []backend.ResetType
+}
+
+func (c *countingSystem) Capabilities() backend.Capability {
+	return backend.Capability{
+		Resets: []backend.ResetCapability{
+			{Type: backend.ResetOn},
+			{Type: backend.ResetForceOff},
+			{Type: backend.ResetGracefulShutdown},
+			{Type: backend.ResetForceRestart},
+		},
+		PowerState: c.reportState,
+	}
+}
+
+func (c *countingSystem) Reset(ctx context.Context, t backend.ResetType) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resets = append(c.resets, t)
+	c.on = t == backend.ResetOn || t == backend.ResetForceRestart
+	return nil
+}
+
+func (c *countingSystem) State(ctx context.Context) (backend.PowerState, error) {
+	if !c.reportState {
+		return "", backend.ErrNotSupported
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.on {
+		return backend.PowerStateOn, nil
+	}
+	return backend.PowerStateOff, nil
+}
+
+func (c *countingSystem) calls() []backend.ResetType {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resets
+}
+
+func postReset(t *testing.T, h http.Handler, resetType string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", strings.NewReader(`{"ResetType":"`+resetType+`"}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code/100 != 2 {
+		t.Fatalf("reset %s = %d: %s", resetType, rec.Code, rec.Body)
+	}
+	return rec
+}
+
+func TestResetSkipsCurrentState(t *testing.T) {
+	tests := []struct {
+		name      string
+		on        bool
+		reassert  bool
+		resetType string
+		wantCalls int
+	}{
+		{"on when on", true, false, "On", 0},
+		{"off when off", false, false, "ForceOff", 0},
+		{"graceful shutdown when off", false, false, "GracefulShutdown", 0},
+		{"on when off", false, false, "On", 1},
+		{"off when on", true, false, "ForceOff", 1},
+		{"restart when on", true, false, "ForceRestart", 1},
+		{"on when on, reasserted", true, true, "On", 1},
+		{"off when off, reasserted", false, true, "ForceOff", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &countingSystem{on: tt.on, reportState: true}
+			s := New(Config{
+				Systems:            map[string]backend.System{"1": c},
+				ReassertPowerState: tt.reassert,
+			})
+			rec := postReset(t, s.Handler(), tt.resetType)
+			if got := len(c.calls()); got != tt.wantCalls {
+				t.Errorf("backend resets = %v, want %d", c.calls(), tt.wantCalls)
+			}
+			if noop := strings.Contains(rec.Body.String(), `"NoOperation":true`); noop != (tt.wantCalls == 0) {
+				t.Errorf("NoOperation in the response = %v, want %v: %s", noop, tt.wantCalls == 0, rec.Body)
+			}
+		})
+	}
+}
+
+// TestResetSkipsLastKnownState checks that without a power state from the
+// backend, the state the server last set decides.
+func TestResetSkipsLastKnownState(t *testing.T) {
+	c := &countingSystem{}
+	h := New(Config{Systems: map[string]backend.System{"1": c}}).Handler()
+	for _, resetType := range []string{"On", "On", "ForceOff", "ForceOff", "On"} {
+		postReset(t, h, resetType)
+	}
+	want := []backend.ResetType{backend.ResetOn, backend.ResetForceOff, backend.ResetOn}
+	if got := c.calls(); !slices.Equal(got, want) {
+		t.Errorf("backend resets = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// TestResourceGolden compares the serialized ServiceRoot, Systems
+// collection and ComputerSystem with their golden files in testdata.
+func TestResourceGolden(t *testing.T) {
+	s := newGoldenServer(Config{})
+	h := s.Handler()
+	tests := []struct {
+		path   string
+		golden string
+	}{
+		{"/redfish/v1/", "service_root.json"},
+		{"/redfish/v1/Systems", "systems_collection.json"},
+		{"/redfish/v1/Systems/1", "computer_system.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.SetBasicAuth("admin", "secret")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d, want %d", tt.path, rec.Code, http.StatusOK)
+			}
+			for k, want := range map[string]string{
+				"Content-Type":   "application/json",
+				"Content-Length": strconv.Itoa(rec.Body.Len()),
+				"OData-Version":  "4.0",
+				"Cache-Control":  "no-cache",
+			} {
+				if got := rec.Header().Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+			compareGolden(t, tt.golden, append(normalizeJSON(t, rec.Body.Bytes()), '\n'))
+		})
+	}
+}
+
+func TestWriteJSONEncodingError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, map[string]any{"unencodable": make(chan int)})
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+		t.Errorf("Content-Length = %s, want %s", got, want)
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if body.Error.Code != "Base.1.0.InternalError" {
+		t.Errorf("error code = %q, want Base.1.0.InternalError", body.Error.Code)
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+const schedulesPath = "/admin/schedules"
+
+// scheduleGrace is how late a scheduled reset may still be performed, e.g.
+// after the shim was down at the scheduled time. Later ones are dropped
+// rather than surprise anyone hours later.
+const scheduleGrace = 15 * time.Minute
+
+// maxScheduleAhead is how far ahead a reset may be scheduled.
+const maxScheduleAhead = 30 * 24 * time.Hour
+
+// scheduledReset is a Reset requested for later. A system has at most one;
+// it is attempted once, at At.
+type scheduledReset struct {
+	ResetType string    `json:"resetType"`
+	At        time.Time `json:"at"`
+	By        string    `json:"by"`
+}
+
+// resetSchedule is the Oem parameter of the Reset action that delays it:
+// DelaySeconds from now, or at the RFC 3339 time At.
+type resetSchedule struct {
+	DelaySeconds *int64
+	At           *string
+}
+
+func (rs resetSchedule) requested() bool { return rs.DelaySeconds != nil || rs.At != nil }
+
+// time validates the schedule and returns when the reset is due, at most
+// maxScheduleAhead from now.
+func (rs resetSchedule) time(now time.Time) (time.Time, []message) {
+	const action = "ComputerSystem.Reset"
+	switch {
+	case rs.DelaySeconds != nil && rs.At != nil:
+		return time.Time{}, []message{msgActionParameterNotSupported("Oem/BmcShim/At", action)}
+	case rs.DelaySeconds != nil:
+		// Bounded before the conversion, which would overflow.
+		if *rs.DelaySeconds <= 0 || *rs.DelaySeconds > int64(maxScheduleAhead/time.Second) {
+			return time.Time{}, []message{msgActionParameterValueFormatError(strconv.FormatInt(*rs.DelaySeconds, 10), "Oem/BmcShim/DelaySeconds", action)}
+		}
+		return now.Add(time.Duration(*rs.DelaySeconds) * time.Second), nil
+	}
+	at, err := time.Parse(time.RFC3339, *rs.At)
+	if err != nil || !at.After(now) || at.Sub(now) > maxScheduleAhead {
+		return time.Time{}, []message{msgActionParameterValueFormatError(*rs.At, "Oem/BmcShim/At", action)}
+	}
+	return at, nil
+}
+
+// scheduledResetOem renders a scheduled reset for the Oem block of the
+// System and the Reset response.
+func scheduledResetOem(sr scheduledReset) map[string]any {
+	return map[string]any{
+		"ResetType":   sr.ResetType,
+		"Time":        sr.At.UTC().Format(time.RFC3339),
+		"RequestedBy": sr.By,
+	}
+}
+
+// scheduleReset validates and stores a delayed Reset of a system,
+// replacing the one scheduled before, if any.
+func (s *Server) scheduleReset(w http.ResponseWriter, r *http.Request, id string, be backend.System, resetType string, rs resetSchedule) {
+	mapped, err := s.mappedResetType(id, resetType)
+	if err == nil {
+		_, err = resetCalls(be, mapped)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, msgActionParameterValueFormatError(resetType, "ResetType", "ComputerSystem.Reset"))
+		return
+	}
+	at, msgs := rs.time(time.Now())
+	if len(msgs) > 0 {
+		writeError(w, http.StatusBadRequest, msgs...)
+		return
+	}
+	sr := scheduledReset{ResetType: resetType, At: at, By: initiator(r)}
+	s.mu.Lock()
+	prev, replaced := s.scheduled[id]
+	s.scheduled[id] = sr
+	s.mu.Unlock()
+	if err := s.saveState(); err != nil {
+		log.Printf("schedule reset %s: save state: %v", id, err)
+		// Put back what was scheduled, unless a later request changed it:
+		// a schedule that was not persisted would not survive a restart.
+		s.mu.Lock()
+		if s.scheduled[id] == sr {
+			if replaced {
+				s.scheduled[id] = prev
+			} else {
+				delete(s.scheduled, id)
+			}
+		}
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	msg := fmt.Sprintf("Reset %s scheduled for %s by %s", resetType, at.UTC().Format(time.RFC3339), sr.By)
+	if replaced {
+		msg += fmt.Sprintf(", replacing Reset %s at %s", prev.ResetType, prev.At.UTC().Format(time.RFC3339))
+	}
+	s.recordEvent(id, severityOK, msg)
+	s.recordAction(id, resetType, sr.By, "scheduled", nil)
+	s.wakeScheduler()
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"@Message.ExtendedInfo": []message{msgSuccess()},
+		"Oem": map[string]any{
+			"BmcShim": map[string]any{"ScheduledReset": scheduledResetOem(sr)},
+		},
+	})
+}
+
+// scheduledResetOf returns the scheduled reset of a system, if any.
+func (s *Server) scheduledResetOf(id string) (scheduledReset, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sr, ok := s.scheduled[id]
+	return sr, ok
+}
+
+// cancelScheduledReset drops the scheduled reset of a system, recording
+// why, and reports whether there was one.
+func (s *Server) cancelScheduledReset(id, reason string) bool {
+	s.mu.Lock()
+	sr, ok := s.scheduled[id]
+	delete(s.scheduled, id)
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	s.recordEvent(id, severityOK, fmt.Sprintf("Scheduled Reset %s at %s %s", sr.ResetType, sr.At.UTC().Format(time.RFC3339), reason))
+	if err := s.saveState(); err != nil {
+		log.Printf("system %s: save state: %v", id, err)
+	}
+	return true
+}
+
+// wakeScheduler makes runSchedules look at the schedules again.
+func (s *Server) wakeScheduler() {
+	select {
+	case s.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// runSchedules performs scheduled resets when they are due, until ctx is
+// done.
+func (s *Server) runSchedules(ctx context.Context) {
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.scheduleWake:
+		case <-t.C:
+		}
+		t.Reset(s.startDueResets(ctx))
+	}
+}
+
+// startDueResets starts the scheduled resets that are due and returns how
+// long until the next one. They are removed first, so a reset is never
+// attempted twice, even across a crash.
+func (s *Server) startDueResets(ctx context.Context) time.Duration {
+	now := time.Now()
+	next := time.Hour
+	due := map[string]scheduledReset{}
+	s.mu.Lock()
+	for id, sr := range s.scheduled {
+		if d := sr.At.Sub(now); d > 0 {
+			next = min(next, d)
+			continue
+		}
+		due[id] = sr
+		delete(s.scheduled, id)
+	}
+	s.mu.Unlock()
+	if len(due) == 0 {
+		return next
+	}
+	if err := s.saveState(); err != nil {
+		log.Printf("scheduled resets: save state: %v", err)
+	}
+	for id, sr := range due {
+		s.bg.Go(func() { s.runScheduledReset(ctx, id, sr) })
+	}
+	return next
+}
+
+// runScheduledReset performs a due scheduled reset like one requested
+// through the API, with the same locking and cooldown, and records the
+// outcome in the event log.
+func (s *Server) runScheduledReset(ctx context.Context, id string, sr scheduledReset) {
+	be, ok := s.system(id)
+	if !ok {
+		log.Printf("scheduled reset: system %s no longer exists, dropping Reset %s", id, sr.ResetType)
+		return
+	}
+	what := fmt.Sprintf("Scheduled Reset %s requested by %s", sr.ResetType, sr.By)
+	by := sr.By + " (scheduled)"
+	if late := time.Since(sr.At); late > scheduleGrace {
+		s.recordEvent(id, severityWarning, fmt.Sprintf("%s dropped: overdue by %s", what, late.Round(time.Second)))
+		s.recordAction(id, sr.ResetType, by, "dropped", nil)
+		return
+	}
+	if s.dryRun(id) {
+		calls, err := s.simulatedCalls(id, be, sr.ResetType)
+		if err != nil {
+			s.recordEvent(id, severityWarning, fmt.Sprintf("%s failed: %v", what, err))
+			s.recordAction(id, sr.ResetType, by, "failed", err)
+			return
+		}
+		log.Printf("dry run: system %s: would call %s", id, strings.Join(calls, ", "))
+		s.recordEvent(id, severityOK, fmt.Sprintf("%s simulated (dry run: %s not called)", what, strings.Join(calls, ", ")))
+		s.recordAction(id, sr.ResetType, by, "simulated", nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.resetTimeout())
+	defer cancel()
+	noop, err := s.applyReset(ctx, id, be, sr.ResetType, by)
+	switch {
+	case err != nil:
+		s.recordEvent(id, severityWarning, fmt.Sprintf("%s failed: %v", what, err))
+		s.recordAction(id, sr.ResetType, by, "failed", err)
+	case noop:
+		s.recordEvent(id, severityOK, fmt.Sprintf("%s skipped, already %s", what, s.powerStateCached(id)))
+		s.recordAction(id, sr.ResetType, by, "skipped", nil)
+	default:
+		s.recordEvent(id, severityOK, what+" performed")
+		s.recordAction(id, sr.ResetType, by, "performed", nil)
+	}
+}
+
+// handleSchedules lists the scheduled resets (GET) and cancels them
+// (DELETE), all of them or, below the path, those of one system.
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, schedulesPath), "/")
+	if id != "" {
+		if _, ok := s.system(id); !ok {
+			writeNotFound(w, r)
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		out := map[string]map[string]any{}
+		s.mu.RLock()
+		for sid, sr := range s.scheduled {
+			if id == "" || sid == id {
+				out[sid] = scheduledResetOem(sr)
+			}
+		}
+		s.mu.RUnlock()
+		writeJSON(w, http.StatusOK, out)
+	case http.MethodDelete:
+		ids := []string{id}
+		if id == "" {
+			ids = s.systemIDs()
+		}
+		for _, sid := range ids {
+			s.cancelScheduledReset(sid, "cancelled by "+initiator(r))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+func TestResetScheduleTime(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	delay := func(n int64) *int64 { return &n }
+	at := func(v string) *string { return &v }
+	tests := []struct {
+		name string
+		rs   resetSchedule
+		want time.Time
+		ok   bool
+	}{
+		{"delay", resetSchedule{DelaySeconds: delay(600)}, now.Add(10 * time.Minute), true},
+		{"longest delay", resetSchedule{DelaySeconds: delay(int64(maxScheduleAhead / time.Second))}, now.Add(maxScheduleAhead), true},
+		{"delay too long", resetSchedule{DelaySeconds: delay(int64(maxScheduleAhead/time.Second) + 1)}, time.Time{}, false},
+		{"delay overflowing a Duration", resetSchedule{DelaySeconds: delay(math.MaxInt64)}, time.Time{}, false},
+		{"zero delay", resetSchedule{DelaySeconds: delay(0)}, time.Time{}, false},
+		{"negative delay", resetSchedule{DelaySeconds: delay(-1)}, time.Time{}, false},
+		{"time", resetSchedule{At: at("2026-01-02T00:00:00Z")}, now.Add(24 * time.Hour), true},
+		{"time too far ahead", resetSchedule{At: at("2027-01-01T00:00:00Z")}, time.Time{}, false},
+		{"past time", resetSchedule{At: at("2025-12-31T00:00:00Z")}, time.Time{}, false},
+		{"malformed time", resetSchedule{At: at("tomorrow")}, time.Time{}, false},
+		{"both", resetSchedule{DelaySeconds: delay(600), At: at("2026-01-02T00:00:00Z")}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, msgs := tt.rs.time(now)
+			if ok := len(msgs) == 0; ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("time() = %v, %v, want %v, ok %v", got, msgs, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// TestScheduleResetSaveFailure checks that a schedule that could not be
+// persisted is not kept either.
+func TestScheduleResetSaveFailure(t *testing.T) {
+	s := New(Config{
+		Systems:   map[string]backend.System{"1": backend.NewNoop()},
+		StateFile: filepath.Join(t.TempDir(), "missing", "state.json"),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset",
+		strings.NewReader(`{"ResetType": "ForceOff", "Oem": {"BmcShim": {"DelaySeconds": 600}}}`))
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+	if sr, ok := s.scheduledResetOf("1"); ok {
+		t.Errorf("scheduled reset %+v kept after the state was not saved", sr)
+	}
+}
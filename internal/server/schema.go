@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Schema validation modes of Config.SchemaValidation.
+const (
+	// SchemaStrict rejects request bodies that violate the schema.
+	SchemaStrict = "strict"
+	// SchemaWarn logs the violations and goes on with the request, whose
+	// properties are still checked by the handler.
+	SchemaWarn = "warn"
+	// SchemaOff does not validate request bodies.
+	SchemaOff = "off"
+)
+
+// SchemaValidations lists the valid values of Config.SchemaValidation.
+var SchemaValidations = []string{SchemaStrict, SchemaWarn, SchemaOff}
+
+// ParseSchemaValidation validates a schema validation mode.
+func ParseSchemaValidation(v string) (string, error) {
+	if !slices.Contains(SchemaValidations, v) {
+		return "", fmt.Errorf("invalid schema validation %q (expected %s)", v, strings.Join(SchemaValidations, ", "))
+	}
+	return v, nil
+}
+
+// Schemas the request bodies of resources are validated against.
+const (
+	schemaComputerSystem = "ComputerSystem.v1_13_0"
+	schemaManagerAccount = "ManagerAccount.v1_4_0"
+)
+
+const jsonSchemasPath = "/redfish/v1/JsonSchemas"
+
+//go:embed schemas/*.json
+var embeddedSchemas embed.FS
+
+// jsonSchema is the part of JSON Schema, as used by the Redfish schemas,
+// that request bodies are validated against.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	PatternProperties    map[string]*jsonSchema `json:"patternProperties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	Enum                 []any                  `json:"enum"`
+	ReadOnly             bool                   `json:"readonly"`
+	Pattern              string                 `json:"pattern"`
+	MaxLength            *int                   `json:"maxLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+
+	pattern  *regexp.Regexp
+	patterns map[*regexp.Regexp]*jsonSchema
+}
+
+// schemaTypes is the type keyword, a single type or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+// schemaFile is an embedded schema and its definitions.
+type schemaFile struct {
+	raw  []byte
+	root *jsonSchema
+}
+
+var schemaFiles = embeddedSchemaFiles()
+
+// embeddedSchemaFiles parses the schemas shipped with the binary.
+func embeddedSchemaFiles() map[string]*schemaFile {
+	files, err := fs.Glob(embeddedSchemas, "schemas/*.json")
+	if err != nil {
+		panic(err)
+	}
+	m := map[string]*schemaFile{}
+	for _, f := range files {
+		raw, err := fs.ReadFile(embeddedSchemas, f)
+		if err != nil {
+			panic(err)
+		}
+		var root jsonSchema
+		if err := json.Unmarshal(raw, &root); err != nil {
+			panic(fmt.Sprintf("schema %s: %v", f, err))
+		}
+		if err := root.compile(&root); err != nil {
+			panic(fmt.Sprintf("schema %s: %v", f, err))
+		}
+		m[strings.TrimSuffix(path.Base(f), ".json")] = &schemaFile{raw: raw, root: &root}
+	}
+	return m
+}
+
+// compile resolves the local references of s and compiles its patterns.
+func (s *jsonSchema) compile(root *jsonSchema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/definitions/")
+		if !ok || root.Definitions[name] == nil {
+			return fmt.Errorf("unresolvable $ref %q", s.Ref)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	if len(s.PatternProperties) > 0 {
+		s.patterns = map[*regexp.Regexp]*jsonSchema{}
+	}
+	for p, ps := range s.PatternProperties {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		s.patterns[re] = ps
+	}
+	var subs []*jsonSchema
+	for _, m := range []map[string]*jsonSchema{s.Properties, s.PatternProperties, s.Definitions} {
+		for _, sub := range m {
+			subs = append(subs, sub)
+		}
+	}
+	subs = append(subs, s.Items)
+	subs = append(subs, s.AnyOf...)
+	for _, sub := range subs {
+		if err := sub.compile(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeBody reads the JSON object of a PATCH of a resource of schema and
+// validates it (see validateBody). It answers the request and returns
+// false if the body is malformed or invalid.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, schema string) (map[string]json.RawMessage, bool) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return nil, false
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(b, &body); err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return nil, false
+	}
+	if !s.validateBody(w, r, schema, b) {
+		return nil, false
+	}
+	return body, true
+}
+
+// validateBody checks a request body against schema and, unless schema
+// validation is off, answers 400 with a message per violation, each
+// relating to the offending property by its JSON pointer. It reports
+// whether the handler should go on.
+func (s *Server) validateBody(w http.ResponseWriter, r *http.Request, schema string, body []byte) bool {
+	mode := s.cfg.SchemaValidation
+	if mode == SchemaOff {
+		return true
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return false
+	}
+	f := schemaFiles[schema]
+	var msgs []message
+	f.root.validate(f.root, v, "", &msgs)
+	if len(msgs) == 0 {
+		return true
+	}
+	if mode == SchemaWarn {
+		for _, m := range msgs {
+			log.Printf("%s %s: schema violation ignored: %s", r.Method, r.URL.Path, m.Message)
+		}
+		return true
+	}
+	writeError(w, http.StatusBadRequest, msgs...)
+	return false
+}
+
+// validate checks v, the value of the property at ptr (a JSON pointer
+// without the leading #), against s, appending a message per violation.
+func (s *jsonSchema) validate(root *jsonSchema, v any, ptr string, msgs *[]message) {
+	prop := strings.TrimPrefix(ptr, "/")
+	related := func(m message) message {
+		m.RelatedProperties = []string{"#" + ptr}
+		return m
+	}
+	if s.ReadOnly && ptr != "" {
+		*msgs = append(*msgs, related(msgPropertyNotWritable(prop)))
+		return
+	}
+	if s.Ref != "" {
+		root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")].validate(root, v, ptr, msgs)
+	}
+	if len(s.AnyOf) > 0 {
+		var first []message
+		for i, alt := range s.AnyOf {
+			var am []message
+			alt.validate(root, v, ptr, &am)
+			if len(am) == 0 {
+				first = nil
+				break
+			}
+			if i == 0 {
+				first = am
+			}
+		}
+		*msgs = append(*msgs, first...)
+		if first != nil {
+			return
+		}
+	}
+	if len(s.Type) > 0 && !slices.Contains(s.Type, jsonType(v)) && !(jsonType(v) == "integer" && slices.Contains(s.Type, "number")) {
+		*msgs = append(*msgs, related(msgPropertyValueTypeError(jsonText(v), prop)))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return jsonText(e) == jsonText(v) }) {
+		*msgs = append(*msgs, related(msgPropertyValueNotInList(jsonText(v), prop)))
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		if (s.MaxLength != nil && len([]rune(v)) > *s.MaxLength) || (s.pattern != nil && !s.pattern.MatchString(v)) {
+			*msgs = append(*msgs, related(msgPropertyValueFormatError(v, prop)))
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if (s.Minimum != nil && n < *s.Minimum) || (s.Maximum != nil && n > *s.Maximum) {
+			*msgs = append(*msgs, related(msgPropertyValueFormatError(v.String(), prop)))
+		}
+	case []any:
+		if s.Items != nil {
+			for i, e := range v {
+				s.Items.validate(root, e, ptr+"/"+strconv.Itoa(i), msgs)
+			}
+		}
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			kp := ptr + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+			if ps, ok := s.Properties[k]; ok {
+				ps.validate(root, v[k], kp, msgs)
+				continue
+			}
+			matched := false
+			for re, ps := range s.patterns {
+				if re.MatchString(k) {
+					ps.validate(root, v[k], kp, msgs)
+					matched = true
+					break
+				}
+			}
+			if !matched && s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				m := msgPropertyUnknown(strings.TrimPrefix(kp, "/"))
+				m.RelatedProperties = []string{"#" + kp}
+				*msgs = append(*msgs, m)
+			}
+		}
+	}
+}
+
+// jsonType returns the JSON Schema type of a decoded value.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// jsonText renders a value for a message: strings as they are, other
+// values as JSON.
+func jsonText(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// handleJSONSchemas serves the collection of the embedded schemas, their
+// JsonSchemaFile resources and the schemas themselves.
+func (s *Server) handleJSONSchemas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, jsonSchemasPath), "/")
+	if rest == "" {
+		members := []map[string]string{}
+		for _, name := range sortedKeys(schemaFiles) {
+			members = append(members, map[string]string{"@odata.id": jsonSchemasPath + "/" + name})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":         "#JsonSchemaFileCollection.JsonSchemaFileCollection",
+			"@odata.id":           jsonSchemasPath,
+			"Name":                "JSON Schema File Collection",
+			"Members":             members,
+			"Members@odata.count": len(members),
+		})
+		return
+	}
+	name, file, _ := strings.Cut(rest, "/")
+	f, ok := schemaFiles[name]
+	switch {
+	case !ok:
+		writeNotFound(w, r)
+	case file == "":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type": "#JsonSchemaFile.v1_1_4.JsonSchemaFile",
+			"@odata.id":   jsonSchemasPath + "/" + name,
+			"Id":          name,
+			"Name":        name + " Schema File",
+			"Description": "The subset of the DMTF schema implemented by this service.",
+			"Schema":      "#" + name + "." + strings.SplitN(name, ".", 2)[0],
+			"Languages":   []string{"en"},
+			"Location": []map[string]string{{
+				"Language":       "en",
+				"Uri":            jsonSchemasPath + "/" + name + "/" + name + ".json",
+				"PublicationUri": "http://redfish.dmtf.org/schemas/v1/" + name + ".json",
+			}},
+		})
+	case file == name+".json":
+		w.Header().Set("Content-Type", "application/schema+json")
+		if _, err := w.Write(f.raw); err != nil {
+			log.Printf("error writing response: %v", err)
+		}
+	default:
+		writeNotFound(w, r)
+	}
+}
@@ -1,142 +1,822 @@
 package server
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
-	"github.com/ArthurVardevanyan/bmc-shim/internal/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/acme"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/buildinfo"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/redfish"
 )
 
 type Config struct {
-	Listen   string
+	// Listen are the addresses to serve on, each "http://host:port",
+	// "https://host:port" or a bare "host:port" (HTTP).
+	Listen []string
+	// TLSCert and TLSKey are the PEM files used by https listeners.
+	TLSCert  string
+	TLSKey   string
 	Username string
 	Password string
-	Systems  map[string]backend.Backend
+	Systems  map[string]backend.System
+	// Info holds optional static metadata per system ID.
+	Info map[string]SystemInfo
+	// PreferBackendName makes the backend's DisplayName win over a
+	// configured SystemInfo.Name.
+	PreferBackendName bool
+	// StateFile is where settings written through the API (AssetTag,
+	// HostName, ...) are persisted across restarts. Empty disables it.
+	StateFile string
+	// LogEntries is the per-system event log capacity (default 100).
+	LogEntries int
+	// SSEMaxConnections limits the open SSE event streams (see
+	// DefaultSSEMaxConnections).
+	SSEMaxConnections int
+	// PublicPaths are the exact request paths served without
+	// authentication. Nil means the service root only (see
+	// DefaultPublicPaths); an empty slice makes every Redfish path require
+	// authentication.
+	PublicPaths []string
+	// HealthAuthRemote requires authentication on the health endpoints
+	// for callers other than localhost.
+	HealthAuthRemote bool
+	// TrustedProxies are the reverse proxies whose forwarding headers are
+	// believed when deriving the client IP. Headers from other peers are
+	// ignored.
+	TrustedProxies []netip.Prefix
+	// DebugListen is a separate address serving pprof, expvar and
+	// /debug/state without authentication. Empty disables it.
+	DebugListen string
+	// DebugOnMain mounts the debug endpoints on the main listeners
+	// instead, behind authentication.
+	DebugOnMain bool
+	// PollInterval is how often the power state and health of every
+	// system is refreshed in the background. Zero disables polling.
+	PollInterval time.Duration
+	// Language is the language of responses to clients that do not ask
+	// for an available one with Accept-Language; it defaults to
+	// DefaultLanguage.
+	Language string
+	// LanguageDir holds additional <language>.json catalogs, loaded by
+	// Start.
+	LanguageDir string
+	// StateStability is the power state hysteresis of systems without
+	// their own (SystemInfo.StateStability).
+	StateStability Stability
+	// MetricsLiveState makes /metrics query the backends on every scrape
+	// instead of reporting cached states.
+	MetricsLiveState bool
+	// BackendCalls, if set, counts the backend calls of the systems for
+	// /metrics.
+	BackendCalls *BackendCalls
+	// ServiceUUID is the ServiceRoot UUID. It defaults to the one kept in
+	// the state file or, on first start, a UUID derived from the host
+	// name, which is then kept there.
+	ServiceUUID string
+	// Advertise announces the service via SSDP and mDNS on
+	// AdvertiseInterfaces (default: all multicast-capable interfaces).
+	Advertise           bool
+	AdvertiseInterfaces []string
+	// ExternalURL is the base URL clients reach the service at, e.g.
+	// behind a proxy or NAT; when set it is announced instead of the
+	// listener's address (see ParseExternalURL).
+	ExternalURL string
+	// URLPrefix is the path the service is mounted under behind a reverse
+	// proxy, e.g. "/bmc/node3" (see ParseURLPrefix). It is stripped from
+	// requests and added to every link; X-Forwarded-Prefix from a trusted
+	// proxy overrides it.
+	URLPrefix string
+	// ManagerInterfaces restricts the host interfaces listed as the
+	// manager's EthernetInterfaces (default: all but loopback);
+	// HideManagerInterfaces lists none.
+	ManagerInterfaces     []string
+	HideManagerInterfaces bool
+	// NotifyURLs receive a POST for every power state change, either made
+	// through the API or observed on the backend.
+	NotifyURLs []string
+	// NotifyTemplate, if set, renders the notification body instead of
+	// the default JSON payload. See ParseNotifyTemplate.
+	NotifyTemplate *template.Template
+	// NotifyTimeout bounds a single delivery attempt (default 10s).
+	NotifyTimeout time.Duration
+	// ReassertPowerState calls the backend for On/Off even when the
+	// system already is in the requested state. By default such requests
+	// succeed without a backend call.
+	ReassertPowerState bool
+	// PowerOnStagger and PowerOnConcurrency sequence resets that power
+	// systems on, across all systems: each starts at least
+	// PowerOnStagger after the previous one and at most
+	// PowerOnConcurrency run at once. A reset waits up to PowerOnMaxWait
+	// (default DefaultPowerOnMaxWait) for its turn. Zero disables them;
+	// power-offs are never delayed.
+	PowerOnStagger     time.Duration
+	PowerOnConcurrency int
+	PowerOnMaxWait     time.Duration
+	// ActionCooldown is the minimum interval between power actions on a
+	// system. Zero disables it.
+	ActionCooldown time.Duration
+	// DryRun simulates power actions on every system: they are logged and
+	// recorded but the backends are never called. SystemInfo.DryRun does
+	// the same per system.
+	DryRun bool
+	// ReadOnly starts the service in read-only (maintenance) mode; see
+	// SetReadOnly.
+	ReadOnly bool
+	// Compat is the compatibility profile shaping responses for clients
+	// that expect something other than the spec-correct default
+	// (CompatStrict); see CompatProfiles.
+	Compat string
+	// Profile adapts the service to a particular client beyond what the
+	// responses look like; "" for none, or ProfileMetal3.
+	Profile string
+	// LegacyBootPOST accepts a POST of only a Boot object to a System as
+	// the equivalent PATCH, for clients written against BMCs that
+	// expect it.
+	LegacyBootPOST bool
+	// UI serves an HTML status page at /ui, with power buttons for
+	// operators.
+	UI bool
+	// SystemOverrides are static ComputerSystem properties per system
+	// ID, replacing what the shim reports; see ParseSystemOverrides.
+	SystemOverrides SystemOverrides
+	// HideBackendOem omits backend details (backend.OemProvider and
+	// backend error messages) from Oem.BmcShim, for deployments that
+	// consider them sensitive.
+	HideBackendOem bool
+	// BackendTimeout bounds the backend calls of a power action or PATCH
+	// (default 60s).
+	BackendTimeout time.Duration
+	// UnknownStateActions allows power actions on systems whose backend
+	// reports their power state as unknown; by default they are refused
+	// with 503.
+	UnknownStateActions bool
+	// SchemaValidation decides what happens to request bodies that
+	// violate the Redfish schema of their resource: SchemaStrict
+	// (default) rejects them, SchemaWarn logs them and SchemaOff does not
+	// check them.
+	SchemaValidation string
+	// ReadyPolicy decides which systems /readyz requires to be healthy:
+	// ReadyCritical (default), ReadyAny or ReadyAll.
+	ReadyPolicy string
+	// BackendStartTimeout bounds each attempt to start a backend that
+	// holds connections (default DefaultBackendStartTimeout).
+	BackendStartTimeout time.Duration
+	// CacheTTL is how long backend reads serving GETs are cached; zero
+	// disables caching. CacheMaxStale is how old a cached read may be to
+	// be served instead when the backend fails; zero disables that.
+	CacheTTL      time.Duration
+	CacheMaxStale time.Duration
+	// ReadTimeout, WriteTimeout and IdleTimeout configure the HTTP
+	// server; zero ReadTimeout and IdleTimeout disable them. WriteTimeout
+	// defaults to, and is raised to at least, BackendTimeout plus
+	// writeTimeoutMargin (and PowerOnMaxWait if power-ons are staggered)
+	// so that a slow action can still be answered.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// APIKeys are accepted in addition to basic auth, and APIKeyFile
+	// holds more, one "key [name [role [systems]]]" per line, re-read by
+	// LoadAPIKeys.
+	APIKeys    []APIKey
+	APIKeyFile string
+	// AllowCIDRs, if set, are the only client networks allowed to make
+	// modifying requests, and with AllowCIDRRead any request but the
+	// health probes.
+	AllowCIDRs    []netip.Prefix
+	AllowCIDRRead bool
+	// OIDC, if set, accepts bearer tokens of an OpenID Connect issuer.
+	OIDC *OIDCConfig
+	// AuthMode selects the accepted credentials, one of the AuthMode
+	// constants. Default AuthModeBasic, or AuthModeOIDCBasic with OIDC.
+	AuthMode string
+	// ACME, if set, obtains the https listeners' certificate from an ACME
+	// CA; TLSCert and TLSKey are then only served until one is issued.
+	ACME *acme.Config
+	// MaxHeaderBytes limits the size of request headers (default
+	// http.DefaultMaxHeaderBytes).
+	MaxHeaderBytes int
+	// UsersFile holds basic auth accounts in addition to Username and
+	// Password, one "name password [role [systems]]" per line, re-read by
+	// LoadUsers.
+	UsersFile string
+	// OutOfScopeForbidden answers requests for systems outside a client's
+	// scope with 403 instead of 404, which reveals that they exist.
+	OutOfScopeForbidden bool
+	// CaptureDir, if set, makes the service write every exchange to this
+	// directory for debugging client integrations, until CaptureMaxFiles
+	// (default DefaultCaptureMaxFiles) were written. It can be toggled at
+	// runtime through /admin/capture.
+	CaptureDir      string
+	CaptureMaxFiles int
+	// LogBodyBytes is how much of a JSON request body the access log
+	// shows (see DefaultLogBodyBytes); 0 leaves bodies out.
+	LogBodyBytes int
+	// HistoryFile is where the power history exported by /admin/history
+	// is appended. Empty means StateFile + ".history" with a StateFile,
+	// and an in-memory history otherwise. Records older than
+	// HistoryRetention are dropped at startup and daily; 0 keeps them.
+	HistoryFile      string
+	HistoryRetention time.Duration
+}
+
+// Defaults for the HTTP server and backend timeouts.
+const (
+	DefaultBackendTimeout = 60 * time.Second
+	DefaultReadTimeout    = 15 * time.Second
+	DefaultIdleTimeout    = 60 * time.Second
+	// writeTimeoutMargin is the time left for writing the response after
+	// the backend calls of a request timed out.
+	writeTimeoutMargin = 5 * time.Second
+)
+
+// DefaultPublicPaths are served without authentication unless configured
+// otherwise, so that clients can discover the service.
+var DefaultPublicPaths = []string{"/redfish/v1/", "/redfish/v1"}
+
+// healthPaths are the probe endpoints. They are public unless
+// Config.HealthAuthRemote is set.
+var healthPaths = map[string]bool{"/livez": true, "/readyz": true, "/startupz": true}
+
+// SystemInfo is static, configuration-provided metadata for a system.
+type SystemInfo struct {
+	Name         string
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	// UUID defaults to a stable UUID derived from the system ID.
+	UUID string
+	// EthernetInterfaces are the host NICs reported to clients (e.g. for
+	// Ironic inspection), in configuration order.
+	EthernetInterfaces []EthernetInterface
+	// DryRun simulates power actions on this system (see Config.DryRun).
+	DryRun bool
+	// BootDevices are the devices a client may put in Boot.BootOrder, in
+	// their default order.
+	BootDevices []string
+	// ProcessorCount, ProcessorModel, MemoryGiB and Disks are a static
+	// hardware inventory for inspection tools; unset ones are not
+	// reported.
+	ProcessorCount int
+	ProcessorModel string
+	MemoryGiB      float64
+	Disks          []Disk
+	// ResetMap overrides how ResetTypes are carried out: each maps to
+	// another ResetType performed instead, or to ResetDisabled to stop
+	// offering it.
+	ResetMap map[string]string
+	// PostPowerOn, if set, runs after every reset that powers the system
+	// on.
+	PostPowerOn *PostPowerOnHook
+	// Description is an optional description of the system.
+	Description string
+	// StateStability overrides Config.StateStability.
+	StateStability Stability
+	// Critical systems have to pass their health check for /readyz to
+	// succeed (see Config.ReadyPolicy).
+	Critical bool
+}
+
+// ResetDisabled in SystemInfo.ResetMap withdraws a ResetType.
+const ResetDisabled = "none"
+
+// EthernetInterface is a configured host NIC.
+type EthernetInterface struct {
+	// Name is optional; it defaults to "Ethernet Interface <n>".
+	Name       string
+	MACAddress string
+}
+
+// Disk is a configured host disk.
+type Disk struct {
+	// Name is optional; it defaults to "Disk <n>".
+	Name          string
+	CapacityBytes int64
 }
 
 type Boot struct {
-	BootSourceOverrideTarget  string `json:"BootSourceOverrideTarget"`
-	BootSourceOverrideEnabled string `json:"BootSourceOverrideEnabled"`
-	BootSourceOverrideMode    string `json:"BootSourceOverrideMode,omitempty"`
+	BootSourceOverrideTarget     string   `json:"BootSourceOverrideTarget"`
+	BootSourceOverrideEnabled    string   `json:"BootSourceOverrideEnabled"`
+	BootSourceOverrideMode       string   `json:"BootSourceOverrideMode,omitempty"`
+	UefiTargetBootSourceOverride string   `json:"UefiTargetBootSourceOverride,omitempty"`
+	BootOrder                    []string `json:"BootOrder,omitempty"`
+}
+
+// Asset holds the client-writable identification of a system.
+type Asset struct {
+	AssetTag string
+	HostName string
 }
 
 type Server struct {
-	cfg  Config
-	http *http.Server
-	mu   sync.RWMutex
-	last map[string]bool
-	boot map[string]Boot
+	cfg   Config
+	http  *http.Server
+	mu    sync.RWMutex
+	last  map[string]bool
+	boot  map[string]Boot
+	asset map[string]Asset
+	// pendingBoot are boot settings written to the Settings resource of a
+	// system, applied on its next power-on or restart; applied is the
+	// outcome of the last application.
+	pendingBoot map[string]Boot
+	applied     map[string]settingsResult
+	// scheduled are the delayed resets per system; scheduleWake tells
+	// runSchedules that they changed.
+	scheduled    map[string]scheduledReset
+	scheduleWake chan struct{}
+	// up is the outcome of the last health check per system.
+	up map[string]bool
+	// powerTimes are the last reset and time on per system.
+	powerTimes map[string]powerTime
+	// unknownState are the systems whose backend last reported their
+	// power state as unknown.
+	unknownState map[string]bool
+	// lastAction is when the last power action per system started, for
+	// the cooldown.
+	lastAction map[string]time.Time
+	// transitions counts power state changes per system, and lastOrigin
+	// is the origin of the last one.
+	transitions map[string]uint64
+	lastOrigin  map[string]string
+	// stoppedState is the power state per system when the shim last
+	// stopped, from the state file, until the system is first seen.
+	stoppedState map[string]bool
+	// catalogs are the translations by language.
+	catalogs map[string]*catalog
+	// hysteresis is the power state hysteresis per system with a
+	// Stability.
+	hysteresis map[string]*hysteresis
+	// systems is the current set of systems; see SetSystems, which
+	// setSystemsMu serializes.
+	systems      atomic.Pointer[systemSet]
+	setSystemsMu sync.Mutex
+	logSeq       atomic.Uint64
+	// public is the set of paths exempt from authentication.
+	public map[string]bool
+	// actionMu is held shared by power actions and exclusively by a
+	// manager reset, so a reset waits for in-flight actions.
+	actionMu sync.RWMutex
+	// readOnly rejects modifying requests; it is only switched under
+	// actionMu.
+	readOnly atomic.Bool
+	// actions counts the power actions being applied and rejected.
+	actions actionStats
+	// warm tracks the backends that have not started yet.
+	warm warmUp
+	// cache holds the backend reads.
+	cache  *readCache
+	notify *notifier
+	// mux routes the requests; capture, set up by Start if configured,
+	// records them.
+	mux     *http.ServeMux
+	capture *capturer
+	// history is the power history; Start moves it to the history file,
+	// if there is one.
+	history *history
+	// powerOn sequences power-ons; nil if they are not staggered.
+	powerOn *powerOnGate
+	// bgCtx is canceled by stopBg on Shutdown to stop background work
+	// (poller, discovery), which bg tracks.
+	bgCtx  context.Context
+	stopBg context.CancelFunc
+	bg     sync.WaitGroup
+	// debug is the separate debug server, if configured.
+	debug *http.Server
+	// lifecycleMu serializes Start and Shutdown; shutDown is set by the
+	// latter.
+	lifecycleMu sync.Mutex
+	shutDown    bool
+	// listening are the listeners as bound by Start, with their actual
+	// ports.
+	listening atomic.Pointer[[]listenSpec]
+	// events passes recorded events to the sseConns open SSE streams.
+	events   eventHub
+	sseConns atomic.Int64
+	// stateMu serializes writes of the state file, usersFileMu those of
+	// the users file and certMu those of the TLS certificate and key.
+	stateMu     sync.Mutex
+	usersFileMu sync.Mutex
+	certMu      sync.Mutex
+	// tlsCert is the certificate of the https listeners unless it is
+	// managed by ACME; see ReplaceCertificate.
+	tlsCert atomic.Pointer[tls.Certificate]
+	// uuidDerived is set if Config.ServiceUUID was not configured, so the
+	// state file may supply it.
+	uuidDerived bool
+	// oidc validates bearer tokens if OIDC is configured.
+	oidc *oidcVerifier
+	// apiKeys are the keys currently accepted; see LoadAPIKeys.
+	apiKeys atomic.Pointer[[]APIKey]
+	// users are the accounts of the users file; see LoadUsers.
+	users atomic.Pointer[[]User]
+	// versions tracks when rendered resources last changed, for
+	// Last-Modified.
+	versions map[string]version
+	// uiKey signs the CSRF tokens and results of the status page.
+	uiKey []byte
+	// interfaces lists the host's network interfaces for the manager's
+	// EthernetInterfaces.
+	interfaces func() ([]hostInterface, error)
+	// clock times the power-on gate and the power-on accounting.
+	clock clock
 }
 
 func New(cfg Config) *Server {
 	mux := http.NewServeMux()
 	if cfg.Systems == nil {
-		cfg.Systems = map[string]backend.Backend{}
+		cfg.Systems = map[string]backend.System{}
+	}
+	if cfg.Info == nil {
+		cfg.Info = map[string]SystemInfo{}
+	}
+	if cfg.PublicPaths == nil {
+		cfg.PublicPaths = DefaultPublicPaths
 	}
 	s := &Server{
-		cfg:  cfg,
-		last: map[string]bool{},
-		boot: map[string]Boot{},
+		cfg:          cfg,
+		last:         map[string]bool{},
+		boot:         map[string]Boot{},
+		pendingBoot:  map[string]Boot{},
+		applied:      map[string]settingsResult{},
+		scheduled:    map[string]scheduledReset{},
+		scheduleWake: make(chan struct{}, 1),
+		asset:        map[string]Asset{},
+		up:           map[string]bool{},
+		unknownState: map[string]bool{},
+		powerTimes:   map[string]powerTime{},
+		transitions:  map[string]uint64{},
+		lastOrigin:   map[string]string{},
+		stoppedState: map[string]bool{},
+		hysteresis:   map[string]*hysteresis{},
+		lastAction:   map[string]time.Time{},
+		public:       map[string]bool{},
+		versions:     map[string]version{},
+		cache:        newReadCache(cfg.CacheTTL, cfg.CacheMaxStale),
+		mux:          mux,
+		history:      &history{},
+		interfaces:   hostInterfaces,
+		clock:        systemClock{},
+	}
+	if cfg.OIDC != nil {
+		s.oidc = newOIDCVerifier(*cfg.OIDC)
+	}
+	if s.cfg.AuthMode == "" {
+		s.cfg.AuthMode = AuthModeBasic
+		if cfg.OIDC != nil {
+			s.cfg.AuthMode = AuthModeOIDCBasic
+		}
+	}
+	keys := append([]APIKey(nil), cfg.APIKeys...)
+	s.apiKeys.Store(&keys)
+	s.notify = newNotifier(cfg.NotifyURLs, cfg.NotifyTemplate, cfg.NotifyTimeout)
+	s.readOnly.Store(cfg.ReadOnly)
+	if cfg.ReadOnly {
+		log.Printf("read-only mode enabled")
+	}
+	s.bgCtx, s.stopBg = context.WithCancel(context.Background())
+	if s.cfg.ServiceUUID == "" {
+		s.uuidDerived = true
+		host, _ := os.Hostname()
+		s.cfg.ServiceUUID = stableUUID("service-root/" + host)
+	}
+	for _, p := range cfg.PublicPaths {
+		s.public[p] = true
+	}
+	if s.cfg.Language == "" {
+		s.cfg.Language = DefaultLanguage
+	}
+	s.catalogs = embeddedCatalogs()
+	if s.cfg.Compat == "" {
+		s.cfg.Compat = CompatStrict
+	}
+	if s.cfg.CaptureMaxFiles <= 0 {
+		s.cfg.CaptureMaxFiles = DefaultCaptureMaxFiles
+	}
+	if s.cfg.LogEntries <= 0 {
+		s.cfg.LogEntries = defaultLogEntries
+	}
+	if s.cfg.SSEMaxConnections <= 0 {
+		s.cfg.SSEMaxConnections = DefaultSSEMaxConnections
+	}
+	s.systems.Store(newSystemSet(cfg.Systems, cfg.Info, &systemSet{}, s.cfg.LogEntries))
+	s.warm.track(cfg.Systems)
+	s.logOverrides()
+	if s.cfg.BackendTimeout <= 0 {
+		s.cfg.BackendTimeout = DefaultBackendTimeout
+	}
+	if s.cfg.BackendStartTimeout <= 0 {
+		s.cfg.BackendStartTimeout = DefaultBackendStartTimeout
+	}
+	if s.cfg.PowerOnMaxWait <= 0 {
+		s.cfg.PowerOnMaxWait = DefaultPowerOnMaxWait
+	}
+	s.powerOn = newPowerOnGate(s.cfg.PowerOnStagger, s.cfg.PowerOnConcurrency, s.clock)
+	if minWrite := s.resetTimeout() + writeTimeoutMargin; s.cfg.WriteTimeout < minWrite {
+		if s.cfg.WriteTimeout > 0 {
+			log.Printf("warning: write timeout %s is shorter than the longest reset %s plus %s; using %s", s.cfg.WriteTimeout, s.resetTimeout(), writeTimeoutMargin, minWrite)
+		}
+		s.cfg.WriteTimeout = minWrite
+	}
+	if s.cfg.MaxHeaderBytes <= 0 {
+		s.cfg.MaxHeaderBytes = http.DefaultMaxHeaderBytes
 	}
 	s.http = &http.Server{
-		Addr:         cfg.Listen,
-		Handler:      s.loggingMiddleware(s.authMiddleware(mux)),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Handler:        s.clientIPMiddleware(s.loggingMiddleware(s.captureMiddleware(s.prefixMiddleware(trimSlashMiddleware(gzipMiddleware(s.localeMiddleware(s.allowlistMiddleware(s.authMiddleware(s.readOnlyMiddleware(s.compatMiddleware(mux))))))))))),
+		ReadTimeout:    s.cfg.ReadTimeout,
+		WriteTimeout:   s.cfg.WriteTimeout,
+		IdleTimeout:    s.cfg.IdleTimeout,
+		MaxHeaderBytes: s.cfg.MaxHeaderBytes,
 	}
 
 	mux.HandleFunc("/redfish/v1/", s.handleRoot)
 	mux.HandleFunc("/redfish/v1/Systems", s.handleSystems)
 	mux.HandleFunc("/redfish/v1/Systems/", s.handleSystem)
+	mux.HandleFunc("/redfish/v1/Chassis", s.handleChassisCollection)
+	mux.HandleFunc("/redfish/v1/Chassis/", s.handleChassis)
+	mux.HandleFunc("/redfish/v1/Registries", s.handleRegistries)
+	mux.HandleFunc("/redfish/v1/Registries/", s.handleRegistry)
+	mux.HandleFunc(jsonSchemasPath, s.handleJSONSchemas)
+	mux.HandleFunc(jsonSchemasPath+"/", s.handleJSONSchemas)
+	mux.HandleFunc("/redfish/v1/Managers", s.handleManagers)
+	mux.HandleFunc("/redfish/v1/Managers/", s.handleManager)
+	mux.HandleFunc("/redfish/v1/AccountService", s.handleAccountService)
+	mux.HandleFunc("/redfish/v1/AccountService/Accounts", s.handleAccounts)
+	mux.HandleFunc("/redfish/v1/AccountService/Accounts/", s.handleAccount)
+	mux.HandleFunc("/redfish/v1/AccountService/Roles", s.handleRoles)
+	mux.HandleFunc("/redfish/v1/AccountService/Roles/", s.handleRole)
+	mux.HandleFunc("/redfish/v1/CertificateService", s.handleCertificateService)
+	mux.HandleFunc("/redfish/v1/CertificateService/", s.handleCertificateService)
+	mux.HandleFunc("/redfish/v1/EventService", s.handleEventService)
+	mux.HandleFunc("/redfish/v1/EventService/SSE", s.handleSSE)
+	mux.HandleFunc("/redfish/v1/EventService/Actions/EventService.SubmitTestEvent", s.handleSubmitTestEvent)
+	mux.HandleFunc(resetAllPath, s.handleResetAll)
+	mux.HandleFunc(simulatePath, s.handleSimulate)
+	mux.HandleFunc(schedulesPath, s.handleSchedules)
+	mux.HandleFunc(capturePath, s.handleCapture)
+	mux.HandleFunc(historyPath, s.handleHistory)
+	mux.HandleFunc(schedulesPath+"/", s.handleSchedules)
+	if cfg.UI {
+		mux.HandleFunc("/{$}", s.handleUIRoot)
+		mux.HandleFunc(uiPath, s.handleUI)
+		mux.HandleFunc(uiPath+"/reset", s.handleUIReset)
+	}
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/version", s.handleVersion)
 	mux.HandleFunc("/livez", s.handleLivez)
 	mux.HandleFunc("/readyz", s.handleReadyz)
 	mux.HandleFunc("/startupz", s.handleLivez)
+	if cfg.DebugOnMain {
+		mux.Handle("/debug/", s.debugHandler())
+	}
+	if cfg.DebugListen != "" {
+		s.debug = &http.Server{
+			Addr:              cfg.DebugListen,
+			Handler:           s.debugHandler(),
+			ReadHeaderTimeout: 15 * time.Second,
+		}
+	}
 
 	return s
 }
 
-func (s *Server) Start() error {
-	ids := make([]string, 0, len(s.cfg.Systems))
-	for id := range s.cfg.Systems {
-		ids = append(ids, id)
-	}
-	log.Printf("bmc-shim listening on %s (HTTP) (systems: %v)", s.cfg.Listen, ids)
-	return s.http.ListenAndServe()
-}
-
+// Shutdown stops the listeners and background work, waiting for active
+// requests until ctx is done. A later Start fails.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.http.Shutdown(ctx)
-}
-
-func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		bodyBytes, _ := io.ReadAll(r.Body)
-		if err := r.Body.Close(); err != nil {
-			log.Printf("error closing request body: %v", err)
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	s.shutDown = true
+	s.stopBg()
+	defer s.history.close()
+	if s.debug != nil {
+		if err := s.debug.Shutdown(ctx); err != nil {
+			log.Printf("debug listener shutdown: %v", err)
 		}
-		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	}
+	err := s.http.Shutdown(ctx)
+	// Give background work (e.g. discovery goodbyes) a chance to finish.
+	done := make(chan struct{})
+	go func() {
+		s.bg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	// Keep the time on counted so far.
+	if serr := s.saveState(); serr != nil {
+		log.Printf("shutdown: save state: %v", serr)
+	}
+	return err
+}
 
-		forwarded := r.Header.Get("X-Forwarded-For")
-		log.Printf("REQ: %s %s RemoteAddr: %s X-Forwarded-For: %s Body: %s", r.Method, r.URL.RequestURI(), r.RemoteAddr, forwarded, string(bodyBytes))
-		next.ServeHTTP(w, r)
-		log.Printf("RES: %s %s RemoteAddr: %s X-Forwarded-For: %s (%v)", r.Method, r.URL.RequestURI(), r.RemoteAddr, forwarded, time.Since(start))
-	})
+// Handler returns the fully wrapped HTTP handler so the server can be
+// driven in-process without a listener (used by the CLI client mode).
+func (s *Server) Handler() http.Handler {
+	return s.http.Handler
 }
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow unauthenticated access to the root service to support discovery
-		// Also allow health checks
-		if r.URL.Path == "/redfish/v1/" || r.URL.Path == "/redfish/v1" ||
-			r.URL.Path == "/livez" || r.URL.Path == "/readyz" || r.URL.Path == "/startupz" {
+		// Paths are compared exactly so that an exemption never extends
+		// to the resources below it.
+		// Debug and admin endpoints are never public.
+		if (s.public[r.URL.Path] && !isDebugPath(r.URL.Path) && !isAdminPath(r.URL.Path)) || (healthPaths[r.URL.Path] && (!s.cfg.HealthAuthRemote || isLoopback(clientIP(r)))) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		if s.cfg.Username == "" && s.cfg.Password == "" {
+		if !s.authRequired() {
 			next.ServeHTTP(w, r)
 			return
 		}
-		usr, pwd, ok := r.BasicAuth()
-		if !ok || usr != s.cfg.Username || pwd != s.cfg.Password {
-			w.Header().Set("WWW-Authenticate", "Basic realm=redfish")
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		p, err := s.authenticate(r)
+		if err != nil {
+			if !errors.Is(err, errNoCredentials) {
+				log.Printf("authentication failed: client %s: %v", clientIP(r), err)
+			}
+			s.challenge(w, err)
+			writeError(w, http.StatusUnauthorized, msgNoValidSession())
+			return
+		}
+		r = setPrincipal(r, p)
+		// Debug and admin endpoints expose every system, so scoped
+		// clients are kept out like readers.
+		if (!allowed(p.Role, r.Method) && !isOwnAccountPatch(p, r)) || ((isDebugPath(r.URL.Path) || isAdminPath(r.URL.Path)) && (p.Role != RoleOperator || p.Systems != nil)) {
+			writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// trimSlashMiddleware drops a trailing slash from Redfish paths other
+// than the service root, so that clients probing e.g.
+// /redfish/v1/Systems/ get the collection. It runs before authentication
+// so that both spellings are treated alike.
+func trimSlashMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p == "/redfish/v1/" || !strings.HasPrefix(p, "/redfish/v1/") || !strings.HasSuffix(p, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = strings.TrimSuffix(p, "/")
+		r2.URL.RawPath = strings.TrimSuffix(r.URL.RawPath, "/")
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// isLoopback reports whether ip is a loopback address.
+func isLoopback(ip string) bool {
+	a, err := netip.ParseAddr(ip)
+	return err == nil && a.IsLoopback()
+}
+
+// writeJSON writes v as a JSON response. It is marshaled before anything
+// is sent, so a value that cannot be encoded yields a complete 500 error
+// response rather than a truncated one.
 func writeJSON(w http.ResponseWriter, code int, v any) {
-	w.Header().Set("Content-Type", "application/json")
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("error encoding %T response: %v", v, err)
+		code = http.StatusInternalServerError
+		msg := msgInternalError()
+		b, _ = json.Marshal(map[string]any{
+			"error": map[string]any{
+				"code":                  msg.MessageID,
+				"message":               msg.Message,
+				"@Message.ExtendedInfo": []message{msg},
+			},
+		})
+	}
+	b = withODataContext(b)
+	if lw, ok := wrappedWriter[*localeWriter](w); ok {
+		b = lw.c.localize(b)
+	}
+	if cw, ok := wrappedWriter[*compatWriter](w); ok && cw.p.rewrites() {
+		b = cw.p.rewrite(b)
+	}
+	b = prefixLinks(w, b)
+	b = append(b, '\n')
+	h := w.Header()
+	setRedfishHeaders(h)
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", strconv.Itoa(len(b)))
 	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(v)
+	if _, err := w.Write(b); err != nil {
+		log.Printf("error writing response: %v", err)
+	}
+}
+
+// wrappedWriter returns the writer of type T among w and those it wraps.
+func wrappedWriter[T http.ResponseWriter](w http.ResponseWriter) (T, bool) {
+	for {
+		if t, ok := w.(T); ok {
+			return t, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// withODataContext adds the @odata.context OData clients such as gofish
+// expect to a resource with an @odata.type but no context. It is derived
+// from the type: "#ComputerSystem.v1_13_0.ComputerSystem" gives
+// "/redfish/v1/$metadata#ComputerSystem.ComputerSystem".
+func withODataContext(b []byte) []byte {
+	var head struct {
+		Type    string  `json:"@odata.type"`
+		Context *string `json:"@odata.context"`
+	}
+	if len(b) < 2 || b[0] != '{' || json.Unmarshal(b, &head) != nil || head.Type == "" || head.Context != nil {
+		return b
+	}
+	t := strings.TrimPrefix(head.Type, "#")
+	ns, _, _ := strings.Cut(t, ".")
+	name := t[strings.LastIndex(t, ".")+1:]
+	ctx, _ := json.Marshal("/redfish/v1/$metadata#" + ns + "." + name)
+	out := make([]byte, 0, len(b)+len(ctx)+20)
+	out = append(out, `{"@odata.context":`...)
+	out = append(out, ctx...)
+	if len(b) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, b[1:]...)
+}
+
+// setRedfishHeaders sets the headers every Redfish response carries.
+// Responses may be cached but must be revalidated, which the
+// Last-Modified of resources that have one makes cheap.
+func setRedfishHeaders(h http.Header) {
+	h.Set("OData-Version", redfish.ODataVersion)
+	h.Set("Cache-Control", "no-cache")
 }
 
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	// The root is registered as a subtree; anything below it is unknown.
+	if r.URL.Path != "/redfish/v1/" {
+		writeNotFound(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, http.MethodGet)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"@odata.type": "#ServiceRoot.v1_0_0.ServiceRoot",
-		"@odata.id":   "/redfish/v1/",
-		"Id":          "RootService",
-		"Name":        "BMC Shim ServiceRoot",
-		"Systems": map[string]string{
-			"@odata.id": "/redfish/v1/Systems",
+	root := redfish.ServiceRoot{
+		ODataType:      "#ServiceRoot.v1_0_0.ServiceRoot",
+		ODataID:        "/redfish/v1/",
+		ID:             "RootService",
+		Name:           "BMC Shim ServiceRoot",
+		RedfishVersion: redfish.Version,
+		UUID:           s.cfg.ServiceUUID,
+		Systems:        redfish.Link{ODataID: "/redfish/v1/Systems"},
+		Chassis:        redfish.Link{ODataID: "/redfish/v1/Chassis"},
+		Managers:       redfish.Link{ODataID: "/redfish/v1/Managers"},
+		Registries:     redfish.Link{ODataID: "/redfish/v1/Registries"},
+		JsonSchemas:    redfish.Link{ODataID: jsonSchemasPath},
+		AccountService: redfish.Link{ODataID: "/redfish/v1/AccountService"},
+		EventService:   redfish.Link{ODataID: "/redfish/v1/EventService"},
+		Oem: map[string]any{
+			"BmcShim": buildinfo.Get(),
 		},
-	})
+	}
+	if s.tlsCert.Load() != nil {
+		root.CertificateService = &redfish.Link{ODataID: "/redfish/v1/CertificateService"}
+	}
+	writeJSON(w, http.StatusOK, root)
+}
+
+// handleVersion serves the build information for dashboards and
+// inventory tools that do not speak Redfish.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	writeJSON(w, http.StatusOK, buildinfo.Get())
 }
 
 func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
@@ -147,8 +827,11 @@ func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
-	// Check if we can reach at least one backend
-	if len(s.cfg.Systems) == 0 {
+	// Check if we can reach at least one backend. One snapshot, so that
+	// systems SetSystems removes meanwhile are still checked.
+	set := s.systems.Load()
+	ids := set.ids
+	if len(ids) == 0 {
 		// No systems configured, technically ready but useless?
 		// Let's say ok.
 		w.WriteHeader(http.StatusOK)
@@ -158,188 +841,49 @@ func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Try to ping backends. If at least one succeeds, we are ready.
-	// We don't want to fail if one of many is down, as long as the service is functional.
-	// But if ALL are down, we are probably not ready.
-	success := false
-	for _, be := range s.cfg.Systems {
-		if hc, ok := be.(backend.HealthChecker); ok {
-			if err := hc.Ping(r.Context()); err == nil {
-				success = true
-				break
-			}
-		} else {
-			// Backend doesn't support health check, assume it's fine
-			success = true
-			break
+	// Ping all backends concurrently; Config.ReadyPolicy decides which
+	// of them have to succeed (see readiness).
+	// Backends without a health check are assumed to be fine.
+	// Backends still starting count as failed without being asked.
+	_, errs := fanOut(r.Context(), ids, fanOutTimeout, func(ctx context.Context, id string) (struct{}, error) {
+		if err := s.notConnected(id); err != nil {
+			return struct{}{}, err
 		}
-	}
-
-	if success {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("ok")); err != nil {
-			log.Printf("error writing response: %v", err)
-		}
-	} else {
-		http.Error(w, "all backends failed", http.StatusServiceUnavailable)
-	}
-}
-
-func (s *Server) handleSystems(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	members := make([]map[string]string, 0, len(s.cfg.Systems))
-	for id := range s.cfg.Systems {
-		members = append(members, map[string]string{"@odata.id": "/redfish/v1/Systems/" + id})
-	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"@odata.id":           "/redfish/v1/Systems",
-		"Members":             members,
-		"Members@odata.count": len(members),
-		"Name":                "Systems Collection",
+		return struct{}{}, s.ping(ctx, id, set.backends[id], s.cfg.CacheTTL)
 	})
-}
-
-func (s *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
-	// Expect paths like /redfish/v1/Systems/<id>[/Actions/ComputerSystem.Reset]
-	path := strings.TrimPrefix(r.URL.Path, "/redfish/v1/Systems/")
-	if path == "" {
-		http.NotFound(w, r)
-		return
+	success, status := s.readiness(ids, errs)
+	code := http.StatusOK
+	if !success {
+		code = http.StatusServiceUnavailable
 	}
-
-	if strings.HasSuffix(path, "/Actions/ComputerSystem.Reset") {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		id := strings.TrimSuffix(path, "/Actions/ComputerSystem.Reset")
-		id = strings.TrimSuffix(id, "/")
-		be, ok := s.cfg.Systems[id]
-		if !ok {
-			http.NotFound(w, r)
-			return
-		}
-		var body struct{ ResetType string }
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
-			return
+	// ?verbose lists each system's check, like the Kubernetes endpoints.
+	if _, verbose := r.URL.Query()["verbose"]; verbose {
+		var b strings.Builder
+		for i, id := range ids {
+			system := "system " + id
+			if s.systemInfo(id).Critical {
+				system += " (critical)"
+			}
+			if errs[i] != nil {
+				fmt.Fprintf(&b, "[-]%s failed: %v\n", system, errs[i])
+			} else {
+				fmt.Fprintf(&b, "[+]%s ok\n", system)
+			}
 		}
-		if err := s.applyReset(r.Context(), id, be, body.ResetType); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		b.WriteString(status + "\n")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		if _, err := w.Write([]byte(b.String())); err != nil {
+			log.Printf("error writing response: %v", err)
 		}
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
-		return
-	}
-
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	id := strings.TrimSuffix(path, "/")
-	be, ok := s.cfg.Systems[id]
-	if !ok {
-		http.NotFound(w, r)
-		return
-	}
-	// Prefer backend-reported state when available
-	on := false
-	if ps, ok := be.(backend.PowerStateProvider); ok {
-		if v, err := ps.CurrentState(r.Context()); err == nil {
-			on = v
-		} else {
-			s.mu.RLock()
-			on = s.last[id]
-			s.mu.RUnlock()
+	if success {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("ok")); err != nil {
+			log.Printf("error writing response: %v", err)
 		}
 	} else {
-		s.mu.RLock()
-		on = s.last[id]
-		s.mu.RUnlock()
-	}
-	powerState := "Off"
-	if on {
-		powerState = "On"
-	}
-
-	// Determine friendly name
-	name := "System " + id
-	if np, ok := be.(backend.NameProvider); ok {
-		if n, err := np.DisplayName(r.Context()); err == nil && n != "" {
-			name = n
-		}
-	}
-
-	// Get or initialize Boot info for this system
-	s.mu.RLock()
-	boot := s.boot[id]
-	s.mu.RUnlock()
-	if boot.BootSourceOverrideTarget == "" {
-		boot = Boot{
-			BootSourceOverrideTarget:  "None",
-			BootSourceOverrideEnabled: "Disabled",
-		}
-	}
-
-	writeJSON(w, http.StatusOK, map[string]any{
-		"@odata.id":  "/redfish/v1/Systems/" + id,
-		"Id":         id,
-		"Name":       name,
-		"PowerState": powerState,
-		"Boot": map[string]any{
-			"BootSourceOverrideTarget":                         boot.BootSourceOverrideTarget,
-			"BootSourceOverrideEnabled":                        boot.BootSourceOverrideEnabled,
-			"BootSourceOverrideTarget@Redfish.AllowableValues": []string{"None", "Pxe", "Hdd"},
-		},
-		"Links": map[string]any{
-			"ManagedBy": []map[string]string{
-				{"@odata.id": "/redfish/v1/Managers/1"},
-			},
-		},
-		"Actions": map[string]any{
-			"#ComputerSystem.Reset": map[string]any{
-				"target":                            "/redfish/v1/Systems/" + id + "/Actions/ComputerSystem.Reset",
-				"ResetType@Redfish.AllowableValues": []string{"On", "ForceOff", "GracefulShutdown", "ForceRestart"},
-			},
-		},
-	})
-}
-
-func (s *Server) applyReset(ctx context.Context, id string, be backend.Backend, resetType string) error {
-	switch resetType {
-	case "On":
-		if err := be.PowerOn(ctx); err != nil {
-			return err
-		}
-		s.mu.Lock()
-		s.last[id] = true
-		s.mu.Unlock()
-		return nil
-	case "ForceOff", "GracefulShutdown", "Off":
-		if err := be.PowerOff(ctx); err != nil {
-			return err
-		}
-		s.mu.Lock()
-		s.last[id] = false
-		s.mu.Unlock()
-		return nil
-	case "ForceRestart", "GracefulRestart":
-		// simple restart: off then on
-		if err := be.PowerOff(ctx); err != nil {
-			return err
-		}
-		time.Sleep(2 * time.Second)
-		if err := be.PowerOn(ctx); err != nil {
-			return err
-		}
-		s.mu.Lock()
-		s.last[id] = true
-		s.mu.Unlock()
-		return nil
-	default:
-		return errors.New("unsupported ResetType")
+		http.Error(w, status, http.StatusServiceUnavailable)
 	}
 }
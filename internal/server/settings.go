@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/redfish"
+)
+
+// Apply times of the Settings resource: Immediate applies a PATCH like
+// one of the System itself, OnReset keeps it pending until the next
+// power-on or restart.
+const (
+	applyImmediate = "Immediate"
+	applyOnReset   = "OnReset"
+)
+
+var settingsApplyTimes = []string{applyImmediate, applyOnReset}
+
+// settingsResult is the outcome of applying pending settings, reported
+// in the @Redfish.Settings annotation of the System.
+type settingsResult struct {
+	Time     time.Time
+	Messages []message
+}
+
+// powersOn reports whether a reset leaves the system on, so that pending
+// settings take effect with it.
+func powersOn(resetType string) bool {
+	if on, ok := targetState(resetType); ok {
+		return on
+	}
+	return resetType != "Nmi"
+}
+
+// settingsAnnotation renders the @Redfish.Settings annotation of a
+// System.
+func (s *Server) settingsAnnotation(id string) *redfish.Settings {
+	s.mu.RLock()
+	res, ok := s.applied[id]
+	s.mu.RUnlock()
+	a := &redfish.Settings{
+		ODataType:           "#Settings.v1_3_0.Settings",
+		SettingsObject:      redfish.Link{ODataID: "/redfish/v1/Systems/" + id + "/Settings"},
+		SupportedApplyTimes: settingsApplyTimes,
+	}
+	if ok {
+		a.Time = res.Time.UTC().Format(time.RFC3339)
+		a.Messages = res.Messages
+	}
+	return a
+}
+
+// handleSettings serves the Settings resource of a system. GET shows the
+// pending boot settings (the current ones if nothing is pending), PATCH
+// changes them and DELETE discards them.
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request, id string, be backend.System) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.settingsResource(id))
+	case http.MethodPatch:
+		s.patchSettings(w, r, id, be)
+	case http.MethodDelete:
+		s.mu.Lock()
+		_, pending := s.pendingBoot[id]
+		delete(s.pendingBoot, id)
+		s.mu.Unlock()
+		if pending {
+			s.recordEvent(id, severityOK, "Pending boot settings discarded by "+initiator(r))
+			if err := s.saveState(); err != nil {
+				log.Printf("system %s: save state: %v", id, err)
+				writeError(w, http.StatusInternalServerError, msgInternalError())
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// pendingOrCurrentBoot returns the pending boot settings of a system, or
+// the current ones if none are pending.
+func (s *Server) pendingOrCurrentBoot(id string) (Boot, bool) {
+	s.mu.RLock()
+	b, ok := s.pendingBoot[id]
+	s.mu.RUnlock()
+	if !ok {
+		return s.currentBoot(id), false
+	}
+	return b, true
+}
+
+func (s *Server) settingsResource(id string) map[string]any {
+	b, pending := s.pendingOrCurrentBoot(id)
+	settings := map[string]any{
+		"@odata.type": systemODataType,
+		"@odata.id":   "/redfish/v1/Systems/" + id + "/Settings",
+		"Id":          "Settings",
+		"Name":        "Pending Settings",
+		"Boot": redfish.Boot{
+			BootSourceOverrideTarget:     b.BootSourceOverrideTarget,
+			BootSourceOverrideEnabled:    b.BootSourceOverrideEnabled,
+			AllowableTargets:             bootTargets,
+			BootSourceOverrideMode:       b.BootSourceOverrideMode,
+			UefiTargetBootSourceOverride: b.UefiTargetBootSourceOverride,
+			BootOrder:                    b.BootOrder,
+		},
+		"@Redfish.SettingsApplyTime": map[string]any{
+			"@odata.type":                       "#Settings.v1_3_0.PreferenceApplyTime",
+			"ApplyTime":                         applyOnReset,
+			"ApplyTime@Redfish.AllowableValues": settingsApplyTimes,
+		},
+	}
+	if pending {
+		settings["Oem"] = map[string]any{"BmcShim": map[string]any{"Pending": true}}
+	}
+	return settings
+}
+
+// patchSettings validates a PATCH of the Settings resource and either
+// applies the boot settings at once or keeps them pending, depending on
+// @Redfish.SettingsApplyTime (default OnReset).
+func (s *Server) patchSettings(w http.ResponseWriter, r *http.Request, id string, be backend.System) {
+	body, ok := s.decodeBody(w, r, schemaComputerSystem)
+	if !ok {
+		return
+	}
+	applyTime := applyOnReset
+	var boot Boot
+	var msgs []message
+	for _, prop := range sortedKeys(body) {
+		raw := body[prop]
+		switch prop {
+		case "Boot":
+			base, _ := s.pendingOrCurrentBoot(id)
+			var bmsgs []message
+			boot, bmsgs = s.parseBootPatch(id, base, raw)
+			msgs = append(msgs, bmsgs...)
+		case "@Redfish.SettingsApplyTime":
+			var at map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &at); err != nil || at == nil {
+				msgs = append(msgs, msgPropertyValueTypeError(string(raw), prop))
+				continue
+			}
+			for _, key := range sortedKeys(at) {
+				switch key {
+				case "ApplyTime":
+					if v, ok := enumValue(at[key], prop+"/"+key, settingsApplyTimes, &msgs); ok {
+						applyTime = v
+					}
+				case "@odata.type":
+				default:
+					msgs = append(msgs, msgPropertyUnknown(prop+"/"+key))
+				}
+			}
+		case "AssetTag", "HostName", "IndicatorLED":
+			// Writable on the System itself only.
+			msgs = append(msgs, msgPropertyNotWritable(prop))
+		default:
+			if systemReadOnly[prop] {
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+			} else {
+				msgs = append(msgs, msgPropertyUnknown(prop))
+			}
+		}
+	}
+	if _, ok := body["Boot"]; !ok && len(msgs) == 0 {
+		msgs = append(msgs, msgPropertyMissing("Boot"))
+	}
+	if len(msgs) > 0 {
+		writeError(w, http.StatusBadRequest, msgs...)
+		return
+	}
+
+	if applyTime == applyImmediate {
+		ctx, cancel := context.WithTimeout(r.Context(), s.cfg.BackendTimeout)
+		defer cancel()
+		s.mu.Lock()
+		delete(s.pendingBoot, id)
+		s.mu.Unlock()
+		if err := s.setBoot(ctx, initiator(r), id, be, boot); err != nil {
+			log.Printf("patch settings %s: %v", id, err)
+			writeError(w, http.StatusInternalServerError, msgInternalError())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.settingsResource(id))
+		return
+	}
+	s.mu.Lock()
+	s.pendingBoot[id] = boot
+	s.mu.Unlock()
+	s.recordEvent(id, severityOK, fmt.Sprintf("Pending boot override %s (%s) set by %s, applied on next reset",
+		boot.BootSourceOverrideTarget, boot.BootSourceOverrideEnabled, initiator(r)))
+	if err := s.saveState(); err != nil {
+		log.Printf("patch settings %s: save state: %v", id, err)
+		writeError(w, http.StatusInternalServerError, msgInternalError())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.settingsResource(id))
+}
+
+// applyPendingSettings applies the pending boot settings of a system
+// ahead of a power-on or restart. A failure is logged and reported in
+// the annotation but does not stop the reset; the settings then stay
+// pending.
+func (s *Server) applyPendingSettings(ctx context.Context, id string, be backend.System, by string) {
+	s.mu.Lock()
+	b, ok := s.pendingBoot[id]
+	delete(s.pendingBoot, id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	res := settingsResult{Time: time.Now()}
+	if err := s.setBoot(ctx, by, id, be, b); err != nil {
+		log.Printf("system %s: apply pending settings: %v", id, err)
+		s.recordEvent(id, severityWarning, fmt.Sprintf("Applying pending boot settings failed: %v", err))
+		res.Messages = []message{msgInternalError()}
+		s.mu.Lock()
+		if _, newer := s.pendingBoot[id]; !newer {
+			s.pendingBoot[id] = b
+		}
+		s.mu.Unlock()
+		if err := s.saveState(); err != nil {
+			log.Printf("system %s: save state: %v", id, err)
+		}
+	}
+	s.mu.Lock()
+	s.applied[id] = res
+	s.mu.Unlock()
+}
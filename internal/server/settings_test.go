@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// bootBackend is a Backend with a BootSetter recording its calls in order.
+// SetBoot fails with failBoot, if set.
+type bootBackend struct {
+	mu       sync.Mutex
+	calls    []string
+	boots    []backend.BootOptions
+	failBoot error
+}
+
+func (b *bootBackend) record(call string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, call)
+}
+
+func (b *bootBackend) PowerOn(ctx context.Context) error  { b.record("PowerOn"); return nil }
+func (b *bootBackend) PowerOff(ctx context.Context) error { b.record("PowerOff"); return nil }
+
+func (b *bootBackend) SetBoot(ctx context.Context, opts backend.BootOptions) error {
+	b.record("SetBoot")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.boots = append(b.boots, opts)
+	return b.failBoot
+}
+
+func (b *bootBackend) takeCalls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	calls := b.calls
+	b.calls = nil
+	return calls
+}
+
+func request(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+const pxeOnce = `{"Boot": {"BootSourceOverrideTarget": "Pxe", "BootSourceOverrideEnabled": "Once"}}`
+
+// pendingState returns whether the Settings resource of system 1 shows
+// pending settings, its boot target, and the @Redfish.Settings annotation
+// and boot target of the System.
+func pendingState(t *testing.T, h http.Handler) (pending bool, pendingTarget string, annotation map[string]any, target string) {
+	t.Helper()
+	_, settings := getJSON(t, h, "/redfish/v1/Systems/1/Settings")
+	oem, _ := settings["Oem"].(map[string]any)
+	shim, _ := oem["BmcShim"].(map[string]any)
+	pending, _ = shim["Pending"].(bool)
+	pendingTarget, _ = settings["Boot"].(map[string]any)["BootSourceOverrideTarget"].(string)
+	_, sys := getJSON(t, h, "/redfish/v1/Systems/1")
+	annotation, _ = sys["@Redfish.Settings"].(map[string]any)
+	target, _ = sys["Boot"].(map[string]any)["BootSourceOverrideTarget"].(string)
+	return pending, pendingTarget, annotation, target
+}
+
+func TestSettingsAppliedOnReset(t *testing.T) {
+	be := &bootBackend{}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+
+	if rec := request(h, http.MethodPatch, "/redfish/v1/Systems/1/Settings", pxeOnce); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH Settings = %d: %s", rec.Code, rec.Body)
+	}
+	if calls := be.takeCalls(); len(calls) != 0 {
+		t.Errorf("backend calls after PATCH = %v, want none until a reset", calls)
+	}
+	pending, pendingTarget, annotation, target := pendingState(t, h)
+	if !pending || pendingTarget != "Pxe" || target != "None" {
+		t.Errorf("before the reset: pending %v %q, live target %q; want Pxe pending and None live", pending, pendingTarget, target)
+	}
+	if annotation["Time"] != nil {
+		t.Errorf("@Redfish.Settings Time = %v before any application", annotation["Time"])
+	}
+
+	// Powering off does not apply them.
+	resetRequest(h, "ForceOff")
+	if calls := be.takeCalls(); strings.Join(calls, ",") != "PowerOff" {
+		t.Errorf("ForceOff calls = %v, want PowerOff alone", calls)
+	}
+	if pending, _, _, _ := pendingState(t, h); !pending {
+		t.Error("settings no longer pending after ForceOff")
+	}
+
+	if rec := resetRequest(h, "On"); rec.Code != http.StatusNoContent {
+		t.Fatalf("On = %d: %s", rec.Code, rec.Body)
+	}
+	if calls := be.takeCalls(); strings.Join(calls, ",") != "SetBoot,PowerOn" {
+		t.Errorf("On calls = %v, want SetBoot before PowerOn", calls)
+	}
+	if got := be.boots; len(got) != 1 || got[0].OverrideTarget != "Pxe" || got[0].OverrideEnabled != "Once" {
+		t.Errorf("SetBoot = %+v, want Pxe once", got)
+	}
+	pending, pendingTarget, annotation, target = pendingState(t, h)
+	if pending || pendingTarget != "Pxe" || target != "Pxe" {
+		t.Errorf("after the reset: pending %v %q, live target %q; want nothing pending and Pxe live", pending, pendingTarget, target)
+	}
+	if annotation["Time"] == nil || annotation["Messages"] != nil {
+		t.Errorf("@Redfish.Settings = %v, want the time of the application without messages", annotation)
+	}
+
+	// Applied once: the next power-on leaves the boot settings alone.
+	resetRequest(h, "ForceOff")
+	resetRequest(h, "On")
+	if calls := be.takeCalls(); strings.Join(calls, ",") != "PowerOff,PowerOn" {
+		t.Errorf("calls of the next power cycle = %v, want no SetBoot", calls)
+	}
+}
+
+func TestSettingsDiscarded(t *testing.T) {
+	be := &bootBackend{}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+	request(h, http.MethodPatch, "/redfish/v1/Systems/1/Settings", pxeOnce)
+	if rec := request(h, http.MethodDelete, "/redfish/v1/Systems/1/Settings", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE Settings = %d: %s", rec.Code, rec.Body)
+	}
+	if pending, pendingTarget, _, _ := pendingState(t, h); pending || pendingTarget != "None" {
+		t.Errorf("after DELETE: pending %v %q, want the current settings", pending, pendingTarget)
+	}
+	resetRequest(h, "On")
+	if calls := be.takeCalls(); strings.Join(calls, ",") != "PowerOn" {
+		t.Errorf("On calls = %v, want PowerOn alone", calls)
+	}
+}
+
+func TestSettingsApplyFailure(t *testing.T) {
+	be := &bootBackend{failBoot: errors.New("boot device busy")}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+	request(h, http.MethodPatch, "/redfish/v1/Systems/1/Settings", pxeOnce)
+	if rec := resetRequest(h, "On"); rec.Code != http.StatusNoContent {
+		t.Fatalf("On = %d: %s", rec.Code, rec.Body)
+	}
+	if calls := be.takeCalls(); strings.Join(calls, ",") != "SetBoot,PowerOn" {
+		t.Errorf("On calls = %v, want the power-on despite the failure", calls)
+	}
+	pending, _, annotation, target := pendingState(t, h)
+	if !pending || target != "None" {
+		t.Errorf("after a failed application: pending %v, live target %q; want still pending", pending, target)
+	}
+	if msgs, _ := annotation["Messages"].([]any); annotation["Time"] == nil || len(msgs) == 0 {
+		t.Errorf("@Redfish.Settings = %v, want the time and the failure", annotation)
+	}
+}
+
+func TestSettingsApplyImmediate(t *testing.T) {
+	be := &bootBackend{}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+	body := `{"Boot": {"BootSourceOverrideTarget": "Hdd", "BootSourceOverrideEnabled": "Continuous"}, "@Redfish.SettingsApplyTime": {"ApplyTime": "Immediate"}}`
+	if rec := request(h, http.MethodPatch, "/redfish/v1/Systems/1/Settings", body); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH Settings = %d: %s", rec.Code, rec.Body)
+	}
+	if calls := be.takeCalls(); strings.Join(calls, ",") != "SetBoot" {
+		t.Errorf("calls = %v, want SetBoot at once", calls)
+	}
+	if pending, _, _, target := pendingState(t, h); pending || target != "Hdd" {
+		t.Errorf("pending %v, live target %q; want Hdd applied", pending, target)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+const simulatePath = "/admin/simulate"
+
+// simulatedFaults is the JSON form of backend.Faults; durations are Go
+// duration strings such as "20s".
+type simulatedFaults struct {
+	FailNext     int    `json:"fail_next,omitempty"`
+	Latency      string `json:"latency,omitempty"`
+	ForcedState  string `json:"forced_state,omitempty"`
+	FlapInterval string `json:"flap_interval,omitempty"`
+}
+
+func faultsJSON(f backend.Faults) simulatedFaults {
+	sf := simulatedFaults{FailNext: f.FailNext, ForcedState: f.ForcedState}
+	if f.Latency > 0 {
+		sf.Latency = f.Latency.String()
+	}
+	if f.FlapInterval > 0 {
+		sf.FlapInterval = f.FlapInterval.String()
+	}
+	return sf
+}
+
+// parse validates the faults of system id, appending problems to msgs.
+func (sf simulatedFaults) parse(id string, msgs *[]message) backend.Faults {
+	f := backend.Faults{FailNext: sf.FailNext, ForcedState: sf.ForcedState}
+	prop := func(name string) string { return id + "/" + name }
+	if sf.FailNext < 0 {
+		*msgs = append(*msgs, msgPropertyValueFormatError(fmt.Sprint(sf.FailNext), prop("fail_next")))
+	}
+	switch sf.ForcedState {
+	case "", "On", "Off":
+	default:
+		*msgs = append(*msgs, msgPropertyValueNotInList(sf.ForcedState, prop("forced_state")))
+	}
+	for _, d := range []struct {
+		name string
+		v    string
+		dst  *time.Duration
+	}{
+		{"latency", sf.Latency, &f.Latency},
+		{"flap_interval", sf.FlapInterval, &f.FlapInterval},
+	} {
+		if d.v == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.v)
+		if err != nil || v < 0 {
+			*msgs = append(*msgs, msgPropertyValueFormatError(d.v, prop(d.name)))
+			continue
+		}
+		*d.dst = v
+	}
+	return f
+}
+
+// simulators returns the systems whose backends can simulate faults.
+func (s *Server) simulators() map[string]backend.FaultInjector {
+	m := map[string]backend.FaultInjector{}
+	for id, be := range s.systems.Load().backends {
+		if fi := be.Capabilities().Faults; fi != nil {
+			m[id] = fi
+		}
+	}
+	return m
+}
+
+// handleSimulate lets test suites inject faults into simulated systems:
+// GET lists the current faults per system, POST replaces those of the
+// systems in the body, e.g. {"1": {"fail_next": 1, "latency": "20s"}},
+// and DELETE clears all of them. It only exists while a simulating
+// backend is in use.
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	sims := s.simulators()
+	if len(sims) == 0 {
+		writeNotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body map[string]simulatedFaults
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, msgMalformedJSON())
+			return
+		}
+		var msgs []message
+		faults := map[string]backend.Faults{}
+		for _, id := range sortedKeys(body) {
+			if _, ok := sims[id]; !ok {
+				msgs = append(msgs, msgPropertyUnknown(id))
+				continue
+			}
+			faults[id] = body[id].parse(id, &msgs)
+		}
+		if len(msgs) > 0 {
+			writeError(w, http.StatusBadRequest, msgs...)
+			return
+		}
+		for id, f := range faults {
+			sims[id].SetFaults(f)
+			log.Printf("system %s: simulated faults set by %s: %+v", id, initiator(r), faultsJSON(f))
+		}
+	case http.MethodDelete:
+		for _, fi := range sims {
+			fi.SetFaults(backend.Faults{})
+		}
+		log.Printf("simulated faults cleared by %s", initiator(r))
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPost, http.MethodDelete)
+		return
+	}
+	out := map[string]simulatedFaults{}
+	for id, fi := range sims {
+		out[id] = faultsJSON(fi.Faults())
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// isAdminPath reports whether p is an admin endpoint, which like the
+// debug endpoints is reserved for unscoped operators.
+func isAdminPath(p string) bool {
+	return strings.HasPrefix(p, "/admin/")
+}
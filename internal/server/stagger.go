@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// DefaultPowerOnMaxWait bounds how long a power-on waits for its turn
+// when power-ons are staggered.
+const DefaultPowerOnMaxWait = time.Minute
+
+// errPowerOnQueued is returned for a power-on that could not start within
+// Config.PowerOnMaxWait.
+var errPowerOnQueued = errors.New("too many power-ons queued")
+
+// powerOnGate sequences power-ons across all systems so that their inrush
+// currents do not add up: at most a number of them run at once, and each
+// starts at least stagger after the one before.
+type powerOnGate struct {
+	clock   clock
+	stagger time.Duration
+	// slots holds a token per running power-on; nil means no limit.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// next is the earliest start of the next power-on.
+	next time.Time
+	// queued counts the power-ons waiting per system and waits records
+	// how long they waited.
+	queued map[string]int
+	waits  map[string]*histogram
+}
+
+// newPowerOnGate returns nil if neither a stagger nor a concurrency limit
+// is configured.
+func newPowerOnGate(stagger time.Duration, concurrency int, c clock) *powerOnGate {
+	if stagger <= 0 && concurrency <= 0 {
+		return nil
+	}
+	g := &powerOnGate{clock: c, stagger: max(stagger, 0), queued: map[string]int{}, waits: map[string]*histogram{}}
+	if concurrency > 0 {
+		g.slots = make(chan struct{}, concurrency)
+	}
+	return g
+}
+
+// acquire waits until a power-on of system id may start and returns the
+// function that ends it. A power-on first waits for a slot, then reserves
+// the next start time and waits for it, so power-ons start in the order
+// they got a slot. A power-on giving up gives its start time back unless a
+// later one reserved the next.
+func (g *powerOnGate) acquire(ctx context.Context, id string) (release func(), err error) {
+	g.enqueue(id)
+	queuedAt := g.clock.Now()
+	defer func() { g.dequeue(id, g.clock.Now().Sub(queuedAt)) }()
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		if g.slots != nil {
+			<-g.slots
+		}
+	}
+	g.mu.Lock()
+	now := g.clock.Now()
+	start, prev := g.next, g.next
+	if start.Before(now) {
+		start = now
+	}
+	g.next = start.Add(g.stagger)
+	reserved := g.next
+	g.mu.Unlock()
+	if wait := start.Sub(now); wait > 0 {
+		select {
+		case <-g.clock.After(wait):
+		case <-ctx.Done():
+			g.mu.Lock()
+			if g.next.Equal(reserved) {
+				g.next = prev
+			}
+			g.mu.Unlock()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+func (g *powerOnGate) enqueue(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.queued[id]++
+}
+
+// dequeue ends the wait of a power-on of system id, whether it may start
+// or gave up.
+func (g *powerOnGate) dequeue(id string, waited time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.queued[id]--; g.queued[id] == 0 {
+		delete(g.queued, id)
+	}
+	h := g.waits[id]
+	if h == nil {
+		h = &histogram{}
+		g.waits[id] = h
+	}
+	h.observe(waited.Seconds())
+}
+
+// awaitPowerOn waits for the turn of a power-on if they are staggered. A
+// power-on still queued after Config.PowerOnMaxWait fails with a
+// backend.RetryableError, so the client is told to come back.
+func (s *Server) awaitPowerOn(ctx context.Context, id string) (release func(), err error) {
+	if s.powerOn == nil {
+		return func() {}, nil
+	}
+	wctx, cancel := context.WithTimeout(ctx, s.cfg.PowerOnMaxWait)
+	defer cancel()
+	release, err = s.powerOn.acquire(wctx, id)
+	if err != nil && ctx.Err() == nil {
+		return nil, &backend.RetryableError{Err: errPowerOnQueued, RetryAfter: max(s.cfg.PowerOnStagger, time.Second)}
+	}
+	return release, err
+}
+
+// resetTimeout bounds a whole reset: the backend calls plus the time a
+// power-on may wait for its turn and the strict post-power-on hooks.
+func (s *Server) resetTimeout() time.Duration {
+	d := s.cfg.BackendTimeout + s.hookTimeout()
+	if s.powerOn == nil {
+		return d
+	}
+	return d + s.cfg.PowerOnMaxWait
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{c.now.Add(d), ch})
+	return ch
+}
+
+// advance moves the time forward by d, firing the timers due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// waitTimers waits until n timers are pending.
+func (c *fakeClock) waitTimers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		got := len(c.timers)
+		c.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers pending, want %d", got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// gateStart is the outcome of a power-on acquiring the gate.
+type gateStart struct {
+	id      string
+	at      time.Time
+	release func()
+	err     error
+}
+
+// acquireAsync acquires g for id in the background, sending the outcome
+// to started.
+func acquireAsync(ctx context.Context, g *powerOnGate, c *fakeClock, id string, started chan<- gateStart) {
+	go func() {
+		release, err := g.acquire(ctx, id)
+		started <- gateStart{id, c.Now(), release, err}
+	}()
+}
+
+func receiveStart(t *testing.T, started <-chan gateStart) gateStart {
+	t.Helper()
+	select {
+	case s := <-started:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no power-on started")
+		return gateStart{}
+	}
+}
+
+func expectNoStart(t *testing.T, started <-chan gateStart) {
+	t.Helper()
+	select {
+	case s := <-started:
+		t.Fatalf("power-on of %s started at %s, want it still waiting", s.id, s.at)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestPowerOnGateSpacing(t *testing.T) {
+	c := newFakeClock()
+	t0 := c.Now()
+	g := newPowerOnGate(5*time.Second, 0, c)
+	started := make(chan gateStart, 3)
+
+	acquireAsync(context.Background(), g, c, "1", started)
+	if s := receiveStart(t, started); !s.at.Equal(t0) {
+		t.Fatalf("first power-on started at %s, want at once", s.at)
+	}
+	acquireAsync(context.Background(), g, c, "2", started)
+	c.waitTimers(t, 1)
+	acquireAsync(context.Background(), g, c, "3", started)
+	c.waitTimers(t, 2)
+	g.mu.Lock()
+	if got := g.queued; got["2"] != 1 || got["3"] != 1 {
+		t.Errorf("queued = %v, want 2 and 3 waiting", got)
+	}
+	g.mu.Unlock()
+
+	for _, want := range []string{"2", "3"} {
+		c.advance(4 * time.Second)
+		expectNoStart(t, started)
+		c.advance(time.Second)
+		s := receiveStart(t, started)
+		if s.err != nil || s.id != want {
+			t.Fatalf("started %s (%v), want %s", s.id, s.err, want)
+		}
+		if want := t0.Add(map[string]time.Duration{"2": 5 * time.Second, "3": 10 * time.Second}[s.id]); !s.at.Equal(want) {
+			t.Errorf("power-on of %s started at %s, want %s", s.id, s.at, want)
+		}
+	}
+
+	// Later power-ons start at once when the stagger has passed.
+	c.advance(time.Minute)
+	acquireAsync(context.Background(), g, c, "1", started)
+	if s := receiveStart(t, started); !s.at.Equal(c.Now()) {
+		t.Errorf("power-on after a pause started at %s, want at once", s.at)
+	}
+}
+
+// TestPowerOnGateConcurrency checks that a power-on waiting for a slot
+// only reserves its start time once it gets one, and then still starts at
+// least the stagger after the power-on before it.
+func TestPowerOnGateConcurrency(t *testing.T) {
+	c := newFakeClock()
+	t0 := c.Now()
+	g := newPowerOnGate(5*time.Second, 1, c)
+	started := make(chan gateStart, 3)
+
+	acquireAsync(context.Background(), g, c, "1", started)
+	first := receiveStart(t, started)
+	acquireAsync(context.Background(), g, c, "2", started)
+	expectNoStart(t, started)
+	c.advance(time.Minute)
+	// Waiting for the slot, not the stagger.
+	expectNoStart(t, started)
+
+	first.release()
+	s := receiveStart(t, started)
+	if s.id != "2" || !s.at.Equal(t0.Add(time.Minute)) {
+		t.Errorf("power-on of %s started at %s, want 2 at once when the slot freed", s.id, s.at)
+	}
+
+	acquireAsync(context.Background(), g, c, "3", started)
+	expectNoStart(t, started)
+	s.release()
+	c.waitTimers(t, 1)
+	c.advance(5 * time.Second)
+	if s := receiveStart(t, started); s.id != "3" || !s.at.Equal(t0.Add(time.Minute+5*time.Second)) {
+		t.Errorf("power-on of %s started at %s, want 3 one stagger after 2", s.id, s.at)
+	}
+}
+
+// TestPowerOnGateGiveUp checks that a power-on giving up returns its start
+// time, unless a later one reserved the next.
+func TestPowerOnGateGiveUp(t *testing.T) {
+	t.Run("last reservation", func(t *testing.T) {
+		c := newFakeClock()
+		t0 := c.Now()
+		g := newPowerOnGate(5*time.Second, 0, c)
+		started := make(chan gateStart, 2)
+
+		acquireAsync(context.Background(), g, c, "1", started)
+		receiveStart(t, started)
+		ctx, cancel := context.WithCancel(context.Background())
+		acquireAsync(ctx, g, c, "2", started)
+		c.waitTimers(t, 1)
+		cancel()
+		if s := receiveStart(t, started); !errors.Is(s.err, context.Canceled) {
+			t.Fatalf("canceled power-on = %v, want context.Canceled", s.err)
+		}
+
+		c.advance(5 * time.Second)
+		acquireAsync(context.Background(), g, c, "3", started)
+		if s := receiveStart(t, started); !s.at.Equal(t0.Add(5 * time.Second)) {
+			t.Errorf("power-on after one that gave up started at %s, want at once", s.at)
+		}
+	})
+
+	t.Run("reserved after", func(t *testing.T) {
+		c := newFakeClock()
+		t0 := c.Now()
+		g := newPowerOnGate(5*time.Second, 0, c)
+		started := make(chan gateStart, 3)
+
+		acquireAsync(context.Background(), g, c, "1", started)
+		receiveStart(t, started)
+		ctx, cancel := context.WithCancel(context.Background())
+		acquireAsync(ctx, g, c, "2", started)
+		c.waitTimers(t, 1)
+		acquireAsync(context.Background(), g, c, "3", started)
+		c.waitTimers(t, 2)
+		cancel()
+		receiveStart(t, started)
+
+		c.advance(10 * time.Second)
+		if s := receiveStart(t, started); s.id != "3" {
+			t.Fatalf("started %s, want 3", s.id)
+		}
+		acquireAsync(context.Background(), g, c, "4", started)
+		c.waitTimers(t, 1)
+		c.advance(5 * time.Second)
+		if s := receiveStart(t, started); !s.at.Equal(t0.Add(15 * time.Second)) {
+			t.Errorf("power-on of 4 started at %s, want one stagger after 3", s.at)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// persistedState is the on-disk format of the state file. Only settings
+// that clients write through the API are persisted; power state always
+// comes from the backends.
+type persistedState struct {
+	// ServiceUUID keeps the ServiceRoot UUID stable when the host name
+	// changes, e.g. for a rescheduled container.
+	ServiceUUID string                     `json:"serviceUUID,omitempty"`
+	Systems     map[string]persistedSystem `json:"systems"`
+}
+
+type persistedSystem struct {
+	AssetTag string `json:"assetTag,omitempty"`
+	HostName string `json:"hostName,omitempty"`
+	Boot     *Boot  `json:"boot,omitempty"`
+	// PendingBoot waits in the Settings resource for the next reset.
+	PendingBoot *Boot `json:"pendingBoot,omitempty"`
+	// ScheduledReset is a Reset delayed through its Oem parameters.
+	ScheduledReset *scheduledReset `json:"scheduledReset,omitempty"`
+	// LastResetTime and PowerOnSeconds are the power-on accounting, which
+	// resumes from them.
+	LastResetTime  *time.Time `json:"lastResetTime,omitempty"`
+	PowerOnSeconds int64      `json:"powerOnSeconds,omitempty"`
+	// PowerState is the last known power state, to tell changes made
+	// while the shim was stopped.
+	PowerState string `json:"powerState,omitempty"`
+}
+
+// LoadState restores persisted settings from the configured state file.
+// A missing file is not an error. A state file without a service UUID
+// is written back with the current one, so it stays the same from then on.
+func (s *Server) LoadState() error {
+	if s.cfg.StateFile == "" {
+		return nil
+	}
+	var st persistedState
+	b, err := os.ReadFile(s.cfg.StateFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &st); err != nil {
+			return fmt.Errorf("state file %s: %w", s.cfg.StateFile, err)
+		}
+	}
+	if s.uuidDerived && st.ServiceUUID != "" {
+		s.cfg.ServiceUUID = st.ServiceUUID
+	}
+	s.restoreSystems(st.Systems)
+	if st.ServiceUUID != s.cfg.ServiceUUID {
+		if err := s.saveState(); err != nil {
+			return fmt.Errorf("state file %s: %w", s.cfg.StateFile, err)
+		}
+	}
+	return nil
+}
+
+// restoreSystems applies the persisted settings of the known systems.
+func (s *Server) restoreSystems(systems map[string]persistedSystem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, ps := range systems {
+		if _, ok := s.system(id); !ok {
+			log.Printf("state file: ignoring unknown system %q", id)
+			continue
+		}
+		s.asset[id] = Asset{AssetTag: ps.AssetTag, HostName: ps.HostName}
+		if ps.Boot != nil {
+			b := *ps.Boot
+			for _, dev := range b.BootOrder {
+				if !slices.Contains(s.systemInfo(id).BootDevices, dev) {
+					log.Printf("state file: system %s: dropping boot order with unknown device %q", id, dev)
+					b.BootOrder = nil
+					break
+				}
+			}
+			s.boot[id] = b
+		}
+		if ps.PendingBoot != nil {
+			s.pendingBoot[id] = *ps.PendingBoot
+		}
+		if ps.ScheduledReset != nil {
+			s.scheduled[id] = *ps.ScheduledReset
+		}
+		p := s.powerTimes[id]
+		if ps.LastResetTime != nil {
+			p.lastReset = *ps.LastResetTime
+		}
+		p.on += time.Duration(ps.PowerOnSeconds) * time.Second
+		s.powerTimes[id] = p
+		switch ps.PowerState {
+		case "On", "Off":
+			s.stoppedState[id] = ps.PowerState == "On"
+		}
+	}
+}
+
+// saveState writes the current settings to the state file, if configured.
+func (s *Server) saveState() error {
+	if s.cfg.StateFile == "" {
+		return nil
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	st := persistedState{ServiceUUID: s.cfg.ServiceUUID, Systems: map[string]persistedSystem{}}
+	s.mu.RLock()
+	for id, a := range s.asset {
+		st.Systems[id] = persistedSystem{AssetTag: a.AssetTag, HostName: a.HostName}
+	}
+	for id, b := range s.boot {
+		ps := st.Systems[id]
+		ps.Boot = &b
+		st.Systems[id] = ps
+	}
+	for id, b := range s.pendingBoot {
+		ps := st.Systems[id]
+		ps.PendingBoot = &b
+		st.Systems[id] = ps
+	}
+	for id, sr := range s.scheduled {
+		ps := st.Systems[id]
+		ps.ScheduledReset = &sr
+		st.Systems[id] = ps
+	}
+	now := s.clock.Now()
+	for id, p := range s.powerTimes {
+		ps := st.Systems[id]
+		if !p.lastReset.IsZero() {
+			t := p.lastReset.UTC().Round(time.Second)
+			ps.LastResetTime = &t
+		}
+		ps.PowerOnSeconds = int64(p.total(now) / time.Second)
+		st.Systems[id] = ps
+	}
+	for id, on := range s.stoppedState {
+		ps := st.Systems[id]
+		ps.PowerState = powerStateString(on)
+		st.Systems[id] = ps
+	}
+	for id, on := range s.last {
+		ps := st.Systems[id]
+		ps.PowerState = powerStateString(on)
+		st.Systems[id] = ps
+	}
+	s.mu.RUnlock()
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.StateFile, b, 0o600)
+}
+
+// writeFileAtomic replaces the file at path with data, so a crash never
+// leaves a partial file.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleSimpleStorage serves the configured disks of a system as a single
+// SimpleStorage controller, sub being the path below SimpleStorage.
+func (s *Server) handleSimpleStorage(w http.ResponseWriter, r *http.Request, id, sub string) {
+	disks := s.systemInfo(id).Disks
+	if len(disks) == 0 {
+		writeNotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	base := "/redfish/v1/Systems/" + id + "/SimpleStorage"
+	switch sub {
+	case "":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type":         "#SimpleStorageCollection.SimpleStorageCollection",
+			"@odata.id":           base,
+			"Name":                "Simple Storage Collection",
+			"Members":             []map[string]string{{"@odata.id": base + "/1"}},
+			"Members@odata.count": 1,
+		})
+	case "1":
+		devices := make([]map[string]any, 0, len(disks))
+		for i, d := range disks {
+			name := d.Name
+			if name == "" {
+				name = "Disk " + strconv.Itoa(i+1)
+			}
+			devices = append(devices, map[string]any{
+				"Name":          name,
+				"CapacityBytes": d.CapacityBytes,
+				"Status":        map[string]string{"State": "Enabled", "Health": "OK"},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.type": "#SimpleStorage.v1_2_0.SimpleStorage",
+			"@odata.id":   base + "/1",
+			"Id":          "1",
+			"Name":        "Simple Storage Controller",
+			"Devices":     devices,
+			"Status":      map[string]string{"State": "Enabled", "Health": "OK"},
+		})
+	default:
+		writeNotFound(w, r)
+	}
+}
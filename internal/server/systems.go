@@ -0,0 +1,939 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+	"github.com/ArthurVardevanyan/bmc-shim/internal/redfish"
+)
+
+func (s *Server) handleSystems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	p, ok := parsePaging(w, r)
+	if !ok {
+		return
+	}
+	ids := s.visibleSystemIDs(r)
+	window, next := p.page(ids)
+	var nextLink string
+	if next >= 0 {
+		nextLink = fmt.Sprintf("/redfish/v1/Systems?$top=%d&$skip=%d", p.top, next)
+	}
+	if wantsExpand(r) {
+		writeJSON(w, http.StatusOK, redfish.Collection[redfish.ComputerSystem]{
+			ODataType:    "#ComputerSystemCollection.ComputerSystemCollection",
+			ODataID:      "/redfish/v1/Systems",
+			Name:         "Systems Collection",
+			Members:      s.renderSystems(r.Context(), window, nil),
+			MembersCount: len(ids),
+			NextLink:     nextLink,
+		})
+		return
+	}
+	links := make([]redfish.Link, 0, len(window))
+	for _, id := range window {
+		links = append(links, redfish.Link{ODataID: "/redfish/v1/Systems/" + id})
+	}
+	writeJSON(w, http.StatusOK, redfish.Collection[redfish.Link]{
+		ODataType:    "#ComputerSystemCollection.ComputerSystemCollection",
+		ODataID:      "/redfish/v1/Systems",
+		Name:         "Systems Collection",
+		Members:      links,
+		MembersCount: len(ids),
+		NextLink:     nextLink,
+	})
+}
+
+func (s *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
+	// Expect paths like /redfish/v1/Systems/<id>[/<sub-resource>...]
+	path := strings.TrimPrefix(r.URL.Path, "/redfish/v1/Systems/")
+	id, sub, _ := strings.Cut(path, "/")
+	sub = strings.TrimSuffix(sub, "/")
+	if id == "" {
+		writeNotFound(w, r)
+		return
+	}
+	be, ok := s.system(id)
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+	if !inScope(r, id) {
+		s.writeOutOfScope(w, r)
+		return
+	}
+
+	switch {
+	case sub == "Actions/ComputerSystem.Reset":
+		s.handleReset(w, r, id, be)
+		return
+	case sub == "EthernetInterfaces":
+		s.handleEthernetInterfaces(w, r, id)
+		return
+	case strings.HasPrefix(sub, "EthernetInterfaces/"):
+		s.handleEthernetInterface(w, r, id, strings.TrimPrefix(sub, "EthernetInterfaces/"))
+		return
+	case sub == "ResetActionInfo":
+		s.handleResetActionInfo(w, r, id, be)
+		return
+	case sub == "Settings":
+		s.handleSettings(w, r, id, be)
+		return
+	case sub == "SimpleStorage" || strings.HasPrefix(sub, "SimpleStorage/"):
+		s.handleSimpleStorage(w, r, id, strings.TrimPrefix(strings.TrimPrefix(sub, "SimpleStorage"), "/"))
+		return
+	case sub == "LogServices" || strings.HasPrefix(sub, "LogServices/"):
+		s.handleLogServices(w, r, id, strings.TrimPrefix(strings.TrimPrefix(sub, "LogServices"), "/"))
+		return
+	case sub != "":
+		writeNotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sel := parseSelect(r)
+		sys := s.renderSystem(r.Context(), id, be, sel)
+		if sel == nil {
+			writeJSONModified(w, r, s.modifiedSince("Systems/"+id, sys), sys)
+			return
+		}
+		v, err := sel.project(sys)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, msgInternalError())
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	case http.MethodPatch:
+		s.patchSystem(w, r, id, be)
+	case http.MethodPost:
+		if s.cfg.LegacyBootPOST {
+			s.postBoot(w, r, id, be)
+			return
+		}
+		fallthrough
+	default:
+		allow := []string{http.MethodGet, http.MethodPatch}
+		if s.cfg.LegacyBootPOST {
+			allow = append(allow, http.MethodPost)
+		}
+		writeMethodNotAllowed(w, r, allow...)
+	}
+}
+
+// renderSystems renders the properties sel names of the systems with the
+// given IDs concurrently. A system whose backend does not answer in time
+// is rendered from cached state, annotated like any other failed backend
+// query. Systems removed meanwhile are left out.
+func (s *Server) renderSystems(ctx context.Context, ids []string, sel selection) []redfish.ComputerSystem {
+	backends := s.systems.Load().backends
+	present := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := backends[id]; ok {
+			present = append(present, id)
+		}
+	}
+	out, errs := fanOut(ctx, present, fanOutTimeout, func(ctx context.Context, id string) (redfish.ComputerSystem, error) {
+		return s.renderSystem(ctx, id, backends[id], sel), nil
+	})
+	for i, err := range errs {
+		if err != nil {
+			done, cancel := context.WithCancel(context.Background())
+			cancel()
+			out[i] = s.renderSystem(done, present[i], backends[present[i]], sel)
+		}
+	}
+	return out
+}
+
+const systemODataType = "#ComputerSystem.v1_13_0.ComputerSystem"
+
+// renderSystem builds the ComputerSystem resource for a system. Only the
+// properties in sel are guaranteed to be filled in: the backend is not
+// asked for what was not selected.
+func (s *Server) renderSystem(ctx context.Context, id string, be backend.System, sel selection) redfish.ComputerSystem {
+	var powerState string
+	var stateErr error
+	if sel.has("PowerState") || sel.has("Oem") {
+		powerState, stateErr = s.queryPowerState(ctx, id, be)
+	}
+
+	if s.notConnected(id) != nil {
+		// The other backend calls would be made in vain too.
+		done, cancel := context.WithCancel(ctx)
+		cancel()
+		ctx = done
+	}
+
+	info := s.systemInfo(id)
+	pt := s.powerTimeOf(id)
+	var lastResetTime string
+	if !pt.lastReset.IsZero() {
+		lastResetTime = pt.lastReset.UTC().Format(time.RFC3339)
+	}
+	var name string
+	if sel.has("Name") {
+		name = s.systemName(ctx, id, be, info)
+	}
+	uuid := info.UUID
+	if uuid == "" {
+		uuid = stableUUID(id)
+	}
+
+	s.mu.RLock()
+	asset := s.asset[id]
+	s.mu.RUnlock()
+
+	sys := redfish.ComputerSystem{
+		ODataType:   systemODataType,
+		ODataID:     "/redfish/v1/Systems/" + id,
+		ID:          id,
+		Name:        name,
+		Description: info.Description,
+		UUID:        uuid,
+		// Only report asset fields that were configured rather than
+		// inventing values; empty ones are omitted.
+		Manufacturer:  info.Manufacturer,
+		Model:         info.Model,
+		SerialNumber:  info.SerialNumber,
+		AssetTag:      asset.AssetTag,
+		HostName:      asset.HostName,
+		PowerState:    powerState,
+		LastResetTime: lastResetTime,
+		LogServices:   redfish.Link{ODataID: "/redfish/v1/Systems/" + id + "/LogServices"},
+		Links: redfish.SystemLinks{
+			ManagedBy: []redfish.Link{{ODataID: "/redfish/v1/Managers/1"}},
+			Chassis:   []redfish.Link{{ODataID: "/redfish/v1/Chassis/" + id}},
+		},
+		Actions: redfish.SystemActions{
+			Reset: redfish.ResetAction{
+				Target:          "/redfish/v1/Systems/" + id + "/Actions/ComputerSystem.Reset",
+				ActionInfo:      "/redfish/v1/Systems/" + id + "/ResetActionInfo",
+				AllowableValues: s.allowableResetTypes(id, be),
+			},
+		},
+	}
+	if sel.has("Boot") {
+		sys.Boot = s.renderBoot(id)
+	}
+	sys.Settings = s.settingsAnnotation(id)
+	if len(info.EthernetInterfaces) > 0 {
+		sys.EthernetInterfaces = &redfish.Link{ODataID: "/redfish/v1/Systems/" + id + "/EthernetInterfaces"}
+	}
+	if info.ProcessorCount > 0 || info.ProcessorModel != "" {
+		sys.ProcessorSummary = &redfish.ProcessorSummary{Count: info.ProcessorCount, Model: info.ProcessorModel}
+	}
+	if info.MemoryGiB > 0 {
+		sys.MemorySummary = &redfish.MemorySummary{TotalSystemMemoryGiB: info.MemoryGiB}
+	}
+	if len(info.Disks) > 0 {
+		sys.SimpleStorage = &redfish.Link{ODataID: "/redfish/v1/Systems/" + id + "/SimpleStorage"}
+	}
+	oem := map[string]any{}
+	if stateErr != nil {
+		// The state is the last known one; say so rather than fail.
+		sys.PowerStateInfo = []message{msgInternalError()}
+		if !s.cfg.HideBackendOem {
+			oem["BackendError"] = stateErr.Error()
+		}
+	}
+	if sel.has("Oem") {
+		if b := s.backendOem(ctx, id, be); b != nil {
+			oem["Backend"] = b
+		}
+	}
+	if s.stability(id).enabled() {
+		flapping, pending := s.flapStatus(id)
+		sys.Status = map[string]string{"State": "Enabled", "Health": severityOK}
+		if flapping {
+			sys.Status["Health"] = severityWarning
+			oem["PowerStateFlapping"] = true
+		}
+		if pending != "" {
+			oem["PendingPowerState"] = pending
+		}
+	}
+	if errors.Is(stateErr, backend.ErrStateUnknown) {
+		if sys.Status == nil {
+			sys.Status = map[string]string{"State": "Enabled"}
+		}
+		sys.Status["Health"] = severityWarning
+		oem["PowerStateUnknown"] = true
+	}
+	if origin := s.lastChangeOrigin(id); origin != "" {
+		oem["LastChangeOrigin"] = origin
+	}
+	if on := pt.total(s.clock.Now()); on > 0 {
+		oem["PowerOnHours"] = math.Round(on.Hours()*100) / 100
+	}
+	if sr, ok := s.scheduledResetOf(id); ok {
+		oem["ScheduledReset"] = scheduledResetOem(sr)
+	}
+	if sel.has("Oem") {
+		if m, ok := s.powerMetrics(ctx, id, be); ok {
+			if m.Watts != nil {
+				oem["PowerConsumedWatts"] = *m.Watts
+			}
+			if m.EnergyKWh != nil {
+				oem["EnergyKWh"] = *m.EnergyKWh
+			}
+		}
+	}
+	if len(oem) > 0 {
+		sys.Oem = map[string]any{"BmcShim": oem}
+	}
+	if ip := be.Capabilities().Indicator; ip != nil && sel.has("IndicatorLED") {
+		if led, err := cachedRead(s.cache, ctx, id, cacheIndicator, s.cfg.CacheTTL, ip.IndicatorLED); err == nil {
+			sys.IndicatorLED = led
+		}
+	}
+	sys.Overrides = s.cfg.SystemOverrides[id]
+	return sys
+}
+
+// backendOem returns the backend's Oem details, or nil if it has none,
+// they are hidden or the backend fails to report them.
+func (s *Server) backendOem(ctx context.Context, id string, be backend.System) map[string]any {
+	op := be.Capabilities().Oem
+	if op == nil || s.cfg.HideBackendOem {
+		return nil
+	}
+	m, err := cachedRead(s.cache, ctx, id, cacheOem, s.cfg.CacheTTL, op.Oem)
+	if err != nil {
+		log.Printf("system %s: backend oem: %v", id, err)
+		return nil
+	}
+	return m
+}
+
+// systemReadOnly lists ComputerSystem properties we render but which
+// clients may not PATCH.
+var systemReadOnly = map[string]bool{
+	"@odata.id": true, "@odata.type": true, "@Redfish.Settings": true,
+	"Id": true, "Name": true, "UUID": true,
+	"PowerState": true, "LastResetTime": true, "Manufacturer": true, "Model": true, "SerialNumber": true,
+	"EthernetInterfaces": true, "ProcessorSummary": true, "MemorySummary": true,
+	"SimpleStorage": true, "Links": true, "Actions": true, "Oem": true,
+}
+
+// postBoot accepts a POST of only a Boot object to a ComputerSystem, as
+// sent by clients written against BMCs that use it instead of PATCH, and
+// handles it as that PATCH (see Config.LegacyBootPOST).
+func (s *Server) postBoot(w http.ResponseWriter, r *http.Request, id string, be backend.System) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(b, &body); err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return
+	}
+	var msgs []message
+	for _, prop := range sortedKeys(body) {
+		if prop != "Boot" {
+			msgs = append(msgs, msgPropertyUnknown(prop))
+		}
+	}
+	if _, ok := body["Boot"]; !ok {
+		msgs = append(msgs, msgPropertyMissing("Boot"))
+	}
+	if len(msgs) > 0 {
+		writeError(w, http.StatusBadRequest, msgs...)
+		return
+	}
+	log.Printf("warning: system %s: Boot set with POST instead of PATCH by %s (User-Agent %q); this is deprecated", id, initiator(r), r.UserAgent())
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	s.patchSystem(w, r, id, be)
+}
+
+// patchSystem applies a PATCH to a ComputerSystem. All properties are
+// validated before anything is applied.
+func (s *Server) patchSystem(w http.ResponseWriter, r *http.Request, id string, be backend.System) {
+	body, ok := s.decodeBody(w, r, schemaComputerSystem)
+	if !ok {
+		return
+	}
+
+	var msgs []message
+	var apply []func(ctx context.Context) (message, error)
+	for _, prop := range sortedKeys(body) {
+		raw := body[prop]
+		switch prop {
+		case "IndicatorLED":
+			var led string
+			if err := json.Unmarshal(raw, &led); err != nil {
+				msgs = append(msgs, msgPropertyValueTypeError(string(raw), prop))
+				continue
+			}
+			switch led {
+			case backend.IndicatorOff, backend.IndicatorLit, backend.IndicatorBlinking:
+			default:
+				msgs = append(msgs, msgPropertyValueNotInList(led, prop))
+				continue
+			}
+			ip := be.Capabilities().Indicator
+			if ip == nil {
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+				continue
+			}
+			if _, err := cachedRead(s.cache, r.Context(), id, cacheIndicator, s.cfg.CacheTTL, ip.IndicatorLED); errors.Is(err, backend.ErrNotSupported) {
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+				continue
+			}
+			apply = append(apply, func(ctx context.Context) (message, error) {
+				err := ip.SetIndicatorLED(ctx, led)
+				s.cache.invalidate(id, cacheIndicator)
+				if errors.Is(err, backend.ErrNotSupported) {
+					return msgPropertyValueNotInList(led, prop), err
+				}
+				if err == nil {
+					s.recordEvent(id, severityOK, "IndicatorLED set to "+led+" by "+initiator(r))
+				}
+				return msgInternalError(), err
+			})
+		case "AssetTag", "HostName":
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				msgs = append(msgs, msgPropertyValueTypeError(string(raw), prop))
+				continue
+			}
+			valid := validAssetTag
+			if prop == "HostName" {
+				valid = validHostName
+			}
+			if !valid(v) {
+				msgs = append(msgs, msgPropertyValueFormatError(v, prop))
+				continue
+			}
+			apply = append(apply, func(ctx context.Context) (message, error) {
+				s.mu.Lock()
+				a := s.asset[id]
+				if prop == "AssetTag" {
+					a.AssetTag = v
+				} else {
+					a.HostName = v
+				}
+				s.asset[id] = a
+				s.mu.Unlock()
+				s.recordEvent(id, severityOK, fmt.Sprintf("%s set to %q by %s", prop, v, initiator(r)))
+				return msgInternalError(), s.saveState()
+			})
+		case "Boot":
+			boot, bmsgs := s.parseBootPatch(id, s.currentBoot(id), raw)
+			if len(bmsgs) > 0 {
+				msgs = append(msgs, bmsgs...)
+				continue
+			}
+			apply = append(apply, func(ctx context.Context) (message, error) {
+				return msgInternalError(), s.setBoot(ctx, initiator(r), id, be, boot)
+			})
+		default:
+			if systemReadOnly[prop] {
+				msgs = append(msgs, msgPropertyNotWritable(prop))
+			} else {
+				msgs = append(msgs, msgPropertyUnknown(prop))
+			}
+		}
+	}
+	if len(msgs) > 0 {
+		writeError(w, http.StatusBadRequest, msgs...)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.BackendTimeout)
+	defer cancel()
+	for _, fn := range apply {
+		if msg, err := fn(ctx); err != nil {
+			log.Printf("patch system %s: %v", id, err)
+			code := http.StatusInternalServerError
+			if errors.Is(err, backend.ErrNotSupported) {
+				code = http.StatusBadRequest
+			}
+			writeError(w, code, msg)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.renderSystem(r.Context(), id, be, nil))
+}
+
+// validAssetTag accepts up to 64 printable ASCII characters.
+func validAssetTag(v string) bool {
+	if len(v) > 64 {
+		return false
+	}
+	for _, c := range v {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// validHostName accepts an empty value or an RFC 1123 host name.
+func validHostName(v string) bool {
+	if v == "" {
+		return true
+	}
+	if len(v) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(v, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// powerState returns the Redfish PowerState of a system, preferring the
+// backend-reported state and falling back to the last known state.
+func (s *Server) powerState(ctx context.Context, id string, be backend.System) string {
+	state, _ := s.queryPowerState(ctx, id, be)
+	return state
+}
+
+// queryPowerState is powerState that also returns the error of a failed
+// backend query, in which case the state is the cached one.
+func (s *Server) queryPowerState(ctx context.Context, id string, be backend.System) (string, error) {
+	if err := s.notConnected(id); err != nil {
+		return s.powerStateCached(id), err
+	}
+	if !be.Capabilities().PowerState {
+		return s.powerStateCached(id), nil
+	}
+	state, err := s.backendState(ctx, id, be, s.cfg.CacheTTL)
+	if err != nil {
+		return s.powerStateCached(id), err
+	}
+	s.observeState(id, stateOn(state))
+	if s.stability(id).enabled() {
+		// Served once stable, without transitional states.
+		return s.powerStateCached(id), nil
+	}
+	return string(state), nil
+}
+
+// backendState queries the power state of a system, unless it was within
+// maxAge, keeping track of whether its backend reports it as unknown.
+func (s *Server) backendState(ctx context.Context, id string, be backend.System, maxAge time.Duration) (backend.PowerState, error) {
+	state, err := cachedRead(s.cache, ctx, id, cacheState, maxAge, be.State)
+	if unknown := errors.Is(err, backend.ErrStateUnknown); unknown || err == nil {
+		s.setStateUnknown(id, unknown, err)
+	}
+	return state, err
+}
+
+// setStateUnknown records whether the power state of a system is unknown,
+// logging an event when that changes.
+func (s *Server) setStateUnknown(id string, unknown bool, cause error) {
+	s.mu.Lock()
+	was := s.unknownState[id]
+	if unknown {
+		s.unknownState[id] = true
+	} else {
+		delete(s.unknownState, id)
+	}
+	s.mu.Unlock()
+	switch {
+	case unknown && !was:
+		s.recordEvent(id, severityWarning, fmt.Sprintf("Power state unknown, serving the last known state: %v", cause))
+	case !unknown && was:
+		s.recordEvent(id, severityOK, "Power state known again")
+	}
+}
+
+// stateUnknownRetry is the Retry-After of power actions refused because
+// the power state is unknown.
+const stateUnknownRetry = 10 * time.Second
+
+// checkStateKnown returns an error wrapping backend.ErrStateUnknown if
+// the backend of a system reported its power state as unknown and still
+// does, unless Config.UnknownStateActions allows acting regardless.
+func (s *Server) checkStateKnown(ctx context.Context, id string, be backend.System) error {
+	if s.cfg.UnknownStateActions {
+		return nil
+	}
+	s.mu.RLock()
+	unknown := s.unknownState[id]
+	s.mu.RUnlock()
+	if !unknown {
+		return nil
+	}
+	if _, err := s.backendState(ctx, id, be, 0); errors.Is(err, backend.ErrStateUnknown) {
+		return err
+	}
+	return nil
+}
+
+// stateOn reports whether a system in state is on or heading there.
+func stateOn(state backend.PowerState) bool {
+	return state == backend.PowerStateOn || state == backend.PowerStatePoweringOn
+}
+
+// Origins of power state changes: a power action through the API, a
+// change made elsewhere that the poller or a request noticed, and one made
+// while the shim was stopped, noticed when it first sees the system.
+const (
+	originAPI       = "api"
+	originOutOfBand = "out-of-band"
+	originStartup   = "startup-recovery"
+)
+
+// observeState records a backend-reported power state, e.g. after an
+// out-of-band change.
+func (s *Server) observeState(id string, on bool) {
+	if st := s.stability(id); st.enabled() && !s.stableState(id, on, st) {
+		return
+	}
+	s.changeState(id, on, originOutOfBand, "observed")
+}
+
+// powerChanged records a power state set through the API.
+func (s *Server) powerChanged(id string, on bool, by string) {
+	s.trustState(id, on)
+	s.changeState(id, on, originAPI, by)
+}
+
+// changeState stores the last known power state of a system. It is the
+// only place that changes it, so every transition is counted, logged,
+// notified and added to the history alike, tagged with its origin. The
+// first state seen of a system is a transition if it differs from the
+// one in the state file; the API setting a state always is one, and
+// resets the system.
+func (s *Server) changeState(id string, on bool, origin, by string) {
+	s.mu.Lock()
+	prev, known := s.last[id]
+	if stopped, ok := s.stoppedState[id]; ok && !known {
+		prev, known = stopped, true
+		if origin == originOutOfBand {
+			origin = originStartup
+		}
+	}
+	delete(s.stoppedState, id)
+	s.last[id] = on
+	s.countPowerTime(id, on)
+	changed := known && prev != on
+	if changed {
+		s.transitions[id]++
+	}
+	if origin == originAPI {
+		changed = !known || prev != on
+	}
+	if changed {
+		s.lastOrigin[id] = origin
+	}
+	s.mu.Unlock()
+	if origin == originAPI || changed {
+		s.recordReset(id)
+	}
+	if !changed {
+		return
+	}
+	from := "Unknown"
+	if known {
+		from = powerStateString(prev)
+	}
+	s.recordEntry(logEntry{
+		SystemID: id,
+		Severity: severityOK,
+		Message:  fmt.Sprintf("Power state changed from %s to %s (%s)", from, powerStateString(on), origin),
+		Origin:   origin,
+	})
+	s.notifyChange(id, prev, known, on, by, origin)
+	s.recordTransition(id, prev, known, on, by, origin)
+}
+
+// lastChangeOrigin returns the origin of the last power state change of a
+// system, or "" if none was seen.
+func (s *Server) lastChangeOrigin(id string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastOrigin[id]
+}
+
+// powerStateCached returns the last known PowerState of a system.
+func (s *Server) powerStateCached(id string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return powerStateString(s.last[id])
+}
+
+func powerStateString(on bool) string {
+	if on {
+		return "On"
+	}
+	return "Off"
+}
+
+// systemName resolves the display name of a system from the configured
+// name and the backend's DisplayName, honoring the configured precedence.
+func (s *Server) systemName(ctx context.Context, id string, be backend.System, info SystemInfo) string {
+	if info.Name != "" && !s.cfg.PreferBackendName {
+		return info.Name
+	}
+	if np := be.Capabilities().Name; np != nil {
+		if n, err := cachedRead(s.cache, ctx, id, cacheName, s.cfg.CacheTTL, np.DisplayName); err == nil && n != "" {
+			return n
+		}
+	}
+	if info.Name != "" {
+		return info.Name
+	}
+	return "System " + id
+}
+
+// uuidNamespace is the namespace for the name-based UUIDs generated for
+// systems without a configured UUID.
+var uuidNamespace = [16]byte{0x6b, 0x1f, 0x4e, 0x0a, 0x8c, 0x52, 0x4d, 0x7e, 0x9a, 0x31, 0x2e, 0x5c, 0x70, 0xd4, 0x13, 0xb8}
+
+// stableUUID returns a deterministic RFC 4122 version 5 UUID for a system ID,
+// so the same ID always reports the same UUID across restarts.
+func stableUUID(id string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace[:])
+	h.Write([]byte(id))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// errUnsupportedResetType is returned by applyReset for unknown ResetTypes.
+var errUnsupportedResetType = errors.New("unsupported ResetType")
+
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request, id string, be backend.System) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	var body struct {
+		ResetType string
+		Oem       struct{ BmcShim resetSchedule }
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, msgMalformedJSON())
+		return
+	}
+	if body.ResetType == "" {
+		writeError(w, http.StatusBadRequest, msgActionParameterMissing("ComputerSystem.Reset", "ResetType"))
+		return
+	}
+	for _, h := range dryRunHeaders {
+		if r.Header.Get(h) != "" {
+			writeError(w, http.StatusBadRequest, msgActionParameterNotSupported(h, "ComputerSystem.Reset"))
+			return
+		}
+	}
+	if rs := body.Oem.BmcShim; rs.requested() {
+		s.scheduleReset(w, r, id, be, body.ResetType, rs)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.resetTimeout())
+	defer cancel()
+	writeResetResult(w, s.resetSystem(ctx, id, be, body.ResetType, initiator(r)))
+}
+
+// resetResult is the outcome of a reset of one system, as answered to the
+// client.
+type resetResult struct {
+	// outcome is that recorded in the history: performed, skipped,
+	// simulated, failed or refused.
+	outcome string
+	code    int
+	// msgs are the messages of an error.
+	msgs []message
+	// retryAfter is the Retry-After in seconds of a 429 or 503, if any.
+	retryAfter int
+	// oem is Oem.BmcShim of a success answered with a body.
+	oem map[string]any
+}
+
+// ok reports whether the reset succeeded.
+func (res resetResult) ok() bool {
+	return res.code < 300
+}
+
+// writeResetResult answers a reset request of one system.
+func writeResetResult(w http.ResponseWriter, res resetResult) {
+	if res.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(res.retryAfter))
+	}
+	switch {
+	case res.code == http.StatusNoContent:
+		w.WriteHeader(http.StatusNoContent)
+	case res.ok():
+		writeJSON(w, res.code, map[string]any{
+			"@Message.ExtendedInfo": []message{msgSuccess()},
+			"Oem":                   map[string]any{"BmcShim": res.oem},
+		})
+	default:
+		writeError(w, res.code, res.msgs...)
+	}
+}
+
+// resetSystem resets a system right away, or simulates it in dry-run
+// mode, recording the outcome.
+func (s *Server) resetSystem(ctx context.Context, id string, be backend.System, resetType, by string) resetResult {
+	if s.dryRun(id) {
+		return s.simulateReset(id, be, resetType, by)
+	}
+	noop, err := s.applyReset(ctx, id, be, resetType, by)
+	if err != nil {
+		if errors.Is(err, errUnsupportedResetType) {
+			return resetResult{outcome: "refused", code: http.StatusBadRequest, msgs: []message{msgActionParameterValueFormatError(resetType, "ResetType", "ComputerSystem.Reset")}}
+		}
+		if errors.Is(err, errReadOnly) {
+			return resetResult{outcome: "refused", code: http.StatusServiceUnavailable, retryAfter: readOnlyRetryAfter, msgs: []message{msgServiceTemporarilyUnavailable(strconv.Itoa(readOnlyRetryAfter))}}
+		}
+		var re *backend.RetryableError
+		if errors.As(err, &re) {
+			retry := max(int(re.RetryAfter.Round(time.Second)/time.Second), 1)
+			s.recordEvent(id, severityWarning, fmt.Sprintf("Reset %s requested by %s failed: %v", resetType, by, err))
+			s.recordAction(id, resetType, by, "failed", err)
+			return resetResult{outcome: "failed", code: http.StatusServiceUnavailable, retryAfter: retry, msgs: []message{msgServiceTemporarilyUnavailable(strconv.Itoa(retry))}}
+		}
+		var cd *cooldownError
+		if errors.As(err, &cd) {
+			s.recordEvent(id, severityWarning, fmt.Sprintf("Reset %s requested by %s refused: %v", resetType, by, err))
+			s.recordAction(id, resetType, by, "refused", err)
+			return resetResult{outcome: "refused", code: http.StatusTooManyRequests, retryAfter: cd.retrySeconds(), msgs: []message{msgServiceTemporarilyUnavailable(strconv.Itoa(cd.retrySeconds()))}}
+		}
+		s.recordEvent(id, severityWarning, fmt.Sprintf("Reset %s requested by %s failed: %v", resetType, by, err))
+		s.recordAction(id, resetType, by, "failed", err)
+		return resetResult{outcome: "failed", code: http.StatusInternalServerError, msgs: []message{msgInternalError()}}
+	}
+	// The latest request wins: an immediate reset supersedes a scheduled
+	// one.
+	s.cancelScheduledReset(id, fmt.Sprintf("cancelled by Reset %s requested by %s", resetType, by))
+	if noop {
+		log.Printf("system %s: Reset %s skipped, already %s", id, resetType, s.powerStateCached(id))
+		s.recordAction(id, resetType, by, "skipped", nil)
+		return resetResult{outcome: "skipped", code: http.StatusOK, oem: map[string]any{"NoOperation": true}}
+	}
+	s.recordEvent(id, severityOK, fmt.Sprintf("Reset %s requested by %s", resetType, by))
+	s.recordAction(id, resetType, by, "performed", nil)
+	return resetResult{outcome: "performed", code: http.StatusNoContent}
+}
+
+// applyReset performs a reset on the backend. noop is true when the
+// system already was in the requested state and the backend was not called;
+// by names the initiator for notifications.
+func (s *Server) applyReset(ctx context.Context, id string, be backend.System, resetType, by string) (noop bool, err error) {
+	defer func() {
+		if reason := rejectReason(err); reason != "" {
+			s.actions.reject(id, reason)
+		}
+	}()
+	s.actionMu.RLock()
+	defer s.actionMu.RUnlock()
+	// Checked again under actionMu in case the mode flipped after the
+	// middleware let the request through.
+	if s.ReadOnly() {
+		return false, errReadOnly
+	}
+	if err := s.notConnected(id); err != nil {
+		return false, &backend.RetryableError{Err: err, RetryAfter: warmUpRetryMin}
+	}
+	// From here on resetType is what the backend is asked to do.
+	resetType, err = s.mappedResetType(id, resetType)
+	if err != nil {
+		return false, err
+	}
+	if _, err := resetCalls(be, resetType); err != nil {
+		return false, err
+	}
+	if !s.cfg.ReassertPowerState && s.inState(ctx, id, be, resetType) {
+		return true, nil
+	}
+	if err := s.checkStateKnown(ctx, id, be); err != nil {
+		return false, &backend.RetryableError{Err: err, RetryAfter: stateUnknownRetry}
+	}
+	if powersOn(resetType) {
+		release, err := s.awaitPowerOn(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		defer release()
+	}
+	if skip, err := s.reserveAction(id, resetType); skip || err != nil {
+		return skip, err
+	}
+	defer s.actions.begin(id)()
+	if powersOn(resetType) {
+		s.applyPendingSettings(ctx, id, be, by)
+	}
+	err = be.Reset(ctx, backend.ResetType(resetType))
+	// Whatever the backend did, what it reported before is outdated.
+	s.cache.invalidate(id)
+	if err != nil {
+		return false, err
+	}
+	if on, ok := targetState(resetType); ok {
+		s.powerChanged(id, on, by)
+	} else if resetType != "Nmi" {
+		// Restarts and power cycles leave the system on.
+		s.powerChanged(id, true, by)
+	}
+	if powersOn(resetType) {
+		return false, s.afterPowerOn(ctx, id, by)
+	}
+	return false, nil
+}
+
+// inState reports whether the system is known to already be in the state
+// resetType asks for. The backend is asked when it can report state,
+// otherwise the last known state is used.
+func (s *Server) inState(ctx context.Context, id string, be backend.System, resetType string) bool {
+	want, ok := targetState(resetType)
+	if !ok {
+		return false
+	}
+	if be.Capabilities().PowerState {
+		state, err := s.backendState(ctx, id, be, 0)
+		if err == nil {
+			on := stateOn(state)
+			s.observeState(id, on)
+			return on == want
+		}
+		if errors.Is(err, backend.ErrStateUnknown) {
+			// The last known state may be stale.
+			return false
+		}
+	}
+	s.mu.RLock()
+	on, known := s.last[id]
+	s.mu.RUnlock()
+	return known && on == want
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// systemSet is the systems served at a time. It is never modified;
+// SetSystems replaces it as a whole, so readers need no locking.
+type systemSet struct {
+	backends map[string]backend.System
+	info     map[string]SystemInfo
+	logs     map[string]*eventLog
+	// ids are the system IDs in sorted order.
+	ids []string
+}
+
+// newSystemSet builds a set, keeping the event logs of systems in prev.
+func newSystemSet(backends map[string]backend.System, info map[string]SystemInfo, prev *systemSet, logEntries int) *systemSet {
+	set := &systemSet{
+		backends: maps.Clone(backends),
+		info:     map[string]SystemInfo{},
+		logs:     make(map[string]*eventLog, len(backends)),
+		ids:      slices.Sorted(maps.Keys(backends)),
+	}
+	for id := range backends {
+		set.info[id] = info[id]
+		if l, ok := prev.logs[id]; ok {
+			set.logs[id] = l
+		} else {
+			set.logs[id] = newEventLog(logEntries)
+		}
+	}
+	return set
+}
+
+// SetSystems replaces the served systems, e.g. after they were discovered
+// again. Systems that remain keep their event log and settings; requests
+// already running finish with the backend they started with.
+func (s *Server) SetSystems(backends map[string]backend.System, info map[string]SystemInfo) {
+	s.setSystemsMu.Lock()
+	defer s.setSystemsMu.Unlock()
+	prev := s.systems.Load()
+	next := newSystemSet(backends, info, prev, s.cfg.LogEntries)
+	var added, removed []string
+	for _, id := range next.ids {
+		if _, ok := prev.backends[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for _, id := range prev.ids {
+		if _, ok := next.backends[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	s.systems.Store(next)
+	s.warm.forget(removed)
+	starting := map[string]backend.System{}
+	for _, id := range added {
+		starting[id] = next.backends[id]
+	}
+	s.warm.track(starting)
+	if s.listening.Load() != nil && len(added) > 0 {
+		s.bg.Go(func() { s.warmUpSystems(s.bgCtx, added) })
+	}
+
+	if len(removed) > 0 {
+		// Forget the observed state so that a system coming back starts
+		// fresh; settings (boot, asset) are kept for it.
+		s.mu.Lock()
+		for _, id := range removed {
+			s.countPowerTime(id, false)
+			delete(s.last, id)
+			delete(s.lastOrigin, id)
+			delete(s.stoppedState, id)
+			delete(s.up, id)
+			delete(s.unknownState, id)
+			delete(s.hysteresis, id)
+		}
+		s.mu.Unlock()
+		for _, id := range removed {
+			s.cache.invalidate(id)
+		}
+		log.Printf("systems removed: %s", strings.Join(removed, ", "))
+	}
+	if len(added) > 0 {
+		log.Printf("systems added: %s", strings.Join(added, ", "))
+	}
+}
+
+// system returns the backend of a system.
+func (s *Server) system(id string) (backend.System, bool) {
+	be, ok := s.systems.Load().backends[id]
+	return be, ok
+}
+
+// systemInfo returns the configured metadata of a system.
+func (s *Server) systemInfo(id string) SystemInfo {
+	return s.systems.Load().info[id]
+}
+
+// eventLogFor returns the event log of a system, or nil for an unknown one.
+func (s *Server) eventLogFor(id string) *eventLog {
+	return s.systems.Load().logs[id]
+}
+
+// systemIDs returns the system IDs in stable sorted order.
+func (s *Server) systemIDs() []string {
+	return slices.Clone(s.systems.Load().ids)
+}
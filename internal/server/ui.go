@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+const uiPath = "/ui"
+
+// uiRefresh is how often the status page reloads itself, in seconds.
+const uiRefresh = 10
+
+// uiTokenMaxAge is how long the CSRF token of a status page is accepted,
+// so a page left open for a day needs a reload before its buttons work.
+const uiTokenMaxAge = 12 * time.Hour
+
+//go:embed ui/status.html
+var uiFiles embed.FS
+
+var uiTemplate = template.Must(template.ParseFS(uiFiles, "ui/status.html"))
+
+// uiButtons are the buttons of the status page: a label and the
+// ResetTypes it sends, the first one a system supports.
+var uiButtons = []struct {
+	label string
+	types []string
+}{
+	{"On", []string{string(backend.ResetOn)}},
+	{"Off", []string{string(backend.ResetGracefulShutdown), string(backend.ResetForceOff)}},
+	{"Restart", []string{string(backend.ResetGracefulRestart), string(backend.ResetForceRestart)}},
+}
+
+type uiAction struct {
+	Label     string
+	ResetType string
+}
+
+type uiSystem struct {
+	ID         string
+	Name       string
+	PowerState string
+	Health     string
+	// Detail says why the health is not OK.
+	Detail  string
+	Actions []uiAction
+}
+
+type uiPage struct {
+	Prefix     string
+	Self       string
+	Refresh    int
+	Flash      string
+	ReadOnly   bool
+	CanOperate bool
+	CSRF       string
+	Systems    []uiSystem
+}
+
+// setupUI generates the key signing the CSRF tokens and results of the
+// status page, if it is served. Until then, the page is unavailable.
+func (s *Server) setupUI() error {
+	if !s.cfg.UI || s.uiKey != nil {
+		return nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("status page key: %w", err)
+	}
+	s.uiKey = key
+	return nil
+}
+
+// handleUIRoot sends browsers opening the service to the status page.
+func (s *Server) handleUIRoot(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, s.urlPrefix(r)+uiPath, http.StatusFound)
+}
+
+// handleUI serves the status page: the systems the client may see with
+// their power state and health and, for operators, buttons posting to
+// /ui/reset. It is rendered like $expand of the Systems collection, so a
+// slow backend shows its last known state.
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+	if s.uiKey == nil {
+		writeError(w, http.StatusServiceUnavailable)
+		return
+	}
+	prefix := s.urlPrefix(r)
+	page := uiPage{
+		Prefix:     prefix,
+		Self:       prefix + uiPath,
+		Refresh:    uiRefresh,
+		ReadOnly:   s.ReadOnly(),
+		CanOperate: s.uiCanOperate(r),
+	}
+	q := r.URL.Query()
+	if text := q.Get("result"); text != "" && hmac.Equal([]byte(q.Get("sig")), []byte(s.uiMAC("result", text))) {
+		page.Flash = text
+	}
+	if page.CanOperate {
+		page.CSRF = s.uiToken(uiWho(r), time.Now())
+	}
+	sel := selection{"Name": true, "PowerState": true}
+	for _, sys := range s.renderSystems(r.Context(), s.visibleSystemIDs(r), sel) {
+		u := uiSystem{ID: sys.ID, Name: sys.Name, PowerState: sys.PowerState}
+		if name, ok := sys.Overrides["Name"]; ok {
+			json.Unmarshal(name, &u.Name)
+		}
+		if u.PowerState == "" {
+			u.PowerState = "Unknown"
+		}
+		u.Health, u.Detail = s.uiHealth(sys.ID, sys.Status, len(sys.PowerStateInfo) > 0)
+		if page.CanOperate {
+			allowed := sys.Actions.Reset.AllowableValues
+			for _, b := range uiButtons {
+				for _, t := range b.types {
+					if slices.Contains(allowed, t) {
+						u.Actions = append(u.Actions, uiAction{Label: b.label, ResetType: t})
+						break
+					}
+				}
+			}
+		}
+		page.Systems = append(page.Systems, u)
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	if err := uiTemplate.Execute(w, page); err != nil {
+		log.Printf("status page: %v", err)
+	}
+}
+
+// uiHealth sums up the health of a system for the status page.
+func (s *Server) uiHealth(id string, status map[string]string, stateFailed bool) (health, detail string) {
+	if err := s.notConnected(id); err != nil {
+		return severityCritical, "backend not connected"
+	}
+	s.mu.RLock()
+	up, known := s.up[id]
+	s.mu.RUnlock()
+	switch {
+	case known && !up:
+		return severityCritical, "health check failing"
+	case status["Health"] != "" && status["Health"] != severityOK:
+		return status["Health"], "power state unknown or flapping"
+	case stateFailed:
+		return severityWarning, "backend error, showing the last known state"
+	}
+	return severityOK, ""
+}
+
+// handleUIReset carries out a button of the status page like the Reset
+// action of the system, then sends the browser back to the page with the
+// outcome.
+func (s *Server) handleUIReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if s.uiKey == nil {
+		writeError(w, http.StatusServiceUnavailable)
+		return
+	}
+	if !s.uiCanOperate(r) {
+		writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	if !s.validUIToken(r.PostFormValue("csrf"), uiWho(r), time.Now()) {
+		log.Printf("status page: reset refused: client %s: missing or invalid CSRF token", clientIP(r))
+		writeError(w, http.StatusForbidden, msgInsufficientPrivilege())
+		return
+	}
+	id, resetType := r.PostFormValue("system"), r.PostFormValue("ResetType")
+	be, ok := s.system(id)
+	if !ok || !inScope(r, id) {
+		writeError(w, http.StatusNotFound, newMessage("ResourceMissingAtURI", "/redfish/v1/Systems/"+id))
+		return
+	}
+	res := s.resetSystem(r.Context(), id, be, resetType, initiator(r))
+	text := fmt.Sprintf("%s of system %s: %s", resetType, id, res.outcome)
+	if !res.ok() && len(res.msgs) > 0 {
+		text += " (" + res.msgs[0].Message + ")"
+	}
+	v := url.Values{"result": {text}, "sig": {s.uiMAC("result", text)}}
+	http.Redirect(w, r, s.urlPrefix(r)+uiPath+"?"+v.Encode(), http.StatusSeeOther)
+}
+
+// uiCanOperate reports whether the client of r gets the buttons of the
+// status page: operators, or everyone without authentication, unless the
+// service is read-only.
+func (s *Server) uiCanOperate(r *http.Request) bool {
+	if s.ReadOnly() {
+		return false
+	}
+	if !s.authRequired() {
+		return true
+	}
+	p, ok := requestPrincipal(r)
+	return ok && allowed(p.Role, http.MethodPost)
+}
+
+// uiWho is who a CSRF token is issued to.
+func uiWho(r *http.Request) string {
+	p, _ := requestPrincipal(r)
+	return p.Name
+}
+
+// uiToken returns a CSRF token for the buttons of a status page served
+// to who: the time it was issued, signed with the key of the process, so
+// that another site cannot forge a button post and no state is kept.
+func (s *Server) uiToken(who string, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return ts + "." + s.uiMAC("csrf", ts, who)
+}
+
+// validUIToken reports whether token was issued to who by uiToken within
+// uiTokenMaxAge.
+func (s *Server) validUIToken(token, who string, now time.Time) bool {
+	ts, mac, ok := strings.Cut(token, ".")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if !ok || err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age < 0 || age > uiTokenMaxAge {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(s.uiMAC("csrf", ts, who)))
+}
+
+// uiMAC signs parts with the key of the process.
+func (s *Server) uiMAC(parts ...string) string {
+	m := hmac.New(sha256.New, s.uiKey)
+	for _, p := range parts {
+		m.Write([]byte(p))
+		m.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
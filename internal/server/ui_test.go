@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+func TestUIDisabledByDefault(t *testing.T) {
+	s := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(&bootBackend{})}})
+	if err := s.setupUI(); err != nil {
+		t.Fatal(err)
+	}
+	if s.uiKey != nil {
+		t.Error("status page key generated without UI")
+	}
+	if rec := request(s.Handler(), http.MethodGet, uiPath, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s: status %d, want 404", uiPath, rec.Code)
+	}
+}
+
+func TestUIStatusPage(t *testing.T) {
+	s := New(Config{UI: true, Systems: map[string]backend.System{"node-a": backend.Adapt(&bootBackend{})}})
+	// The key comes from Start, so the page is unavailable until then.
+	if rec := request(s.Handler(), http.MethodGet, uiPath, ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET %s before setup: status %d, want 503", uiPath, rec.Code)
+	}
+	if err := s.setupUI(); err != nil {
+		t.Fatal(err)
+	}
+	rec := request(s.Handler(), http.MethodGet, uiPath, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, want 200", uiPath, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "node-a") {
+		t.Errorf("status page does not list node-a:\n%s", rec.Body.String())
+	}
+	if rec := request(s.Handler(), http.MethodPost, uiPath+"/reset", "system=node-a&ResetType=On"); rec.Code != http.StatusForbidden {
+		t.Errorf("POST without CSRF token: status %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// flakyStateBackend is a Backend whose power state can be made unknown,
+// as that of a Home Assistant entity going unavailable.
+type flakyStateBackend struct {
+	mu      sync.Mutex
+	on      bool
+	unknown bool
+	calls   int
+}
+
+func (f *flakyStateBackend) switchTo(on bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.on = on
+	return nil
+}
+
+func (f *flakyStateBackend) PowerOn(ctx context.Context) error  { return f.switchTo(true) }
+func (f *flakyStateBackend) PowerOff(ctx context.Context) error { return f.switchTo(false) }
+
+func (f *flakyStateBackend) CurrentState(ctx context.Context) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.unknown {
+		return false, fmt.Errorf("switch.node1 is unavailable: %w", backend.ErrStateUnknown)
+	}
+	return f.on, nil
+}
+
+func (f *flakyStateBackend) setUnknown(unknown bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unknown = unknown
+}
+
+// systemHealth returns the PowerState, Status.Health and whether Oem marks
+// the state unknown of system 1.
+func systemHealth(t *testing.T, h http.Handler) (state, health string, unknown bool) {
+	t.Helper()
+	_, sys := getJSON(t, h, "/redfish/v1/Systems/1")
+	state, _ = sys["PowerState"].(string)
+	if st, ok := sys["Status"].(map[string]any); ok {
+		health, _ = st["Health"].(string)
+	}
+	oem, _ := sys["Oem"].(map[string]any)
+	shim, _ := oem["BmcShim"].(map[string]any)
+	unknown, _ = shim["PowerStateUnknown"].(bool)
+	return state, health, unknown
+}
+
+// TestUnknownStateTransitions follows a system whose state becomes unknown
+// and known again: the last known state is served with a warning and power
+// actions are refused meanwhile.
+func TestUnknownStateTransitions(t *testing.T) {
+	be := &flakyStateBackend{on: true}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}}).Handler()
+
+	if state, health, unknown := systemHealth(t, h); state != "On" || health == severityWarning || unknown {
+		t.Fatalf("known state: %s, health %q, unknown %v", state, health, unknown)
+	}
+
+	be.setUnknown(true)
+	if state, health, unknown := systemHealth(t, h); state != "On" || health != severityWarning || !unknown {
+		t.Errorf("unknown state: %s, health %q, unknown %v; want On with a warning", state, health, unknown)
+	}
+	rec := resetRequest(h, "ForceOff")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("ForceOff while unknown = %d (Retry-After %q), want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if be.calls != 0 {
+		t.Errorf("backend called %d times while the state was unknown", be.calls)
+	}
+	expectMetrics(t, h, `bmc_shim_power_actions_rejected_total{system="1",reason="state_unknown"} 1`)
+
+	be.setUnknown(false)
+	if state, health, unknown := systemHealth(t, h); state != "On" || health == severityWarning || unknown {
+		t.Errorf("known again: %s, health %q, unknown %v", state, health, unknown)
+	}
+	if rec := resetRequest(h, "ForceOff"); rec.Code != http.StatusNoContent {
+		t.Errorf("ForceOff once known again = %d, want 204", rec.Code)
+	}
+	if state, _, _ := systemHealth(t, h); state != "Off" {
+		t.Errorf("PowerState after ForceOff = %s", state)
+	}
+}
+
+func TestUnknownStateActionsAllowed(t *testing.T) {
+	be := &flakyStateBackend{on: true}
+	h := New(Config{Systems: map[string]backend.System{"1": backend.Adapt(be)}, UnknownStateActions: true}).Handler()
+	systemHealth(t, h)
+	be.setUnknown(true)
+	systemHealth(t, h)
+	if rec := resetRequest(h, "ForceOff"); rec.Code != http.StatusNoContent || be.calls != 1 {
+		t.Errorf("ForceOff while unknown = %d with %d backend calls, want 204 with UnknownStateActions", rec.Code, be.calls)
+	}
+}
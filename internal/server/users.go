@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// User is a basic auth account from Config.UsersFile.
+type User struct {
+	Name     string
+	Password string
+	Role     string
+	// Systems are the system IDs the user may see and act on; nil means
+	// all of them.
+	Systems []string
+}
+
+// ParseUser parses "name password [role [systems]]", separated by
+// whitespace, where systems is a comma-separated list of system IDs or
+// "*" for all (the default). The role defaults to operator.
+func ParseUser(s string) (User, error) {
+	f := strings.Fields(s)
+	if len(f) < 2 || len(f) > 4 {
+		return User{}, fmt.Errorf("invalid user entry: expected \"name password [role [systems]]\"")
+	}
+	u := User{Name: f[0], Password: f[1], Role: RoleOperator}
+	if len(f) > 2 {
+		u.Role = f[2]
+	}
+	if u.Role != RoleReader && u.Role != RoleOperator {
+		return User{}, fmt.Errorf("user %s: invalid role %q (expected %s or %s)", u.Name, u.Role, RoleReader, RoleOperator)
+	}
+	if len(f) > 3 {
+		systems, err := parseScope(f[3])
+		if err != nil {
+			return User{}, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+		u.Systems = systems
+	}
+	return u, nil
+}
+
+// parseScope parses a comma-separated list of system IDs; "*" means all
+// systems and yields nil.
+func parseScope(s string) ([]string, error) {
+	if s == "*" {
+		return nil, nil
+	}
+	var ids []string
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("empty system list %q (use * for all systems)", s)
+	}
+	return ids, nil
+}
+
+// LoadUsers (re)reads Config.UsersFile and replaces the accepted users, so
+// removing a line revokes that account. On error the previous users stay
+// in effect. Blank lines and lines starting with # are ignored.
+func (s *Server) LoadUsers() error {
+	if s.cfg.UsersFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.cfg.UsersFile)
+	if err != nil {
+		return err
+	}
+	var users []User
+	names := map[string]bool{s.cfg.Username: s.cfg.Username != ""}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := ParseUser(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", s.cfg.UsersFile, n, err)
+		}
+		if names[u.Name] {
+			return fmt.Errorf("%s:%d: duplicate user %q", s.cfg.UsersFile, n, u.Name)
+		}
+		names[u.Name] = true
+		for _, id := range u.Systems {
+			if _, ok := s.system(id); !ok {
+				log.Printf("warning: %s:%d: user %s is scoped to unknown system %q", s.cfg.UsersFile, n, u.Name, id)
+			}
+		}
+		users = append(users, u)
+	}
+	s.users.Store(&users)
+	log.Printf("loaded %d users", len(users))
+	return nil
+}
+
+// lookupUser returns the user with the given name and password. Like
+// lookupAPIKey, it compares against every user in constant time.
+func (s *Server) lookupUser(name, password string) (User, bool) {
+	users := s.users.Load()
+	if users == nil {
+		return User{}, false
+	}
+	got := sha256.Sum256([]byte(name + "\x00" + password))
+	var match User
+	ok := false
+	for _, u := range *users {
+		want := sha256.Sum256([]byte(u.Name + "\x00" + u.Password))
+		if subtle.ConstantTimeCompare(got[:], want[:]) == 1 {
+			match, ok = u, true
+		}
+	}
+	return match, ok
+}
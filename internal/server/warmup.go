@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ArthurVardevanyan/bmc-shim/backend"
+)
+
+// DefaultBackendStartTimeout bounds each attempt to start a backend.
+const DefaultBackendStartTimeout = 30 * time.Second
+
+// warmUpRetryMin and warmUpRetryMax bound the backoff between attempts
+// to start a backend that failed to.
+const (
+	warmUpRetryMin = 5 * time.Second
+	warmUpRetryMax = 5 * time.Minute
+)
+
+// errNotConnected is wrapped by the error of a system whose backend has
+// not started yet.
+var errNotConnected = errors.New("backend not connected")
+
+// errStarting is why a backend is not connected while it is first
+// started.
+var errStarting = errors.New("starting")
+
+// warmUp tracks the systems whose backend (a backend.Starter) has not
+// started yet. Such a system is degraded: it is served from cached state
+// and power actions are refused until its backend connected.
+type warmUp struct {
+	mu sync.Mutex
+	// degraded is why each degraded system's backend is not connected.
+	degraded map[string]error
+}
+
+// track marks the systems whose backend needs starting as degraded until
+// it started, and returns their IDs.
+func (w *warmUp) track(systems map[string]backend.System) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.degraded == nil {
+		w.degraded = map[string]error{}
+	}
+	var ids []string
+	for _, id := range sortedKeys(systems) {
+		if systems[id].Capabilities().Start != nil {
+			w.degraded[id] = errStarting
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// set records the outcome of an attempt to start a system's backend. It
+// reports false if the system is no longer tracked, e.g. was removed.
+func (w *warmUp) set(id string, err error) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.degraded[id]; !ok {
+		return false
+	}
+	if err == nil {
+		delete(w.degraded, id)
+	} else {
+		w.degraded[id] = err
+	}
+	return true
+}
+
+// forget stops tracking the given systems.
+func (w *warmUp) forget(ids []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range ids {
+		delete(w.degraded, id)
+	}
+}
+
+// notConnected returns an error wrapping errNotConnected if the backend
+// of a system has not started yet, and nil otherwise.
+func (s *Server) notConnected(id string) error {
+	s.warm.mu.Lock()
+	defer s.warm.mu.Unlock()
+	if err, ok := s.warm.degraded[id]; ok {
+		return fmt.Errorf("%w: %v", errNotConnected, err)
+	}
+	return nil
+}
+
+// warmUpSystems starts the backends of the given systems concurrently and
+// logs each system's initial health: whether its backend connected or,
+// for backends without connections, passes its health check. Backends
+// that fail to start are retried in the background.
+func (s *Server) warmUpSystems(ctx context.Context, ids []string) {
+	// took is how long the start or health check took, or -1 if the
+	// backend has neither.
+	took, errs := fanOut(ctx, ids, s.cfg.BackendStartTimeout, func(ctx context.Context, id string) (time.Duration, error) {
+		be, ok := s.system(id)
+		if !ok {
+			return -1, nil
+		}
+		begin := time.Now()
+		caps := be.Capabilities()
+		switch {
+		case caps.Start != nil:
+			err := caps.Start.Start(ctx)
+			return time.Since(begin), err
+		case caps.Health != nil:
+			err := s.ping(ctx, id, be, 0)
+			s.setUp(id, err == nil)
+			return time.Since(begin), err
+		}
+		return -1, nil
+	})
+	ready := 0
+	for i, id := range ids {
+		be, ok := s.system(id)
+		if !ok {
+			continue
+		}
+		err := errs[i]
+		if st := be.Capabilities().Start; st != nil {
+			if !s.warm.set(id, err) {
+				continue
+			}
+			if err != nil {
+				log.Printf("startup: system %s degraded, backend not connected: %v", id, err)
+				s.bg.Go(func() { s.retryStart(s.bgCtx, id, st) })
+				continue
+			}
+			log.Printf("startup: system %s connected in %s", id, took[i].Round(time.Millisecond))
+		} else if err != nil {
+			log.Printf("startup: system %s unhealthy: %v", id, err)
+			continue
+		} else if took[i] < 0 {
+			log.Printf("startup: system %s has no health check", id)
+		} else {
+			log.Printf("startup: system %s healthy in %s", id, took[i].Round(time.Millisecond))
+		}
+		ready++
+	}
+	log.Printf("startup: %d of %d systems ready", ready, len(ids))
+}
+
+// retryStart starts a system's backend until it succeeds, the system is
+// removed or ctx is done, backing off between attempts.
+func (s *Server) retryStart(ctx context.Context, id string, st backend.Starter) {
+	delay := warmUpRetryMin
+	for {
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		sctx, cancel := context.WithTimeout(ctx, s.cfg.BackendStartTimeout)
+		err := st.Start(sctx)
+		cancel()
+		if ctx.Err() != nil || !s.warm.set(id, err) {
+			return
+		}
+		if err == nil {
+			s.recordEvent(id, severityOK, "Backend connected")
+			return
+		}
+		log.Printf("system %s: backend not connected: %v", id, err)
+		delay = min(2*delay, warmUpRetryMax)
+	}
+}